@@ -130,6 +130,14 @@ build_authtool() {
     popd >/dev/null
 }
 
+build_cli() {
+    set_go_path
+    pushd $SrcPath >/dev/null
+    echo -n "build cfs-cli "
+    go build $MODFLAGS -ldflags "${LDFlags}" -o ${BuildBinPath}/cfs-cli ${SrcPath}/cli/*.go  && echo "success" || echo "failed"
+    popd >/dev/null
+}
+
 clean() {
     ${RM} ${BuildBinPath}
 }
@@ -161,6 +169,9 @@ case "$cmd" in
     "authtool")
         build_authtool
         ;;
+    "cli")
+        build_cli
+        ;;
     "clean")
         clean
         ;;
@@ -0,0 +1,282 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The views below mirror the replies of the master which are not defined in proto.
+
+type clusterView struct {
+	Name               string
+	LeaderAddr         string
+	DisableAutoAlloc   bool
+	MetaNodeThreshold  float32
+	Applied            uint64
+	MaxDataPartitionID uint64
+	MaxMetaNodeID      uint64
+	MaxMetaPartitionID uint64
+	DataNodeStatInfo   *nodeStatInfo
+	MetaNodeStatInfo   *nodeStatInfo
+	VolStatInfo        []*volStatInfo
+	BadPartitionIDs    []badPartitionView
+	MetaNodes          []nodeView
+	DataNodes          []nodeView
+}
+
+type nodeStatInfo struct {
+	TotalGB     uint64
+	UsedGB      uint64
+	IncreasedGB int64
+	UsedRatio   string
+}
+
+type volStatInfo struct {
+	Name      string
+	TotalGB   uint64
+	UsedGB    uint64
+	UsedRatio string
+}
+
+type badPartitionView struct {
+	DiskPath     string
+	PartitionIDs []uint64
+}
+
+type nodeView struct {
+	Addr       string
+	Status     bool
+	ID         uint64
+	IsWritable bool
+}
+
+type topologyView struct {
+	NodeSet map[uint64]*nodeSetView
+}
+
+type nodeSetView struct {
+	Racks     []*rackView
+	MetaNodes []nodeView
+}
+
+type rackView struct {
+	Name      string
+	DataNodes []nodeView
+}
+
+type dataNodeInfo struct {
+	Total                     uint64 `json:"TotalWeight"`
+	Used                      uint64 `json:"UsedWeight"`
+	AvailableSpace            uint64
+	ID                        uint64
+	RackName                  string `json:"Rack"`
+	Addr                      string
+	ReportTime                time.Time
+	UsageRatio                float64
+	SelectedTimes             uint64
+	DataPartitionReports      []*proto.PartitionReport
+	DataPartitionCount        uint32
+	NodeSetID                 uint64
+	PersistenceDataPartitions []uint64
+	BadDisks                  []string
+	DiskReports               []*proto.DiskReport
+}
+
+type metaNodeInfo struct {
+	ID                        uint64
+	Addr                      string
+	IsActive                  bool
+	RackName                  string `json:"Rack"`
+	MaxMemAvailWeight         uint64
+	Total                     uint64 `json:"TotalWeight"`
+	Used                      uint64 `json:"UsedWeight"`
+	Ratio                     float64
+	SelectCount               uint64
+	Threshold                 float32
+	ReportTime                time.Time
+	MetaPartitionCount        int
+	NodeSetID                 uint64
+	PersistenceMetaPartitions []uint64
+}
+
+type dataPartitionInfo struct {
+	PartitionID             uint64
+	LastLoadedTime          int64
+	ReplicaNum              uint8
+	Status                  int8
+	Replicas                []*dataReplica
+	Hosts                   []string
+	Peers                   []proto.Peer
+	MissingNodes            map[string]int64
+	VolName                 string
+	VolID                   uint64
+	FilesWithMissingReplica map[string]int64
+	EcDataNum               uint8
+	EcParityNum             uint8
+	MediaType               string
+	Cold                    bool
+}
+
+type dataReplica struct {
+	Addr            string
+	ReportTime      int64
+	FileCount       uint32
+	Status          int8
+	HasLoadResponse bool
+	Total           uint64 `json:"TotalSize"`
+	Used            uint64 `json:"UsedSize"`
+	IsLeader        bool
+	NeedsToCompare  bool
+	DiskPath        string
+}
+
+type metaPartitionInfo struct {
+	PartitionID  uint64
+	Start        uint64
+	End          uint64
+	MaxInodeID   uint64
+	Replicas     []*metaReplica
+	ReplicaNum   uint8
+	Status       int8
+	Hosts        []string
+	Peers        []proto.Peer
+	MissNodes    map[string]int64
+	LoadResponse []*proto.MetaPartitionLoadResponse
+}
+
+type metaReplica struct {
+	Addr       string
+	ReportTime int64
+	Status     int8
+	IsLeader   bool
+	ApplyID    uint64
+}
+
+type params map[string]string
+
+// Send the request to the master, and decode the data of the reply into the result if it is not nil.
+// The helper finds the leader among the masters, to which the following requests are sent.
+func (c *cli) request(path string, p params, result interface{}) (err error) {
+	if len(c.master.Nodes()) == 0 {
+		return fmt.Errorf("no master address, set it by -master or $%v", envMasterAddr)
+	}
+	// the helper does not escape the values
+	escaped := make(map[string]string, len(p))
+	for k, v := range p {
+		escaped[k] = url.QueryEscape(v)
+	}
+	data, err := c.master.Request(http.MethodGet, path, escaped, nil)
+	if err != nil {
+		return
+	}
+	if result != nil {
+		err = json.Unmarshal(data, result)
+	}
+	return
+}
+
+// Send the request of which the master replies with a message.
+func (c *cli) requestMsg(path string, p params) error {
+	var msg string
+	if err := c.request(path, p, &msg); err != nil {
+		return err
+	}
+	return c.printMsg(msg)
+}
+
+func (c *cli) getCluster() (cv *clusterView, err error) {
+	cv = new(clusterView)
+	err = c.request(proto.AdminGetCluster, nil, cv)
+	return
+}
+
+func (c *cli) getVol(name string) (vv *proto.SimpleVolView, err error) {
+	vv = new(proto.SimpleVolView)
+	err = c.request(proto.AdminGetVol, params{"name": name}, vv)
+	return
+}
+
+// Return the key to operate the volume, which is derived from the owner.
+func volAuthKey(owner string) string {
+	sum := md5.Sum([]byte(owner))
+	return hex.EncodeToString(sum[:])
+}
+
+// Return the params to operate the volume, along with its key.
+func (c *cli) volParams(name string) (p params, err error) {
+	vv, err := c.getVol(name)
+	if err != nil {
+		return
+	}
+	return params{"name": name, "authKey": volAuthKey(vv.Owner)}, nil
+}
+
+func parseID(s string) (uint64, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", s)
+	}
+	return id, nil
+}
+
+func formatStatus(status int8) string {
+	switch status {
+	case proto.ReadOnly:
+		return "ReadOnly"
+	case proto.ReadWrite:
+		return "ReadWrite"
+	case proto.Unavailable:
+		return "Unavailable"
+	}
+	return strconv.Itoa(int(status))
+}
+
+func formatActive(active bool) string {
+	if active {
+		return "Active"
+	}
+	return "Inactive"
+}
+
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+}
+
+func formatSize(size uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
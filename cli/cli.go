@@ -0,0 +1,308 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// cfs-cli administrates a cluster through the API of the master.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
+)
+
+const (
+	envMasterAddr  = "CFS_MASTER" // the master addresses if the flag is not given
+	hostsSeparator = ","
+)
+
+var (
+	CommitID   string
+	BranchName string
+	BuildTime  string
+)
+
+var errAborted = errors.New("aborted")
+
+type runFunc func(c *cli, args []string) error
+
+// A command runs with the arguments, or dispatches them to its sub commands.
+type command struct {
+	name    string
+	aliases []string
+	args    []string // the names of the required arguments
+	desc    string
+	setup   func(fs *flag.FlagSet) runFunc // defines the flags of the command
+	subs    []*command
+}
+
+func (cmd *command) match(name string) bool {
+	if cmd.name == name {
+		return true
+	}
+	for _, alias := range cmd.aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmd *command) usage(w io.Writer, path string) {
+	if len(cmd.subs) > 0 {
+		fmt.Fprintf(w, "Usage: %v <command>\n\n%v\n\nCommands:\n", path, cmd.desc)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, sub := range cmd.subs {
+			name := sub.name
+			if len(sub.aliases) > 0 {
+				name = fmt.Sprintf("%v (%v)", name, strings.Join(sub.aliases, ", "))
+			}
+			fmt.Fprintf(tw, "  %v\t%v\n", name, sub.desc)
+		}
+		tw.Flush()
+		return
+	}
+	args := make([]string, 0, len(cmd.args))
+	for _, arg := range cmd.args {
+		args = append(args, "<"+arg+">")
+	}
+	fmt.Fprintf(w, "Usage: %v [flags] %v\n\n%v\n", path, strings.Join(args, " "), cmd.desc)
+}
+
+// Run the command found by the arguments.
+func (cmd *command) execute(c *cli, path string, args []string) error {
+	if len(cmd.subs) > 0 {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			cmd.usage(c.errOut, path)
+			return flag.ErrHelp
+		}
+		for _, sub := range cmd.subs {
+			if sub.match(args[0]) {
+				return sub.execute(c, path+" "+sub.name, args[1:])
+			}
+		}
+		cmd.usage(c.errOut, path)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	fs.Usage = func() {
+		cmd.usage(c.errOut, path)
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(c.errOut, "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	run := cmd.setup(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != len(cmd.args) {
+		fs.Usage()
+		return fmt.Errorf("wrong number of arguments, expected %v, got %v", len(cmd.args), fs.NArg())
+	}
+	return run(c, fs.Args())
+}
+
+// Return whether the flag is given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+type cli struct {
+	master util.MasterHelper
+	json   bool
+	yes    bool
+	in     *bufio.Reader
+	out    io.Writer
+	errOut io.Writer // the prompts and the usages
+}
+
+// Print the value as JSON, or by the function in the human readable format.
+func (c *cli) print(v interface{}, render func()) error {
+	if !c.json {
+		render()
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, string(data))
+	return nil
+}
+
+// Print the message returned by the master.
+func (c *cli) printMsg(msg string) error {
+	return c.print(msg, func() {
+		fmt.Fprintln(c.out, strings.TrimSpace(msg))
+	})
+}
+
+// Ask the user to confirm the destructive operation, unless it is confirmed by the flag.
+func (c *cli) confirm(format string, a ...interface{}) error {
+	if c.yes {
+		return nil
+	}
+	fmt.Fprintf(c.errOut, format+" (yes/no): ", a...)
+	answer, err := c.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errAborted
+}
+
+// A table aligns the values of the rows by columns.
+type table struct {
+	w *tabwriter.Writer
+}
+
+func (c *cli) table(header ...interface{}) *table {
+	t := &table{w: tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)}
+	t.row(header...)
+	return t
+}
+
+func (t *table) row(values ...interface{}) {
+	for i, v := range values {
+		if i > 0 {
+			fmt.Fprint(t.w, "\t")
+		}
+		fmt.Fprint(t.w, v)
+	}
+	fmt.Fprintln(t.w)
+}
+
+func (t *table) flush() {
+	t.w.Flush()
+}
+
+// Print the fields of an item line by line, given as pairs of the name and the value.
+func (c *cli) fields(pairs ...interface{}) {
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(tw, "%v:\t%v\n", pairs[i], pairs[i+1])
+	}
+	tw.Flush()
+}
+
+var rootCmd = &command{
+	name: "cfs-cli",
+	desc: "Administrate a ChubaoFS cluster through the master.",
+	subs: []*command{
+		clusterCmd,
+		topologyCmd,
+		volCmd,
+		dataNodeCmd,
+		metaNodeCmd,
+		dataPartitionCmd,
+		metaPartitionCmd,
+		jobCmd,
+		{
+			name: "version",
+			desc: "Show the version of cfs-cli",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					fmt.Fprintf(c.out, "Branch: %v\nCommit: %v\nBuild: %v\n", BranchName, CommitID, BuildTime)
+					return nil
+				}
+			},
+		},
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Run the command line, and return the exit code.
+func run(args []string, in io.Reader, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("cfs-cli", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	masterAddr := fs.String("master", os.Getenv(envMasterAddr), "addresses of the masters separated by commas, $"+envMasterAddr+" by default")
+	jsonOut := fs.Bool("json", false, "print the output as JSON")
+	yes := fs.Bool("y", false, "confirm the destructive operations without prompts")
+	authNodes := fs.String("authnodes", "", "addresses of the authnodes separated by commas, if the cluster is authenticated")
+	clientID := fs.String("clientid", "", "ID of the client registered in the authnodes")
+	clientKey := fs.String("clientkey", "", "key of the client in the authnodes, base64 encoded")
+	certFile := fs.String("certfile", "", "path of the certificate of the authnodes")
+	fs.Usage = func() {
+		rootCmd.usage(errOut, "cfs-cli [flags]")
+		fmt.Fprintf(errOut, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	c := &cli{
+		master: util.NewMasterHelper(),
+		json:   *jsonOut,
+		yes:    *yes,
+		in:     bufio.NewReader(in),
+		out:    out,
+		errOut: errOut,
+	}
+	for _, addr := range strings.Split(*masterAddr, hostsSeparator) {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			c.master.AddNode(addr)
+		}
+	}
+	if *authNodes != "" {
+		authenticator, err := auth.NewAuthenticator(strings.Split(*authNodes, hostsSeparator), *clientID, *clientKey, *certFile)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error: bad authnodes: %v\n", err)
+			return 2
+		}
+		c.master.SetTokenFunc(func() (string, error) {
+			return authenticator.Token(proto.MasterServiceID)
+		})
+	}
+	if err := rootCmd.execute(c, "cfs-cli", args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		fmt.Fprintf(errOut, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// A master which replies to the requests by the handlers of the paths, and records the requests.
+type testMaster struct {
+	sync.Mutex
+	*httptest.Server
+	handlers map[string]func(q url.Values) *proto.HTTPReply
+	requests []string
+}
+
+func newTestMaster() *testMaster {
+	m := &testMaster{handlers: make(map[string]func(q url.Values) *proto.HTTPReply)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		m.requests = append(m.requests, r.URL.Path)
+		handler, ok := m.handlers[r.URL.Path]
+		m.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := json.Marshal(handler(r.URL.Query()))
+		w.Write(data)
+	}))
+	return m
+}
+
+func (m *testMaster) handle(path string, handler func(q url.Values) *proto.HTTPReply) {
+	m.Lock()
+	m.handlers[path] = handler
+	m.Unlock()
+}
+
+func (m *testMaster) requested(path string) bool {
+	m.Lock()
+	defer m.Unlock()
+	for _, p := range m.requests {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *testMaster) addr() string {
+	return strings.TrimPrefix(m.URL, "http://")
+}
+
+// Runs the command line against the master, with the input to the prompts.
+func runTestCLI(m *testMaster, input string, args ...string) (code int, out, errOut string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-master", m.addr()}, args...)
+	code = run(args, strings.NewReader(input), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func newTestVolMaster() *testMaster {
+	m := newTestMaster()
+	m.handle(proto.AdminGetVol, func(q url.Values) *proto.HTTPReply {
+		if q.Get("name") != "vol" {
+			return &proto.HTTPReply{Code: proto.ErrCodeVolNotExists, Msg: proto.ErrVolNotExists.Error()}
+		}
+		return &proto.HTTPReply{Data: &proto.SimpleVolView{Name: "vol", Owner: "owner", Capacity: 10}}
+	})
+	m.handle(proto.AdminDeleteVol, func(q url.Values) *proto.HTTPReply {
+		if q.Get("authKey") != volAuthKey("owner") {
+			return &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: "bad authKey"}
+		}
+		return &proto.HTTPReply{Data: "delete vol[vol] successfully"}
+	})
+	return m
+}
+
+func TestArgs(t *testing.T) {
+	m := newTestVolMaster()
+	defer m.Close()
+
+	if code, _, errOut := runTestCLI(m, ""); code != 2 || !strings.Contains(errOut, "Usage: cfs-cli") {
+		t.Fatalf("expect the usage without a command, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut := runTestCLI(m, "", "volume"); code != 0 || !strings.Contains(errOut, "Commands:") {
+		t.Fatalf("expect the usage of the sub commands, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut := runTestCLI(m, "", "volume", "nosuch"); code != 1 || !strings.Contains(errOut, `unknown command "nosuch"`) {
+		t.Fatalf("expect the unknown command rejected, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut := runTestCLI(m, "", "volume", "info"); code != 1 || !strings.Contains(errOut, "wrong number of arguments") {
+		t.Fatalf("expect the missing argument rejected, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut := runTestCLI(m, "", "volume", "create", "-capacity", "x", "vol", "owner"); code != 1 ||
+		!strings.Contains(errOut, "invalid value") {
+		t.Fatalf("expect the bad flag rejected, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut := runTestCLI(m, "", "-nosuch", "volume"); code != 2 || !strings.Contains(errOut, "-nosuch") {
+		t.Fatalf("expect the unknown global flag rejected, got code %v: %v", code, errOut)
+	}
+
+	// the aliases are matched, and the flags of the command are given before the arguments
+	var query url.Values
+	m.handle(proto.AdminCreateVol, func(q url.Values) *proto.HTTPReply {
+		query = q
+		return &proto.HTTPReply{Data: "create vol[vol] successfully"}
+	})
+	code, out, errOut := runTestCLI(m, "", "vol", "create", "-capacity", "100", "vol", "owner")
+	if code != 0 || strings.TrimSpace(out) != "create vol[vol] successfully" {
+		t.Fatalf("create: code %v out %v err %v", code, out, errOut)
+	}
+	if query.Get("name") != "vol" || query.Get("owner") != "owner" || query.Get("capacity") != "100" ||
+		query.Get("mpCount") != "3" {
+		t.Fatalf("expect the params of the flags and the arguments, got %v", query)
+	}
+
+	code, out, _ = runTestCLI(m, "", "-json", "vol", "info", "vol")
+	var vv proto.SimpleVolView
+	if err := json.Unmarshal([]byte(out), &vv); code != 0 || err != nil || vv.Owner != "owner" {
+		t.Fatalf("expect the volume as JSON, got code %v: %v", code, out)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	m := newTestVolMaster()
+	defer m.Close()
+
+	code, _, errOut := runTestCLI(m, "no\n", "vol", "delete", "vol")
+	if code != 1 || !strings.Contains(errOut, "Delete volume vol and all its files? (yes/no)") ||
+		!strings.Contains(errOut, errAborted.Error()) {
+		t.Fatalf("expect the delete aborted, got code %v: %v", code, errOut)
+	}
+	if code, _, errOut = runTestCLI(m, "", "vol", "delete", "vol"); code != 1 || !strings.Contains(errOut, errAborted.Error()) {
+		t.Fatalf("expect the delete aborted without an answer, got code %v: %v", code, errOut)
+	}
+	if m.requested(proto.AdminDeleteVol) {
+		t.Fatalf("expect no delete requested before it is confirmed")
+	}
+
+	code, out, errOut := runTestCLI(m, "Yes\n", "vol", "delete", "vol")
+	if code != 0 || strings.TrimSpace(out) != "delete vol[vol] successfully" {
+		t.Fatalf("expect the delete confirmed, got code %v out %v err %v", code, out, errOut)
+	}
+
+	// no prompt with -y
+	code, out, errOut = runTestCLI(m, "", "-y", "vol", "delete", "vol")
+	if code != 0 || strings.Contains(errOut, "yes/no") || strings.TrimSpace(out) != "delete vol[vol] successfully" {
+		t.Fatalf("expect the delete without the prompt, got code %v out %v err %v", code, out, errOut)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	m := newTestVolMaster()
+	defer m.Close()
+
+	// the message of the error replied by the master is shown
+	code, out, errOut := runTestCLI(m, "", "-y", "vol", "delete", "nosuch")
+	if code != 1 || out != "" || !strings.Contains(errOut, proto.ErrVolNotExists.Error()) {
+		t.Fatalf("expect the error of the master, got code %v out %v err %v", code, out, errOut)
+	}
+	if m.requested(proto.AdminDeleteVol) {
+		t.Fatalf("expect no delete requested of the volume not found")
+	}
+
+	// the path not served by any master
+	if code, _, errOut = runTestCLI(m, "", "vol", "set-trash", "vol", "24"); code != 1 ||
+		!strings.Contains(errOut, util.ErrNoValidMaster.Error()) {
+		t.Fatalf("expect the request failed, got code %v: %v", code, errOut)
+	}
+
+	var stderr bytes.Buffer
+	if code = run([]string{"-master", "", "vol", "info", "vol"}, strings.NewReader(""), &bytes.Buffer{}, &stderr); code != 1 ||
+		!strings.Contains(stderr.String(), "no master address") {
+		t.Fatalf("expect the master address required, got code %v: %v", code, stderr.String())
+	}
+}
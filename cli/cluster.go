@@ -0,0 +1,283 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+var clusterCmd = &command{
+	name: "cluster",
+	desc: "Manage the cluster",
+	subs: []*command{
+		{
+			name:  "info",
+			desc:  "Show the summary of the cluster",
+			setup: func(fs *flag.FlagSet) runFunc { return runClusterInfo },
+		},
+		{
+			name: "freeze",
+			args: []string{"true|false"},
+			desc: "Turn off or on the automatic allocation of the data partitions",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := strconv.ParseBool(args[0]); err != nil {
+						return fmt.Errorf("invalid status %q", args[0])
+					}
+					return c.requestMsg(proto.AdminClusterFreeze, params{"enable": args[0]})
+				}
+			},
+		},
+		{
+			name: "set-threshold",
+			args: []string{"ratio"},
+			desc: "Set the memory usage ratio above which the meta partitions of a meta node become read-only",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := strconv.ParseFloat(args[0], 64); err != nil {
+						return fmt.Errorf("invalid threshold %q", args[0])
+					}
+					return c.requestMsg(proto.AdminSetMetaNodeThreshold, params{"threshold": args[0]})
+				}
+			},
+		},
+		{
+			name: "add-master",
+			args: []string{"id", "addr"},
+			desc: "Add a master to the raft group of the masters",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AddRaftNode, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		{
+			name: "remove-master",
+			args: []string{"id", "addr"},
+			desc: "Remove a master from the raft group of the masters",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					if err := c.confirm("Remove master %v(%v) from the cluster?", args[0], args[1]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.RemoveRaftNode, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		newBalancerCmd("balancer", "data nodes", proto.AdminStartBalancer, proto.AdminStopBalancer, proto.AdminGetBalancer),
+		newBalancerCmd("meta-balancer", "meta nodes", proto.AdminStartMetaBalancer, proto.AdminStopMetaBalancer,
+			proto.AdminGetMetaBalancer),
+	},
+}
+
+func runClusterInfo(c *cli, args []string) error {
+	cv, err := c.getCluster()
+	if err != nil {
+		return err
+	}
+	return c.print(cv, func() {
+		c.fields(
+			"Name", cv.Name,
+			"Master leader", cv.LeaderAddr,
+			"Auto allocation", !cv.DisableAutoAlloc,
+			"Meta node threshold", cv.MetaNodeThreshold,
+			"Applied", cv.Applied,
+			"Max data partition ID", cv.MaxDataPartitionID,
+			"Max meta partition ID", cv.MaxMetaPartitionID,
+			"Max node ID", cv.MaxMetaNodeID,
+			"Volumes", len(cv.VolStatInfo),
+			"Data nodes", len(cv.DataNodes),
+			"Meta nodes", len(cv.MetaNodes),
+		)
+		fmt.Fprintln(c.out)
+		t := c.table("NODES", "TOTAL(GB)", "USED(GB)", "INCREASED(GB)", "USED RATIO")
+		for _, s := range []struct {
+			name string
+			stat *nodeStatInfo
+		}{{"data nodes", cv.DataNodeStatInfo}, {"meta nodes", cv.MetaNodeStatInfo}} {
+			if s.stat != nil {
+				t.row(s.name, s.stat.TotalGB, s.stat.UsedGB, s.stat.IncreasedGB, s.stat.UsedRatio)
+			}
+		}
+		t.flush()
+		if len(cv.BadPartitionIDs) > 0 {
+			fmt.Fprintln(c.out)
+			t = c.table("BAD DISK", "PARTITIONS")
+			for _, bp := range cv.BadPartitionIDs {
+				t.row(bp.DiskPath, bp.PartitionIDs)
+			}
+			t.flush()
+		}
+	})
+}
+
+func newBalancerCmd(name, nodes, startPath, stopPath, getPath string) *command {
+	return &command{
+		name: name,
+		desc: "Manage the balancer of the " + nodes,
+		subs: []*command{
+			{
+				name: "info",
+				desc: "Show the status and the migrations of the balancer",
+				setup: func(fs *flag.FlagSet) runFunc {
+					return func(c *cli, args []string) error {
+						bv := new(proto.BalancerView)
+						if err := c.request(getPath, nil, bv); err != nil {
+							return err
+						}
+						return c.print(bv, func() { printBalancer(c, bv) })
+					}
+				},
+			},
+			{
+				name: "start",
+				desc: "Start the balancer of the " + nodes,
+				setup: func(fs *flag.FlagSet) runFunc {
+					threshold := fs.Float64("threshold", 0, "skew of the usage ratio tolerated, between 0 and 1, kept if not set")
+					concurrency := fs.Int("concurrency", 0, "maximum number of migrations at a time, kept if not set")
+					return func(c *cli, args []string) error {
+						p := params{}
+						if *threshold > 0 {
+							p["threshold"] = strconv.FormatFloat(*threshold, 'f', -1, 64)
+						}
+						if *concurrency > 0 {
+							p["concurrency"] = strconv.Itoa(*concurrency)
+						}
+						return c.requestMsg(startPath, p)
+					}
+				},
+			},
+			{
+				name: "stop",
+				desc: "Stop the balancer of the " + nodes,
+				setup: func(fs *flag.FlagSet) runFunc {
+					return func(c *cli, args []string) error {
+						return c.requestMsg(stopPath, nil)
+					}
+				},
+			},
+		},
+	}
+}
+
+func printBalancer(c *cli, bv *proto.BalancerView) {
+	c.fields(
+		"Enabled", bv.Enabled,
+		"Threshold", bv.Threshold,
+		"Concurrency", bv.Concurrency,
+		"Average usage", fmt.Sprintf("%.4f", bv.AvgUsage),
+		"Skew", fmt.Sprintf("%.4f", bv.Skew),
+		"Finished", bv.Finished,
+		"Failed", bv.Failed,
+	)
+	if len(bv.Nodes) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("DATA NODE", "USAGE", "DISKS")
+		for _, n := range bv.Nodes {
+			t.row(n.Addr, fmt.Sprintf("%.4f", n.UsageRatio), len(n.Disks))
+		}
+		t.flush()
+	}
+	if len(bv.MetaNodes) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("META NODE", "TOTAL", "USED", "USAGE", "PARTITIONS")
+		for _, n := range bv.MetaNodes {
+			t.row(n.Addr, formatSize(n.Total), formatSize(n.Used), fmt.Sprintf("%.4f", n.UsageRatio), len(n.Partitions))
+		}
+		t.flush()
+	}
+	if len(bv.Tasks) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("PARTITION", "VOLUME", "SRC", "DST", "STATE", "STARTED", "UPDATED", "MESSAGE")
+		for _, task := range bv.Tasks {
+			src := task.Src
+			if task.SrcDisk != "" {
+				src += ":" + task.SrcDisk
+			}
+			t.row(task.PartitionID, task.VolName, src, task.Dst, formatBalanceState(task.State),
+				formatTime(task.StartTime), formatTime(task.UpdateTime), task.Msg)
+		}
+		t.flush()
+	}
+}
+
+func formatBalanceState(state uint8) string {
+	switch state {
+	case proto.BalanceAddingReplica:
+		return "AddingReplica"
+	case proto.BalanceCatchingUp:
+		return "CatchingUp"
+	case proto.BalanceRemovingReplica:
+		return "RemovingReplica"
+	case proto.BalanceFinished:
+		return "Finished"
+	case proto.BalanceFailed:
+		return "Failed"
+	}
+	return strconv.Itoa(int(state))
+}
+
+var topologyCmd = &command{
+	name:    "topology",
+	aliases: []string{"topo"},
+	desc:    "Show the node sets and the racks of the cluster",
+	subs: []*command{
+		{
+			name: "info",
+			desc: "Show the nodes of each node set and rack",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					tv := new(topologyView)
+					if err := c.request(proto.GetTopologyView, nil, tv); err != nil {
+						return err
+					}
+					return c.print(tv, func() { printTopology(c, tv) })
+				}
+			},
+		},
+	},
+}
+
+func printTopology(c *cli, tv *topologyView) {
+	ids := make([]uint64, 0, len(tv.NodeSet))
+	for id := range tv.NodeSet {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	t := c.table("NODE SET", "RACK", "TYPE", "ID", "ADDR", "STATUS", "WRITABLE")
+	for _, id := range ids {
+		ns := tv.NodeSet[id]
+		for _, rack := range ns.Racks {
+			for _, n := range rack.DataNodes {
+				t.row(id, rack.Name, "data", n.ID, n.Addr, formatActive(n.Status), n.IsWritable)
+			}
+		}
+		for _, n := range ns.MetaNodes {
+			t.row(id, "-", "meta", n.ID, n.Addr, formatActive(n.Status), n.IsWritable)
+		}
+	}
+	t.flush()
+}
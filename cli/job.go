@@ -0,0 +1,144 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+var jobCmd = &command{
+	name: "job",
+	desc: "Manage the jobs of the master, such as the decommission of the nodes",
+	subs: []*command{
+		{
+			name: "list",
+			desc: "List the running and recently finished jobs",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					var jobs []*proto.Job
+					if err := c.request(proto.AdminListJobs, nil, &jobs); err != nil {
+						return err
+					}
+					return c.print(jobs, func() {
+						t := c.table("ID", "TYPE", "TARGET", "STATUS", "PROGRESS", "FAILED", "UPDATED", "MESSAGE")
+						for _, job := range jobs {
+							t.row(job.ID, job.Type, formatJobTarget(job), formatJobStatus(job.Status),
+								fmt.Sprintf("%v/%v", job.Succeeded+job.Failed, job.Total), job.Failed,
+								formatTime(job.UpdateTime), job.Msg)
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"id"},
+			desc: "Show the job along with the progress on each partition",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					job := new(proto.Job)
+					if err := c.request(proto.AdminGetJob, params{"id": args[0]}, job); err != nil {
+						return err
+					}
+					return c.print(job, func() { printJob(c, job) })
+				}
+			},
+		},
+		newJobOpCmd("pause", "Pause the job, which stops after the running step", proto.AdminPauseJob, false),
+		newJobOpCmd("resume", "Resume the job paused or failed, retrying the failed steps", proto.AdminResumeJob, false),
+		newJobOpCmd("cancel", "Cancel the job, which stops after the running step without rolling back", proto.AdminCancelJob, true),
+	},
+}
+
+func newJobOpCmd(name, desc, path string, confirm bool) *command {
+	return &command{
+		name: name,
+		args: []string{"id"},
+		desc: desc,
+		setup: func(fs *flag.FlagSet) runFunc {
+			return func(c *cli, args []string) error {
+				if _, err := parseID(args[0]); err != nil {
+					return err
+				}
+				if confirm {
+					if err := c.confirm("%v job %v?", strings.Title(name), args[0]); err != nil {
+						return err
+					}
+				}
+				return c.requestMsg(path, params{"id": args[0]})
+			}
+		},
+	}
+}
+
+func printJob(c *cli, job *proto.Job) {
+	c.fields(
+		"ID", job.ID,
+		"Type", job.Type,
+		"Target", formatJobTarget(job),
+		"Status", formatJobStatus(job.Status),
+		"Created", formatTime(job.CreateTime),
+		"Updated", formatTime(job.UpdateTime),
+		"Partitions", job.Total,
+		"Succeeded", job.Succeeded,
+		"Failed", job.Failed,
+		"Message", job.Msg,
+	)
+	if len(job.Steps) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("PARTITION", "VOLUME", "STATUS", "UPDATED", "MESSAGE")
+		for _, s := range job.Steps {
+			t.row(s.PartitionID, s.VolName, formatJobStatus(s.Status), formatTime(s.UpdateTime), s.Msg)
+		}
+		t.flush()
+	}
+}
+
+func formatJobTarget(job *proto.Job) string {
+	if job.Disk != "" {
+		return job.Addr + ":" + job.Disk
+	}
+	if job.PartitionID != 0 {
+		return fmt.Sprintf("%v@%v", job.PartitionID, job.Addr)
+	}
+	return job.Addr
+}
+
+func formatJobStatus(status uint8) string {
+	switch status {
+	case proto.JobPending:
+		return "Pending"
+	case proto.JobRunning:
+		return "Running"
+	case proto.JobPaused:
+		return "Paused"
+	case proto.JobCancelled:
+		return "Cancelled"
+	case proto.JobSucceeded:
+		return "Succeeded"
+	case proto.JobFailed:
+		return "Failed"
+	}
+	return strconv.Itoa(int(status))
+}
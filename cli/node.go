@@ -0,0 +1,191 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+var dataNodeCmd = &command{
+	name:    "datanode",
+	aliases: []string{"dn"},
+	desc:    "Manage the data nodes",
+	subs: []*command{
+		{
+			name: "list",
+			desc: "List the data nodes",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					cv, err := c.getCluster()
+					if err != nil {
+						return err
+					}
+					return c.print(cv.DataNodes, func() { printNodes(c, cv.DataNodes) })
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"addr"},
+			desc: "Show the usage, the disks and the partitions of the data node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					dn := new(dataNodeInfo)
+					if err := c.request(proto.GetDataNode, params{"addr": args[0]}, dn); err != nil {
+						return err
+					}
+					return c.print(dn, func() { printDataNode(c, dn) })
+				}
+			},
+		},
+		{
+			name: "decommission",
+			args: []string{"addr"},
+			desc: "Migrate all the data partitions off the data node in a job, and remove it from the cluster",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if err := c.confirm("Decommission data node %v?", args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.DecommissionDataNode, params{"addr": args[0]})
+				}
+			},
+		},
+		{
+			name: "decommission-disk",
+			args: []string{"addr", "disk"},
+			desc: "Migrate all the data partitions off the disk of the data node in a job",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if err := c.confirm("Decommission disk %v of data node %v?", args[1], args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.DecommissionDisk, params{"addr": args[0], "disk": args[1]})
+				}
+			},
+		},
+	},
+}
+
+var metaNodeCmd = &command{
+	name:    "metanode",
+	aliases: []string{"mn"},
+	desc:    "Manage the meta nodes",
+	subs: []*command{
+		{
+			name: "list",
+			desc: "List the meta nodes",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					cv, err := c.getCluster()
+					if err != nil {
+						return err
+					}
+					return c.print(cv.MetaNodes, func() { printNodes(c, cv.MetaNodes) })
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"addr"},
+			desc: "Show the memory usage and the partitions of the meta node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					mn := new(metaNodeInfo)
+					if err := c.request(proto.GetMetaNode, params{"addr": args[0]}, mn); err != nil {
+						return err
+					}
+					return c.print(mn, func() { printMetaNode(c, mn) })
+				}
+			},
+		},
+		{
+			name: "decommission",
+			args: []string{"addr"},
+			desc: "Migrate all the meta partitions off the meta node in a job, and remove it from the cluster",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if err := c.confirm("Decommission meta node %v?", args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.DecommissionMetaNode, params{"addr": args[0]})
+				}
+			},
+		},
+	},
+}
+
+func printNodes(c *cli, nodes []nodeView) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	t := c.table("ID", "ADDR", "STATUS", "WRITABLE")
+	for _, n := range nodes {
+		t.row(n.ID, n.Addr, formatActive(n.Status), n.IsWritable)
+	}
+	t.flush()
+}
+
+func printDataNode(c *cli, dn *dataNodeInfo) {
+	c.fields(
+		"ID", dn.ID,
+		"Addr", dn.Addr,
+		"Rack", dn.RackName,
+		"Node set", dn.NodeSetID,
+		"Total", formatSize(dn.Total),
+		"Used", formatSize(dn.Used),
+		"Available", formatSize(dn.AvailableSpace),
+		"Usage ratio", fmt.Sprintf("%.4f", dn.UsageRatio),
+		"Partitions", dn.DataPartitionCount,
+		"Bad disks", dn.BadDisks,
+		"Report time", dn.ReportTime.Format("2006-01-02 15:04:05"),
+	)
+	if len(dn.DiskReports) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("DISK", "MEDIA", "TOTAL", "USED", "STATUS")
+		for _, d := range dn.DiskReports {
+			t.row(d.Path, formatMedia(d.MediaType), formatSize(d.Total), formatSize(d.Used), formatStatus(int8(d.Status)))
+		}
+		t.flush()
+	}
+	if len(dn.DataPartitionReports) > 0 {
+		fmt.Fprintln(c.out)
+		t := c.table("PARTITION", "VOLUME", "DISK", "STATUS", "LEADER", "EXTENTS", "USED", "TOTAL")
+		for _, r := range dn.DataPartitionReports {
+			t.row(r.PartitionID, r.VolName, r.DiskPath, formatStatus(int8(r.PartitionStatus)), r.IsLeader,
+				r.ExtentCount, formatSize(r.Used), formatSize(r.Total))
+		}
+		t.flush()
+	}
+}
+
+func printMetaNode(c *cli, mn *metaNodeInfo) {
+	c.fields(
+		"ID", mn.ID,
+		"Addr", mn.Addr,
+		"Status", formatActive(mn.IsActive),
+		"Rack", mn.RackName,
+		"Node set", mn.NodeSetID,
+		"Total memory", formatSize(mn.Total),
+		"Used memory", formatSize(mn.Used),
+		"Usage ratio", fmt.Sprintf("%.4f", mn.Ratio),
+		"Threshold", mn.Threshold,
+		"Partitions", mn.MetaPartitionCount,
+		"Partition IDs", mn.PersistenceMetaPartitions,
+		"Report time", mn.ReportTime.Format("2006-01-02 15:04:05"),
+	)
+}
@@ -0,0 +1,342 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+var dataPartitionCmd = &command{
+	name:    "datapartition",
+	aliases: []string{"dp"},
+	desc:    "Manage the data partitions",
+	subs: []*command{
+		{
+			name: "list",
+			args: []string{"volume"},
+			desc: "List the data partitions of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					view := proto.NewDataPartitionsView()
+					if err := c.request(proto.ClientDataPartitions, params{"name": args[0]}, view); err != nil {
+						return err
+					}
+					dps := view.DataPartitions
+					sort.Slice(dps, func(i, j int) bool { return dps[i].PartitionID < dps[j].PartitionID })
+					return c.print(dps, func() {
+						t := c.table("ID", "STATUS", "REPLICAS", "LEADER", "HOSTS", "EC", "MEDIA", "COLD")
+						for _, dp := range dps {
+							ec := "-"
+							if dp.EcDataNum > 0 {
+								ec = fmt.Sprintf("%v+%v", dp.EcDataNum, dp.EcParityNum)
+							}
+							t.row(dp.PartitionID, formatStatus(dp.Status), dp.ReplicaNum, dp.LeaderAddr, dp.Hosts, ec,
+								formatMedia(dp.MediaType), dp.Cold)
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"id"},
+			desc: "Show the replicas of the data partition",
+			setup: func(fs *flag.FlagSet) runFunc {
+				vol := fs.String("vol", "", "volume of the data partition, which speeds up the lookup")
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					p := params{"id": args[0]}
+					if *vol != "" {
+						p["name"] = *vol
+					}
+					dp := new(dataPartitionInfo)
+					if err := c.request(proto.AdminGetDataPartition, p, dp); err != nil {
+						return err
+					}
+					return c.print(dp, func() { printDataPartition(c, dp) })
+				}
+			},
+		},
+		{
+			name: "create",
+			args: []string{"volume", "count"},
+			desc: "Create data partitions for the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				ec := fs.Bool("ec", false, "create erasure-coded partitions")
+				cold := fs.Bool("cold", false, "create partitions of the cold tier")
+				return func(c *cli, args []string) error {
+					if count, err := strconv.Atoi(args[1]); err != nil || count <= 0 {
+						return fmt.Errorf("invalid count %q", args[1])
+					}
+					return c.requestMsg(proto.AdminCreateDataPartition, params{
+						"name":  args[0],
+						"count": args[1],
+						"ec":    strconv.FormatBool(*ec),
+						"cold":  strconv.FormatBool(*cold),
+					})
+				}
+			},
+		},
+		{
+			name: "load",
+			args: []string{"id"},
+			desc: "Load the data partition on its replicas and compare the files",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminLoadDataPartition, params{"id": args[0]})
+				}
+			},
+		},
+		{
+			name: "decommission",
+			args: []string{"id", "addr"},
+			desc: "Move the replica of the data partition off the data node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					if err := c.confirm("Decommission the replica of data partition %v on %v?", args[0], args[1]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDecommissionDataPartition, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		{
+			name: "add-replica",
+			args: []string{"id", "addr"},
+			desc: "Add a replica of the data partition on the data node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminAddDataReplica, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		{
+			name: "del-replica",
+			args: []string{"id", "addr"},
+			desc: "Delete the replica of the data partition on the data node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					if err := c.confirm("Delete the replica of data partition %v on %v?", args[0], args[1]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDeleteDataReplica, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+	},
+}
+
+func printDataPartition(c *cli, dp *dataPartitionInfo) {
+	ec := "-"
+	if dp.EcDataNum > 0 {
+		ec = fmt.Sprintf("%v+%v", dp.EcDataNum, dp.EcParityNum)
+	}
+	c.fields(
+		"ID", dp.PartitionID,
+		"Volume", dp.VolName,
+		"Status", formatStatus(dp.Status),
+		"Replicas", dp.ReplicaNum,
+		"Hosts", dp.Hosts,
+		"Erasure code", ec,
+		"Media", formatMedia(dp.MediaType),
+		"Cold", dp.Cold,
+		"Last loaded", formatTime(dp.LastLoadedTime),
+		"Missing nodes", formatMissing(dp.MissingNodes),
+		"Files missing replicas", len(dp.FilesWithMissingReplica),
+	)
+	fmt.Fprintln(c.out)
+	t := c.table("ADDR", "DISK", "STATUS", "LEADER", "FILES", "USED", "TOTAL", "REPORTED")
+	for _, r := range dp.Replicas {
+		t.row(r.Addr, r.DiskPath, formatStatus(r.Status), r.IsLeader, r.FileCount, formatSize(r.Used),
+			formatSize(r.Total), formatTime(r.ReportTime))
+	}
+	t.flush()
+}
+
+func formatMissing(nodes map[string]int64) string {
+	if len(nodes) == 0 {
+		return "-"
+	}
+	addrs := make([]string, 0, len(nodes))
+	for addr := range nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return fmt.Sprint(addrs)
+}
+
+var metaPartitionCmd = &command{
+	name:    "metapartition",
+	aliases: []string{"mp"},
+	desc:    "Manage the meta partitions",
+	subs: []*command{
+		{
+			name: "list",
+			args: []string{"volume"},
+			desc: "List the meta partitions of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					var mps []*proto.MetaPartitionView
+					if err := c.request(proto.ClientMetaPartitions, params{"name": args[0]}, &mps); err != nil {
+						return err
+					}
+					sort.Slice(mps, func(i, j int) bool { return mps[i].Start < mps[j].Start })
+					return c.print(mps, func() {
+						t := c.table("ID", "START", "END", "STATUS", "LEADER", "MEMBERS")
+						for _, mp := range mps {
+							t.row(mp.PartitionID, mp.Start, mp.End, formatStatus(mp.Status), mp.LeaderAddr, mp.Members)
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"id"},
+			desc: "Show the replicas of the meta partition",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					mp := new(metaPartitionInfo)
+					if err := c.request(proto.ClientMetaPartition, params{"id": args[0]}, mp); err != nil {
+						return err
+					}
+					return c.print(mp, func() { printMetaPartition(c, mp) })
+				}
+			},
+		},
+		{
+			name: "create",
+			args: []string{"volume", "start"},
+			desc: "Split the inode range of the last meta partition of the volume at the start, creating a new one",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+						return fmt.Errorf("invalid start %q", args[1])
+					}
+					return c.requestMsg(proto.AdminCreateMP, params{"name": args[0], "start": args[1]})
+				}
+			},
+		},
+		{
+			name: "load",
+			args: []string{"id"},
+			desc: "Load the meta partition on its replicas and compare the snapshots",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminLoadMetaPartition, params{"id": args[0]})
+				}
+			},
+		},
+		{
+			name: "decommission",
+			args: []string{"id", "addr"},
+			desc: "Move the replica of the meta partition off the meta node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					if err := c.confirm("Decommission the replica of meta partition %v on %v?", args[0], args[1]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDecommissionMetaPartition, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		{
+			name: "add-replica",
+			args: []string{"id", "addr"},
+			desc: "Add a replica of the meta partition on the meta node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminAddMetaReplica, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+		{
+			name: "del-replica",
+			args: []string{"id", "addr"},
+			desc: "Delete the replica of the meta partition on the meta node",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[0]); err != nil {
+						return err
+					}
+					if err := c.confirm("Delete the replica of meta partition %v on %v?", args[0], args[1]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDeleteMetaReplica, params{"id": args[0], "addr": args[1]})
+				}
+			},
+		},
+	},
+}
+
+func printMetaPartition(c *cli, mp *metaPartitionInfo) {
+	c.fields(
+		"ID", mp.PartitionID,
+		"Start", mp.Start,
+		"End", mp.End,
+		"Max inode", mp.MaxInodeID,
+		"Status", formatStatus(mp.Status),
+		"Replicas", mp.ReplicaNum,
+		"Hosts", mp.Hosts,
+		"Missing nodes", formatMissing(mp.MissNodes),
+	)
+	fmt.Fprintln(c.out)
+	t := c.table("ADDR", "STATUS", "LEADER", "APPLY ID", "REPORTED")
+	for _, r := range mp.Replicas {
+		t.row(r.Addr, formatStatus(r.Status), r.IsLeader, r.ApplyID, formatTime(r.ReportTime))
+	}
+	t.flush()
+	if len(mp.LoadResponse) > 0 {
+		fmt.Fprintln(c.out)
+		t = c.table("LOADED ON", "APPLY ID", "INODE CRC", "DENTRY CRC")
+		for _, r := range mp.LoadResponse {
+			t.row(r.Addr, r.ApplyID, r.InodeSign, r.DentrySign)
+		}
+		t.flush()
+	}
+}
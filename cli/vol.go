@@ -0,0 +1,469 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// the status of a volume
+const (
+	volNormal     uint8 = 0
+	volMarkDelete uint8 = 1
+)
+
+var volCmd = &command{
+	name:    "volume",
+	aliases: []string{"vol"},
+	desc:    "Manage the volumes",
+	subs: []*command{
+		{
+			name: "list",
+			desc: "List the volumes along with their usage",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					cv, err := c.getCluster()
+					if err != nil {
+						return err
+					}
+					return c.print(cv.VolStatInfo, func() {
+						t := c.table("VOLUME", "TOTAL(GB)", "USED(GB)", "USED RATIO")
+						for _, vs := range cv.VolStatInfo {
+							t.row(vs.Name, vs.TotalGB, vs.UsedGB, vs.UsedRatio)
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name:  "info",
+			args:  []string{"name"},
+			desc:  "Show the settings of the volume",
+			setup: func(fs *flag.FlagSet) runFunc { return runVolInfo },
+		},
+		{
+			name: "stat",
+			args: []string{"name"},
+			desc: "Show the capacity and the used space of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					stat := new(proto.VolStatInfo)
+					if err := c.request(proto.ClientVolStat, params{"name": args[0]}, stat); err != nil {
+						return err
+					}
+					return c.print(stat, func() {
+						c.fields("Name", stat.Name, "Total", formatSize(stat.TotalSize), "Used", formatSize(stat.UsedSize))
+					})
+				}
+			},
+		},
+		{
+			name: "create",
+			args: []string{"name", "owner"},
+			desc: "Create a volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				capacity := fs.Uint64("capacity", 10, "capacity in GB")
+				mpCount := fs.Int("mp-count", 3, "number of the meta partitions created initially")
+				dpSize := fs.Int("dp-size", 0, "size of the data partitions in GB, the default of the master if zero")
+				followerRead := fs.Bool("follower-read", false, "allow reading from the followers of the data partitions")
+				return func(c *cli, args []string) error {
+					return c.requestMsg(proto.AdminCreateVol, params{
+						"name":         args[0],
+						"owner":        args[1],
+						"capacity":     strconv.FormatUint(*capacity, 10),
+						"mpCount":      strconv.Itoa(*mpCount),
+						"size":         strconv.Itoa(*dpSize),
+						"followerRead": strconv.FormatBool(*followerRead),
+					})
+				}
+			},
+		},
+		{
+			name: "delete",
+			args: []string{"name"},
+			desc: "Delete the volume along with all its files",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					if err = c.confirm("Delete volume %v and all its files?", args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDeleteVol, p)
+				}
+			},
+		},
+		{
+			name: "update",
+			args: []string{"name"},
+			desc: "Update the capacity, the replicas or the follower read of the volume, the others are kept",
+			setup: func(fs *flag.FlagSet) runFunc {
+				capacity := fs.Uint64("capacity", 0, "capacity in GB")
+				replicas := fs.Int("replicas", 0, "number of the replicas of the data partitions")
+				followerRead := fs.Bool("follower-read", false, "allow reading from the followers of the data partitions")
+				return func(c *cli, args []string) error {
+					vv, err := c.getVol(args[0])
+					if err != nil {
+						return err
+					}
+					p := params{"name": args[0], "authKey": volAuthKey(vv.Owner)}
+					p["capacity"] = strconv.FormatUint(vv.Capacity, 10)
+					p["followerRead"] = strconv.FormatBool(vv.FollowerRead)
+					if isFlagSet(fs, "capacity") {
+						p["capacity"] = strconv.FormatUint(*capacity, 10)
+					}
+					if isFlagSet(fs, "replicas") {
+						p["replicaNum"] = strconv.Itoa(*replicas)
+					}
+					if isFlagSet(fs, "follower-read") {
+						p["followerRead"] = strconv.FormatBool(*followerRead)
+					}
+					return c.requestMsg(proto.AdminUpdateVol, p)
+				}
+			},
+		},
+		{
+			name: "set-trash",
+			args: []string{"name", "hours"},
+			desc: "Set the hours to keep the deleted files in the trash, zero disables the trash",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["retention"] = args[1]
+					return c.requestMsg(proto.AdminSetVolTrash, p)
+				}
+			},
+		},
+		{
+			name: "set-ec",
+			args: []string{"name"},
+			desc: "Set the erasure code of the volume, to which the extents not modified for the days are converted",
+			setup: func(fs *flag.FlagSet) runFunc {
+				dataNum := fs.Uint("data", 0, "number of the data shards")
+				parityNum := fs.Uint("parity", 0, "number of the parity shards")
+				migrateDays := fs.Uint("migrate-days", 0, "days since the last modification, zero disables the conversion")
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["dataNum"] = strconv.FormatUint(uint64(*dataNum), 10)
+					p["parityNum"] = strconv.FormatUint(uint64(*parityNum), 10)
+					p["migrateDays"] = strconv.FormatUint(uint64(*migrateDays), 10)
+					return c.requestMsg(proto.AdminSetVolEc, p)
+				}
+			},
+		},
+		{
+			name: "set-tier",
+			args: []string{"name"},
+			desc: "Set the media of the volume, and the cold tier to which the files not accessed for the days are migrated, the settings not given are kept",
+			setup: func(fs *flag.FlagSet) runFunc {
+				mediaType := fs.String("media", "", "media class of the data partitions written by the clients, any if empty")
+				coldMediaType := fs.String("cold-media", "", "media class of the cold data partitions")
+				coldAfterDays := fs.Uint("cold-after-days", 0, "days since the last access, zero disables the migration")
+				return func(c *cli, args []string) error {
+					vv, err := c.getVol(args[0])
+					if err != nil {
+						return err
+					}
+					p := params{
+						"name":          args[0],
+						"authKey":       volAuthKey(vv.Owner),
+						"mediaType":     vv.MediaType,
+						"coldMediaType": vv.ColdMediaType,
+						"coldAfterDays": strconv.FormatUint(uint64(vv.ColdAfterDays), 10),
+					}
+					if isFlagSet(fs, "media") {
+						p["mediaType"] = *mediaType
+					}
+					if isFlagSet(fs, "cold-media") {
+						p["coldMediaType"] = *coldMediaType
+					}
+					if isFlagSet(fs, "cold-after-days") {
+						p["coldAfterDays"] = strconv.FormatUint(uint64(*coldAfterDays), 10)
+					}
+					return c.requestMsg(proto.AdminSetVolTier, p)
+				}
+			},
+		},
+		{
+			name: "split-dir",
+			args: []string{"name", "inode"},
+			desc: "Split the directory across meta partitions",
+			setup: func(fs *flag.FlagSet) runFunc {
+				count := fs.Int("count", 0, "number of the shards, the default of the master if zero")
+				return func(c *cli, args []string) error {
+					if _, err := parseID(args[1]); err != nil {
+						return err
+					}
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["inode"] = args[1]
+					if *count > 0 {
+						p["count"] = strconv.Itoa(*count)
+					}
+					info := new(proto.DirShardInfo)
+					if err = c.request(proto.AdminSplitDir, p, info); err != nil {
+						return err
+					}
+					return c.print(info, func() {
+						c.fields("Inode", info.Inode, "Meta partitions", info.PartitionIDs)
+					})
+				}
+			},
+		},
+		quotaCmd,
+		snapshotCmd,
+	},
+}
+
+func runVolInfo(c *cli, args []string) error {
+	vv, err := c.getVol(args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(vv, func() {
+		c.fields(
+			"ID", vv.ID,
+			"Name", vv.Name,
+			"Owner", vv.Owner,
+			"Status", formatVolStatus(vv.Status),
+			"Capacity", fmt.Sprintf("%v GB", vv.Capacity),
+			"Data partitions", fmt.Sprintf("%v (%v writable)", vv.DpCnt, vv.RwDpCnt),
+			"Meta partitions", vv.MpCnt,
+			"Data replicas", vv.DpReplicaNum,
+			"Meta replicas", vv.MpReplicaNum,
+			"Follower read", vv.FollowerRead,
+			"Copy on write", vv.CopyOnWrite,
+			"Trash retention", fmt.Sprintf("%v hours", vv.TrashRetention),
+			"Erasure code", formatEc(vv.EcDataNum, vv.EcParityNum, vv.EcMigrateDays),
+			"Media", formatMedia(vv.MediaType),
+			"Cold tier", formatColdTier(vv.ColdMediaType, vv.ColdAfterDays),
+		)
+	})
+}
+
+func formatVolStatus(status uint8) string {
+	switch status {
+	case volNormal:
+		return "Normal"
+	case volMarkDelete:
+		return "MarkDelete"
+	}
+	return strconv.Itoa(int(status))
+}
+
+func formatEc(dataNum, parityNum uint8, migrateDays uint32) string {
+	if migrateDays == 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("%v+%v after %v days", dataNum, parityNum, migrateDays)
+}
+
+func formatMedia(mediaType string) string {
+	if mediaType == "" {
+		return "any"
+	}
+	return mediaType
+}
+
+func formatColdTier(coldMediaType string, coldAfterDays uint32) string {
+	if coldAfterDays == 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("%v after %v days", coldMediaType, coldAfterDays)
+}
+
+var quotaCmd = &command{
+	name: "quota",
+	desc: "Manage the directory quotas of the volume",
+	subs: []*command{
+		{
+			name: "list",
+			args: []string{"volume"},
+			desc: "List the quotas of the volume along with their usage",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					var quotas []*proto.QuotaInfo
+					if err := c.request(proto.AdminListQuota, params{"name": args[0]}, &quotas); err != nil {
+						return err
+					}
+					return c.print(quotas, func() { printQuotas(c, quotas...) })
+				}
+			},
+		},
+		{
+			name: "info",
+			args: []string{"volume", "id"},
+			desc: "Show the quota along with its usage",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					quota := new(proto.QuotaInfo)
+					if err := c.request(proto.AdminGetQuota, params{"name": args[0], "id": args[1]}, quota); err != nil {
+						return err
+					}
+					return c.print(quota, func() { printQuotas(c, quota) })
+				}
+			},
+		},
+		{
+			name: "set",
+			args: []string{"volume"},
+			desc: "Create a quota on the directory, or update the limits of the quota",
+			setup: func(fs *flag.FlagSet) runFunc {
+				id := fs.Uint("id", 0, "ID of the quota to update")
+				inode := fs.Uint64("inode", 0, "inode of the directory to create the quota on")
+				maxFiles := fs.Uint64("max-files", 0, "maximum number of the files, zero if unlimited")
+				maxBytes := fs.Uint64("max-bytes", 0, "maximum bytes of the files, zero if unlimited")
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					switch {
+					case *id != 0:
+						p["id"] = strconv.FormatUint(uint64(*id), 10)
+					case *inode != 0:
+						p["inode"] = strconv.FormatUint(*inode, 10)
+					default:
+						return fmt.Errorf("either -id or -inode is required")
+					}
+					p["maxFiles"] = strconv.FormatUint(*maxFiles, 10)
+					p["maxBytes"] = strconv.FormatUint(*maxBytes, 10)
+					var quotaID uint32
+					if err = c.request(proto.AdminSetQuota, p, &quotaID); err != nil {
+						return err
+					}
+					return c.print(quotaID, func() { fmt.Fprintf(c.out, "set quota[%v] successfully\n", quotaID) })
+				}
+			},
+		},
+		{
+			name: "delete",
+			args: []string{"volume", "id"},
+			desc: "Delete the quota",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["id"] = args[1]
+					if err = c.confirm("Delete quota %v of volume %v?", args[1], args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDeleteQuota, p)
+				}
+			},
+		},
+	},
+}
+
+func printQuotas(c *cli, quotas ...*proto.QuotaInfo) {
+	t := c.table("ID", "INODE", "FILES", "MAX FILES", "BYTES", "MAX BYTES")
+	for _, q := range quotas {
+		t.row(q.QuotaID, q.RootInode, q.UsedFiles, q.MaxFiles, formatSize(q.UsedBytes), formatSize(q.MaxBytes))
+	}
+	t.flush()
+}
+
+var snapshotCmd = &command{
+	name: "snapshot",
+	desc: "Manage the snapshots of the volume",
+	subs: []*command{
+		{
+			name: "list",
+			args: []string{"volume"},
+			desc: "List the snapshots of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					var snapshots []*proto.SnapshotInfo
+					if err := c.request(proto.AdminListSnapshot, params{"name": args[0]}, &snapshots); err != nil {
+						return err
+					}
+					return c.print(snapshots, func() { printSnapshots(c, snapshots...) })
+				}
+			},
+		},
+		{
+			name: "create",
+			args: []string{"volume", "snapshot"},
+			desc: "Create a snapshot of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["snapshot"] = args[1]
+					snapshot := new(proto.SnapshotInfo)
+					if err = c.request(proto.AdminCreateSnapshot, p, snapshot); err != nil {
+						return err
+					}
+					return c.print(snapshot, func() { printSnapshots(c, snapshot) })
+				}
+			},
+		},
+		{
+			name: "delete",
+			args: []string{"volume", "snapshot"},
+			desc: "Delete the snapshot of the volume",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(c *cli, args []string) error {
+					p, err := c.volParams(args[0])
+					if err != nil {
+						return err
+					}
+					p["snapshot"] = args[1]
+					if err = c.confirm("Delete snapshot %v of volume %v?", args[1], args[0]); err != nil {
+						return err
+					}
+					return c.requestMsg(proto.AdminDeleteSnapshot, p)
+				}
+			},
+		},
+	},
+}
+
+func printSnapshots(c *cli, snapshots ...*proto.SnapshotInfo) {
+	t := c.table("ID", "NAME", "CREATED", "STATUS")
+	for _, s := range snapshots {
+		t.row(s.ID, s.Name, formatTime(s.CreateTime), formatSnapshotStatus(s.Status))
+	}
+	t.flush()
+}
+
+func formatSnapshotStatus(status uint8) string {
+	switch status {
+	case proto.SnapshotCreating:
+		return "Creating"
+	case proto.SnapshotNormal:
+		return "Normal"
+	}
+	return strconv.Itoa(int(status))
+}
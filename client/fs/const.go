@@ -46,6 +46,12 @@ const (
 	DeleteExtentsTimeout = 600 * time.Second
 )
 
+const (
+	// the intervals to retry a lock held by others while waiting for it
+	MinLockWaitInterval = 10 * time.Millisecond
+	MaxLockWaitInterval = time.Second
+)
+
 var (
 	// The following two are used in the FUSE cache
 	// every time the lookup will be performed on the fly, and the result will not be cached
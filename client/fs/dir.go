@@ -16,6 +16,7 @@ package fs
 
 import (
 	"os"
+	"sync"
 	"syscall"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -44,7 +46,7 @@ var (
 	_ fs.NodeRemover         = (*Dir)(nil)
 	_ fs.NodeFsyncer         = (*Dir)(nil)
 	_ fs.NodeRequestLookuper = (*Dir)(nil)
-	_ fs.HandleReadDirAller  = (*Dir)(nil)
+	_ fs.NodeOpener          = (*Dir)(nil)
 	_ fs.NodeRenamer         = (*Dir)(nil)
 	_ fs.NodeSetattrer       = (*Dir)(nil)
 	_ fs.NodeSymlinker       = (*Dir)(nil)
@@ -52,6 +54,9 @@ var (
 	_ fs.NodeListxattrer     = (*Dir)(nil)
 	_ fs.NodeSetxattrer      = (*Dir)(nil)
 	_ fs.NodeRemovexattrer   = (*Dir)(nil)
+	_ fs.NodeAccesser        = (*Dir)(nil)
+
+	_ fs.HandleReader = (*DirHandle)(nil)
 )
 
 // NewDir returns a new directory.
@@ -78,7 +83,17 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 // Create handles the create request.
 func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
 	start := time.Now()
-	info, err := d.super.mw.Create_ll(d.inode.ino, req.Name, proto.Mode(req.Mode.Perm()), req.Uid, req.Gid, nil)
+	c := newCredential(&req.Header)
+	parent, err := d.super.InodeGet(d.inode.ino)
+	if err != nil {
+		log.LogErrorf("Create: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
+		return nil, nil, ParseError(err)
+	}
+	if err = parent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return nil, nil, err
+	}
+	mode, gid, acl, dacl := parent.newChild(c, req.Mode&modePermBits, req.Umask)
+	info, err := d.super.mw.CreateWithACL_ll(d.inode.ino, req.Name, proto.Mode(mode), req.Uid, gid, nil, acl, dacl)
 	if err != nil {
 		log.LogErrorf("Create: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
 		return nil, nil, ParseError(err)
@@ -117,7 +132,17 @@ func (d *Dir) Forget() {
 // Mkdir handles the mkdir request.
 func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
 	start := time.Now()
-	info, err := d.super.mw.Create_ll(d.inode.ino, req.Name, proto.Mode(os.ModeDir|req.Mode.Perm()), req.Uid, req.Gid, nil)
+	c := newCredential(&req.Header)
+	parent, err := d.super.InodeGet(d.inode.ino)
+	if err != nil {
+		log.LogErrorf("Mkdir: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
+		return nil, ParseError(err)
+	}
+	if err = parent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return nil, err
+	}
+	mode, gid, acl, dacl := parent.newChild(c, os.ModeDir|req.Mode&modePermBits, req.Umask)
+	info, err := d.super.mw.CreateWithACL_ll(d.inode.ino, req.Name, proto.Mode(mode), req.Uid, gid, nil, acl, dacl)
 	if err != nil {
 		log.LogErrorf("Mkdir: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
 		return nil, ParseError(err)
@@ -139,6 +164,19 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 // Remove handles the remove request.
 func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 	start := time.Now()
+	c := newCredential(&req.Header)
+	parent, err := d.super.InodeGet(d.inode.ino)
+	if err != nil {
+		log.LogErrorf("Remove: parent(%v) name(%v) err(%v)", d.inode.ino, req.Name, err)
+		return ParseError(err)
+	}
+	if err = parent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return err
+	}
+	if err = d.checkSticky(c, parent, req.Name); err != nil {
+		return err
+	}
+
 	d.dcache.Delete(req.Name)
 
 	info, err := d.super.mw.Delete_ll(d.inode.ino, req.Name, req.Dir)
@@ -172,6 +210,10 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 
 	log.LogDebugf("TRACE Lookup: parent(%v) req(%v)", d.inode.ino, req)
 
+	if err = d.super.checkAccess(d.inode.ino, newCredential(&req.Header), proto.ACLExec); err != nil {
+		return nil, err
+	}
+
 	ino, ok := d.dcache.Get(req.Name)
 	if !ok {
 		ino, _, err = d.super.mw.Lookup_ll(d.inode.ino, req.Name)
@@ -208,39 +250,78 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 	return child, nil
 }
 
-// ReadDirAll gets all the dentries in a directory and puts them into the cache.
-func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	start := time.Now()
-	children, err := d.super.mw.ReadDir_ll(d.inode.ino)
-	if err != nil {
-		log.LogErrorf("Readdir: ino(%v) err(%v)", d.inode.ino, err)
-		return make([]fuse.Dirent, 0), ParseError(err)
+// Open handles the open request of the directory.
+func (d *Dir) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	log.LogDebugf("TRACE Open dir: ino(%v)", d.inode.ino)
+	if err := d.super.checkAccess(d.inode.ino, newCredential(&req.Header), proto.ACLRead); err != nil {
+		return nil, err
 	}
+	return &DirHandle{dir: d, stream: d.super.mw.OpenDirStream(d.inode.ino)}, nil
+}
+
+// DirHandle defines the handle of an opened directory, which reads the dentries lazily so that a
+// huge directory is never listed at once.
+type DirHandle struct {
+	dir    *Dir
+	lock   sync.Mutex
+	stream *meta.DirStream
+}
+
+// Read reads the dentries from the offset, and puts them into the cache.
+func (h *DirHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	d := h.dir
+	start := time.Now()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
 
-	inodes := make([]uint64, 0, len(children))
-	dirents := make([]fuse.Dirent, 0, len(children))
-	dcache := NewDentryCache()
+	offset := uint64(req.Offset)
+	if offset == 0 {
+		d.dcache = NewDentryCache()
+	}
+	dcache := d.dcache
 
-	for _, child := range children {
-		dentry := fuse.Dirent{
-			Inode: child.Inode,
-			Type:  ParseType(child.Type),
-			Name:  child.Name,
+	data := resp.Data[:0]
+	inodes := make([]uint64, 0)
+	for full := false; !full; {
+		children, err := h.stream.ReadAt(offset)
+		if err != nil {
+			log.LogErrorf("Readdir: ino(%v) offset(%v) err(%v)", d.inode.ino, offset, err)
+			if len(data) > 0 {
+				break
+			}
+			return ParseError(err)
+		}
+		if len(children) == 0 {
+			break
+		}
+		for _, child := range children {
+			dentry := fuse.Dirent{
+				Inode: child.Inode,
+				Type:  ParseType(child.Type),
+				Name:  child.Name,
+			}
+			size := len(data)
+			if data = fuse.AppendDirentAt(data, dentry, offset+1); len(data) > req.Size {
+				data = data[:size]
+				full = true
+				break
+			}
+			offset++
+			inodes = append(inodes, child.Inode)
+			dcache.Put(child.Name, child.Inode)
 		}
-		inodes = append(inodes, child.Inode)
-		dirents = append(dirents, dentry)
-		dcache.Put(child.Name, child.Inode)
 	}
+	resp.Data = data
 
 	infos := d.super.mw.BatchInodeGet(inodes)
 	for _, info := range infos {
 		d.super.ic.Put(NewInode(info))
 	}
-	d.dcache = dcache
 
 	elapsed := time.Since(start)
-	log.LogDebugf("TRACE ReadDir: ino(%v) (%v)ns", d.inode.ino, elapsed.Nanoseconds())
-	return dirents, nil
+	log.LogDebugf("TRACE ReadDir: ino(%v) offset(%v) dentries(%v) (%v)ns", d.inode.ino, req.Offset, len(inodes), elapsed.Nanoseconds())
+	return nil
 }
 
 // Rename handles the rename request.
@@ -251,6 +332,9 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Nod
 		return fuse.ENOTSUP
 	}
 	start := time.Now()
+	if err := d.checkRename(newCredential(&req.Header), req, dstDir); err != nil {
+		return err
+	}
 	d.dcache.Delete(req.OldName)
 	err := d.super.mw.Rename_ll(d.inode.ino, req.OldName, dstDir.inode.ino, req.NewName)
 	if err != nil {
@@ -275,13 +359,23 @@ func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.
 		log.LogErrorf("Setattr: ino(%v) err(%v)", ino, err)
 		return ParseError(err)
 	}
+	c := newCredential(&req.Header)
+	if err = inode.checkSetattr(c, req); err != nil {
+		return err
+	}
 
 	if valid := inode.setattr(req); valid != 0 {
-		err = d.super.mw.Setattr(ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
+		err = d.super.mw.SetattrAs(c.caller(), ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
 		if err != nil {
 			d.super.ic.Delete(ino)
 			return ParseError(err)
 		}
+		if valid&proto.AttrMode != 0 && inode.acl != nil {
+			if err = d.super.chmodACL(inode, c); err != nil {
+				log.LogErrorf("Setattr: ino(%v) err(%v)", ino, err)
+				return err
+			}
+		}
 	}
 
 	inode.fillAttr(&resp.Attr)
@@ -297,7 +391,17 @@ func (d *Dir) Mknod(ctx context.Context, req *fuse.MknodRequest) (fs.Node, error
 	}
 
 	start := time.Now()
-	info, err := d.super.mw.Create_ll(d.inode.ino, req.Name, proto.Mode(req.Mode), req.Uid, req.Gid, nil)
+	c := newCredential(&req.Header)
+	parent, err := d.super.InodeGet(d.inode.ino)
+	if err != nil {
+		log.LogErrorf("Mknod: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
+		return nil, ParseError(err)
+	}
+	if err = parent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return nil, err
+	}
+	mode, gid, acl, dacl := parent.newChild(c, req.Mode, req.Umask)
+	info, err := d.super.mw.CreateWithACL_ll(d.inode.ino, req.Name, proto.Mode(mode), req.Uid, gid, nil, acl, dacl)
 	if err != nil {
 		log.LogErrorf("Mknod: parent(%v) req(%v) err(%v)", d.inode.ino, req, err)
 		return nil, ParseError(err)
@@ -320,7 +424,17 @@ func (d *Dir) Mknod(ctx context.Context, req *fuse.MknodRequest) (fs.Node, error
 func (d *Dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
 	parentIno := d.inode.ino
 	start := time.Now()
-	info, err := d.super.mw.Create_ll(parentIno, req.NewName, proto.Mode(os.ModeSymlink|os.ModePerm), req.Uid, req.Gid, []byte(req.Target))
+	c := newCredential(&req.Header)
+	parent, err := d.super.InodeGet(parentIno)
+	if err != nil {
+		log.LogErrorf("Symlink: parent(%v) NewName(%v) err(%v)", parentIno, req.NewName, err)
+		return nil, ParseError(err)
+	}
+	if err = parent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return nil, err
+	}
+	mode, gid, _, _ := parent.newChild(c, os.ModeSymlink|os.ModePerm, 0)
+	info, err := d.super.mw.Create_ll(parentIno, req.NewName, proto.Mode(mode), req.Uid, gid, []byte(req.Target))
 	if err != nil {
 		log.LogErrorf("Symlink: parent(%v) NewName(%v) err(%v)", parentIno, req.NewName, err)
 		return nil, ParseError(err)
@@ -355,6 +469,9 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.
 	}
 
 	start := time.Now()
+	if err := d.super.checkAccess(d.inode.ino, newCredential(&req.Header), proto.ACLWrite|proto.ACLExec); err != nil {
+		return nil, err
+	}
 
 	info, err := d.super.mw.Link(d.inode.ino, req.NewName, oldInode.ino)
 	if err != nil {
@@ -378,22 +495,141 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.
 	return newFile, nil
 }
 
-// Getxattr has not been implemented yet.
+// Getxattr gets an extended attribute.
 func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ENOSYS
+	ino := d.inode.ino
+	if err := d.super.checkXAttr(ino, newCredential(&req.Header), req.Name, proto.ACLRead); err != nil {
+		return err
+	}
+	value, err := d.super.mw.XAttrGet_ll(ino, req.Name)
+	if err != nil {
+		log.LogDebugf("Getxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	resp.Xattr = value
+	log.LogDebugf("TRACE Getxattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
 }
 
-// Listxattr has not been implemented yet.
+// Listxattr lists the extended attributes.
 func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ENOSYS
+	ino := d.inode.ino
+	names, err := d.super.mw.XAttrsList_ll(ino)
+	if err != nil {
+		log.LogErrorf("Listxattr: ino(%v) err(%v)", ino, err)
+		return ParseError(err)
+	}
+	resp.Append(names...)
+	log.LogDebugf("TRACE Listxattr: ino(%v) names(%v)", ino, names)
+	return nil
 }
 
-// Setxattr has not been implemented yet.
+// Setxattr sets an extended attribute.
 func (d *Dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return fuse.ENOSYS
+	ino := d.inode.ino
+	c := newCredential(&req.Header)
+	if isACLXAttr(req.Name) {
+		if err := d.super.setACL(ino, c, req.Name, req.Xattr); err != nil {
+			log.LogErrorf("Setxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+			return err
+		}
+		log.LogDebugf("TRACE Setxattr: ino(%v) name(%v)", ino, req.Name)
+		return nil
+	}
+	if err := d.super.checkXAttr(ino, c, req.Name, proto.ACLWrite); err != nil {
+		return err
+	}
+	if err := d.super.mw.XAttrSetAs_ll(c.caller(), ino, req.Name, req.Xattr, req.Flags); err != nil {
+		log.LogErrorf("Setxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	log.LogDebugf("TRACE Setxattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
 }
 
-// Removexattr has not been implemented yet.
+// Removexattr removes an extended attribute.
 func (d *Dir) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
-	return fuse.ENOSYS
+	ino := d.inode.ino
+	c := newCredential(&req.Header)
+	if err := d.super.checkXAttr(ino, c, req.Name, proto.ACLWrite); err != nil {
+		return err
+	}
+	if err := d.super.mw.XAttrDelAs_ll(c.caller(), ino, req.Name); err != nil {
+		log.LogErrorf("Removexattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	if isACLXAttr(req.Name) {
+		d.super.ic.Delete(ino)
+	}
+	log.LogDebugf("TRACE Removexattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
+}
+
+// Access handles the access request.
+func (d *Dir) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	return d.super.checkAccess(d.inode.ino, newCredential(&req.Header), uint16(req.Mask))
+}
+
+// lookupChild returns the inode of the entry in the directory.
+func (d *Dir) lookupChild(name string) (*Inode, error) {
+	ino, _, err := d.super.mw.Lookup_ll(d.inode.ino, name)
+	if err != nil {
+		return nil, ParseError(err)
+	}
+	inode, err := d.super.InodeGet(ino)
+	if err != nil {
+		return nil, ParseError(err)
+	}
+	return inode, nil
+}
+
+// checkSticky checks if the caller may remove the entry from the directory with the sticky bit.
+func (d *Dir) checkSticky(c *credential, parent *Inode, name string) error {
+	if parent.mode&os.ModeSticky == 0 || parent.isOwner(c) {
+		return nil
+	}
+	child, err := d.lookupChild(name)
+	if err != nil {
+		return err
+	}
+	return child.checkSticky(c, parent)
+}
+
+// checkRename checks if the caller may rename the entry to the destination directory, which
+// replaces the existing entry if there is any. A directory moved to another parent takes the write
+// permission too, as its ".." entry changes.
+func (d *Dir) checkRename(c *credential, req *fuse.RenameRequest, dstDir *Dir) error {
+	srcParent, err := d.super.InodeGet(d.inode.ino)
+	if err != nil {
+		return ParseError(err)
+	}
+	if err = srcParent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return err
+	}
+	dstParent, err := d.super.InodeGet(dstDir.inode.ino)
+	if err != nil {
+		return ParseError(err)
+	}
+	if err = dstParent.access(c, proto.ACLWrite|proto.ACLExec); err != nil {
+		return err
+	}
+
+	if srcParent.mode&os.ModeSticky != 0 || srcParent.ino != dstParent.ino {
+		child, err := d.lookupChild(req.OldName)
+		if err != nil {
+			return err
+		}
+		if err = child.checkSticky(c, srcParent); err != nil {
+			return err
+		}
+		if srcParent.ino != dstParent.ino && child.mode.IsDir() {
+			if err = child.access(c, proto.ACLWrite); err != nil {
+				return err
+			}
+		}
+	}
+	if err = dstDir.checkSticky(c, dstParent, req.NewName); err != nil && err != fuse.ENOENT {
+		return err
+	}
+	return nil
 }
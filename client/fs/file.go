@@ -17,6 +17,7 @@ package fs
 import (
 	"fmt"
 	"io"
+	"math"
 	"syscall"
 	"time"
 
@@ -53,6 +54,8 @@ var (
 	_ fs.NodeListxattrer   = (*File)(nil)
 	_ fs.NodeSetxattrer    = (*File)(nil)
 	_ fs.NodeRemovexattrer = (*File)(nil)
+	_ fs.HandleLocker      = (*File)(nil)
+	_ fs.NodeAccesser      = (*File)(nil)
 )
 
 // NewFile returns a new file.
@@ -114,6 +117,10 @@ func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 	ino := f.inode.ino
 	start := time.Now()
 
+	if err = f.super.checkAccess(ino, newCredential(&req.Header), openPerm(req.Flags)); err != nil {
+		return nil, err
+	}
+
 	f.super.ec.OpenStream(ino)
 
 	if f.super.keepCache {
@@ -132,6 +139,14 @@ func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) (err error
 
 	start := time.Now()
 
+	if req.ReleaseFlags&fuse.ReleaseFlockUnlock != 0 {
+		lock := &proto.FileLock{Owner: req.LockOwner, Type: proto.FileLockUnlock, End: proto.FileLockEOF, Flock: true}
+		if err = f.super.mw.SetLock_ll(ino, lock); err != nil {
+			// released once the lease expires anyway
+			log.LogWarnf("Release: flock unlock failed, ino(%v) req(%v) err(%v)", ino, req, err)
+		}
+	}
+
 	//log.LogDebugf("TRACE Release close stream: ino(%v) req(%v)", ino, req)
 
 	err = f.super.ec.CloseStream(ino)
@@ -209,6 +224,10 @@ func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 	start := time.Now()
 
 	size, err := f.super.ec.Write(ino, int(req.Offset), req.Data, enSyncWrite)
+	if err == syscall.EDQUOT {
+		log.LogWarnf("Write: ino(%v) offset(%v) len(%v) err(%v)", ino, req.Offset, reqlen, err)
+		return ParseError(err)
+	}
 	if err != nil {
 		msg := fmt.Sprintf("Write: ino(%v) offset(%v) len(%v) err(%v)", ino, req.Offset, reqlen, err)
 		f.super.handleError("Write", msg)
@@ -259,6 +278,16 @@ func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
 	ino := f.inode.ino
 	start := time.Now()
+	inode, err := f.super.InodeGet(ino)
+	if err != nil {
+		log.LogErrorf("Setattr: InodeGet failed, ino(%v) err(%v)", ino, err)
+		return ParseError(err)
+	}
+	c := newCredential(&req.Header)
+	if err = inode.checkSetattr(c, req); err != nil {
+		return err
+	}
+
 	if req.Valid.Size() {
 		if err := f.super.ec.Flush(ino); err != nil {
 			log.LogErrorf("Setattr: truncate wait for flush ino(%v) size(%v) err(%v)", ino, req.Size, err)
@@ -272,7 +301,7 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 		f.super.ec.RefreshExtentsCache(ino)
 	}
 
-	inode, err := f.super.InodeGet(ino)
+	inode, err = f.super.InodeGet(ino)
 	if err != nil {
 		log.LogErrorf("Setattr: InodeGet failed, ino(%v) err(%v)", ino, err)
 		return ParseError(err)
@@ -285,11 +314,17 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 	}
 
 	if valid := inode.setattr(req); valid != 0 {
-		err = f.super.mw.Setattr(ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
+		err = f.super.mw.SetattrAs(c.caller(), ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
 		if err != nil {
 			f.super.ic.Delete(ino)
 			return ParseError(err)
 		}
+		if valid&proto.AttrMode != 0 && inode.acl != nil {
+			if err = f.super.chmodACL(inode, c); err != nil {
+				log.LogErrorf("Setattr: ino(%v) err(%v)", ino, err)
+				return err
+			}
+		}
 	}
 
 	inode.fillAttr(&resp.Attr)
@@ -299,6 +334,11 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse
 	return nil
 }
 
+// Access handles the access request.
+func (f *File) Access(ctx context.Context, req *fuse.AccessRequest) error {
+	return f.super.checkAccess(f.inode.ino, newCredential(&req.Header), uint16(req.Mask))
+}
+
 // Readlink handles the readlink request.
 func (f *File) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
 	ino := f.inode.ino
@@ -311,24 +351,168 @@ func (f *File) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string,
 	return string(inode.target), nil
 }
 
-// Getxattr has not been implemented yet.
+// Getxattr gets an extended attribute.
 func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return fuse.ENOSYS
+	ino := f.inode.ino
+	if err := f.super.checkXAttr(ino, newCredential(&req.Header), req.Name, proto.ACLRead); err != nil {
+		return err
+	}
+	value, err := f.super.mw.XAttrGet_ll(ino, req.Name)
+	if err != nil {
+		log.LogDebugf("Getxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	resp.Xattr = value
+	log.LogDebugf("TRACE Getxattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
 }
 
-// Listxattr has not been implemented yet.
+// Listxattr lists the extended attributes.
 func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return fuse.ENOSYS
+	ino := f.inode.ino
+	names, err := f.super.mw.XAttrsList_ll(ino)
+	if err != nil {
+		log.LogErrorf("Listxattr: ino(%v) err(%v)", ino, err)
+		return ParseError(err)
+	}
+	resp.Append(names...)
+	log.LogDebugf("TRACE Listxattr: ino(%v) names(%v)", ino, names)
+	return nil
 }
 
-// Setxattr has not been implemented yet.
+// Setxattr sets an extended attribute.
 func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return fuse.ENOSYS
+	ino := f.inode.ino
+	c := newCredential(&req.Header)
+	if isACLXAttr(req.Name) {
+		if err := f.super.setACL(ino, c, req.Name, req.Xattr); err != nil {
+			log.LogErrorf("Setxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+			return err
+		}
+		log.LogDebugf("TRACE Setxattr: ino(%v) name(%v)", ino, req.Name)
+		return nil
+	}
+	if err := f.super.checkXAttr(ino, c, req.Name, proto.ACLWrite); err != nil {
+		return err
+	}
+	if err := f.super.mw.XAttrSetAs_ll(c.caller(), ino, req.Name, req.Xattr, req.Flags); err != nil {
+		log.LogErrorf("Setxattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	log.LogDebugf("TRACE Setxattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
 }
 
-// Removexattr has not been implemented yet.
+// Removexattr removes an extended attribute.
 func (f *File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
-	return fuse.ENOSYS
+	ino := f.inode.ino
+	c := newCredential(&req.Header)
+	if err := f.super.checkXAttr(ino, c, req.Name, proto.ACLWrite); err != nil {
+		return err
+	}
+	if err := f.super.mw.XAttrDelAs_ll(c.caller(), ino, req.Name); err != nil {
+		log.LogErrorf("Removexattr: ino(%v) name(%v) err(%v)", ino, req.Name, err)
+		return ParseError(err)
+	}
+	if isACLXAttr(req.Name) {
+		f.super.ic.Delete(ino)
+	}
+	log.LogDebugf("TRACE Removexattr: ino(%v) name(%v)", ino, req.Name)
+	return nil
+}
+
+// Lock acquires or releases a flock or POSIX lock, which excludes the locks of the other hosts as well.
+func (f *File) Lock(ctx context.Context, req *fuse.LockRequest) (err error) {
+	ino := f.inode.ino
+	lock, err := newFileLock(req.LockOwner, req.Lock, req.LockFlags)
+	if err != nil {
+		log.LogErrorf("Lock: ino(%v) req(%v) err(%v)", ino, req, err)
+		return ParseError(err)
+	}
+	interval := MinLockWaitInterval
+	for {
+		err = f.super.mw.SetLock_ll(ino, lock)
+		if err != syscall.EAGAIN || !req.Wait {
+			break
+		}
+		// wait for the release of the conflicting locks, or for the interruption
+		select {
+		case <-ctx.Done():
+			log.LogDebugf("Lock: interrupted, ino(%v) req(%v)", ino, req)
+			return fuse.EINTR
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > MaxLockWaitInterval {
+			interval = MaxLockWaitInterval
+		}
+	}
+	if err != nil {
+		if err == syscall.EAGAIN {
+			log.LogDebugf("Lock: ino(%v) req(%v) err(%v)", ino, req, err)
+		} else {
+			log.LogErrorf("Lock: ino(%v) req(%v) err(%v)", ino, req, err)
+		}
+		return ParseError(err)
+	}
+	log.LogDebugf("TRACE Lock: ino(%v) req(%v)", ino, req)
+	return nil
+}
+
+// QueryLock returns a lock conflicting with the given one, i.e. F_GETLK.
+func (f *File) QueryLock(ctx context.Context, req *fuse.QueryLockRequest, resp *fuse.QueryLockResponse) error {
+	ino := f.inode.ino
+	lock, err := newFileLock(req.LockOwner, req.Lock, req.LockFlags)
+	if err != nil {
+		log.LogErrorf("QueryLock: ino(%v) req(%v) err(%v)", ino, req, err)
+		return ParseError(err)
+	}
+	conflict, err := f.super.mw.GetLock_ll(ino, lock)
+	if err != nil {
+		log.LogErrorf("QueryLock: ino(%v) req(%v) err(%v)", ino, req, err)
+		return ParseError(err)
+	}
+	resp.Lock = fuse.FileLock{Start: conflict.Start, End: conflict.End, PID: conflict.Pid}
+	switch conflict.Type {
+	case proto.FileLockRead:
+		resp.Lock.Type = fuse.LockRead
+	case proto.FileLockWrite:
+		resp.Lock.Type = fuse.LockWrite
+	default:
+		resp.Lock.Type = fuse.LockUnlock
+	}
+	if resp.Lock.End == proto.FileLockEOF {
+		resp.Lock.End = math.MaxInt64
+	}
+	log.LogDebugf("TRACE QueryLock: ino(%v) req(%v) resp(%v)", ino, req, resp)
+	return nil
+}
+
+// Converts a lock of FUSE, whose range ends at OFFSET_MAX of the kernel if it is to the end of the file.
+func newFileLock(owner uint64, l fuse.FileLock, flags fuse.LockFlags) (*proto.FileLock, error) {
+	lock := &proto.FileLock{
+		Owner: owner,
+		Pid:   l.PID,
+		Start: l.Start,
+		End:   l.End,
+		Flock: flags&fuse.LockFlock != 0,
+	}
+	switch l.Type {
+	case fuse.LockRead:
+		lock.Type = proto.FileLockRead
+	case fuse.LockWrite:
+		lock.Type = proto.FileLockWrite
+	case fuse.LockUnlock:
+		lock.Type = proto.FileLockUnlock
+	default:
+		return nil, syscall.EINVAL
+	}
+	if lock.End >= math.MaxInt64 {
+		lock.End = proto.FileLockEOF
+	}
+	if lock.Start > lock.End {
+		return nil, syscall.EINVAL
+	}
+	return lock, nil
 }
 
 func (f *File) fileSize(ino uint64) (size int, gen uint64) {
@@ -43,6 +43,9 @@ type Inode struct {
 	mode   os.FileMode
 	target []byte
 
+	acl        proto.ACL // access ACL
+	defaultACL proto.ACL
+
 	// protected under the inode cache lock
 	expiration int64
 }
@@ -112,6 +115,20 @@ func (inode *Inode) fill(info *proto.InodeInfo) {
 	inode.mtime = info.ModifyTime
 	inode.target = info.Target
 	inode.mode = proto.OsMode(info.Mode)
+	inode.acl = parseACL(info.Inode, info.ACL)
+	inode.defaultACL = parseACL(info.Inode, info.DefaultACL)
+}
+
+func parseACL(ino uint64, raw []byte) proto.ACL {
+	if len(raw) == 0 {
+		return nil
+	}
+	acl, err := proto.ParseACL(raw)
+	if err != nil {
+		log.LogWarnf("parseACL: ino(%v) err(%v)", ino, err)
+		return nil
+	}
+	return acl
 }
 
 func (inode *Inode) fillAttr(attr *fuse.Attr) {
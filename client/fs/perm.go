@@ -0,0 +1,331 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The permissions are checked against the caller of each FUSE request by the client, rather than
+// by the kernel with default_permissions, which would ignore the ACLs.
+
+// the permission bits kept in the mode of a new inode
+const modePermBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+var errAccess = fuse.Errno(syscall.EACCES)
+
+// credential defines the caller of a request.
+type credential struct {
+	uid    uint32
+	gid    uint32
+	pid    uint32
+	groups []uint32 // supplementary groups, loaded on demand
+	loaded bool
+}
+
+func newCredential(h *fuse.Header) *credential {
+	return &credential{uid: h.Uid, gid: h.Gid, pid: h.Pid}
+}
+
+func (c *credential) isRoot() bool {
+	return c.uid == 0
+}
+
+// caller returns the caller of the request sent to the metanode, which checks the ownership against it as well.
+func (c *credential) caller() *proto.Caller {
+	if c.isRoot() {
+		return &proto.Caller{}
+	}
+	if !c.loaded {
+		c.groups = loadGroups(c.pid)
+		c.loaded = true
+	}
+	return &proto.Caller{Uid: c.uid, Groups: append([]uint32{c.gid}, c.groups...)}
+}
+
+// inGroup checks if the caller is a member of the group. The supplementary groups are not carried
+// by the FUSE requests, and thus read from the status of the calling process.
+func (c *credential) inGroup(gid uint32) bool {
+	if gid == c.gid {
+		return true
+	}
+	if !c.loaded {
+		c.groups = loadGroups(c.pid)
+		c.loaded = true
+	}
+	for _, g := range c.groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+func loadGroups(pid uint32) (groups []uint32) {
+	if pid == 0 {
+		// the caller is out of the pid namespace of the client
+		return
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		log.LogWarnf("loadGroups: pid(%v) err(%v)", pid, err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "Groups:")) {
+			if gid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				groups = append(groups, uint32(gid))
+			}
+		}
+		break
+	}
+	return
+}
+
+// access checks if the caller is permitted to access the inode with the permission bits, by the
+// access ACL if there is any, or the mode otherwise.
+func (inode *Inode) access(c *credential, want uint16) error {
+	if c.isRoot() {
+		// root is not permitted to execute only if nobody is
+		if want&proto.ACLExec != 0 && !inode.mode.IsDir() && inode.mode&0111 == 0 {
+			return errAccess
+		}
+		return nil
+	}
+	if inode.acl != nil {
+		if !inode.acl.Permits(c.uid, c.inGroup, inode.uid, inode.gid, want) {
+			return errAccess
+		}
+		return nil
+	}
+	var perm uint16
+	switch {
+	case c.uid == inode.uid:
+		perm = uint16(inode.mode>>6) & 7
+	case c.inGroup(inode.gid):
+		perm = uint16(inode.mode>>3) & 7
+	default:
+		perm = uint16(inode.mode) & 7
+	}
+	if perm&want != want {
+		return errAccess
+	}
+	return nil
+}
+
+func (inode *Inode) isOwner(c *credential) bool {
+	return c.isRoot() || c.uid == inode.uid
+}
+
+// checkSticky checks if the caller may remove or rename the inode in the directory, which is only
+// permitted to the owners of the inode and the directory if the directory has the sticky bit.
+func (inode *Inode) checkSticky(c *credential, dir *Inode) error {
+	if dir.mode&os.ModeSticky == 0 || inode.isOwner(c) || c.uid == dir.uid {
+		return nil
+	}
+	return fuse.EPERM
+}
+
+// checkSetattr checks if the caller may change the attributes of the inode as requested. The
+// setgid bit is dropped from the new mode if the caller is not a member of the group.
+func (inode *Inode) checkSetattr(c *credential, req *fuse.SetattrRequest) error {
+	if req.Valid.Uid() && req.Uid != inode.uid && !c.isRoot() {
+		return fuse.EPERM
+	}
+	gid := inode.gid
+	if req.Valid.Gid() {
+		gid = req.Gid
+		if gid != inode.gid && !c.isRoot() && (c.uid != inode.uid || !c.inGroup(gid)) {
+			return fuse.EPERM
+		}
+	}
+	if req.Valid.Mode() {
+		if !inode.isOwner(c) {
+			return fuse.EPERM
+		}
+		if !c.isRoot() && !c.inGroup(gid) {
+			req.Mode &^= os.ModeSetgid
+		}
+	}
+	if req.Valid.Size() && !req.Valid.Handle() {
+		if err := inode.access(c, proto.ACLWrite); err != nil {
+			return err
+		}
+	}
+	if req.Valid.Atime() || req.Valid.Mtime() {
+		// setting the times to the current time only takes the write permission, like utime(2)
+		now := (!req.Valid.Atime() || req.Valid.AtimeNow()) && (!req.Valid.Mtime() || req.Valid.MtimeNow())
+		if !inode.isOwner(c) && (!now || inode.access(c, proto.ACLWrite) != nil) {
+			return fuse.EPERM
+		}
+	}
+	return nil
+}
+
+// newChild returns the mode, the gid and the ACLs of a new inode created by the caller in the
+// directory. The new inode inherits the default ACL of the directory if there is any, or the mode
+// is masked by the umask otherwise. The group of the directory with the setgid bit is inherited too.
+func (inode *Inode) newChild(c *credential, mode, umask os.FileMode) (os.FileMode, uint32, []byte, []byte) {
+	var (
+		gid       = c.gid
+		acl, dacl []byte
+		isDir     = mode.IsDir()
+		isSymlink = mode&os.ModeSymlink != 0
+	)
+	if inode.mode&os.ModeSetgid != 0 {
+		gid = inode.gid
+		if isDir {
+			mode |= os.ModeSetgid
+		}
+	}
+	switch {
+	case isSymlink:
+	case inode.defaultACL == nil:
+		mode &^= umask
+	default:
+		var access proto.ACL
+		access, mode = inode.defaultACL.Inherit(mode)
+		if !access.IsMinimal() {
+			acl = access.Marshal()
+		}
+		if isDir {
+			dacl = inode.defaultACL.Marshal()
+		}
+	}
+	return mode, gid, acl, dacl
+}
+
+// openPerm returns the permission bits taken to open a file with the flags.
+func openPerm(flags fuse.OpenFlags) (want uint16) {
+	switch flags & fuse.OpenAccessModeMask {
+	case fuse.OpenReadOnly:
+		want = proto.ACLRead
+	case fuse.OpenWriteOnly:
+		want = proto.ACLWrite
+	default:
+		want = proto.ACLRead | proto.ACLWrite
+	}
+	if flags&fuse.OpenTruncate != 0 {
+		want |= proto.ACLWrite
+	}
+	return
+}
+
+func isACLXAttr(name string) bool {
+	return name == proto.XAttrACLAccess || name == proto.XAttrACLDefault
+}
+
+// checkAccess checks if the caller is permitted to access the inode with the permission bits.
+func (s *Super) checkAccess(ino uint64, c *credential, want uint16) error {
+	inode, err := s.InodeGet(ino)
+	if err != nil {
+		return ParseError(err)
+	}
+	return inode.access(c, want)
+}
+
+// checkXAttr checks if the caller may access the extended attribute of the inode with the
+// permission bits. The ACLs are readable by anyone, but only changed by the owner.
+func (s *Super) checkXAttr(ino uint64, c *credential, name string, want uint16) error {
+	inode, err := s.InodeGet(ino)
+	if err != nil {
+		return ParseError(err)
+	}
+	if !isACLXAttr(name) {
+		return inode.access(c, want)
+	}
+	if want&proto.ACLWrite != 0 && !inode.isOwner(c) {
+		return fuse.EPERM
+	}
+	return nil
+}
+
+// setACL sets the ACL of the inode. The permission bits of the mode are kept in sync with the
+// access ACL, which is not kept at all if it is equivalent to the mode.
+func (s *Super) setACL(ino uint64, c *credential, name string, value []byte) error {
+	if err := s.checkXAttr(ino, c, name, proto.ACLWrite); err != nil {
+		return err
+	}
+	inode, err := s.InodeGet(ino)
+	if err != nil {
+		return ParseError(err)
+	}
+	defer s.ic.Delete(ino)
+
+	if len(value) == 0 {
+		return s.removeACL(ino, c, name)
+	}
+	acl, err := proto.ParseACL(value)
+	if err != nil {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	if name == proto.XAttrACLDefault {
+		if !inode.mode.IsDir() {
+			return errAccess
+		}
+		if err = s.mw.XAttrSetAs_ll(c.caller(), ino, name, value, 0); err != nil {
+			return ParseError(err)
+		}
+		return nil
+	}
+
+	mode := inode.mode&^os.ModePerm | acl.Mode()
+	if !c.isRoot() && !c.inGroup(inode.gid) {
+		mode &^= os.ModeSetgid
+	}
+	if mode != inode.mode {
+		if err = s.mw.SetattrAs(c.caller(), ino, proto.AttrMode, proto.Mode(mode), inode.uid, inode.gid); err != nil {
+			return ParseError(err)
+		}
+	}
+	if acl.IsMinimal() {
+		return s.removeACL(ino, c, name)
+	}
+	if err = s.mw.XAttrSetAs_ll(c.caller(), ino, name, value, 0); err != nil {
+		return ParseError(err)
+	}
+	return nil
+}
+
+func (s *Super) removeACL(ino uint64, c *credential, name string) error {
+	if err := s.mw.XAttrDelAs_ll(c.caller(), ino, name); err != nil && err != syscall.ENODATA {
+		return ParseError(err)
+	}
+	return nil
+}
+
+// chmodACL updates the access ACL of the inode with the permission bits of the changed mode.
+func (s *Super) chmodACL(inode *Inode, c *credential) error {
+	acl := inode.acl.Chmod(inode.mode)
+	if err := s.mw.XAttrSetAs_ll(c.caller(), inode.ino, proto.XAttrACLAccess, acl.Marshal(), 0); err != nil {
+		s.ic.Delete(inode.ino)
+		return ParseError(err)
+	}
+	inode.acl = acl
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"golang.org/x/net/context"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,30 +28,43 @@ import (
 
 	"github.com/chubaofs/chubaofs/sdk/data/stream"
 	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
 	"github.com/chubaofs/chubaofs/util/ump"
 )
 
 type MountOption struct {
-	MountPoint    string
-	Volname       string
-	Owner         string
-	Master        string
-	Logpath       string
-	Loglvl        string
-	Profport      string
-	IcacheTimeout int64
-	LookupValid   int64
-	AttrValid     int64
-	ReadRate      int64
-	WriteRate     int64
-	EnSyncWrite   int64
-	AutoInvalData int64
-	UmpDatadir    string
-	Rdonly        bool
-	WriteCache    bool
-	KeepCache     bool
+	MountPoint     string
+	Volname        string
+	Owner          string
+	Master         string
+	Logpath        string
+	Loglvl         string
+	Profport       string
+	IcacheTimeout  int64
+	LookupValid    int64
+	AttrValid      int64
+	ReadRate       int64
+	WriteRate      int64
+	EnSyncWrite    int64
+	AutoInvalData  int64
+	UmpDatadir     string
+	Rdonly         bool
+	WriteCache     bool
+	KeepCache      bool
+	AuthNodes      string
+	ClientID       string
+	ClientKey      string
+	AuthCertFile   string
+	Snapshot       string // name of the volume snapshot to mount read-only
+	EnableFileLock bool   // keep the flock and POSIX locks on the metanodes, so that they work across hosts
+
+	BlockCachePolicy   string
+	BlockCacheSize     int64 // in MB
+	BlockCacheDiskSize int64 // in MB
+	BlockCacheDir      string
 }
 
 // Super defines the struct of a super block.
@@ -78,15 +92,35 @@ var (
 // NewSuper returns a new Super.
 func NewSuper(opt *MountOption) (s *Super, err error) {
 	s = new(Super)
-	s.mw, err = meta.NewMetaWrapper(opt.Volname, opt.Owner, opt.Master)
+	var authenticator *auth.Authenticator
+	if opt.AuthNodes != "" {
+		authenticator, err = auth.NewAuthenticator(strings.Split(opt.AuthNodes, ","), opt.ClientID, opt.ClientKey, opt.AuthCertFile)
+		if err != nil {
+			return nil, errors.Trace(err, "NewAuthenticator failed!")
+		}
+	}
+
+	s.mw, err = meta.NewMetaWrapper(opt.Volname, opt.Owner, opt.Master, authenticator)
 	if err != nil {
 		return nil, errors.Trace(err, "NewMetaWrapper failed!")
 	}
+	if opt.Snapshot != "" {
+		if err = s.mw.MountSnapshot(opt.Snapshot); err != nil {
+			return nil, errors.Trace(err, "MountSnapshot failed!")
+		}
+	}
 
-	s.ec, err = stream.NewExtentClient(opt.Volname, opt.Master, opt.ReadRate, opt.WriteRate, s.mw.AppendExtentKey, s.mw.GetExtents, s.mw.Truncate)
+	s.ec, err = stream.NewExtentClient(opt.Volname, opt.Master, authenticator, opt.ReadRate, opt.WriteRate, s.mw.AppendExtentKey, s.mw.GetExtents, s.mw.Truncate, s.mw.OverwriteExtents, s.mw.CheckQuota)
 	if err != nil {
 		return nil, errors.Trace(err, "NewExtentClient failed!")
 	}
+	if opt.BlockCachePolicy != "" && opt.BlockCachePolicy != stream.BlockCachePolicyNone {
+		cache, err := stream.NewBlockCache(opt.BlockCachePolicy, opt.BlockCacheSize*util.MB, opt.BlockCacheDiskSize*util.MB, opt.BlockCacheDir)
+		if err != nil {
+			return nil, errors.Trace(err, "NewBlockCache failed!")
+		}
+		s.ec.SetBlockCache(cache)
+	}
 
 	s.volname = opt.Volname
 	s.owner = opt.Owner
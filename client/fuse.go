@@ -219,6 +219,7 @@ func mount(opt *cfs.MountOption) (fsConn *fuse.Conn, super *cfs.Super, err error
 
 	options := []fuse.MountOption{
 		fuse.AllowOther(),
+		fuse.DontMask(),
 		fuse.MaxReadahead(MaxReadAhead),
 		fuse.AsyncRead(),
 		fuse.AutoInvalData(opt.AutoInvalData),
@@ -234,6 +235,10 @@ func mount(opt *cfs.MountOption) (fsConn *fuse.Conn, super *cfs.Super, err error
 		options = append(options, fuse.WritebackCache())
 	}
 
+	if opt.EnableFileLock {
+		options = append(options, fuse.LockingFlock(), fuse.LockingPOSIX())
+	}
+
 	fsConn, err = fuse.Mount(opt.MountPoint, options...)
 	return
 }
@@ -274,6 +279,21 @@ func parseMountOption(cfg *config.Config) (*cfs.MountOption, error) {
 	opt.Rdonly = cfg.GetBool(proto.Rdonly)
 	opt.WriteCache = cfg.GetBool(proto.WriteCache)
 	opt.KeepCache = cfg.GetBool(proto.KeepCache)
+	opt.AuthNodes = cfg.GetString(proto.AuthNodes)
+	opt.ClientID = cfg.GetString(proto.ClientID)
+	opt.ClientKey = cfg.GetString(proto.ClientKey)
+	opt.AuthCertFile = cfg.GetString(proto.AuthCertFile)
+	opt.Snapshot = cfg.GetString(proto.Snapshot)
+	opt.EnableFileLock = cfg.GetBool(proto.EnableFileLock)
+	opt.BlockCachePolicy = cfg.GetString(proto.BlockCachePolicy)
+	opt.BlockCacheSize = parseConfigString(cfg, proto.BlockCacheSize)
+	opt.BlockCacheDiskSize = parseConfigString(cfg, proto.BlockCacheDiskSize)
+	opt.BlockCacheDir = cfg.GetString(proto.BlockCacheDir)
+	if opt.Snapshot != "" {
+		// a snapshot is never modified, and its inodes are not the ones locked in the volume
+		opt.Rdonly = true
+		opt.EnableFileLock = false
+	}
 
 	if opt.MountPoint == "" || opt.Volname == "" || opt.Owner == "" || opt.Master == "" {
 		return nil, errors.New(fmt.Sprintf("invalid config file: lack of mandatory fields, mountPoint(%v), volName(%v), owner(%v), masterAddr(%v)", opt.MountPoint, opt.Volname, opt.Owner, opt.Master))
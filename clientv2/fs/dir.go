@@ -302,47 +302,49 @@ func (s *Super) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
 	handle.lock.Lock()
 	defer handle.lock.Unlock()
 
-	if pos == 0 || handle.entries == nil {
-		children, err := s.mw.ReadDir_ll(pino)
+	if handle.stream == nil {
+		handle.stream = s.mw.OpenDirStream(pino)
+	}
+	if pos == 0 {
+		pinode.dcache = NewDentryCache()
+	}
+
+	inodes := make([]uint64, 0)
+	for full := false; !full; {
+		children, err := handle.stream.ReadAt(uint64(pos))
 		if err != nil {
 			log.LogErrorf("%v: failed to readdir from metanode, err(%v)", desc, err)
+			if op.BytesRead > 0 {
+				break
+			}
 			return ParseError(err)
 		}
-		handle.entries = children
-		pinode.dcache = NewDentryCache()
-	}
-
-	if pos > len(handle.entries) {
-		log.LogErrorf("%v: offset beyond scope, pos(%v) num of entries(%v)", desc, pos, len(handle.entries))
-		err = errors.New("invalid entries")
-		return fuse.EINVAL
-	}
-
-	inodes := make([]uint64, 0, len(handle.entries))
-
-	for i := pos; i < len(handle.entries); i++ {
-		child := handle.entries[i]
-		dirent := fuseutil.Dirent{
-			Offset: fuseops.DirOffset(i) + 1,
-			Inode:  fuseops.InodeID(child.Inode),
-			Name:   child.Name,
-			Type:   ParseType(child.Type),
+		if len(children) == 0 {
+			break
 		}
+		for _, child := range children {
+			dirent := fuseutil.Dirent{
+				Offset: fuseops.DirOffset(pos) + 1,
+				Inode:  fuseops.InodeID(child.Inode),
+				Name:   child.Name,
+				Type:   ParseType(child.Type),
+			}
 
-		nbytes := fuseutil.WriteDirent(op.Dst[op.BytesRead:], dirent)
-		if nbytes == 0 {
-			break
+			nbytes := fuseutil.WriteDirent(op.Dst[op.BytesRead:], dirent)
+			if nbytes == 0 {
+				full = true
+				break
+			}
+			op.BytesRead += nbytes
+			pos++
+			inodes = append(inodes, child.Inode)
+			pinode.dcache.Put(child.Name, child.Inode)
 		}
-		op.BytesRead += nbytes
-		inodes = append(inodes, child.Inode)
-		pinode.dcache.Put(child.Name, child.Inode)
 	}
 
-	if pos == 0 {
-		infos := s.mw.BatchInodeGet(inodes)
-		for _, info := range infos {
-			s.ic.Put(NewInode(info))
-		}
+	infos := s.mw.BatchInodeGet(inodes)
+	for _, info := range infos {
+		s.ic.Put(NewInode(info))
 	}
 
 	log.LogDebugf("TRACE exit %v: handle(%v) BytesRead(%v)", desc, op.Handle, op.BytesRead)
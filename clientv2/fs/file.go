@@ -24,6 +24,7 @@ import (
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 
+	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 )
@@ -142,6 +143,10 @@ func (s *Super) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
 	defer metric.Set(err)
 
 	size, err := s.ec.Write(ino, offset, op.Data, enSyncWrite)
+	if err == syscall.EDQUOT {
+		log.LogWarnf("WriteFile: localIP(%v) op(%v) err(%v)", s.localIP, desc, err)
+		return ParseError(err)
+	}
 	if err != nil {
 		errmsg := fmt.Sprintf("WriteFile: Write failed, localIP(%v) op(%v) err(%v)", s.localIP, desc, err)
 		log.LogErrorf(errmsg)
@@ -229,19 +234,84 @@ func (s *Super) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) erro
 }
 
 func (s *Super) RemoveXattr(ctx context.Context, op *fuseops.RemoveXattrOp) error {
-	return fuse.ENOSYS
+	ino := uint64(op.Inode)
+	desc := fuse.OpDescription(op)
+
+	if isACLXAttr(op.Name) {
+		return syscall.EOPNOTSUPP
+	}
+	if err := s.mw.XAttrDelAsRoot_ll(ino, op.Name); err != nil {
+		log.LogErrorf("RemoveXattr: op(%v) err(%v)", desc, err)
+		return ParseError(err)
+	}
+	log.LogDebugf("TRACE RemoveXattr: op(%v)", desc)
+	return nil
 }
 
 func (s *Super) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
-	return fuse.ENOSYS
+	ino := uint64(op.Inode)
+	desc := fuse.OpDescription(op)
+
+	value, err := s.mw.XAttrGet_ll(ino, op.Name)
+	if err != nil {
+		log.LogDebugf("GetXattr: op(%v) err(%v)", desc, err)
+		return ParseError(err)
+	}
+	op.BytesRead = len(value)
+	if len(op.Dst) < len(value) {
+		// zero-sized Dst is a size query, not an error
+		if len(op.Dst) == 0 {
+			return nil
+		}
+		return syscall.ERANGE
+	}
+	copy(op.Dst, value)
+	log.LogDebugf("TRACE GetXattr: op(%v)", desc)
+	return nil
 }
 
 func (s *Super) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error {
-	return fuse.ENOSYS
+	ino := uint64(op.Inode)
+	desc := fuse.OpDescription(op)
+
+	names, err := s.mw.XAttrsList_ll(ino)
+	if err != nil {
+		log.LogErrorf("ListXattr: op(%v) err(%v)", desc, err)
+		return ParseError(err)
+	}
+	for _, name := range names {
+		size := len(name) + 1
+		if op.BytesRead+size <= len(op.Dst) {
+			copy(op.Dst[op.BytesRead:], name)
+			op.Dst[op.BytesRead+size-1] = 0
+		} else if len(op.Dst) != 0 {
+			return syscall.ERANGE
+		}
+		op.BytesRead += size
+	}
+	log.LogDebugf("TRACE ListXattr: op(%v) names(%v)", desc, names)
+	return nil
 }
 
 func (s *Super) SetXattr(ctx context.Context, op *fuseops.SetXattrOp) error {
-	return fuse.ENOSYS
+	ino := uint64(op.Inode)
+	desc := fuse.OpDescription(op)
+
+	if isACLXAttr(op.Name) {
+		return syscall.EOPNOTSUPP
+	}
+	if err := s.mw.XAttrSetAsRoot_ll(ino, op.Name, op.Value, op.Flags); err != nil {
+		log.LogErrorf("SetXattr: op(%v) err(%v)", desc, err)
+		return ParseError(err)
+	}
+	log.LogDebugf("TRACE SetXattr: op(%v)", desc)
+	return nil
+}
+
+// The ACLs are not supported, as the kernel checks the permissions by the mode bits only, and the owners of
+// the ACLs cannot be checked without the callers.
+func isACLXAttr(name string) bool {
+	return name == proto.XAttrACLAccess || name == proto.XAttrACLDefault
 }
 
 func (s *Super) fileSize(ino uint64) (size int, gen uint64) {
@@ -18,7 +18,7 @@ import (
 	"sync"
 	"sync/atomic"
 
-	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
 	"github.com/jacobsa/fuse/fuseops"
 )
 
@@ -33,8 +33,8 @@ type Handle struct {
 	ino uint64
 
 	// For directory handles only
-	lock    sync.Mutex
-	entries []proto.Dentry
+	lock   sync.Mutex
+	stream *meta.DirStream
 }
 
 func NewHandleCache() *HandleCache {
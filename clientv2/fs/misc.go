@@ -84,7 +84,7 @@ func (s *Super) SetInodeAttributes(ctx context.Context, op *fuseops.SetInodeAttr
 	}
 
 	if valid := setattr(op, inode); valid != 0 {
-		err = s.mw.Setattr(ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
+		err = s.mw.SetattrAsRoot(ino, valid, proto.Mode(inode.mode), inode.uid, inode.gid)
 		if err != nil {
 			s.ic.Delete(ino)
 			return ParseError(err)
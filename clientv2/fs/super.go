@@ -19,6 +19,7 @@ import (
 	"golang.org/x/net/context"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jacobsa/fuse/fuseops"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/chubaofs/chubaofs/sdk/data/stream"
 	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -50,6 +52,11 @@ type MountOption struct {
 	Rdonly        bool
 	WriteCache    bool
 	KeepCache     bool
+	AuthNodes     string
+	ClientID      string
+	ClientKey     string
+	AuthCertFile  string
+	Snapshot      string // name of the volume snapshot to mount read-only
 }
 
 type Super struct {
@@ -72,12 +79,25 @@ var (
 
 func NewSuper(opt *MountOption) (s *Super, err error) {
 	s = new(Super)
-	s.mw, err = meta.NewMetaWrapper(opt.Volname, opt.Owner, opt.Master)
+	var authenticator *auth.Authenticator
+	if opt.AuthNodes != "" {
+		authenticator, err = auth.NewAuthenticator(strings.Split(opt.AuthNodes, ","), opt.ClientID, opt.ClientKey, opt.AuthCertFile)
+		if err != nil {
+			return nil, errors.Trace(err, "NewAuthenticator failed!")
+		}
+	}
+
+	s.mw, err = meta.NewMetaWrapper(opt.Volname, opt.Owner, opt.Master, authenticator)
 	if err != nil {
 		return nil, errors.Trace(err, "NewMetaWrapper failed!")
 	}
+	if opt.Snapshot != "" {
+		if err = s.mw.MountSnapshot(opt.Snapshot); err != nil {
+			return nil, errors.Trace(err, "MountSnapshot failed!")
+		}
+	}
 
-	s.ec, err = stream.NewExtentClient(opt.Volname, opt.Master, opt.ReadRate, opt.WriteRate, s.mw.AppendExtentKey, s.mw.GetExtents, s.mw.Truncate)
+	s.ec, err = stream.NewExtentClient(opt.Volname, opt.Master, authenticator, opt.ReadRate, opt.WriteRate, s.mw.AppendExtentKey, s.mw.GetExtents, s.mw.Truncate, s.mw.OverwriteExtents, s.mw.CheckQuota)
 	if err != nil {
 		return nil, errors.Trace(err, "NewExtentClient failed!")
 	}
@@ -221,6 +221,9 @@ func mount(opt *cfs.MountOption) (*fuse.MountedFileSystem, error) {
 	// define extra options
 	mntcfg.Options = make(map[string]string)
 	mntcfg.Options["allow_other"] = ""
+	// the requests do not carry the callers, so the kernel checks the permissions by the mode bits, along with
+	// the ownership to change the attributes, and the metadata is changed as root
+	mntcfg.Options["default_permissions"] = ""
 
 	mfs, err := fuse.Mount(opt.MountPoint, server, mntcfg)
 	if err != nil {
@@ -266,6 +269,15 @@ func parseMountOption(cfg *config.Config) (*cfs.MountOption, error) {
 	opt.Rdonly = cfg.GetBool(proto.Rdonly)
 	opt.WriteCache = cfg.GetBool(proto.WriteCache)
 	opt.KeepCache = cfg.GetBool(proto.KeepCache)
+	opt.AuthNodes = cfg.GetString(proto.AuthNodes)
+	opt.ClientID = cfg.GetString(proto.ClientID)
+	opt.ClientKey = cfg.GetString(proto.ClientKey)
+	opt.AuthCertFile = cfg.GetString(proto.AuthCertFile)
+	opt.Snapshot = cfg.GetString(proto.Snapshot)
+	if opt.Snapshot != "" {
+		// a snapshot is never modified
+		opt.Rdonly = true
+	}
 
 	if opt.MountPoint == "" || opt.Volname == "" || opt.Owner == "" || opt.Master == "" {
 		return nil, errors.New(fmt.Sprintf("invalid config file: lack of mandatory fields, mountPoint(%v), volName(%v), owner(%v), masterAddr(%v)", opt.MountPoint, opt.Volname, opt.Owner, opt.Master))
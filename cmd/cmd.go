@@ -34,6 +34,8 @@ import (
 	"github.com/chubaofs/chubaofs/datanode"
 	"github.com/chubaofs/chubaofs/master"
 	"github.com/chubaofs/chubaofs/metanode"
+	"github.com/chubaofs/chubaofs/objectnode"
+	"github.com/chubaofs/chubaofs/replicator"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/log"
 	"github.com/chubaofs/chubaofs/util/ump"
@@ -54,17 +56,21 @@ const (
 )
 
 const (
-	RoleMaster = "master"
-	RoleMeta   = "metanode"
-	RoleData   = "datanode"
-	RoleAuth   = "authnode"
+	RoleMaster     = "master"
+	RoleMeta       = "metanode"
+	RoleData       = "datanode"
+	RoleAuth       = "authnode"
+	RoleObject     = "objectnode"
+	RoleReplicator = "replicator"
 )
 
 const (
-	ModuleMaster = "master"
-	ModuleMeta   = "metaNode"
-	ModuleData   = "dataNode"
-	ModuleAuth   = "authNode"
+	ModuleMaster     = "master"
+	ModuleMeta       = "metaNode"
+	ModuleData       = "dataNode"
+	ModuleAuth       = "authNode"
+	ModuleObject     = "objectNode"
+	ModuleReplicator = "replicator"
 )
 
 const (
@@ -173,6 +179,12 @@ func main() {
 	case RoleAuth:
 		server = authnode.NewServer()
 		module = ModuleAuth
+	case RoleObject:
+		server = objectnode.NewServer()
+		module = ModuleObject
+	case RoleReplicator:
+		server = replicator.NewServer()
+		module = ModuleReplicator
 	default:
 		daemonize.SignalOutcome(fmt.Errorf("Fatal: role mismatch: %v", role))
 		os.Exit(1)
@@ -34,6 +34,11 @@ const (
 	NetworkProtocol = "tcp"
 )
 
+// Client ID in the tickets issued by a data node to access the other data nodes
+const (
+	PeerClientID = "datanode"
+)
+
 // Status of load data partition extent header
 const (
 	FinishLoadDataPartitionExtentHeader = 1
@@ -63,6 +68,9 @@ const (
 	ActionAddDataPartitionRaftMember    = "ActionAddDataPartitionRaftMember"
 	ActionRemoveDataPartitionRaftMember = "ActionRemoveDataPartitionRaftMember"
 	ActionDataPartitionTryToLeader      = "ActionDataPartitionTryToLeader"
+	ActionEcConvertExtent               = "ActionEcConvertExtent"
+	ActionTierMigrateExtent             = "ActionTierMigrateExtent"
+	ActionEcReconstructDataPartition    = "ActionEcReconstructDataPartition"
 
 	ActionCreateDataPartition        = "ActionCreateDataPartition"
 	ActionLoadDataPartition          = "ActionLoadDataPartition"
@@ -73,6 +81,21 @@ const (
 )
 
 // Apply the raft log operation. Currently we only have the random write operation.
+const (
+	DefaultScrubInterval = 7 * 24 // hours between the scrubs of a data partition
+	DefaultScrubRate     = 20     // MB/s read by the scrubber on each disk
+	IntervalToScrub      = 10     // minutes between the checks of the data partitions to scrub
+	MaxScrubHistory      = 10     // number of the scrub records kept for each data partition
+)
+
+const (
+	TinyCompactColdTime = 60 // minutes since the last modification of a file before its data is relocated
+	MaxCompactHistory   = 10 // number of the compaction records kept for each data partition
+
+	compactBatchCount       = 128 // number of the files relocated in a request to a meta partition
+	compactMetaDeadlineTime = 60  // seconds to wait for the reply of a meta partition
+)
+
 const (
 	MinTinyExtentsToRepair = 10 // minimum number of tiny extents to repair
 )
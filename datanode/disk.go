@@ -53,6 +53,7 @@ type Disk struct {
 	MaxErrCnt     int // maximum number of errors
 	Status        int // disk status such as READONLY
 	ReservedSpace uint64
+	MediaType     string // media class of the disk, such as nvme or hdd
 
 	RejectWrite  bool
 	partitionMap map[uint64]*DataPartition
@@ -61,10 +62,11 @@ type Disk struct {
 
 type PartitionVisitor func(dp *DataPartition)
 
-func NewDisk(path string, reservedSpace uint64, maxErrCnt int, space *SpaceManager) (d *Disk) {
+func NewDisk(path string, reservedSpace uint64, mediaType string, maxErrCnt int, space *SpaceManager) (d *Disk) {
 	d = new(Disk)
 	d.Path = path
 	d.ReservedSpace = reservedSpace
+	d.MediaType = mediaType
 	d.MaxErrCnt = maxErrCnt
 	d.RejectWrite = false
 	d.space = space
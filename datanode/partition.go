@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chubaofs/chubaofs/master"
@@ -59,6 +60,9 @@ type DataPartitionMetadata struct {
 	Hosts                   []string
 	DataPartitionCreateType int
 	LastTruncateID          uint64
+	EcDataNum               uint8
+	EcParityNum             uint8
+	LastScrubTime           int64
 }
 
 type sortedPeers []proto.Peer
@@ -115,6 +119,15 @@ type DataPartition struct {
 	loadExtentHeaderStatus        int
 	FullSyncTinyDeleteTime        int64
 	DataPartitionCreateType       int
+
+	lastScrubTime int64 // the end of the last scrub
+	scrubHistory  []*ScrubRecord
+	scrubLock     sync.RWMutex
+
+	compacting      int32 // a tiny extent of the partition is being compacted
+	compactHistory  []*CompactRecord
+	tinyExtentMarks map[uint64]*tinyExtentMark
+	compactLock     sync.RWMutex
 }
 
 func CreateDataPartition(dpCfg *dataPartitionCfg, disk *Disk, request *proto.CreateDataPartitionRequest) (dp *DataPartition, err error) {
@@ -164,6 +177,8 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 		PartitionID:   meta.PartitionID,
 		Peers:         meta.Peers,
 		Hosts:         meta.Hosts,
+		EcDataNum:     meta.EcDataNum,
+		EcParityNum:   meta.EcParityNum,
 		RaftStore:     disk.space.GetRaftStore(),
 		NodeID:        disk.space.GetNodeID(),
 		ClusterID:     disk.space.GetClusterID(),
@@ -178,6 +193,7 @@ func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err
 	log.LogInfof("Action(LoadDataPartition) PartitionID(%v) meta(%v)", dp.partitionID, meta)
 	dp.DataPartitionCreateType = meta.DataPartitionCreateType
 	dp.lastTruncateID = meta.LastTruncateID
+	dp.lastScrubTime = meta.LastScrubTime
 	if meta.DataPartitionCreateType == proto.NormalCreateDataPartition {
 		err = dp.StartRaft()
 	} else {
@@ -211,6 +227,7 @@ func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk) (dp *DataPartition, e
 		snapshot:        make([]*proto.File, 0),
 		partitionStatus: proto.ReadWrite,
 		config:          dpCfg,
+		tinyExtentMarks: make(map[uint64]*tinyExtentMark),
 	}
 	partition.replicasInit()
 	partition.extentStore, err = storage.NewExtentStore(partition.path, dpCfg.PartitionID, dpCfg.PartitionSize)
@@ -335,6 +352,11 @@ func (dp *DataPartition) Disk() *Disk {
 	return dp.disk
 }
 
+// IsEc returns true if the partition is erasure-coded.
+func (dp *DataPartition) IsEc() bool {
+	return dp.config.EcDataNum > 0
+}
+
 func (dp *DataPartition) IsRejectWrite() bool {
 	return dp.Disk().RejectWrite
 }
@@ -391,6 +413,9 @@ func (dp *DataPartition) PersistMetadata() (err error) {
 		DataPartitionCreateType: dp.DataPartitionCreateType,
 		CreateTime:              time.Now().Format(TimeLayout),
 		LastTruncateID:          dp.lastTruncateID,
+		EcDataNum:               dp.config.EcDataNum,
+		EcParityNum:             dp.config.EcParityNum,
+		LastScrubTime:           atomic.LoadInt64(&dp.lastScrubTime),
 	}
 	if metaData, err = json.Marshal(md); err != nil {
 		return
@@ -414,6 +439,10 @@ func (dp *DataPartition) statusUpdateScheduler() {
 			if index >= math.MaxUint32 {
 				index = 0
 			}
+			// the shards of an erasure-coded partition differ from each other, and are reconstructed on the task of the master
+			if dp.IsEc() {
+				continue
+			}
 			if index%2 == 0 {
 				dp.LaunchRepair(proto.TinyExtentType)
 			} else {
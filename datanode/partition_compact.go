@@ -0,0 +1,595 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The tiny extents are shared by the small files, and never shrink as the deleted ranges are only punched out.
+// The first host of a data partition compacts a tiny extent on the admin request, with the keys referencing it
+// collected from all the meta partitions of the volume:
+//
+// 1. The data of each file not modified for the cold time is rewritten into a new normal extent of the file
+//    through the replication of the partition, and the meta partition replaces the keys of the file, each only
+//    if the file still has the same key at its file offset. The ranges of the replaced keys are then deleted
+//    from the tiny extent by the meta partition as usual. A normal extent is deleted as a whole with any key of
+//    it, so the data of different files is never rewritten into the same extent.
+// 2. The ranges below the watermark marked at least the cold time ago, which are referenced by no key, are
+//    punched out on all the replicas. They are left by the keys trimmed by overwrites, and by the deletes lost.
+//    The keys of the data written before the mark are expected to be committed within the cold time.
+//
+// The space allocated but not referenced by any key is reported as reclaimable, which may include the data
+// written recently whose keys are not committed yet.
+
+// TinyExtentUsage defines the usage of the space of a tiny extent.
+type TinyExtentUsage struct {
+	ExtentID    uint64 `json:"extentID"`
+	Size        int64  `json:"size"`      // logical size of the extent
+	Allocated   int64  `json:"allocated"` // space allocated on the disk
+	Live        int64  `json:"live"`      // space referenced by the keys, rounded up to pages
+	Reclaimable int64  `json:"reclaimable"`
+}
+
+// CompactRecord defines the progress and the result of a compaction of a tiny extent.
+type CompactRecord struct {
+	ExtentID       uint64   `json:"extentID"`
+	StartTime      int64    `json:"start"`
+	EndTime        int64    `json:"end"` // zero while the compaction is running
+	RelocatedFiles int      `json:"relocatedFiles"`
+	RelocatedKeys  int      `json:"relocatedKeys"`
+	RelocatedBytes uint64   `json:"relocatedBytes"`
+	SkippedFiles   int      `json:"skippedFiles"` // modified recently, or changed during the compaction
+	NewExtents     []uint64 `json:"newExtents"`
+	PunchedBytes   int64    `json:"punchedBytes"` // space freed by punching the unreferenced ranges
+	Msg            string   `json:"msg,omitempty"`
+}
+
+// the watermark of a tiny extent at the time it is marked
+type tinyExtentMark struct {
+	watermark int64
+	time      int64
+}
+
+// the keys referencing the tiny extents collected from a meta partition
+type metaExtentRefs struct {
+	partition *proto.MetaPartitionView
+	refs      []*proto.ExtentRef
+}
+
+// the keys of a file to be relocated
+type relocateFile struct {
+	inode      uint64
+	generation uint64
+	hot        bool // modified within the cold time
+	keys       []*proto.ExtentKey
+}
+
+// TinyExtentUsages returns the usages of the space of the tiny extents of the partition.
+func (dp *DataPartition) TinyExtentUsages() (usages []*TinyExtentUsage, err error) {
+	if !dp.isFirstHost() {
+		return nil, fmt.Errorf("partition(%v) local is not the first host(%v)", dp.partitionID, dp.getReplicaAddr(0))
+	}
+	// the marks are taken before the keys are collected, so that the keys of the data below them are all collected
+	for extentID := uint64(storage.TinyExtentStartID); extentID < storage.TinyExtentStartID+storage.TinyExtentCount; extentID++ {
+		if err = dp.markTinyExtent(extentID); err != nil {
+			return
+		}
+	}
+	metaRefs, err := dp.getExtentRefs(0)
+	if err != nil {
+		return
+	}
+	keys := make(map[uint64][]*proto.ExtentKey)
+	for _, m := range metaRefs {
+		for _, ref := range m.refs {
+			keys[ref.Key.ExtentId] = append(keys[ref.Key.ExtentId], &ref.Key)
+		}
+	}
+	store := dp.ExtentStore()
+	for extentID := uint64(storage.TinyExtentStartID); extentID < storage.TinyExtentStartID+storage.TinyExtentCount; extentID++ {
+		usage := &TinyExtentUsage{ExtentID: extentID}
+		if usage.Size, usage.Allocated, err = store.TinyExtentUsage(extentID); err != nil {
+			return
+		}
+		for _, r := range liveRanges(keys[extentID]) {
+			usage.Live += r[1] - r[0]
+		}
+		if usage.Allocated > usage.Live {
+			usage.Reclaimable = usage.Allocated - usage.Live
+		}
+		usages = append(usages, usage)
+	}
+	return
+}
+
+// CompactHistory returns the records of the recent compactions, of which the last one may be running.
+func (dp *DataPartition) CompactHistory() (records []*CompactRecord) {
+	dp.compactLock.RLock()
+	defer dp.compactLock.RUnlock()
+	records = make([]*CompactRecord, 0, len(dp.compactHistory))
+	for _, r := range dp.compactHistory {
+		record := *r
+		record.NewExtents = append([]uint64(nil), r.NewExtents...)
+		records = append(records, &record)
+	}
+	return
+}
+
+func (dp *DataPartition) updateCompactRecord(record *CompactRecord, update func(r *CompactRecord)) {
+	dp.compactLock.Lock()
+	defer dp.compactLock.Unlock()
+	update(record)
+}
+
+// StartCompactTinyExtent starts the compaction of the tiny extent, unless a compaction of the partition is running.
+func (dp *DataPartition) StartCompactTinyExtent(extentID uint64) (err error) {
+	if !storage.IsTinyExtent(extentID) {
+		return fmt.Errorf("extent(%v) is not a tiny extent", extentID)
+	}
+	if dp.IsEc() || !dp.isFirstHost() {
+		return fmt.Errorf("partition(%v) local is not the first host(%v)", dp.partitionID, dp.getReplicaAddr(0))
+	}
+	if !atomic.CompareAndSwapInt32(&dp.compacting, 0, 1) {
+		return fmt.Errorf("partition(%v) is compacting", dp.partitionID)
+	}
+	record := &CompactRecord{ExtentID: extentID, StartTime: time.Now().Unix()}
+	dp.compactLock.Lock()
+	dp.compactHistory = append(dp.compactHistory, record)
+	if len(dp.compactHistory) > MaxCompactHistory {
+		dp.compactHistory = dp.compactHistory[len(dp.compactHistory)-MaxCompactHistory:]
+	}
+	dp.compactLock.Unlock()
+	go func() {
+		defer atomic.StoreInt32(&dp.compacting, 0)
+		err := dp.compactTinyExtent(record)
+		dp.updateCompactRecord(record, func(r *CompactRecord) {
+			if err != nil {
+				r.Msg = err.Error()
+			}
+			r.EndTime = time.Now().Unix()
+		})
+		log.LogInfof("action[compactTinyExtent] partition(%v) finished, record(%+v)", dp.partitionID, record)
+	}()
+	return
+}
+
+func (dp *DataPartition) compactTinyExtent(record *CompactRecord) (err error) {
+	store := dp.ExtentStore()
+	extentID := record.ExtentID
+	_, allocated, err := store.TinyExtentUsage(extentID)
+	if err != nil {
+		return
+	}
+	// the mark is taken before the keys are collected, so that the keys of the data below it are all collected
+	punchLimit := dp.takeTinyExtentMark(extentID)
+	metaRefs, err := dp.getExtentRefs(extentID)
+	if err != nil {
+		return
+	}
+	var keys []*proto.ExtentKey
+	coldTime := time.Now().Add(-TinyCompactColdTime * time.Minute).Unix()
+	for _, m := range metaRefs {
+		files := make(map[uint64]*relocateFile)
+		var inodes []uint64
+		for _, ref := range m.refs {
+			keys = append(keys, &ref.Key)
+			if ref.Snapshot {
+				continue
+			}
+			f, ok := files[ref.Inode]
+			if !ok {
+				f = &relocateFile{inode: ref.Inode, generation: ref.Generation}
+				files[ref.Inode] = f
+				inodes = append(inodes, ref.Inode)
+			}
+			key := ref.Key
+			f.hot = f.hot || ref.ModifyTime > coldTime
+			f.keys = append(f.keys, &key)
+		}
+		for start := 0; start < len(inodes); start += compactBatchCount {
+			if dp.isStopped() {
+				return fmt.Errorf("partition stopped")
+			}
+			end := util.Min(start+compactBatchCount, len(inodes))
+			batch := make([]*relocateFile, 0, end-start)
+			for _, ino := range inodes[start:end] {
+				batch = append(batch, files[ino])
+			}
+			if err = dp.relocateFiles(m.partition, batch, record); err != nil {
+				return
+			}
+		}
+	}
+	if punchLimit > 0 {
+		if err = dp.punchUnreferenced(extentID, punchLimit, keys); err != nil {
+			return
+		}
+		_, left, e := store.TinyExtentUsage(extentID)
+		if e == nil && left < allocated {
+			dp.updateCompactRecord(record, func(r *CompactRecord) { r.PunchedBytes = allocated - left })
+		}
+	}
+	return
+}
+
+// Rewrite the data of the files into new extents, and replace the keys of the files in the meta partition.
+func (dp *DataPartition) relocateFiles(mp *proto.MetaPartitionView, files []*relocateFile, record *CompactRecord) (err error) {
+	req := &proto.RelocateExtentsRequest{VolName: dp.volumeID, PartitionID: mp.PartitionID}
+	newExtents := make([]uint64, 0, len(files))
+	owners := make([]int, 0) // index of the new extent of each relocation
+	skipped := 0
+	for _, f := range files {
+		if f.hot {
+			skipped++
+			continue
+		}
+		var (
+			newExtentID uint64
+			relocations []*proto.ExtentRelocation
+		)
+		if newExtentID, relocations, err = dp.rewriteFile(f); err != nil {
+			dp.deleteNewExtents(newExtents)
+			err = errors.Trace(err, "relocateFiles ino(%v)", f.inode)
+			return
+		}
+		for _, r := range relocations {
+			req.Relocations = append(req.Relocations, r)
+			owners = append(owners, len(newExtents))
+		}
+		newExtents = append(newExtents, newExtentID)
+	}
+	if len(req.Relocations) == 0 {
+		dp.updateCompactRecord(record, func(r *CompactRecord) { r.SkippedFiles += skipped })
+		return
+	}
+	resp := &proto.RelocateExtentsResponse{}
+	if err = requestMetaPartition(mp, proto.OpMetaRelocateExtents, req, resp); err != nil {
+		// the keys may be replaced or not, so the new extents are left to be deleted with the files
+		return
+	}
+	if len(resp.Replaced) != len(req.Relocations) {
+		return fmt.Errorf("meta partition(%v) replied %v results for %v relocations",
+			mp.PartitionID, len(resp.Replaced), len(req.Relocations))
+	}
+	used := make([]bool, len(newExtents))
+	var (
+		keys  int
+		bytes uint64
+	)
+	for i, replaced := range resp.Replaced {
+		if replaced {
+			used[owners[i]] = true
+			keys++
+			bytes += uint64(req.Relocations[i].New.Size)
+		}
+	}
+	var relocated, unused []uint64
+	for i, extentID := range newExtents {
+		if used[i] {
+			relocated = append(relocated, extentID)
+		} else {
+			// none of the keys of the file is replaced, as it is changed during the compaction
+			unused = append(unused, extentID)
+		}
+	}
+	dp.deleteNewExtents(unused)
+	skipped += len(unused)
+	dp.updateCompactRecord(record, func(r *CompactRecord) {
+		r.RelocatedFiles += len(relocated)
+		r.RelocatedKeys += keys
+		r.RelocatedBytes += bytes
+		r.SkippedFiles += skipped
+		r.NewExtents = append(r.NewExtents, relocated...)
+	})
+	return
+}
+
+// Rewrite the data of the keys of the file into a new extent.
+func (dp *DataPartition) rewriteFile(f *relocateFile) (extentID uint64, relocations []*proto.ExtentRelocation, err error) {
+	sort.Slice(f.keys, func(i, j int) bool { return f.keys[i].ExtentOffset < f.keys[j].ExtentOffset })
+	var total uint64
+	for _, k := range f.keys {
+		total += uint64(k.Size)
+	}
+	if total > util.ExtentSize {
+		err = fmt.Errorf("keys of size(%v) exceed the extent size", total)
+		return
+	}
+	data := make([]byte, total)
+	offset := uint64(0)
+	for _, k := range f.keys {
+		if _, err = dp.ExtentStore().Read(k.ExtentId, int64(k.ExtentOffset), int64(k.Size), data[offset:offset+uint64(k.Size)], false); err != nil {
+			return
+		}
+		newKey := *k
+		newKey.ExtentOffset = offset
+		newKey.CRC = 0
+		relocations = append(relocations, &proto.ExtentRelocation{Inode: f.inode, Generation: f.generation, Old: *k, New: newKey})
+		offset += uint64(k.Size)
+	}
+
+	if extentID, err = dp.createOnFirstHost(f.inode); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			dp.deleteNewExtents([]uint64{extentID})
+		}
+	}()
+	for _, r := range relocations {
+		r.New.ExtentId = extentID
+	}
+	for off := 0; off < len(data); off += util.BlockSize {
+		if err = dp.writeToFirstHost(extentID, int64(off), data[off:util.Min(off+util.BlockSize, len(data))]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Delete the new extents referenced by no key.
+func (dp *DataPartition) deleteNewExtents(extents []uint64) {
+	for _, extentID := range extents {
+		if _, err := dp.sendToFirstHost(dp.newReplicatedPacket(proto.OpMarkDelete, extentID)); err != nil {
+			log.LogWarnf("action[deleteNewExtents] partition(%v) extent(%v) err(%v)", dp.partitionID, extentID, err)
+		}
+	}
+}
+
+// Punch out the ranges of the tiny extent below the limit which are referenced by none of the keys.
+func (dp *DataPartition) punchUnreferenced(extentID uint64, limit int64, keys []*proto.ExtentKey) (err error) {
+	offset := int64(0)
+	punch := func(end int64) error {
+		for ; offset < end; offset += util.ExtentSize {
+			size := util.Min(util.ExtentSize, int(end-offset))
+			p := dp.newReplicatedPacket(proto.OpMarkDelete, extentID)
+			p.ExtentType = proto.TinyExtentType
+			p.Data, _ = json.Marshal(&proto.TinyExtentDeleteRecord{
+				PartitionId:  dp.partitionID,
+				ExtentId:     extentID,
+				ExtentOffset: uint64(offset),
+				Size:         uint32(size),
+			})
+			p.Size = uint32(len(p.Data))
+			if _, err := dp.sendToFirstHost(p); err != nil {
+				return errors.Trace(err, "punchUnreferenced extent(%v) offset(%v) size(%v)", extentID, offset, size)
+			}
+		}
+		return nil
+	}
+	for _, r := range liveRanges(keys) {
+		if r[0] >= limit {
+			break
+		}
+		if err = punch(r[0]); err != nil {
+			return
+		}
+		offset = r[1]
+	}
+	return punch(limit)
+}
+
+// Returns the ranges of the tiny extent referenced by the keys, which are rounded up to pages and merged.
+func liveRanges(keys []*proto.ExtentKey) (ranges [][2]int64) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ExtentOffset < keys[j].ExtentOffset })
+	for _, k := range keys {
+		start := int64(k.ExtentOffset)
+		end := start + int64(k.Size)
+		if end%storage.PageSize != 0 {
+			end += storage.PageSize - end%storage.PageSize
+		}
+		if n := len(ranges); n > 0 && start <= ranges[n-1][1] {
+			if end > ranges[n-1][1] {
+				ranges[n-1][1] = end
+			}
+			continue
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return
+}
+
+// Mark the watermark of the tiny extent if not marked.
+func (dp *DataPartition) markTinyExtent(extentID uint64) (err error) {
+	watermark, err := dp.ExtentStore().GetTinyExtentOffset(extentID)
+	if err != nil {
+		return
+	}
+	dp.compactLock.Lock()
+	defer dp.compactLock.Unlock()
+	if _, ok := dp.tinyExtentMarks[extentID]; !ok {
+		dp.tinyExtentMarks[extentID] = &tinyExtentMark{watermark: watermark, time: time.Now().Unix()}
+	}
+	return
+}
+
+// Returns the watermark of the tiny extent marked at least the cold time ago, and marks the current one instead.
+// Zero is returned if the extent is not marked long enough.
+func (dp *DataPartition) takeTinyExtentMark(extentID uint64) (limit int64) {
+	watermark, err := dp.ExtentStore().GetTinyExtentOffset(extentID)
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	dp.compactLock.Lock()
+	defer dp.compactLock.Unlock()
+	mark, ok := dp.tinyExtentMarks[extentID]
+	if ok && now-mark.time < TinyCompactColdTime*60 {
+		return
+	}
+	if ok {
+		limit = mark.watermark
+	}
+	dp.tinyExtentMarks[extentID] = &tinyExtentMark{watermark: watermark, time: now}
+	return
+}
+
+func (dp *DataPartition) isFirstHost() bool {
+	if dp.getReplicaLen() == 0 {
+		return false
+	}
+	return strings.TrimSpace(strings.Split(dp.getReplicaAddr(0), ":")[0]) == LocalIP
+}
+
+// Create a new normal extent of the file on all the hosts.
+func (dp *DataPartition) createOnFirstHost(inode uint64) (extentID uint64, err error) {
+	p := dp.newReplicatedPacket(proto.OpCreateExtent, 0)
+	p.Data = make([]byte, 8)
+	binary.BigEndian.PutUint64(p.Data, inode)
+	p.Size = uint32(len(p.Data))
+	reply, err := dp.sendToFirstHost(p)
+	if err != nil {
+		return
+	}
+	return reply.ExtentID, nil
+}
+
+// Write the data at the offset of the normal extent, which is no larger than a block.
+func (dp *DataPartition) writeToFirstHost(extentID uint64, offset int64, data []byte) (err error) {
+	p := dp.newReplicatedPacket(proto.OpWrite, extentID)
+	p.ExtentOffset = offset
+	p.Data = data
+	p.Size = uint32(len(data))
+	p.CRC = crc32.ChecksumIEEE(data)
+	if _, err = dp.sendToFirstHost(p); err != nil {
+		err = errors.Trace(err, "writeToFirstHost extent(%v_%v) offset(%v)", dp.partitionID, extentID, offset)
+	}
+	return
+}
+
+// Returns a packet to the first host, which is replicated to the other hosts as the packets of the clients.
+func (dp *DataPartition) newReplicatedPacket(opcode uint8, extentID uint64) (p *repl.Packet) {
+	replicas := dp.Replicas()
+	p = repl.NewPacket()
+	p.Opcode = opcode
+	p.ExtentType = proto.NormalExtentType
+	p.PartitionID = dp.partitionID
+	p.ExtentID = extentID
+	p.Arg = []byte(strings.Join(replicas[1:], proto.AddrSplit) + proto.AddrSplit)
+	p.ArgLen = uint32(len(p.Arg))
+	p.RemainingFollowers = uint8(len(replicas) - 1)
+	p.ReqID = proto.GenerateRequestID()
+	return
+}
+
+func (dp *DataPartition) sendToFirstHost(p *repl.Packet) (reply *repl.Packet, err error) {
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(dp.getReplicaAddr(0)); err != nil {
+		return
+	}
+	defer func() {
+		gConnPool.PutConnect(conn, err != nil)
+	}()
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	reply = repl.NewPacket()
+	if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		err = fmt.Errorf("request(%v) reply(%v) err(%v)", p.GetUniqueLogId(), reply.GetUniqueLogId(), string(reply.Data[:reply.Size]))
+	}
+	return
+}
+
+// Collect the keys referencing the tiny extent, or all the tiny extents if zero, from the meta partitions.
+func (dp *DataPartition) getExtentRefs(extentID uint64) (metaRefs []*metaExtentRefs, err error) {
+	data, err := MasterHelper.Request(http.MethodGet, proto.ClientMetaPartitions, map[string]string{"name": dp.volumeID}, nil)
+	if err != nil {
+		return
+	}
+	var partitions []*proto.MetaPartitionView
+	if err = json.Unmarshal(data, &partitions); err != nil {
+		return
+	}
+	for _, mp := range partitions {
+		req := &proto.GetExtentRefsRequest{
+			VolName:         dp.volumeID,
+			PartitionID:     mp.PartitionID,
+			DataPartitionID: dp.partitionID,
+			ExtentID:        extentID,
+		}
+		resp := &proto.GetExtentRefsResponse{}
+		if err = requestMetaPartition(mp, proto.OpMetaGetExtentRefs, req, resp); err != nil {
+			return
+		}
+		metaRefs = append(metaRefs, &metaExtentRefs{partition: mp, refs: resp.Refs})
+	}
+	return
+}
+
+// Send the request to the leader of the meta partition, or to the other members which proxy it to the leader.
+func requestMetaPartition(mp *proto.MetaPartitionView, opcode uint8, req, resp interface{}) (err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	addrs := mp.Members
+	if mp.LeaderAddr != "" {
+		addrs = append([]string{mp.LeaderAddr}, mp.Members...)
+	}
+	for _, addr := range addrs {
+		if err = sendToMetaNode(addr, opcode, data, resp); err == nil {
+			return
+		}
+		log.LogWarnf("action[requestMetaPartition] partition(%v) addr(%v) err(%v)", mp.PartitionID, addr, err)
+	}
+	if err == nil {
+		err = fmt.Errorf("meta partition(%v) has no members", mp.PartitionID)
+	}
+	return
+}
+
+func sendToMetaNode(addr string, opcode uint8, data []byte, resp interface{}) (err error) {
+	var conn *net.TCPConn
+	if conn, err = gMetaConnPool.GetConnect(addr); err != nil {
+		return
+	}
+	defer func() {
+		gMetaConnPool.PutConnect(conn, err != nil)
+	}()
+	p := proto.NewPacketReqID()
+	p.Opcode = opcode
+	p.Data = data
+	p.Size = uint32(len(data))
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, compactMetaDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		return fmt.Errorf("%v err(%v)", p.GetOpMsg(), string(p.Data[:p.Size]))
+	}
+	return json.Unmarshal(p.Data[:p.Size], resp)
+}
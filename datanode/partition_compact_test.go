@@ -0,0 +1,32 @@
+package datanode
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// The ranges referenced by the keys are kept from punching, rounded up to pages and merged.
+func TestLiveRanges(t *testing.T) {
+	page := uint64(storage.PageSize)
+	keys := []*proto.ExtentKey{
+		{ExtentOffset: 3 * page, Size: 10},
+		{ExtentOffset: 0, Size: uint32(page)},
+		{ExtentOffset: page, Size: 1},
+		{ExtentOffset: 3*page + 10, Size: uint32(page)},
+		{ExtentOffset: 8 * page, Size: uint32(page)},
+	}
+	expect := [][2]int64{
+		{0, int64(2 * page)},
+		{int64(3 * page), int64(5 * page)},
+		{int64(8 * page), int64(9 * page)},
+	}
+	if ranges := liveRanges(keys); !reflect.DeepEqual(ranges, expect) {
+		t.Fatalf("expect %v, got %v", expect, ranges)
+	}
+	if ranges := liveRanges(nil); len(ranges) != 0 {
+		t.Fatalf("expect no range without keys, got %v", ranges)
+	}
+}
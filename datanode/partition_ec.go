@@ -0,0 +1,371 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/ec"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// An erasure-coded data partition keeps the shards of the extents converted from the replicated
+// data partitions, which are sealed and never written again. The extent of the same ID on the i-th
+// host of the partition keeps the i-th unit of each stripe of the extent, so the extents on all the
+// hosts are of the same size, and are never repaired by comparing with each other as the replicas are.
+
+const (
+	// the deadline to read the units of the stripes from the other hosts
+	ecReadDeadlineTime = 60
+)
+
+// Handle OpEcConvertExtent packet.
+func (s *DataNode) handlePacketToEcConvertExtent(p *repl.Packet) {
+	var (
+		err      error
+		extentID uint64
+		data     []byte
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionEcConvertExtent, err.Error())
+		}
+	}()
+	partition := p.Object.(*DataPartition)
+	if !partition.IsEc() {
+		err = fmt.Errorf("partition(%v) is not erasure-coded", partition.partitionID)
+		return
+	}
+	req := &proto.EcConvertExtentRequest{}
+	if err = json.Unmarshal(p.Data[:p.Size], req); err != nil {
+		return
+	}
+	if extentID, err = partition.ecConvertExtent(req, s.localServerAddr); err != nil {
+		return
+	}
+	if data, err = json.Marshal(&proto.EcConvertExtentResponse{ExtentID: extentID}); err != nil {
+		return
+	}
+	p.PacketOkWithBody(data)
+}
+
+// Handle OpEcReconstructDataPartition packet.
+func (s *DataNode) handlePacketToEcReconstructDataPartition(p *repl.Packet) {
+	task := &proto.AdminTask{}
+	if err := json.Unmarshal(p.Data, task); err != nil {
+		p.PackErrorBody(ActionEcReconstructDataPartition, err.Error())
+		return
+	}
+	p.PacketOkReply()
+	go s.asyncEcReconstructDataPartition(task)
+}
+
+func (s *DataNode) asyncEcReconstructDataPartition(task *proto.AdminTask) {
+	var err error
+	request := &proto.EcReconstructRequest{}
+	response := &proto.EcReconstructResponse{}
+	bytes, _ := json.Marshal(task.Request)
+	json.Unmarshal(bytes, request)
+	response.PartitionID = request.PartitionID
+	dp := s.space.Partition(request.PartitionID)
+	if dp == nil {
+		err = fmt.Errorf("DataPartition(%v) not found", request.PartitionID)
+	} else if !dp.IsEc() {
+		err = fmt.Errorf("DataPartition(%v) is not erasure-coded", request.PartitionID)
+	} else {
+		err = dp.ecReconstruct(request.Hosts, s.localServerAddr)
+	}
+	if err != nil {
+		response.Status = proto.TaskFailed
+		response.Result = err.Error()
+		log.LogErrorf("action[asyncEcReconstructDataPartition] partition(%v) err(%v)", request.PartitionID, err)
+	} else {
+		response.Status = proto.TaskSucceeds
+	}
+	task.Response = response
+	data, err := json.Marshal(task)
+	if err != nil {
+		log.LogErrorf("action[asyncEcReconstructDataPartition] partition(%v) err(%v)", request.PartitionID, err)
+		return
+	}
+	if _, err = MasterHelper.Request("POST", proto.GetDataNodeTaskResponse, nil, data); err != nil {
+		err = errors.Trace(err, "reconstruct DataPartition failed,PartitionID(%v)", request.PartitionID)
+		log.LogError(errors.Stack(err))
+	}
+}
+
+func (dp *DataPartition) newEcEncoder(hosts []string) (encoder *ec.Encoder, err error) {
+	dataNum, parityNum := int(dp.config.EcDataNum), int(dp.config.EcParityNum)
+	if len(hosts) != dataNum+parityNum {
+		return nil, fmt.Errorf("partition(%v) hosts(%v) mismatch data(%v) parity(%v)",
+			dp.partitionID, hosts, dataNum, parityNum)
+	}
+	return ec.NewEncoder(dataNum, parityNum)
+}
+
+// Copy the extent of the replicated partition into a new extent of this partition, and write its
+// shards to the hosts stripe by stripe.
+func (dp *DataPartition) ecConvertExtent(req *proto.EcConvertExtentRequest, localAddr string) (extentID uint64, err error) {
+	encoder, err := dp.newEcEncoder(req.Hosts)
+	if err != nil {
+		return
+	}
+	if req.Size == 0 || req.Size > util.ExtentSize || len(req.SrcHosts) == 0 {
+		err = fmt.Errorf("illegal extent(%v_%v) size(%v) hosts(%v)", req.SrcPartitionID, req.SrcExtentID, req.Size, req.SrcHosts)
+		return
+	}
+	store := dp.ExtentStore()
+	if extentID, err = store.NextExtentID(); err != nil {
+		return
+	}
+	for _, host := range req.Hosts {
+		if host == localAddr {
+			err = store.Create(extentID)
+		} else {
+			err = sendToRemote(host, newEcCreateExtentPacket(dp.partitionID, extentID))
+		}
+		if err != nil {
+			err = errors.Trace(err, "ecConvertExtent create extent(%v_%v) on host(%v)", dp.partitionID, extentID, host)
+			return
+		}
+	}
+
+	dataNum := encoder.DataNum()
+	stripeSize := ec.StripeSize(dataNum)
+	stripe := make([]byte, stripeSize)
+	for offset := uint64(0); offset < req.Size; offset += stripeSize {
+		size := util.Min(int(stripeSize), int(req.Size-offset))
+		for i := size; i < len(stripe); i++ {
+			stripe[i] = 0
+		}
+		if err = readFromHosts(req.SrcPartitionID, req.SrcHosts, req.SrcExtentID, int(offset), stripe[:size]); err != nil {
+			return
+		}
+		shards := make([][]byte, len(req.Hosts))
+		for i := 0; i < dataNum; i++ {
+			shards[i] = stripe[uint64(i)*ec.StripeUnitSize : uint64(i+1)*ec.StripeUnitSize]
+		}
+		if err = encoder.Encode(shards); err != nil {
+			return
+		}
+		shardOffset := int64(offset / uint64(dataNum))
+		for i, host := range req.Hosts {
+			if host == localAddr {
+				err = store.Write(extentID, shardOffset, int64(len(shards[i])), shards[i],
+					crc32.ChecksumIEEE(shards[i]), storage.AppendWriteType, BufferWrite)
+			} else {
+				err = sendToRemote(host, newEcWritePacket(dp.partitionID, extentID, shardOffset, shards[i]))
+			}
+			if err != nil {
+				err = errors.Trace(err, "ecConvertExtent write extent(%v_%v) offset(%v) on host(%v)",
+					dp.partitionID, extentID, shardOffset, host)
+				return
+			}
+		}
+	}
+	log.LogInfof("action[ecConvertExtent] extent(%v_%v) size(%v) converted to extent(%v_%v)",
+		req.SrcPartitionID, req.SrcExtentID, req.Size, dp.partitionID, extentID)
+	return
+}
+
+// Reconstruct the local shards of all the extents from the shards on the other hosts.
+func (dp *DataPartition) ecReconstruct(hosts []string, localAddr string) (err error) {
+	encoder, err := dp.newEcEncoder(hosts)
+	if err != nil {
+		return
+	}
+	index := -1
+	for i, host := range hosts {
+		if host == localAddr {
+			index = i
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("partition(%v) local host(%v) not in hosts(%v)", dp.partitionID, localAddr, hosts)
+	}
+	var extents []*storage.ExtentInfo
+	for _, host := range hosts {
+		if host == localAddr {
+			continue
+		}
+		if extents, err = dp.getRemoteExtentInfo(proto.NormalExtentType, nil, host); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+	store := dp.ExtentStore()
+	for _, remote := range extents {
+		if storage.IsTinyExtent(remote.FileID) {
+			continue
+		}
+		if !store.HasExtent(remote.FileID) {
+			if err = store.Create(remote.FileID); err != nil {
+				return
+			}
+		}
+		var local *storage.ExtentInfo
+		if local, err = store.Watermark(remote.FileID); err != nil {
+			return
+		}
+		for offset := local.Size - local.Size%ec.StripeUnitSize; offset < remote.Size; offset += ec.StripeUnitSize {
+			var shard []byte
+			if shard, err = dp.ecReconstructUnit(encoder, hosts, index, remote.FileID, offset); err != nil {
+				return
+			}
+			if err = ecWriteUnit(store, remote.FileID, offset, local.Size, shard); err != nil {
+				return
+			}
+		}
+	}
+	log.LogInfof("action[ecReconstruct] partition(%v) shard(%v) reconstructed %v extents", dp.partitionID, index, len(extents))
+	return
+}
+
+// Write the unit of the shard at the offset of the extent of the size. The part of the unit below the size,
+// written by the reconstruction interrupted, is overwritten in place, and the rest is appended.
+func ecWriteUnit(store *storage.ExtentStore, extentID, offset, size uint64, shard []byte) (err error) {
+	if offset < size {
+		n := util.Min(int(size-offset), len(shard))
+		if err = store.Write(extentID, int64(offset), int64(n), shard[:n], crc32.ChecksumIEEE(shard[:n]),
+			storage.RandomWriteType, BufferWrite); err != nil {
+			return
+		}
+		if shard, offset = shard[n:], offset+uint64(n); len(shard) == 0 {
+			return
+		}
+	}
+	return store.Write(extentID, int64(offset), int64(len(shard)), shard, crc32.ChecksumIEEE(shard),
+		storage.AppendWriteType, BufferWrite)
+}
+
+// Reconstruct the unit of a stripe at the offset of the shard from any dataNum units of the other hosts.
+func (dp *DataPartition) ecReconstructUnit(encoder *ec.Encoder, hosts []string, index int, extentID, offset uint64) (shard []byte, err error) {
+	shards := make([][]byte, len(hosts))
+	present := 0
+	for i, host := range hosts {
+		if i == index || present == encoder.DataNum() {
+			continue
+		}
+		unit := make([]byte, ec.StripeUnitSize)
+		if e := readRemoteExtent(dp.partitionID, host, extentID, int(offset), unit); e != nil {
+			log.LogWarnf("action[ecReconstructUnit] extent(%v_%v) offset(%v) err(%v)", dp.partitionID, extentID, offset, e)
+			continue
+		}
+		shards[i] = unit
+		present++
+	}
+	if err = encoder.Reconstruct(shards); err != nil {
+		err = errors.Trace(err, "ecReconstructUnit extent(%v_%v) offset(%v)", dp.partitionID, extentID, offset)
+		return
+	}
+	return shards[index], nil
+}
+
+// Read the range of the extent from any of the hosts.
+func readFromHosts(partitionID uint64, hosts []string, extentID uint64, offset int, data []byte) (err error) {
+	for _, host := range hosts {
+		if err = readRemoteExtent(partitionID, host, extentID, offset, data); err == nil {
+			return
+		}
+		log.LogWarnf("action[readFromHosts] extent(%v_%v) offset(%v) host(%v) err(%v)", partitionID, extentID, offset, host, err)
+	}
+	return
+}
+
+// Read the range of the extent from the host.
+func readRemoteExtent(partitionID uint64, host string, extentID uint64, offset int, data []byte) (err error) {
+	request := repl.NewExtentRepairReadPacket(partitionID, extentID, offset, len(data))
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(host); err != nil {
+		return errors.Trace(err, "readRemoteExtent get conn from host(%v) error", host)
+	}
+	defer gConnPool.PutConnect(conn, true)
+	if err = request.WriteToConn(conn); err != nil {
+		return errors.Trace(err, "readRemoteExtent send request to host(%v) error", host)
+	}
+	for read := 0; read < len(data); {
+		reply := repl.NewPacket()
+		if err = reply.ReadFromConn(conn, ecReadDeadlineTime); err != nil {
+			return errors.Trace(err, "readRemoteExtent receive data from host(%v) error", host)
+		}
+		if reply.ResultCode != proto.OpOk {
+			return fmt.Errorf("readRemoteExtent host(%v) request(%v) err(%v)", host, request.GetUniqueLogId(), string(reply.Data[:reply.Size]))
+		}
+		if reply.ReqID != request.ReqID || reply.Size == 0 || reply.ExtentOffset != int64(offset+read) {
+			return fmt.Errorf("readRemoteExtent host(%v) request(%v) unavalid reply(%v)", host, request.GetUniqueLogId(), reply.GetUniqueLogId())
+		}
+		if reply.CRC != crc32.ChecksumIEEE(reply.Data[:reply.Size]) {
+			return fmt.Errorf("readRemoteExtent host(%v) request(%v) crc mismatch", host, request.GetUniqueLogId())
+		}
+		read += copy(data[read:], reply.Data[:reply.Size])
+	}
+	return
+}
+
+func newEcCreateExtentPacket(partitionID, extentID uint64) (p *repl.Packet) {
+	p = repl.NewPacket()
+	p.Opcode = proto.OpCreateExtent
+	p.ExtentType = proto.NormalExtentType
+	p.PartitionID = partitionID
+	p.ExtentID = extentID
+	p.ReqID = proto.GenerateRequestID()
+	return
+}
+
+func newEcWritePacket(partitionID, extentID uint64, offset int64, data []byte) (p *repl.Packet) {
+	p = repl.NewPacket()
+	p.Opcode = proto.OpWrite
+	p.ExtentType = proto.NormalExtentType
+	p.PartitionID = partitionID
+	p.ExtentID = extentID
+	p.ExtentOffset = offset
+	p.Data = data
+	p.Size = uint32(len(data))
+	p.CRC = crc32.ChecksumIEEE(data)
+	p.ReqID = proto.GenerateRequestID()
+	return
+}
+
+// Send the packet to the host only, without the followers.
+func sendToRemote(host string, p *repl.Packet) (err error) {
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(host); err != nil {
+		return
+	}
+	defer func() {
+		gConnPool.PutConnect(conn, err != nil)
+	}()
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	reply := repl.NewPacket()
+	if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		err = fmt.Errorf("request(%v) reply(%v) err(%v)", p.GetUniqueLogId(), reply.GetUniqueLogId(), string(reply.Data[:reply.Size]))
+	}
+	return
+}
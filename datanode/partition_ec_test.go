@@ -0,0 +1,190 @@
+package datanode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/ec"
+)
+
+// Returns the partition of a host serving the reads of the extents, as the datanodes do.
+func newTestEcHost(t *testing.T, dataNum, parityNum uint8) (dp *DataPartition, addr string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "partition_ec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewExtentStore(dir, 1, util.GB)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		store.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	dp = &DataPartition{
+		partitionID: 1,
+		extentStore: store,
+		config:      &dataPartitionCfg{PartitionID: 1, EcDataNum: dataNum, EcParityNum: parityNum},
+	}
+	s := &DataNode{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn *net.TCPConn) {
+				defer conn.Close()
+				for {
+					p := repl.NewPacket()
+					if err := p.ReadFromConn(conn, proto.NoReadDeadlineTime); err != nil {
+						return
+					}
+					p.Object = dp
+					s.OperatePacket(p, conn)
+					if !p.IsReadOperation() {
+						p.WriteToConn(conn)
+					}
+				}
+			}(conn.(*net.TCPConn))
+		}
+	}()
+	return dp, ln.Addr().String(), func() {
+		ln.Close()
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Writes the shards of the data to the extents of the hosts, except the units of the host skipped.
+func writeTestEcExtent(t *testing.T, dps []*DataPartition, extentID uint64, data []byte, skip int) (shards [][][]byte) {
+	encoder, err := ec.NewEncoder(int(dps[0].config.EcDataNum), int(dps[0].config.EcParityNum))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, dp := range dps {
+		if i == skip {
+			continue
+		}
+		if err = dp.ExtentStore().Create(extentID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stripeSize := int(ec.StripeSize(encoder.DataNum()))
+	for offset := 0; offset < len(data); offset += stripeSize {
+		stripe := make([][]byte, len(dps))
+		for i := 0; i < encoder.DataNum(); i++ {
+			stripe[i] = data[offset+i*ec.StripeUnitSize : offset+(i+1)*ec.StripeUnitSize]
+		}
+		if err = encoder.Encode(stripe); err != nil {
+			t.Fatal(err)
+		}
+		shardOffset := uint64(offset / encoder.DataNum())
+		for i, dp := range dps {
+			if i == skip {
+				continue
+			}
+			if err = ecWriteUnit(dp.ExtentStore(), extentID, shardOffset, shardOffset, stripe[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		shards = append(shards, stripe)
+	}
+	// the extents modified lately are not listed to be repaired
+	for i, dp := range dps {
+		if i == skip {
+			continue
+		}
+		info, err := dp.ExtentStore().Watermark(extentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info.ModifyTime -= 2 * storage.RepairInterval
+	}
+	return
+}
+
+func checkTestEcShard(t *testing.T, dp *DataPartition, extentID uint64, index int, shards [][][]byte) {
+	t.Helper()
+	store := dp.ExtentStore()
+	info, err := store.Watermark(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != uint64(len(shards)*ec.StripeUnitSize) {
+		t.Fatalf("extent %v: expect size %v, got %v", extentID, len(shards)*ec.StripeUnitSize, info.Size)
+	}
+	unit := make([]byte, ec.StripeUnitSize)
+	for i, stripe := range shards {
+		if _, err = store.Read(extentID, int64(i*ec.StripeUnitSize), int64(len(unit)), unit, false); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unit, stripe[index]) {
+			t.Fatalf("extent %v: expect the unit %v of the stripe %v reconstructed", extentID, index, i)
+		}
+	}
+}
+
+func TestEcReconstruct(t *testing.T) {
+	var (
+		dps   []*DataPartition
+		hosts []string
+	)
+	for i := 0; i < 3; i++ {
+		dp, addr, cleanup := newTestEcHost(t, 2, 1)
+		defer cleanup()
+		dps = append(dps, dp)
+		hosts = append(hosts, addr)
+	}
+	data := make([]byte, 3*ec.StripeSize(2))
+	rand.Read(data)
+	const missing, partial, parity = 1025, 1026, 1027
+	missingShards := writeTestEcExtent(t, dps, missing, data, 0)
+	partialShards := writeTestEcExtent(t, dps, partial, data, 0)
+	parityShards := writeTestEcExtent(t, dps, parity, data, 2)
+
+	// the reconstruction interrupted in the middle of a unit, whose tail is torn
+	store := dps[0].ExtentStore()
+	if err := store.Create(partial); err != nil {
+		t.Fatal(err)
+	}
+	for offset := uint64(0); offset < 2; offset++ {
+		if err := ecWriteUnit(store, partial, offset*ec.StripeUnitSize, offset*ec.StripeUnitSize, partialShards[offset][0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	torn := bytes.Repeat([]byte("x"), ec.StripeUnitSize/2)
+	if err := store.Write(partial, 2*ec.StripeUnitSize, int64(len(torn)), torn, 0, storage.AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dps[0].ecReconstruct(hosts, hosts[0]); err != nil {
+		t.Fatalf("reconstruct: %v", err)
+	}
+	checkTestEcShard(t, dps[0], missing, 0, missingShards)
+	checkTestEcShard(t, dps[0], partial, 0, partialShards)
+
+	// the parity is reconstructed from the data units
+	if err := dps[2].ecReconstruct(hosts, hosts[2]); err != nil {
+		t.Fatalf("reconstruct the parity: %v", err)
+	}
+	checkTestEcShard(t, dps[2], parity, 2, parityShards)
+
+	if err := dps[0].ecReconstruct(hosts[:2], hosts[0]); err == nil {
+		t.Fatalf("expect the hosts mismatching the partition refused")
+	}
+	if err := dps[0].ecReconstruct(hosts, "127.0.0.1:1"); err == nil {
+		t.Fatalf("expect the host not in the partition refused")
+	}
+}
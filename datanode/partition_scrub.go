@@ -0,0 +1,256 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/time/rate"
+)
+
+// The scrubber reads every block of the normal extents of the data partitions on a disk, and verifies it against
+// the crc stored in the header of the extent. A corrupt block is rebuilt from a replica of which the block matches
+// the stored crc, through the repair read. The extents with the blocks that cannot be rebuilt are marked bad in the
+// scrub record and alarmed, so that the replica can be decommissioned.
+//
+// Each disk scrubs one data partition at a time, and the reads are limited by the scrub rate. A data partition is
+// scrubbed once every scrub interval, and the end of the last scrub is persisted in the metadata of the partition.
+// The tiny extents and the erasure-coded partitions are not scrubbed, as they have no crc of the blocks.
+
+// ScrubRecord defines the progress and the result of a scrub of a data partition.
+type ScrubRecord struct {
+	StartTime      int64    `json:"start"`
+	EndTime        int64    `json:"end"` // zero while the scrub is running
+	TotalExtents   int      `json:"totalExtents"`
+	ScannedExtents int      `json:"scannedExtents"`
+	ScannedBytes   uint64   `json:"scannedBytes"`
+	CorruptBlocks  int      `json:"corruptBlocks"`
+	RepairedBlocks int      `json:"repairedBlocks"`
+	BadExtents     []uint64 `json:"badExtents"` // the extents with the corrupt blocks not repaired
+	Msg            string   `json:"msg,omitempty"`
+}
+
+func (d *Disk) scrub() {
+	interval, limit := d.space.scrubInterval, d.space.scrubRate
+	if interval <= 0 {
+		return
+	}
+	limiter := rate.NewLimiter(rate.Limit(limit), util.BlockSize)
+	for {
+		partitions := make([]*DataPartition, 0)
+		d.RLock()
+		for _, dp := range d.partitionMap {
+			partitions = append(partitions, dp)
+		}
+		d.RUnlock()
+		// the partitions scrubbed earlier go first
+		sort.Slice(partitions, func(i, j int) bool {
+			return atomic.LoadInt64(&partitions[i].lastScrubTime) < atomic.LoadInt64(&partitions[j].lastScrubTime)
+		})
+		for _, dp := range partitions {
+			if time.Now().Unix()-atomic.LoadInt64(&dp.lastScrubTime) < interval {
+				continue
+			}
+			dp.scrub(limiter)
+		}
+		time.Sleep(time.Minute * IntervalToScrub)
+	}
+}
+
+// ScrubHistory returns the records of the recent scrubs, of which the last one may be running.
+func (dp *DataPartition) ScrubHistory() (records []*ScrubRecord) {
+	dp.scrubLock.RLock()
+	defer dp.scrubLock.RUnlock()
+	records = make([]*ScrubRecord, 0, len(dp.scrubHistory))
+	for _, r := range dp.scrubHistory {
+		record := *r
+		record.BadExtents = append([]uint64(nil), r.BadExtents...)
+		records = append(records, &record)
+	}
+	return
+}
+
+// BadExtentCount returns the number of the extents with the corrupt blocks not repaired by the last scrub finished,
+// which is reported to the master so that the replica can be decommissioned.
+func (dp *DataPartition) BadExtentCount() int {
+	dp.scrubLock.RLock()
+	defer dp.scrubLock.RUnlock()
+	for i := len(dp.scrubHistory) - 1; i >= 0; i-- {
+		if r := dp.scrubHistory[i]; r.EndTime != 0 {
+			return len(r.BadExtents)
+		}
+	}
+	return 0
+}
+
+func (dp *DataPartition) updateScrubRecord(record *ScrubRecord, update func(r *ScrubRecord)) {
+	dp.scrubLock.Lock()
+	defer dp.scrubLock.Unlock()
+	update(record)
+}
+
+func (dp *DataPartition) isStopped() bool {
+	select {
+	case <-dp.stopC:
+		return true
+	default:
+		return false
+	}
+}
+
+func (dp *DataPartition) scrub(limiter *rate.Limiter) {
+	if dp.IsEc() || dp.isStopped() {
+		return
+	}
+	record := &ScrubRecord{StartTime: time.Now().Unix()}
+	dp.scrubLock.Lock()
+	dp.scrubHistory = append(dp.scrubHistory, record)
+	if len(dp.scrubHistory) > MaxScrubHistory {
+		dp.scrubHistory = dp.scrubHistory[len(dp.scrubHistory)-MaxScrubHistory:]
+	}
+	dp.scrubLock.Unlock()
+	defer func() {
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.EndTime = time.Now().Unix() })
+		log.LogInfof("action[scrub] partition(%v) finished, record(%+v)", dp.partitionID, record)
+	}()
+
+	extents, _, err := dp.extentStore.GetAllWatermarks(storage.NormalExtentFilter())
+	if err != nil {
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.Msg = err.Error() })
+		return
+	}
+	dp.updateScrubRecord(record, func(r *ScrubRecord) { r.TotalExtents = len(extents) })
+	data := make([]byte, util.BlockSize)
+	for _, ei := range extents {
+		if dp.isStopped() {
+			dp.updateScrubRecord(record, func(r *ScrubRecord) { r.Msg = "partition stopped" })
+			return
+		}
+		dp.scrubExtent(ei.FileID, data, limiter, record)
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.ScannedExtents++ })
+	}
+	atomic.StoreInt64(&dp.lastScrubTime, time.Now().Unix())
+	if err = dp.PersistMetadata(); err != nil {
+		log.LogErrorf("action[scrub] partition(%v) persist metadata err(%v)", dp.partitionID, err)
+	}
+}
+
+// scrubExtent verifies the blocks of the extent of which the crc has been computed, and rebuilds the corrupt ones.
+func (dp *DataPartition) scrubExtent(extentID uint64, data []byte, limiter *rate.Limiter, record *ScrubRecord) {
+	store := dp.extentStore
+	blockCnt, err := store.BlockCount(extentID)
+	if err != nil {
+		return
+	}
+	var isBad bool
+	for blockNo := 0; blockNo < blockCnt; blockNo++ {
+		limiter.WaitN(context.Background(), util.BlockSize)
+		size, expectCrc, actualCrc, err := store.VerifyBlock(extentID, blockNo, data)
+		if err != nil {
+			// the extent has been deleted
+			return
+		}
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.ScannedBytes += uint64(size) })
+		if expectCrc == 0 || actualCrc == expectCrc {
+			continue
+		}
+		// verify again in case of a random write between the read of the block and the update of the crc
+		if _, expectCrc, actualCrc, err = store.VerifyBlock(extentID, blockNo, data); err != nil ||
+			expectCrc == 0 || actualCrc == expectCrc {
+			continue
+		}
+		log.LogWarnf("action[scrubExtent] partition(%v) extent(%v) block(%v) crc mismatch, expect(%v) actual(%v)",
+			dp.partitionID, extentID, blockNo, expectCrc, actualCrc)
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.CorruptBlocks++ })
+		if err = dp.repairBlock(extentID, blockNo, size, expectCrc); err != nil {
+			mesg := fmt.Sprintf("data partition %v extent %v block %v on %v is corrupt and not repaired: %v",
+				dp.partitionID, extentID, blockNo, LocalIP, err)
+			log.LogError(mesg)
+			exporter.Warning(mesg)
+			if !isBad {
+				isBad = true
+				dp.updateScrubRecord(record, func(r *ScrubRecord) { r.BadExtents = append(r.BadExtents, extentID) })
+			}
+			continue
+		}
+		dp.updateScrubRecord(record, func(r *ScrubRecord) { r.RepairedBlocks++ })
+	}
+}
+
+// repairBlock rebuilds the block from the first replica of which the block matches the crc.
+func (dp *DataPartition) repairBlock(extentID uint64, blockNo, size int, expectCrc uint32) (err error) {
+	for _, addr := range dp.Replicas() {
+		if strings.TrimSpace(strings.Split(addr, ":")[0]) == LocalIP {
+			continue
+		}
+		var data []byte
+		if data, err = dp.readBlockFromReplica(addr, extentID, blockNo, size); err != nil {
+			log.LogWarnf("action[repairBlock] partition(%v) extent(%v) block(%v) read from(%v) err(%v)",
+				dp.partitionID, extentID, blockNo, addr, err)
+			continue
+		}
+		if crc32.ChecksumIEEE(data) != expectCrc {
+			log.LogWarnf("action[repairBlock] partition(%v) extent(%v) block(%v) on(%v) is corrupt too",
+				dp.partitionID, extentID, blockNo, addr)
+			continue
+		}
+		if err = dp.extentStore.RepairBlock(extentID, blockNo, data); err != nil {
+			return
+		}
+		log.LogInfof("action[repairBlock] partition(%v) extent(%v) block(%v) repaired from(%v)",
+			dp.partitionID, extentID, blockNo, addr)
+		return nil
+	}
+	return fmt.Errorf("no replica has the block matching crc %v", expectCrc)
+}
+
+// readBlockFromReplica reads the block through the repair read, which replies a block in one packet.
+func (dp *DataPartition) readBlockFromReplica(addr string, extentID uint64, blockNo, size int) (data []byte, err error) {
+	request := repl.NewExtentRepairReadPacket(dp.partitionID, extentID, blockNo*util.BlockSize, size)
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(addr); err != nil {
+		return
+	}
+	// the connection is closed since the final reply of the repair read is not consumed
+	defer gConnPool.PutConnect(conn, true)
+	if err = request.WriteToConn(conn); err != nil {
+		return
+	}
+	reply := repl.NewPacket()
+	if err = reply.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		return nil, fmt.Errorf("result code(%v) msg(%v)", reply.ResultCode, string(reply.Data[:reply.Size]))
+	}
+	if reply.ReqID != request.ReqID || reply.ExtentID != extentID ||
+		reply.ExtentOffset != request.ExtentOffset || int(reply.Size) != size {
+		return nil, fmt.Errorf("unavalid reply(%v) of request(%v)", reply.GetUniqueLogId(), request.GetUniqueLogId())
+	}
+	return reply.Data[:reply.Size], nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The files of a volume not accessed for the days of the tier policy are migrated by the metanodes to the cold
+// data partitions, which are created on the disks of the cold media class. The first host of a cold data partition
+// copies the extent from the hosts of the source partition into a new extent, which is replicated to the other hosts
+// as the extents written by the clients, and then the keys of the file are replaced on the metanode.
+
+// Handle OpTierMigrateExtent packet.
+func (s *DataNode) handlePacketToTierMigrateExtent(p *repl.Packet) {
+	var (
+		err      error
+		extentID uint64
+		data     []byte
+	)
+	defer func() {
+		if err != nil {
+			p.PackErrorBody(ActionTierMigrateExtent, err.Error())
+		}
+	}()
+	partition := p.Object.(*DataPartition)
+	if partition.IsEc() || !partition.isFirstHost() {
+		err = fmt.Errorf("partition(%v) local is not the first host(%v)", partition.partitionID, partition.getReplicaAddr(0))
+		return
+	}
+	req := &proto.TierMigrateExtentRequest{}
+	if err = json.Unmarshal(p.Data[:p.Size], req); err != nil {
+		return
+	}
+	if extentID, err = partition.tierMigrateExtent(req); err != nil {
+		return
+	}
+	if data, err = json.Marshal(&proto.TierMigrateExtentResponse{ExtentID: extentID}); err != nil {
+		return
+	}
+	p.PacketOkWithBody(data)
+}
+
+// Copy the extent of the source partition into a new extent of this partition block by block.
+func (dp *DataPartition) tierMigrateExtent(req *proto.TierMigrateExtentRequest) (extentID uint64, err error) {
+	if req.Size == 0 || req.Size > util.ExtentSize || len(req.SrcHosts) == 0 {
+		err = fmt.Errorf("illegal extent(%v_%v) size(%v) hosts(%v)", req.SrcPartitionID, req.SrcExtentID, req.Size, req.SrcHosts)
+		return
+	}
+	if extentID, err = dp.createOnFirstHost(req.Inode); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			dp.deleteNewExtents([]uint64{extentID})
+		}
+	}()
+	data := make([]byte, util.BlockSize)
+	for offset := uint64(0); offset < req.Size; offset += util.BlockSize {
+		size := util.Min(util.BlockSize, int(req.Size-offset))
+		if err = readFromHosts(req.SrcPartitionID, req.SrcHosts, req.SrcExtentID, int(offset), data[:size]); err != nil {
+			return
+		}
+		if err = dp.writeToFirstHost(extentID, int64(offset), data[:size]); err != nil {
+			return
+		}
+	}
+	log.LogInfof("action[tierMigrateExtent] extent(%v_%v) size(%v) migrated to extent(%v_%v)",
+		req.SrcPartitionID, req.SrcExtentID, req.Size, dp.partitionID, extentID)
+	return
+}
@@ -35,7 +35,9 @@ import (
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/repl"
 	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 )
@@ -48,6 +50,9 @@ var (
 	LocalIP      string
 	gConnPool    = util.NewConnectPool()
 	MasterHelper = util.NewMasterHelper()
+
+	// the connections to the metanodes, which are not authenticated as the ones to the other datanodes
+	gMetaConnPool = util.NewConnectPool()
 )
 
 const (
@@ -72,6 +77,13 @@ const (
 	ConfigKeyRaftDir       = "raftDir"       // string
 	ConfigKeyRaftHeartbeat = "raftHeartbeat" // string
 	ConfigKeyRaftReplica   = "raftReplica"   // string
+	ConfigKeyAuthenticate  = "authenticate"  // bool
+	ConfigKeyServiceKey    = "serviceKey"    // string
+	ConfigKeyAuthNodes     = "authNodes"     // array
+	ConfigKeyClientID      = "clientID"      // string
+	ConfigKeyClientKey     = "clientKey"     // string
+	ConfigKeyScrubInterval = "scrubInterval" // int, hours and negative to disable
+	ConfigKeyScrubRate     = "scrubRate"     // int, MB/s
 )
 
 // DataNode defines the structure of a data node.
@@ -91,6 +103,10 @@ type DataNode struct {
 	stopC           chan bool
 	state           uint32
 	wg              sync.WaitGroup
+	authenticate    bool
+	serviceKey      []byte
+	scrubInterval   int64
+	scrubRate       int64
 }
 
 func NewServer() *DataNode {
@@ -200,9 +216,59 @@ func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
 	if s.rackName == "" {
 		s.rackName = DefaultRackName
 	}
+	if err = s.parseAuthConfig(cfg); err != nil {
+		return
+	}
+	if s.scrubInterval = cfg.GetInt64(ConfigKeyScrubInterval); s.scrubInterval == 0 {
+		s.scrubInterval = DefaultScrubInterval
+	}
+	if s.scrubRate = cfg.GetInt64(ConfigKeyScrubRate); s.scrubRate <= 0 {
+		s.scrubRate = DefaultScrubRate
+	}
 	log.LogDebugf("action[parseConfig] load masterAddrs(%v).", MasterHelper.Nodes())
 	log.LogDebugf("action[parseConfig] load port(%v).", s.port)
 	log.LogDebugf("action[parseConfig] load rackName(%v).", s.rackName)
+	log.LogDebugf("action[parseConfig] load scrubInterval(%v) scrubRate(%v).", s.scrubInterval, s.scrubRate)
+	return
+}
+
+func (s *DataNode) parseAuthConfig(cfg *config.Config) (err error) {
+	if s.authenticate = cfg.GetBool(ConfigKeyAuthenticate); s.authenticate {
+		if s.serviceKey, err = cryptoutil.Base64Decode(cfg.GetString(ConfigKeyServiceKey)); err != nil || len(s.serviceKey) == 0 {
+			return fmt.Errorf("Err:serviceKey unavalid")
+		}
+		// packets forwarded to the followers are authenticated with tickets issued by this node
+		var peerAuth *auth.Authenticator
+		if peerAuth, err = auth.NewPeerAuthenticator(PeerClientID, proto.DataServiceID, s.serviceKey); err != nil {
+			return
+		}
+		handshake := func(c *net.TCPConn) error {
+			return peerAuth.Handshake(proto.DataServiceID, c)
+		}
+		repl.SetHandshake(handshake)
+		// and so are the shards of the erasure-coded partitions written to the other nodes
+		gConnPool.SetHandshake(handshake)
+	}
+	var authNodes []string
+	for _, addr := range cfg.GetArray(ConfigKeyAuthNodes) {
+		authNodes = append(authNodes, addr.(string))
+	}
+	if len(authNodes) == 0 {
+		return
+	}
+	authenticator, err := auth.NewAuthenticator(authNodes, cfg.GetString(ConfigKeyClientID),
+		cfg.GetString(ConfigKeyClientKey), "")
+	if err != nil {
+		return fmt.Errorf("Err:authNodes unavalid: %v", err)
+	}
+	MasterHelper.SetTokenFunc(func() (string, error) {
+		return authenticator.Token(proto.MasterServiceID)
+	})
+	// the extents referred by the metanodes are checked and relocated when compacting the partitions
+	gMetaConnPool.SetHandshake(func(c *net.TCPConn) error {
+		return authenticator.Handshake(proto.MetaServiceID, c)
+	})
+	log.LogDebugf("action[parseConfig] load authNodes(%v) clientID(%v).", authNodes, authenticator.ClientID())
 	return
 }
 
@@ -216,15 +282,20 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 	s.space.SetRaftStore(s.raftStore)
 	s.space.SetNodeID(s.nodeID)
 	s.space.SetClusterID(s.clusterID)
+	s.space.SetScrubConfig(s.scrubInterval, s.scrubRate)
 
 	var wg sync.WaitGroup
 	for _, d := range cfg.GetArray(ConfigKeyDisks) {
 		log.LogDebugf("action[startSpaceManager] load disk raw config(%v).", d)
 
-		// format "PATH:RESET_SIZE
+		// format "PATH:RESET_SIZE[:MEDIA_TYPE]"
 		arr := strings.Split(d.(string), ":")
-		if len(arr) != 2 {
-			return errors.New("Invalid disk configuration. Example: PATH:RESERVE_SIZE")
+		if len(arr) != 2 && len(arr) != 3 {
+			return errors.New("Invalid disk configuration. Example: PATH:RESERVE_SIZE[:MEDIA_TYPE]")
+		}
+		var mediaType string
+		if len(arr) == 3 {
+			mediaType = strings.TrimSpace(arr[2])
 		}
 		path := arr[0]
 		fileInfo, err := os.Stat(path)
@@ -244,10 +315,10 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 		}
 
 		wg.Add(1)
-		go func(wg *sync.WaitGroup, path string, reservedSpace uint64) {
+		go func(wg *sync.WaitGroup, path string, reservedSpace uint64, mediaType string) {
 			defer wg.Done()
-			s.space.LoadDisk(path, reservedSpace, DefaultDiskMaxErr)
-		}(&wg, path, reservedSpace)
+			s.space.LoadDisk(path, reservedSpace, mediaType, DefaultDiskMaxErr)
+		}(&wg, path, reservedSpace, mediaType)
 	}
 	wg.Wait()
 	return nil
@@ -360,6 +431,8 @@ func (s *DataNode) registerHandler() {
 	http.HandleFunc("/partition", s.getPartitionAPI)
 	http.HandleFunc("/extent", s.getExtentAPI)
 	http.HandleFunc("/block", s.getBlockCrcAPI)
+	http.HandleFunc("/tinyExtents", s.getTinyExtentsAPI)
+	http.HandleFunc("/compactTinyExtent", s.compactTinyExtentAPI)
 	http.HandleFunc("/stats", s.getStatAPI)
 	http.HandleFunc("/raftStatus", s.getRaftStatus)
 }
@@ -403,7 +476,8 @@ func (s *DataNode) serveConn(conn net.Conn) {
 	c, _ := conn.(*net.TCPConn)
 	c.SetKeepAlive(true)
 	c.SetNoDelay(true)
-	packetProcessor := repl.NewReplProtocol(c, s.Prepare, s.OperatePacket, s.Post)
+	ca := &connAuth{s: s}
+	packetProcessor := repl.NewReplProtocol(c, ca.Prepare, s.OperatePacket, s.Post)
 	packetProcessor.ServerConn()
 }
 
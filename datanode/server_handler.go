@@ -38,6 +38,7 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 			Status      int    `json:"status"`
 			RestSize    uint64 `json:"restSize"`
 			Partitions  int    `json:"partitions"`
+			MediaType   string `json:"mediaType"`
 		}{
 			Path:        diskItem.Path,
 			Total:       diskItem.Total,
@@ -48,6 +49,7 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 			Status:      diskItem.Status,
 			RestSize:    diskItem.ReservedSpace,
 			Partitions:  diskItem.PartitionCount(),
+			MediaType:   diskItem.MediaType,
 		}
 		disks = append(disks, disk)
 	}
@@ -160,6 +162,7 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		Replicas             []string              `json:"replicas"`
 		TinyDeleteRecordSize int64                 `json:"tinyDeleteRecordSize"`
 		RaftStatus           *raft.Status          `json: "raftStatus"`
+		Scrub                []*ScrubRecord        `json:"scrub"`
 	}{
 		VolName:              partition.volumeID,
 		ID:                   partition.partitionID,
@@ -172,6 +175,7 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		Replicas:             partition.Replicas(),
 		TinyDeleteRecordSize: tinyDeleteRecordSize,
 		RaftStatus:           partition.raftPartition.Status(),
+		Scrub:                partition.ScrubHistory(),
 	}
 	s.buildSuccessResp(w, result)
 }
@@ -242,6 +246,75 @@ func (s *DataNode) getBlockCrcAPI(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func (s *DataNode) getTinyExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		usages      []*TinyExtentUsage
+		err         error
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partitionID, err = strconv.ParseUint(r.FormValue("id"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if usages, err = partition.TinyExtentUsages(); err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := &struct {
+		ID          uint64             `json:"id"`
+		Extents     []*TinyExtentUsage `json:"extents"`
+		Reclaimable int64              `json:"reclaimable"`
+		Compactions []*CompactRecord   `json:"compactions"`
+	}{
+		ID:          partitionID,
+		Extents:     usages,
+		Compactions: partition.CompactHistory(),
+	}
+	for _, usage := range usages {
+		result.Reclaimable += usage.Reclaimable
+	}
+	s.buildSuccessResp(w, result)
+}
+
+func (s *DataNode) compactTinyExtentAPI(w http.ResponseWriter, r *http.Request) {
+	var (
+		partitionID uint64
+		extentID    uint64
+		err         error
+	)
+	if err = r.ParseForm(); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if partitionID, err = strconv.ParseUint(r.FormValue("id"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if extentID, err = strconv.ParseUint(r.FormValue("extentID"), 10, 64); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if err = partition.StartCompactTinyExtent(extentID); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, fmt.Sprintf("compaction of extent(%v_%v) started", partitionID, extentID))
+}
+
 func (s *DataNode) buildSuccessResp(w http.ResponseWriter, data interface{}) {
 	s.buildJSONResp(w, http.StatusOK, data, "")
 }
@@ -41,6 +41,8 @@ type SpaceManager struct {
 	selectedIndex        int // TODO what is selected index
 	diskList             []string
 	createPartitionMutex sync.RWMutex
+	scrubInterval        int64 // seconds between the scrubs of a data partition, and non-positive to disable
+	scrubRate            int   // bytes read by the scrubber on each disk per second
 }
 
 // NewSpaceManager creates a new space manager.
@@ -81,6 +83,12 @@ func (manager *SpaceManager) GetClusterID() (clusterID string) {
 	return manager.clusterID
 }
 
+// SetScrubConfig sets the interval of the scrubs in hours, and the rate of the reads on each disk in MB/s.
+func (manager *SpaceManager) SetScrubConfig(interval, rate int64) {
+	manager.scrubInterval = interval * 3600
+	manager.scrubRate = int(rate) * util.MB
+}
+
 func (manager *SpaceManager) SetRaftStore(raftStore raftstore.RaftStore) {
 	manager.raftStore = raftStore
 }
@@ -120,7 +128,7 @@ func (manager *SpaceManager) Stats() *Stats {
 	return manager.stats
 }
 
-func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, maxErrCnt int) (err error) {
+func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, mediaType string, maxErrCnt int) (err error) {
 	var (
 		disk    *Disk
 		visitor PartitionVisitor
@@ -135,11 +143,12 @@ func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, maxErrC
 		}
 	}
 	if _, err = manager.GetDisk(path); err != nil {
-		disk = NewDisk(path, reservedSpace, maxErrCnt, manager)
+		disk = NewDisk(path, reservedSpace, mediaType, maxErrCnt, manager)
 		disk.RestorePartition(visitor)
 		manager.putDisk(disk)
 		err = nil
 		go disk.autoComputeExtentCrc()
+		go disk.scrub()
 	}
 	return
 }
@@ -189,7 +198,8 @@ func (manager *SpaceManager) updateMetrics() {
 		remainingCapacityToCreatePartition, maxCapacityToCreatePartition, partitionCnt)
 }
 
-func (manager *SpaceManager) minPartitionCnt() (d *Disk) {
+// Returns the disk of the media class with the least weight, or of any class if the media type is empty.
+func (manager *SpaceManager) minPartitionCnt(mediaType string) (d *Disk) {
 	manager.diskMutex.Lock()
 	defer manager.diskMutex.Unlock()
 	var (
@@ -201,6 +211,9 @@ func (manager *SpaceManager) minPartitionCnt() (d *Disk) {
 		if disk.Available <= 5*util.GB || disk.Status != proto.ReadWrite {
 			continue
 		}
+		if mediaType != "" && disk.MediaType != mediaType {
+			continue
+		}
 		diskWeight := disk.getSelectWeight()
 		if diskWeight < minWeight {
 			minWeight = diskWeight
@@ -264,12 +277,14 @@ func (manager *SpaceManager) CreatePartition(request *proto.CreateDataPartitionR
 		NodeID:        manager.nodeID,
 		ClusterID:     manager.clusterID,
 		PartitionSize: request.PartitionSize,
+		EcDataNum:     request.EcDataNum,
+		EcParityNum:   request.EcParityNum,
 	}
 	dp = manager.partitions[dpCfg.PartitionID]
 	if dp != nil {
 		return
 	}
-	disk := manager.minPartitionCnt()
+	disk := manager.minPartitionCnt(request.MediaType)
 	if disk == nil {
 		return nil, ErrNoSpaceToCreatePartition
 	}
@@ -324,6 +339,7 @@ func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatRespo
 			IsLeader:        isLeader,
 			ExtentCount:     partition.GetExtentCount(),
 			NeedCompare:     true,
+			BadExtentCount:  partition.BadExtentCount(),
 		}
 		log.LogDebugf("action[Heartbeats] dpid(%v), status(%v) total(%v) used(%v) leader(%v) b(%v).", vr.PartitionID, vr.PartitionStatus, vr.Total, vr.Used, leaderAddr, vr.IsLeader)
 		response.PartitionReports = append(response.PartitionReports, vr)
@@ -331,9 +347,17 @@ func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatRespo
 	})
 
 	disks := space.GetDisks()
+	response.DiskReports = make([]*proto.DiskReport, 0, len(disks))
 	for _, d := range disks {
 		if d.Status == proto.Unavailable {
 			response.BadDisks = append(response.BadDisks, d.Path)
 		}
+		response.DiskReports = append(response.DiskReports, &proto.DiskReport{
+			Path:      d.Path,
+			Total:     d.Total,
+			Used:      d.Used,
+			Status:    d.Status,
+			MediaType: d.MediaType,
+		})
 	}
 }
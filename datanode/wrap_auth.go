@@ -0,0 +1,83 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+)
+
+// connAuth keeps the ticket presented by the client of a connection.
+type connAuth struct {
+	s      *DataNode
+	ticket *cryptoutil.Ticket
+}
+
+// Prepare authenticates the connection or checks the ticket of the connection before preparing the packet.
+// The packets of a connection are prepared one by one, so the ticket needs no lock.
+func (ca *connAuth) Prepare(p *repl.Packet) (err error) {
+	if p.Opcode == proto.OpAuthenticate {
+		err = ca.authenticate(p)
+	} else {
+		err = ca.checkTicket(p)
+	}
+	if err != nil || p.Opcode == proto.OpAuthenticate {
+		p.SetPacketHasPrepare()
+		p.BeforeTp(ca.s.clusterID)
+		if err != nil {
+			p.PackErrorBody(repl.ActionPreparePkt, err.Error())
+		}
+		return
+	}
+	return ca.s.Prepare(p)
+}
+
+func (ca *connAuth) authenticate(p *repl.Packet) (err error) {
+	if !ca.s.authenticate {
+		return
+	}
+	t, err := proto.ExtractAPIAccessToken(string(p.Data[:p.Size]), proto.DataServiceID, ca.s.serviceKey)
+	if err != nil {
+		return fmt.Errorf("%v: %v", proto.ErrInvalidTicket, err)
+	}
+	ca.ticket = &t
+	return
+}
+
+// Check whether the ticket of the connection grants the operation. The operations sent by the master,
+// metanodes and other data nodes require the tickets of the services, and unknown operations are rejected.
+func (ca *connAuth) checkTicket(p *repl.Packet) (err error) {
+	if !ca.s.authenticate {
+		return
+	}
+	rsc, ok := proto.DataOp2ResourceMap[p.Opcode]
+	if !ok {
+		return fmt.Errorf("%v: unknown operation(%v)", proto.ErrInvalidTicket, p.Opcode)
+	}
+	if ca.ticket == nil {
+		return fmt.Errorf("%v: connection is not authenticated", proto.ErrInvalidTicket)
+	}
+	if time.Now().Unix() >= ca.ticket.Exp {
+		return fmt.Errorf("%v: ticket expired", proto.ErrInvalidTicket)
+	}
+	if err = proto.CheckTicketCaps(ca.ticket, rsc); err != nil {
+		return fmt.Errorf("%v: %v", proto.ErrInvalidTicket, err)
+	}
+	return
+}
@@ -112,6 +112,14 @@ func (s *DataNode) OperatePacket(p *repl.Packet, c *net.TCPConn) (err error) {
 		s.handlePacketToReadTinyDeleteRecordFile(p, c)
 	case proto.OpBroadcastMinAppliedID:
 		s.handleBroadcastMinAppliedID(p)
+	case proto.OpEcConvertExtent:
+		s.handlePacketToEcConvertExtent(p)
+	case proto.OpTierMigrateExtent:
+		s.handlePacketToTierMigrateExtent(p)
+	case proto.OpEcReconstructDataPartition:
+		s.handlePacketToEcReconstructDataPartition(p)
+	case proto.OpAuthenticate:
+		p.PacketOkReply()
 	default:
 		p.PackErrorBody(repl.ErrorUnknownOp.Error(), repl.ErrorUnknownOp.Error()+strconv.Itoa(int(p.Opcode)))
 	}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
 	"net"
@@ -35,25 +36,34 @@ const (
 	TaskWorkerInterval = time.Second * time.Duration(2)
 )
 
+// If set, the connections of the tasks are authenticated with the tickets it obtains from authnode,
+// which the metanodes and datanodes require if they enable the authentication.
+var taskAuthenticator *auth.Authenticator
+
 // AdminTaskManager sends administration commands to the metaNode or dataNode.
 type AdminTaskManager struct {
 	clusterID  string
 	targetAddr string
+	serviceID  string // the service of the target node, i.e. proto.MetaServiceID or proto.DataServiceID
 	TaskMap    map[string]*proto.AdminTask
 	sync.RWMutex
 	exitCh   chan struct{}
 	connPool *util.ConnectPool
 }
 
-func newAdminTaskManager(targetAddr, clusterID string) (sender *AdminTaskManager) {
+func newAdminTaskManager(targetAddr, clusterID, serviceID string) (sender *AdminTaskManager) {
 
 	sender = &AdminTaskManager{
 		targetAddr: targetAddr,
 		clusterID:  clusterID,
+		serviceID:  serviceID,
 		TaskMap:    make(map[string]*proto.AdminTask),
 		exitCh:     make(chan struct{}, 1),
 		connPool:   util.NewConnectPool(),
 	}
+	if taskAuthenticator != nil {
+		sender.connPool.SetHandshake(sender.handshake)
+	}
 	go sender.process()
 
 	return
@@ -123,10 +133,20 @@ func (sender *AdminTaskManager) getConn() (conn *net.TCPConn, err error) {
 		conn = connect.(*net.TCPConn)
 		conn.SetKeepAlive(true)
 		conn.SetNoDelay(true)
+		if taskAuthenticator != nil {
+			if err = sender.handshake(conn); err != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
 	}
 	return
 }
 
+func (sender *AdminTaskManager) handshake(conn *net.TCPConn) error {
+	return taskAuthenticator.Handshake(sender.serviceID, conn)
+}
+
 func (sender *AdminTaskManager) putConn(conn *net.TCPConn, forceClose bool) {
 	if useConnPool {
 		sender.connPool.PutConnect(conn, forceClose)
@@ -134,6 +134,123 @@ func (m *Server) setupAutoAllocation(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set DisableAutoAllocate to %v successfully", status)))
 }
 
+// Start the balancer of the data nodes, which moves the replicas of the data partitions from the disks
+// used more than the average of the cluster by the threshold to the data nodes used less.
+func (m *Server) startBalancer(w http.ResponseWriter, r *http.Request) {
+	var (
+		threshold   float64
+		concurrency int
+		err         error
+	)
+	if threshold, concurrency, err = parseRequestToStartBalancer(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.startBalancer(m.cluster.balancer, threshold, concurrency); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply("start balancer successfully"))
+}
+
+func (m *Server) stopBalancer(w http.ResponseWriter, r *http.Request) {
+	if err := m.cluster.stopBalancer(m.cluster.balancer); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply("stop balancer successfully"))
+}
+
+func (m *Server) getBalancer(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.getBalancerView()))
+}
+
+// Start the balancer of the meta nodes, which moves the replicas of the meta partitions from the meta nodes
+// using more memory than the average of the cluster by the threshold to the meta nodes using less.
+func (m *Server) startMetaBalancer(w http.ResponseWriter, r *http.Request) {
+	var (
+		threshold   float64
+		concurrency int
+		err         error
+	)
+	if threshold, concurrency, err = parseRequestToStartBalancer(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.startBalancer(m.cluster.metaBalancer, threshold, concurrency); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply("start meta balancer successfully"))
+}
+
+func (m *Server) stopMetaBalancer(w http.ResponseWriter, r *http.Request) {
+	if err := m.cluster.stopBalancer(m.cluster.metaBalancer); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply("stop meta balancer successfully"))
+}
+
+// Get the meta balancer, along with the memory footprint of the meta partitions on each meta node.
+func (m *Server) getMetaBalancer(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.getMetaBalancerView()))
+}
+
+// List the jobs, without the steps.
+func (m *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	sendOkReply(w, r, newSuccessHTTPReply(m.cluster.jobs.list()))
+}
+
+// Get the job along with the progress on each partition.
+func (m *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	var (
+		id  uint64
+		job *proto.Job
+		err error
+	)
+	if id, err = parseRequestToOperateJob(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if job, err = m.cluster.jobs.view(id); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(job))
+}
+
+// Cancel the job, which stops after the running step. The partitions operated on are not rolled back.
+func (m *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	m.operateJob(w, r, "cancel", m.cluster.cancelJob)
+}
+
+// Pause the job, which stops after the running step.
+func (m *Server) pauseJob(w http.ResponseWriter, r *http.Request) {
+	m.operateJob(w, r, "pause", m.cluster.pauseJob)
+}
+
+// Resume the job paused or failed, in which case the failed steps are retried.
+func (m *Server) resumeJob(w http.ResponseWriter, r *http.Request) {
+	m.operateJob(w, r, "resume", m.cluster.resumeJob)
+}
+
+func (m *Server) operateJob(w http.ResponseWriter, r *http.Request, action string, operate func(id uint64) error) {
+	var (
+		id  uint64
+		err error
+	)
+	if id, err = parseRequestToOperateJob(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = operate(id); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("%v job[%v] successfully", action, id)))
+}
+
 // View the topology of the cluster.
 func (m *Server) getTopology(w http.ResponseWriter, r *http.Request) {
 	tv := &TopologyView{
@@ -232,10 +349,12 @@ func (m *Server) createDataPartition(w http.ResponseWriter, r *http.Request) {
 		reqCreateCount             int
 		lastTotalDataPartitions    int
 		clusterTotalDataPartitions int
+		isEc                       bool
+		isCold                     bool
 		err                        error
 	)
 
-	if reqCreateCount, volName, err = parseRequestToCreateDataPartition(r); err != nil {
+	if reqCreateCount, volName, isEc, isCold, err = parseRequestToCreateDataPartition(r); err != nil {
 		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
 		return
 	}
@@ -247,7 +366,14 @@ func (m *Server) createDataPartition(w http.ResponseWriter, r *http.Request) {
 	lastTotalDataPartitions = len(vol.dataPartitions.partitions)
 	clusterTotalDataPartitions = m.cluster.getDataPartitionCount()
 	for i := 0; i < reqCreateCount; i++ {
-		if _, err = m.cluster.createDataPartition(volName); err != nil {
+		if isEc {
+			_, err = m.cluster.createEcDataPartition(volName)
+		} else if isCold {
+			_, err = m.cluster.createColdDataPartition(volName)
+		} else {
+			_, err = m.cluster.createDataPartition(volName)
+		}
+		if err != nil {
 			break
 		}
 	}
@@ -336,7 +462,7 @@ func (m *Server) addDataReplica(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = m.cluster.addDataReplica(dp, addr); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobAddDataReplica, addr, partitionID, dp.VolName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -363,7 +489,7 @@ func (m *Server) deleteDataReplica(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = m.cluster.removeDataReplica(dp, addr, true); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobDeleteDataReplica, addr, partitionID, dp.VolName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -390,7 +516,7 @@ func (m *Server) addMetaReplica(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = m.cluster.addMetaReplica(mp, addr); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobAddMetaReplica, addr, partitionID, mp.volName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -417,7 +543,7 @@ func (m *Server) deleteMetaReplica(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = m.cluster.deleteMetaReplica(mp, addr, true); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobDeleteMetaReplica, addr, partitionID, mp.volName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -444,7 +570,7 @@ func (m *Server) decommissionDataPartition(w http.ResponseWriter, r *http.Reques
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrDataPartitionNotExists))
 		return
 	}
-	if err = m.cluster.decommissionDataPartition(addr, dp, handleDataPartitionOfflineErr); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobDecommissionDataPartition, addr, partitionID, dp.VolName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -505,6 +631,231 @@ func (m *Server) updateVol(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(msg))
 }
 
+func (m *Server) setQuota(w http.ResponseWriter, r *http.Request) {
+	var (
+		name      string
+		authKey   string
+		quotaID   uint32
+		rootInode uint64
+		maxFiles  uint64
+		maxBytes  uint64
+		err       error
+	)
+	if name, authKey, quotaID, rootInode, maxFiles, maxBytes, err = parseRequestToSetQuota(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if quotaID, err = m.cluster.setQuota(name, authKey, quotaID, rootInode, maxFiles, maxBytes); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(quotaID))
+}
+
+func (m *Server) deleteQuota(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		quotaID uint32
+		err     error
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if quotaID, err = extractQuotaID(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.deleteQuota(name, authKey, quotaID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("delete quota[%v] of vol[%v] successfully", quotaID, name)))
+}
+
+func (m *Server) getQuota(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		quotaID uint32
+		vol     *Vol
+		quota   *proto.QuotaInfo
+		err     error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if quotaID, err = extractQuotaID(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	if quota, err = vol.getQuota(quotaID); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(quota))
+}
+
+// Obtain the quotas of the volume along with their usage.
+func (m *Server) listQuota(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		vol  *Vol
+		err  error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(vol.getQuotas()))
+}
+
+func (m *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		authKey  string
+		snapName string
+		snapshot *proto.SnapshotInfo
+		err      error
+	)
+	if name, authKey, snapName, err = parseRequestToSnapshot(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if snapshot, err = m.cluster.createSnapshot(name, authKey, snapName); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(snapshot))
+}
+
+func (m *Server) deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	var (
+		name     string
+		authKey  string
+		snapName string
+		err      error
+	)
+	if name, authKey, snapName, err = parseRequestToSnapshot(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.deleteSnapshot(name, authKey, snapName); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("delete snapshot[%v] of vol[%v] successfully", snapName, name)))
+}
+
+func (m *Server) listSnapshot(w http.ResponseWriter, r *http.Request) {
+	var (
+		name string
+		vol  *Vol
+		err  error
+	)
+	if name, err = parseAndExtractName(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if vol, err = m.cluster.getVol(name); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(proto.ErrVolNotExists))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(vol.getSnapshots()))
+}
+
+// Split a directory of the volume across meta partitions, which is done automatically once the directory
+// has too many entries.
+func (m *Server) splitDir(w http.ResponseWriter, r *http.Request) {
+	var (
+		name    string
+		authKey string
+		ino     uint64
+		count   int
+		pids    []uint64
+		err     error
+	)
+	if name, authKey, ino, count, err = parseRequestToSplitDir(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if pids, err = m.cluster.splitVolDir(name, authKey, ino, count); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(&proto.DirShardInfo{Inode: ino, PartitionIDs: pids}))
+}
+
+// Set the hours to keep the deleted files of the volume in the trash, and zero disables the trash.
+func (m *Server) setVolTrash(w http.ResponseWriter, r *http.Request) {
+	var (
+		name      string
+		authKey   string
+		retention uint32
+		err       error
+	)
+	if name, authKey, retention, err = parseRequestToSetVolTrash(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setVolTrash(name, authKey, retention); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set trash retention of vol[%v] to [%v] hours successfully", name, retention)))
+}
+
+func (m *Server) setVolEc(w http.ResponseWriter, r *http.Request) {
+	var (
+		name        string
+		authKey     string
+		dataNum     uint8
+		parityNum   uint8
+		migrateDays uint32
+		err         error
+	)
+	if name, authKey, dataNum, parityNum, migrateDays, err = parseRequestToSetVolEc(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setVolEc(name, authKey, dataNum, parityNum, migrateDays); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set erasure code of vol[%v] to data[%v] parity[%v] migrateDays[%v] successfully",
+		name, dataNum, parityNum, migrateDays)))
+}
+
+func (m *Server) setVolTier(w http.ResponseWriter, r *http.Request) {
+	var (
+		name          string
+		authKey       string
+		mediaType     string
+		coldMediaType string
+		coldAfterDays uint32
+		err           error
+	)
+	if name, authKey, mediaType, coldMediaType, coldAfterDays, err = parseRequestToSetVolTier(r); err != nil {
+		sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeParamError, Msg: err.Error()})
+		return
+	}
+	if err = m.cluster.setVolTier(name, authKey, mediaType, coldMediaType, coldAfterDays); err != nil {
+		sendErrReply(w, r, newErrHTTPReply(err))
+		return
+	}
+	sendOkReply(w, r, newSuccessHTTPReply(fmt.Sprintf("set tier of vol[%v] to media[%v] coldMedia[%v] coldAfterDays[%v] successfully",
+		name, mediaType, coldMediaType, coldAfterDays)))
+}
+
 func (m *Server) createVol(w http.ResponseWriter, r *http.Request) {
 	var (
 		name         string
@@ -563,6 +914,14 @@ func newSimpleView(vol *Vol) *proto.SimpleVolView {
 		RwDpCnt:            vol.dataPartitions.readableAndWritableCnt,
 		MpCnt:              len(vol.MetaPartitions),
 		DpCnt:              len(vol.dataPartitions.partitionMap),
+		CopyOnWrite:        vol.hasSnapshots(),
+		TrashRetention:     vol.TrashRetention,
+		EcDataNum:          vol.EcDataNum,
+		EcParityNum:        vol.EcParityNum,
+		EcMigrateDays:      vol.EcMigrateDays,
+		MediaType:          vol.MediaType,
+		ColdMediaType:      vol.ColdMediaType,
+		ColdAfterDays:      vol.ColdAfterDays,
 	}
 }
 
@@ -603,10 +962,12 @@ func (m *Server) getDataNode(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(dataNode))
 }
 
-// Decommission a data node. This will decommission all the data partition on that node.
+// Decommission a data node. This will decommission all the data partition on that node, in a job running
+// in the background.
 func (m *Server) decommissionDataNode(w http.ResponseWriter, r *http.Request) {
 	var (
 		node        *DataNode
+		job         *proto.Job
 		rstMsg      string
 		offLineAddr string
 		err         error
@@ -621,23 +982,23 @@ func (m *Server) decommissionDataNode(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrDataNodeNotExists))
 		return
 	}
-	if err = m.cluster.decommissionDataNode(node); err != nil {
+	if job, err = m.cluster.decommissionDataNode(node); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
-	rstMsg = fmt.Sprintf("decommission data node [%v] successfully", offLineAddr)
+	rstMsg = fmt.Sprintf("decommission data node [%v] submitted as job[%v]", offLineAddr, job.ID)
 	sendOkReply(w, r, newSuccessHTTPReply(rstMsg))
 }
 
-// Decommission a disk. This will decommission all the data partitions on this disk.
+// Decommission a disk. This will decommission all the data partitions on this disk, in a job running
+// in the background.
 func (m *Server) decommissionDisk(w http.ResponseWriter, r *http.Request) {
 	var (
 		node                  *DataNode
+		job                   *proto.Job
 		rstMsg                string
 		offLineAddr, diskPath string
 		err                   error
-		badPartitionIds       []uint64
-		badPartitions         []*DataPartition
 	)
 
 	if offLineAddr, diskPath, err = parseRequestToDecommissionNode(r); err != nil {
@@ -649,21 +1010,12 @@ func (m *Server) decommissionDisk(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrDataNodeNotExists))
 		return
 	}
-	badPartitions = node.badPartitions(diskPath, m.cluster)
-	if len(badPartitions) == 0 {
-		err = fmt.Errorf("node[%v] disk[%v] does not have any data partition", node.Addr, diskPath)
-		sendErrReply(w, r, newErrHTTPReply(err))
-		return
-	}
-	for _, bdp := range badPartitions {
-		badPartitionIds = append(badPartitionIds, bdp.PartitionID)
-	}
-	rstMsg = fmt.Sprintf("receive decommissionDisk node[%v] disk[%v], badPartitionIds[%v] has offline successfully",
-		node.Addr, diskPath, badPartitionIds)
-	if err = m.cluster.decommissionDisk(node, diskPath, badPartitions); err != nil {
+	if job, err = m.cluster.decommissionDisk(node, diskPath); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
+	rstMsg = fmt.Sprintf("receive decommissionDisk node[%v] disk[%v], %v partitions submitted as job[%v]",
+		node.Addr, diskPath, job.Total, job.ID)
 	Warn(m.clusterName, rstMsg)
 	sendOkReply(w, r, newSuccessHTTPReply(rstMsg))
 }
@@ -732,7 +1084,7 @@ func (m *Server) decommissionMetaPartition(w http.ResponseWriter, r *http.Reques
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrMetaPartitionNotExists))
 		return
 	}
-	if err = m.cluster.decommissionMetaPartition(nodeAddr, mp); err != nil {
+	if err = m.cluster.runJobInRequest(newPartitionJob(proto.JobDecommissionMetaPartition, nodeAddr, partitionID, mp.volName)); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
@@ -763,9 +1115,12 @@ func (m *Server) loadMetaPartition(w http.ResponseWriter, r *http.Request) {
 	sendOkReply(w, r, newSuccessHTTPReply(msg))
 }
 
+// Decommission a meta node. This will decommission all the meta partitions on that node, in a job running
+// in the background.
 func (m *Server) decommissionMetaNode(w http.ResponseWriter, r *http.Request) {
 	var (
 		metaNode    *MetaNode
+		job         *proto.Job
 		rstMsg      string
 		offLineAddr string
 		err         error
@@ -780,11 +1135,11 @@ func (m *Server) decommissionMetaNode(w http.ResponseWriter, r *http.Request) {
 		sendErrReply(w, r, newErrHTTPReply(proto.ErrMetaNodeNotExists))
 		return
 	}
-	if err = m.cluster.decommissionMetaNode(metaNode); err != nil {
+	if job, err = m.cluster.decommissionMetaNode(metaNode); err != nil {
 		sendErrReply(w, r, newErrHTTPReply(err))
 		return
 	}
-	rstMsg = fmt.Sprintf("decommissionMetaNode metaNode [%v] has offline successfully", offLineAddr)
+	rstMsg = fmt.Sprintf("decommissionMetaNode metaNode [%v] submitted as job[%v]", offLineAddr, job.ID)
 	sendOkReply(w, r, newSuccessHTTPReply(rstMsg))
 }
 
@@ -950,6 +1305,146 @@ func parseRequestToUpdateVol(r *http.Request) (name, authKey string, capacity, r
 	return
 }
 
+func parseRequestToSetQuota(r *http.Request) (name, authKey string, quotaID uint32, rootInode, maxFiles, maxBytes uint64, err error) {
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	// a new quota is created on the given inode if no quota ID is specified
+	if r.FormValue(idKey) != "" {
+		if quotaID, err = extractQuotaID(r); err != nil {
+			return
+		}
+	} else if rootInode, err = extractUint64(r, inodeKey); err != nil {
+		return
+	}
+	if maxFiles, err = extractUint64(r, maxFilesKey); err != nil {
+		return
+	}
+	if maxBytes, err = extractUint64(r, maxBytesKey); err != nil {
+		return
+	}
+	return
+}
+
+func parseRequestToSnapshot(r *http.Request) (name, authKey, snapName string, err error) {
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	if snapName = r.FormValue(snapshotKey); snapName == "" {
+		err = keyNotFound(snapshotKey)
+		return
+	}
+	return
+}
+
+func parseRequestToSplitDir(r *http.Request) (name, authKey string, ino uint64, count int, err error) {
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	if ino, err = extractUint64(r, inodeKey); err != nil {
+		return
+	}
+	if value := r.FormValue(countKey); value != "" {
+		if count, err = strconv.Atoi(value); err != nil || count < 2 {
+			err = unmatchedKey(countKey)
+			return
+		}
+	}
+	return
+}
+
+func parseRequestToSetVolTrash(r *http.Request) (name, authKey string, retention uint32, err error) {
+	var (
+		value string
+		hours uint64
+	)
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	if value = r.FormValue(trashRetentionKey); value == "" {
+		err = keyNotFound(trashRetentionKey)
+		return
+	}
+	if hours, err = strconv.ParseUint(value, 10, 32); err != nil {
+		err = unmatchedKey(trashRetentionKey)
+		return
+	}
+	retention = uint32(hours)
+	return
+}
+
+func parseRequestToSetVolEc(r *http.Request) (name, authKey string, dataNum, parityNum uint8, migrateDays uint32, err error) {
+	var value uint64
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	if value, err = extractUint64(r, ecMigrateDaysKey); err != nil {
+		return
+	}
+	migrateDays = uint32(value)
+	// the erasure code params are not needed to disable the conversion
+	if migrateDays == 0 {
+		return
+	}
+	if value, err = extractUint64(r, ecDataNumKey); err != nil {
+		return
+	}
+	dataNum = uint8(value)
+	if value, err = extractUint64(r, ecParityNumKey); err != nil {
+		return
+	}
+	parityNum = uint8(value)
+	return
+}
+
+func extractQuotaID(r *http.Request) (quotaID uint32, err error) {
+	var (
+		value string
+		id    uint64
+	)
+	if value = r.FormValue(idKey); value == "" {
+		err = keyNotFound(idKey)
+		return
+	}
+	if id, err = strconv.ParseUint(value, 10, 32); err != nil {
+		err = unmatchedKey(idKey)
+		return
+	}
+	return uint32(id), nil
+}
+
+func parseRequestToSetVolTier(r *http.Request) (name, authKey, mediaType, coldMediaType string, coldAfterDays uint32, err error) {
+	var value uint64
+	if name, authKey, err = parseVolNameAndAuthKey(r); err != nil {
+		return
+	}
+	mediaType = r.FormValue(mediaTypeKey)
+	coldMediaType = r.FormValue(coldMediaTypeKey)
+	if r.FormValue(coldAfterDaysKey) != "" {
+		if value, err = extractUint64(r, coldAfterDaysKey); err != nil {
+			return
+		}
+		coldAfterDays = uint32(value)
+	}
+	// the files can not be migrated without the cold tier
+	if coldAfterDays > 0 && (coldMediaType == "" || coldMediaType == mediaType) {
+		err = unmatchedKey(coldMediaTypeKey)
+	}
+	return
+}
+
+func extractUint64(r *http.Request, key string) (value uint64, err error) {
+	var str string
+	if str = r.FormValue(key); str == "" {
+		err = keyNotFound(key)
+		return
+	}
+	if value, err = strconv.ParseUint(str, 10, 64); err != nil {
+		err = unmatchedKey(key)
+	}
+	return
+}
+
 func parseRequestToCreateVol(r *http.Request) (name, owner string, mpCount, size, capacity int, followerRead bool, err error) {
 	if err = r.ParseForm(); err != nil {
 		return
@@ -989,7 +1484,7 @@ func parseRequestToCreateVol(r *http.Request) (name, owner string, mpCount, size
 	return
 }
 
-func parseRequestToCreateDataPartition(r *http.Request) (count int, name string, err error) {
+func parseRequestToCreateDataPartition(r *http.Request) (count int, name string, isEc, isCold bool, err error) {
 	if err = r.ParseForm(); err != nil {
 		return
 	}
@@ -1003,6 +1498,18 @@ func parseRequestToCreateDataPartition(r *http.Request) (count int, name string,
 	if name, err = extractName(r); err != nil {
 		return
 	}
+	if value := r.FormValue(ecKey); value != "" {
+		if isEc, err = strconv.ParseBool(value); err != nil {
+			err = unmatchedKey(ecKey)
+			return
+		}
+	}
+	if value := r.FormValue(coldKey); value != "" {
+		if isCold, err = strconv.ParseBool(value); err != nil {
+			err = unmatchedKey(coldKey)
+			return
+		}
+	}
 	return
 }
 
@@ -1159,6 +1666,33 @@ func parseAndExtractThreshold(r *http.Request) (threshold float64, err error) {
 	return
 }
 
+func parseRequestToStartBalancer(r *http.Request) (threshold float64, concurrency int, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	// the settings are kept if not specified
+	if value := r.FormValue(thresholdKey); value != "" {
+		if threshold, err = strconv.ParseFloat(value, 64); err != nil || threshold <= 0 || threshold >= 1 {
+			err = unmatchedKey(thresholdKey)
+			return
+		}
+	}
+	if value := r.FormValue(concurrencyKey); value != "" {
+		if concurrency, err = strconv.Atoi(value); err != nil || concurrency <= 0 {
+			err = unmatchedKey(concurrencyKey)
+			return
+		}
+	}
+	return
+}
+
+func parseRequestToOperateJob(r *http.Request) (id uint64, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	return extractUint64(r, idKey)
+}
+
 func validateRequestToCreateMetaPartition(r *http.Request) (volName string, start uint64, err error) {
 	if volName, err = extractName(r); err != nil {
 		return
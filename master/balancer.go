@@ -0,0 +1,481 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The balancer moves the replicas of the data partitions from the disks used more than the average
+// of the cluster by the threshold, to the data nodes used less than the average, such as the ones
+// just joined. A replica is moved by adding a new replica, waiting for it to catch up, and then
+// removing the old one. Each data node takes part in one migration at a time.
+//
+// The settings of the balancer are persisted with the cluster, but the migrations are not, so a
+// migration interrupted by the change of the master leader may leave an extra replica.
+
+type balancer struct {
+	sync.RWMutex
+	enabled     bool
+	threshold   float64
+	concurrency int
+	tasks       map[uint64]*proto.BalanceTask // running migrations keyed by partition ID
+	history     []*proto.BalanceTask          // recently finished migrations
+	finished    uint64
+	failed      uint64
+}
+
+func newBalancer(threshold float64, concurrency int) *balancer {
+	return &balancer{
+		threshold:   threshold,
+		concurrency: concurrency,
+		tasks:       make(map[uint64]*proto.BalanceTask),
+	}
+}
+
+func (b *balancer) load(enabled bool, threshold float64, concurrency int) {
+	b.Lock()
+	defer b.Unlock()
+	b.enabled = enabled
+	if threshold > 0 {
+		b.threshold = threshold
+	}
+	if concurrency > 0 {
+		b.concurrency = concurrency
+	}
+}
+
+// balanceNode is the usage of a data node seen by the balancer.
+type balanceNode struct {
+	addr      string
+	nodeSetID uint64
+	usage     float64
+	writable  bool
+	disks     []*proto.DiskReport
+	reports   []*proto.PartitionReport
+}
+
+func (n *balanceNode) hasPartition(partitionID uint64) bool {
+	return hasPartitionReport(n.reports, partitionID)
+}
+
+func hasPartitionReport(reports []*proto.PartitionReport, partitionID uint64) bool {
+	for _, r := range reports {
+		if r.PartitionID == partitionID {
+			return true
+		}
+	}
+	return false
+}
+
+// balanceMove is a replica to be moved from the disk of the source to the destination.
+type balanceMove struct {
+	partitionID uint64
+	src         string
+	srcDisk     string
+	dst         string
+}
+
+func diskUsage(d *proto.DiskReport) float64 {
+	if d.Total == 0 {
+		return 0
+	}
+	return float64(d.Used) / float64(d.Total)
+}
+
+// planBalanceMoves chooses at most max replicas to move. The sources are the disks used more than the
+// average by the threshold, and the most used disks of such nodes, from the most used one. The
+// destinations are the writable nodes used less than the average, preferring the same node set.
+// The busy nodes and partitions are skipped.
+func planBalanceMoves(nodes []*balanceNode, avg, threshold float64, max int,
+	busyNodes map[string]bool, busyPartitions map[uint64]bool) (moves []*balanceMove) {
+	type source struct {
+		node  *balanceNode
+		disk  *proto.DiskReport
+		usage float64
+	}
+	var (
+		sources []*source
+		targets []*balanceNode
+	)
+	for _, n := range nodes {
+		var mostUsed *proto.DiskReport
+		for _, d := range n.disks {
+			if d.Status == proto.Unavailable || d.Total == 0 {
+				continue
+			}
+			if mostUsed == nil || diskUsage(d) > diskUsage(mostUsed) {
+				mostUsed = d
+			}
+			if diskUsage(d) > avg+threshold {
+				sources = append(sources, &source{node: n, disk: d, usage: diskUsage(d)})
+			}
+		}
+		if mostUsed != nil && n.usage > avg+threshold && diskUsage(mostUsed) <= avg+threshold {
+			sources = append(sources, &source{node: n, disk: mostUsed, usage: n.usage})
+		}
+		if n.writable && n.usage < avg {
+			targets = append(targets, n)
+		}
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].usage > sources[j].usage })
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].usage < targets[j].usage })
+
+	chooseTarget := func(src *balanceNode, partitionID uint64) *balanceNode {
+		var other *balanceNode
+		for _, t := range targets {
+			if busyNodes[t.addr] || t.hasPartition(partitionID) {
+				continue
+			}
+			if t.nodeSetID == src.nodeSetID {
+				return t
+			}
+			if other == nil {
+				other = t
+			}
+		}
+		return other
+	}
+
+	for _, s := range sources {
+		if len(moves) >= max {
+			return
+		}
+		if busyNodes[s.node.addr] {
+			continue
+		}
+		reports := make([]*proto.PartitionReport, 0)
+		for _, r := range s.node.reports {
+			if r.DiskPath == s.disk.Path && !busyPartitions[r.PartitionID] {
+				reports = append(reports, r)
+			}
+		}
+		// the larger partitions reduce the skew in fewer moves
+		sort.SliceStable(reports, func(i, j int) bool { return reports[i].Used > reports[j].Used })
+		for _, r := range reports {
+			dst := chooseTarget(s.node, r.PartitionID)
+			if dst == nil {
+				continue
+			}
+			moves = append(moves, &balanceMove{partitionID: r.PartitionID, src: s.node.addr, srcDisk: s.disk.Path, dst: dst.addr})
+			busyNodes[s.node.addr] = true
+			busyNodes[dst.addr] = true
+			busyPartitions[r.PartitionID] = true
+			break
+		}
+	}
+	return
+}
+
+// balanceNodes returns the usage of the active data nodes, and the average usage of them.
+func (c *Cluster) balanceNodes() (nodes []*balanceNode, avg float64) {
+	var total, used uint64
+	c.dataNodes.Range(func(key, value interface{}) bool {
+		dataNode := value.(*DataNode)
+		writable := dataNode.isWriteAble()
+		dataNode.RLock()
+		defer dataNode.RUnlock()
+		if !dataNode.isActive || dataNode.Total == 0 {
+			return true
+		}
+		total += dataNode.Total
+		used += dataNode.Used
+		nodes = append(nodes, &balanceNode{
+			addr:      dataNode.Addr,
+			nodeSetID: dataNode.NodeSetID,
+			usage:     dataNode.UsageRatio,
+			writable:  writable,
+			disks:     dataNode.DiskReports,
+			reports:   dataNode.DataPartitionReports,
+		})
+		return true
+	})
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].addr < nodes[j].addr })
+	if total > 0 {
+		avg = float64(used) / float64(total)
+	}
+	return
+}
+
+func (c *Cluster) scheduleToBalanceDataNodes() {
+	go func() {
+		for {
+			time.Sleep(time.Second * intervalToBalanceDataNodes)
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.balanceDataNodes()
+			}
+		}
+	}()
+}
+
+// balanceDataNodes starts the migrations up to the concurrency of the balancer.
+func (c *Cluster) balanceDataNodes() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.LogWarnf("balanceDataNodes occurred panic,err[%v]", r)
+			WarnBySpecialKey(fmt.Sprintf("%v_%v_scheduling_job_panic", c.Name, ModuleName),
+				"balanceDataNodes occurred panic")
+		}
+	}()
+	b := c.balancer
+	threshold, slots, busyNodes, busyPartitions := b.available()
+	if slots <= 0 {
+		return
+	}
+	nodes, avg := c.balanceNodes()
+	for _, move := range planBalanceMoves(nodes, avg, threshold, slots, busyNodes, busyPartitions) {
+		dp, err := c.getDataPartitionByID(move.partitionID)
+		if err != nil {
+			continue
+		}
+		if err = c.validateBalanceMove(dp, move); err != nil {
+			log.LogWarnf("action[balanceDataNodes] skip partition[%v] from[%v] to[%v], err[%v]",
+				move.partitionID, move.src, move.dst, err)
+			continue
+		}
+		now := time.Now().Unix()
+		task := &proto.BalanceTask{PartitionID: dp.PartitionID, VolName: dp.VolName, Src: move.src, SrcDisk: move.srcDisk,
+			Dst: move.dst, State: proto.BalanceAddingReplica, StartTime: now, UpdateTime: now}
+		if !b.addTask(task) {
+			continue
+		}
+		log.LogInfof("action[balanceDataNodes] start %v, average usage[%v]", task, avg)
+		go c.runBalanceTask(dp, task)
+	}
+}
+
+func (c *Cluster) validateBalanceMove(dp *DataPartition, move *balanceMove) (err error) {
+	dp.RLock()
+	if dp.isEc() {
+		err = fmt.Errorf("erasure-coded partition")
+	} else if dp.isRecover {
+		err = fmt.Errorf("partition is recovering")
+	} else if !dp.hasHost(move.src) || dp.hasHost(move.dst) {
+		err = fmt.Errorf("hosts %v changed", dp.Hosts)
+	} else if len(dp.Hosts) != int(dp.ReplicaNum) {
+		err = fmt.Errorf("hosts %v not match replica num %v", dp.Hosts, dp.ReplicaNum)
+	}
+	dp.RUnlock()
+	if err != nil {
+		return
+	}
+	if !c.hasMediaType(move.dst, dp.MediaType) {
+		return fmt.Errorf("node %v has no disk of media %v", move.dst, dp.MediaType)
+	}
+	return c.validateDecommissionDataPartition(dp, move.src)
+}
+
+// runBalanceTask adds the new replica, waits for it to catch up, and removes the old one.
+func (c *Cluster) runBalanceTask(dp *DataPartition, task *proto.BalanceTask) {
+	var err error
+	defer func() {
+		if err != nil {
+			log.LogErrorf("action[runBalanceTask] %v err[%v]", task, err)
+			c.balancer.finishTask(task, err)
+			return
+		}
+		log.LogInfof("action[runBalanceTask] %v finished", task)
+		c.balancer.finishTask(task, nil)
+	}()
+	if err = c.addDataReplica(dp, task.Dst); err != nil {
+		return
+	}
+	c.balancer.setTaskState(task, proto.BalanceCatchingUp)
+	deadline := time.Now().Add(balanceCatchUpTimeout)
+	for !c.isReplicaCaughtUp(dp, task.Src, task.Dst) {
+		if !c.partition.IsRaftLeader() {
+			err = fmt.Errorf("master leader changed")
+			return
+		}
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("replica not caught up in %v", balanceCatchUpTimeout)
+			// the old replica is kept, so the new one is removed to restore the replica num
+			if e := c.removeDataReplica(dp, task.Dst, false); e != nil {
+				log.LogErrorf("action[runBalanceTask] %v roll back err[%v]", task, e)
+			}
+			return
+		}
+		time.Sleep(time.Second * intervalToCheckBalanceTask)
+	}
+	c.balancer.setTaskState(task, proto.BalanceRemovingReplica)
+	err = c.removeDataReplica(dp, task.Src, true)
+}
+
+// isReplicaCaughtUp returns true if the new replica has been reported by its data node with as many
+// extents and as much data as the old one.
+func (c *Cluster) isReplicaCaughtUp(dp *DataPartition, src, dst string) bool {
+	dataNode, err := c.dataNode(dst)
+	if err != nil {
+		return false
+	}
+	dataNode.RLock()
+	reported := hasPartitionReport(dataNode.DataPartitionReports, dp.PartitionID)
+	dataNode.RUnlock()
+	if !reported {
+		return false
+	}
+	dp.RLock()
+	defer dp.RUnlock()
+	srcReplica, err := dp.getReplica(src)
+	if err != nil {
+		return false
+	}
+	dstReplica, err := dp.getReplica(dst)
+	if err != nil || !dstReplica.isLive(defaultDataPartitionTimeOutSec) {
+		return false
+	}
+	return dstReplica.FileCount >= srcReplica.FileCount && dstReplica.Used+balanceCatchUpSlack >= srcReplica.Used
+}
+
+// available returns the number of the migrations that can be started, and the nodes and partitions
+// taking part in the running ones.
+func (b *balancer) available() (threshold float64, slots int, busyNodes map[string]bool, busyPartitions map[uint64]bool) {
+	b.RLock()
+	defer b.RUnlock()
+	if !b.enabled || len(b.tasks) >= b.concurrency {
+		return
+	}
+	threshold, slots = b.threshold, b.concurrency-len(b.tasks)
+	busyNodes = make(map[string]bool)
+	busyPartitions = make(map[uint64]bool)
+	for _, t := range b.tasks {
+		busyNodes[t.Src] = true
+		busyNodes[t.Dst] = true
+		busyPartitions[t.PartitionID] = true
+	}
+	return
+}
+
+func (b *balancer) addTask(task *proto.BalanceTask) bool {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.tasks[task.PartitionID]; ok || len(b.tasks) >= b.concurrency {
+		return false
+	}
+	b.tasks[task.PartitionID] = task
+	return true
+}
+
+func (b *balancer) setTaskState(task *proto.BalanceTask, state uint8) {
+	b.Lock()
+	defer b.Unlock()
+	task.State = state
+	task.UpdateTime = time.Now().Unix()
+}
+
+func (b *balancer) finishTask(task *proto.BalanceTask, err error) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.tasks, task.PartitionID)
+	task.UpdateTime = time.Now().Unix()
+	if err != nil {
+		task.State = proto.BalanceFailed
+		task.Msg = err.Error()
+		b.failed++
+	} else {
+		task.State = proto.BalanceFinished
+		b.finished++
+	}
+	b.history = append(b.history, task)
+	if len(b.history) > maxBalanceTaskHistory {
+		b.history = b.history[len(b.history)-maxBalanceTaskHistory:]
+	}
+}
+
+func (c *Cluster) startBalancer(b *balancer, threshold float64, concurrency int) (err error) {
+	b.Lock()
+	oldEnabled, oldThreshold, oldConcurrency := b.enabled, b.threshold, b.concurrency
+	b.enabled = true
+	if threshold > 0 {
+		b.threshold = threshold
+	}
+	if concurrency > 0 {
+		b.concurrency = concurrency
+	}
+	b.Unlock()
+	if err = c.syncPutCluster(); err != nil {
+		b.Lock()
+		b.enabled, b.threshold, b.concurrency = oldEnabled, oldThreshold, oldConcurrency
+		b.Unlock()
+		log.LogErrorf("action[startBalancer] err[%v]", err)
+		err = proto.ErrPersistenceByRaft
+	}
+	return
+}
+
+// stopBalancer stops scheduling new migrations, and the running ones go on until they finish.
+func (c *Cluster) stopBalancer(b *balancer) (err error) {
+	b.Lock()
+	oldEnabled := b.enabled
+	b.enabled = false
+	b.Unlock()
+	if err = c.syncPutCluster(); err != nil {
+		b.Lock()
+		b.enabled = oldEnabled
+		b.Unlock()
+		log.LogErrorf("action[stopBalancer] err[%v]", err)
+		err = proto.ErrPersistenceByRaft
+	}
+	return
+}
+
+func (c *Cluster) getBalancerView() (view *proto.BalancerView) {
+	nodes, avg := c.balanceNodes()
+	view = &proto.BalancerView{AvgUsage: avg, Nodes: make([]*proto.BalanceNodeView, 0, len(nodes))}
+	minUsage, maxUsage := 1.0, 0.0
+	for _, n := range nodes {
+		view.Nodes = append(view.Nodes, &proto.BalanceNodeView{Addr: n.addr, UsageRatio: n.usage, Disks: n.disks})
+		for _, d := range n.disks {
+			if d.Status == proto.Unavailable || d.Total == 0 {
+				continue
+			}
+			if u := diskUsage(d); u < minUsage {
+				minUsage = u
+			}
+			if u := diskUsage(d); u > maxUsage {
+				maxUsage = u
+			}
+		}
+	}
+	if maxUsage > minUsage {
+		view.Skew = maxUsage - minUsage
+	}
+	c.balancer.fillView(view)
+	return
+}
+
+// fillView fills the settings and the migrations of the balancer in the view.
+func (b *balancer) fillView(view *proto.BalancerView) {
+	b.RLock()
+	defer b.RUnlock()
+	view.Enabled, view.Threshold, view.Concurrency = b.enabled, b.threshold, b.concurrency
+	view.Finished, view.Failed = b.finished, b.failed
+	view.Tasks = make([]*proto.BalanceTask, 0, len(b.tasks)+len(b.history))
+	for _, t := range b.tasks {
+		task := *t
+		view.Tasks = append(view.Tasks, &task)
+	}
+	sort.Slice(view.Tasks, func(i, j int) bool { return view.Tasks[i].StartTime < view.Tasks[j].StartTime })
+	for _, t := range b.history {
+		task := *t
+		view.Tasks = append(view.Tasks, &task)
+	}
+}
@@ -0,0 +1,88 @@
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestPlanBalanceMoves(t *testing.T) {
+	full := &balanceNode{
+		addr:      "192.168.0.1:6000",
+		nodeSetID: 1,
+		usage:     0.9,
+		disks: []*proto.DiskReport{
+			{Path: "/disk1", Total: 100 * util.GB, Used: 95 * util.GB},
+			{Path: "/disk2", Total: 100 * util.GB, Used: 85 * util.GB},
+		},
+		reports: []*proto.PartitionReport{
+			{PartitionID: 1, DiskPath: "/disk1", Used: 10 * util.GB},
+			{PartitionID: 2, DiskPath: "/disk1", Used: 20 * util.GB},
+			{PartitionID: 3, DiskPath: "/disk2", Used: 30 * util.GB},
+		},
+	}
+	other := &balanceNode{
+		addr:      "192.168.0.2:6000",
+		nodeSetID: 2,
+		usage:     0.1,
+		writable:  true,
+		disks:     []*proto.DiskReport{{Path: "/disk1", Total: 100 * util.GB, Used: 10 * util.GB}},
+	}
+	sameSet := &balanceNode{
+		addr:      "192.168.0.3:6000",
+		nodeSetID: 1,
+		usage:     0.2,
+		writable:  true,
+		disks:     []*proto.DiskReport{{Path: "/disk1", Total: 100 * util.GB, Used: 20 * util.GB}},
+		reports:   []*proto.PartitionReport{{PartitionID: 9, DiskPath: "/disk1", Used: 20 * util.GB}},
+	}
+	nodes := []*balanceNode{full, other, sameSet}
+
+	// the largest partition on the most used disk is moved to the node in the same node set
+	moves := planBalanceMoves(nodes, 0.4, 0.1, 4, make(map[string]bool), make(map[uint64]bool))
+	if len(moves) != 1 {
+		t.Errorf("expect one move for one source node, got %v", len(moves))
+		return
+	}
+	if m := moves[0]; m.partitionID != 2 || m.srcDisk != "/disk1" || m.dst != sameSet.addr {
+		t.Errorf("unexpected move %+v", m)
+		return
+	}
+
+	// the busy nodes and partitions are skipped
+	busyNodes := map[string]bool{sameSet.addr: true}
+	busyPartitions := map[uint64]bool{2: true}
+	moves = planBalanceMoves(nodes, 0.4, 0.1, 4, busyNodes, busyPartitions)
+	if len(moves) != 1 || moves[0].partitionID != 1 || moves[0].dst != other.addr {
+		t.Errorf("unexpected moves %v", moves)
+		return
+	}
+
+	// nothing is moved if the skew is within the threshold
+	if moves = planBalanceMoves(nodes, 0.4, 0.6, 4, make(map[string]bool), make(map[uint64]bool)); len(moves) != 0 {
+		t.Errorf("expect no moves, got %v", len(moves))
+	}
+}
+
+func TestBalancer(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?threshold=%v&concurrency=%v", hostAddr, proto.AdminStartBalancer, 0.2, 2)
+	process(reqURL, t)
+	view := server.cluster.getBalancerView()
+	if !view.Enabled || view.Threshold != 0.2 || view.Concurrency != 2 {
+		t.Errorf("unexpected balancer %+v", view)
+		return
+	}
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%v?threshold=%v", proto.AdminStartBalancer, 2), nil)
+	if _, _, err := parseRequestToStartBalancer(req); err == nil {
+		t.Errorf("expect invalid threshold to fail")
+	}
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminGetBalancer), t)
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminStopBalancer), t)
+	if server.cluster.getBalancerView().Enabled {
+		t.Errorf("expect balancer to be stopped")
+	}
+}
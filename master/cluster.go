@@ -36,6 +36,7 @@ type Cluster struct {
 	createVolMutex      sync.RWMutex // create volume mutex
 	mnMutex             sync.RWMutex // meta node mutex
 	dnMutex             sync.RWMutex // data node mutex
+	snapshotMutex       sync.Mutex   // serializes taking and deleting the snapshots
 	leaderInfo          *LeaderInfo
 	cfg                 *clusterConfig
 	retainLogs          uint64
@@ -46,6 +47,9 @@ type Cluster struct {
 	volStatInfo         sync.Map
 	BadDataPartitionIds *sync.Map
 	DisableAutoAllocate bool
+	balancer            *balancer
+	metaBalancer        *balancer
+	jobs                *jobManager
 	fsm                 *MetadataFsm
 	partition           raftstore.Partition
 }
@@ -58,6 +62,9 @@ func newCluster(name string, leaderInfo *LeaderInfo, fsm *MetadataFsm, partition
 	c.cfg = cfg
 	c.t = newTopology()
 	c.BadDataPartitionIds = new(sync.Map)
+	c.balancer = newBalancer(defaultBalanceThreshold, defaultBalanceConcurrency)
+	c.metaBalancer = newBalancer(defaultBalanceThreshold, defaultMetaBalanceConcurrency)
+	c.jobs = newJobManager()
 	c.dataNodeStatInfo = new(nodeStatInfo)
 	c.metaNodeStatInfo = new(nodeStatInfo)
 	c.fsm = fsm
@@ -78,6 +85,11 @@ func (c *Cluster) scheduleTask() {
 	c.scheduleToCheckDiskRecoveryProgress()
 	c.scheduleToLoadMetaPartitions()
 	c.scheduleToReduceReplicaNum()
+	c.scheduleToSplitLargeDirs()
+	c.scheduleToBalanceDataNodes()
+	c.scheduleToBalanceMetaNodes()
+	c.scheduleToRunJobs()
+	c.scheduleToTakeSnapshots()
 }
 
 func (c *Cluster) masterAddr() (addr string) {
@@ -480,12 +492,33 @@ func (c *Cluster) markDeleteVol(name, authKey string) (err error) {
 // - If succeeded, replicate the data through raft and persist it to RocksDB.
 // - Otherwise, throw errors
 func (c *Cluster) createDataPartition(volName string) (dp *DataPartition, err error) {
+	return c.doCreateDataPartition(volName, false, false)
+}
+
+// Synchronously create an erasure-coded data partition with the erasure code params of the volume,
+// whose hosts keep the data shards and the parity shards in order.
+func (c *Cluster) createEcDataPartition(volName string) (dp *DataPartition, err error) {
+	return c.doCreateDataPartition(volName, true, false)
+}
+
+// Synchronously create a data partition on the disks of the cold media class of the volume.
+func (c *Cluster) createColdDataPartition(volName string) (dp *DataPartition, err error) {
+	return c.doCreateDataPartition(volName, false, true)
+}
+
+func (c *Cluster) doCreateDataPartition(volName string, isEc, isCold bool) (dp *DataPartition, err error) {
 	var (
 		vol         *Vol
 		partitionID uint64
 		targetHosts []string
 		targetPeers []proto.Peer
 		wg          sync.WaitGroup
+		replicaNum  uint8
+		ecDataNum   uint8
+		ecParityNum uint8
+		mediaType   string
+		coldMedia   string
+		errChannel  chan error
 	)
 
 	if vol, err = c.getVol(volName); err != nil {
@@ -493,14 +526,33 @@ func (c *Cluster) createDataPartition(volName string) (dp *DataPartition, err er
 	}
 	vol.createDpMutex.Lock()
 	defer vol.createDpMutex.Unlock()
-	errChannel := make(chan error, vol.dpReplicaNum)
-	if targetHosts, targetPeers, err = c.chooseTargetDataNodes(nil, nil, nil, int(vol.dpReplicaNum)); err != nil {
+	replicaNum = vol.dpReplicaNum
+	if isEc {
+		if ecDataNum, ecParityNum = vol.ecParams(); ecDataNum == 0 {
+			err = fmt.Errorf("erasure code of vol[%v] is not enabled", volName)
+			goto errHandler
+		}
+		replicaNum = ecDataNum + ecParityNum
+	}
+	if mediaType, coldMedia = vol.tierParams(); isCold {
+		if coldMedia == "" {
+			err = fmt.Errorf("cold tier of vol[%v] is not enabled", volName)
+			goto errHandler
+		}
+		mediaType = coldMedia
+	}
+	errChannel = make(chan error, replicaNum)
+	if targetHosts, targetPeers, err = c.chooseTargetDataNodes(nil, nil, c.hostsWithoutMediaType(mediaType), int(replicaNum)); err != nil {
 		goto errHandler
 	}
 	if partitionID, err = c.idAlloc.allocateDataPartitionID(); err != nil {
 		goto errHandler
 	}
-	dp = newDataPartition(partitionID, vol.dpReplicaNum, volName, vol.ID)
+	dp = newDataPartition(partitionID, replicaNum, volName, vol.ID)
+	dp.EcDataNum = ecDataNum
+	dp.EcParityNum = ecParityNum
+	dp.MediaType = mediaType
+	dp.Cold = isCold
 	dp.Hosts = targetHosts
 	dp.Peers = targetPeers
 	for _, host := range targetHosts {
@@ -648,25 +700,21 @@ func (c *Cluster) getAllMetaPartitionIDByMetaNode(addr string) (partitionIDs []u
 	return
 }
 
-func (c *Cluster) decommissionDataNode(dataNode *DataNode) (err error) {
-	msg := fmt.Sprintf("action[decommissionDataNode], Node[%v] OffLine", dataNode.Addr)
-	log.LogWarn(msg)
-	safeVols := c.allVols()
-	for _, vol := range safeVols {
-		for _, dp := range vol.dataPartitions.partitions {
-			if err = c.decommissionDataPartition(dataNode.Addr, dp, dataNodeOfflineErr); err != nil {
-				return
-			}
-		}
+// deleteDataNode removes the data node decommissioned from the cluster.
+func (c *Cluster) deleteDataNode(addr string) (err error) {
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		// removed by the run before the change of the leader
+		return nil
 	}
 	if err = c.syncDeleteDataNode(dataNode); err != nil {
-		msg = fmt.Sprintf("action[decommissionDataNode],clusterID[%v] Node[%v] OffLine failed,err[%v]",
+		msg := fmt.Sprintf("action[decommissionDataNode],clusterID[%v] Node[%v] OffLine failed,err[%v]",
 			c.Name, dataNode.Addr, err)
 		Warn(c.Name, msg)
 		return
 	}
 	c.delDataNodeFromCache(dataNode)
-	msg = fmt.Sprintf("action[decommissionDataNode],clusterID[%v] Node[%v] OffLine success",
+	msg := fmt.Sprintf("action[decommissionDataNode],clusterID[%v] Node[%v] OffLine success",
 		c.Name, dataNode.Addr)
 	Warn(c.Name, msg)
 	return
@@ -690,13 +738,14 @@ func (c *Cluster) delDataNodeFromCache(dataNode *DataNode) {
 // 6. persistent the new host list
 func (c *Cluster) decommissionDataPartition(offlineAddr string, dp *DataPartition, errMsg string) (err error) {
 	var (
-		targetHosts []string
-		newAddr     string
-		msg         string
-		dataNode    *DataNode
-		rack        *Rack
-		replica     *DataReplica
-		ns          *nodeSet
+		targetHosts  []string
+		newAddr      string
+		msg          string
+		dataNode     *DataNode
+		rack         *Rack
+		replica      *DataReplica
+		ns           *nodeSet
+		excludeHosts []string
 	)
 	dp.RLock()
 	if ok := dp.hasHost(offlineAddr); !ok {
@@ -704,6 +753,8 @@ func (c *Cluster) decommissionDataPartition(offlineAddr string, dp *DataPartitio
 		return
 	}
 	replica, _ = dp.getReplica(offlineAddr)
+	// the new replica is placed on the disks of the same media class
+	excludeHosts = append(c.hostsWithoutMediaType(dp.MediaType), dp.Hosts...)
 	dp.RUnlock()
 	if err = c.validateDecommissionDataPartition(dp, offlineAddr); err != nil {
 		goto errHandler
@@ -720,24 +771,30 @@ func (c *Cluster) decommissionDataPartition(offlineAddr string, dp *DataPartitio
 	if rack, err = c.t.getRack(dataNode); err != nil {
 		goto errHandler
 	}
-	if targetHosts, _, err = rack.getAvailDataNodeHosts(dp.Hosts, 1); err != nil {
+	if targetHosts, _, err = rack.getAvailDataNodeHosts(excludeHosts, 1); err != nil {
 		if ns, err = c.t.getNodeSet(dataNode.NodeSetID); err != nil {
 			goto errHandler
 		}
 		// select data nodes from the other rack in same node set
-		if targetHosts, _, err = ns.getAvailDataNodeHosts(rack, dp.Hosts, 1); err != nil {
+		if targetHosts, _, err = ns.getAvailDataNodeHosts(rack, excludeHosts, 1); err != nil {
 			// select data nodes from the other node set
-			if targetHosts, _, err = c.chooseTargetDataNodes(ns, rack, dp.Hosts, 1); err != nil {
+			if targetHosts, _, err = c.chooseTargetDataNodes(ns, rack, excludeHosts, 1); err != nil {
 				goto errHandler
 			}
 		}
 	}
-	if err = c.removeDataReplica(dp, offlineAddr, false); err != nil {
-		goto errHandler
-	}
 	newAddr = targetHosts[0]
-	if err = c.addDataReplica(dp, newAddr); err != nil {
-		goto errHandler
+	if dp.isEc() {
+		if err = c.replaceEcDataReplica(dp, offlineAddr, newAddr); err != nil {
+			goto errHandler
+		}
+	} else {
+		if err = c.removeDataReplica(dp, offlineAddr, false); err != nil {
+			goto errHandler
+		}
+		if err = c.addDataReplica(dp, newAddr); err != nil {
+			goto errHandler
+		}
 	}
 	dp.Status = proto.ReadOnly
 	dp.isRecover = true
@@ -763,7 +820,11 @@ func (c *Cluster) validateDecommissionDataPartition(dp *DataPartition, offlineAd
 		return
 	}
 
-	if err = dp.hasMissingOneReplica(int(vol.dpReplicaNum)); err != nil {
+	replicaNum := vol.dpReplicaNum
+	if dp.isEc() {
+		replicaNum = dp.ReplicaNum
+	}
+	if err = dp.hasMissingOneReplica(int(replicaNum)); err != nil {
 		return
 	}
 
@@ -914,6 +975,11 @@ func (c *Cluster) removeDataReplica(dp *DataPartition, addr string, validate boo
 		err = fmt.Errorf("vol[%v],data partition[%v] can't decommision util it has recovered", dp.VolName, dp.PartitionID)
 		return
 	}
+	// a host of an erasure-coded partition can only be replaced, since the others keep their shards in order
+	if dp.isEc() && len(dp.Hosts) <= int(dp.ReplicaNum) {
+		err = fmt.Errorf("vol[%v],erasure-coded data partition[%v] can't remove replica without a new one", dp.VolName, dp.PartitionID)
+		return
+	}
 	dataNode, err := c.dataNode(addr)
 	if err != nil {
 		return
@@ -981,6 +1047,9 @@ func (c *Cluster) removeDataPartitionRaftMember(dp *DataPartition, removePeer pr
 		}
 		newHosts = append(newHosts, host)
 	}
+	if dp.isEc() {
+		newHosts = dp.ecHostsAfterRemoval(removePeer.Addr)
+	}
 	newPeers := make([]proto.Peer, 0, len(dp.Peers)-1)
 	for _, peer := range dp.Peers {
 		if peer.ID == removePeer.ID && peer.Addr == removePeer.Addr {
@@ -1028,26 +1097,21 @@ func (c *Cluster) putBadDataPartitionIDs(replica *DataReplica, offlineAddr strin
 	c.BadDataPartitionIds.Store(key, newBadPartitionIDs)
 }
 
-func (c *Cluster) decommissionMetaNode(metaNode *MetaNode) (err error) {
-	msg := fmt.Sprintf("action[decommissionMetaNode],clusterID[%v] Node[%v] begin", c.Name, metaNode.Addr)
-	log.LogWarn(msg)
-	safeVols := c.allVols()
-	for _, vol := range safeVols {
-		for _, mp := range vol.MetaPartitions {
-			// err is not handled here.
-			if err = c.decommissionMetaPartition(metaNode.Addr, mp); err != nil {
-				return
-			}
-		}
+// deleteMetaNode removes the meta node decommissioned from the cluster.
+func (c *Cluster) deleteMetaNode(addr string) (err error) {
+	metaNode, err := c.metaNode(addr)
+	if err != nil {
+		// removed by the run before the change of the leader
+		return nil
 	}
 	if err = c.syncDeleteMetaNode(metaNode); err != nil {
-		msg = fmt.Sprintf("action[decommissionMetaNode],clusterID[%v] Node[%v] OffLine failed,err[%v]",
+		msg := fmt.Sprintf("action[decommissionMetaNode],clusterID[%v] Node[%v] OffLine failed,err[%v]",
 			c.Name, metaNode.Addr, err)
 		Warn(c.Name, msg)
 		return
 	}
 	c.deleteMetaNodeFromCache(metaNode)
-	msg = fmt.Sprintf("action[decommissionMetaNode],clusterID[%v] Node[%v] OffLine success", c.Name, metaNode.Addr)
+	msg := fmt.Sprintf("action[decommissionMetaNode],clusterID[%v] Node[%v] OffLine success", c.Name, metaNode.Addr)
 	Warn(c.Name, msg)
 	return
 }
@@ -1110,6 +1174,37 @@ errHandler:
 	return
 }
 
+func (c *Cluster) setVolTrash(name, authKey string, retention uint32) (err error) {
+	var (
+		vol          *Vol
+		oldRetention uint32
+	)
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[setVolTrash] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	oldRetention = vol.TrashRetention
+	vol.TrashRetention = retention
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.TrashRetention = oldRetention
+		log.LogErrorf("action[setVolTrash] vol[%v] err[%v]", name, err)
+		err = proto.ErrPersistenceByRaft
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[setVolTrash], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
 // Create a new volume.
 // By default we create 3 meta partitions and 10 data partitions during initialization.
 func (c *Cluster) createVol(name, owner string, mpCount, size, capacity int, followerRead bool) (vol *Vol, err error) {
@@ -37,6 +37,14 @@ const (
 	cfgMetaNodeReservedMem              = "metaNodeReservedMem"
 	heartbeatPortKey                    = "heartbeatPort"
 	replicaPortKey                      = "replicaPort"
+	// if enabled, requests must carry a ticket issued by authnode for the master service
+	cfgAuthenticate = "authenticate"
+	// the base64 encoded key of the master service in authnode
+	cfgServiceKey = "serviceKey"
+	// authnode addresses, to get the tickets of the metanodes and datanodes which authenticate the tasks
+	cfgAuthNodes = "authNodes"
+	cfgClientID  = "clientID"
+	cfgClientKey = "clientKey"
 )
 
 //default value
@@ -36,12 +36,27 @@ const (
 	volAuthKey            = "authKey"
 	replicaNumKey         = "replicaNum"
 	followerReadKey       = "followerRead"
+	inodeKey              = "inode"
+	maxFilesKey           = "maxFiles"
+	maxBytesKey           = "maxBytes"
+	snapshotKey           = "snapshot"
+	trashRetentionKey     = "retention"
+	ecKey                 = "ec"
+	ecDataNumKey          = "dataNum"
+	ecParityNumKey        = "parityNum"
+	ecMigrateDaysKey      = "migrateDays"
+	coldKey               = "cold"
+	mediaTypeKey          = "mediaType"
+	coldMediaTypeKey      = "coldMediaType"
+	coldAfterDaysKey      = "coldAfterDays"
+	concurrencyKey        = "concurrency"
 )
 
 const (
 	deleteIllegalReplicaErr       = "deleteIllegalReplicaErr "
 	addMissingReplicaErr          = "addMissingReplicaErr "
 	checkDataPartitionDiskErr     = "checkDataPartitionDiskErr  "
+	checkDataPartitionBadExtents  = "checkDataPartitionBadExtents "
 	getAvailDataNodeHostsErr      = "getAvailDataNodeHostsErr "
 	getAvailMetaNodeHostsErr      = "getAvailMetaNodeHostsErr "
 	dataNodeOfflineErr            = "dataNodeOfflineErr "
@@ -79,6 +94,20 @@ const (
 	EmptyCrcValue                         uint32 = 4045511210
 	DefaultRackName                              = "default"
 	retrySendSyncTaskInternal                    = 3 * time.Second
+	defaultDirShardCount                         = 4
+	intervalToSplitLargeDirs                     = 60
+	defaultBalanceThreshold                      = 0.1
+	defaultBalanceConcurrency                    = 4
+	intervalToBalanceDataNodes                   = 60
+	defaultMetaBalanceConcurrency                = 2
+	intervalToBalanceMetaNodes                   = 60
+	intervalToCheckBalanceTask                   = 10
+	balanceCatchUpTimeout                        = 12 * time.Hour
+	balanceCatchUpSlack                          = 64 * util.MB
+	maxBalanceTaskHistory                        = 100
+	intervalToRunJobs                            = 5
+	intervalToTakeSnapshots                      = 10
+	maxJobHistory                                = 100
 )
 
 const (
@@ -107,6 +136,9 @@ const (
 	opSyncAddNodeSet           uint32 = 0x12
 	opSyncUpdateNodeSet        uint32 = 0x13
 	opSyncBatchPut             uint32 = 0x14
+	opSyncAddJob               uint32 = 0x15
+	opSyncUpdateJob            uint32 = 0x16
+	opSyncDeleteJob            uint32 = 0x17
 )
 
 const (
@@ -118,6 +150,7 @@ const (
 	volAcronym            = "vol"
 	clusterAcronym        = "c"
 	nodeSetAcronym        = "s"
+	jobAcronym            = "job"
 	maxDataPartitionIDKey = keySeparator + "max_dp_id"
 	maxMetaPartitionIDKey = keySeparator + "max_mp_id"
 	maxCommonIDKey        = keySeparator + "max_common_id"
@@ -128,4 +161,5 @@ const (
 	metaPartitionPrefix   = keySeparator + metaPartitionAcronym + keySeparator
 	clusterPrefix         = keySeparator + clusterAcronym + keySeparator
 	nodeSetPrefix         = keySeparator + nodeSetAcronym + keySeparator
+	jobPrefix             = keySeparator + jobAcronym + keySeparator
 )
@@ -43,6 +43,7 @@ type DataNode struct {
 	NodeSetID                 uint64
 	PersistenceDataPartitions []uint64
 	BadDisks                  []string
+	DiskReports               []*proto.DiskReport
 }
 
 func newDataNode(addr, clusterID string) (dataNode *DataNode) {
@@ -50,7 +51,7 @@ func newDataNode(addr, clusterID string) (dataNode *DataNode) {
 	dataNode.Carry = rand.Float64()
 	dataNode.Total = 1
 	dataNode.Addr = addr
-	dataNode.TaskManager = newAdminTaskManager(dataNode.Addr, clusterID)
+	dataNode.TaskManager = newAdminTaskManager(dataNode.Addr, clusterID, proto.DataServiceID)
 	return
 }
 
@@ -87,6 +88,7 @@ func (dataNode *DataNode) updateNodeMetric(resp *proto.DataNodeHeartbeatResponse
 	dataNode.DataPartitionCount = resp.CreatedPartitionCnt
 	dataNode.DataPartitionReports = resp.PartitionReports
 	dataNode.BadDisks = resp.BadDisks
+	dataNode.DiskReports = resp.DiskReports
 	if dataNode.Total == 0 {
 		dataNode.UsageRatio = 0.0
 	} else {
@@ -15,6 +15,7 @@ func TestDataNode(t *testing.T) {
 	time.Sleep(5 * time.Second)
 	getDataNodeInfo(addr, t)
 	decommissionDataNode(addr, t)
+	waitForJobs(t)
 	_, err := server.cluster.dataNode(addr)
 	if err == nil {
 		t.Errorf("decommission datanode [%v] failed", addr)
@@ -47,6 +47,10 @@ type DataPartition struct {
 	lastWarnTime            int64
 	FileInCoreMap           map[string]*FileInCore
 	FilesWithMissingReplica map[string]int64 // key: file name, value: last time when a missing replica is found
+	EcDataNum               uint8            // the partition is erasure-coded if it is not zero, and its hosts are in the order of the shards
+	EcParityNum             uint8
+	MediaType               string // media class of the disks of the replicas, any if empty
+	Cold                    bool   // the partition is in the cold tier of the volume
 }
 
 func newDataPartition(ID uint64, replicaNum uint8, volName string, volID uint64) (partition *DataPartition) {
@@ -121,7 +125,8 @@ func (partition *DataPartition) createTaskToRemoveRaftMember(removePeer proto.Pe
 func (partition *DataPartition) createTaskToCreateDataPartition(addr string, dataPartitionSize uint64, peers []proto.Peer, hosts []string, createType int) (task *proto.AdminTask) {
 
 	task = proto.NewAdminTask(proto.OpCreateDataPartition, addr, newCreateDataPartitionRequest(
-		partition.VolName, partition.PartitionID, peers, int(dataPartitionSize), hosts, createType))
+		partition.VolName, partition.PartitionID, peers, int(dataPartitionSize), hosts, createType,
+		partition.EcDataNum, partition.EcParityNum, partition.MediaType))
 	partition.resetTaskID(task)
 	return
 }
@@ -265,6 +270,10 @@ func (partition *DataPartition) convertToDataPartitionResponse() (dpr *proto.Dat
 	dpr.Hosts = make([]string, len(partition.Hosts))
 	copy(dpr.Hosts, partition.Hosts)
 	dpr.LeaderAddr = partition.getLeaderAddr()
+	dpr.EcDataNum = partition.EcDataNum
+	dpr.EcParityNum = partition.EcParityNum
+	dpr.MediaType = partition.MediaType
+	dpr.Cold = partition.Cold
 	return
 }
 
@@ -379,7 +388,7 @@ func (partition *DataPartition) checkReplicaNum(c *Cluster, vol *Vol) {
 		Warn(c.Name, msg)
 	}
 
-	if vol.dpReplicaNum != partition.ReplicaNum && !vol.NeedToLowerReplica {
+	if !partition.isEc() && vol.dpReplicaNum != partition.ReplicaNum && !vol.NeedToLowerReplica {
 		vol.NeedToLowerReplica = true
 	}
 }
@@ -521,6 +530,7 @@ func (partition *DataPartition) updateMetric(vr *proto.PartitionReport, dataNode
 	replica.setAlive()
 	replica.IsLeader = vr.IsLeader
 	replica.NeedsToCompare = vr.NeedCompare
+	replica.BadExtentCount = vr.BadExtentCount
 	if replica.DiskPath != vr.DiskPath && vr.DiskPath != "" {
 		oldDiskPath := replica.DiskPath
 		replica.DiskPath = vr.DiskPath
@@ -166,6 +166,22 @@ func (partition *DataPartition) checkDiskError(clusterID, leaderAddr string) (di
 	return
 }
 
+// checkBadExtents alarms the replicas with the corrupt blocks that the scrubber of the data node failed to repair
+// from the other replicas, which are to be decommissioned.
+func (partition *DataPartition) checkBadExtents(clusterID, leaderAddr string) {
+	partition.RLock()
+	defer partition.RUnlock()
+	for _, replica := range partition.Replicas {
+		if replica.BadExtentCount == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("action[%v],clusterID[%v],partitionID:%v  On :%v  %v extents corrupt and not repaired",
+			checkDataPartitionBadExtents, clusterID, partition.PartitionID, replica.Addr, replica.BadExtentCount)
+		msg = msg + fmt.Sprintf(" decommissionDataPartitionURL is http://%v/dataPartition/decommission?id=%v&addr=%v", leaderAddr, partition.PartitionID, replica.Addr)
+		Warn(clusterID, msg)
+	}
+}
+
 func (partition *DataPartition) checkReplicationTask(clusterID string, dataPartitionSize uint64) (tasks []*proto.AdminTask) {
 	var msg string
 	tasks = make([]*proto.AdminTask, 0)
@@ -33,6 +33,7 @@ type DataReplica struct {
 	IsLeader        bool
 	NeedsToCompare  bool
 	DiskPath        string
+	BadExtentCount  int // extents with the corrupt blocks the data node failed to repair
 }
 
 func newDataReplica(dataNode *DataNode) (replica *DataReplica) {
@@ -0,0 +1,219 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A directory is split when the leader of the partition of its inode reports it has too many entries.
+// The shards are recorded in the volume only after the directory inode is marked by the meta partition,
+// which rejects the entries created in it afterwards by the clients not aware of the shards yet, and
+// replies the shards along with the rejection. So the clients do not wait for the shards to be recorded
+// here, nor fail if the recording does. A directory split already keeps its shards, which are recorded
+// instead of the chosen ones.
+
+func (vol *Vol) dirShardList() (shards []*proto.DirShardInfo) {
+	shards = make([]*proto.DirShardInfo, 0, len(vol.dirShards))
+	for ino, pids := range vol.dirShards {
+		shards = append(shards, &proto.DirShardInfo{Inode: ino, PartitionIDs: pids})
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].Inode < shards[j].Inode })
+	return
+}
+
+func (vol *Vol) loadDirShards(shards []*proto.DirShardInfo) {
+	for _, s := range shards {
+		vol.dirShards[s.Inode] = s.PartitionIDs
+	}
+}
+
+// getDirShards returns the sharded directories of the volume sorted by inode.
+func (vol *Vol) getDirShards() []*proto.DirShardInfo {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.dirShardList()
+}
+
+func (vol *Vol) isDirSharded(ino uint64) bool {
+	vol.RLock()
+	defer vol.RUnlock()
+	_, ok := vol.dirShards[ino]
+	return ok
+}
+
+// chooseDirShards returns the partitions of the shards of the directory, the first of which is the
+// partition of the directory inode. The others are the writable partitions of the volume, starting
+// from a position decided by the inode so that the shards of different directories are spread.
+func (vol *Vol) chooseDirShards(ino uint64, count int) (pids []uint64, err error) {
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	var (
+		home       *MetaPartition
+		candidates []uint64
+	)
+	for _, mp := range vol.MetaPartitions {
+		if mp.Start <= ino && ino <= mp.End {
+			home = mp
+			continue
+		}
+		if mp.Status == proto.ReadWrite {
+			candidates = append(candidates, mp.PartitionID)
+		}
+	}
+	if home == nil {
+		return nil, proto.ErrMetaPartitionNotExists
+	}
+	if count > len(candidates)+1 {
+		count = len(candidates) + 1
+	}
+	if count < 2 {
+		return nil, fmt.Errorf("no enough writable meta partitions to split the directory")
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+	pids = append(pids, home.PartitionID)
+	offset := int(ino % uint64(len(candidates)))
+	for i := 0; i < count-1; i++ {
+		pids = append(pids, candidates[(offset+i)%len(candidates)])
+	}
+	return
+}
+
+func (mp *MetaPartition) createTaskToSplitDir(ino uint64, pids []uint64) (t *proto.AdminTask, err error) {
+	mr, err := mp.getMetaReplicaLeader()
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	req := &proto.SplitDirRequest{PartitionID: mp.PartitionID, Inode: ino, PartitionIDs: pids}
+	t = proto.NewAdminTask(proto.OpMetaSplitDir, mr.Addr, req)
+	resetMetaPartitionTaskID(t, mp.PartitionID)
+	return
+}
+
+func (c *Cluster) splitDir(vol *Vol, ino uint64, count int) (pids []uint64, err error) {
+	var (
+		mp       *MetaPartition
+		task     *proto.AdminTask
+		metaNode *MetaNode
+		packet   *proto.Packet
+		info     = new(proto.DirShardInfo)
+	)
+	if vol.isDirSharded(ino) {
+		return nil, fmt.Errorf("directory[%v] is already split", ino)
+	}
+	if count <= 0 {
+		count = defaultDirShardCount
+	}
+	if pids, err = vol.chooseDirShards(ino, count); err != nil {
+		goto errHandler
+	}
+	if mp, err = vol.metaPartition(pids[0]); err != nil {
+		goto errHandler
+	}
+	mp.RLock()
+	task, err = mp.createTaskToSplitDir(ino, pids)
+	mp.RUnlock()
+	if err != nil {
+		goto errHandler
+	}
+	if metaNode, err = c.metaNode(task.OperatorAddr); err != nil {
+		goto errHandler
+	}
+	if packet, err = metaNode.Sender.syncSendAdminTask(task); err != nil {
+		goto errHandler
+	}
+	// the metanodes of the earlier versions reply no shards
+	if len(packet.Data) > 0 {
+		if err = json.Unmarshal(packet.Data, info); err != nil {
+			goto errHandler
+		}
+	}
+	if len(info.PartitionIDs) > 0 {
+		pids = info.PartitionIDs
+	}
+	if err = c.putDirShards(vol, ino, pids); err != nil {
+		goto errHandler
+	}
+	vol.updateViewCache(c)
+	log.LogInfof("action[splitDir] vol[%v] ino[%v] shards%v", vol.Name, ino, pids)
+	return
+errHandler:
+	err = fmt.Errorf("action[splitDir], clusterID[%v] name:%v, ino:%v, err:%v ", c.Name, vol.Name, ino, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (c *Cluster) splitVolDir(name, authKey string, ino uint64, count int) (pids []uint64, err error) {
+	var vol *Vol
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[splitVolDir] err[%v]", err)
+		return nil, proto.ErrVolNotExists
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	return c.splitDir(vol, ino, count)
+}
+
+func (c *Cluster) putDirShards(vol *Vol, ino uint64, pids []uint64) (err error) {
+	vol.Lock()
+	defer vol.Unlock()
+	vol.dirShards[ino] = pids
+	if err = c.syncUpdateVol(vol); err != nil {
+		delete(vol.dirShards, ino)
+		log.LogErrorf("action[putDirShards] vol[%v] err[%v]", vol.Name, err)
+		err = proto.ErrPersistenceByRaft
+	}
+	return
+}
+
+func (c *Cluster) scheduleToSplitLargeDirs() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.splitLargeDirs()
+			}
+			time.Sleep(time.Second * intervalToSplitLargeDirs)
+		}
+	}()
+}
+
+// splitLargeDirs splits the directories reported by the leaders of the meta partitions.
+func (c *Cluster) splitLargeDirs() {
+	for _, vol := range c.allVols() {
+		if vol.status() == markDelete {
+			continue
+		}
+		for _, mp := range vol.cloneMetaPartitionMap() {
+			mp.RLock()
+			largeDirs := mp.largeDirs
+			mp.RUnlock()
+			for _, ino := range largeDirs {
+				if vol.isDirSharded(ino) {
+					continue
+				}
+				c.splitDir(vol, ino, defaultDirShardCount)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestSplitDir(t *testing.T) {
+	name := "dirShardVol"
+	vol := newVol(10002, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	addr := "127.0.0.1:8110"
+	addMetaServer(addr)
+	time.Sleep(time.Second)
+	metaNode, err := server.cluster.metaNode(addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := uint64(1); i <= 3; i++ {
+		mp := newMetaPartition(10020+i, (i-1)*defaultMetaPartitionInodeIDStep+1, i*defaultMetaPartitionInodeIDStep, 3, name, vol.ID)
+		mp.Status = proto.ReadWrite
+		mr := newMetaReplica(mp.Start, mp.End, metaNode)
+		mr.IsLeader = true
+		mp.addReplica(mr)
+		vol.addMetaPartition(mp)
+	}
+	server.cluster.putVol(vol)
+
+	ino := defaultMetaPartitionInodeIDStep + 10
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&inode=%v",
+		hostAddr, proto.AdminSplitDir, name, buildAuthKey("cfs"), ino)
+	if reply := process(reqURL, t); reply == nil {
+		return
+	}
+	shards := vol.getDirShards()
+	if len(shards) != 1 || shards[0].Inode != ino {
+		t.Errorf("unexpected shards %v", shards)
+		return
+	}
+	// the shards are capped by the partitions of the volume, and start from the partition of the inode
+	if pids := shards[0].PartitionIDs; len(pids) != 3 || pids[0] != 10022 {
+		t.Errorf("unexpected partitions of shards %v", pids)
+		return
+	}
+	if _, err = server.cluster.splitVolDir(name, buildAuthKey("cfs"), ino, 0); err == nil {
+		t.Errorf("expect splitting the directory twice to fail")
+		return
+	}
+	// the shards kept by the meta partition are recorded, if the master failed to record them before
+	vol.Lock()
+	delete(vol.dirShards, ino)
+	vol.Unlock()
+	if _, err = server.cluster.splitVolDir(name, buildAuthKey("cfs"), ino, 2); err != nil {
+		t.Errorf("split the directory again: %v", err)
+		return
+	}
+	if shards = vol.getDirShards(); len(shards) != 1 || len(shards[0].PartitionIDs) != 3 || shards[0].PartitionIDs[0] != 10022 {
+		t.Errorf("expect the shards kept by the meta partition, got %v", shards)
+		return
+	}
+
+	// the directories reported by the leaders are split automatically
+	mp, _ := vol.metaPartition(10021)
+	mp.largeDirs = []uint64{5}
+	server.cluster.splitLargeDirs()
+	if !vol.isDirSharded(5) {
+		t.Errorf("expect directory[5] to be split")
+		return
+	}
+	vol.updateViewCache(server.cluster)
+	if len(vol.getDirShards()) != 2 {
+		t.Errorf("unexpected shards %v", vol.getDirShards())
+	}
+}
@@ -77,18 +77,3 @@ func (c *Cluster) checkDiskRecoveryProgress() {
 		return true
 	})
 }
-
-func (c *Cluster) decommissionDisk(dataNode *DataNode, badDiskPath string, badPartitions []*DataPartition) (err error) {
-	msg := fmt.Sprintf("action[decommissionDisk], Node[%v] OffLine,disk[%v]", dataNode.Addr, badDiskPath)
-	log.LogWarn(msg)
-
-	for _, dp := range badPartitions {
-		if err = c.decommissionDataPartition(dataNode.Addr, dp, diskOfflineErr); err != nil {
-			return
-		}
-	}
-	msg = fmt.Sprintf("action[decommissionDisk],clusterID[%v] Node[%v] OffLine success",
-		c.Name, dataNode.Addr)
-	Warn(c.Name, msg)
-	return
-}
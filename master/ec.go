@@ -0,0 +1,143 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/ec"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The extents of a volume with the erasure code enabled are converted to the erasure-coded data partitions
+// by the metanodes once they are not modified for the days of the policy. The i-th host of an erasure-coded
+// data partition keeps the i-th shard, so the order of the hosts is kept when a host is decommissioned,
+// and the shards on the new host are reconstructed from the others on the task of the master.
+
+func (partition *DataPartition) isEc() bool {
+	return partition.EcDataNum > 0
+}
+
+func (vol *Vol) ecParams() (dataNum, parityNum uint8) {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.EcDataNum, vol.EcParityNum
+}
+
+func (c *Cluster) setVolEc(name, authKey string, dataNum, parityNum uint8, migrateDays uint32) (err error) {
+	var (
+		vol                      *Vol
+		oldDataNum, oldParityNum uint8
+		oldMigrateDays           uint32
+	)
+	if migrateDays > 0 {
+		if err = ec.CheckParams(int(dataNum), int(parityNum)); err != nil {
+			return
+		}
+	}
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[setVolEc] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	oldDataNum, oldParityNum, oldMigrateDays = vol.EcDataNum, vol.EcParityNum, vol.EcMigrateDays
+	// the params of the existing erasure-coded data partitions are kept by themselves
+	if migrateDays > 0 {
+		vol.EcDataNum, vol.EcParityNum = dataNum, parityNum
+	}
+	vol.EcMigrateDays = migrateDays
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.EcDataNum, vol.EcParityNum, vol.EcMigrateDays = oldDataNum, oldParityNum, oldMigrateDays
+		log.LogErrorf("action[setVolEc] vol[%v] err[%v]", name, err)
+		err = proto.ErrPersistenceByRaft
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[setVolEc], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+// Returns the hosts of the erasure-coded data partition after removing the given one. The last host,
+// which is the one added by the decommission, takes the place of the removed one.
+func (partition *DataPartition) ecHostsAfterRemoval(removeAddr string) (newHosts []string) {
+	newHosts = make([]string, len(partition.Hosts))
+	copy(newHosts, partition.Hosts)
+	last := len(newHosts) - 1
+	for i, host := range newHosts {
+		if host == removeAddr {
+			newHosts[i] = newHosts[last]
+			break
+		}
+	}
+	return newHosts[:last]
+}
+
+// Replace the offline host of the erasure-coded data partition with the new one. The new host is added
+// before the offline one is removed, so that the hosts are always in the order of the shards.
+func (c *Cluster) replaceEcDataReplica(dp *DataPartition, offlineAddr, newAddr string) (err error) {
+	if err = c.addDataReplica(dp, newAddr); err != nil {
+		return
+	}
+	if err = c.removeDataReplica(dp, offlineAddr, false); err != nil {
+		return
+	}
+	return c.syncReconstructEcDataPartition(dp, newAddr)
+}
+
+func (partition *DataPartition) createTaskToReconstructEc(addr string) (task *proto.AdminTask) {
+	hosts := make([]string, len(partition.Hosts))
+	copy(hosts, partition.Hosts)
+	req := &proto.EcReconstructRequest{PartitionID: partition.PartitionID, Hosts: hosts}
+	task = proto.NewAdminTask(proto.OpEcReconstructDataPartition, addr, req)
+	partition.resetTaskID(task)
+	return
+}
+
+// Ask the host to reconstruct its shards, which is done asynchronously by the data node.
+func (c *Cluster) syncReconstructEcDataPartition(dp *DataPartition, addr string) (err error) {
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		return
+	}
+	dp.RLock()
+	task := dp.createTaskToReconstructEc(addr)
+	dp.RUnlock()
+	if _, err = dataNode.TaskManager.syncSendAdminTask(task); err != nil {
+		return
+	}
+	log.LogInfof("action[syncReconstructEcDataPartition] partition[%v] addr[%v] hosts[%v]", dp.PartitionID, addr, dp.Hosts)
+	return
+}
+
+func (c *Cluster) dealEcReconstructResponse(nodeAddr string, resp *proto.EcReconstructResponse) (err error) {
+	if resp.Status == proto.TaskSucceeds {
+		log.LogInfof("action[dealEcReconstructResponse] partition[%v] on node[%v] reconstructed", resp.PartitionID, nodeAddr)
+		return
+	}
+	msg := fmt.Sprintf("action[dealEcReconstructResponse] clusterID[%v] partition[%v] on node[%v] failed to reconstruct, err[%v]",
+		c.Name, resp.PartitionID, nodeAddr, resp.Result)
+	Warn(c.Name, msg)
+	return
+}
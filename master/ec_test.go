@@ -0,0 +1,43 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestSetVolEc(t *testing.T) {
+	name := "ecVol"
+	vol := newVol(10003, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	server.cluster.putVol(vol)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&dataNum=%v&parityNum=%v&migrateDays=%v",
+		hostAddr, proto.AdminSetVolEc, name, buildAuthKey("cfs"), 4, 2, 30)
+	process(reqURL, t)
+	if vol.EcDataNum != 4 || vol.EcParityNum != 2 || vol.EcMigrateDays != 30 {
+		t.Errorf("set vol ec failed,expect[4 2 30],real[%v %v %v]", vol.EcDataNum, vol.EcParityNum, vol.EcMigrateDays)
+		return
+	}
+	if view := newSimpleView(vol); view.EcDataNum != 4 || view.EcMigrateDays != 30 {
+		t.Errorf("expect ec params in the view,real[%v %v]", view.EcDataNum, view.EcMigrateDays)
+		return
+	}
+
+	// disable the conversion, and the params are kept for the existing partitions
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&migrateDays=0", hostAddr, proto.AdminSetVolEc, name, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.EcMigrateDays != 0 || vol.EcDataNum != 4 {
+		t.Errorf("disable vol ec failed,real[%v %v]", vol.EcDataNum, vol.EcMigrateDays)
+	}
+}
+
+func TestEcHostsAfterRemoval(t *testing.T) {
+	dp := newDataPartition(1, 3, "ecVol", 10003)
+	dp.EcDataNum, dp.EcParityNum = 2, 1
+	dp.Hosts = []string{"a", "b", "c", "d"}
+	hosts := dp.ecHostsAfterRemoval("b")
+	if fmt.Sprint(hosts) != "[a d c]" {
+		t.Errorf("expect hosts[a d c],real[%v]", hosts)
+	}
+}
@@ -45,6 +45,10 @@ func (partition *DataPartition) validateCRC(clusterID string) {
 		}
 		Warn(clusterID, fmt.Sprintf("vol[%v],dpId[%v],liveAddrs[%v],inactiveAddrs[%v]", partition.VolName, partition.PartitionID, liveAddrs, inactiveAddrs))
 	}
+	// the shards of an erasure-coded partition differ from each other
+	if partition.isEc() {
+		return
+	}
 	partition.doValidateCRC(liveReplicas, clusterID)
 	return
 }
@@ -15,9 +15,11 @@
 package master
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/log"
 	"net/http/httputil"
 )
@@ -66,6 +68,28 @@ func (m *Server) handleFunctions() {
 	http.Handle(proto.GetMetaNodeTaskResponse, m.handlerWithInterceptor())
 	http.Handle(proto.AdminCreateMP, m.handlerWithInterceptor())
 	http.Handle(proto.ClientVolStat, m.handlerWithInterceptor())
+	http.Handle(proto.AdminSetQuota, m.handlerWithInterceptor())
+	http.Handle(proto.AdminDeleteQuota, m.handlerWithInterceptor())
+	http.Handle(proto.AdminGetQuota, m.handlerWithInterceptor())
+	http.Handle(proto.AdminListQuota, m.handlerWithInterceptor())
+	http.Handle(proto.AdminCreateSnapshot, m.handlerWithInterceptor())
+	http.Handle(proto.AdminDeleteSnapshot, m.handlerWithInterceptor())
+	http.Handle(proto.AdminListSnapshot, m.handlerWithInterceptor())
+	http.Handle(proto.AdminSetVolTrash, m.handlerWithInterceptor())
+	http.Handle(proto.AdminSetVolEc, m.handlerWithInterceptor())
+	http.Handle(proto.AdminSetVolTier, m.handlerWithInterceptor())
+	http.Handle(proto.AdminSplitDir, m.handlerWithInterceptor())
+	http.Handle(proto.AdminStartBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminStopBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminGetBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminStartMetaBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminStopMetaBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminGetMetaBalancer, m.handlerWithInterceptor())
+	http.Handle(proto.AdminListJobs, m.handlerWithInterceptor())
+	http.Handle(proto.AdminGetJob, m.handlerWithInterceptor())
+	http.Handle(proto.AdminCancelJob, m.handlerWithInterceptor())
+	http.Handle(proto.AdminPauseJob, m.handlerWithInterceptor())
+	http.Handle(proto.AdminResumeJob, m.handlerWithInterceptor())
 	http.Handle(proto.AddRaftNode, m.handlerWithInterceptor())
 	http.Handle(proto.RemoveRaftNode, m.handlerWithInterceptor())
 	http.Handle(proto.AdminSetMetaNodeThreshold, m.handlerWithInterceptor())
@@ -84,6 +108,11 @@ func (m *Server) newReverseProxy() *httputil.ReverseProxy {
 func (m *Server) handlerWithInterceptor() http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			if err := m.checkTicket(r); err != nil {
+				log.LogWarnf("action[handlerWithInterceptor] URL[%v],remoteAddr[%v] err[%v]", r.URL, r.RemoteAddr, err)
+				sendErrReply(w, r, &proto.HTTPReply{Code: proto.ErrCodeInvalidTicket, Msg: err.Error()})
+				return
+			}
 			if m.partition.IsRaftLeader() {
 				if m.metaReady {
 					m.ServeHTTP(w, r)
@@ -102,6 +131,29 @@ func (m *Server) handlerWithInterceptor() http.Handler {
 		})
 }
 
+// Check the ticket carried by the request, and whether it grants the access to the api.
+func (m *Server) checkTicket(r *http.Request) (err error) {
+	if !m.authenticate {
+		return
+	}
+	rsc, ok := proto.MasterAPI2ResourceMap[r.URL.Path]
+	if !ok {
+		return fmt.Errorf("%v: unknown api [%v]", proto.ErrInvalidTicket, r.URL.Path)
+	}
+	token := r.Header.Get(util.AuthTokenHeader)
+	if token == "" {
+		return fmt.Errorf("%v: no ticket", proto.ErrInvalidTicket)
+	}
+	ticket, err := proto.ExtractAPIAccessToken(token, proto.MasterServiceID, m.serviceKey)
+	if err != nil {
+		return fmt.Errorf("%v: %v", proto.ErrInvalidTicket, err)
+	}
+	if err = proto.CheckTicketCaps(&ticket, rsc); err != nil {
+		return fmt.Errorf("%v: %v", proto.ErrInvalidTicket, err)
+	}
+	return
+}
+
 func (m *Server) proxy(w http.ResponseWriter, r *http.Request) {
 	m.reverseProxy.ServeHTTP(w, r)
 }
@@ -179,6 +231,50 @@ func (m *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		m.setMetaNodeThreshold(w, r)
 	case proto.GetTopologyView:
 		m.getTopology(w, r)
+	case proto.AdminSetQuota:
+		m.setQuota(w, r)
+	case proto.AdminDeleteQuota:
+		m.deleteQuota(w, r)
+	case proto.AdminGetQuota:
+		m.getQuota(w, r)
+	case proto.AdminListQuota:
+		m.listQuota(w, r)
+	case proto.AdminCreateSnapshot:
+		m.createSnapshot(w, r)
+	case proto.AdminDeleteSnapshot:
+		m.deleteSnapshot(w, r)
+	case proto.AdminListSnapshot:
+		m.listSnapshot(w, r)
+	case proto.AdminSetVolTrash:
+		m.setVolTrash(w, r)
+	case proto.AdminSetVolEc:
+		m.setVolEc(w, r)
+	case proto.AdminSetVolTier:
+		m.setVolTier(w, r)
+	case proto.AdminSplitDir:
+		m.splitDir(w, r)
+	case proto.AdminStartBalancer:
+		m.startBalancer(w, r)
+	case proto.AdminStopBalancer:
+		m.stopBalancer(w, r)
+	case proto.AdminGetBalancer:
+		m.getBalancer(w, r)
+	case proto.AdminStartMetaBalancer:
+		m.startMetaBalancer(w, r)
+	case proto.AdminStopMetaBalancer:
+		m.stopMetaBalancer(w, r)
+	case proto.AdminGetMetaBalancer:
+		m.getMetaBalancer(w, r)
+	case proto.AdminListJobs:
+		m.listJobs(w, r)
+	case proto.AdminGetJob:
+		m.getJob(w, r)
+	case proto.AdminCancelJob:
+		m.cancelJob(w, r)
+	case proto.AdminPauseJob:
+		m.pauseJob(w, r)
+	case proto.AdminResumeJob:
+		m.resumeJob(w, r)
 	default:
 
 	}
@@ -0,0 +1,81 @@
+package master
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Every API served through the interceptor is checked against the tickets, which rejects the
+// ones without a resource when the authentication is enabled.
+func TestHandlersHaveAuthResource(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, "../proto", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make(map[string]string)
+	for _, f := range pkgs["proto"].Files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if i >= len(vs.Values) {
+						continue
+					}
+					if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						paths[name.Name], _ = strconv.Unquote(lit.Value)
+					}
+				}
+			}
+		}
+	}
+
+	f, err := parser.ParseFile(fset, "http_server.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes int
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		if fn, ok := call.Fun.(*ast.SelectorExpr); !ok || fn.Sel.Name != "Handle" {
+			return true
+		}
+		handler, ok := call.Args[1].(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if fn, ok := handler.Fun.(*ast.SelectorExpr); !ok || fn.Sel.Name != "handlerWithInterceptor" {
+			return true
+		}
+		arg, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok {
+			t.Errorf("%v: expect the path to be a constant of proto", fset.Position(call.Pos()))
+			return true
+		}
+		routes++
+		path, ok := paths[arg.Sel.Name]
+		if !ok {
+			t.Errorf("%v: unknown path proto.%v", fset.Position(call.Pos()), arg.Sel.Name)
+			return true
+		}
+		if _, ok = proto.MasterAPI2ResourceMap[path]; !ok {
+			t.Errorf("expect a resource of proto.%v (%v) in MasterAPI2ResourceMap", arg.Sel.Name, path)
+		}
+		return true
+	})
+	if routes == 0 {
+		t.Fatalf("expect the routes to be found in http_server.go")
+	}
+}
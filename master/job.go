@@ -0,0 +1,608 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The decommission of the nodes and the disks, and the addition, the removal and the decommission of the
+// replicas, are run as jobs. A job is persisted by the raft of the masters along with its steps, one for
+// each partition operated on, and the progress is persisted as each step finishes. The new leader loads
+// the jobs, and resumes the running ones from the steps not finished.
+//
+// The decommission of a node or a disk runs in the background, while the other jobs run in the request.
+// A job paused or cancelled stops after the running step. A job paused or failed can be resumed, in which
+// case the failed steps are retried.
+
+// jobRun identifies a run of a job, so that a stale run, such as the one on the old leader, stops.
+type jobRun struct{}
+
+type jobManager struct {
+	sync.RWMutex
+	jobs map[uint64]*proto.Job
+	runs map[uint64]*jobRun // the running jobs keyed by the job ID
+}
+
+func newJobManager() *jobManager {
+	return &jobManager{
+		jobs: make(map[uint64]*proto.Job),
+		runs: make(map[uint64]*jobRun),
+	}
+}
+
+func (m *jobManager) clear() {
+	m.Lock()
+	defer m.Unlock()
+	m.jobs = make(map[uint64]*proto.Job)
+	m.runs = make(map[uint64]*jobRun)
+}
+
+func (m *jobManager) put(job *proto.Job) {
+	m.Lock()
+	defer m.Unlock()
+	m.jobs[job.ID] = job
+}
+
+func isMetaJob(jobType string) bool {
+	switch jobType {
+	case proto.JobDecommissionMetaNode, proto.JobDecommissionMetaPartition, proto.JobAddMetaReplica,
+		proto.JobDeleteMetaReplica:
+		return true
+	}
+	return false
+}
+
+// conflicts returns true if both jobs operate on the same partition, or on the same node or disk.
+func conflicts(a, b *proto.Job) bool {
+	if a.PartitionID != 0 || b.PartitionID != 0 {
+		return a.PartitionID == b.PartitionID && isMetaJob(a.Type) == isMetaJob(b.Type)
+	}
+	return a.Type == b.Type && a.Addr == b.Addr && a.Disk == b.Disk
+}
+
+// add adds the job and registers its run, unless an active job conflicts with it.
+func (m *jobManager) add(job *proto.Job) (run *jobRun, err error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, j := range m.jobs {
+		if j.IsActive() && conflicts(j, job) {
+			return nil, fmt.Errorf("conflict with active job[%v]", j.ID)
+		}
+	}
+	run = new(jobRun)
+	m.jobs[job.ID] = job
+	m.runs[job.ID] = run
+	return
+}
+
+func (m *jobManager) remove(id uint64) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.jobs, id)
+	delete(m.runs, id)
+}
+
+func (m *jobManager) get(id uint64) (job *proto.Job, err error) {
+	m.RLock()
+	defer m.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, proto.ErrJobNotExists
+	}
+	return
+}
+
+// startRuns registers the runs of the running jobs which are not run, such as the ones loaded by the new leader.
+func (m *jobManager) startRuns() (jobs []*proto.Job, runs []*jobRun) {
+	m.Lock()
+	defer m.Unlock()
+	for id, job := range m.jobs {
+		if _, ok := m.runs[id]; ok || job.Status != proto.JobRunning {
+			continue
+		}
+		run := new(jobRun)
+		m.runs[id] = run
+		jobs = append(jobs, job)
+		runs = append(runs, run)
+	}
+	return
+}
+
+func (m *jobManager) endRun(id uint64, run *jobRun) {
+	m.Lock()
+	defer m.Unlock()
+	if m.runs[id] == run {
+		delete(m.runs, id)
+	}
+}
+
+// nextStep returns the first step not finished, or nil if all the steps have finished, and whether the step
+// was interrupted, such as by the change of the leader. It returns false if the job should stop, which is the
+// case if the job is not running or the run is stale.
+func (m *jobManager) nextStep(job *proto.Job, run *jobRun) (step *proto.JobStep, interrupted, ok bool) {
+	m.Lock()
+	defer m.Unlock()
+	if m.runs[job.ID] != run || job.Status != proto.JobRunning {
+		return nil, false, false
+	}
+	for _, s := range job.Steps {
+		if s.Status == proto.JobPending || s.Status == proto.JobRunning {
+			interrupted = s.Status == proto.JobRunning
+			s.Status = proto.JobRunning
+			s.UpdateTime = time.Now().Unix()
+			return s, interrupted, true
+		}
+	}
+	return nil, false, true
+}
+
+func (m *jobManager) finishStep(job *proto.Job, step *proto.JobStep, err error) {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now().Unix()
+	step.UpdateTime = now
+	step.Msg = ""
+	if err != nil {
+		step.Status = proto.JobFailed
+		step.Msg = err.Error()
+	} else {
+		step.Status = proto.JobSucceeded
+	}
+	job.UpdateTime = now
+	countJobSteps(job)
+}
+
+// addSteps appends the steps on the partitions not operated on yet, and returns the number of them.
+func (m *jobManager) addSteps(job *proto.Job, steps []*proto.JobStep) (added int) {
+	m.Lock()
+	defer m.Unlock()
+	existing := make(map[uint64]bool, len(job.Steps))
+	for _, s := range job.Steps {
+		existing[s.PartitionID] = true
+	}
+	for _, s := range steps {
+		if !existing[s.PartitionID] {
+			job.Steps = append(job.Steps, s)
+			added++
+		}
+	}
+	countJobSteps(job)
+	return
+}
+
+func countJobSteps(job *proto.Job) {
+	job.Total, job.Succeeded, job.Failed = len(job.Steps), 0, 0
+	for _, s := range job.Steps {
+		switch s.Status {
+		case proto.JobSucceeded:
+			job.Succeeded++
+		case proto.JobFailed:
+			job.Failed++
+		}
+	}
+}
+
+// failure returns the error of the failed steps.
+func (m *jobManager) failure(job *proto.Job) error {
+	m.RLock()
+	defer m.RUnlock()
+	if job.Failed == 0 {
+		return nil
+	}
+	if len(job.Steps) == 1 {
+		return fmt.Errorf("%v", job.Steps[0].Msg)
+	}
+	return fmt.Errorf("%v of %v partitions failed", job.Failed, job.Total)
+}
+
+func (m *jobManager) setStatus(job *proto.Job, status uint8, msg string) {
+	m.Lock()
+	defer m.Unlock()
+	job.Status = status
+	job.Msg = msg
+	job.UpdateTime = time.Now().Unix()
+}
+
+// result returns the error of the job which has stopped.
+func (m *jobManager) result(job *proto.Job) error {
+	m.RLock()
+	defer m.RUnlock()
+	switch job.Status {
+	case proto.JobSucceeded:
+		return nil
+	case proto.JobFailed:
+		return fmt.Errorf("job[%v] failed: %v", job.ID, job.Msg)
+	case proto.JobPaused:
+		return fmt.Errorf("job[%v] paused", job.ID)
+	case proto.JobCancelled:
+		return fmt.Errorf("job[%v] cancelled", job.ID)
+	}
+	return fmt.Errorf("job[%v] stopped", job.ID)
+}
+
+// list returns the copies of the jobs without the steps, in the order of the ID.
+func (m *jobManager) list() (jobs []*proto.Job) {
+	m.RLock()
+	defer m.RUnlock()
+	jobs = make([]*proto.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		j := *job
+		j.Steps = nil
+		jobs = append(jobs, &j)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return
+}
+
+// view returns a copy of the job along with the steps.
+func (m *jobManager) view(id uint64) (view *proto.Job, err error) {
+	m.RLock()
+	defer m.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, proto.ErrJobNotExists
+	}
+	j := *job
+	j.Steps = make([]*proto.JobStep, 0, len(job.Steps))
+	for _, s := range job.Steps {
+		step := *s
+		j.Steps = append(j.Steps, &step)
+	}
+	return &j, nil
+}
+
+// expired returns the finished jobs beyond the history kept, from the oldest one.
+func (m *jobManager) expired() (jobs []*proto.Job) {
+	m.RLock()
+	defer m.RUnlock()
+	for _, job := range m.jobs {
+		if !job.IsActive() {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) <= maxJobHistory {
+		return nil
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs[:len(jobs)-maxJobHistory]
+}
+
+func newJob(jobType, addr string, steps []*proto.JobStep) *proto.Job {
+	return &proto.Job{Type: jobType, Addr: addr, Steps: steps}
+}
+
+func newPartitionJob(jobType, addr string, partitionID uint64, volName string) *proto.Job {
+	job := newJob(jobType, addr, []*proto.JobStep{{PartitionID: partitionID, VolName: volName}})
+	job.PartitionID = partitionID
+	return job
+}
+
+// submitJob persists the job and registers its run, which is then started by the caller.
+func (c *Cluster) submitJob(job *proto.Job) (run *jobRun, err error) {
+	if job.ID, err = c.idAlloc.allocateCommonID(); err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	job.Status = proto.JobRunning
+	job.CreateTime, job.UpdateTime = now, now
+	for _, s := range job.Steps {
+		s.UpdateTime = now
+	}
+	countJobSteps(job)
+	if run, err = c.jobs.add(job); err != nil {
+		return
+	}
+	if err = c.syncAddJob(job); err != nil {
+		c.jobs.remove(job.ID)
+		log.LogErrorf("action[submitJob] %v err[%v]", job, err)
+		return nil, proto.ErrPersistenceByRaft
+	}
+	log.LogWarnf("action[submitJob] %v submitted with %v partitions", job, job.Total)
+	return
+}
+
+// runJobInRequest submits the job and runs it until it stops.
+func (c *Cluster) runJobInRequest(job *proto.Job) (err error) {
+	run, err := c.submitJob(job)
+	if err != nil {
+		return
+	}
+	return c.runJob(job, run)
+}
+
+// startJob submits the job and runs it in the background.
+func (c *Cluster) startJob(job *proto.Job) (err error) {
+	run, err := c.submitJob(job)
+	if err != nil {
+		return
+	}
+	go c.runJob(job, run)
+	return
+}
+
+func (c *Cluster) scheduleToRunJobs() {
+	go func() {
+		for {
+			time.Sleep(time.Second * intervalToRunJobs)
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.resumeJobs()
+			}
+		}
+	}()
+}
+
+// resumeJobs runs the running jobs which are not run, such as the ones loaded by the new leader.
+func (c *Cluster) resumeJobs() {
+	jobs, runs := c.jobs.startRuns()
+	for i, job := range jobs {
+		log.LogWarnf("action[resumeJobs] resume %v", job)
+		go c.runJob(job, runs[i])
+	}
+}
+
+// runJob runs the pending steps in order, and then finishes the job. It returns the error of the job.
+func (c *Cluster) runJob(job *proto.Job, run *jobRun) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.LogWarnf("runJob occurred panic,job[%v],err[%v]", job.ID, r)
+			WarnBySpecialKey(fmt.Sprintf("%v_%v_scheduling_job_panic", c.Name, ModuleName),
+				"runJob occurred panic")
+			err = fmt.Errorf("job[%v] panic: %v", job.ID, r)
+		}
+		c.jobs.endRun(job.ID, run)
+	}()
+	for {
+		step, interrupted, ok := c.jobs.nextStep(job, run)
+		if !ok {
+			return c.jobs.result(job)
+		}
+		if step == nil {
+			// the partitions placed on the node after the job was submitted are operated on too
+			if c.jobs.addSteps(job, c.jobSteps(job.Type, job.Addr, job.Disk)) > 0 {
+				continue
+			}
+			break
+		}
+		if !c.partition.IsRaftLeader() {
+			return fmt.Errorf("job[%v] stopped as the master leader changed", job.ID)
+		}
+		// the step started is persisted, so that the new leader knows it was interrupted
+		if err = c.syncUpdateJob(job); err != nil {
+			log.LogErrorf("action[runJob] %v persist err[%v]", job, err)
+			return proto.ErrPersistenceByRaft
+		}
+		stepErr := c.runJobStep(job, step, interrupted)
+		if stepErr != nil {
+			log.LogErrorf("action[runJob] %v partition[%v] err[%v]", job, step.PartitionID, stepErr)
+		}
+		c.jobs.finishStep(job, step, stepErr)
+		if err = c.syncUpdateJob(job); err != nil {
+			log.LogErrorf("action[runJob] %v persist err[%v]", job, err)
+			return proto.ErrPersistenceByRaft
+		}
+	}
+	return c.finishJob(job)
+}
+
+// runJobStep operates on the partition of the step. The step interrupted is run again, in which case the
+// replica already added or removed is skipped.
+func (c *Cluster) runJobStep(job *proto.Job, step *proto.JobStep, interrupted bool) (err error) {
+	if isMetaJob(job.Type) {
+		var mp *MetaPartition
+		if mp, err = c.getMetaPartitionByID(step.PartitionID); err != nil {
+			// the volume has been deleted
+			return nil
+		}
+		mp.RLock()
+		hasHost := contains(mp.Hosts, job.Addr)
+		mp.RUnlock()
+		switch job.Type {
+		case proto.JobAddMetaReplica:
+			if !interrupted || !hasHost {
+				err = c.addMetaReplica(mp, job.Addr)
+			}
+		case proto.JobDeleteMetaReplica:
+			if !interrupted || hasHost {
+				err = c.deleteMetaReplica(mp, job.Addr, true)
+			}
+		default:
+			err = c.decommissionMetaPartition(job.Addr, mp)
+		}
+		return
+	}
+	var dp *DataPartition
+	if dp, err = c.getDataPartitionByID(step.PartitionID); err != nil {
+		return nil
+	}
+	dp.RLock()
+	hasHost := dp.hasHost(job.Addr)
+	dp.RUnlock()
+	switch job.Type {
+	case proto.JobAddDataReplica:
+		if !interrupted || !hasHost {
+			err = c.addDataReplica(dp, job.Addr)
+		}
+	case proto.JobDeleteDataReplica:
+		if !interrupted || hasHost {
+			err = c.removeDataReplica(dp, job.Addr, true)
+		}
+	case proto.JobDecommissionDataNode:
+		err = c.decommissionDataPartition(job.Addr, dp, dataNodeOfflineErr)
+	case proto.JobDecommissionDisk:
+		err = c.decommissionDataPartition(job.Addr, dp, diskOfflineErr)
+	default:
+		err = c.decommissionDataPartition(job.Addr, dp, handleDataPartitionOfflineErr)
+	}
+	return
+}
+
+// jobSteps returns the steps on the partitions placed on the node or the disk decommissioned.
+func (c *Cluster) jobSteps(jobType, addr, disk string) (steps []*proto.JobStep) {
+	now := time.Now().Unix()
+	switch jobType {
+	case proto.JobDecommissionDataNode:
+		for _, vol := range c.allVols() {
+			for _, dp := range vol.dataPartitions.partitions {
+				dp.RLock()
+				if dp.hasHost(addr) {
+					steps = append(steps, &proto.JobStep{PartitionID: dp.PartitionID, VolName: dp.VolName, UpdateTime: now})
+				}
+				dp.RUnlock()
+			}
+		}
+	case proto.JobDecommissionDisk:
+		dataNode, err := c.dataNode(addr)
+		if err != nil {
+			return
+		}
+		for _, dp := range dataNode.badPartitions(disk, c) {
+			steps = append(steps, &proto.JobStep{PartitionID: dp.PartitionID, VolName: dp.VolName, UpdateTime: now})
+		}
+	case proto.JobDecommissionMetaNode:
+		for _, vol := range c.allVols() {
+			for _, mp := range vol.MetaPartitions {
+				mp.RLock()
+				if contains(mp.Hosts, addr) {
+					steps = append(steps, &proto.JobStep{PartitionID: mp.PartitionID, VolName: mp.volName, UpdateTime: now})
+				}
+				mp.RUnlock()
+			}
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].PartitionID < steps[j].PartitionID })
+	return
+}
+
+// finishJob removes the node decommissioned if all the steps succeeded, and persists the result of the job.
+func (c *Cluster) finishJob(job *proto.Job) (err error) {
+	if err = c.jobs.failure(job); err == nil {
+		switch job.Type {
+		case proto.JobDecommissionDataNode:
+			err = c.deleteDataNode(job.Addr)
+		case proto.JobDecommissionMetaNode:
+			err = c.deleteMetaNode(job.Addr)
+		case proto.JobDecommissionDisk:
+			Warn(c.Name, fmt.Sprintf("action[decommissionDisk],clusterID[%v] Node[%v] disk[%v] OffLine success",
+				c.Name, job.Addr, job.Disk))
+		}
+	}
+	if err != nil {
+		c.jobs.setStatus(job, proto.JobFailed, err.Error())
+	} else {
+		c.jobs.setStatus(job, proto.JobSucceeded, "")
+	}
+	if e := c.syncUpdateJob(job); e != nil {
+		log.LogErrorf("action[finishJob] %v persist err[%v]", job, e)
+		return proto.ErrPersistenceByRaft
+	}
+	log.LogWarnf("action[finishJob] %v finished, succeeded[%v] failed[%v]", job, job.Succeeded, job.Failed)
+	c.deleteExpiredJobs()
+	return c.jobs.result(job)
+}
+
+func (c *Cluster) deleteExpiredJobs() {
+	for _, job := range c.jobs.expired() {
+		if err := c.syncDeleteJob(job); err != nil {
+			log.LogErrorf("action[deleteExpiredJobs] %v err[%v]", job, err)
+			return
+		}
+		c.jobs.remove(job.ID)
+	}
+}
+
+// decommissionDataNode migrates the data partitions off the data node, and then removes it from the cluster.
+func (c *Cluster) decommissionDataNode(dataNode *DataNode) (job *proto.Job, err error) {
+	job = newJob(proto.JobDecommissionDataNode, dataNode.Addr, c.jobSteps(proto.JobDecommissionDataNode, dataNode.Addr, ""))
+	err = c.startJob(job)
+	return
+}
+
+// decommissionDisk migrates the data partitions off the disk of the data node.
+func (c *Cluster) decommissionDisk(dataNode *DataNode, diskPath string) (job *proto.Job, err error) {
+	steps := c.jobSteps(proto.JobDecommissionDisk, dataNode.Addr, diskPath)
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("node[%v] disk[%v] does not have any data partition", dataNode.Addr, diskPath)
+	}
+	job = newJob(proto.JobDecommissionDisk, dataNode.Addr, steps)
+	job.Disk = diskPath
+	err = c.startJob(job)
+	return
+}
+
+// decommissionMetaNode migrates the meta partitions off the meta node, and then removes it from the cluster.
+func (c *Cluster) decommissionMetaNode(metaNode *MetaNode) (job *proto.Job, err error) {
+	job = newJob(proto.JobDecommissionMetaNode, metaNode.Addr, c.jobSteps(proto.JobDecommissionMetaNode, metaNode.Addr, ""))
+	err = c.startJob(job)
+	return
+}
+
+func (c *Cluster) pauseJob(id uint64) (err error) {
+	return c.changeJobStatus(id, proto.JobPaused, func(job *proto.Job) bool { return job.Status == proto.JobRunning })
+}
+
+func (c *Cluster) cancelJob(id uint64) (err error) {
+	return c.changeJobStatus(id, proto.JobCancelled, func(job *proto.Job) bool { return job.IsActive() })
+}
+
+// resumeJob runs the job paused or failed again, in which case the failed steps are retried.
+func (c *Cluster) resumeJob(id uint64) (err error) {
+	if err = c.changeJobStatus(id, proto.JobRunning, func(job *proto.Job) bool {
+		if job.Status != proto.JobPaused && job.Status != proto.JobFailed {
+			return false
+		}
+		for _, s := range job.Steps {
+			if s.Status == proto.JobFailed {
+				s.Status = proto.JobPending
+			}
+		}
+		countJobSteps(job)
+		return true
+	}); err != nil {
+		return
+	}
+	c.resumeJobs()
+	return
+}
+
+// changeJobStatus sets the status of the job and persists it, if the job is allowed to change.
+func (c *Cluster) changeJobStatus(id uint64, status uint8, allowed func(job *proto.Job) bool) (err error) {
+	job, err := c.jobs.get(id)
+	if err != nil {
+		return
+	}
+	c.jobs.Lock()
+	if !allowed(job) {
+		c.jobs.Unlock()
+		return fmt.Errorf("job[%v] is in status %v", id, job.Status)
+	}
+	oldStatus, oldMsg := job.Status, job.Msg
+	job.Status = status
+	job.Msg = ""
+	job.UpdateTime = time.Now().Unix()
+	c.jobs.Unlock()
+	if err = c.syncUpdateJob(job); err != nil {
+		c.jobs.setStatus(job, oldStatus, oldMsg)
+		log.LogErrorf("action[changeJobStatus] job[%v] err[%v]", id, err)
+		return proto.ErrPersistenceByRaft
+	}
+	return
+}
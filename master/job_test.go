@@ -0,0 +1,146 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestJobConflicts(t *testing.T) {
+	m := newJobManager()
+	dn := &proto.Job{ID: 1, Type: proto.JobDecommissionDataNode, Addr: "192.168.0.1:6000", Status: proto.JobRunning}
+	m.jobs[dn.ID] = dn
+	if _, err := m.add(&proto.Job{ID: 2, Type: proto.JobDecommissionDataNode, Addr: dn.Addr}); err == nil {
+		t.Errorf("expect the decommission of the same data node to conflict")
+	}
+	if _, err := m.add(&proto.Job{ID: 3, Type: proto.JobDecommissionDisk, Addr: dn.Addr, Disk: "/disk1"}); err != nil {
+		t.Errorf("unexpected conflict of the disk job, err[%v]", err)
+	}
+	dp := &proto.Job{ID: 4, Type: proto.JobAddDataReplica, Addr: dn.Addr, PartitionID: 10, Status: proto.JobRunning}
+	m.jobs[dp.ID] = dp
+	if _, err := m.add(&proto.Job{ID: 5, Type: proto.JobDeleteDataReplica, Addr: "192.168.0.2:6000", PartitionID: 10}); err == nil {
+		t.Errorf("expect the jobs on the same data partition to conflict")
+	}
+	if _, err := m.add(&proto.Job{ID: 6, Type: proto.JobAddMetaReplica, Addr: dn.Addr, PartitionID: 10}); err != nil {
+		t.Errorf("unexpected conflict of the meta partition job, err[%v]", err)
+	}
+	// the finished jobs do not conflict
+	dn.Status = proto.JobSucceeded
+	if _, err := m.add(&proto.Job{ID: 7, Type: proto.JobDecommissionDataNode, Addr: dn.Addr}); err != nil {
+		t.Errorf("unexpected conflict with the finished job, err[%v]", err)
+	}
+}
+
+func TestJobSteps(t *testing.T) {
+	m := newJobManager()
+	job := newJob(proto.JobDecommissionMetaNode, "192.168.0.1:9021", []*proto.JobStep{{PartitionID: 1}, {PartitionID: 2}})
+	job.ID = 1
+	job.Status = proto.JobRunning
+	run, err := m.add(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, interrupted, ok := m.nextStep(job, run)
+	if !ok || step == nil || step.PartitionID != 1 || interrupted {
+		t.Fatalf("unexpected step %+v, interrupted[%v] ok[%v]", step, interrupted, ok)
+	}
+	// the step started but not finished is interrupted, such as by the change of the leader
+	run = new(jobRun)
+	m.runs[job.ID] = run
+	if step, interrupted, ok = m.nextStep(job, run); !ok || step.PartitionID != 1 || !interrupted {
+		t.Fatalf("expect the interrupted step 1, got %+v, interrupted[%v] ok[%v]", step, interrupted, ok)
+	}
+	m.finishStep(job, step, fmt.Errorf("no available meta node"))
+	if step, _, ok = m.nextStep(job, run); !ok || step.PartitionID != 2 {
+		t.Fatalf("expect step 2, got %+v ok[%v]", step, ok)
+	}
+	m.finishStep(job, step, nil)
+	if step, _, ok = m.nextStep(job, run); !ok || step != nil {
+		t.Fatalf("expect no step left, got %+v ok[%v]", step, ok)
+	}
+	if job.Total != 2 || job.Succeeded != 1 || job.Failed != 1 || m.failure(job) == nil {
+		t.Errorf("unexpected progress total[%v] succeeded[%v] failed[%v]", job.Total, job.Succeeded, job.Failed)
+	}
+	// the new partitions on the node are appended
+	if added := m.addSteps(job, []*proto.JobStep{{PartitionID: 2}, {PartitionID: 3}}); added != 1 || job.Total != 3 {
+		t.Errorf("expect partition 3 appended, added[%v] total[%v]", added, job.Total)
+	}
+	// the stale run stops
+	if _, _, ok = m.nextStep(job, new(jobRun)); ok {
+		t.Errorf("expect the stale run to stop")
+	}
+	job.Status = proto.JobPaused
+	if _, _, ok = m.nextStep(job, run); ok {
+		t.Errorf("expect the paused job to stop")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	c := server.cluster
+	// the volume of the partition has been deleted, so the step succeeds without operating on it
+	job := newPartitionJob(proto.JobAddDataReplica, mds1Addr, 1<<40, "deletedVol")
+	if err := c.runJobInRequest(job); err != nil {
+		t.Fatalf("run job err[%v]", err)
+	}
+	view := getJob(job.ID, t)
+	if view == nil {
+		return
+	}
+	if view.Status != proto.JobSucceeded || len(view.Steps) != 1 || view.Steps[0].Status != proto.JobSucceeded {
+		t.Errorf("unexpected job %+v", view)
+	}
+	reply := process(fmt.Sprintf("%v%v", hostAddr, proto.AdminListJobs), t)
+	if reply == nil {
+		return
+	}
+	if jobs, ok := reply.Data.([]interface{}); !ok || len(jobs) == 0 {
+		t.Errorf("expect jobs listed, got %v", reply.Data)
+	}
+	// the finished job cannot be paused
+	if err := c.pauseJob(job.ID); err == nil {
+		t.Errorf("expect the finished job not to be paused")
+	}
+
+	// the running job loaded by the new leader is resumed from the interrupted step
+	job = newPartitionJob(proto.JobDeleteMetaReplica, mms1Addr, 1<<40, "deletedVol")
+	run, err := c.submitJob(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.jobs.endRun(job.ID, run)
+	job.Steps[0].Status = proto.JobRunning
+	c.resumeJobs()
+	waitForJobs(t)
+	if job.Status != proto.JobSucceeded {
+		t.Errorf("expect the resumed job to succeed, got status %v msg[%v]", job.Status, job.Msg)
+	}
+}
+
+func getJob(id uint64, t *testing.T) (job *proto.Job) {
+	var err error
+	if job, err = server.cluster.jobs.view(id); err != nil {
+		t.Errorf("get job[%v] err[%v]", id, err)
+		return nil
+	}
+	process(fmt.Sprintf("%v%v?id=%v", hostAddr, proto.AdminGetJob, id), t)
+	return
+}
+
+// waitForJobs waits for the jobs running in the background to finish.
+func waitForJobs(t *testing.T) {
+	for i := 0; i < 60; i++ {
+		var active bool
+		for _, job := range server.cluster.jobs.list() {
+			if job.IsActive() {
+				active = true
+			}
+		}
+		if !active {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	t.Errorf("jobs not finished in time")
+}
@@ -116,6 +116,9 @@ func (m *Server) loadMetadata() {
 	if err = m.cluster.loadDataPartitions(); err != nil {
 		panic(err)
 	}
+	if err = m.cluster.loadJobs(); err != nil {
+		panic(err)
+	}
 	log.LogInfo("action[loadMetadata] end")
 
 }
@@ -125,5 +128,6 @@ func (m *Server) clearMetadata() {
 	m.cluster.clearDataNodes()
 	m.cluster.clearMetaNodes()
 	m.cluster.clearVols()
+	m.cluster.jobs.clear()
 	m.cluster.t = newTopology()
 }
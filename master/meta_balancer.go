@@ -0,0 +1,301 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The meta balancer moves the replicas of the meta partitions from the meta nodes using more memory than
+// the average of the cluster by the threshold, to the meta nodes using less than the average, instead of
+// leaving the heavy meta nodes to stop taking new partitions at the threshold of memory. A replica is moved
+// by adding a raft member on the new meta node, waiting for it to apply the raft log up to the leader, and
+// then removing the old one. Each meta node takes part in one migration at a time.
+//
+// The memory footprint of a meta partition is estimated by its meta node from the number of the inodes and
+// dentries, so that the partitions are moved only if they fit in the memory left below the average.
+
+// metaBalanceNode is the memory usage of a meta node seen by the meta balancer.
+type metaBalanceNode struct {
+	addr      string
+	nodeSetID uint64
+	total     uint64
+	used      uint64
+	usage     float64
+	writable  bool
+	reports   []*proto.MetaPartitionReport
+}
+
+func (n *metaBalanceNode) hasPartition(partitionID uint64) bool {
+	for _, r := range n.reports {
+		if r.PartitionID == partitionID {
+			return true
+		}
+	}
+	return false
+}
+
+// room returns the memory that can be taken before the meta node is used more than the average.
+func (n *metaBalanceNode) room(avg float64) uint64 {
+	limit := uint64(avg * float64(n.total))
+	if n.used >= limit {
+		return 0
+	}
+	return limit - n.used
+}
+
+// planMetaBalanceMoves chooses at most max replicas to move. The sources are the meta nodes used more than
+// the average by the threshold, from the most used one. The largest partition of a source fitting in the room
+// of a destination is moved, and the destinations are the writable meta nodes used less than the average,
+// preferring the same node set. The busy nodes and partitions are skipped.
+func planMetaBalanceMoves(nodes []*metaBalanceNode, avg, threshold float64, max int,
+	busyNodes map[string]bool, busyPartitions map[uint64]bool) (moves []*balanceMove) {
+	var sources, targets []*metaBalanceNode
+	for _, n := range nodes {
+		if n.usage > avg+threshold {
+			sources = append(sources, n)
+		}
+		if n.writable && n.usage < avg {
+			targets = append(targets, n)
+		}
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].usage > sources[j].usage })
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].usage < targets[j].usage })
+
+	chooseTarget := func(src *metaBalanceNode, r *proto.MetaPartitionReport) *metaBalanceNode {
+		var other *metaBalanceNode
+		for _, t := range targets {
+			if busyNodes[t.addr] || t.hasPartition(r.PartitionID) || t.room(avg) < r.MemSize {
+				continue
+			}
+			if t.nodeSetID == src.nodeSetID {
+				return t
+			}
+			if other == nil {
+				other = t
+			}
+		}
+		return other
+	}
+
+	for _, s := range sources {
+		if len(moves) >= max {
+			return
+		}
+		if busyNodes[s.addr] {
+			continue
+		}
+		reports := make([]*proto.MetaPartitionReport, 0)
+		for _, r := range s.reports {
+			// an empty partition does not reduce the usage
+			if r.MemSize > 0 && !busyPartitions[r.PartitionID] {
+				reports = append(reports, r)
+			}
+		}
+		sort.SliceStable(reports, func(i, j int) bool { return reports[i].MemSize > reports[j].MemSize })
+		for _, r := range reports {
+			dst := chooseTarget(s, r)
+			if dst == nil {
+				continue
+			}
+			moves = append(moves, &balanceMove{partitionID: r.PartitionID, src: s.addr, dst: dst.addr})
+			busyNodes[s.addr] = true
+			busyNodes[dst.addr] = true
+			busyPartitions[r.PartitionID] = true
+			break
+		}
+	}
+	return
+}
+
+// metaBalanceNodes returns the memory usage of the active meta nodes, and the average usage of them.
+func (c *Cluster) metaBalanceNodes() (nodes []*metaBalanceNode, avg float64) {
+	var total, used uint64
+	c.metaNodes.Range(func(key, value interface{}) bool {
+		metaNode := value.(*MetaNode)
+		writable := metaNode.isWritable()
+		metaNode.RLock()
+		defer metaNode.RUnlock()
+		if !metaNode.IsActive || metaNode.Total == 0 {
+			return true
+		}
+		total += metaNode.Total
+		used += metaNode.Used
+		nodes = append(nodes, &metaBalanceNode{
+			addr:      metaNode.Addr,
+			nodeSetID: metaNode.NodeSetID,
+			total:     metaNode.Total,
+			used:      metaNode.Used,
+			usage:     metaNode.Ratio,
+			writable:  writable,
+			reports:   metaNode.metaPartitionInfos,
+		})
+		return true
+	})
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].addr < nodes[j].addr })
+	if total > 0 {
+		avg = float64(used) / float64(total)
+	}
+	return
+}
+
+func (c *Cluster) scheduleToBalanceMetaNodes() {
+	go func() {
+		for {
+			time.Sleep(time.Second * intervalToBalanceMetaNodes)
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.balanceMetaNodes()
+			}
+		}
+	}()
+}
+
+// balanceMetaNodes starts the migrations up to the concurrency of the meta balancer.
+func (c *Cluster) balanceMetaNodes() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.LogWarnf("balanceMetaNodes occurred panic,err[%v]", r)
+			WarnBySpecialKey(fmt.Sprintf("%v_%v_scheduling_job_panic", c.Name, ModuleName),
+				"balanceMetaNodes occurred panic")
+		}
+	}()
+	b := c.metaBalancer
+	threshold, slots, busyNodes, busyPartitions := b.available()
+	if slots <= 0 {
+		return
+	}
+	nodes, avg := c.metaBalanceNodes()
+	for _, move := range planMetaBalanceMoves(nodes, avg, threshold, slots, busyNodes, busyPartitions) {
+		mp, err := c.getMetaPartitionByID(move.partitionID)
+		if err != nil {
+			continue
+		}
+		if err = c.validateMetaBalanceMove(mp, move); err != nil {
+			log.LogWarnf("action[balanceMetaNodes] skip partition[%v] from[%v] to[%v], err[%v]",
+				move.partitionID, move.src, move.dst, err)
+			continue
+		}
+		now := time.Now().Unix()
+		task := &proto.BalanceTask{PartitionID: mp.PartitionID, VolName: mp.volName, Src: move.src,
+			Dst: move.dst, State: proto.BalanceAddingReplica, StartTime: now, UpdateTime: now}
+		if !b.addTask(task) {
+			continue
+		}
+		log.LogInfof("action[balanceMetaNodes] start %v, average usage[%v]", task, avg)
+		go c.runMetaBalanceTask(mp, task)
+	}
+}
+
+func (c *Cluster) validateMetaBalanceMove(mp *MetaPartition, move *balanceMove) (err error) {
+	mp.RLock()
+	if !contains(mp.Hosts, move.src) || contains(mp.Hosts, move.dst) {
+		err = fmt.Errorf("hosts %v changed", mp.Hosts)
+	} else if len(mp.Hosts) != int(mp.ReplicaNum) {
+		err = fmt.Errorf("hosts %v not match replica num %v", mp.Hosts, mp.ReplicaNum)
+	}
+	mp.RUnlock()
+	if err != nil {
+		return
+	}
+	return c.validateDecommissionMetaPartition(mp, move.src)
+}
+
+// runMetaBalanceTask adds the new replica, waits for it to catch up with the leader, and removes the old one.
+func (c *Cluster) runMetaBalanceTask(mp *MetaPartition, task *proto.BalanceTask) {
+	var err error
+	defer func() {
+		if err != nil {
+			log.LogErrorf("action[runMetaBalanceTask] %v err[%v]", task, err)
+			c.metaBalancer.finishTask(task, err)
+			return
+		}
+		log.LogInfof("action[runMetaBalanceTask] %v finished", task)
+		c.metaBalancer.finishTask(task, nil)
+	}()
+	if err = c.addMetaReplica(mp, task.Dst); err != nil {
+		return
+	}
+	c.metaBalancer.setTaskState(task, proto.BalanceCatchingUp)
+	// the raft log applied by the leader after the new member joined is to be applied by the new replica
+	mp.RLock()
+	var applyID uint64
+	if leader, e := mp.getMetaReplicaLeader(); e == nil {
+		applyID = leader.ApplyID
+	}
+	mp.RUnlock()
+	deadline := time.Now().Add(balanceCatchUpTimeout)
+	for !isMetaReplicaCaughtUp(mp, task.Dst, applyID) {
+		if !c.partition.IsRaftLeader() {
+			err = fmt.Errorf("master leader changed")
+			return
+		}
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("replica not caught up in %v", balanceCatchUpTimeout)
+			// the old replica is kept, so the new one is removed to restore the replica num
+			if e := c.deleteMetaReplica(mp, task.Dst, false); e != nil {
+				log.LogErrorf("action[runMetaBalanceTask] %v roll back err[%v]", task, e)
+			}
+			return
+		}
+		time.Sleep(time.Second * intervalToCheckBalanceTask)
+	}
+	c.metaBalancer.setTaskState(task, proto.BalanceRemovingReplica)
+	err = c.deleteMetaReplica(mp, task.Src, true)
+}
+
+// isMetaReplicaCaughtUp returns true if the new replica has been reported alive, and has applied the raft log
+// up to the index applied by the leader when it joined.
+func isMetaReplicaCaughtUp(mp *MetaPartition, dst string, applyID uint64) bool {
+	mp.RLock()
+	defer mp.RUnlock()
+	mr, err := mp.getMetaReplica(dst)
+	if err != nil || !mr.isActive() {
+		return false
+	}
+	// a replica always applies the change of the raft members adding itself
+	return mr.ApplyID > 0 && mr.ApplyID >= applyID
+}
+
+func (c *Cluster) getMetaBalancerView() (view *proto.BalancerView) {
+	nodes, avg := c.metaBalanceNodes()
+	view = &proto.BalancerView{AvgUsage: avg, MetaNodes: make([]*proto.MetaNodeMemView, 0, len(nodes))}
+	minUsage, maxUsage := 1.0, 0.0
+	for _, n := range nodes {
+		nv := &proto.MetaNodeMemView{Addr: n.addr, Total: n.total, Used: n.used, UsageRatio: n.usage,
+			Partitions: make([]*proto.MetaPartitionMemView, 0, len(n.reports))}
+		for _, r := range n.reports {
+			nv.Partitions = append(nv.Partitions, &proto.MetaPartitionMemView{PartitionID: r.PartitionID, VolName: r.VolName,
+				InodeCount: r.InodeCount, DentryCount: r.DentryCount, MemSize: r.MemSize})
+		}
+		sort.Slice(nv.Partitions, func(i, j int) bool { return nv.Partitions[i].MemSize > nv.Partitions[j].MemSize })
+		view.MetaNodes = append(view.MetaNodes, nv)
+		if n.usage < minUsage {
+			minUsage = n.usage
+		}
+		if n.usage > maxUsage {
+			maxUsage = n.usage
+		}
+	}
+	if maxUsage > minUsage {
+		view.Skew = maxUsage - minUsage
+	}
+	c.metaBalancer.fillView(view)
+	return
+}
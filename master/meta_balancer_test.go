@@ -0,0 +1,86 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestPlanMetaBalanceMoves(t *testing.T) {
+	heavy := &metaBalanceNode{
+		addr:      "192.168.0.1:9021",
+		nodeSetID: 1,
+		total:     10 * util.GB,
+		used:      9 * util.GB,
+		usage:     0.9,
+		reports: []*proto.MetaPartitionReport{
+			{PartitionID: 1, MemSize: 500 * util.MB},
+			{PartitionID: 2, MemSize: 3 * util.GB},
+			{PartitionID: 3, MemSize: 1 * util.GB},
+			{PartitionID: 4},
+		},
+	}
+	other := &metaBalanceNode{
+		addr:      "192.168.0.2:9021",
+		nodeSetID: 2,
+		total:     10 * util.GB,
+		used:      1 * util.GB,
+		usage:     0.1,
+		writable:  true,
+	}
+	sameSet := &metaBalanceNode{
+		addr:      "192.168.0.3:9021",
+		nodeSetID: 1,
+		total:     10 * util.GB,
+		used:      2 * util.GB,
+		usage:     0.2,
+		writable:  true,
+		reports:   []*proto.MetaPartitionReport{{PartitionID: 3, MemSize: 1 * util.GB}},
+	}
+	nodes := []*metaBalanceNode{heavy, other, sameSet}
+
+	// the largest partition fitting in the room below the average is moved, preferring the same node set
+	moves := planMetaBalanceMoves(nodes, 0.4, 0.1, 4, make(map[string]bool), make(map[uint64]bool))
+	if len(moves) != 1 {
+		t.Errorf("expect one move for one source node, got %v", len(moves))
+		return
+	}
+	if m := moves[0]; m.partitionID != 2 || m.src != heavy.addr || m.dst != other.addr {
+		t.Errorf("unexpected move %+v", m)
+		return
+	}
+
+	// the busy nodes and partitions are skipped, and a node hosting the partition is not a destination
+	busyNodes := map[string]bool{other.addr: true}
+	busyPartitions := map[uint64]bool{2: true}
+	moves = planMetaBalanceMoves(nodes, 0.4, 0.1, 4, busyNodes, busyPartitions)
+	if len(moves) != 1 || moves[0].partitionID != 1 || moves[0].dst != sameSet.addr {
+		t.Errorf("unexpected moves %v", moves)
+		return
+	}
+
+	// nothing is moved if the skew is within the threshold
+	if moves = planMetaBalanceMoves(nodes, 0.4, 0.6, 4, make(map[string]bool), make(map[uint64]bool)); len(moves) != 0 {
+		t.Errorf("expect no moves, got %v", len(moves))
+	}
+}
+
+func TestMetaBalancer(t *testing.T) {
+	reqURL := fmt.Sprintf("%v%v?threshold=%v&concurrency=%v", hostAddr, proto.AdminStartMetaBalancer, 0.3, 1)
+	process(reqURL, t)
+	view := server.cluster.getMetaBalancerView()
+	if !view.Enabled || view.Threshold != 0.3 || view.Concurrency != 1 {
+		t.Errorf("unexpected meta balancer %+v", view)
+		return
+	}
+	if server.cluster.getBalancerView().Threshold == 0.3 {
+		t.Errorf("expect the balancer of the data nodes to be kept")
+	}
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminGetMetaBalancer), t)
+	process(fmt.Sprintf("%v%v", hostAddr, proto.AdminStopMetaBalancer), t)
+	if server.cluster.getMetaBalancerView().Enabled {
+		t.Errorf("expect meta balancer to be stopped")
+	}
+}
@@ -46,7 +46,7 @@ type MetaNode struct {
 func newMetaNode(addr, clusterID string) (node *MetaNode) {
 	return &MetaNode{
 		Addr:   addr,
-		Sender: newAdminTaskManager(addr, clusterID),
+		Sender: newAdminTaskManager(addr, clusterID, proto.MetaServiceID),
 		Carry:  rand.Float64(),
 	}
 }
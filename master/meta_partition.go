@@ -34,6 +34,7 @@ type MetaReplica struct {
 	ReportTime int64
 	Status     int8 // unavailable, readOnly, readWrite
 	IsLeader   bool
+	ApplyID    uint64 // the index of the raft log applied, with which a new replica is known to catch up
 	metaNode   *MetaNode
 }
 
@@ -52,6 +53,8 @@ type MetaPartition struct {
 	Peers        []proto.Peer
 	MissNodes    map[string]int64
 	LoadResponse []*proto.MetaPartitionLoadResponse
+	quotaUsages  []*proto.QuotaUsage // reported by the leader
+	largeDirs    []uint64            // directories over the threshold of sharding, reported by the leader
 	sync.RWMutex
 }
 
@@ -321,6 +324,12 @@ func (mp *MetaPartition) updateMetaPartition(mgr *proto.MetaPartitionReport, met
 		mp.addReplica(mr)
 	}
 	mp.MaxInodeID = mgr.MaxInodeID
+	if mgr.IsLeader && mgr.QuotaUsages != nil {
+		mp.quotaUsages = mgr.QuotaUsages
+	}
+	if mgr.IsLeader {
+		mp.largeDirs = mgr.LargeDirs
+	}
 	mr.updateMetric(mgr)
 	mp.removeMissingReplica(metaNode.Addr)
 }
@@ -588,6 +597,7 @@ func (mr *MetaReplica) setLastReportTime() {
 func (mr *MetaReplica) updateMetric(mgr *proto.MetaPartitionReport) {
 	mr.Status = (int8)(mgr.Status)
 	mr.IsLeader = mgr.IsLeader
+	mr.ApplyID = mgr.ApplyID
 	mr.setLastReportTime()
 }
 
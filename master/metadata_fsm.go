@@ -118,7 +118,8 @@ func (mf *MetadataFsm) Apply(command []byte, index uint64) (resp interface{}, er
 		cmdMap[applied] = []byte(strconv.FormatUint(uint64(index), 10))
 	}
 	switch cmd.Op {
-	case opSyncDeleteDataNode, opSyncDeleteMetaNode, opSyncDeleteVol, opSyncDeleteDataPartition, opSyncDeleteMetaPartition:
+	case opSyncDeleteDataNode, opSyncDeleteMetaNode, opSyncDeleteVol, opSyncDeleteDataPartition, opSyncDeleteMetaPartition,
+		opSyncDeleteJob:
 		if err = mf.delKeyAndPutIndex(cmd.K, cmdMap); err != nil {
 			panic(err)
 		}
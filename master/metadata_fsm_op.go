@@ -30,9 +30,15 @@ import (
    transferred over the network. */
 
 type clusterValue struct {
-	Name                string
-	Threshold           float32
-	DisableAutoAllocate bool
+	Name                   string
+	Threshold              float32
+	DisableAutoAllocate    bool
+	BalancerEnabled        bool
+	BalanceThreshold       float64
+	BalanceConcurrency     int
+	MetaBalancerEnabled    bool
+	MetaBalanceThreshold   float64
+	MetaBalanceConcurrency int
 }
 
 func newClusterValue(c *Cluster) (cv *clusterValue) {
@@ -41,6 +47,16 @@ func newClusterValue(c *Cluster) (cv *clusterValue) {
 		Threshold:           c.cfg.MetaNodeThreshold,
 		DisableAutoAllocate: c.DisableAutoAllocate,
 	}
+	c.balancer.RLock()
+	cv.BalancerEnabled = c.balancer.enabled
+	cv.BalanceThreshold = c.balancer.threshold
+	cv.BalanceConcurrency = c.balancer.concurrency
+	c.balancer.RUnlock()
+	c.metaBalancer.RLock()
+	cv.MetaBalancerEnabled = c.metaBalancer.enabled
+	cv.MetaBalanceThreshold = c.metaBalancer.threshold
+	cv.MetaBalanceConcurrency = c.metaBalancer.concurrency
+	c.metaBalancer.RUnlock()
 	return cv
 }
 
@@ -80,6 +96,10 @@ type dataPartitionValue struct {
 	VolID       uint64
 	VolName     string
 	Replicas    []*replicaValue
+	EcDataNum   uint8
+	EcParityNum uint8
+	MediaType   string
+	Cold        bool
 }
 
 type replicaValue struct {
@@ -97,6 +117,10 @@ func newDataPartitionValue(dp *DataPartition) (dpv *dataPartitionValue) {
 		VolID:       dp.VolID,
 		VolName:     dp.VolName,
 		Replicas:    make([]*replicaValue, 0),
+		EcDataNum:   dp.EcDataNum,
+		EcParityNum: dp.EcParityNum,
+		MediaType:   dp.MediaType,
+		Cold:        dp.Cold,
 	}
 	for _, replica := range dp.Replicas {
 		rv := &replicaValue{Addr: replica.Addr, DiskPath: replica.DiskPath}
@@ -115,6 +139,17 @@ type volValue struct {
 	Capacity          uint64
 	Owner             string
 	FollowerRead      bool
+	Quotas            []*bsProto.QuotaInfo
+	MaxQuotaID        uint32
+	Snapshots         []*bsProto.SnapshotInfo
+	TrashRetention    uint32
+	EcDataNum         uint8
+	EcParityNum       uint8
+	EcMigrateDays     uint32
+	MediaType         string
+	ColdMediaType     string
+	ColdAfterDays     uint32
+	DirShards         []*bsProto.DirShardInfo
 }
 
 func newVolValue(vol *Vol) (vv *volValue) {
@@ -128,6 +163,17 @@ func newVolValue(vol *Vol) (vv *volValue) {
 		Capacity:          vol.Capacity,
 		Owner:             vol.Owner,
 		FollowerRead:      vol.FollowerRead,
+		Quotas:            vol.quotaLimits(),
+		MaxQuotaID:        vol.maxQuotaID,
+		Snapshots:         vol.snapshotList(),
+		TrashRetention:    vol.TrashRetention,
+		EcDataNum:         vol.EcDataNum,
+		EcParityNum:       vol.EcParityNum,
+		EcMigrateDays:     vol.EcMigrateDays,
+		MediaType:         vol.MediaType,
+		ColdMediaType:     vol.ColdMediaType,
+		ColdAfterDays:     vol.ColdAfterDays,
+		DirShards:         vol.dirShardList(),
 	}
 	return
 }
@@ -215,6 +261,8 @@ func (m *RaftCmd) setOpType() {
 		m.Op = opSyncPutCluster
 	case nodeSetAcronym:
 		m.Op = opSyncAddNodeSet
+	case jobAcronym:
+		m.Op = opSyncAddJob
 	case maxDataPartitionIDKey:
 		m.Op = opSyncAllocDataPartitionID
 	case maxMetaPartitionIDKey:
@@ -409,6 +457,32 @@ func (c *Cluster) syncPutDataNodeInfo(opType uint32, dataNode *DataNode) (err er
 	return c.submit(metadata)
 }
 
+// key=#job#id,value = json.Marshal(job)
+func (c *Cluster) syncAddJob(job *bsProto.Job) (err error) {
+	return c.syncPutJob(opSyncAddJob, job)
+}
+
+func (c *Cluster) syncUpdateJob(job *bsProto.Job) (err error) {
+	return c.syncPutJob(opSyncUpdateJob, job)
+}
+
+func (c *Cluster) syncDeleteJob(job *bsProto.Job) (err error) {
+	return c.syncPutJob(opSyncDeleteJob, job)
+}
+
+func (c *Cluster) syncPutJob(opType uint32, job *bsProto.Job) (err error) {
+	metadata := new(RaftCmd)
+	metadata.Op = opType
+	metadata.K = jobPrefix + strconv.FormatUint(job.ID, 10)
+	c.jobs.RLock()
+	metadata.V, err = json.Marshal(job)
+	c.jobs.RUnlock()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	return c.submit(metadata)
+}
+
 func (c *Cluster) addRaftNode(nodeID uint64, addr string) (err error) {
 	peer := proto.Peer{ID: nodeID}
 	_, err = c.partition.ChangeMember(proto.ConfAddNode, peer, []byte(addr))
@@ -441,6 +515,8 @@ func (c *Cluster) loadClusterValue() (err error) {
 		}
 		c.cfg.MetaNodeThreshold = cv.Threshold
 		c.DisableAutoAllocate = cv.DisableAutoAllocate
+		c.balancer.load(cv.BalancerEnabled, cv.BalanceThreshold, cv.BalanceConcurrency)
+		c.metaBalancer.load(cv.MetaBalancerEnabled, cv.MetaBalanceThreshold, cv.MetaBalanceConcurrency)
 		log.LogInfof("action[loadClusterValue], metaNodeThreshold[%v]", cv.Threshold)
 	}
 	return
@@ -524,6 +600,16 @@ func (c *Cluster) loadVols() (err error) {
 		}
 		vol := newVol(vv.ID, vv.Name, vv.Owner, vv.DataPartitionSize, vv.Capacity, vv.DpReplicaNum, vv.ReplicaNum, vv.FollowerRead)
 		vol.Status = vv.Status
+		vol.loadQuotas(vv.Quotas, vv.MaxQuotaID)
+		vol.loadSnapshots(vv.Snapshots)
+		vol.TrashRetention = vv.TrashRetention
+		vol.EcDataNum = vv.EcDataNum
+		vol.EcParityNum = vv.EcParityNum
+		vol.EcMigrateDays = vv.EcMigrateDays
+		vol.MediaType = vv.MediaType
+		vol.ColdMediaType = vv.ColdMediaType
+		vol.ColdAfterDays = vv.ColdAfterDays
+		vol.loadDirShards(vv.DirShards)
 		c.putVol(vol)
 		log.LogInfof("action[loadVols],vol[%v]", vol.Name)
 	}
@@ -586,6 +672,10 @@ func (c *Cluster) loadDataPartitions() (err error) {
 		dp := newDataPartition(dpv.PartitionID, dpv.ReplicaNum, dpv.VolName, dpv.VolID)
 		dp.Hosts = strings.Split(dpv.Hosts, underlineSeparator)
 		dp.Peers = dpv.Peers
+		dp.EcDataNum = dpv.EcDataNum
+		dp.EcParityNum = dpv.EcParityNum
+		dp.MediaType = dpv.MediaType
+		dp.Cold = dpv.Cold
 		for _, rv := range dpv.Replicas {
 			dp.afterCreation(rv.Addr, rv.DiskPath, c)
 		}
@@ -594,3 +684,21 @@ func (c *Cluster) loadDataPartitions() (err error) {
 	}
 	return
 }
+
+func (c *Cluster) loadJobs() (err error) {
+	result, err := c.fsm.store.SeekForPrefix([]byte(jobPrefix))
+	if err != nil {
+		err = fmt.Errorf("action[loadJobs],err:%v", err.Error())
+		return err
+	}
+	for _, value := range result {
+		job := &bsProto.Job{}
+		if err = json.Unmarshal(value, job); err != nil {
+			err = fmt.Errorf("action[loadJobs],value:%v,unmarshal err:%v", string(value), err)
+			return err
+		}
+		c.jobs.put(job)
+		log.LogInfof("action[loadJobs],%v", job)
+	}
+	return
+}
@@ -17,11 +17,13 @@ type MockMetaServer struct {
 	NodeID     uint64
 	TcpAddr    string
 	partitions map[uint64]*MockMetaPartition // Key: metaRangeId, Val: metaPartition
+	dirShards  map[uint64][]uint64           // Key: inode of the split directory, Val: partitions of the shards
 	sync.RWMutex
 }
 
 func NewMockMetaServer(addr string) *MockMetaServer {
-	mms := &MockMetaServer{TcpAddr: addr, partitions: make(map[uint64]*MockMetaPartition, 0)}
+	mms := &MockMetaServer{TcpAddr: addr, partitions: make(map[uint64]*MockMetaPartition, 0),
+		dirShards: make(map[uint64][]uint64)}
 	return mms
 }
 
@@ -118,6 +120,12 @@ func (mms *MockMetaServer) serveConn(rc net.Conn) {
 	case proto.OpMetaPartitionTryToLeader:
 		err = mms.handleTryToLeader(conn, req, adminTask)
 		fmt.Printf("meta node [%v] try to leader,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpMetaSplitDir:
+		err = mms.handleSplitDir(conn, req, adminTask)
+		fmt.Printf("meta node [%v] split dir,id[%v],err:%v\n", mms.TcpAddr, adminTask.ID, err)
+	case proto.OpCreateMetaSnapshot, proto.OpDeleteMetaSnapshot, proto.OpMetaApplyQuota:
+		responseAckOKToMaster(conn, req, nil)
+		fmt.Printf("meta node [%v] %v,id[%v]\n", mms.TcpAddr, req.GetOpMsg(), adminTask.ID)
 	default:
 		fmt.Printf("unknown code [%v]\n", req.Opcode)
 	}
@@ -138,6 +146,33 @@ func (mms *MockMetaServer) handleTryToLeader(conn net.Conn, p *proto.Packet, adm
 	return
 }
 
+// The directory split already keeps its shards, like the metanode.
+func (mms *MockMetaServer) handleSplitDir(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
+	requestJson, err := json.Marshal(adminTask.Request)
+	if err != nil {
+		responseAckErrToMaster(conn, p, err)
+		return
+	}
+	req := &proto.SplitDirRequest{}
+	if err = json.Unmarshal(requestJson, req); err != nil {
+		responseAckErrToMaster(conn, p, err)
+		return
+	}
+	mms.Lock()
+	pids, ok := mms.dirShards[req.Inode]
+	if !ok {
+		pids = req.PartitionIDs
+		mms.dirShards[req.Inode] = pids
+	}
+	mms.Unlock()
+	data, err := json.Marshal(&proto.DirShardInfo{Inode: req.Inode, PartitionIDs: pids})
+	if err != nil {
+		responseAckErrToMaster(conn, p, err)
+		return
+	}
+	return responseAckOKToMaster(conn, p, data)
+}
+
 func (mms *MockMetaServer) handleCreateMetaPartition(conn net.Conn, p *proto.Packet, adminTask *proto.AdminTask) (err error) {
 	defer func() {
 		if err != nil {
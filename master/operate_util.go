@@ -28,7 +28,7 @@ import (
 	"time"
 )
 
-func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Peer, dataPartitionSize int, hosts []string, createType int) (req *proto.CreateDataPartitionRequest) {
+func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Peer, dataPartitionSize int, hosts []string, createType int, ecDataNum, ecParityNum uint8, mediaType string) (req *proto.CreateDataPartitionRequest) {
 	req = &proto.CreateDataPartitionRequest{
 		PartitionId:   ID,
 		PartitionSize: dataPartitionSize,
@@ -36,6 +36,9 @@ func newCreateDataPartitionRequest(volName string, ID uint64, members []proto.Pe
 		Members:       members,
 		Hosts:         hosts,
 		CreateType:    createType,
+		EcDataNum:     ecDataNum,
+		EcParityNum:   ecParityNum,
+		MediaType:     mediaType,
 	}
 	return
 }
@@ -102,6 +105,8 @@ func unmarshalTaskResponse(task *proto.AdminTask) (err error) {
 		response = &proto.UpdateMetaPartitionResponse{}
 	case proto.OpDecommissionMetaPartition:
 		response = &proto.MetaPartitionDecommissionResponse{}
+	case proto.OpEcReconstructDataPartition:
+		response = &proto.EcReconstructResponse{}
 	default:
 		log.LogError(fmt.Sprintf("unknown operate code(%v)", task.OpCode))
 	}
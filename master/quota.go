@@ -0,0 +1,226 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The quotas of a volume only keep the limits, the usage is reported by the leaders of the meta
+// partitions and aggregated on demand.
+
+func (vol *Vol) quotaLimits() (quotas []*proto.QuotaInfo) {
+	quotas = make([]*proto.QuotaInfo, 0, len(vol.quotas))
+	for _, q := range vol.quotas {
+		quotas = append(quotas, &proto.QuotaInfo{
+			QuotaID:   q.QuotaID,
+			RootInode: q.RootInode,
+			MaxFiles:  q.MaxFiles,
+			MaxBytes:  q.MaxBytes,
+		})
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].QuotaID < quotas[j].QuotaID })
+	return
+}
+
+func (vol *Vol) loadQuotas(quotas []*proto.QuotaInfo, maxQuotaID uint32) {
+	vol.maxQuotaID = maxQuotaID
+	for _, q := range quotas {
+		vol.quotas[q.QuotaID] = q
+	}
+}
+
+// getQuotas returns the quotas of the volume along with their usage.
+func (vol *Vol) getQuotas() (quotas []*proto.QuotaInfo) {
+	vol.RLock()
+	quotas = vol.quotaLimits()
+	vol.RUnlock()
+	if len(quotas) == 0 {
+		return
+	}
+	index := make(map[uint32]*proto.QuotaInfo, len(quotas))
+	for _, q := range quotas {
+		index[q.QuotaID] = q
+	}
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	for _, mp := range vol.MetaPartitions {
+		mp.RLock()
+		for _, usage := range mp.quotaUsages {
+			if q, ok := index[usage.QuotaID]; ok {
+				q.UsedFiles += usage.Files
+				q.UsedBytes += usage.Bytes
+			}
+		}
+		mp.RUnlock()
+	}
+	return
+}
+
+func (vol *Vol) getQuota(quotaID uint32) (quota *proto.QuotaInfo, err error) {
+	for _, q := range vol.getQuotas() {
+		if q.QuotaID == quotaID {
+			return q, nil
+		}
+	}
+	return nil, proto.ErrQuotaNotExists
+}
+
+// setQuota creates a quota if quotaID is 0, otherwise updates the limits of the quota. The inodes already
+// beneath the root inode are then accounted to the quota by the meta partitions. Accounting an inode twice
+// takes no effect, so updating the limits accounts the inodes again in case the last time failed.
+func (c *Cluster) setQuota(name, authKey string, quotaID uint32, rootInode, maxFiles, maxBytes uint64) (id uint32, err error) {
+	var vol *Vol
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[setQuota] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	if id, rootInode, err = c.putQuota(vol, authKey, quotaID, rootInode, maxFiles, maxBytes); err != nil {
+		if err == proto.ErrVolAuthKeyNotMatch || err == proto.ErrQuotaNotExists {
+			return
+		}
+		goto errHandler
+	}
+	if err = c.applyQuota(vol, id, rootInode); err != nil {
+		err = fmt.Errorf("quota[%v] is set but the existing inodes are not accounted, set it again to retry: %v", id, err)
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[setQuota], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (c *Cluster) putQuota(vol *Vol, authKey string, quotaID uint32, rootInode, maxFiles, maxBytes uint64) (id uint32, root uint64, err error) {
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return 0, 0, proto.ErrVolAuthKeyNotMatch
+	}
+	oldMaxID := vol.maxQuotaID
+	old, exist := vol.quotas[quotaID]
+	if quotaID == 0 {
+		for _, q := range vol.quotas {
+			if q.RootInode == rootInode {
+				return 0, 0, fmt.Errorf("quota[%v] already exists on inode[%v]", q.QuotaID, rootInode)
+			}
+		}
+		vol.maxQuotaID++
+		quotaID = vol.maxQuotaID
+	} else if !exist {
+		return 0, 0, proto.ErrQuotaNotExists
+	} else {
+		rootInode = old.RootInode
+	}
+	vol.quotas[quotaID] = &proto.QuotaInfo{QuotaID: quotaID, RootInode: rootInode, MaxFiles: maxFiles, MaxBytes: maxBytes}
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.maxQuotaID = oldMaxID
+		if exist {
+			vol.quotas[quotaID] = old
+		} else {
+			delete(vol.quotas, quotaID)
+		}
+		log.LogErrorf("action[putQuota] vol[%v] err[%v]", vol.Name, err)
+		return 0, 0, proto.ErrPersistenceByRaft
+	}
+	return quotaID, rootInode, nil
+}
+
+func (mp *MetaPartition) createTaskToApplyQuota(quotaID uint32, rootInode uint64) (t *proto.AdminTask, err error) {
+	mr, err := mp.getMetaReplicaLeader()
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	req := &proto.ApplyQuotaRequest{
+		VolName:     mp.volName,
+		PartitionID: mp.PartitionID,
+		QuotaID:     quotaID,
+		Inodes:      []uint64{rootInode},
+		Dirs:        []uint64{rootInode},
+	}
+	t = proto.NewAdminTask(proto.OpMetaApplyQuota, mr.Addr, req)
+	resetMetaPartitionTaskID(t, mp.PartitionID)
+	return
+}
+
+// applyQuota makes the partition of the root inode account the inodes beneath it to the quota, which walks
+// the directory tree along with the other partitions in the background.
+func (c *Cluster) applyQuota(vol *Vol, quotaID uint32, rootInode uint64) (err error) {
+	var (
+		mp       *MetaPartition
+		task     *proto.AdminTask
+		metaNode *MetaNode
+	)
+	if mp = vol.metaPartitionOfInode(rootInode); mp == nil {
+		return proto.ErrMetaPartitionNotExists
+	}
+	mp.RLock()
+	task, err = mp.createTaskToApplyQuota(quotaID, rootInode)
+	mp.RUnlock()
+	if err != nil {
+		return
+	}
+	if metaNode, err = c.metaNode(task.OperatorAddr); err != nil {
+		return
+	}
+	if _, err = metaNode.Sender.syncSendAdminTask(task); err != nil {
+		return
+	}
+	log.LogInfof("action[applyQuota] vol[%v] quota[%v] ino[%v]", vol.Name, quotaID, rootInode)
+	return
+}
+
+func (c *Cluster) deleteQuota(name, authKey string, quotaID uint32) (err error) {
+	var (
+		vol *Vol
+		old *proto.QuotaInfo
+		ok  bool
+	)
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[deleteQuota] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	if old, ok = vol.quotas[quotaID]; !ok {
+		return proto.ErrQuotaNotExists
+	}
+	// the quota IDs are never reused, so the inodes accounted to a deleted quota are simply ignored
+	delete(vol.quotas, quotaID)
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.quotas[quotaID] = old
+		log.LogErrorf("action[deleteQuota] vol[%v] err[%v]", name, err)
+		err = proto.ErrPersistenceByRaft
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[deleteQuota], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
@@ -0,0 +1,90 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestQuota(t *testing.T) {
+	name := "quotaVol"
+	vol := newVol(10000, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	addr := "127.0.0.1:8111"
+	addMetaServer(addr)
+	time.Sleep(time.Second)
+	metaNode, err := server.cluster.metaNode(addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := uint64(1); i <= 2; i++ {
+		mp := newMetaPartition(10000+i, (i-1)*defaultMetaPartitionInodeIDStep, i*defaultMetaPartitionInodeIDStep, 3, name, vol.ID)
+		mp.quotaUsages = []*proto.QuotaUsage{{QuotaID: 1, Files: 60, Bytes: 512}}
+		mr := newMetaReplica(mp.Start, mp.End, metaNode)
+		mr.IsLeader = true
+		mp.addReplica(mr)
+		vol.addMetaPartition(mp)
+	}
+	server.cluster.putVol(vol)
+
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&inode=%v&maxFiles=%v&maxBytes=%v",
+		hostAddr, proto.AdminSetQuota, name, buildAuthKey("cfs"), proto.RootIno, 100, 1024)
+	reply := process(reqURL, t)
+	if reply == nil {
+		return
+	}
+	quotaID := uint32(reply.Data.(float64))
+	if quotaID != 1 {
+		t.Errorf("expect quota id 1, but is %v", quotaID)
+		return
+	}
+	if _, err = server.cluster.setQuota(name, buildAuthKey("cfs"), 0, proto.RootIno, 1, 1); err == nil {
+		t.Errorf("expect duplicated quota on inode[%v] to fail", proto.RootIno)
+		return
+	}
+
+	// the quota is kept if the existing inodes fail to be accounted, which is retried by setting it again
+	missing := 2*defaultMetaPartitionInodeIDStep + 1
+	if _, err = server.cluster.setQuota(name, buildAuthKey("cfs"), 0, missing, 1, 1); err == nil {
+		t.Errorf("expect applying the quota on inode[%v] out of the partitions to fail", missing)
+		return
+	}
+	if _, err = vol.getQuota(quotaID + 1); err != nil {
+		t.Errorf("expect quota[%v] to be kept, err[%v]", quotaID+1, err)
+		return
+	}
+	if _, err = server.cluster.setQuota(name, buildAuthKey("cfs"), quotaID+1, 0, 2, 2); err == nil {
+		t.Errorf("expect applying the quota on inode[%v] out of the partitions to fail again", missing)
+		return
+	}
+	if err = server.cluster.deleteQuota(name, buildAuthKey("cfs"), quotaID+1); err != nil {
+		t.Error(err)
+		return
+	}
+
+	quota, err := vol.getQuota(quotaID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if quota.UsedFiles != 120 || quota.UsedBytes != 1024 {
+		t.Errorf("unexpected usage of quota %v", quota)
+		return
+	}
+	if !quota.Exceeded() {
+		t.Errorf("expect quota %v to be exceeded", quota)
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminListQuota, name)
+	process(reqURL, t)
+
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&id=%v",
+		hostAddr, proto.AdminDeleteQuota, name, buildAuthKey("cfs"), quotaID)
+	process(reqURL, t)
+	if _, err = vol.getQuota(quotaID); err != proto.ErrQuotaNotExists {
+		t.Errorf("expect quota[%v] to be deleted, err[%v]", quotaID, err)
+	}
+}
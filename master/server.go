@@ -23,7 +23,9 @@ import (
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -73,6 +75,8 @@ type Server struct {
 	wg           sync.WaitGroup
 	reverseProxy *httputil.ReverseProxy
 	metaReady    bool
+	authenticate bool
+	serviceKey   []byte
 }
 
 // NewServer creates a new server
@@ -208,6 +212,20 @@ func (m *Server) checkConfig(cfg *config.Config) (err error) {
 			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
 		}
 	}
+	if m.authenticate = cfg.GetBool(cfgAuthenticate); m.authenticate {
+		if m.serviceKey, err = cryptoutil.Base64Decode(cfg.GetString(cfgServiceKey)); err != nil || len(m.serviceKey) == 0 {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, "invalid serviceKey")
+		}
+	}
+	if authNodes := cfg.GetArray(cfgAuthNodes); len(authNodes) > 0 {
+		addrs := make([]string, 0, len(authNodes))
+		for _, addr := range authNodes {
+			addrs = append(addrs, addr.(string))
+		}
+		if taskAuthenticator, err = auth.NewAuthenticator(addrs, cfg.GetString(cfgClientID), cfg.GetString(cfgClientKey), ""); err != nil {
+			return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+		}
+	}
 	m.tickInterval = int(cfg.GetFloat(cfgTickInterval))
 	m.electionTick = int(cfg.GetFloat(cfgElectionTick))
 	if m.tickInterval <= 300 {
@@ -0,0 +1,273 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A snapshot of a volume is taken by each meta partition, which freezes its inode and dentry trees
+// on the admin task of the master. The extents referenced by a snapshot are kept by the metanodes
+// until the snapshot is deleted.
+//
+// The extents must not be overwritten in place once a snapshot is taken. The clients turn on
+// copy-on-write when they see a snapshot in the volume view, which they refresh every minute, so a
+// snapshot is first recorded as being created, and the meta partitions take it only after the clients
+// have had the time to refresh twice. The leader takes the snapshots in the background, so that the
+// ones recorded by an old leader are taken as well.
+//
+// The meta partitions take a snapshot one after another, so it is not consistent across them. The
+// changes made while the snapshot is being taken, including a rename moving a dentry from one partition
+// to another, may be in the snapshot of one partition and not in the one of the other.
+
+// The time the clients are given to turn on copy-on-write before a snapshot is taken.
+var snapshotCopyOnWriteDelay = 2 * time.Minute
+
+func (vol *Vol) snapshotList() (snapshots []*proto.SnapshotInfo) {
+	snapshots = make([]*proto.SnapshotInfo, 0, len(vol.snapshots))
+	for _, s := range vol.snapshots {
+		snapshot := *s
+		snapshots = append(snapshots, &snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return
+}
+
+func (vol *Vol) loadSnapshots(snapshots []*proto.SnapshotInfo) {
+	for _, s := range snapshots {
+		vol.snapshots[s.ID] = s
+	}
+}
+
+// getSnapshots returns the snapshots of the volume sorted by ID.
+func (vol *Vol) getSnapshots() []*proto.SnapshotInfo {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.snapshotList()
+}
+
+func (vol *Vol) hasSnapshots() bool {
+	vol.RLock()
+	defer vol.RUnlock()
+	return len(vol.snapshots) > 0
+}
+
+func (vol *Vol) getSnapshotByName(snapName string) (snapshot *proto.SnapshotInfo, err error) {
+	for _, s := range vol.getSnapshots() {
+		if s.Name == snapName {
+			return s, nil
+		}
+	}
+	return nil, proto.ErrSnapshotNotExists
+}
+
+func (mp *MetaPartition) createTaskToSnapshot(opCode uint8, snapshotID uint64) (t *proto.AdminTask, err error) {
+	mr, err := mp.getMetaReplicaLeader()
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	req := &proto.MetaSnapshotRequest{PartitionID: mp.PartitionID, SnapshotID: snapshotID}
+	t = proto.NewAdminTask(opCode, mr.Addr, req)
+	resetMetaPartitionTaskID(t, mp.PartitionID)
+	return
+}
+
+// Send the snapshot task to the leaders of all the meta partitions of the volume.
+func (c *Cluster) syncSnapshotToMetaPartitions(vol *Vol, opCode uint8, snapshotID uint64) (err error) {
+	vol.mpsLock.RLock()
+	mps := make([]*MetaPartition, 0, len(vol.MetaPartitions))
+	for _, mp := range vol.MetaPartitions {
+		mps = append(mps, mp)
+	}
+	vol.mpsLock.RUnlock()
+	for _, mp := range mps {
+		var (
+			task     *proto.AdminTask
+			metaNode *MetaNode
+		)
+		mp.RLock()
+		task, err = mp.createTaskToSnapshot(opCode, snapshotID)
+		mp.RUnlock()
+		if err != nil {
+			return fmt.Errorf("meta partition[%v]: %v", mp.PartitionID, err)
+		}
+		if metaNode, err = c.metaNode(task.OperatorAddr); err != nil {
+			return fmt.Errorf("meta partition[%v]: %v", mp.PartitionID, err)
+		}
+		if _, err = metaNode.Sender.syncSendAdminTask(task); err != nil {
+			return fmt.Errorf("meta partition[%v]: %v", mp.PartitionID, err)
+		}
+	}
+	return
+}
+
+func (c *Cluster) createSnapshot(name, authKey, snapName string) (snapshot *proto.SnapshotInfo, err error) {
+	var (
+		vol *Vol
+		id  uint64
+	)
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[createSnapshot] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return nil, proto.ErrVolAuthKeyNotMatch
+	}
+	if _, err = vol.getSnapshotByName(snapName); err == nil {
+		return nil, fmt.Errorf("snapshot[%v] already exists", snapName)
+	}
+	if id, err = c.idAlloc.allocateCommonID(); err != nil {
+		goto errHandler
+	}
+	// the snapshot is recorded before it is taken, so that the clients turn on copy-on-write in time
+	snapshot = &proto.SnapshotInfo{ID: id, Name: snapName, CreateTime: time.Now().Unix(), Status: proto.SnapshotCreating}
+	if err = c.putSnapshot(vol, snapshot); err != nil {
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[createSnapshot], clusterID[%v] name:%v, snapshot:%v, err:%v ", c.Name, name, snapName, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (c *Cluster) scheduleToTakeSnapshots() {
+	go func() {
+		for {
+			if c.partition != nil && c.partition.IsRaftLeader() {
+				c.takeSnapshots()
+			}
+			time.Sleep(time.Second * intervalToTakeSnapshots)
+		}
+	}()
+}
+
+// takeSnapshots takes the snapshots being created, once the clients have had the time to turn on copy-on-write.
+func (c *Cluster) takeSnapshots() {
+	deadline := time.Now().Add(-snapshotCopyOnWriteDelay).Unix()
+	for _, vol := range c.allVols() {
+		for _, s := range vol.getSnapshots() {
+			if s.Status == proto.SnapshotCreating && s.CreateTime <= deadline {
+				c.takeSnapshot(vol, s)
+			}
+		}
+	}
+}
+
+// takeSnapshot takes the snapshot on all the meta partitions of the volume. The snapshot is removed if it fails,
+// unless it cannot be deleted from the meta partitions, in which case it is taken again later.
+func (c *Cluster) takeSnapshot(vol *Vol, snapshot *proto.SnapshotInfo) (err error) {
+	c.snapshotMutex.Lock()
+	defer c.snapshotMutex.Unlock()
+	// the snapshot may be deleted in the meantime
+	if s, e := vol.getSnapshotByName(snapshot.Name); e != nil || s.ID != snapshot.ID || s.Status != proto.SnapshotCreating {
+		return
+	}
+	if err = c.syncSnapshotToMetaPartitions(vol, proto.OpCreateMetaSnapshot, snapshot.ID); err != nil {
+		if e := c.syncSnapshotToMetaPartitions(vol, proto.OpDeleteMetaSnapshot, snapshot.ID); e != nil {
+			log.LogWarnf("action[takeSnapshot] vol[%v] snapshot[%v] roll back err[%v]", vol.Name, snapshot.ID, e)
+			goto errHandler
+		}
+		if e := c.removeSnapshot(vol, snapshot.ID); e != nil {
+			log.LogWarnf("action[takeSnapshot] vol[%v] snapshot[%v] roll back err[%v]", vol.Name, snapshot.ID, e)
+		}
+		goto errHandler
+	}
+	if err = c.putSnapshot(vol, &proto.SnapshotInfo{ID: snapshot.ID, Name: snapshot.Name, CreateTime: snapshot.CreateTime,
+		Status: proto.SnapshotNormal}); err != nil {
+		goto errHandler
+	}
+	log.LogInfof("action[takeSnapshot] vol[%v] snapshot[%v] taken", vol.Name, snapshot.Name)
+	return
+errHandler:
+	err = fmt.Errorf("action[takeSnapshot], clusterID[%v] name:%v, snapshot:%v, err:%v ", c.Name, vol.Name, snapshot.Name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (c *Cluster) deleteSnapshot(name, authKey, snapName string) (err error) {
+	var (
+		vol      *Vol
+		snapshot *proto.SnapshotInfo
+	)
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[deleteSnapshot] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	c.snapshotMutex.Lock()
+	defer c.snapshotMutex.Unlock()
+	if snapshot, err = vol.getSnapshotByName(snapName); err != nil {
+		return
+	}
+	// the meta partitions ignore the snapshots not existing, so the deletion can be retried on failure
+	if err = c.syncSnapshotToMetaPartitions(vol, proto.OpDeleteMetaSnapshot, snapshot.ID); err != nil {
+		goto errHandler
+	}
+	if err = c.removeSnapshot(vol, snapshot.ID); err != nil {
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[deleteSnapshot], clusterID[%v] name:%v, snapshot:%v, err:%v ", c.Name, name, snapName, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (c *Cluster) putSnapshot(vol *Vol, snapshot *proto.SnapshotInfo) (err error) {
+	vol.Lock()
+	defer vol.Unlock()
+	old, exist := vol.snapshots[snapshot.ID]
+	vol.snapshots[snapshot.ID] = snapshot
+	if err = c.syncUpdateVol(vol); err != nil {
+		if exist {
+			vol.snapshots[snapshot.ID] = old
+		} else {
+			delete(vol.snapshots, snapshot.ID)
+		}
+		log.LogErrorf("action[putSnapshot] vol[%v] err[%v]", vol.Name, err)
+		err = proto.ErrPersistenceByRaft
+	}
+	return
+}
+
+func (c *Cluster) removeSnapshot(vol *Vol, snapshotID uint64) (err error) {
+	vol.Lock()
+	defer vol.Unlock()
+	old, exist := vol.snapshots[snapshotID]
+	if !exist {
+		return
+	}
+	delete(vol.snapshots, snapshotID)
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.snapshots[snapshotID] = old
+		log.LogErrorf("action[removeSnapshot] vol[%v] err[%v]", vol.Name, err)
+		err = proto.ErrPersistenceByRaft
+	}
+	return
+}
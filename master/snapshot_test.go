@@ -0,0 +1,82 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestSnapshot(t *testing.T) {
+	name := "snapshotVol"
+	vol := newVol(10001, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	// a dedicated mock meta node acknowledges the snapshot tasks, as the others may have been decommissioned
+	addr := "127.0.0.1:8109"
+	addMetaServer(addr)
+	time.Sleep(time.Second)
+	metaNode, err := server.cluster.metaNode(addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := uint64(1); i <= 2; i++ {
+		mp := newMetaPartition(10010+i, (i-1)*defaultMetaPartitionInodeIDStep, i*defaultMetaPartitionInodeIDStep, 3, name, vol.ID)
+		mr := newMetaReplica(mp.Start, mp.End, metaNode)
+		mr.IsLeader = true
+		mp.addReplica(mr)
+		vol.addMetaPartition(mp)
+	}
+	server.cluster.putVol(vol)
+
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&snapshot=%v",
+		hostAddr, proto.AdminCreateSnapshot, name, buildAuthKey("cfs"), "snap1")
+	if reply := process(reqURL, t); reply == nil {
+		return
+	}
+	snapshot, err := vol.getSnapshotByName("snap1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the clients turn on copy-on-write before the snapshot is taken
+	if snapshot.Status != proto.SnapshotCreating {
+		t.Errorf("expect snapshot %v to be created later", snapshot)
+		return
+	}
+	if !newSimpleView(vol).CopyOnWrite {
+		t.Errorf("expect vol[%v] to be copy-on-write", name)
+		return
+	}
+	server.cluster.takeSnapshots()
+	if snapshot, _ = vol.getSnapshotByName("snap1"); snapshot.Status != proto.SnapshotCreating {
+		t.Errorf("expect snapshot %v not to be taken before the clients refresh", snapshot)
+		return
+	}
+	delay := snapshotCopyOnWriteDelay
+	snapshotCopyOnWriteDelay = 0
+	server.cluster.takeSnapshots()
+	snapshotCopyOnWriteDelay = delay
+	if snapshot, _ = vol.getSnapshotByName("snap1"); snapshot.Status != proto.SnapshotNormal {
+		t.Errorf("unexpected status of snapshot %v", snapshot)
+		return
+	}
+	if _, err = server.cluster.createSnapshot(name, buildAuthKey("cfs"), "snap1"); err == nil {
+		t.Errorf("expect duplicated snapshot to fail")
+		return
+	}
+	reqURL = fmt.Sprintf("%v%v?name=%v", hostAddr, proto.AdminListSnapshot, name)
+	process(reqURL, t)
+
+	reqURL = fmt.Sprintf("%v%v?name=%v&authKey=%v&snapshot=%v",
+		hostAddr, proto.AdminDeleteSnapshot, name, buildAuthKey("cfs"), "snap1")
+	process(reqURL, t)
+	if _, err = vol.getSnapshotByName("snap1"); err != proto.ErrSnapshotNotExists {
+		t.Errorf("expect snapshot to be deleted, err[%v]", err)
+		return
+	}
+	if newSimpleView(vol).CopyOnWrite {
+		t.Errorf("expect vol[%v] not to be copy-on-write", name)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The disks of the data nodes are tagged with the media classes, such as ssd and hdd, which are reported in
+// the heartbeats. The data partitions of a volume are placed on the disks of the media class of the volume,
+// and the cold data partitions on the disks of the cold media class. The metanodes migrate the files not
+// accessed for the days of the tier policy to the cold data partitions.
+
+func (vol *Vol) tierParams() (mediaType, coldMediaType string) {
+	vol.RLock()
+	defer vol.RUnlock()
+	return vol.MediaType, vol.ColdMediaType
+}
+
+func (c *Cluster) setVolTier(name, authKey, mediaType, coldMediaType string, coldAfterDays uint32) (err error) {
+	var (
+		vol                        *Vol
+		oldMediaType, oldColdMedia string
+		oldColdAfterDays           uint32
+	)
+	if vol, err = c.getVol(name); err != nil {
+		log.LogErrorf("action[setVolTier] err[%v]", err)
+		err = proto.ErrVolNotExists
+		goto errHandler
+	}
+	vol.Lock()
+	defer vol.Unlock()
+	if !matchKey(vol.Owner, authKey) {
+		return proto.ErrVolAuthKeyNotMatch
+	}
+	oldMediaType, oldColdMedia, oldColdAfterDays = vol.MediaType, vol.ColdMediaType, vol.ColdAfterDays
+	// the existing data partitions are kept on their disks, only the new ones are placed by the media classes
+	vol.MediaType, vol.ColdMediaType, vol.ColdAfterDays = mediaType, coldMediaType, coldAfterDays
+	if err = c.syncUpdateVol(vol); err != nil {
+		vol.MediaType, vol.ColdMediaType, vol.ColdAfterDays = oldMediaType, oldColdMedia, oldColdAfterDays
+		log.LogErrorf("action[setVolTier] vol[%v] err[%v]", name, err)
+		err = proto.ErrPersistenceByRaft
+		goto errHandler
+	}
+	return
+errHandler:
+	err = fmt.Errorf("action[setVolTier], clusterID[%v] name:%v, err:%v ", c.Name, name, err.Error())
+	log.LogError(errors.Stack(err))
+	Warn(c.Name, err.Error())
+	return
+}
+
+func (dataNode *DataNode) hasMediaType(mediaType string) bool {
+	dataNode.RLock()
+	defer dataNode.RUnlock()
+	for _, disk := range dataNode.DiskReports {
+		if disk.MediaType == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the data node has a disk of the media class, or the media class is not required.
+func (c *Cluster) hasMediaType(addr, mediaType string) bool {
+	if mediaType == "" {
+		return true
+	}
+	dataNode, err := c.dataNode(addr)
+	if err != nil {
+		return false
+	}
+	return dataNode.hasMediaType(mediaType)
+}
+
+// Returns the data nodes without any disk of the media class, which are excluded from the placement.
+func (c *Cluster) hostsWithoutMediaType(mediaType string) (hosts []string) {
+	if mediaType == "" {
+		return
+	}
+	c.dataNodes.Range(func(addr, value interface{}) bool {
+		if !value.(*DataNode).hasMediaType(mediaType) {
+			hosts = append(hosts, addr.(string))
+		}
+		return true
+	})
+	return
+}
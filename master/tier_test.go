@@ -0,0 +1,62 @@
+package master
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestSetVolTier(t *testing.T) {
+	name := "tierVol"
+	vol := newVol(10004, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	server.cluster.putVol(vol)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&mediaType=ssd&coldMediaType=hdd&coldAfterDays=30",
+		hostAddr, proto.AdminSetVolTier, name, buildAuthKey("cfs"))
+	process(reqURL, t)
+	if vol.MediaType != "ssd" || vol.ColdMediaType != "hdd" || vol.ColdAfterDays != 30 {
+		t.Errorf("set vol tier failed,expect[ssd hdd 30],real[%v %v %v]", vol.MediaType, vol.ColdMediaType, vol.ColdAfterDays)
+		return
+	}
+	if view := newSimpleView(vol); view.ColdMediaType != "hdd" || view.ColdAfterDays != 30 {
+		t.Errorf("expect tier params in the view,real[%v %v]", view.ColdMediaType, view.ColdAfterDays)
+		return
+	}
+	if _, _, _, _, _, err := parseRequestToSetVolTier(newTierRequest(t, name, "hdd", "hdd", 30)); err == nil {
+		t.Errorf("expect err of the same cold media type")
+	}
+}
+
+func newTierRequest(t *testing.T, name, mediaType, coldMediaType string, coldAfterDays uint32) *http.Request {
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&mediaType=%v&coldMediaType=%v&coldAfterDays=%v",
+		hostAddr, proto.AdminSetVolTier, name, buildAuthKey("cfs"), mediaType, coldMediaType, coldAfterDays)
+	r, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestHostsWithoutMediaType(t *testing.T) {
+	c := new(Cluster)
+	ssd := newDataNode("127.0.0.1:10001", "test")
+	ssd.DiskReports = []*proto.DiskReport{{Path: "/data0", MediaType: "ssd"}, {Path: "/data1", MediaType: "hdd"}}
+	hdd := newDataNode("127.0.0.1:10002", "test")
+	hdd.DiskReports = []*proto.DiskReport{{Path: "/data0", MediaType: "hdd"}}
+	c.dataNodes.Store(ssd.Addr, ssd)
+	c.dataNodes.Store(hdd.Addr, hdd)
+	if hosts := c.hostsWithoutMediaType("ssd"); fmt.Sprint(hosts) != "[127.0.0.1:10002]" {
+		t.Errorf("expect hosts[127.0.0.1:10002],real[%v]", hosts)
+	}
+	if hosts := c.hostsWithoutMediaType("hdd"); len(hosts) != 0 {
+		t.Errorf("expect no hosts,real[%v]", hosts)
+	}
+	if hosts := c.hostsWithoutMediaType(""); len(hosts) != 0 {
+		t.Errorf("expect no hosts for any media,real[%v]", hosts)
+	}
+	if !c.hasMediaType(ssd.Addr, "ssd") || c.hasMediaType(hdd.Addr, "ssd") {
+		t.Errorf("unexpected media of the data nodes")
+	}
+}
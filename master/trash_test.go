@@ -0,0 +1,25 @@
+package master
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestSetVolTrash(t *testing.T) {
+	name := "trashVol"
+	vol := newVol(10002, name, "cfs", util.DefaultDataPartitionSize, 100, 3, 3, false)
+	server.cluster.putVol(vol)
+	reqURL := fmt.Sprintf("%v%v?name=%v&authKey=%v&retention=%v",
+		hostAddr, proto.AdminSetVolTrash, name, buildAuthKey("cfs"), 24)
+	process(reqURL, t)
+	if vol.TrashRetention != 24 {
+		t.Errorf("set vol trash failed,expect[%v],real[%v]", 24, vol.TrashRetention)
+		return
+	}
+	if view := newSimpleView(vol); view.TrashRetention != 24 {
+		t.Errorf("expect trash retention[%v] in the view,real[%v]", 24, view.TrashRetention)
+	}
+}
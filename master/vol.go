@@ -44,11 +44,25 @@ type Vol struct {
 	viewCache          []byte
 	createDpMutex      sync.RWMutex
 	createMpMutex      sync.RWMutex
+	quotas             map[uint32]*proto.QuotaInfo // limits of the quotas, keyed by quota ID
+	maxQuotaID         uint32
+	snapshots          map[uint64]*proto.SnapshotInfo // keyed by snapshot ID
+	dirShards          map[uint64][]uint64            // partitions of the sharded directories, keyed by inode
+	TrashRetention     uint32                         // hours to keep the deleted files in the trash
+	EcDataNum          uint8                          // params of the erasure-coded data partitions
+	EcParityNum        uint8
+	EcMigrateDays      uint32 // days after which the extents not modified are converted to erasure code
+	MediaType          string // media class of the disks of the data partitions, any if empty
+	ColdMediaType      string // media class of the disks of the cold data partitions
+	ColdAfterDays      uint32 // days after which the files not accessed are migrated to the cold tier
 	sync.RWMutex
 }
 
 func newVol(id uint64, name, owner string, dpSize, capacity uint64, dpReplicaNum, mpReplicaNum uint8, followerRead bool) (vol *Vol) {
 	vol = &Vol{ID: id, Name: name, MetaPartitions: make(map[uint64]*MetaPartition, 0)}
+	vol.quotas = make(map[uint32]*proto.QuotaInfo)
+	vol.snapshots = make(map[uint64]*proto.SnapshotInfo)
+	vol.dirShards = make(map[uint64][]uint64)
 	vol.dataPartitions = newDataPartitionMap(name)
 	if dpReplicaNum < 1 {
 		dpReplicaNum = defaultReplicaNum
@@ -95,6 +109,18 @@ func (vol *Vol) metaPartition(partitionID uint64) (mp *MetaPartition, err error)
 	return
 }
 
+// metaPartitionOfInode returns the meta partition whose range the inode falls in, or nil if there is none.
+func (vol *Vol) metaPartitionOfInode(ino uint64) *MetaPartition {
+	vol.mpsLock.RLock()
+	defer vol.mpsLock.RUnlock()
+	for _, mp := range vol.MetaPartitions {
+		if mp.Start <= ino && ino <= mp.End {
+			return mp
+		}
+	}
+	return nil
+}
+
 func (vol *Vol) maxPartitionID() (maxPartitionID uint64) {
 	vol.mpsLock.RLock()
 	defer vol.mpsLock.RUnlock()
@@ -166,10 +192,11 @@ func (vol *Vol) checkDataPartitions(c *Cluster) (cnt int) {
 
 		dp.checkMissingReplicas(c.Name, c.leaderInfo.addr, c.cfg.MissingDataPartitionInterval, c.cfg.IntervalToAlarmMissingDataPartition)
 		dp.checkReplicaNum(c, vol)
-		if dp.Status == proto.ReadWrite {
+		if dp.Status == proto.ReadWrite && !dp.isEc() && !dp.Cold {
 			cnt++
 		}
 		dp.checkDiskError(c.Name, c.leaderInfo.addr)
+		dp.checkBadExtents(c.Name, c.leaderInfo.addr)
 		tasks := dp.checkReplicationTask(c.Name, vol.dataPartitionSize)
 		if len(tasks) != 0 {
 			c.addDataNodeTasks(tasks)
@@ -207,6 +234,9 @@ func (vol *Vol) checkReplicaNum(c *Cluster) {
 	var err error
 	dps := vol.cloneDataPartitionMap()
 	for _, dp := range dps {
+		if dp.isEc() {
+			continue
+		}
 		host := dp.getToBeDecommissionHost(int(vol.dpReplicaNum))
 		if host == "" {
 			continue
@@ -370,6 +400,8 @@ func (vol *Vol) totalUsedSpace() uint64 {
 
 func (vol *Vol) updateViewCache(c *Cluster) {
 	view := proto.NewVolView(vol.Name, vol.Status, vol.FollowerRead)
+	view.TrashRetention = vol.TrashRetention
+	view.DirShards = vol.getDirShards()
 	mpViews := vol.getMetaPartitionsView()
 	view.MetaPartitions = mpViews
 	mpViewsReply := newSuccessHTTPReply(mpViews)
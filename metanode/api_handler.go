@@ -57,6 +57,10 @@ func (m *MetaNode) registerAPIHandler() (err error) {
 	http.HandleFunc("/getDentry", m.getDentryHandler)
 	http.HandleFunc("/getDirectory", m.getDirectoryHandler)
 	http.HandleFunc("/getAllDentry", m.getAllDentriesHandler)
+	// list the entries in the trash, which are kept by the partition of the root
+	http.HandleFunc("/getTrash", m.getTrashHandler)
+	// read the events of the metadata changes of the partition after an offset
+	http.HandleFunc("/getEvents", m.getEventsHandler)
 	return
 }
 
@@ -399,3 +403,83 @@ func (m *MetaNode) getDirectoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	return
 }
+
+func (m *MetaNode) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusBadRequest, "")
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[getTrashHandler] response %s", err)
+		}
+	}()
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	mp, err := m.metadataManager.GetPartition(pid)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	entries, status := mp.ListTrash()
+	if status != proto.OpOk {
+		resp.Code = http.StatusNotFound
+		resp.Msg = fmt.Sprintf("no trash in partition %v", pid)
+		return
+	}
+	resp.Code = http.StatusOK
+	resp.Msg = http.StatusText(http.StatusOK)
+	resp.Data = entries
+}
+
+func (m *MetaNode) getEventsHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	resp := NewAPIResponse(http.StatusBadRequest, "")
+	defer func() {
+		data, _ := resp.Marshal()
+		if _, err := w.Write(data); err != nil {
+			log.LogErrorf("[getEventsHandler] response %s", err)
+		}
+	}()
+	pid, err := strconv.ParseUint(r.FormValue("pid"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	from, err := strconv.ParseUint(r.FormValue("from"), 10, 64)
+	if err != nil {
+		resp.Msg = err.Error()
+		return
+	}
+	var limit int
+	if value := r.FormValue("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil {
+			resp.Msg = err.Error()
+			return
+		}
+	}
+	mp, err := m.metadataManager.GetPartition(pid)
+	if err != nil {
+		resp.Code = http.StatusNotFound
+		resp.Msg = err.Error()
+		return
+	}
+	p := &Packet{}
+	if err = mp.ReadChanges(&proto.ReadMetaChangesRequest{PartitionID: pid, From: from, Limit: limit}, p); err != nil {
+		resp.Code = http.StatusInternalServerError
+		resp.Msg = err.Error()
+		return
+	}
+	changes := &proto.ReadMetaChangesResponse{}
+	if err = json.Unmarshal(p.Data, changes); err != nil {
+		resp.Code = http.StatusInternalServerError
+		resp.Msg = err.Error()
+		return
+	}
+	resp.Code = http.StatusOK
+	resp.Msg = http.StatusText(http.StatusOK)
+	resp.Data = changes.Events(from)
+}
@@ -15,21 +15,47 @@
 package metanode
 
 import (
-	"github.com/chubaofs/chubaofs/util/btree"
+	"encoding/binary"
+	"fmt"
 	"sync"
+
+	"github.com/chubaofs/chubaofs/util/btree"
 )
 
 const defaultBTreeDegree = 32
 
+const (
+	inodeKeyPrefix  byte = 'i' // followed by the inode ID
+	dentryKeyPrefix byte = 'd' // followed by the parent ID and the name
+)
+
 type (
 	// BtreeItem type alias google btree Item
 	BtreeItem = btree.Item
 )
 
+// MetaTree is the ordered set of the inodes or the dentries of a meta partition.
+// BTree keeps all the items in memory, and RocksTree keeps them in RocksDB with the hot ones cached.
+type MetaTree interface {
+	Get(key BtreeItem) BtreeItem
+	CopyGet(key BtreeItem) BtreeItem
+	CopyFind(key BtreeItem, fn func(i BtreeItem))
+	Has(key BtreeItem) bool
+	Delete(key BtreeItem) BtreeItem
+	ReplaceOrInsert(key BtreeItem, replace bool) (BtreeItem, bool)
+	Ascend(fn func(i BtreeItem) bool)
+	AscendRange(greaterOrEqual, lessThan BtreeItem, iterator func(i BtreeItem) bool)
+	AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem) bool)
+	GetTree() MetaTree
+	Reset()
+	Len() int
+}
+
 // BTree is the wrapper of Google's btree.
 type BTree struct {
 	sync.RWMutex
-	tree *btree.BTree
+	tree    *btree.BTree
+	changed map[string]struct{} // keys of the changed items, if tracked
 }
 
 // NewBtree creates a new btree.
@@ -49,7 +75,9 @@ func (b *BTree) Get(key BtreeItem) (item BtreeItem) {
 
 func (b *BTree) CopyGet(key BtreeItem) (item BtreeItem) {
 	b.Lock()
-	item = b.tree.CopyGet(key)
+	if item = b.tree.CopyGet(key); item != nil {
+		b.change(item)
+	}
 	b.Unlock()
 	return
 }
@@ -68,6 +96,9 @@ func (b *BTree) Find(key BtreeItem, fn func(i BtreeItem)) {
 func (b *BTree) CopyFind(key BtreeItem, fn func(i BtreeItem)) {
 	b.Lock()
 	item := b.tree.CopyGet(key)
+	if item != nil {
+		b.change(item)
+	}
 	fn(item)
 	b.Unlock()
 }
@@ -83,7 +114,9 @@ func (b *BTree) Has(key BtreeItem) (ok bool) {
 // Delete deletes the object by the given key.
 func (b *BTree) Delete(key BtreeItem) (item BtreeItem) {
 	b.Lock()
-	item = b.tree.Delete(key)
+	if item = b.tree.Delete(key); item != nil {
+		b.change(item)
+	}
 	b.Unlock()
 	return
 }
@@ -93,6 +126,7 @@ func (b *BTree) ReplaceOrInsert(key BtreeItem, replace bool) (item BtreeItem, ok
 	b.Lock()
 	if replace {
 		item = b.tree.ReplaceOrInsert(key)
+		b.change(key)
 		b.Unlock()
 		ok = true
 		return
@@ -101,6 +135,7 @@ func (b *BTree) ReplaceOrInsert(key BtreeItem, replace bool) (item BtreeItem, ok
 	item = b.tree.Get(key)
 	if item == nil {
 		item = b.tree.ReplaceOrInsert(key)
+		b.change(key)
 		b.Unlock()
 		ok = true
 		return
@@ -133,8 +168,15 @@ func (b *BTree) AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem)
 	b.RUnlock()
 }
 
+// DescendLessOrEqual is the wrapper of the google's btree DescendLessOrEqual.
+func (b *BTree) DescendLessOrEqual(pivot BtreeItem, iterator func(i BtreeItem) bool) {
+	b.RLock()
+	b.tree.DescendLessOrEqual(pivot, iterator)
+	b.RUnlock()
+}
+
 // GetTree returns the snapshot of a btree.
-func (b *BTree) GetTree() *BTree {
+func (b *BTree) GetTree() MetaTree {
 	b.Lock()
 	t := b.tree.Clone()
 	b.Unlock()
@@ -143,10 +185,11 @@ func (b *BTree) GetTree() *BTree {
 	return nb
 }
 
-// Reset resets the current btree.
+// Reset resets the current btree, which stops tracking the changes.
 func (b *BTree) Reset() {
 	b.Lock()
 	b.tree.Clear(false)
+	b.changed = nil
 	b.Unlock()
 }
 
@@ -165,3 +208,60 @@ func (b *BTree) MaxItem() BtreeItem {
 	b.RUnlock()
 	return item
 }
+
+// TrackChanges starts recording the keys of the changed items, so that the tree is stored incrementally.
+func (b *BTree) TrackChanges() {
+	b.Lock()
+	b.changed = make(map[string]struct{})
+	b.Unlock()
+}
+
+// TakeChanges returns the keys of the items changed since the last call, or nil if not tracked.
+func (b *BTree) TakeChanges() (keys map[string]struct{}) {
+	b.Lock()
+	if keys = b.changed; keys != nil {
+		b.changed = make(map[string]struct{})
+	}
+	b.Unlock()
+	return
+}
+
+func (b *BTree) change(item BtreeItem) {
+	if b.changed != nil {
+		b.changed[string(treeKey(item))] = struct{}{}
+	}
+}
+
+// Returns the key of the inode or the dentry, in the same order as the item.
+func treeKey(item BtreeItem) (key []byte) {
+	switch it := item.(type) {
+	case nil:
+		return nil
+	case *Inode:
+		key = make([]byte, 9)
+		key[0] = inodeKeyPrefix
+		binary.BigEndian.PutUint64(key[1:], it.Inode)
+	case *Dentry:
+		key = make([]byte, 9+len(it.Name))
+		key[0] = dentryKeyPrefix
+		binary.BigEndian.PutUint64(key[1:], it.ParentId)
+		copy(key[9:], it.Name)
+	default:
+		panic(fmt.Sprintf("unknown item type %T", item))
+	}
+	return
+}
+
+// Returns the inode or the dentry, with only the key set, of the key returned by treeKey.
+func treeKeyItem(key []byte) BtreeItem {
+	if len(key) < 9 {
+		return nil
+	}
+	switch key[0] {
+	case inodeKeyPrefix:
+		return NewInode(binary.BigEndian.Uint64(key[1:]), 0)
+	case dentryKeyPrefix:
+		return &Dentry{ParentId: binary.BigEndian.Uint64(key[1:9]), Name: string(key[9:])}
+	}
+	return nil
+}
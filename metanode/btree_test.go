@@ -0,0 +1,63 @@
+package metanode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBTreeTrackChanges(t *testing.T) {
+	tree := NewBtree()
+	tree.ReplaceOrInsert(NewInode(1, 0), true)
+	if keys := tree.TakeChanges(); keys != nil {
+		t.Fatalf("expect no changes before tracking, got %v", keys)
+	}
+	key := func(item BtreeItem) string { return string(treeKey(item)) }
+
+	tree.TrackChanges()
+	tree.ReplaceOrInsert(NewInode(2, 0), true)
+	tree.ReplaceOrInsert(NewInode(3, 0), true)
+	tree.Delete(NewInode(3, 0))
+	tree.CopyGet(NewInode(1, 0))
+	tree.Get(NewInode(2, 0))
+	want := map[string]struct{}{
+		key(NewInode(1, 0)): {},
+		key(NewInode(2, 0)): {},
+		key(NewInode(3, 0)): {},
+	}
+	if keys := tree.TakeChanges(); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expect changes %v, got %v", want, keys)
+	}
+	dentries := NewBtree()
+	dentries.TrackChanges()
+	dentries.ReplaceOrInsert(&Dentry{ParentId: 1, Name: "a", Inode: 2}, true)
+	dentries.ReplaceOrInsert(&Dentry{ParentId: 1, Name: "a", Inode: 3}, true)
+	if keys := dentries.TakeChanges(); !reflect.DeepEqual(keys, map[string]struct{}{key(&Dentry{ParentId: 1, Name: "a"}): {}}) {
+		t.Fatalf("expect the dentry to be changed, got %v", keys)
+	}
+	if keys := tree.TakeChanges(); keys == nil || len(keys) != 0 {
+		t.Fatalf("expect the changes to be taken once, got %v", keys)
+	}
+
+	// the missing items are not changed
+	tree.Delete(NewInode(4, 0))
+	tree.CopyGet(NewInode(4, 0))
+	if keys := tree.TakeChanges(); len(keys) != 0 {
+		t.Fatalf("expect no changes of the missing items, got %v", keys)
+	}
+
+	// the keys are in the order of the items, and decoded back into them
+	for _, item := range []BtreeItem{NewInode(1, 0), NewInode(2, 0), &Dentry{ParentId: 1, Name: "a"}} {
+		if got := treeKeyItem(treeKey(item)); got == nil || got.Less(item) || item.Less(got) {
+			t.Fatalf("expect the key of %v to be decoded, got %v", item, got)
+		}
+	}
+	if !(key(NewInode(1, 0)) < key(NewInode(2, 0))) {
+		t.Fatalf("expect the keys of the inodes to be ordered")
+	}
+
+	tree.Reset()
+	tree.ReplaceOrInsert(NewInode(5, 0), true)
+	if keys := tree.TakeChanges(); keys != nil {
+		t.Fatalf("expect the reset to stop tracking, got %v", keys)
+	}
+}
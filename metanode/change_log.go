@@ -0,0 +1,440 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	changeLogDir = "changelog"
+	// the file keeping the apply ID after which the log is restarted, if the changes before it are lost
+	changeLogFirstFile = "first"
+)
+
+var (
+	// the maximum number of the recent changes cached in memory
+	maxCachedChanges = 1 << 16
+	// the size of a segment file of the change log, and the number of the segments kept
+	changeLogSegmentSize int64 = 16 * util.MB
+	maxChangeLogSegments       = 8
+)
+
+// ChangeLog keeps the changes of the metadata applied by a meta partition in the order of the raft log, so that
+// they can be tailed by the readers from an apply ID. The changes are appended to the segment files in the
+// directory of the partition, one JSON per line, and the oldest segment is dropped once there are too many.
+// The segments are synced before the snapshot of the partition is stored, so that the changes of the raft log
+// entries not replayed after restarts are never lost. The recent changes are cached in memory as well.
+// If the changes fail to be appended, the log is restarted after them, and the segments before are no longer
+// read.
+type ChangeLog struct {
+	sync.RWMutex
+	dir        string
+	first      uint64   // the changes applied after it are kept
+	last       uint64   // the apply ID of the last change appended
+	segments   []uint64 // the segments named by the apply ID before their first changes, in order
+	file       *os.File // the last segment, being appended
+	fileSize   int64
+	cacheFirst uint64 // the changes applied after it are cached
+	cache      []*proto.MetaChange
+}
+
+// NewChangeLog returns a new ChangeLog in the given directory, which is loaded on the start of the partition.
+func NewChangeLog(dir string) *ChangeLog {
+	return &ChangeLog{dir: dir}
+}
+
+// Load opens the segments of the change log. The log is restarted from the apply ID of the partition if the
+// changes applied before it are missing, e.g. the log was not there.
+func (l *ChangeLog) Load(applyID uint64) (err error) {
+	l.Lock()
+	defer l.Unlock()
+	l.closeFile()
+	l.segments, l.cache = nil, nil
+	if err = os.MkdirAll(l.dir, 0755); err != nil {
+		return
+	}
+	fileInfos, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range fileInfos {
+		if id, e := strconv.ParseUint(fi.Name(), 10, 64); e == nil {
+			l.segments = append(l.segments, id)
+		}
+	}
+	if len(l.segments) == 0 {
+		return l.reset(applyID)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+	id := l.segments[len(l.segments)-1]
+	last, size, err := scanSegment(l.segmentFile(id))
+	if err != nil {
+		return
+	}
+	// the raft log entries applied after the last change have no changes, as the segments are synced
+	// before the snapshot is stored
+	if last < id {
+		last = id
+	}
+	if last < applyID {
+		last = applyID
+	}
+	if l.file, err = os.OpenFile(l.segmentFile(id), os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return
+	}
+	// drop the partial change written on crash
+	if err = l.file.Truncate(size); err != nil {
+		return
+	}
+	l.first, l.last, l.cacheFirst, l.fileSize = l.segments[0], last, last, size
+	if first := l.loadFirst(); first > l.first {
+		l.first = first
+	}
+	return
+}
+
+// Returns the apply ID after which the log was restarted, or 0 if it never was.
+func (l *ChangeLog) loadFirst() uint64 {
+	data, err := ioutil.ReadFile(path.Join(l.dir, changeLogFirstFile))
+	if err != nil {
+		return 0
+	}
+	first, _ := strconv.ParseUint(string(data), 10, 64)
+	return first
+}
+
+// Reset drops all the changes, and restarts the log from the given apply ID.
+func (l *ChangeLog) Reset(applyID uint64) error {
+	l.Lock()
+	defer l.Unlock()
+	return l.reset(applyID)
+}
+
+func (l *ChangeLog) reset(applyID uint64) (err error) {
+	l.closeFile()
+	l.segments, l.cache = nil, nil
+	l.first, l.last, l.cacheFirst = applyID, applyID, applyID
+	if err = os.RemoveAll(l.dir); err != nil {
+		return
+	}
+	if err = os.MkdirAll(l.dir, 0755); err != nil {
+		return
+	}
+	return l.openSegment(applyID)
+}
+
+// restart restarts the log after the changes of the given apply ID, which are lost. The segments before are
+// kept until they are dropped as usual, but are no longer read.
+func (l *ChangeLog) restart(applyID uint64) (err error) {
+	l.closeFile()
+	l.cache = nil
+	l.first, l.last, l.cacheFirst = applyID, applyID, applyID
+	if err = ioutil.WriteFile(path.Join(l.dir, changeLogFirstFile), []byte(strconv.FormatUint(applyID, 10)), 0644); err != nil {
+		return
+	}
+	return l.openSegment(applyID)
+}
+
+// Append adds the changes applied by the raft log entry of the given apply ID. The entries replayed after
+// restarts are skipped. If the changes fail to be written, the log is restarted after them, so that the readers
+// never miss a change silently.
+func (l *ChangeLog) Append(applyID uint64, time int64, changes ...*proto.MetaChange) (err error) {
+	l.Lock()
+	defer l.Unlock()
+	if applyID <= l.last {
+		return
+	}
+	defer func() {
+		if err != nil {
+			log.LogErrorf("ChangeLog: append changes of apply ID %v to %v err(%v), restart the log", applyID, l.dir, err)
+			if e := l.restart(applyID); e != nil {
+				log.LogErrorf("ChangeLog: restart %v err(%v)", l.dir, e)
+			}
+		}
+	}()
+	if l.file == nil {
+		return fmt.Errorf("change log is not opened")
+	}
+	buf := bytes.NewBuffer(nil)
+	for _, c := range changes {
+		c.ApplyID, c.Time = applyID, time
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	n, err := l.file.Write(buf.Bytes())
+	if err != nil {
+		// drop the partial changes written, so that the segment is still read to the end
+		if n > 0 {
+			if e := l.file.Truncate(l.fileSize); e != nil {
+				log.LogErrorf("ChangeLog: truncate segment of %v err(%v)", l.dir, e)
+			}
+		}
+		return
+	}
+	l.fileSize += int64(n)
+	l.last = applyID
+	l.cacheChanges(changes)
+	if l.fileSize >= changeLogSegmentSize {
+		l.closeFile()
+		// the log is restarted on the next append if the segment fails to be created
+		if e := l.openSegment(applyID); e != nil {
+			log.LogErrorf("ChangeLog: create segment %v of %v err(%v)", applyID, l.dir, e)
+		}
+	}
+	return
+}
+
+func (l *ChangeLog) cacheChanges(changes []*proto.MetaChange) {
+	l.cache = append(l.cache, changes...)
+	if len(l.cache) <= maxCachedChanges {
+		return
+	}
+	// drop the older half, and never split the changes of an apply ID
+	n := len(l.cache) / 2
+	for n < len(l.cache) && l.cache[n].ApplyID == l.cache[n-1].ApplyID {
+		n++
+	}
+	l.cacheFirst = l.cache[n-1].ApplyID
+	l.cache = append([]*proto.MetaChange(nil), l.cache[n:]...)
+}
+
+// Sync flushes the last segment to the disk.
+func (l *ChangeLog) Sync() error {
+	l.RLock()
+	defer l.RUnlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Sync()
+}
+
+// Close closes the last segment.
+func (l *ChangeLog) Close() {
+	l.Lock()
+	defer l.Unlock()
+	l.closeFile()
+}
+
+// Read returns at most limit changes applied after the given apply ID, and more if the changes of the
+// last apply ID exceed the limit. It returns truncated if the changes are no longer kept.
+func (l *ChangeLog) Read(from uint64, limit int) (changes []*proto.MetaChange, truncated bool, err error) {
+	l.RLock()
+	if from < l.first {
+		l.RUnlock()
+		return nil, true, nil
+	}
+	if from >= l.cacheFirst {
+		changes = readChanges(l.cache, from, limit)
+		l.RUnlock()
+		return
+	}
+	segments := append([]uint64(nil), l.segments...)
+	l.RUnlock()
+
+	// the segments are read without the lock, as the changes written are never modified
+	i := sort.Search(len(segments), func(i int) bool { return segments[i] > from }) - 1
+	if i < 0 {
+		return nil, true, nil
+	}
+	for _, id := range segments[i:] {
+		var full bool
+		if changes, full, err = l.readSegment(id, from, limit, changes); err != nil {
+			if os.IsNotExist(err) {
+				return nil, true, nil
+			}
+			return nil, false, err
+		}
+		if full {
+			break
+		}
+	}
+	return
+}
+
+// Reads the changes after the given apply ID from a segment, and returns full once the limit is reached.
+func (l *ChangeLog) readSegment(id, from uint64, limit int, changes []*proto.MetaChange) ([]*proto.MetaChange, bool, error) {
+	fp, err := os.Open(l.segmentFile(id))
+	if err != nil {
+		return changes, false, err
+	}
+	defer fp.Close()
+	reader := bufio.NewReader(fp)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the partial change being written is ignored
+			return changes, false, nil
+		}
+		if err != nil {
+			return changes, false, err
+		}
+		c := &proto.MetaChange{}
+		if err = json.Unmarshal(line, c); err != nil {
+			return changes, false, err
+		}
+		if c.ApplyID <= from {
+			continue
+		}
+		if len(changes) > 0 && len(changes) >= limit && c.ApplyID != changes[len(changes)-1].ApplyID {
+			return changes, true, nil
+		}
+		changes = append(changes, c)
+	}
+}
+
+func readChanges(cache []*proto.MetaChange, from uint64, limit int) (changes []*proto.MetaChange) {
+	i := sort.Search(len(cache), func(i int) bool {
+		return cache[i].ApplyID > from
+	})
+	for ; i < len(cache); i++ {
+		if len(changes) > 0 && len(changes) >= limit && cache[i].ApplyID != changes[len(changes)-1].ApplyID {
+			break
+		}
+		changes = append(changes, cache[i])
+	}
+	return
+}
+
+// Creates a new segment after the given apply ID, and drops the oldest ones if there are too many.
+func (l *ChangeLog) openSegment(id uint64) (err error) {
+	if l.file, err = os.OpenFile(l.segmentFile(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	l.fileSize = 0
+	l.segments = append(l.segments, id)
+	for len(l.segments) > maxChangeLogSegments {
+		if err = os.Remove(l.segmentFile(l.segments[0])); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		l.segments = l.segments[1:]
+		if l.first < l.segments[0] {
+			l.first = l.segments[0]
+		}
+	}
+	return nil
+}
+
+func (l *ChangeLog) closeFile() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *ChangeLog) segmentFile(id uint64) string {
+	return path.Join(l.dir, fmt.Sprintf("%020d", id))
+}
+
+// Returns the apply ID of the last complete change in the segment, and the size of the complete changes.
+func scanSegment(filename string) (last uint64, size int64, err error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	reader := bufio.NewReader(fp)
+	for {
+		line, e := reader.ReadBytes('\n')
+		if e == io.EOF {
+			return
+		}
+		if e != nil {
+			return 0, 0, e
+		}
+		c := &proto.MetaChange{}
+		if e = json.Unmarshal(line, c); e != nil {
+			return
+		}
+		last = c.ApplyID
+		size += int64(len(line))
+	}
+}
+
+func newMetaChanges(typ uint8, ino, parentID uint64, name string) []*proto.MetaChange {
+	return []*proto.MetaChange{{Type: typ, Inode: ino, ParentID: parentID, Name: name}}
+}
+
+// Returns the changes of the operations of a committed transaction.
+func txMetaChanges(txID string, ops []*proto.TxOperation) (changes []*proto.MetaChange) {
+	for _, op := range ops {
+		c := &proto.MetaChange{Inode: op.Inode, ParentID: op.ParentID, Name: op.Name, TxID: txID}
+		switch op.Type {
+		case proto.TxOpCreateDentry:
+			c.Type = proto.MetaChangeCreateDentry
+		case proto.TxOpDeleteDentry:
+			c.Type, c.Inode = proto.MetaChangeDeleteDentry, op.OldInode
+		case proto.TxOpUpdateDentry:
+			c.Type = proto.MetaChangeUpdateDentry
+		case proto.TxOpUnlinkInode:
+			c.Type, c.ParentID, c.Name = proto.MetaChangeUnlinkInode, 0, ""
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return
+}
+
+// Returns the rename of a transaction decided to be committed by the coordinator, whose dentries are changed
+// by the participants later.
+func txRenameChanges(tx *proto.TxInfo) []*proto.MetaChange {
+	c := &proto.MetaChange{Type: proto.MetaChangeRename, TxID: tx.TxID}
+	for _, part := range tx.Participants {
+		for _, op := range part.Ops {
+			switch op.Type {
+			case proto.TxOpDeleteDentry:
+				c.Inode, c.ParentID, c.Name = op.OldInode, op.ParentID, op.Name
+			case proto.TxOpCreateDentry, proto.TxOpUpdateDentry:
+				c.NewParentID, c.NewName = op.ParentID, op.Name
+			}
+		}
+	}
+	if c.Inode == 0 || c.NewName == "" {
+		return nil
+	}
+	return []*proto.MetaChange{c}
+}
+
+// Returns the status of the response of an applied operation.
+func changeStatus(resp interface{}) uint8 {
+	switch r := resp.(type) {
+	case uint8:
+		return r
+	case *InodeResponse:
+		return r.Status
+	case *DentryResponse:
+		return r.Status
+	}
+	return proto.OpOk
+}
@@ -0,0 +1,178 @@
+package metanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Returns a change log loaded in a temporary directory, which is removed by the returned function.
+func newTestChangeLog(t *testing.T, applyID uint64) (*ChangeLog, func()) {
+	dir, err := ioutil.TempDir("", "changelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewChangeLog(path.Join(dir, changeLogDir))
+	if err = l.Load(applyID); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return l, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Appends a change for each apply ID, named by the apply ID.
+func appendTestChanges(t *testing.T, l *ChangeLog, applyIDs ...uint64) {
+	for _, id := range applyIDs {
+		if err := l.Append(id, 0, newMetaChanges(proto.MetaChangeCreateInode, id, 0, "")...); err != nil {
+			t.Fatalf("append %v: %v", id, err)
+		}
+	}
+}
+
+// Checks the changes read after the apply ID to be of the given apply IDs.
+func checkTestChanges(t *testing.T, l *ChangeLog, from uint64, limit int, applyIDs ...uint64) {
+	t.Helper()
+	changes, truncated, err := l.Read(from, limit)
+	if err != nil || truncated {
+		t.Fatalf("read from %v: truncated %v err %v", from, truncated, err)
+	}
+	if len(changes) != len(applyIDs) {
+		t.Fatalf("read from %v: expect %v changes, got %v", from, len(applyIDs), len(changes))
+	}
+	for i, c := range changes {
+		if c.ApplyID != applyIDs[i] || c.Inode != applyIDs[i] {
+			t.Fatalf("read from %v: expect change %v of apply ID %v, got %v", from, i, applyIDs[i], c)
+		}
+	}
+}
+
+func checkTestTruncated(t *testing.T, l *ChangeLog, from uint64) {
+	t.Helper()
+	if _, truncated, err := l.Read(from, 10); err != nil || !truncated {
+		t.Fatalf("read from %v: expect truncated, got %v err %v", from, truncated, err)
+	}
+}
+
+// Uses small segments and cache, so that the changes are read from the segments and dropped with them.
+func setTestChangeLogLimits() func() {
+	cached, size, segments := maxCachedChanges, changeLogSegmentSize, maxChangeLogSegments
+	maxCachedChanges, changeLogSegmentSize, maxChangeLogSegments = 2, 100, 3
+	return func() {
+		maxCachedChanges, changeLogSegmentSize, maxChangeLogSegments = cached, size, segments
+	}
+}
+
+func TestChangeLogRead(t *testing.T) {
+	l, cleanup := newTestChangeLog(t, 10)
+	defer cleanup()
+	appendTestChanges(t, l, 11, 12, 13)
+	// the changes of an apply ID are never split
+	two := append(newMetaChanges(proto.MetaChangeCreateInode, 14, 0, ""), newMetaChanges(proto.MetaChangeCreateInode, 14, 0, "")...)
+	if err := l.Append(14, 0, two...); err != nil {
+		t.Fatal(err)
+	}
+	// the entries replayed are skipped
+	appendTestChanges(t, l, 12)
+
+	checkTestChanges(t, l, 10, 2, 11, 12)
+	checkTestChanges(t, l, 12, 10, 13, 14, 14)
+	checkTestChanges(t, l, 13, 1, 14, 14)
+	checkTestChanges(t, l, 14, 10)
+	checkTestTruncated(t, l, 9)
+}
+
+func TestChangeLogSegments(t *testing.T) {
+	defer setTestChangeLogLimits()()
+	l, cleanup := newTestChangeLog(t, 0)
+	defer cleanup()
+	for id := uint64(1); id <= 5; id++ {
+		appendTestChanges(t, l, id)
+	}
+	if len(l.segments) < 2 {
+		t.Fatalf("expect the segments to be rotated, got %v", l.segments)
+	}
+	checkTestChanges(t, l, 0, 10, 1, 2, 3, 4, 5)
+	checkTestChanges(t, l, 2, 2, 3, 4)
+
+	// the oldest segments are dropped
+	for id := uint64(6); id <= 20; id++ {
+		appendTestChanges(t, l, id)
+	}
+	if len(l.segments) != maxChangeLogSegments {
+		t.Fatalf("expect %v segments, got %v", maxChangeLogSegments, l.segments)
+	}
+	checkTestTruncated(t, l, 0)
+	checkTestTruncated(t, l, l.first-1)
+	checkTestChanges(t, l, 19, 10, 20)
+	changes, _, err := l.Read(l.first, 100)
+	if err != nil || len(changes) == 0 || changes[len(changes)-1].ApplyID != 20 {
+		t.Fatalf("expect the changes after the first kept, got %v err %v", changes, err)
+	}
+}
+
+// The partial change written on crash is dropped, and the entries applied after the last change are not
+// taken as lost.
+func TestChangeLogLoad(t *testing.T) {
+	defer setTestChangeLogLimits()()
+	l, cleanup := newTestChangeLog(t, 0)
+	defer cleanup()
+	appendTestChanges(t, l, 1, 2, 3, 4, 5)
+	l.Close()
+	last := l.segmentFile(l.segments[len(l.segments)-1])
+	fp, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.WriteString(`{"op":1,"ino":6,"apply`)
+	fp.Close()
+
+	if err = l.Load(7); err != nil {
+		t.Fatal(err)
+	}
+	checkTestChanges(t, l, 0, 10, 1, 2, 3, 4, 5)
+	// the entries before the apply ID of the partition are not replayed
+	appendTestChanges(t, l, 7, 8)
+	checkTestChanges(t, l, 5, 10, 8)
+	checkTestChanges(t, l, 0, 10, 1, 2, 3, 4, 5, 8)
+
+	// the log is restarted without any segments
+	dir := l.dir
+	l.Close()
+	os.RemoveAll(dir)
+	if err = l.Load(9); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTruncated(t, l, 8)
+	checkTestChanges(t, l, 9, 10)
+}
+
+// The log is restarted after the changes failed to be appended, which is kept after the reload.
+func TestChangeLogAppendFailure(t *testing.T) {
+	l, cleanup := newTestChangeLog(t, 0)
+	defer cleanup()
+	appendTestChanges(t, l, 1, 2)
+	segment := l.segments[0]
+	l.file.Close()
+	if err := l.Append(3, 0, newMetaChanges(proto.MetaChangeCreateInode, 3, 0, "")...); err == nil {
+		t.Fatalf("expect the append to fail")
+	}
+	appendTestChanges(t, l, 4)
+	checkTestTruncated(t, l, 2)
+	checkTestChanges(t, l, 3, 10, 4)
+	if _, err := os.Stat(l.segmentFile(segment)); err != nil {
+		t.Fatalf("expect the segment before to be kept: %v", err)
+	}
+
+	l.Close()
+	if err := l.Load(4); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTruncated(t, l, 2)
+	checkTestChanges(t, l, 3, 10, 4)
+}
@@ -79,6 +79,42 @@ type (
 	EvictInodeReq = proto.EvictInodeRequest
 	// Client -> MetaNOde
 	SetattrRequest = proto.SetAttrRequest
+	// Client -> MetaNode
+	SetXAttrReq = proto.SetXAttrRequest
+	// Client -> MetaNode
+	GetXAttrReq = proto.GetXAttrRequest
+	// MetaNode -> Client
+	GetXAttrResp = proto.GetXAttrResponse
+	// Client -> MetaNode
+	ListXAttrReq = proto.ListXAttrRequest
+	// MetaNode -> Client
+	ListXAttrResp = proto.ListXAttrResponse
+	// Client -> MetaNode
+	RemoveXAttrReq = proto.RemoveXAttrRequest
+	// Client -> MetaNode
+	TxRenameReq = proto.TxRenameRequest
+	// MetaNode -> MetaNode
+	TxPrepareReq = proto.TxPrepareRequest
+	// MetaNode -> MetaNode
+	TxCommitReq = proto.TxCommitRequest
+	// MetaNode -> MetaNode
+	TxRollbackReq = proto.TxRollbackRequest
+	// MetaNode -> MetaNode
+	TxGetStateReq = proto.TxGetStateRequest
+	// MetaNode -> MetaNode
+	TxGetStateResp = proto.TxGetStateResponse
+	// Client -> MetaNode
+	SetInodeQuotaReq = proto.SetInodeQuotaRequest
+	// Client -> MetaNode
+	SetLockReq = proto.SetLockRequest
+	// Client -> MetaNode
+	GetLockReq = proto.GetLockRequest
+	// MetaNode -> Client
+	GetLockResp = proto.GetLockResponse
+	// Client -> MetaNode
+	RenewLockReq = proto.RenewLockRequest
+	// MetaNode -> Client
+	RenewLockResp = proto.RenewLockResponse
 )
 
 const (
@@ -102,6 +138,34 @@ const (
 	opFSMInternalDelExtentFile
 	opFSMInternalDelExtentCursor
 	opExtentFileSnapshot
+	opFSMSetXAttr
+	opFSMRemoveXAttr
+	opFSMTxInit
+	opFSMTxSetState
+	opFSMTxDelete
+	opFSMTxPrepare
+	opFSMTxCommit
+	opFSMTxRollback
+	opTxTableSnapshot
+	opFSMSetInodeQuota
+	opFSMCreateSnapshot
+	opFSMDeleteSnapshot
+	opMetaSnapshotInode
+	opMetaSnapshotDentry
+	opFSMEcConvertExtent
+	opFSMSetLock
+	opFSMRenewLock
+	opLockTableSnapshot
+	opFSMCreateShardDentry
+	opFSMSplitDir
+	opFSMRelocateExtents
+	opCheckpointDeleteInode
+	opCheckpointDeleteDentry
+	opFSMExtentsOverwrite
+	opFSMMarkDirRemoving
+	opFSMPutQuotaTask
+	opFSMDeleteQuotaTask
+	opQuotaTaskSnapshot
 )
 
 var (
@@ -118,18 +182,44 @@ const (
 	defaultMetadataDir = "metadataDir"
 	defaultRaftDir     = "raftDir"
 	defaultAuthTimeout = 5 // seconds
+
+	defaultDirShardThreshold = 1000000 // zero disables the split of the directories
+
+	// the stores of the inodes and the dentries
+	metadataStoreMemory        = "memory"
+	metadataStoreRocksDB       = "rocksdb"
+	defaultMetadataCachedItems = 100000 // items of a tree cached in memory by the rocksdb store
+
+	// the approximate memory used by an inode or a dentry, including the btree overhead,
+	// with which the memory footprint of a meta partition is estimated
+	approxInodeMemSize  = 400
+	approxDentryMemSize = 160
 )
 
 // Configuration keys
 const (
-	cfgLocalIP           = "localIP"
-	cfgListen            = "listen"
-	cfgMetadataDir       = "metadataDir"
-	cfgRaftDir           = "raftDir"
-	cfgMasterAddrs       = "masterAddrs"
-	cfgRaftHeartbeatPort = "raftHeartbeatPort"
-	cfgRaftReplicaPort   = "raftReplicaPort"
-	cfgTotalMem          = "totalMem"
+	cfgLocalIP             = "localIP"
+	cfgListen              = "listen"
+	cfgMetadataDir         = "metadataDir"
+	cfgRaftDir             = "raftDir"
+	cfgMasterAddrs         = "masterAddrs"
+	cfgRaftHeartbeatPort   = "raftHeartbeatPort"
+	cfgRaftReplicaPort     = "raftReplicaPort"
+	cfgTotalMem            = "totalMem"
+	cfgAuthenticate        = "authenticate" // require clients to present tickets issued by authnode
+	cfgServiceKey          = "serviceKey"   // key of the metanode service in authnode
+	cfgAuthNodes           = "authNodes"    // authnode addresses, to get tickets for accessing the master
+	cfgClientID            = "clientID"
+	cfgClientKey           = "clientKey"
+	cfgDirShardThreshold   = "dirShardThreshold"   // number of the entries of a directory to split it
+	cfgMetadataStore       = "metadataStore"       // memory or rocksdb
+	cfgMetadataCachedItems = "metadataCachedItems" // hot items of a tree cached by the rocksdb store
+	cfgAllowNoCaller       = "allowNoCaller"       // allow setattr and the ACLs without a caller, of the old clients
+)
+
+const (
+	// client ID in the tickets issued by a metanode to access the other metanodes
+	peerClientID = "metanode"
 )
 
 const (
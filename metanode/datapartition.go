@@ -27,6 +27,15 @@ type DataPartition struct {
 	ReplicaNum    uint8
 	PartitionType string
 	Hosts         []string
+	EcDataNum     uint8 // the partition is erasure-coded if it is not zero
+	EcParityNum   uint8
+	MediaType     string
+	Cold          bool // the partition is in the cold tier of the volume
+}
+
+// IsEc returns true if the data partition is erasure-coded.
+func (dp *DataPartition) IsEc() bool {
+	return dp.EcDataNum > 0
 }
 
 // GetAllAddrs returns all addresses of the data partition.
@@ -70,6 +79,30 @@ func (v *Vol) UpdatePartitions(partitions *DataPartitionsView) {
 	}
 }
 
+// EcPartitions returns the writable erasure-coded data partitions.
+func (v *Vol) EcPartitions() (partitions []*DataPartition) {
+	v.RLock()
+	defer v.RUnlock()
+	for _, dp := range v.dataPartitionView {
+		if dp.IsEc() && dp.Status == proto.ReadWrite {
+			partitions = append(partitions, dp)
+		}
+	}
+	return
+}
+
+// ColdPartitions returns the writable data partitions of the cold tier.
+func (v *Vol) ColdPartitions() (partitions []*DataPartition) {
+	v.RLock()
+	defer v.RUnlock()
+	for _, dp := range v.dataPartitionView {
+		if dp.Cold && !dp.IsEc() && dp.Status == proto.ReadWrite {
+			partitions = append(partitions, dp)
+		}
+	}
+	return
+}
+
 func (v *Vol) replaceOrInsert(partition *DataPartition) {
 	v.Lock()
 	defer v.Unlock()
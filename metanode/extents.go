@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
 	"sync"
 )
 
@@ -83,28 +84,69 @@ func (e *ExtentsTree) MarshalJSON() ([]byte, error) {
 	return e.Marshal()
 }
 
-// Append appends a btree item to the extent tree.
+// Append appends a btree item to the extent tree. The extent keys overlapping with the new one
+// are trimmed, and the ones completely covered are returned to be deleted, unless the extents
+// are still referenced by the tree.
 func (e *ExtentsTree) Append(key BtreeItem) (items []BtreeItem) {
-	var delItems []BtreeItem
+	var (
+		overlaps []*proto.ExtentKey
+		covered  []*proto.ExtentKey
+	)
 	ext := key.(*proto.ExtentKey)
-	lessFileOffset := ext.FileOffset + uint64(ext.Size)
-	e.AscendRange(key, &proto.ExtentKey{FileOffset: lessFileOffset},
+	start := ext.FileOffset
+	end := ext.FileOffset + uint64(ext.Size)
+	// only the last key before the new one may overlap with its head
+	e.DescendLessOrEqual(key, func(item BtreeItem) bool {
+		k := item.(*proto.ExtentKey)
+		if k.FileOffset >= start {
+			return true
+		}
+		if k.FileOffset+uint64(k.Size) > start {
+			overlaps = append(overlaps, k)
+		}
+		return false
+	})
+	e.AscendRange(key, &proto.ExtentKey{FileOffset: end},
 		func(item BtreeItem) bool {
-			delItems = append(delItems, item)
+			overlaps = append(overlaps, item.(*proto.ExtentKey))
 			return true
 		})
 
-	for _, item := range delItems {
-		delKey := item.(*proto.ExtentKey)
-		if delKey.PartitionId == ext.PartitionId && delKey.ExtentId == ext.
-			ExtentId {
-			continue
+	for _, k := range overlaps {
+		e.Delete(k)
+		parts := k.Trim(start, end)
+		for _, part := range parts {
+			e.ReplaceOrInsert(part, true)
+		}
+		if len(parts) == 0 {
+			covered = append(covered, k)
 		}
-		e.Delete(item)
-		items = append(items, item)
 	}
 	// add item to btree
 	e.ReplaceOrInsert(key, true)
+
+	for _, k := range covered {
+		if e.Referenced(k) {
+			continue
+		}
+		items = append(items, k)
+	}
+	return
+}
+
+// Referenced returns true if the data of the extent key is still referenced by the tree.
+// A tiny extent is shared by many files, so only the keys overlapping in it are counted.
+func (e *ExtentsTree) Referenced(ek *proto.ExtentKey) (found bool) {
+	tiny := storage.IsTinyExtent(ek.ExtentId)
+	e.Range(func(item BtreeItem) bool {
+		k := item.(*proto.ExtentKey)
+		if k.PartitionId != ek.PartitionId || k.ExtentId != ek.ExtentId {
+			return true
+		}
+		found = !tiny || (k.ExtentOffset < ek.ExtentOffset+uint64(ek.Size) &&
+			ek.ExtentOffset < k.ExtentOffset+uint64(k.Size))
+		return !found
+	})
 	return
 }
 
@@ -169,6 +211,6 @@ func (e *ExtentsTree) UnmarshalBinary(data []byte) (err error) {
 // Clone returns a copy of the extent tree.
 func (e *ExtentsTree) Clone() *ExtentsTree {
 	return &ExtentsTree{
-		BTree: e.GetTree(),
+		BTree: e.GetTree().(*BTree),
 	}
 }
@@ -0,0 +1,135 @@
+package metanode
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestExtentsTreeAppend(t *testing.T) {
+	key := func(fileOffset, extentID, extentOffset uint64, size uint32) proto.ExtentKey {
+		return proto.ExtentKey{FileOffset: fileOffset, PartitionId: 1, ExtentId: extentID, ExtentOffset: extentOffset, Size: size}
+	}
+	tests := []struct {
+		name    string
+		keys    []proto.ExtentKey
+		append  proto.ExtentKey
+		expect  []proto.ExtentKey
+		deleted []proto.ExtentKey
+	}{
+		{
+			name:   "empty",
+			append: key(0, 1024, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100)},
+		},
+		{
+			name:   "adjacent",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 100), key(200, 1026, 0, 100)},
+			append: key(100, 1025, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1025, 0, 100), key(200, 1026, 0, 100)},
+		},
+		{
+			name:   "extending the extent",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 100)},
+			append: key(100, 1024, 100, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1024, 100, 100)},
+		},
+		{
+			name:    "same range",
+			keys:    []proto.ExtentKey{key(0, 1024, 0, 100)},
+			append:  key(0, 1025, 0, 100),
+			expect:  []proto.ExtentKey{key(0, 1025, 0, 100)},
+			deleted: []proto.ExtentKey{key(0, 1024, 0, 100)},
+		},
+		{
+			name:   "same key",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 100)},
+			append: key(0, 1024, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100)},
+		},
+		{
+			name:   "head of a key",
+			keys:   []proto.ExtentKey{key(100, 1024, 0, 100)},
+			append: key(50, 1025, 0, 100),
+			expect: []proto.ExtentKey{key(50, 1025, 0, 100), key(150, 1024, 50, 50)},
+		},
+		{
+			name:   "tail of a key",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 100)},
+			append: key(50, 1025, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 50), key(50, 1025, 0, 100)},
+		},
+		{
+			name:   "inside a key",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 300)},
+			append: key(100, 1025, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1025, 0, 100), key(200, 1024, 200, 100)},
+		},
+		{
+			name:    "covering several keys",
+			keys:    []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1025, 0, 100), key(200, 1026, 0, 100), key(300, 1027, 0, 100)},
+			append:  key(50, 1028, 0, 300),
+			expect:  []proto.ExtentKey{key(0, 1024, 0, 50), key(50, 1028, 0, 300), key(350, 1027, 50, 50)},
+			deleted: []proto.ExtentKey{key(100, 1025, 0, 100), key(200, 1026, 0, 100)},
+		},
+		{
+			name:   "covered key of an extent still referenced",
+			keys:   []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1024, 100, 100)},
+			append: key(100, 1025, 0, 100),
+			expect: []proto.ExtentKey{key(0, 1024, 0, 100), key(100, 1025, 0, 100)},
+		},
+		{
+			name:    "covered key of a tiny extent",
+			keys:    []proto.ExtentKey{key(0, 1, 0, 100), key(100, 1, 4096, 100)},
+			append:  key(100, 1025, 0, 100),
+			expect:  []proto.ExtentKey{key(0, 1, 0, 100), key(100, 1025, 0, 100)},
+			deleted: []proto.ExtentKey{key(100, 1, 4096, 100)},
+		},
+	}
+	for _, tt := range tests {
+		tree := NewExtentsTree()
+		for i := range tt.keys {
+			tree.ReplaceOrInsert(&tt.keys[i], true)
+		}
+		appended := tt.append
+		items := tree.Append(&appended)
+		var keys, deleted []proto.ExtentKey
+		tree.Range(func(item BtreeItem) bool {
+			keys = append(keys, *item.(*proto.ExtentKey))
+			return true
+		})
+		for _, item := range items {
+			deleted = append(deleted, *item.(*proto.ExtentKey))
+		}
+		if !reflect.DeepEqual(keys, tt.expect) {
+			t.Errorf("%v: expect keys %v, got %v", tt.name, tt.expect, keys)
+		}
+		if !reflect.DeepEqual(deleted, tt.deleted) {
+			t.Errorf("%v: expect deleted keys %v, got %v", tt.name, tt.deleted, deleted)
+		}
+	}
+}
+
+func TestExtentsTreeReferenced(t *testing.T) {
+	tree := NewExtentsTree()
+	tree.ReplaceOrInsert(&proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, ExtentOffset: 0, Size: 100}, true)
+	tree.ReplaceOrInsert(&proto.ExtentKey{FileOffset: 100, PartitionId: 1, ExtentId: 1, ExtentOffset: 4096, Size: 100}, true)
+	tests := []struct {
+		name       string
+		key        proto.ExtentKey
+		referenced bool
+	}{
+		{name: "other range of the extent", key: proto.ExtentKey{PartitionId: 1, ExtentId: 1024, ExtentOffset: 1000, Size: 10}, referenced: true},
+		{name: "extent of another partition", key: proto.ExtentKey{PartitionId: 2, ExtentId: 1024, Size: 100}},
+		{name: "other extent", key: proto.ExtentKey{PartitionId: 1, ExtentId: 1025, Size: 100}},
+		{name: "overlapping in the tiny extent", key: proto.ExtentKey{PartitionId: 1, ExtentId: 1, ExtentOffset: 4000, Size: 100}, referenced: true},
+		{name: "before in the tiny extent", key: proto.ExtentKey{PartitionId: 1, ExtentId: 1, ExtentOffset: 3996, Size: 100}},
+		{name: "after in the tiny extent", key: proto.ExtentKey{PartitionId: 1, ExtentId: 1, ExtentOffset: 4196, Size: 100}},
+	}
+	for _, tt := range tests {
+		if referenced := tree.Referenced(&tt.key); referenced != tt.referenced {
+			t.Errorf("%v: expect referenced %v, got %v", tt.name, tt.referenced, referenced)
+		}
+	}
+}
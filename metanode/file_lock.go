@@ -0,0 +1,166 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// FileLockRecord defines an advisory lock held on an inode, which is released once its lease expires.
+type FileLockRecord struct {
+	proto.FileLock
+	Expire int64 `json:"expire"` // unix time in nanoseconds
+}
+
+// FileLockTable keeps the advisory file locks on the inodes of a meta partition. It is modified
+// by the raft log only, and the time of the modifications is set by the leader, so that the leases
+// expire alike on all the replicas.
+type FileLockTable struct {
+	sync.RWMutex
+	Locks map[uint64][]*FileLockRecord `json:"locks"` // inode -> locks
+}
+
+// NewFileLockTable returns a new FileLockTable.
+func NewFileLockTable() *FileLockTable {
+	return &FileLockTable{
+		Locks: make(map[uint64][]*FileLockRecord),
+	}
+}
+
+// Removes the expired locks on the inode, and returns the others.
+func (t *FileLockTable) prune(ino uint64, now int64) []*FileLockRecord {
+	records := t.Locks[ino]
+	live := records[:0]
+	for _, r := range records {
+		if r.Expire > now {
+			live = append(live, r)
+		}
+	}
+	if len(live) == 0 {
+		delete(t.Locks, ino)
+		return nil
+	}
+	t.Locks[ino] = live
+	return live
+}
+
+// GetConflict returns a lock on the inode which conflicts with the given one, or nil if there is none.
+func (t *FileLockTable) GetConflict(ino uint64, lock *proto.FileLock, now int64) *proto.FileLock {
+	t.RLock()
+	defer t.RUnlock()
+	for _, r := range t.Locks[ino] {
+		if r.Expire > now && r.Conflicts(lock) {
+			l := r.FileLock
+			return &l
+		}
+	}
+	return nil
+}
+
+// SetLock acquires or releases the lock on the inode, and returns false if the lock conflicts with
+// the locks of other owners. The lock replaces the locks of the same owner in its range, so that
+// a lock can be upgraded, downgraded or released partially. The leases of the other locks of the
+// client on the inode are renewed as well.
+func (t *FileLockTable) SetLock(ino uint64, lock *proto.FileLock, now int64) bool {
+	t.Lock()
+	defer t.Unlock()
+	records := t.prune(ino, now)
+	if lock.Type != proto.FileLockUnlock {
+		for _, r := range records {
+			if r.Conflicts(lock) {
+				return false
+			}
+		}
+	}
+	expire := now + int64(proto.FileLockLease)
+	result := make([]*FileLockRecord, 0, len(records)+1)
+	for _, r := range records {
+		if r.ClientID == lock.ClientID {
+			r.Expire = expire
+		}
+		if !r.SameOwner(lock) || r.End < lock.Start || r.Start > lock.End {
+			result = append(result, r)
+			continue
+		}
+		// keep the parts out of the range of the new lock
+		if r.Start < lock.Start {
+			left := *r
+			left.End = lock.Start - 1
+			result = append(result, &left)
+		}
+		if r.End > lock.End {
+			right := *r
+			right.Start = lock.End + 1
+			result = append(result, &right)
+		}
+	}
+	if lock.Type != proto.FileLockUnlock {
+		result = append(result, &FileLockRecord{FileLock: *lock, Expire: expire})
+	}
+	if len(result) == 0 {
+		delete(t.Locks, ino)
+	} else {
+		t.Locks[ino] = result
+	}
+	return true
+}
+
+// Renew renews the leases of the locks held by the client on the inodes, and returns the inodes
+// on which the client holds no lock, either released or expired. The expired locks of all the
+// inodes are removed as well.
+func (t *FileLockTable) Renew(clientID uint64, inodes []uint64, now int64) (released []uint64) {
+	t.Lock()
+	defer t.Unlock()
+	for ino := range t.Locks {
+		t.prune(ino, now)
+	}
+	expire := now + int64(proto.FileLockLease)
+	for _, ino := range inodes {
+		held := false
+		for _, r := range t.Locks[ino] {
+			if r.ClientID == clientID {
+				r.Expire = expire
+				held = true
+			}
+		}
+		if !held {
+			released = append(released, ino)
+		}
+	}
+	return
+}
+
+// Marshal marshals the FileLockTable into a byte array.
+func (t *FileLockTable) Marshal() ([]byte, error) {
+	t.RLock()
+	defer t.RUnlock()
+	return json.Marshal(t)
+}
+
+// Unmarshal unmarshals the FileLockTable.
+func (t *FileLockTable) Unmarshal(data []byte) (err error) {
+	t.Lock()
+	defer t.Unlock()
+	if err = json.Unmarshal(data, t); err != nil {
+		return
+	}
+	if t.Locks == nil {
+		t.Locks = make(map[uint64][]*FileLockRecord)
+	}
+	return
+}
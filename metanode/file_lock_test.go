@@ -0,0 +1,219 @@
+package metanode
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const testLease = int64(proto.FileLockLease)
+
+func testLock(owner uint64, typ uint32, start, end uint64) *proto.FileLock {
+	return &proto.FileLock{ClientID: owner / 10, Owner: owner, Type: typ, Start: start, End: end}
+}
+
+// Returns the locks on the inode as "owner type start-end", sorted.
+func testLocks(t *FileLockTable, ino uint64) []string {
+	var locks []string
+	for _, r := range t.Locks[ino] {
+		typ := "R"
+		if r.Type == proto.FileLockWrite {
+			typ = "W"
+		}
+		locks = append(locks, fmt.Sprintf("%v %v %v-%v", r.Owner, typ, r.Start, r.End))
+	}
+	sort.Strings(locks)
+	return locks
+}
+
+func TestFileLockTableSetLock(t *testing.T) {
+	const (
+		r = proto.FileLockRead
+		w = proto.FileLockWrite
+		u = proto.FileLockUnlock
+	)
+	type step struct {
+		lock *proto.FileLock
+		ok   bool
+	}
+	// the owners 10 and 11 are of the client 1, and the owner 20 is of the client 2
+	tests := []struct {
+		name  string
+		steps []step
+		want  []string
+	}{
+		{
+			name:  "shared overlapping",
+			steps: []step{{testLock(10, r, 0, 9), true}, {testLock(20, r, 5, 14), true}},
+			want:  []string{"10 R 0-9", "20 R 5-14"},
+		},
+		{
+			name:  "exclusive overlapping",
+			steps: []step{{testLock(10, r, 0, 9), true}, {testLock(20, w, 9, 14), false}, {testLock(11, w, 5, 5), false}},
+			want:  []string{"10 R 0-9"},
+		},
+		{
+			name:  "exclusive adjacent",
+			steps: []step{{testLock(10, w, 0, 9), true}, {testLock(20, w, 10, 19), true}, {testLock(11, r, 0, 9), false}},
+			want:  []string{"10 W 0-9", "20 W 10-19"},
+		},
+		{
+			// the adjacent locks of the same owner are kept apart, which is the same as merged
+			name:  "same owner adjacent",
+			steps: []step{{testLock(10, w, 0, 9), true}, {testLock(10, w, 10, 19), true}},
+			want:  []string{"10 W 0-9", "10 W 10-19"},
+		},
+		{
+			name:  "same owner overlapping",
+			steps: []step{{testLock(10, w, 0, 9), true}, {testLock(10, w, 5, 14), true}},
+			want:  []string{"10 W 0-4", "10 W 5-14"},
+		},
+		{
+			name: "unlock in the middle",
+			steps: []step{
+				{testLock(10, w, 0, 99), true},
+				{testLock(10, u, 40, 59), true},
+				{testLock(20, w, 40, 59), true},
+				{testLock(20, w, 39, 39), false},
+				{testLock(20, w, 60, 60), false},
+			},
+			want: []string{"10 W 0-39", "10 W 60-99", "20 W 40-59"},
+		},
+		{
+			name:  "unlock of other owner",
+			steps: []step{{testLock(10, w, 0, 99), true}, {testLock(20, u, 0, 99), true}, {testLock(11, u, 0, 99), true}},
+			want:  []string{"10 W 0-99"},
+		},
+		{
+			name:  "unlock to the end",
+			steps: []step{{testLock(10, r, 0, proto.FileLockEOF), true}, {testLock(10, u, 100, proto.FileLockEOF), true}},
+			want:  []string{"10 R 0-99"},
+		},
+		{
+			name:  "unlock all",
+			steps: []step{{testLock(10, r, 0, 9), true}, {testLock(10, r, 20, 29), true}, {testLock(10, u, 0, proto.FileLockEOF), true}},
+		},
+		{
+			name:  "upgrade",
+			steps: []step{{testLock(10, r, 0, 99), true}, {testLock(10, w, 50, 149), true}},
+			want:  []string{"10 R 0-49", "10 W 50-149"},
+		},
+		{
+			name:  "upgrade conflicting",
+			steps: []step{{testLock(10, r, 0, 99), true}, {testLock(20, r, 90, 99), true}, {testLock(10, w, 0, 99), false}},
+			want:  []string{"10 R 0-99", "20 R 90-99"},
+		},
+		{
+			name:  "downgrade",
+			steps: []step{{testLock(10, w, 0, 99), true}, {testLock(10, r, 0, 149), true}, {testLock(20, r, 0, 9), true}},
+			want:  []string{"10 R 0-149", "20 R 0-9"},
+		},
+		{
+			name:  "downgrade in the middle",
+			steps: []step{{testLock(10, w, 0, 99), true}, {testLock(10, r, 40, 59), true}},
+			want:  []string{"10 R 40-59", "10 W 0-39", "10 W 60-99"},
+		},
+	}
+	for _, tt := range tests {
+		table := NewFileLockTable()
+		for i, s := range tt.steps {
+			if ok := table.SetLock(1, s.lock, 0); ok != s.ok {
+				t.Errorf("%v: expect step %v %v to return %v", tt.name, i, s.lock, s.ok)
+			}
+		}
+		if got := testLocks(table, 1); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: expect locks %v, got %v", tt.name, tt.want, got)
+		}
+		if _, ok := table.Locks[1]; ok != (len(tt.want) > 0) {
+			t.Errorf("%v: expect the inode to be kept only with locks", tt.name)
+		}
+	}
+}
+
+func TestFileLockTableFlock(t *testing.T) {
+	table := NewFileLockTable()
+	flock := &proto.FileLock{ClientID: 1, Owner: 10, Type: proto.FileLockWrite, End: proto.FileLockEOF, Flock: true}
+	if !table.SetLock(1, flock, 0) {
+		t.Fatalf("expect the flock to be acquired")
+	}
+	// the POSIX locks of the same owner neither conflict with nor replace the flock
+	if !table.SetLock(1, testLock(20, proto.FileLockWrite, 0, 9), 0) || !table.SetLock(1, testLock(10, proto.FileLockUnlock, 0, 9), 0) {
+		t.Fatalf("expect the POSIX locks not to conflict with the flock")
+	}
+	other := *flock
+	other.ClientID, other.Owner, other.Type = 2, 20, proto.FileLockRead
+	if table.SetLock(1, &other, 0) {
+		t.Fatalf("expect the flock of the other owner to conflict")
+	}
+	if conflict := table.GetConflict(1, &other, 0); conflict == nil || *conflict != *flock {
+		t.Fatalf("expect the conflicting flock %v, got %v", flock, conflict)
+	}
+}
+
+func TestFileLockTableLease(t *testing.T) {
+	table := NewFileLockTable()
+	if !table.SetLock(1, testLock(10, proto.FileLockWrite, 0, 9), 0) ||
+		!table.SetLock(2, testLock(10, proto.FileLockWrite, 0, 9), 0) {
+		t.Fatalf("expect the locks to be acquired")
+	}
+	// setting a lock renews the leases of the other locks of the client on the same inode only
+	if !table.SetLock(1, testLock(11, proto.FileLockRead, 20, 29), testLease/2) {
+		t.Fatalf("expect the lock to be acquired")
+	}
+	lock := testLock(20, proto.FileLockWrite, 0, 9)
+	if conflict := table.GetConflict(1, lock, testLease); conflict == nil || conflict.Owner != 10 {
+		t.Fatalf("expect the renewed lock to conflict, got %v", conflict)
+	}
+	if conflict := table.GetConflict(2, lock, testLease); conflict != nil {
+		t.Fatalf("expect the lock to expire at the end of the lease, got %v", conflict)
+	}
+	if !table.SetLock(2, lock, testLease) {
+		t.Fatalf("expect the expired lock to be replaced")
+	}
+	if got := testLocks(table, 2); !reflect.DeepEqual(got, []string{"20 W 0-9"}) {
+		t.Fatalf("expect the expired lock to be removed, got %v", got)
+	}
+
+	// the client renews its locks, and learns the inodes on which it holds none
+	if released := table.Renew(1, []uint64{1, 2, 3}, testLease); !reflect.DeepEqual(released, []uint64{2, 3}) {
+		t.Fatalf("expect the released inodes [2 3], got %v", released)
+	}
+	if released := table.Renew(1, []uint64{1}, testLease*3/2); released != nil {
+		t.Fatalf("expect the renewed locks to be held, got released %v", released)
+	}
+	// the locks of the client 2 are not renewed, and expire
+	if released := table.Renew(1, []uint64{1}, testLease*2); released != nil {
+		t.Fatalf("expect the renewed locks to be held, got released %v", released)
+	}
+	if _, ok := table.Locks[2]; ok {
+		t.Fatalf("expect the expired locks of the other inodes to be removed")
+	}
+	if released := table.Renew(1, []uint64{1}, testLease*4); !reflect.DeepEqual(released, []uint64{1}) {
+		t.Fatalf("expect the locks to expire without renewal, got released %v", released)
+	}
+	if len(table.Locks) != 0 {
+		t.Fatalf("expect no lock left, got %v", table.Locks)
+	}
+}
+
+func TestFileLockTableMarshal(t *testing.T) {
+	table := NewFileLockTable()
+	table.SetLock(1, testLock(10, proto.FileLockWrite, 0, 9), 0)
+	data, err := table.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewFileLockTable()
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Locks, table.Locks) {
+		t.Fatalf("expect locks %v, got %v", table.Locks, loaded.Locks)
+	}
+	if err = loaded.Unmarshal([]byte("{}")); err != nil || loaded.Locks == nil {
+		t.Fatalf("expect an empty table, got %v %v", loaded.Locks, err)
+	}
+}
@@ -21,11 +21,18 @@ import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
 	"io"
+	"sort"
 	"sync"
 )
 
 const (
 	DeleteMarkFlag = 1 << 0
+	// XAttrMarkFlag is only set in the marshaled value, and indicates that
+	// the extended attributes are stored right after the Reserved field.
+	XAttrMarkFlag = 1 << 1
+	// QuotaMarkFlag is only set in the marshaled value, and indicates that
+	// the quota IDs are stored right after the extended attributes.
+	QuotaMarkFlag = 1 << 2
 )
 
 // Inode wraps necessary properties of `Inode` information in the file system.
@@ -41,6 +48,18 @@ const (
 //  +-------+------+------+-----+----+----+----+--------+------------------+
 //  | bytes |  4   |  8   |  8  | 8  | 8  | 8  |   4    |      ExtLen      |
 //  +-------+------+------+-----+----+----+----+--------+------------------+
+// Marshal extended attributes (only present if XAttrMarkFlag is set):
+//  +-------+-------+--------+-----+--------+-----+-----+
+//  | item  | Count | KeyLen | Key | ValLen | Val | ... |
+//  +-------+-------+--------+-----+--------+-----+-----+
+//  | bytes |   4   |   4    | Len |   4    | Len | ... |
+//  +-------+-------+--------+-----+--------+-----+-----+
+// Marshal quota IDs (only present if QuotaMarkFlag is set):
+//  +-------+-------+---------+-----+
+//  | item  | Count | QuotaID | ... |
+//  +-------+-------+---------+-----+
+//  | bytes |   4   |    4    | ... |
+//  +-------+-------+---------+-----+
 // Marshal entity:
 //  +-------+-----------+--------------+-----------+--------------+
 //  | item  | KeyLength | MarshaledKey | ValLength | MarshaledVal |
@@ -62,6 +81,8 @@ type Inode struct {
 	NLink      uint32 // NodeLink counts
 	Flag       int32
 	Reserved   uint64 // reserved space
+	XAttrs     map[string][]byte
+	QuotaIDs   []uint32 // quotas the inode is accounted to
 	Extents    *ExtentsTree
 }
 
@@ -85,6 +106,8 @@ func (i *Inode) String() string {
 	buff.WriteString(fmt.Sprintf("NLink[%d]", i.NLink))
 	buff.WriteString(fmt.Sprintf("Flag[%d]", i.Flag))
 	buff.WriteString(fmt.Sprintf("Reserved[%d]", i.Reserved))
+	buff.WriteString(fmt.Sprintf("XAttrs[%d]", len(i.XAttrs)))
+	buff.WriteString(fmt.Sprintf("QuotaIDs[%v]", i.QuotaIDs))
 	buff.WriteString(fmt.Sprintf("Extents[%s]", i.Extents))
 	buff.WriteString("}")
 	return buff.String()
@@ -135,6 +158,15 @@ func (i *Inode) Copy() BtreeItem {
 	newIno.NLink = i.NLink
 	newIno.Flag = i.Flag
 	newIno.Reserved = i.Reserved
+	if len(i.XAttrs) > 0 {
+		newIno.XAttrs = make(map[string][]byte, len(i.XAttrs))
+		for key, val := range i.XAttrs {
+			newIno.XAttrs[key] = append([]byte(nil), val...)
+		}
+	}
+	if len(i.QuotaIDs) > 0 {
+		newIno.QuotaIDs = append([]uint32(nil), i.QuotaIDs...)
+	}
 	newIno.Extents = i.Extents.Clone()
 	i.RUnlock()
 	return newIno
@@ -254,12 +286,25 @@ func (i *Inode) MarshalValue() (val []byte) {
 	if err = binary.Write(buff, binary.BigEndian, &i.NLink); err != nil {
 		panic(err)
 	}
-	if err = binary.Write(buff, binary.BigEndian, &i.Flag); err != nil {
+	flag := i.Flag
+	if len(i.XAttrs) > 0 {
+		flag |= XAttrMarkFlag
+	}
+	if len(i.QuotaIDs) > 0 {
+		flag |= QuotaMarkFlag
+	}
+	if err = binary.Write(buff, binary.BigEndian, &flag); err != nil {
 		panic(err)
 	}
 	if err = binary.Write(buff, binary.BigEndian, &i.Reserved); err != nil {
 		panic(err)
 	}
+	if flag&XAttrMarkFlag != 0 {
+		i.marshalXAttrs(buff)
+	}
+	if flag&QuotaMarkFlag != 0 {
+		i.marshalQuotaIDs(buff)
+	}
 	// marshal ExtentsKey
 	extData, err := i.Extents.MarshalBinary()
 	if err != nil {
@@ -322,6 +367,18 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 	if err = binary.Read(buff, binary.BigEndian, &i.Reserved); err != nil {
 		return
 	}
+	if i.Flag&XAttrMarkFlag != 0 {
+		i.Flag &^= XAttrMarkFlag
+		if err = i.unmarshalXAttrs(buff); err != nil {
+			return
+		}
+	}
+	if i.Flag&QuotaMarkFlag != 0 {
+		i.Flag &^= QuotaMarkFlag
+		if err = i.unmarshalQuotaIDs(buff); err != nil {
+			return
+		}
+	}
 	if buff.Len() == 0 {
 		return
 	}
@@ -335,6 +392,79 @@ func (i *Inode) UnmarshalValue(val []byte) (err error) {
 	return
 }
 
+// marshalXAttrs writes the extended attributes sorted by key, so that
+// replicas always produce the same snapshot bytes.
+func (i *Inode) marshalXAttrs(buff *bytes.Buffer) {
+	keys := make([]string, 0, len(i.XAttrs))
+	for key := range i.XAttrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	count := uint32(len(keys))
+	if err := binary.Write(buff, binary.BigEndian, &count); err != nil {
+		panic(err)
+	}
+	for _, key := range keys {
+		val := i.XAttrs[key]
+		keyLen := uint32(len(key))
+		if err := binary.Write(buff, binary.BigEndian, &keyLen); err != nil {
+			panic(err)
+		}
+		buff.WriteString(key)
+		valLen := uint32(len(val))
+		if err := binary.Write(buff, binary.BigEndian, &valLen); err != nil {
+			panic(err)
+		}
+		buff.Write(val)
+	}
+}
+
+func (i *Inode) marshalQuotaIDs(buff *bytes.Buffer) {
+	count := uint32(len(i.QuotaIDs))
+	if err := binary.Write(buff, binary.BigEndian, &count); err != nil {
+		panic(err)
+	}
+	if err := binary.Write(buff, binary.BigEndian, i.QuotaIDs); err != nil {
+		panic(err)
+	}
+}
+
+func (i *Inode) unmarshalQuotaIDs(buff *bytes.Buffer) (err error) {
+	var count uint32
+	if err = binary.Read(buff, binary.BigEndian, &count); err != nil {
+		return
+	}
+	i.QuotaIDs = make([]uint32, count)
+	err = binary.Read(buff, binary.BigEndian, i.QuotaIDs)
+	return
+}
+
+func (i *Inode) unmarshalXAttrs(buff *bytes.Buffer) (err error) {
+	var count, keyLen, valLen uint32
+	if err = binary.Read(buff, binary.BigEndian, &count); err != nil {
+		return
+	}
+	i.XAttrs = make(map[string][]byte, count)
+	for n := uint32(0); n < count; n++ {
+		if err = binary.Read(buff, binary.BigEndian, &keyLen); err != nil {
+			return
+		}
+		key := make([]byte, keyLen)
+		if _, err = io.ReadFull(buff, key); err != nil {
+			return
+		}
+		if err = binary.Read(buff, binary.BigEndian, &valLen); err != nil {
+			return
+		}
+		val := make([]byte, valLen)
+		if _, err = io.ReadFull(buff, val); err != nil {
+			return
+		}
+		i.XAttrs[string(key)] = val
+	}
+	return
+}
+
 // AppendExtents append the extent to the btree.
 func (i *Inode) AppendExtents(exts []BtreeItem, ct int64) (items []BtreeItem) {
 	i.Lock()
@@ -352,6 +482,15 @@ func (i *Inode) AppendExtents(exts []BtreeItem, ct int64) (items []BtreeItem) {
 	return
 }
 
+// OverwriteExtents records that the extents are overwritten in place, which change neither the extent keys
+// nor the size, so that the clients refreshing the extents drop the data cached before.
+func (i *Inode) OverwriteExtents(ct int64) {
+	i.Lock()
+	i.Generation++
+	i.ModifyTime = ct
+	i.Unlock()
+}
+
 // ExtentsTruncate truncates the extents.
 func (i *Inode) ExtentsTruncate(exts []BtreeItem, length uint64, ct int64) {
 	i.Lock()
@@ -363,7 +502,10 @@ func (i *Inode) ExtentsTruncate(exts []BtreeItem, length uint64, ct int64) {
 	if item != nil {
 		ext := item.(*proto.ExtentKey)
 		if (ext.FileOffset + uint64(ext.Size)) > length {
-			ext.Size = uint32(length - ext.FileOffset)
+			// the extent keys may be shared with the snapshots, so replace it with a trimmed copy
+			newExt := *ext
+			newExt.Size = uint32(length - ext.FileOffset)
+			i.Extents.ReplaceOrInsert(&newExt, true)
 		}
 	}
 	i.Size = length
@@ -429,7 +571,7 @@ func (i *Inode) ShouldDelete() bool {
 // SetAttr sets the attributes of the inode.
 func (i *Inode) SetAttr(valid, mode, uid, gid uint32) {
 	i.Lock()
-	if mode&proto.AttrMode != 0 {
+	if valid&proto.AttrMode != 0 {
 		i.Type = mode
 	}
 	if valid&proto.AttrUid != 0 {
@@ -441,6 +583,77 @@ func (i *Inode) SetAttr(valid, mode, uid, gid uint32) {
 	i.Unlock()
 }
 
+// GetXAttr returns the value of the extended attribute.
+func (i *Inode) GetXAttr(key string) (val []byte, ok bool) {
+	i.RLock()
+	defer i.RUnlock()
+	if val, ok = i.XAttrs[key]; ok {
+		val = append([]byte(nil), val...)
+	}
+	return
+}
+
+// SetXAttr sets the value of the extended attribute.
+func (i *Inode) SetXAttr(key string, val []byte) {
+	i.Lock()
+	if i.XAttrs == nil {
+		i.XAttrs = make(map[string][]byte)
+	}
+	i.XAttrs[key] = val
+	i.Unlock()
+}
+
+// RemoveXAttr removes the extended attribute and returns if it existed.
+func (i *Inode) RemoveXAttr(key string) (ok bool) {
+	i.Lock()
+	if _, ok = i.XAttrs[key]; ok {
+		delete(i.XAttrs, key)
+	}
+	i.Unlock()
+	return
+}
+
+// ListXAttr returns the sorted keys of the extended attributes.
+func (i *Inode) ListXAttr() (keys []string) {
+	i.RLock()
+	keys = make([]string, 0, len(i.XAttrs))
+	for key := range i.XAttrs {
+		keys = append(keys, key)
+	}
+	i.RUnlock()
+	sort.Strings(keys)
+	return
+}
+
+// AddQuota accounts the inode to the quota, and returns false if it is already accounted.
+func (i *Inode) AddQuota(quotaID uint32) bool {
+	i.Lock()
+	defer i.Unlock()
+	for _, id := range i.QuotaIDs {
+		if id == quotaID {
+			return false
+		}
+	}
+	i.QuotaIDs = append(i.QuotaIDs, quotaID)
+	return true
+}
+
+// RemoveQuota removes the inode from the quota, and returns false if it is not accounted.
+func (i *Inode) RemoveQuota(quotaID uint32) bool {
+	i.Lock()
+	defer i.Unlock()
+	for k, id := range i.QuotaIDs {
+		if id == quotaID {
+			i.QuotaIDs = append(i.QuotaIDs[:k], i.QuotaIDs[k+1:]...)
+			if len(i.QuotaIDs) == 0 {
+				i.QuotaIDs = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
 func (i *Inode) DoWriteFunc(fn func()) {
 	i.Lock()
 	fn()
@@ -0,0 +1,104 @@
+package metanode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Only the attributes marked valid are changed, whatever the bits of the mode are.
+func TestInodeSetAttr(t *testing.T) {
+	const mode = 0644
+	tests := []struct {
+		name  string
+		valid uint32
+		mode  uint32
+		uid   uint32
+		gid   uint32
+		want  [3]uint32
+	}{
+		{"chmod", proto.AttrMode, proto.Mode(0600), 0, 0, [3]uint32{proto.Mode(0600), 1, 1}},
+		// the other-execute bit is the same as the mask of the mode
+		{"chmod executable", proto.AttrMode, proto.Mode(0755), 0, 0, [3]uint32{proto.Mode(0755), 1, 1}},
+		{"chown", proto.AttrUid | proto.AttrGid, 0, 2, 3, [3]uint32{proto.Mode(mode), 2, 3}},
+		{"chown with mode", proto.AttrUid, proto.Mode(0777), 2, 3, [3]uint32{proto.Mode(mode), 2, 1}},
+		{"chgrp with mode", proto.AttrGid, proto.Mode(0701), 2, 3, [3]uint32{proto.Mode(mode), 1, 3}},
+		{"none", 0, proto.Mode(0777), 2, 3, [3]uint32{proto.Mode(mode), 1, 1}},
+	}
+	for _, tt := range tests {
+		ino := NewInode(2, proto.Mode(mode))
+		ino.Uid, ino.Gid = 1, 1
+		ino.SetAttr(tt.valid, tt.mode, tt.uid, tt.gid)
+		if got := [3]uint32{ino.Type, ino.Uid, ino.Gid}; got != tt.want {
+			t.Errorf("%v: expect mode/uid/gid %o/%v/%v, got %o/%v/%v", tt.name, tt.want[0], tt.want[1], tt.want[2],
+				got[0], got[1], got[2])
+		}
+	}
+}
+
+func checkTestInodeUnmarshal(t *testing.T, ino *Inode) *Inode {
+	t.Helper()
+	data, err := ino.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := NewInode(0, 0)
+	if err = got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Inode != ino.Inode || got.Type != ino.Type || got.Flag != ino.Flag || got.NLink != ino.NLink ||
+		!reflect.DeepEqual(got.XAttrs, ino.XAttrs) || !reflect.DeepEqual(got.QuotaIDs, ino.QuotaIDs) {
+		t.Fatalf("expect %v xattrs %v quotas %v, got %v xattrs %v quotas %v", ino, ino.XAttrs, ino.QuotaIDs,
+			got, got.XAttrs, got.QuotaIDs)
+	}
+	if got.Extents.String() != ino.Extents.String() {
+		t.Fatalf("expect extents %v, got %v", ino.Extents, got.Extents)
+	}
+	return got
+}
+
+// The extended attributes are marshaled along with the quotas and the extents, whose flags are not kept.
+func TestInodeXAttrMarshal(t *testing.T) {
+	ino := NewInode(10, proto.Mode(0644))
+	ino.Extents.Append(&proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 100})
+	plain := checkTestInodeUnmarshal(t, ino)
+	if plain.XAttrs != nil {
+		t.Fatalf("expect no xattrs, got %v", plain.XAttrs)
+	}
+
+	ino.SetXAttr("user.b", []byte("value"))
+	ino.SetXAttr("user.a", []byte{})
+	ino.SetXAttr(proto.XAttrACLAccess, proto.ACL{{Tag: proto.ACLUserObj, Perm: 6}}.Marshal())
+	checkTestInodeUnmarshal(t, ino)
+	ino.QuotaIDs = []uint32{1, 2}
+	got := checkTestInodeUnmarshal(t, ino)
+	if got.Flag&(XAttrMarkFlag|QuotaMarkFlag) != 0 {
+		t.Fatalf("expect the mark flags not to be kept, got flag %v", got.Flag)
+	}
+	if keys := got.ListXAttr(); !reflect.DeepEqual(keys, []string{"system.posix_acl_access", "user.a", "user.b"}) {
+		t.Fatalf("expect the keys sorted, got %v", keys)
+	}
+
+	// the attributes are marshaled in the same bytes whatever the order they are set in
+	other := NewInode(10, proto.Mode(0644))
+	other.Extents.Append(&proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 100})
+	other.QuotaIDs = []uint32{1, 2}
+	for _, key := range []string{proto.XAttrACLAccess, "user.a", "user.b"} {
+		val, _ := ino.GetXAttr(key)
+		other.SetXAttr(key, val)
+	}
+	data, _ := ino.Marshal()
+	otherData, _ := other.Marshal()
+	if !bytes.Equal(data, otherData) {
+		t.Fatalf("expect the same bytes of the same attributes")
+	}
+
+	// the copy does not share the attributes
+	cp := got.Copy().(*Inode)
+	cp.SetXAttr("user.a", []byte("changed"))
+	if val, _ := got.GetXAttr("user.a"); len(val) != 0 {
+		t.Fatalf("expect the xattr of the copy not shared, got %q", val)
+	}
+}
@@ -51,6 +51,10 @@ type MetadataManagerConfig struct {
 	NodeID    uint64
 	RootDir   string
 	RaftStore raftstore.RaftStore
+	// Handshake authenticates the connections to the other metanodes.
+	Handshake util.HandshakeFunc
+	// DataHandshake authenticates the connections to the datanodes.
+	DataHandshake util.HandshakeFunc
 }
 
 type metadataManager struct {
@@ -58,9 +62,14 @@ type metadataManager struct {
 	rootDir    string
 	raftStore  raftstore.RaftStore
 	connPool   *util.ConnectPool
+	handshake  util.HandshakeFunc
 	state      uint32
 	mu         sync.RWMutex
 	partitions map[uint64]MetaPartition // Key: metaRangeId, Val: metaPartition
+
+	// connections to the datanodes, which are authenticated with the tickets of the data service
+	dataConnPool  *util.ConnectPool
+	dataHandshake util.HandshakeFunc
 }
 
 // HandleMetadataOperation handles the metadata operations.
@@ -122,6 +131,54 @@ func (m *metadataManager) HandleMetadataOperation(conn net.Conn, p *Packet,
 		err = m.opMetaPartitionTryToLeader(conn, p, remoteAddr)
 	case proto.OpMetaBatchInodeGet:
 		err = m.opMetaBatchInodeGet(conn, p, remoteAddr)
+	case proto.OpMetaSetXAttr:
+		err = m.opMetaSetXAttr(conn, p, remoteAddr)
+	case proto.OpMetaGetXAttr:
+		err = m.opMetaGetXAttr(conn, p, remoteAddr)
+	case proto.OpMetaListXAttr:
+		err = m.opMetaListXAttr(conn, p, remoteAddr)
+	case proto.OpMetaRemoveXAttr:
+		err = m.opMetaRemoveXAttr(conn, p, remoteAddr)
+	case proto.OpMetaTxRename:
+		err = m.opMetaTxRename(conn, p, remoteAddr)
+	case proto.OpMetaTxPrepare:
+		err = m.opMetaTxPrepare(conn, p, remoteAddr)
+	case proto.OpMetaTxCommit:
+		err = m.opMetaTxCommit(conn, p, remoteAddr)
+	case proto.OpMetaTxRollback:
+		err = m.opMetaTxRollback(conn, p, remoteAddr)
+	case proto.OpMetaTxGetState:
+		err = m.opMetaTxGetState(conn, p, remoteAddr)
+	case proto.OpMetaSetInodeQuota:
+		err = m.opMetaSetInodeQuota(conn, p, remoteAddr)
+	case proto.OpMetaSetLock:
+		err = m.opMetaSetLock(conn, p, remoteAddr)
+	case proto.OpMetaGetLock:
+		err = m.opMetaGetLock(conn, p, remoteAddr)
+	case proto.OpMetaRenewLock:
+		err = m.opMetaRenewLock(conn, p, remoteAddr)
+	case proto.OpCreateMetaSnapshot:
+		err = m.opCreateMetaSnapshot(conn, p, remoteAddr)
+	case proto.OpDeleteMetaSnapshot:
+		err = m.opDeleteMetaSnapshot(conn, p, remoteAddr)
+	case proto.OpMetaSplitDir:
+		err = m.opSplitDir(conn, p, remoteAddr)
+	case proto.OpMetaApplyQuota:
+		err = m.opApplyQuota(conn, p, remoteAddr)
+	case proto.OpMetaExtentsOverwrite:
+		err = m.opMetaExtentsOverwrite(conn, p, remoteAddr)
+	case proto.OpMetaGetExtentRefs:
+		err = m.opGetExtentRefs(conn, p, remoteAddr)
+	case proto.OpMetaRelocateExtents:
+		err = m.opRelocateExtents(conn, p, remoteAddr)
+	case proto.OpMetaTierMigrate:
+		err = m.opTierMigrate(conn, p, remoteAddr)
+	case proto.OpMetaReadChanges:
+		err = m.opReadChanges(conn, p, remoteAddr)
+	case proto.OpMetaRestoreTrash:
+		err = m.opRestoreTrash(conn, p, remoteAddr)
+	case proto.OpMetaMarkDirRemoving:
+		err = m.opMarkDirRemoving(conn, p, remoteAddr)
 	default:
 		err = fmt.Errorf("%s unknown Opcode: %d, reqId: %d", remoteAddr,
 			p.Opcode, p.GetReqID())
@@ -158,9 +215,16 @@ func (m *metadataManager) Stop() {
 	}
 }
 
-// onStart creates the connection pool and loads the partitions.
+// onStart creates the connection pools and loads the partitions.
 func (m *metadataManager) onStart() (err error) {
 	m.connPool = util.NewConnectPool()
+	if m.handshake != nil {
+		m.connPool.SetHandshake(m.handshake)
+	}
+	m.dataConnPool = util.NewConnectPool()
+	if m.dataHandshake != nil {
+		m.dataConnPool.SetHandshake(m.dataHandshake)
+	}
 	err = m.loadPartitions()
 	return
 }
@@ -240,7 +304,7 @@ func (m *metadataManager) loadPartitions() (err error) {
 					NodeId:    m.nodeId,
 					RaftStore: m.raftStore,
 					RootDir:   path.Join(m.rootDir, fileName),
-					ConnPool:  m.connPool,
+					ConnPool:  m.dataConnPool,
 				}
 				partitionConfig.AfterStop = func() {
 					m.detachPartition(id)
@@ -317,7 +381,7 @@ func (m *metadataManager) createPartition(id uint64, volName string, start,
 		RaftStore:   m.raftStore,
 		NodeId:      m.nodeId,
 		RootDir:     path.Join(m.rootDir, partitionPrefix+partitionId),
-		ConnPool:    m.connPool,
+		ConnPool:    m.dataConnPool,
 	}
 	mpc.AfterStop = func() {
 		// TODO Unhandled errors
@@ -370,9 +434,11 @@ func (m *metadataManager) MarshalJSON() (data []byte, err error) {
 // NewMetadataManager returns a new metadata manager.
 func NewMetadataManager(conf MetadataManagerConfig) MetadataManager {
 	return &metadataManager{
-		nodeId:     conf.NodeID,
-		rootDir:    conf.RootDir,
-		raftStore:  conf.RaftStore,
-		partitions: make(map[uint64]MetaPartition),
+		nodeId:        conf.NodeID,
+		rootDir:       conf.RootDir,
+		raftStore:     conf.RaftStore,
+		handshake:     conf.Handshake,
+		dataHandshake: conf.DataHandshake,
+		partitions:    make(map[uint64]MetaPartition),
 	}
 }
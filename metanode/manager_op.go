@@ -68,12 +68,19 @@ func (m *metadataManager) opMasterHeartbeat(conn net.Conn, p *Packet,
 			Status:      proto.ReadWrite,
 			MaxInodeID:  mConf.Cursor,
 			VolName:     mConf.VolName,
+			ApplyID:     partition.GetApplyID(),
 		}
+		mpr.InodeCount, mpr.DentryCount = partition.GetItemCount()
+		mpr.MemSize = mpr.InodeCount*approxInodeMemSize + mpr.DentryCount*approxDentryMemSize
 		addr, isLeader := partition.IsLeader()
 		if addr == "" {
 			mpr.Status = proto.Unavailable
 		}
 		mpr.IsLeader = isLeader
+		if isLeader {
+			mpr.QuotaUsages = partition.GetQuotaUsages()
+			mpr.LargeDirs = partition.GetLargeDirs()
+		}
 		if mConf.Cursor >= mConf.End {
 			mpr.Status = proto.ReadOnly
 		}
@@ -464,6 +471,36 @@ func (m *metadataManager) opMetaExtentsAdd(conn net.Conn, p *Packet,
 	return
 }
 
+func (m *metadataManager) opMetaExtentsOverwrite(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &proto.OverwriteExtentsRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("%s, response to client: %s", err.Error(),
+			p.GetResultMsg())
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	err = mp.ExtentsOverwrite(req, p)
+	m.respondToClient(conn, p)
+	if err != nil {
+		log.LogErrorf("%s [opMetaExtentsOverwrite] ExtentsOverwrite: %s, "+
+			"response to client: %s", remoteAddr, err.Error(), p.GetResultMsg())
+	}
+	log.LogDebugf("%s [opMetaExtentsOverwrite] req: %d - %v, resp: %v",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
 func (m *metadataManager) opMetaExtentsList(conn net.Conn, p *Packet,
 	remoteAddr string) (err error) {
 	req := &proto.GetExtentsRequest{}
@@ -835,3 +872,673 @@ errDeal:
 	m.respondToClient(conn, p)
 	return
 }
+
+func (m *metadataManager) opMetaSetXAttr(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &SetXAttrReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetXAttr]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.SetXAttr(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaSetXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaSetXAttr] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaGetXAttr(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &GetXAttrReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaGetXAttr]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaGetXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.GetXAttr(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaGetXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaGetXAttr] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaListXAttr(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &ListXAttrReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaListXAttr]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaListXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.ListXAttr(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaListXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaListXAttr] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaRemoveXAttr(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &RemoveXAttrReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaRemoveXAttr]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaRemoveXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.RemoveXAttr(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaRemoveXAttr] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaRemoveXAttr] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaTxRename(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &TxRenameReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxRename]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxRename] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TxRename(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaTxRename] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaTxRename] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaTxPrepare(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &TxPrepareReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxPrepare]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxPrepare] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TxPrepare(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaTxPrepare] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaTxPrepare] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaTxCommit(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &TxCommitReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxCommit]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxCommit] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TxCommit(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaTxCommit] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaTxCommit] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaTxRollback(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &TxRollbackReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxRollback]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxRollback] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TxRollback(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaTxRollback] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaTxRollback] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaTxGetState(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &TxGetStateReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxGetState]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaTxGetState] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TxGetState(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaTxGetState] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaTxGetState] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaSetInodeQuota(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &SetInodeQuotaReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetInodeQuota]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetInodeQuota] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.SetInodeQuota(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaSetInodeQuota] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaSetInodeQuota] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaSetLock(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &SetLockReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetLock]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaSetLock] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.SetLock(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaSetLock] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaSetLock] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaGetLock(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &GetLockReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaGetLock]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaGetLock] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.GetLock(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaGetLock] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaGetLock] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opMetaRenewLock(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	req := &RenewLockReq{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaRenewLock]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMetaRenewLock] %s, req: %s", err.Error(),
+			string(p.Data))
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.RenewLock(req, p); err != nil {
+		err = errors.NewErrorf("[opMetaRenewLock] %s, req: %s", err.Error(),
+			string(p.Data))
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opMetaRenewLock] req: %d - %v, resp: %v, body: %s",
+		remoteAddr, p.GetReqID(), req, p.GetResultMsg(), p.Data)
+	return
+}
+
+func (m *metadataManager) opCreateMetaSnapshot(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	return m.opMetaSnapshot(conn, p, remoteAddr, "opCreateMetaSnapshot",
+		func(mp MetaPartition, req *proto.MetaSnapshotRequest) error {
+			return mp.CreateSnapshot(req, p)
+		})
+}
+
+func (m *metadataManager) opDeleteMetaSnapshot(conn net.Conn, p *Packet,
+	remoteAddr string) (err error) {
+	return m.opMetaSnapshot(conn, p, remoteAddr, "opDeleteMetaSnapshot",
+		func(mp MetaPartition, req *proto.MetaSnapshotRequest) error {
+			return mp.DeleteSnapshot(req, p)
+		})
+}
+
+// Handle the snapshot admin tasks sent by the master.
+func (m *metadataManager) opMetaSnapshot(conn net.Conn, p *Packet, remoteAddr, action string,
+	op func(mp MetaPartition, req *proto.MetaSnapshotRequest) error) (err error) {
+	req := &proto.MetaSnapshotRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%s]: %s", action, err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[%s] %s, req: %v", action, err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = op(mp, req); err != nil {
+		err = errors.NewErrorf("[%s] %s, req: %v", action, err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [%s] req: %d - %v, resp: %v", remoteAddr, action,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+// Handle the admin task of the master to split a directory.
+func (m *metadataManager) opSplitDir(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.SplitDirRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opSplitDir]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opSplitDir] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.SplitDir(req, p); err != nil {
+		err = errors.NewErrorf("[opSplitDir] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opSplitDir] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+func (m *metadataManager) opMarkDirRemoving(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.MarkDirRemovingRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMarkDirRemoving]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opMarkDirRemoving] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.MarkDirRemoving(req, p); err != nil {
+		err = errors.NewErrorf("[opMarkDirRemoving] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opMarkDirRemoving] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+// Handle the request of the master, or another meta partition, to account the inodes to a quota.
+func (m *metadataManager) opApplyQuota(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.ApplyQuotaRequest{}
+	adminTask := &proto.AdminTask{
+		Request: req,
+	}
+	decode := json.NewDecoder(bytes.NewBuffer(p.Data))
+	decode.UseNumber()
+	if err = decode.Decode(adminTask); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opApplyQuota]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opApplyQuota] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.ApplyQuota(req, p); err != nil {
+		err = errors.NewErrorf("[opApplyQuota] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opApplyQuota] req: %d - quota(%v) inodes(%v) dirs(%v), resp: %v", remoteAddr,
+		p.GetReqID(), req.QuotaID, len(req.Inodes), len(req.Dirs), p.GetResultMsg())
+	return
+}
+
+// Handle the request of a data node to list the keys referencing its tiny extents.
+func (m *metadataManager) opGetExtentRefs(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.GetExtentRefsRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opGetExtentRefs]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opGetExtentRefs] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.GetExtentRefs(req, p); err != nil {
+		err = errors.NewErrorf("[opGetExtentRefs] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogDebugf("%s [opGetExtentRefs] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+// Handle the request of a data node to replace the keys of its tiny extents with the relocated ones.
+func (m *metadataManager) opRelocateExtents(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.RelocateExtentsRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opRelocateExtents]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opRelocateExtents] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.RelocateExtents(req, p); err != nil {
+		err = errors.NewErrorf("[opRelocateExtents] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opRelocateExtents] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+func (m *metadataManager) opTierMigrate(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.TierMigrateRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opTierMigrate]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opTierMigrate] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.TierMigrate(req, p); err != nil {
+		err = errors.NewErrorf("[opTierMigrate] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opTierMigrate] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+func (m *metadataManager) opReadChanges(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.ReadMetaChangesRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opReadChanges]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opReadChanges] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.ReadChanges(req, p); err != nil {
+		err = errors.NewErrorf("[opReadChanges] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opReadChanges] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
+
+func (m *metadataManager) opRestoreTrash(conn net.Conn, p *Packet, remoteAddr string) (err error) {
+	req := &proto.RestoreTrashRequest{}
+	if err = json.Unmarshal(p.Data, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opRestoreTrash]: %s", err.Error())
+		return
+	}
+	mp, err := m.getPartition(req.PartitionID)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, []byte(err.Error()))
+		m.respondToClient(conn, p)
+		err = errors.NewErrorf("[opRestoreTrash] %s, req: %v", err.Error(), req)
+		return
+	}
+	if !m.serveProxy(conn, mp, p) {
+		return
+	}
+	if err = mp.RestoreTrash(req, p); err != nil {
+		err = errors.NewErrorf("[opRestoreTrash] %s, req: %v", err.Error(), req)
+	}
+	m.respondToClient(conn, p)
+	log.LogInfof("%s [opRestoreTrash] req: %d - %v, resp: %v", remoteAddr,
+		p.GetReqID(), req, p.GetResultMsg())
+	return
+}
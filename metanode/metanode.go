@@ -23,13 +23,16 @@ import (
 	"time"
 
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -39,6 +42,16 @@ var (
 	clusterInfo    *proto.ClusterInfo
 	masterHelper   util.MasterHelper
 	configTotalMem uint64
+
+	// the directories with more entries are reported to the master to be split
+	dirShardThreshold uint64 = defaultDirShardThreshold
+
+	// where the inodes and the dentries of the meta partitions are stored
+	metadataStore       = metadataStoreMemory
+	metadataCachedItems = defaultMetadataCachedItems
+
+	// the requests of setattr and of the ACLs without a caller, from the clients older than it, are allowed
+	allowNoCaller bool
 )
 
 // The MetaNode manages the dentry and inode information of the meta partitions on a meta node.
@@ -57,6 +70,10 @@ type MetaNode struct {
 	httpStopC         chan uint8
 	state             uint32
 	wg                sync.WaitGroup
+	authenticate      bool
+	serviceKey        []byte
+	peerAuth          *auth.Authenticator
+	authenticator     *auth.Authenticator // obtains the tickets of the master and data services from authnode
 }
 
 // Start starts up the meta node with the specified configuration.
@@ -193,6 +210,25 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 	m.raftHeartbeatPort = cfg.GetString(cfgRaftHeartbeatPort)
 	m.raftReplicatePort = cfg.GetString(cfgRaftReplicaPort)
 	configTotalMem, _ = strconv.ParseUint(cfg.GetString(cfgTotalMem), 10, 64)
+	allowNoCaller = cfg.GetBool(cfgAllowNoCaller)
+
+	if threshold := cfg.GetString(cfgDirShardThreshold); threshold != "" {
+		if dirShardThreshold, err = strconv.ParseUint(threshold, 10, 64); err != nil {
+			return fmt.Errorf("bad dirShardThreshold config")
+		}
+	}
+
+	if store := cfg.GetString(cfgMetadataStore); store != "" {
+		if store != metadataStoreMemory && store != metadataStoreRocksDB {
+			return fmt.Errorf("bad metadataStore config")
+		}
+		metadataStore = store
+	}
+	if items := cfg.GetString(cfgMetadataCachedItems); items != "" {
+		if metadataCachedItems, err = strconv.Atoi(items); err != nil || metadataCachedItems <= 0 {
+			return fmt.Errorf("bad metadataCachedItems config")
+		}
+	}
 
 	if configTotalMem == 0 {
 		return fmt.Errorf("bad totalMem config,Recommended to be configured as 80 percent of physical machine memory")
@@ -225,16 +261,52 @@ func (m *MetaNode) parseConfig(cfg *config.Config) (err error) {
 	log.LogInfof("[parseConfig] load raftDir[%v].", m.raftDir)
 	log.LogInfof("[parseConfig] load raftHeartbeatPort[%v].", m.raftHeartbeatPort)
 	log.LogInfof("[parseConfig] load raftReplicatePort[%v].", m.raftReplicatePort)
+	log.LogInfof("[parseConfig] load dirShardThreshold[%v].", dirShardThreshold)
+	log.LogInfof("[parseConfig] load metadataStore[%v] metadataCachedItems[%v].", metadataStore, metadataCachedItems)
+	log.LogInfof("[parseConfig] load allowNoCaller[%v].", allowNoCaller)
 
 	addrs := cfg.GetArray(cfgMasterAddrs)
 	masterHelper = util.NewMasterHelper()
 	for _, addr := range addrs {
 		masterHelper.AddNode(addr.(string))
 	}
+	if err = m.parseAuthConfig(cfg); err != nil {
+		return
+	}
 	err = m.validConfig()
 	return
 }
 
+func (m *MetaNode) parseAuthConfig(cfg *config.Config) (err error) {
+	if m.authenticate = cfg.GetBool(cfgAuthenticate); m.authenticate {
+		if m.serviceKey, err = cryptoutil.Base64Decode(cfg.GetString(cfgServiceKey)); err != nil || len(m.serviceKey) == 0 {
+			return fmt.Errorf("bad serviceKey config")
+		}
+		// requests proxied to the other metanodes are authenticated with tickets issued by this node
+		if m.peerAuth, err = auth.NewPeerAuthenticator(peerClientID, proto.MetaServiceID, m.serviceKey); err != nil {
+			return
+		}
+	}
+	var authNodes []string
+	for _, addr := range cfg.GetArray(cfgAuthNodes) {
+		authNodes = append(authNodes, addr.(string))
+	}
+	if len(authNodes) == 0 {
+		return
+	}
+	authenticator, err := auth.NewAuthenticator(authNodes, cfg.GetString(cfgClientID),
+		cfg.GetString(cfgClientKey), "")
+	if err != nil {
+		return fmt.Errorf("bad authNodes config: %v", err)
+	}
+	masterHelper.SetTokenFunc(func() (string, error) {
+		return authenticator.Token(proto.MasterServiceID)
+	})
+	m.authenticator = authenticator
+	log.LogInfof("[parseConfig] load authNodes[%v] clientID[%v].", authNodes, authenticator.ClientID())
+	return
+}
+
 func (m *MetaNode) validConfig() (err error) {
 	if len(strings.TrimSpace(m.listen)) == 0 {
 		err = errors.New("illegal listen")
@@ -265,6 +337,17 @@ func (m *MetaNode) startMetaManager() (err error) {
 		RootDir:   m.metadataDir,
 		RaftStore: m.raftStore,
 	}
+	if m.peerAuth != nil {
+		conf.Handshake = func(c *net.TCPConn) error {
+			return m.peerAuth.Handshake(proto.MetaServiceID, c)
+		}
+	}
+	// the extents are deleted, converted and migrated on the datanodes with the tickets from authnode
+	if m.authenticator != nil {
+		conf.DataHandshake = func(c *net.TCPConn) error {
+			return m.authenticator.Handshake(proto.DataServiceID, c)
+		}
+	}
 	m.metadataManager = NewMetadataManager(conf)
 	if err = m.metadataManager.Start(); err == nil {
 		log.LogInfof("[startMetaManager] manager start finish.")
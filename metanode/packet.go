@@ -45,6 +45,26 @@ func NewPacketToDeleteExtent(dp *DataPartition, ext *proto.ExtentKey) *Packet {
 	return p
 }
 
+// NewPacketToEcConvertExtent returns a new packet to convert an extent into the erasure-coded data partition.
+func NewPacketToEcConvertExtent(dp *DataPartition, data []byte) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = proto.OpEcConvertExtent
+	p.PartitionID = dp.PartitionID
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+	p.Data = data
+	p.Size = uint32(len(data))
+	return p
+}
+
+// NewPacketToTierMigrateExtent returns a new packet to migrate an extent to the cold data partition.
+func NewPacketToTierMigrateExtent(dp *DataPartition, data []byte) *Packet {
+	p := NewPacketToEcConvertExtent(dp, data)
+	p.Opcode = proto.OpTierMigrateExtent
+	return p
+}
+
 // NewPacketToDeleteExtent returns a new packet to delete the extent.
 func NewPacketToFreeInodeOnRaftFollower(partitionID uint64, freeInodes []byte) *Packet {
 	p := new(Packet)
@@ -59,3 +79,13 @@ func NewPacketToFreeInodeOnRaftFollower(partitionID uint64, freeInodes []byte) *
 
 	return p
 }
+
+// NewPacketToTx returns a new packet of the transaction operations between meta partitions.
+func NewPacketToTx(partitionID uint64, opcode uint8) *Packet {
+	p := new(Packet)
+	p.Magic = proto.ProtoMagic
+	p.Opcode = opcode
+	p.PartitionID = partitionID
+	p.ReqID = proto.GenerateRequestID()
+	return p
+}
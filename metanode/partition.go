@@ -19,6 +19,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"fmt"
@@ -112,7 +113,7 @@ type OpInode interface {
 	CreateInodeLink(req *LinkInodeReq, p *Packet) (err error)
 	EvictInode(req *EvictInodeReq, p *Packet) (err error)
 	SetAttr(reqData []byte, p *Packet) (err error)
-	GetInodeTree() *BTree
+	GetInodeTree() MetaTree
 }
 
 // OpDentry defines the interface for the dentry operations.
@@ -122,21 +123,98 @@ type OpDentry interface {
 	UpdateDentry(req *UpdateDentryReq, p *Packet) (err error)
 	ReadDir(req *ReadDirReq, p *Packet) (err error)
 	Lookup(req *LookupReq, p *Packet) (err error)
-	GetDentryTree() *BTree
+	GetDentryTree() MetaTree
 }
 
 // OpExtent defines the interface for the extent operations.
 type OpExtent interface {
 	ExtentAppend(req *proto.AppendExtentKeyRequest, p *Packet) (err error)
+	ExtentsOverwrite(req *proto.OverwriteExtentsRequest, p *Packet) (err error)
 	ExtentsList(req *proto.GetExtentsRequest, p *Packet) (err error)
 	ExtentsTruncate(req *ExtentsTruncateReq, p *Packet) (err error)
 }
 
+// OpXAttr defines the interface for the extended attribute operations.
+type OpXAttr interface {
+	SetXAttr(req *SetXAttrReq, p *Packet) (err error)
+	GetXAttr(req *GetXAttrReq, p *Packet) (err error)
+	ListXAttr(req *ListXAttrReq, p *Packet) (err error)
+	RemoveXAttr(req *RemoveXAttrReq, p *Packet) (err error)
+}
+
+// OpTransaction defines the interface for the transaction operations.
+type OpTransaction interface {
+	TxRename(req *TxRenameReq, p *Packet) (err error)
+	TxPrepare(req *TxPrepareReq, p *Packet) (err error)
+	TxCommit(req *TxCommitReq, p *Packet) (err error)
+	TxRollback(req *TxRollbackReq, p *Packet) (err error)
+	TxGetState(req *TxGetStateReq, p *Packet) (err error)
+}
+
+// OpQuota defines the interface for the quota operations.
+type OpQuota interface {
+	SetInodeQuota(req *SetInodeQuotaReq, p *Packet) (err error)
+	ApplyQuota(req *proto.ApplyQuotaRequest, p *Packet) (err error)
+	GetQuotaUsages() []*proto.QuotaUsage
+}
+
+// OpSnapshot defines the interface for the volume snapshot operations.
+type OpSnapshot interface {
+	CreateSnapshot(req *proto.MetaSnapshotRequest, p *Packet) (err error)
+	DeleteSnapshot(req *proto.MetaSnapshotRequest, p *Packet) (err error)
+}
+
+// OpTrash defines the interface for the trash operations.
+type OpTrash interface {
+	ListTrash() (entries []*proto.TrashEntry, status uint8)
+	RestoreTrash(req *proto.RestoreTrashRequest, p *Packet) (err error)
+}
+
+// OpLock defines the interface for the file lock operations.
+type OpLock interface {
+	SetLock(req *SetLockReq, p *Packet) (err error)
+	GetLock(req *GetLockReq, p *Packet) (err error)
+	RenewLock(req *RenewLockReq, p *Packet) (err error)
+}
+
+// OpDirShard defines the interface for the directory sharding operations.
+type OpDirShard interface {
+	SplitDir(req *proto.SplitDirRequest, p *Packet) (err error)
+	MarkDirRemoving(req *proto.MarkDirRemovingRequest, p *Packet) (err error)
+	GetLargeDirs() []uint64
+}
+
+// OpExtentCompact defines the interface for the tiny extent compaction operations.
+type OpExtentCompact interface {
+	GetExtentRefs(req *proto.GetExtentRefsRequest, p *Packet) (err error)
+	RelocateExtents(req *proto.RelocateExtentsRequest, p *Packet) (err error)
+}
+
+// OpTier defines the interface for the storage tiering operations.
+type OpTier interface {
+	TierMigrate(req *proto.TierMigrateRequest, p *Packet) (err error)
+}
+
+// OpChangeLog defines the interface for the change log operations.
+type OpChangeLog interface {
+	ReadChanges(req *proto.ReadMetaChangesRequest, p *Packet) (err error)
+}
+
 // OpMeta defines the interface for the metadata operations.
 type OpMeta interface {
 	OpInode
 	OpDentry
 	OpExtent
+	OpXAttr
+	OpTransaction
+	OpQuota
+	OpSnapshot
+	OpTrash
+	OpLock
+	OpDirShard
+	OpExtentCompact
+	OpTier
+	OpChangeLog
 	OpPartition
 }
 
@@ -144,6 +222,8 @@ type OpMeta interface {
 type OpPartition interface {
 	IsLeader() (leaderAddr string, isLeader bool)
 	GetCursor() uint64
+	GetApplyID() uint64
+	GetItemCount() (inodeCount, dentryCount uint64)
 	GetBaseConfig() MetaPartitionConfig
 	LoadSnapshotSign(p *Packet) (err error)
 	PersistMetadata() (err error)
@@ -173,8 +253,22 @@ type metaPartition struct {
 	config        *MetaPartitionConfig
 	size          uint64 // For partition all file size
 	applyID       uint64 // Inode/Dentry max applyID, this index will be update after restoring from the dumped data.
-	dentryTree    *BTree
-	inodeTree     *BTree // btree for inodes
+	dentryTree    MetaTree
+	inodeTree     MetaTree                 // btree for inodes
+	txTable       *TxTable                 // transactions coordinated or prepared by the partition
+	fileLocks     *FileLockTable           // advisory file locks on the inodes
+	changeLog     *ChangeLog               // changes applied, tailed by the readers
+	metaStore     *rocksMetaStore          // holds the trees if the metadata is stored in rocksdb
+	largeDirs     sync.Map                 // the directories to be split, reported to the master
+	quotaUsages   *quotaUsageTable         // usage of the quotas, updated by the FSM
+	quotaTasks    *QuotaTaskTable          // directory trees to be accounted to the quotas
+	quotaTaskC    chan struct{}            // notifies quotaWorker of the new tasks
+	tierLock      sync.Mutex
+	tierInodes    map[uint64]uint32        // the tier policies of the files sent by the other partitions
+	tierDirs      map[uint64]uint32        // the tier policies of the directories sharded in the partition
+	tierC         chan struct{}            // notifies tierWorker of the policies sent
+	snapshots     map[uint64]*metaSnapshot // volume snapshots by ID
+	snapshotsLock sync.RWMutex
 	raftPartition raftstore.Partition
 	stopC         chan bool
 	storeChan     chan *storeMsg
@@ -241,6 +335,13 @@ func (mp *metaPartition) onStart() (err error) {
 			mp.config.PartitionId, err.Error())
 		return
 	}
+	if err = mp.changeLog.Load(mp.applyID); err != nil {
+		err = errors.NewErrorf("[onStart] load change log id=%d: %s",
+			mp.config.PartitionId, err.Error())
+		return
+	}
+	// the usage of the quotas is updated by the raft log entries applied after the snapshot
+	mp.quotaUsages = newQuotaUsageTable(mp.countQuotaUsages())
 	mp.startSchedule(mp.applyID)
 	if err = mp.startFreeList(); err != nil {
 		err = errors.NewErrorf("[onStart] start free list id=%d: %s",
@@ -252,6 +353,11 @@ func (mp *metaPartition) onStart() (err error) {
 			mp.config.PartitionId, err.Error())
 		return
 	}
+	go mp.txWorker()
+	go mp.quotaWorker()
+	go mp.trashWorker()
+	go mp.ecWorker()
+	go mp.tierWorker()
 
 	return
 }
@@ -259,6 +365,10 @@ func (mp *metaPartition) onStart() (err error) {
 func (mp *metaPartition) onStop() {
 	mp.stopRaft()
 	mp.stop()
+	mp.changeLog.Close()
+	if mp.metaStore != nil {
+		mp.metaStore.Close()
+	}
 	if mp.delInodeFp != nil {
 		// TODO Unhandled errors
 		mp.delInodeFp.Sync()
@@ -333,16 +443,24 @@ func (mp *metaPartition) getRaftPort() (heartbeat, replica int, err error) {
 // NewMetaPartition creates a new meta partition with the specified configuration.
 func NewMetaPartition(conf *MetaPartitionConfig, manager *metadataManager) MetaPartition {
 	mp := &metaPartition{
-		config:     conf,
-		dentryTree: NewBtree(),
-		inodeTree:  NewBtree(),
-		stopC:      make(chan bool),
-		storeChan:  make(chan *storeMsg, 5),
-		freeList:   newFreeList(),
-		extDelCh:   make(chan BtreeItem, 10000),
-		extReset:   make(chan struct{}),
-		vol:        NewVol(),
-		manager:    manager,
+		config:      conf,
+		dentryTree:  NewBtree(),
+		inodeTree:   NewBtree(),
+		txTable:     NewTxTable(),
+		fileLocks:   NewFileLockTable(),
+		quotaUsages: newQuotaUsageTable(nil),
+		quotaTasks:  NewQuotaTaskTable(),
+		quotaTaskC:  make(chan struct{}, 1),
+		tierC:       make(chan struct{}, 1),
+		changeLog:   NewChangeLog(path.Join(conf.RootDir, changeLogDir)),
+		snapshots:   make(map[uint64]*metaSnapshot),
+		stopC:       make(chan bool),
+		storeChan:   make(chan *storeMsg, 5),
+		freeList:    newFreeList(),
+		extDelCh:    make(chan BtreeItem, 10000),
+		extReset:    make(chan struct{}),
+		vol:         NewVol(),
+		manager:     manager,
 	}
 	return mp
 }
@@ -382,6 +500,16 @@ func (mp *metaPartition) GetCursor() uint64 {
 	return mp.config.Cursor
 }
 
+// GetApplyID returns the index of the raft log applied.
+func (mp *metaPartition) GetApplyID() uint64 {
+	return atomic.LoadUint64(&mp.applyID)
+}
+
+// GetItemCount returns the number of the inodes and dentries.
+func (mp *metaPartition) GetItemCount() (inodeCount, dentryCount uint64) {
+	return uint64(mp.inodeTree.Len()), uint64(mp.dentryTree.Len())
+}
+
 // PersistMetadata is the wrapper of persistMetadata.
 func (mp *metaPartition) PersistMetadata() (err error) {
 	mp.config.sortPeers()
@@ -394,40 +522,102 @@ func (mp *metaPartition) load() (err error) {
 		return
 	}
 	loadSnapshotDir := path.Join(mp.config.RootDir, snapshotDir)
-	if err = mp.loadInode(loadSnapshotDir); err != nil {
+	if metadataStore == metadataStoreRocksDB {
+		if loadSnapshotDir, err = mp.loadRocksDB(); err != nil || loadSnapshotDir == "" {
+			return
+		}
+	} else {
+		if _, err = os.Stat(path.Join(mp.config.RootDir, rocksDBDir)); err == nil {
+			err = errors.NewErrorf("[load]: partition is stored in rocksdb")
+			return
+		}
+		if err = mp.loadInode(loadSnapshotDir); err != nil {
+			return
+		}
+		if err = mp.loadDentry(loadSnapshotDir); err != nil {
+			return
+		}
+		if err = mp.loadDeltas(loadSnapshotDir); err != nil {
+			return
+		}
+	}
+	if err = mp.loadTxTable(loadSnapshotDir); err != nil {
 		return
 	}
-	if err = mp.loadDentry(loadSnapshotDir); err != nil {
+	if err = mp.loadFileLocks(loadSnapshotDir); err != nil {
 		return
 	}
-	err = mp.loadApplyID(loadSnapshotDir)
+	if err = mp.loadQuotaTasks(loadSnapshotDir); err != nil {
+		return
+	}
+	if err = mp.loadMetaSnapshots(loadSnapshotDir); err != nil {
+		return
+	}
+	if err = mp.loadApplyID(loadSnapshotDir); err != nil {
+		return
+	}
+	if mp.metaStore != nil {
+		mp.loadFreeList()
+	}
+	mp.trackChanges()
 	return
 }
 
 func (mp *metaPartition) store(sm *storeMsg) (err error) {
+	// the changes applied before the snapshot are never replayed, so they are synced first
+	if err = mp.changeLog.Sync(); err != nil {
+		return
+	}
 	tmpDir := path.Join(mp.config.RootDir, snapshotDirTmp)
 	if _, err = os.Stat(tmpDir); err == nil {
-		// TODO Unhandled errors
-		os.RemoveAll(tmpDir)
+		if mp.metaStore != nil {
+			// the DB is flushed, but the snapshot is not renamed by the last store
+			if err = mp.renameSnapshotDir(); err != nil {
+				return
+			}
+		} else {
+			// TODO Unhandled errors
+			os.RemoveAll(tmpDir)
+		}
 	}
 	err = nil
 	if err = os.MkdirAll(tmpDir, 0775); err != nil {
 		return
 	}
 
+	var (
+		inoCRC, denCRC uint32
+		delta, flushed bool
+	)
 	defer func() {
-		if err != nil {
+		if err != nil && !flushed {
 			// TODO Unhandled errors
 			os.RemoveAll(tmpDir)
 		}
 	}()
-	var (
-		inoCRC, denCRC uint32
-	)
-	if inoCRC, err = mp.storeInode(tmpDir, sm); err != nil {
+	if mp.metaStore == nil {
+		if inoCRC, denCRC, delta, err = mp.storeDelta(tmpDir, sm); err != nil {
+			return
+		}
+	}
+	if mp.metaStore == nil && !delta {
+		if inoCRC, err = mp.storeInode(tmpDir, sm); err != nil {
+			return
+		}
+		if denCRC, err = mp.storeDentry(tmpDir, sm); err != nil {
+			return
+		}
+	}
+	if err = mp.storeTxTable(tmpDir, sm); err != nil {
+		return
+	}
+	if err = mp.storeFileLocks(tmpDir, sm); err != nil {
 		return
 	}
-	if denCRC, err = mp.storeDentry(tmpDir, sm); err != nil {
+	if err = mp.storeQuotaTasks(tmpDir, sm); err != nil {
+		return
+	}
+	if err = mp.storeMetaSnapshots(tmpDir, sm); err != nil {
 		return
 	}
 	if err = mp.storeApplyID(tmpDir, sm); err != nil {
@@ -438,6 +628,21 @@ func (mp *metaPartition) store(sm *storeMsg) (err error) {
 		[]byte(fmt.Sprintf("%d %d", inoCRC, denCRC)), 0775); err != nil {
 		return
 	}
+	if mp.metaStore != nil {
+		// The items are flushed once the rest is written, so that the DB always matches
+		// the snapshot, or the temporary one until it is renamed.
+		if err = mp.metaStore.Flush(sm.applyIndex, sm.inodeTree, sm.dentryTree); err != nil {
+			return
+		}
+		flushed = true
+	}
+	err = mp.renameSnapshotDir()
+	return
+}
+
+// Replaces the snapshot with the temporary one.
+func (mp *metaPartition) renameSnapshotDir() (err error) {
+	tmpDir := path.Join(mp.config.RootDir, snapshotDirTmp)
 	snapshotDir := path.Join(mp.config.RootDir, snapshotDir)
 	// check snapshot backup
 	backupDir := path.Join(mp.config.RootDir, snapshotBackup)
@@ -622,6 +827,13 @@ func (mp *metaPartition) MarshalJSON() ([]byte, error) {
 func (mp *metaPartition) Reset() (err error) {
 	mp.inodeTree.Reset()
 	mp.dentryTree.Reset()
+	mp.txTable = NewTxTable()
+	mp.fileLocks = NewFileLockTable()
+	mp.quotaTasks = NewQuotaTaskTable()
+	mp.quotaUsages = newQuotaUsageTable(nil)
+	mp.snapshotsLock.Lock()
+	mp.snapshots = make(map[uint64]*metaSnapshot)
+	mp.snapshotsLock.Unlock()
 	mp.config.Cursor = 0
 	mp.applyID = 0
 	// delete ino/dentry applyID file
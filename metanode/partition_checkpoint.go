@@ -0,0 +1,289 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A snapshot of the memory store consists of the base inode and dentry files, followed by
+// the deltas of the items changed since then. A delta is a file of the length prefixed
+// meta items sent by the raft snapshot, in which the deleted items are recorded by the key.
+// The deltas are merged into a new base once there are too many of them, or they are large
+// compared to the base.
+const (
+	maxCheckpointDeltas = 16
+	// the deltas are merged once their size exceeds the base size divided by the ratio
+	checkpointMergeRatio = 2
+)
+
+// The keys of the items changed since the last store. A nil one stores the trees in full.
+type treeChanges struct {
+	inodes   map[string]struct{}
+	dentries map[string]struct{}
+}
+
+func mergeChanges(a, b *treeChanges) *treeChanges {
+	if a == nil || b == nil {
+		return nil
+	}
+	for k := range b.inodes {
+		a.inodes[k] = struct{}{}
+	}
+	for k := range b.dentries {
+		a.dentries[k] = struct{}{}
+	}
+	return a
+}
+
+// Start tracking the changes of the trees stored in memory, which are stored by deltas.
+func (mp *metaPartition) trackChanges() {
+	if mp.metaStore != nil {
+		return
+	}
+	mp.inodeTree.(*BTree).TrackChanges()
+	mp.dentryTree.(*BTree).TrackChanges()
+}
+
+// Take the changes since the last call. It is called before the trees are cloned,
+// so that any change missed by the clones is left to the next store.
+func (mp *metaPartition) takeChanges() *treeChanges {
+	if mp.metaStore != nil {
+		return nil
+	}
+	inodes := mp.inodeTree.(*BTree).TakeChanges()
+	dentries := mp.dentryTree.(*BTree).TakeChanges()
+	if inodes == nil || dentries == nil {
+		return nil
+	}
+	return &treeChanges{inodes: inodes, dentries: dentries}
+}
+
+// List the delta files of the snapshot in the order of the apply ID.
+func listDeltaFiles(rootDir string) (names []string, err error) {
+	fp, err := os.Open(rootDir)
+	if err != nil {
+		return
+	}
+	all, err := fp.Readdirnames(-1)
+	fp.Close()
+	if err != nil {
+		return
+	}
+	ids := make(map[string]uint64)
+	for _, name := range all {
+		if !strings.HasPrefix(name, deltaFilePrefix) {
+			continue
+		}
+		id, e := strconv.ParseUint(name[len(deltaFilePrefix):], 10, 64)
+		if e != nil {
+			continue
+		}
+		ids[name] = id
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return ids[names[i]] < ids[names[j]] })
+	return
+}
+
+// Store the changes as a delta of the current snapshot, whose files are linked into the
+// temporary one, along with the signature of the base. It returns false if a full store
+// is needed instead.
+func (mp *metaPartition) storeDelta(rootDir string, sm *storeMsg) (inoCRC, denCRC uint32,
+	ok bool, err error) {
+	if sm.changes == nil {
+		return
+	}
+	if _, inoCRC, denCRC, err = mp.loadSnapshotSign(snapshotDir); err != nil {
+		err = nil
+		return
+	}
+	baseDir := path.Join(mp.config.RootDir, snapshotDir)
+	var baseSize, deltaSize int64
+	for _, name := range []string{inodeFile, dentryFile} {
+		info, e := os.Stat(path.Join(baseDir, name))
+		if e != nil {
+			return
+		}
+		baseSize += info.Size()
+	}
+	deltas, err := listDeltaFiles(baseDir)
+	if err != nil || len(deltas) >= maxCheckpointDeltas {
+		return
+	}
+	for _, name := range deltas {
+		info, e := os.Stat(path.Join(baseDir, name))
+		if e != nil {
+			return
+		}
+		deltaSize += info.Size()
+	}
+	if deltaSize*checkpointMergeRatio > baseSize {
+		return
+	}
+	// the files of a snapshot are never modified, so they are shared by the links
+	for _, name := range append([]string{inodeFile, dentryFile}, deltas...) {
+		if err = os.Link(path.Join(baseDir, name), path.Join(rootDir, name)); err != nil {
+			return
+		}
+	}
+	if err = mp.storeDeltaFile(rootDir, sm); err != nil {
+		return
+	}
+	log.LogDebugf("[storeDelta] partition(%v) stored %v inodes and %v dentries of apply ID %v, deltas(%v)",
+		mp.config.PartitionId, len(sm.changes.inodes), len(sm.changes.dentries), sm.applyIndex, len(deltas)+1)
+	ok = true
+	return
+}
+
+func (mp *metaPartition) storeDeltaFile(rootDir string, sm *storeMsg) (err error) {
+	filename := path.Join(rootDir, fmt.Sprintf("%s%d", deltaFilePrefix, sm.applyIndex))
+	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0755)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := fp.Close(); err == nil {
+			err = e
+		}
+	}()
+	writer := bufio.NewWriterSize(fp, 4*1024*1024)
+	lenBuf := make([]byte, 4)
+	write := func(item *MetaItem) (err error) {
+		data, err := item.MarshalBinary()
+		if err != nil {
+			return
+		}
+		binary.BigEndian.PutUint32(lenBuf, uint32(len(data)))
+		if _, err = writer.Write(lenBuf); err != nil {
+			return
+		}
+		_, err = writer.Write(data)
+		return
+	}
+	for key := range sm.changes.inodes {
+		ino, ok := treeKeyItem([]byte(key)).(*Inode)
+		if !ok {
+			return errors.NewErrorf("[storeDeltaFile] invalid inode key %v", []byte(key))
+		}
+		item := NewMetaItem(opCheckpointDeleteInode, ino.MarshalKey(), nil)
+		if i := sm.inodeTree.Get(ino); i != nil {
+			ino = i.(*Inode)
+			item = NewMetaItem(opFSMCreateInode, ino.MarshalKey(), ino.MarshalValue())
+		}
+		if err = write(item); err != nil {
+			return
+		}
+	}
+	for key := range sm.changes.dentries {
+		dentry, ok := treeKeyItem([]byte(key)).(*Dentry)
+		if !ok {
+			return errors.NewErrorf("[storeDeltaFile] invalid dentry key %v", []byte(key))
+		}
+		item := NewMetaItem(opCheckpointDeleteDentry, dentry.MarshalKey(), nil)
+		if i := sm.dentryTree.Get(dentry); i != nil {
+			dentry = i.(*Dentry)
+			item = NewMetaItem(opFSMCreateDentry, dentry.MarshalKey(), dentry.MarshalValue())
+		}
+		if err = write(item); err != nil {
+			return
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	return fp.Sync()
+}
+
+// Replay the deltas of the snapshot on the loaded base.
+func (mp *metaPartition) loadDeltas(rootDir string) (err error) {
+	deltas, err := listDeltaFiles(rootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, name := range deltas {
+		err = readItems(path.Join(rootDir, name), func(data []byte) error {
+			item := NewMetaItem(0, nil, nil)
+			if err := item.UnmarshalBinary(data); err != nil {
+				return err
+			}
+			return mp.replayCheckpointItem(item)
+		})
+		if err != nil {
+			err = errors.NewErrorf("[loadDeltas] %s: %s", name, err.Error())
+			return
+		}
+	}
+	if len(deltas) > 0 {
+		log.LogInfof("[loadDeltas] partition(%v) replayed %v deltas", mp.config.PartitionId, len(deltas))
+	}
+	return
+}
+
+func (mp *metaPartition) replayCheckpointItem(item *MetaItem) (err error) {
+	switch item.Op {
+	case opFSMCreateInode:
+		ino := NewInode(0, 0)
+		if err = ino.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		if err = ino.UnmarshalValue(item.V); err != nil {
+			return
+		}
+		mp.inodeTree.ReplaceOrInsert(ino, true)
+		mp.checkAndInsertFreeList(ino)
+		if mp.config.Cursor < ino.Inode {
+			mp.config.Cursor = ino.Inode
+		}
+	case opCheckpointDeleteInode:
+		ino := NewInode(0, 0)
+		if err = ino.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		mp.inodeTree.Delete(ino)
+		mp.freeList.Remove(ino.Inode)
+	case opFSMCreateDentry:
+		dentry := &Dentry{}
+		if err = dentry.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		if err = dentry.UnmarshalValue(item.V); err != nil {
+			return
+		}
+		mp.dentryTree.ReplaceOrInsert(dentry, true)
+	case opCheckpointDeleteDentry:
+		dentry := &Dentry{}
+		if err = dentry.UnmarshalKey(item.K); err != nil {
+			return
+		}
+		mp.dentryTree.Delete(dentry)
+	default:
+		err = errors.NewErrorf("unknown op %v", item.Op)
+	}
+	return
+}
@@ -0,0 +1,241 @@
+package metanode
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Stores the partition as the store tick applied at the index does.
+func storeTestPartition(t *testing.T, mp *metaPartition, index uint64) {
+	t.Helper()
+	mp.applyID = index
+	sm := &storeMsg{
+		command:    opFSMStoreTick,
+		applyIndex: index,
+		changes:    mp.takeChanges(),
+		inodeTree:  mp.getInodeTree(),
+		dentryTree: mp.getDentryTree(),
+	}
+	if err := mp.store(sm); err != nil {
+		t.Fatalf("store at %v: %v", index, err)
+	}
+}
+
+// Loads the stored partition into a new one, as a restart does.
+func loadTestPartition(t *testing.T, mp *metaPartition) *metaPartition {
+	t.Helper()
+	conf := *mp.config
+	loaded := NewMetaPartition(&conf, nil).(*metaPartition)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// Returns the inodes with their uids, and the dentries of the partition.
+func testPartitionItems(mp *metaPartition) (inodes []string, dentries []string) {
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		inodes = append(inodes, fmt.Sprintf("%v:%v", ino.Inode, ino.Uid))
+		return true
+	})
+	mp.dentryTree.Ascend(func(i BtreeItem) bool {
+		d := i.(*Dentry)
+		dentries = append(dentries, fmt.Sprintf("%v/%v:%v", d.ParentId, d.Name, d.Inode))
+		return true
+	})
+	sort.Strings(inodes)
+	sort.Strings(dentries)
+	return
+}
+
+func checkTestPartitionLoaded(t *testing.T, mp, loaded *metaPartition) {
+	t.Helper()
+	inodes, dentries := testPartitionItems(mp)
+	gotInodes, gotDentries := testPartitionItems(loaded)
+	if !reflect.DeepEqual(gotInodes, inodes) {
+		t.Fatalf("expect inodes %v, got %v", inodes, gotInodes)
+	}
+	if !reflect.DeepEqual(gotDentries, dentries) {
+		t.Fatalf("expect dentries %v, got %v", dentries, gotDentries)
+	}
+	if loaded.applyID != mp.applyID || loaded.config.Cursor != mp.config.Cursor {
+		t.Fatalf("expect apply ID %v cursor %v, got %v %v", mp.applyID, mp.config.Cursor,
+			loaded.applyID, loaded.config.Cursor)
+	}
+}
+
+func testDeltaFiles(t *testing.T, mp *metaPartition) []string {
+	t.Helper()
+	deltas, err := listDeltaFiles(path.Join(mp.config.RootDir, snapshotDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deltas
+}
+
+func newTestCheckpointPartition(t *testing.T) (*metaPartition, func()) {
+	mp, cleanup := newTestPartition(t)
+	mp.config.Peers = []proto.Peer{{ID: 1, Addr: "127.0.0.1:17210"}}
+	if err := mp.persistMetadata(); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	mp.trackChanges()
+	return mp, cleanup
+}
+
+func createTestInodes(t *testing.T, mp *metaPartition, prefix string, n int) (inodes []*Inode) {
+	for i := 0; i < n; i++ {
+		inodes = append(inodes, createTestInode(t, mp, proto.RootIno, fmt.Sprintf("%v%v", prefix, i), proto.Mode(0644)))
+	}
+	return
+}
+
+func TestCheckpointDelta(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	inodes := createTestInodes(t, mp, "base", 100)
+	storeTestPartition(t, mp, 10)
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 0 {
+		t.Fatalf("expect the first store to be a base, got deltas %v", deltas)
+	}
+	checkTestPartitionLoaded(t, mp, loadTestPartition(t, mp))
+
+	// a created, a changed and a deleted inode and dentry
+	createTestInode(t, mp, proto.RootIno, "new", proto.Mode(0644))
+	mp.fsmSetAttr(&SetattrRequest{Inode: inodes[1].Inode, Valid: proto.AttrUid, Uid: 7})
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: proto.RootIno, Name: "base0"}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	mp.inodeTree.Delete(inodes[0])
+	storeTestPartition(t, mp, 20)
+	if deltas := testDeltaFiles(t, mp); !reflect.DeepEqual(deltas, []string{deltaFilePrefix + "20"}) {
+		t.Fatalf("expect a delta, got %v", deltas)
+	}
+	// nothing changed is stored by an empty delta
+	storeTestPartition(t, mp, 30)
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 2 {
+		t.Fatalf("expect two deltas, got %v", deltas)
+	}
+	loaded := loadTestPartition(t, mp)
+	checkTestPartitionLoaded(t, mp, loaded)
+	if loaded.inodeTree.Get(inodes[0]) != nil {
+		t.Fatalf("expect the deleted inode not to be loaded")
+	}
+
+	// the loaded partition goes on storing deltas on the same base
+	loaded.trackChanges()
+	createTestInode(t, loaded, proto.RootIno, "after restart", proto.Mode(0644))
+	storeTestPartition(t, loaded, 40)
+	if deltas := testDeltaFiles(t, loaded); len(deltas) != 3 {
+		t.Fatalf("expect three deltas, got %v", deltas)
+	}
+	checkTestPartitionLoaded(t, loaded, loadTestPartition(t, loaded))
+}
+
+func TestCheckpointMergeDeltas(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	inodes := createTestInodes(t, mp, "base", 200)
+	storeTestPartition(t, mp, 1)
+	for i := 0; i < maxCheckpointDeltas; i++ {
+		mp.fsmSetAttr(&SetattrRequest{Inode: inodes[i].Inode, Valid: proto.AttrUid, Uid: uint32(i + 1)})
+		storeTestPartition(t, mp, uint64(i+2))
+	}
+	if deltas := testDeltaFiles(t, mp); len(deltas) != maxCheckpointDeltas {
+		t.Fatalf("expect %v deltas, got %v", maxCheckpointDeltas, deltas)
+	}
+	checkTestPartitionLoaded(t, mp, loadTestPartition(t, mp))
+
+	// the deltas are merged into a new base at the limit
+	mp.fsmSetAttr(&SetattrRequest{Inode: inodes[100].Inode, Valid: proto.AttrUid, Uid: 100})
+	storeTestPartition(t, mp, 100)
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 0 {
+		t.Fatalf("expect the deltas to be merged at the limit, got %v", deltas)
+	}
+	checkTestPartitionLoaded(t, mp, loadTestPartition(t, mp))
+
+	// and once they are large compared to the base
+	createTestInodes(t, mp, "large", 150)
+	storeTestPartition(t, mp, 101)
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 1 {
+		t.Fatalf("expect a delta, got %v", deltas)
+	}
+	mp.fsmSetAttr(&SetattrRequest{Inode: inodes[101].Inode, Valid: proto.AttrUid, Uid: 101})
+	storeTestPartition(t, mp, 102)
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 0 {
+		t.Fatalf("expect the deltas to be merged over the size limit, got %v", deltas)
+	}
+	checkTestPartitionLoaded(t, mp, loadTestPartition(t, mp))
+}
+
+// A store without the changes, e.g. after a raft snapshot is applied, stores the trees in full.
+func TestCheckpointUntrackedStoreIsFull(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	createTestInodes(t, mp, "base", 10)
+	storeTestPartition(t, mp, 1)
+	createTestInode(t, mp, proto.RootIno, "new", proto.Mode(0644))
+	sm := &storeMsg{command: opFSMStoreTick, applyIndex: 2, inodeTree: mp.getInodeTree(), dentryTree: mp.getDentryTree()}
+	mp.applyID = 2
+	if err := mp.store(sm); err != nil {
+		t.Fatal(err)
+	}
+	if deltas := testDeltaFiles(t, mp); len(deltas) != 0 {
+		t.Fatalf("expect a full store, got deltas %v", deltas)
+	}
+	checkTestPartitionLoaded(t, mp, loadTestPartition(t, mp))
+}
+
+// A crash after the delta is written but before the snapshot is replaced by the temporary one leaves the last
+// snapshot as it is, and the changes of the delta are replayed from the raft log after the restart.
+func TestCheckpointCrashAfterDelta(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	createTestInodes(t, mp, "base", 50)
+	storeTestPartition(t, mp, 10)
+	stored := loadTestPartition(t, mp)
+
+	createTestInode(t, mp, proto.RootIno, "lost", proto.Mode(0644))
+	tmpDir := path.Join(mp.config.RootDir, snapshotDirTmp)
+	if err := os.MkdirAll(tmpDir, 0775); err != nil {
+		t.Fatal(err)
+	}
+	sm := &storeMsg{
+		command:    opFSMStoreTick,
+		applyIndex: 20,
+		changes:    mp.takeChanges(),
+		inodeTree:  mp.getInodeTree(),
+		dentryTree: mp.getDentryTree(),
+	}
+	_, _, ok, err := mp.storeDelta(tmpDir, sm)
+	if err != nil || !ok {
+		t.Fatalf("expect the delta to be written, got %v %v", ok, err)
+	}
+
+	// the restart loads the last snapshot without the delta
+	loaded := loadTestPartition(t, mp)
+	checkTestPartitionLoaded(t, stored, loaded)
+	if _, err = os.Stat(path.Join(mp.config.RootDir, snapshotDir, deltaFilePrefix+"20")); !os.IsNotExist(err) {
+		t.Fatalf("expect the delta not to be in the snapshot, got %v", err)
+	}
+
+	// the change replayed is stored by the next delta, which drops the temporary snapshot
+	loaded.trackChanges()
+	createTestInode(t, loaded, proto.RootIno, "lost", proto.Mode(0644))
+	storeTestPartition(t, loaded, 20)
+	if deltas := testDeltaFiles(t, loaded); !reflect.DeepEqual(deltas, []string{deltaFilePrefix + "20"}) {
+		t.Fatalf("expect the delta of the replayed change, got %v", deltas)
+	}
+	if _, err = os.Stat(tmpDir); !os.IsNotExist(err) {
+		t.Fatalf("expect the temporary snapshot to be removed, got %v", err)
+	}
+	checkTestPartitionLoaded(t, loaded, loadTestPartition(t, loaded))
+}
@@ -129,6 +129,9 @@ func (mp *metaPartition) deleteMarkedInodes(inoSlice []uint64) {
 
 			i.Extents.Range(func(item BtreeItem) bool {
 				ext := item.(*proto.ExtentKey)
+				if mp.referencedBySnapshots(i.Inode, ext) {
+					return true
+				}
 				if err := mp.doDeleteMarkedInodes(ext); err != nil {
 					dirtyExt = append(dirtyExt, ext)
 					log.LogWarnf("[deleteMarkedInodes] delete failed extents: ino(%v) ext(%s), err(%s)", i.Inode, ext.String(), err.Error())
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"sync/atomic"
+	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util/exporter"
@@ -34,9 +35,18 @@ import (
 
 // Apply applies the given operational commands.
 func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{}, err error) {
+	var changes []*proto.MetaChange
 	msg := &MetaItem{}
 	defer func() {
+		if err == nil && mp.metaStore != nil {
+			// the items read from a failed store may be wrong, so the result is not acknowledged
+			err = mp.metaStore.Err()
+		}
 		if err == nil {
+			// the changes are appended before the apply ID is updated, so that the readers never miss them
+			if len(changes) > 0 && changeStatus(resp) == proto.OpOk {
+				mp.changeLog.Append(index, time.Now().Unix(), changes...)
+			}
 			mp.uploadApplyID(index)
 		}
 	}()
@@ -54,30 +64,39 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 			mp.config.Cursor = ino.Inode
 		}
 		resp = mp.fsmCreateInode(ino)
+		changes = newMetaChanges(proto.MetaChangeCreateInode, ino.Inode, 0, "")
 	case opFSMUnlinkInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
+		if mp.txTable.IsInodeLocked(ino.Inode) {
+			resp = &InodeResponse{Status: proto.OpAgain}
+			return
+		}
 		resp = mp.fsmUnlinkInode(ino)
+		changes = newMetaChanges(proto.MetaChangeUnlinkInode, ino.Inode, 0, "")
 	case opFSMExtentTruncate:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
 		resp = mp.fsmExtentsTruncate(ino)
+		changes = newMetaChanges(proto.MetaChangeTruncate, ino.Inode, 0, "")
 	case opFSMCreateLinkInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
 		resp = mp.fsmCreateLinkInode(ino)
+		changes = newMetaChanges(proto.MetaChangeLinkInode, ino.Inode, 0, "")
 	case opFSMEvictInode:
 		ino := NewInode(0, 0)
 		if err = ino.Unmarshal(msg.V); err != nil {
 			return
 		}
 		resp = mp.fsmEvictInode(ino)
+		changes = newMetaChanges(proto.MetaChangeEvictInode, ino.Inode, 0, "")
 	case opFSMSetAttr:
 		req := &SetattrRequest{}
 		err = json.Unmarshal(msg.V, req)
@@ -85,24 +104,133 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 			return
 		}
 		err = mp.fsmSetAttr(req)
+		changes = newMetaChanges(proto.MetaChangeSetAttr, req.Inode, 0, "")
+	case opFSMSetXAttr:
+		req := &SetXAttrReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmSetXAttr(req)
+		changes = newMetaChanges(proto.MetaChangeSetAttr, req.Inode, 0, "")
+	case opFSMRemoveXAttr:
+		req := &RemoveXAttrReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmRemoveXAttr(req)
+		changes = newMetaChanges(proto.MetaChangeSetAttr, req.Inode, 0, "")
+	case opFSMSetInodeQuota:
+		req := &SetInodeQuotaReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmSetInodeQuota(req)
+	case opFSMPutQuotaTask:
+		task := &QuotaTask{}
+		if err = json.Unmarshal(msg.V, task); err != nil {
+			return
+		}
+		task.ID = index
+		resp = mp.fsmPutQuotaTask(task)
+	case opFSMDeleteQuotaTask:
+		task := &QuotaTask{}
+		if err = json.Unmarshal(msg.V, task); err != nil {
+			return
+		}
+		resp = mp.fsmDeleteQuotaTask(task)
+	case opFSMCreateSnapshot:
+		req := &proto.MetaSnapshotRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmCreateSnapshot(req)
+	case opFSMDeleteSnapshot:
+		req := &proto.MetaSnapshotRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmDeleteSnapshot(req)
+	case opFSMEcConvertExtent:
+		req := &EcConvertExtentReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmEcConvertExtent(req)
+	case opFSMSetLock:
+		req := &SetLockReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmSetLock(req)
+	case opFSMRenewLock:
+		req := &RenewLockReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmRenewLock(req)
 	case opFSMCreateDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
+		if mp.txTable.IsDentryLocked(den.ParentId, den.Name) {
+			resp = proto.OpAgain
+			return
+		}
 		resp = mp.fsmCreateDentry(den, false)
+		changes = newMetaChanges(proto.MetaChangeCreateDentry, den.Inode, den.ParentId, den.Name)
+	case opFSMCreateShardDentry:
+		den := &Dentry{}
+		if err = den.Unmarshal(msg.V); err != nil {
+			return
+		}
+		if mp.txTable.IsDentryLocked(den.ParentId, den.Name) {
+			resp = proto.OpAgain
+			return
+		}
+		// the parent inode is in another partition
+		resp = mp.fsmCreateDentry(den, true)
+		changes = newMetaChanges(proto.MetaChangeCreateDentry, den.Inode, den.ParentId, den.Name)
+	case opFSMSplitDir:
+		req := &proto.SplitDirRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmSplitDir(req)
+	case opFSMMarkDirRemoving:
+		req := &dirRemovingReq{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmMarkDirRemoving(req)
+	case opFSMRelocateExtents:
+		req := &proto.RelocateExtentsRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmRelocateExtents(req)
 	case opFSMDeleteDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
+		if mp.txTable.IsDentryLocked(den.ParentId, den.Name) {
+			resp = &DentryResponse{Status: proto.OpAgain}
+			return
+		}
 		resp = mp.fsmDeleteDentry(den)
+		changes = newMetaChanges(proto.MetaChangeDeleteDentry, den.Inode, den.ParentId, den.Name)
 	case opFSMUpdateDentry:
 		den := &Dentry{}
 		if err = den.Unmarshal(msg.V); err != nil {
 			return
 		}
+		if mp.txTable.IsDentryLocked(den.ParentId, den.Name) {
+			resp = &DentryResponse{Status: proto.OpAgain}
+			return
+		}
 		resp = mp.fsmUpdateDentry(den)
+		changes = newMetaChanges(proto.MetaChangeUpdateDentry, den.Inode, den.ParentId, den.Name)
 	case opFSMDeletePartition:
 		resp = mp.fsmDeletePartition()
 	case opFSMUpdatePartition:
@@ -117,17 +245,76 @@ func (mp *metaPartition) Apply(command []byte, index uint64) (resp interface{},
 			return
 		}
 		resp = mp.fsmAppendExtents(ino)
+		changes = newMetaChanges(proto.MetaChangeAppend, ino.Inode, 0, "")
+	case opFSMExtentsOverwrite:
+		ino := NewInode(0, 0)
+		if err = ino.Unmarshal(msg.V); err != nil {
+			return
+		}
+		resp = mp.fsmOverwriteExtents(ino)
+		changes = newMetaChanges(proto.MetaChangeOverwrite, ino.Inode, 0, "")
 	case opFSMStoreTick:
+		changes := mp.takeChanges()
 		inodeTree := mp.getInodeTree()
 		dentryTree := mp.getDentryTree()
+		txTable, _ := mp.txTable.Marshal()
+		fileLocks, _ := mp.fileLocks.Marshal()
+		quotaTasks, _ := mp.quotaTasks.Marshal()
 		msg := &storeMsg{
 			command:    opFSMStoreTick,
 			applyIndex: index,
 			inodeTree:  inodeTree,
 			dentryTree: dentryTree,
+			txTable:    txTable,
+			fileLocks:  fileLocks,
+			quotaTasks: quotaTasks,
+			snapshots:  mp.getSnapshots(),
+			changes:    changes,
 		}
 
 		mp.storeChan <- msg
+	case opFSMTxInit:
+		tx := &proto.TxInfo{}
+		if err = json.Unmarshal(msg.V, tx); err != nil {
+			return
+		}
+		resp = mp.fsmTxInit(tx)
+	case opFSMTxSetState:
+		tx := &proto.TxInfo{}
+		if err = json.Unmarshal(msg.V, tx); err != nil {
+			return
+		}
+		if cur, ok := mp.txTable.GetTx(tx.TxID); ok && cur.State == proto.TxStateInit && tx.State == proto.TxStateCommitted {
+			changes = txRenameChanges(cur)
+		}
+		resp = mp.fsmTxSetState(tx)
+	case opFSMTxDelete:
+		tx := &proto.TxInfo{}
+		if err = json.Unmarshal(msg.V, tx); err != nil {
+			return
+		}
+		resp = mp.fsmTxDelete(tx)
+	case opFSMTxPrepare:
+		req := &proto.TxPrepareRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmTxPrepare(req)
+	case opFSMTxCommit:
+		req := &proto.TxCommitRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		if rec, ok := mp.txTable.GetRecord(req.TxID); ok {
+			changes = txMetaChanges(rec.TxID, rec.Ops)
+		}
+		resp = mp.fsmTxCommit(req)
+	case opFSMTxRollback:
+		req := &proto.TxRollbackRequest{}
+		if err = json.Unmarshal(msg.V, req); err != nil {
+			return
+		}
+		resp = mp.fsmTxRollback(req)
 	case opFSMInternalDeleteInode:
 		err = mp.internalDelete(msg.V)
 	case opFSMInternalDelExtentFile:
@@ -192,8 +379,20 @@ func (mp *metaPartition) Snapshot() (raftproto.Snapshot, error) {
 			fileList = append(fileList, in.Name())
 		}
 	}
-	snapIter := NewMetaItemIterator(applyID, ino, dentry, mp.config.RootDir,
-		fileList)
+	txTable, err := mp.txTable.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	fileLocks, err := mp.fileLocks.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	quotaTasks, err := mp.quotaTasks.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	snapIter := NewMetaItemIterator(applyID, ino, dentry, txTable, fileLocks, quotaTasks,
+		mp.getSnapshots(), mp.config.RootDir, fileList)
 	return snapIter, nil
 }
 
@@ -204,22 +403,50 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 		index      int
 		appIndexID uint64
 		cursor     uint64
-		inodeTree  = NewBtree()
-		dentryTree = NewBtree()
+		inodeTree  MetaTree
+		dentryTree MetaTree
+		txTable    = NewTxTable()
+		fileLocks  = NewFileLockTable()
+		quotaTasks = NewQuotaTaskTable()
+		snapshots  = make(map[uint64]*metaSnapshot)
 	)
 	defer func() {
 		if err == io.EOF {
+			if mp.metaStore != nil {
+				if err = mp.metaStore.EndLoad(); err != nil {
+					log.LogErrorf("[ApplySnapshot]: %s", err.Error())
+					return
+				}
+			}
 			mp.applyID = appIndexID
+			if e := mp.changeLog.Reset(appIndexID); e != nil {
+				log.LogErrorf("ApplySnapshot: partition(%v) reset change log err(%v)", mp.config.PartitionId, e)
+			}
 			mp.inodeTree = inodeTree
 			mp.dentryTree = dentryTree
+			mp.txTable = txTable
+			mp.fileLocks = fileLocks
+			mp.quotaTasks = quotaTasks
+			mp.quotaUsages = newQuotaUsageTable(mp.countQuotaUsages())
+			mp.snapshotsLock.Lock()
+			mp.snapshots = snapshots
+			mp.snapshotsLock.Unlock()
 			mp.config.Cursor = cursor
+			mp.trackChanges()
 			err = nil
 			// store message
+			txData, _ := txTable.Marshal()
+			lockData, _ := fileLocks.Marshal()
+			quotaData, _ := quotaTasks.Marshal()
 			mp.storeChan <- &storeMsg{
 				command:    opFSMStoreTick,
 				applyIndex: mp.applyID,
-				inodeTree:  mp.inodeTree,
-				dentryTree: mp.dentryTree,
+				inodeTree:  mp.getInodeTree(),
+				dentryTree: mp.getDentryTree(),
+				txTable:    txData,
+				fileLocks:  lockData,
+				quotaTasks: quotaData,
+				snapshots:  mp.getSnapshots(),
 			}
 			mp.extReset <- struct{}{}
 			log.LogDebugf("[ApplySnapshot] successful.")
@@ -227,6 +454,15 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 		}
 		log.LogErrorf("[ApplySnapshot]: %s", err.Error())
 	}()
+	if mp.metaStore != nil {
+		// the items are loaded into the DB, instead of new trees in memory
+		if err = mp.metaStore.BeginLoad(); err != nil {
+			return
+		}
+		inodeTree, dentryTree = mp.inodeTree, mp.dentryTree
+	} else {
+		inodeTree, dentryTree = NewBtree(), NewBtree()
+	}
 	for {
 		data, err = iter.Next()
 		if err != nil {
@@ -261,6 +497,47 @@ func (mp *metaPartition) ApplySnapshot(peers []raftproto.Peer, iter raftproto.Sn
 			dentry.UnmarshalValue(snap.V)
 			dentryTree.ReplaceOrInsert(dentry, true)
 			log.LogDebugf("action[ApplySnapshot] create dentry[%v].", dentry)
+		case opTxTableSnapshot:
+			if err = txTable.Unmarshal(snap.V); err != nil {
+				return
+			}
+			log.LogDebugf("action[ApplySnapshot] load transactions.")
+		case opLockTableSnapshot:
+			if err = fileLocks.Unmarshal(snap.V); err != nil {
+				return
+			}
+			log.LogDebugf("action[ApplySnapshot] load file locks.")
+		case opQuotaTaskSnapshot:
+			if err = quotaTasks.Unmarshal(snap.V); err != nil {
+				return
+			}
+			log.LogDebugf("action[ApplySnapshot] load quota tasks.")
+		case opFSMCreateSnapshot:
+			id := binary.BigEndian.Uint64(snap.K)
+			snapshots[id] = newMetaSnapshot(id)
+			log.LogDebugf("action[ApplySnapshot] create snapshot[%v].", id)
+		case opMetaSnapshotInode:
+			ino := NewInode(0, 0)
+			if err = ino.Unmarshal(snap.V); err != nil {
+				return
+			}
+			s, ok := snapshots[binary.BigEndian.Uint64(snap.K)]
+			if !ok {
+				err = fmt.Errorf("snapshot of inode[%v] not exists", ino.Inode)
+				return
+			}
+			s.inodeTree.ReplaceOrInsert(ino, true)
+		case opMetaSnapshotDentry:
+			dentry := &Dentry{}
+			if err = dentry.Unmarshal(snap.V); err != nil {
+				return
+			}
+			s, ok := snapshots[binary.BigEndian.Uint64(snap.K)]
+			if !ok {
+				err = fmt.Errorf("snapshot of dentry[%v] not exists", dentry)
+				return
+			}
+			s.dentryTree.ReplaceOrInsert(dentry, true)
 		case opExtentFileSnapshot:
 			fileName := string(snap.K)
 			fileName = path.Join(mp.config.RootDir, fileName)
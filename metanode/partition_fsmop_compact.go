@@ -0,0 +1,63 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+func (mp *metaPartition) fsmRelocateExtents(req *proto.RelocateExtentsRequest) (resp *proto.RelocateExtentsResponse) {
+	resp = &proto.RelocateExtentsResponse{Replaced: make([]bool, len(req.Relocations))}
+	// the generations of the inodes bumped by the relocations of the request
+	relocated := make(map[uint64]uint64)
+	for i, r := range req.Relocations {
+		item := mp.inodeTree.CopyGet(NewInode(r.Inode, 0))
+		if item == nil || item.(*Inode).ShouldDelete() {
+			continue
+		}
+		ino := item.(*Inode)
+		old := r.Old
+		generation := r.Generation
+		if gen, ok := relocated[r.Inode]; ok {
+			generation = gen
+		}
+		ino.Lock()
+		// the generation is unknown in the requests logged before it is recorded, and an overwrite
+		// in place bumps it without changing the keys
+		if generation != 0 && ino.Generation != generation {
+			log.LogWarnf("fsmRelocateExtents: partition(%v) ino(%v) generation changed from %v to %v",
+				mp.config.PartitionId, r.Inode, generation, ino.Generation)
+		} else if found := ino.Extents.Get(&proto.ExtentKey{FileOffset: old.FileOffset}); found != nil && *found.(*proto.ExtentKey) == old {
+			// the extent keys may be shared with the snapshots, so they are replaced with the copies
+			newExt := r.New
+			ino.Extents.ReplaceOrInsert(&newExt, true)
+			ino.Generation++
+			if generation != 0 {
+				relocated[r.Inode] = ino.Generation
+			}
+			resp.Replaced[i] = true
+		}
+		ino.Unlock()
+		if resp.Replaced[i] && !ino.Extents.Referenced(&old) {
+			for _, item := range mp.unreferencedBySnapshots(ino.Inode, []BtreeItem{&old}) {
+				mp.extDelCh <- item
+			}
+		}
+	}
+	log.LogInfof("fsmRelocateExtents: partition(%v) relocations(%v) replaced(%v)",
+		mp.config.PartitionId, len(req.Relocations), resp.Replaced)
+	return
+}
@@ -51,6 +51,9 @@ func (mp *metaPartition) fsmCreateDentry(dentry *Dentry,
 			status = proto.OpArgMismatchErr
 			return
 		}
+		if status = mp.checkDirShard(parIno, dentry.Name); status != proto.OpOk {
+			return
+		}
 	}
 	if item, ok := mp.dentryTree.ReplaceOrInsert(dentry, false); !ok {
 		//do not allow directories and files to overwrite each
@@ -69,6 +72,9 @@ func (mp *metaPartition) fsmCreateDentry(dentry *Dentry,
 	} else {
 		if !forceUpdate {
 			parIno.IncNLink()
+			if mp.isLargeDir(parIno) {
+				mp.largeDirs.Store(parIno.Inode, struct{}{})
+			}
 		}
 	}
 
@@ -122,25 +128,47 @@ func (mp *metaPartition) fsmUpdateDentry(dentry *Dentry) (
 		}
 		d := item.(*Dentry)
 		d.Inode, dentry.Inode = dentry.Inode, d.Inode
+		// the type of the new inode if given, e.g. a file renamed over a symlink
+		if dentry.Type != 0 {
+			d.Type, dentry.Type = dentry.Type, d.Type
+		}
 		resp.Msg = dentry
 	})
 	return
 }
 
-func (mp *metaPartition) getDentryTree() *BTree {
+func (mp *metaPartition) getDentryTree() MetaTree {
 	return mp.dentryTree.GetTree()
 }
 
-func (mp *metaPartition) readDir(req *ReadDirReq) (resp *ReadDirResp) {
+func (mp *metaPartition) readDir(req *ReadDirReq) (resp *ReadDirResp, status uint8) {
 	resp = &ReadDirResp{}
+	status = proto.OpOk
+	tree := mp.dentryTree
+	if req.SnapshotID != 0 {
+		s := mp.getSnapshot(req.SnapshotID)
+		if s == nil {
+			status = proto.OpNotExistErr
+			return
+		}
+		tree = s.dentryTree
+	}
 	begDentry := &Dentry{
 		ParentId: req.ParentID,
+		Name:     req.Marker,
 	}
 	endDentry := &Dentry{
 		ParentId: req.ParentID + 1,
 	}
-	mp.dentryTree.AscendRange(begDentry, endDentry, func(i BtreeItem) bool {
+	tree.AscendRange(begDentry, endDentry, func(i BtreeItem) bool {
 		d := i.(*Dentry)
+		if req.Marker != "" && d.Name == req.Marker {
+			return true
+		}
+		if req.Limit > 0 && uint64(len(resp.Children)) >= req.Limit {
+			resp.NextMarker = resp.Children[len(resp.Children)-1].Name
+			return false
+		}
 		resp.Children = append(resp.Children, proto.Dentry{
 			Inode: d.Inode,
 			Type:  d.Type,
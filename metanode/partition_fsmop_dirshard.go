@@ -0,0 +1,96 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func (mp *metaPartition) fsmSplitDir(req *proto.SplitDirRequest) (status uint8) {
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil {
+		return proto.OpNotExistErr
+	}
+	dir := item.(*Inode)
+	if dir.ShouldDelete() {
+		return proto.OpNotExistErr
+	}
+	if !proto.IsDir(dir.Type) {
+		return proto.OpArgMismatchErr
+	}
+	// the directory split by an earlier task, which the master failed to record, keeps its shards
+	if _, ok := dir.GetXAttr(proto.DirShardXAttr); ok {
+		mp.largeDirs.Delete(req.Inode)
+		return proto.OpOk
+	}
+	val, err := json.Marshal(req.PartitionIDs)
+	if err != nil {
+		return proto.OpErr
+	}
+	dir.SetXAttr(proto.DirShardXAttr, val)
+	mp.largeDirs.Delete(req.Inode)
+	return proto.OpOk
+}
+
+// checkDirShard checks whether the new dentry of the parent belongs to the partition, and whether
+// the parent is being removed, in which case the client tries again later.
+func (mp *metaPartition) checkDirShard(parent *Inode, name string) uint8 {
+	val, ok := parent.GetXAttr(proto.DirShardXAttr)
+	if !ok {
+		return proto.OpOk
+	}
+	var pids []uint64
+	if err := json.Unmarshal(val, &pids); err != nil || len(pids) == 0 {
+		return proto.OpOk
+	}
+	if proto.DirShardPartition(pids, parent.Inode, name) != mp.config.PartitionId {
+		return proto.OpDirShardErr
+	}
+	if _, ok = parent.GetXAttr(proto.DirRemovingXAttr); ok {
+		return proto.OpAgain
+	}
+	return proto.OpOk
+}
+
+// fsmMarkDirRemoving marks the sharded directory as being removed, if it has no entries in the
+// partition, or clears the mark.
+func (mp *metaPartition) fsmMarkDirRemoving(req *dirRemovingReq) (status uint8) {
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil {
+		return proto.OpNotExistErr
+	}
+	dir := item.(*Inode)
+	if !req.Removing {
+		dir.RemoveXAttr(proto.DirRemovingXAttr)
+		return proto.OpOk
+	}
+	if dir.ShouldDelete() {
+		return proto.OpNotExistErr
+	}
+	if !proto.IsDir(dir.Type) {
+		return proto.OpArgMismatchErr
+	}
+	if _, ok := dir.GetXAttr(proto.DirShardXAttr); !ok {
+		return proto.OpArgMismatchErr
+	}
+	if !dir.IsEmptyDir() {
+		return proto.OpNotEmtpy
+	}
+	dir.SetXAttr(proto.DirRemovingXAttr, []byte(strconv.FormatInt(req.Time, 10)))
+	return proto.OpOk
+}
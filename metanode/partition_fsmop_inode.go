@@ -36,7 +36,9 @@ func (mp *metaPartition) fsmCreateInode(ino *Inode) (status uint8) {
 	status = proto.OpOk
 	if _, ok := mp.inodeTree.ReplaceOrInsert(ino, false); !ok {
 		status = proto.OpExistErr
+		return
 	}
+	mp.quotaUsages.update(nil, inodeQuotaUsage(ino))
 	return
 }
 
@@ -95,7 +97,7 @@ func (mp *metaPartition) hasInode(ino *Inode) (ok bool) {
 	return
 }
 
-func (mp *metaPartition) getInodeTree() *BTree {
+func (mp *metaPartition) getInodeTree() MetaTree {
 	return mp.inodeTree.GetTree()
 }
 
@@ -125,6 +127,7 @@ func (mp *metaPartition) fsmUnlinkInode(ino *Inode) (resp *InodeResponse) {
 
 	if inode.IsEmptyDir() {
 		mp.inodeTree.Delete(inode)
+		mp.quotaUsages.update(inodeQuotaUsage(inode), nil)
 	}
 
 	inode.DecNLink()
@@ -156,6 +159,9 @@ func (mp *metaPartition) internalDelete(val []byte) (err error) {
 }
 
 func (mp *metaPartition) internalDeleteInode(ino *Inode) {
+	if item := mp.inodeTree.Get(ino); item != nil {
+		mp.quotaUsages.update(inodeQuotaUsage(item.(*Inode)), nil)
+	}
 	mp.inodeTree.Delete(ino)
 	mp.freeList.Remove(ino.Inode)
 	return
@@ -178,7 +184,10 @@ func (mp *metaPartition) fsmAppendExtents(ino *Inode) (status uint8) {
 		items = append(items, item)
 		return true
 	})
+	before := inodeQuotaUsage(ino2)
 	items = ino2.AppendExtents(items, ino.ModifyTime)
+	mp.quotaUsages.update(before, inodeQuotaUsage(ino2))
+	items = mp.unreferencedBySnapshots(ino2.Inode, items)
 	for _, item := range items {
 		log.LogInfof("fsmAppendExtents inode(%v) ext(%v)", ino2.Inode, item.(*proto.ExtentKey))
 		mp.extDelCh <- item
@@ -186,6 +195,19 @@ func (mp *metaPartition) fsmAppendExtents(ino *Inode) (status uint8) {
 	return
 }
 
+func (mp *metaPartition) fsmOverwriteExtents(ino *Inode) (status uint8) {
+	item := mp.inodeTree.CopyGet(ino)
+	if item == nil {
+		return proto.OpNotExistErr
+	}
+	ino2 := item.(*Inode)
+	if ino2.ShouldDelete() {
+		return proto.OpNotExistErr
+	}
+	ino2.OverwriteExtents(ino.ModifyTime)
+	return proto.OpOk
+}
+
 func (mp *metaPartition) fsmExtentsTruncate(ino *Inode) (resp *InodeResponse) {
 	resp = NewInodeResponse()
 
@@ -210,7 +232,17 @@ func (mp *metaPartition) fsmExtentsTruncate(ino *Inode) (resp *InodeResponse) {
 			delExtents = append(delExtents, item)
 			return true
 		})
+	before := inodeQuotaUsage(i)
 	i.ExtentsTruncate(delExtents, ino.Size, ino.ModifyTime)
+	mp.quotaUsages.update(before, inodeQuotaUsage(i))
+	// the extents may still be referenced by the rest of the file or the snapshots
+	items := delExtents[:0]
+	for _, ext := range delExtents {
+		if !i.Extents.Referenced(ext.(*proto.ExtentKey)) {
+			items = append(items, ext)
+		}
+	}
+	delExtents = mp.unreferencedBySnapshots(i.Inode, items)
 	// now we should delete the extent
 	for _, ext := range delExtents {
 		log.LogInfof("fsmExtentsTruncate inode(%v) ext(%v)", i.Inode, ext.(*proto.ExtentKey))
@@ -232,15 +264,18 @@ func (mp *metaPartition) fsmEvictInode(ino *Inode) (resp *InodeResponse) {
 	if i.ShouldDelete() {
 		return
 	}
+	before := inodeQuotaUsage(i)
 	if proto.IsDir(i.Type) {
 		if i.IsEmptyDir() {
 			i.SetDeleteMark()
+			mp.quotaUsages.update(before, nil)
 		}
 		return
 	}
 
 	if i.IsTempFile() {
 		i.SetDeleteMark()
+		mp.quotaUsages.update(before, nil)
 		mp.freeList.Push(i.Inode)
 	}
 	return
@@ -268,3 +303,120 @@ func (mp *metaPartition) fsmSetAttr(req *SetattrRequest) (err error) {
 	ino.SetAttr(req.Valid, req.Mode, req.Uid, req.Gid)
 	return
 }
+
+func (mp *metaPartition) fsmSetXAttr(req *SetXAttrReq) (status uint8) {
+	status = proto.OpOk
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil {
+		status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	if ino.ShouldDelete() {
+		status = proto.OpNotExistErr
+		return
+	}
+	_, exist := ino.GetXAttr(req.Key)
+	if exist && req.Flags&proto.XAttrCreate != 0 {
+		status = proto.OpExistErr
+		return
+	}
+	if !exist && req.Flags&proto.XAttrReplace != 0 {
+		status = proto.OpNoAttrErr
+		return
+	}
+	ino.SetXAttr(req.Key, req.Value)
+	return
+}
+
+func (mp *metaPartition) fsmRemoveXAttr(req *RemoveXAttrReq) (status uint8) {
+	status = proto.OpOk
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item == nil {
+		status = proto.OpNotExistErr
+		return
+	}
+	ino := item.(*Inode)
+	if ino.ShouldDelete() {
+		status = proto.OpNotExistErr
+		return
+	}
+	if !ino.RemoveXAttr(req.Key) {
+		status = proto.OpNoAttrErr
+	}
+	return
+}
+
+func (mp *metaPartition) fsmSetInodeQuota(req *SetInodeQuotaReq) (status uint8) {
+	status = proto.OpOk
+	for _, inode := range req.Inodes {
+		item := mp.inodeTree.CopyGet(NewInode(inode, 0))
+		if item == nil {
+			continue
+		}
+		ino := item.(*Inode)
+		if ino.ShouldDelete() {
+			continue
+		}
+		before := inodeQuotaUsage(ino)
+		if req.Remove {
+			ino.RemoveQuota(req.QuotaID)
+		} else {
+			ino.AddQuota(req.QuotaID)
+		}
+		mp.quotaUsages.update(before, inodeQuotaUsage(ino))
+	}
+	return
+}
+
+// Replace the keys of the source extent with the ones of the erasure-coded extent converted from it. The keys
+// beyond the converted size are kept, since the extent may be appended after the conversion started. Nothing is
+// replaced if the file has been changed since the extent was chosen, e.g. overwritten in place, as the copy may
+// miss the data written during the conversion, and the copy is deleted instead.
+func (mp *metaPartition) fsmEcConvertExtent(req *EcConvertExtentReq) (status uint8) {
+	status = proto.OpOk
+	src := &proto.ExtentKey{PartitionId: req.SrcPartitionID, ExtentId: req.SrcExtentID, Size: uint32(req.Size)}
+	dst := &proto.ExtentKey{PartitionId: req.DstPartitionID, ExtentId: req.DstExtentID, Size: uint32(req.Size)}
+	var replaced []*proto.ExtentKey
+	item := mp.inodeTree.CopyGet(NewInode(req.Inode, 0))
+	if item != nil && !item.(*Inode).ShouldDelete() {
+		ino := item.(*Inode)
+		ino.Lock()
+		// the generation is unknown in the requests logged before it is recorded
+		if req.Generation != 0 && ino.Generation != req.Generation {
+			ino.Unlock()
+			log.LogWarnf("fsmEcConvertExtent: partition(%v) req(%v) generation changed to %v",
+				mp.config.PartitionId, req, ino.Generation)
+			mp.extDelCh <- dst
+			return proto.OpNotExistErr
+		}
+		ino.Extents.Range(func(item BtreeItem) bool {
+			ek := item.(*proto.ExtentKey)
+			if ek.PartitionId == src.PartitionId && ek.ExtentId == src.ExtentId && ek.ExtentOffset+uint64(ek.Size) <= req.Size {
+				replaced = append(replaced, ek)
+			}
+			return true
+		})
+		// the extent keys may be shared with the snapshots, so they are replaced with the copies
+		for _, ek := range replaced {
+			newExt := *ek
+			newExt.PartitionId, newExt.ExtentId = dst.PartitionId, dst.ExtentId
+			ino.Extents.ReplaceOrInsert(&newExt, true)
+		}
+		if len(replaced) > 0 {
+			ino.Generation++
+		}
+		ino.Unlock()
+		if len(replaced) > 0 && !ino.Extents.Referenced(src) {
+			for _, item := range mp.unreferencedBySnapshots(ino.Inode, []BtreeItem{src}) {
+				mp.extDelCh <- item
+			}
+		}
+	}
+	if len(replaced) == 0 {
+		status = proto.OpNotExistErr
+		mp.extDelCh <- dst
+	}
+	log.LogInfof("fsmEcConvertExtent: partition(%v) req(%v) replaced(%v)", mp.config.PartitionId, req, len(replaced))
+	return
+}
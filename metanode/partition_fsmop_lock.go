@@ -0,0 +1,35 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Acquire or release a file lock with the time set by the leader.
+func (mp *metaPartition) fsmSetLock(req *SetLockReq) (status uint8) {
+	status = proto.OpOk
+	if !mp.fileLocks.SetLock(req.Inode, &req.Lock, req.Time) {
+		status = proto.OpLockConflictErr
+	}
+	return
+}
+
+// Renew the leases of the file locks of a client with the time set by the leader.
+func (mp *metaPartition) fsmRenewLock(req *RenewLockReq) (resp *RenewLockResp) {
+	return &RenewLockResp{
+		Inodes: mp.fileLocks.Renew(req.ClientID, req.Inodes, req.Time),
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"sort"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// metaSnapshot is the frozen version of the inode and dentry trees taken by a volume snapshot.
+// The trees share the unmodified nodes with the live ones, which copy them on write.
+type metaSnapshot struct {
+	id         uint64
+	inodeTree  MetaTree
+	dentryTree MetaTree
+}
+
+func newMetaSnapshot(id uint64) *metaSnapshot {
+	return &metaSnapshot{
+		id:         id,
+		inodeTree:  NewBtree(),
+		dentryTree: NewBtree(),
+	}
+}
+
+func (mp *metaPartition) getSnapshot(id uint64) *metaSnapshot {
+	mp.snapshotsLock.RLock()
+	defer mp.snapshotsLock.RUnlock()
+	return mp.snapshots[id]
+}
+
+// Returns the snapshots sorted by ID.
+func (mp *metaPartition) getSnapshots() (snapshots []*metaSnapshot) {
+	mp.snapshotsLock.RLock()
+	for _, s := range mp.snapshots {
+		snapshots = append(snapshots, s)
+	}
+	mp.snapshotsLock.RUnlock()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].id < snapshots[j].id
+	})
+	return
+}
+
+func (mp *metaPartition) putSnapshot(s *metaSnapshot) {
+	mp.snapshotsLock.Lock()
+	mp.snapshots[s.id] = s
+	mp.snapshotsLock.Unlock()
+}
+
+func (mp *metaPartition) fsmCreateSnapshot(req *proto.MetaSnapshotRequest) (status uint8) {
+	status = proto.OpOk
+	if mp.getSnapshot(req.SnapshotID) != nil {
+		return
+	}
+	mp.putSnapshot(&metaSnapshot{
+		id:         req.SnapshotID,
+		inodeTree:  mp.inodeTree.GetTree(),
+		dentryTree: mp.dentryTree.GetTree(),
+	})
+	log.LogInfof("fsmCreateSnapshot: partition(%v) snapshot(%v)", mp.config.PartitionId, req.SnapshotID)
+	return
+}
+
+// Delete the snapshot, and the extents which are only referenced by it.
+func (mp *metaPartition) fsmDeleteSnapshot(req *proto.MetaSnapshotRequest) (status uint8) {
+	status = proto.OpOk
+	mp.snapshotsLock.Lock()
+	s, ok := mp.snapshots[req.SnapshotID]
+	delete(mp.snapshots, req.SnapshotID)
+	mp.snapshotsLock.Unlock()
+	if !ok {
+		return
+	}
+	s.inodeTree.Ascend(func(item BtreeItem) bool {
+		ino := item.(*Inode)
+		var live *Inode
+		if i := mp.inodeTree.Get(ino); i != nil {
+			live = i.(*Inode)
+		}
+		var exts []BtreeItem
+		ino.Extents.Range(func(ext BtreeItem) bool {
+			if live == nil || !live.Extents.Referenced(ext.(*proto.ExtentKey)) {
+				exts = append(exts, ext)
+			}
+			return true
+		})
+		for _, ext := range mp.unreferencedBySnapshots(ino.Inode, exts) {
+			log.LogInfof("fsmDeleteSnapshot inode(%v) ext(%v)", ino.Inode, ext.(*proto.ExtentKey))
+			mp.extDelCh <- ext
+		}
+		return true
+	})
+	log.LogInfof("fsmDeleteSnapshot: partition(%v) snapshot(%v)", mp.config.PartitionId, req.SnapshotID)
+	return
+}
+
+// Returns true if the extent key of the inode is still referenced by any snapshot.
+func (mp *metaPartition) referencedBySnapshots(inode uint64, ek *proto.ExtentKey) bool {
+	for _, s := range mp.getSnapshots() {
+		item := s.inodeTree.Get(NewInode(inode, 0))
+		if item != nil && item.(*Inode).Extents.Referenced(ek) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter out the extent keys of the inode referenced by the snapshots, so that they are not deleted.
+func (mp *metaPartition) unreferencedBySnapshots(inode uint64, exts []BtreeItem) (items []BtreeItem) {
+	if len(mp.getSnapshots()) == 0 {
+		return exts
+	}
+	for _, ext := range exts {
+		if !mp.referencedBySnapshots(inode, ext.(*proto.ExtentKey)) {
+			items = append(items, ext)
+		}
+	}
+	return
+}
+
+// Returns the inode from the snapshot, or from the live tree if the snapshot ID is zero.
+func (mp *metaPartition) getSnapshotInode(snapshotID uint64, ino *Inode) (resp *InodeResponse) {
+	if snapshotID == 0 {
+		return mp.getInode(ino)
+	}
+	resp = NewInodeResponse()
+	resp.Status = proto.OpOk
+	s := mp.getSnapshot(snapshotID)
+	if s == nil {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	item := s.inodeTree.Get(ino)
+	if item == nil || item.(*Inode).ShouldDelete() {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	resp.Msg = item.(*Inode)
+	return
+}
+
+// Returns the dentry from the snapshot, or from the live tree if the snapshot ID is zero.
+func (mp *metaPartition) getSnapshotDentry(snapshotID uint64, dentry *Dentry) (*Dentry, uint8) {
+	if snapshotID == 0 {
+		return mp.getDentry(dentry)
+	}
+	s := mp.getSnapshot(snapshotID)
+	if s == nil {
+		return nil, proto.OpNotExistErr
+	}
+	item := s.dentryTree.Get(dentry)
+	if item == nil {
+		return nil, proto.OpNotExistErr
+	}
+	return item.(*Dentry), proto.OpOk
+}
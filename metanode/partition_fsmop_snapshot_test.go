@@ -0,0 +1,168 @@
+package metanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Returns the extent keys deleted by the partition so far.
+func deletedExtents(mp *metaPartition) (keys []proto.ExtentKey) {
+	for ek := deletedExtent(mp); ek != nil; ek = deletedExtent(mp) {
+		keys = append(keys, *ek)
+	}
+	return
+}
+
+func appendTestExtent(mp *metaPartition, inode uint64, ek proto.ExtentKey) {
+	update := NewInode(inode, 0)
+	update.Extents.Append(&ek)
+	update.ModifyTime = time.Now().Unix()
+	mp.fsmAppendExtents(update)
+}
+
+// The inodes and dentries of a snapshot are not changed by the live tree, and the extents
+// referenced by the snapshot are kept.
+func TestSnapshotFrozen(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	old := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, Size: 100}
+	appendTestExtent(mp, ino.Inode, old)
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+
+	newKey := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 200}
+	appendTestExtent(mp, ino.Inode, newKey)
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: proto.RootIno, Name: "file"}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	if keys := deletedExtents(mp); len(keys) != 0 {
+		t.Fatalf("expect the extents of the snapshot to be kept, got %v", keys)
+	}
+
+	live := mp.getSnapshotInode(0, NewInode(ino.Inode, 0))
+	if keys := extentKeysOf(live.Msg); len(keys) != 1 || keys[0] != newKey {
+		t.Fatalf("expect the live inode to have the new key, got %v", keys)
+	}
+	snap := mp.getSnapshotInode(1, NewInode(ino.Inode, 0))
+	if snap.Status != proto.OpOk {
+		t.Fatalf("snapshot inode: status %v", snap.Status)
+	}
+	if keys := extentKeysOf(snap.Msg); len(keys) != 1 || keys[0] != old || snap.Msg.Size != 100 {
+		t.Fatalf("expect the snapshot inode to be frozen, got %v size %v", keys, snap.Msg.Size)
+	}
+	if _, status := mp.getSnapshotDentry(0, &Dentry{ParentId: proto.RootIno, Name: "file"}); status != proto.OpNotExistErr {
+		t.Fatalf("expect the live dentry to be deleted, got status %v", status)
+	}
+	if d, status := mp.getSnapshotDentry(1, &Dentry{ParentId: proto.RootIno, Name: "file"}); status != proto.OpOk || d.Inode != ino.Inode {
+		t.Fatalf("expect the snapshot dentry to be kept, got %v status %v", d, status)
+	}
+	if resp := mp.getSnapshotInode(2, NewInode(ino.Inode, 0)); resp.Status != proto.OpNotExistErr {
+		t.Fatalf("expect no inode from an unknown snapshot, got status %v", resp.Status)
+	}
+}
+
+// The extents truncated from a file are kept for the snapshots.
+func TestSnapshotTruncate(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	head := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, Size: 100}
+	tail := proto.ExtentKey{FileOffset: 100, PartitionId: 1, ExtentId: 1025, Size: 100}
+	appendTestExtent(mp, ino.Inode, head)
+	appendTestExtent(mp, ino.Inode, tail)
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+
+	truncate := NewInode(ino.Inode, 0)
+	truncate.Size = 100
+	if resp := mp.fsmExtentsTruncate(truncate); resp.Status != proto.OpOk {
+		t.Fatalf("truncate: status %v", resp.Status)
+	}
+	if keys := deletedExtents(mp); len(keys) != 0 {
+		t.Fatalf("expect the truncated extent to be kept for the snapshot, got %v", keys)
+	}
+	mp.fsmDeleteSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+	if keys := deletedExtents(mp); len(keys) != 1 || keys[0] != tail {
+		t.Fatalf("expect the truncated extent to be deleted with the snapshot, got %v", keys)
+	}
+}
+
+// Deleting a snapshot deletes the extents referenced neither by the live tree nor by the other snapshots.
+func TestDeleteSnapshot(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	first := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, Size: 100}
+	second := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 100}
+	third := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1026, Size: 100}
+	kept := proto.ExtentKey{FileOffset: 100, PartitionId: 1, ExtentId: 1027, Size: 100}
+	appendTestExtent(mp, ino.Inode, first)
+	appendTestExtent(mp, ino.Inode, kept)
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+	appendTestExtent(mp, ino.Inode, second)
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 2})
+	appendTestExtent(mp, ino.Inode, third)
+	if keys := deletedExtents(mp); len(keys) != 0 {
+		t.Fatalf("expect the overwritten extents to be kept for the snapshots, got %v", keys)
+	}
+
+	// the second extent is still referenced by the second snapshot
+	mp.fsmDeleteSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+	if keys := deletedExtents(mp); len(keys) != 1 || keys[0] != first {
+		t.Fatalf("expect only the extent of the first snapshot to be deleted, got %v", keys)
+	}
+	mp.fsmDeleteSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 2})
+	if keys := deletedExtents(mp); len(keys) != 1 || keys[0] != second {
+		t.Fatalf("expect only the extent of the second snapshot to be deleted, got %v", keys)
+	}
+	// deleting an unknown snapshot is ignored, so that the master can retry
+	if status := mp.fsmDeleteSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 2}); status != proto.OpOk {
+		t.Fatalf("expect the deletion to be retried, got status %v", status)
+	}
+	if keys := extentKeysOf(mp.inodeTree.Get(ino).(*Inode)); len(keys) != 2 || keys[0] != third || keys[1] != kept {
+		t.Fatalf("expect the live keys to be kept, got %v", keys)
+	}
+}
+
+// The snapshots are sent to the followers along with the trees of the partition.
+func TestSnapshotApply(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	old := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, Size: 100}
+	appendTestExtent(mp, ino.Inode, old)
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+	newKey := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1025, Size: 100}
+	appendTestExtent(mp, ino.Inode, newKey)
+	mp.fsmDeleteDentry(&Dentry{ParentId: proto.RootIno, Name: "file"})
+
+	follower, cleanupFollower := newTestPartition(t)
+	defer cleanupFollower()
+	iter, err := mp.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { <-follower.extReset }()
+	if err = follower.ApplySnapshot(nil, iter); err != nil {
+		t.Fatalf("apply snapshot: %v", err)
+	}
+
+	live := follower.getSnapshotInode(0, NewInode(ino.Inode, 0))
+	if keys := extentKeysOf(live.Msg); len(keys) != 1 || keys[0] != newKey {
+		t.Fatalf("expect the live inode to have the new key, got %v", keys)
+	}
+	snap := follower.getSnapshotInode(1, NewInode(ino.Inode, 0))
+	if snap.Status != proto.OpOk {
+		t.Fatalf("snapshot inode: status %v", snap.Status)
+	}
+	if keys := extentKeysOf(snap.Msg); len(keys) != 1 || keys[0] != old {
+		t.Fatalf("expect the snapshot inode to have the old key, got %v", keys)
+	}
+	if _, status := follower.getSnapshotDentry(1, &Dentry{ParentId: proto.RootIno, Name: "file"}); status != proto.OpOk {
+		t.Fatalf("expect the snapshot dentry, got status %v", status)
+	}
+	if _, status := follower.getSnapshotDentry(0, &Dentry{ParentId: proto.RootIno, Name: "file"}); status != proto.OpNotExistErr {
+		t.Fatalf("expect no live dentry, got status %v", status)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+type TxStateResponse struct {
+	Status uint8
+	State  uint8
+}
+
+// Record a transaction coordinated by this partition.
+func (mp *metaPartition) fsmTxInit(tx *proto.TxInfo) (status uint8) {
+	status = proto.OpOk
+	if !mp.txTable.PutTx(tx) {
+		status = proto.OpExistErr
+	}
+	return
+}
+
+// Decide a transaction. The first decision wins, so the response is the state actually recorded.
+func (mp *metaPartition) fsmTxSetState(tx *proto.TxInfo) (resp *TxStateResponse) {
+	resp = &TxStateResponse{Status: proto.OpOk}
+	state, ok := mp.txTable.SetTxState(tx.TxID, tx.State)
+	if !ok {
+		resp.Status = proto.OpNotExistErr
+		return
+	}
+	resp.State = state
+	return
+}
+
+func (mp *metaPartition) fsmTxDelete(tx *proto.TxInfo) (status uint8) {
+	mp.txTable.DeleteTx(tx.TxID)
+	return proto.OpOk
+}
+
+// Validate the operations of a participant and lock the items they touch.
+func (mp *metaPartition) fsmTxPrepare(req *proto.TxPrepareRequest) (status uint8) {
+	if _, ok := mp.txTable.GetRecord(req.TxID); ok {
+		return proto.OpOk
+	}
+	for _, op := range req.Ops {
+		if status = mp.txCheckOperation(op); status != proto.OpOk {
+			log.LogWarnf("fsmTxPrepare: partition(%v) tx(%v) op(%v) status(%v)",
+				mp.config.PartitionId, req.TxID, op, status)
+			return
+		}
+	}
+	rec := &TxRecord{
+		TxID:        req.TxID,
+		Coordinator: req.Coordinator,
+		Ops:         req.Ops,
+		CreateTime:  req.CreateTime,
+	}
+	if !mp.txTable.PutRecord(rec) {
+		return proto.OpAgain
+	}
+	return proto.OpOk
+}
+
+func (mp *metaPartition) txCheckOperation(op *proto.TxOperation) (status uint8) {
+	status = proto.OpOk
+	switch op.Type {
+	case proto.TxOpCreateDentry:
+		if !op.Shard {
+			item := mp.inodeTree.Get(NewInode(op.ParentID, 0))
+			if item == nil || item.(*Inode).ShouldDelete() {
+				return proto.OpNotExistErr
+			}
+			if !proto.IsDir(item.(*Inode).Type) {
+				return proto.OpArgMismatchErr
+			}
+			if st := mp.checkDirShard(item.(*Inode), op.Name); st != proto.OpOk {
+				return st
+			}
+		}
+		if _, st := mp.getDentry(&Dentry{ParentId: op.ParentID, Name: op.Name}); st == proto.OpOk {
+			return proto.OpExistErr
+		}
+	case proto.TxOpDeleteDentry, proto.TxOpUpdateDentry:
+		den, st := mp.getDentry(&Dentry{ParentId: op.ParentID, Name: op.Name})
+		if st != proto.OpOk || den.Inode != op.OldInode {
+			return proto.OpNotExistErr
+		}
+		if op.Type == proto.TxOpUpdateDentry && proto.IsDir(den.Type) != proto.IsDir(op.Mode) {
+			return proto.OpArgMismatchErr
+		}
+	case proto.TxOpUnlinkInode:
+		if !mp.hasInode(NewInode(op.Inode, 0)) {
+			return proto.OpNotExistErr
+		}
+	default:
+		return proto.OpArgMismatchErr
+	}
+	return
+}
+
+// Execute the prepared operations. Committing an unknown transaction is a no-op, so that it can be retried.
+func (mp *metaPartition) fsmTxCommit(req *proto.TxCommitRequest) (status uint8) {
+	rec, ok := mp.txTable.GetRecord(req.TxID)
+	if !ok {
+		return proto.OpOk
+	}
+	for _, op := range rec.Ops {
+		var st uint8
+		switch op.Type {
+		case proto.TxOpCreateDentry:
+			st = mp.fsmCreateDentry(&Dentry{ParentId: op.ParentID, Name: op.Name,
+				Inode: op.Inode, Type: op.Mode}, op.Shard)
+		case proto.TxOpDeleteDentry:
+			st = mp.fsmDeleteDentry(&Dentry{ParentId: op.ParentID, Name: op.Name}).Status
+		case proto.TxOpUpdateDentry:
+			st = mp.fsmUpdateDentry(&Dentry{ParentId: op.ParentID, Name: op.Name,
+				Inode: op.Inode, Type: op.Mode}).Status
+		case proto.TxOpUnlinkInode:
+			ino := NewInode(op.Inode, 0)
+			ino.ModifyTime = rec.CreateTime
+			st = mp.fsmUnlinkInode(ino).Status
+		}
+		if st != proto.OpOk {
+			log.LogErrorf("fsmTxCommit: partition(%v) tx(%v) op(%v) status(%v)",
+				mp.config.PartitionId, rec.TxID, op, st)
+		}
+	}
+	mp.txTable.DeleteRecord(rec.TxID)
+	return proto.OpOk
+}
+
+func (mp *metaPartition) fsmTxRollback(req *proto.TxRollbackRequest) (status uint8) {
+	mp.txTable.DeleteRecord(req.TxID)
+	return proto.OpOk
+}
@@ -0,0 +1,60 @@
+package metanode
+
+import (
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestTxCheckUpdateDentry(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+
+	file := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0600))
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	link := createTestInode(t, mp, proto.RootIno, "link", proto.Mode(os.ModeSymlink|0777))
+
+	tests := []struct {
+		name     string
+		oldInode uint64
+		mode     uint32
+		status   uint8
+	}{
+		{"file", file.Inode, proto.Mode(0644), proto.OpOk},
+		{"file", file.Inode, proto.Mode(os.ModeDir | 0600), proto.OpArgMismatchErr},
+		{"dir", dir.Inode, proto.Mode(os.ModeDir | 0700), proto.OpOk},
+		{"dir", dir.Inode, proto.Mode(0755), proto.OpArgMismatchErr},
+		{"link", link.Inode, proto.Mode(0644), proto.OpOk},
+		{"file", dir.Inode, proto.Mode(0644), proto.OpNotExistErr},
+	}
+	for _, tt := range tests {
+		op := &proto.TxOperation{
+			Type:     proto.TxOpUpdateDentry,
+			ParentID: proto.RootIno,
+			Name:     tt.name,
+			Inode:    100,
+			OldInode: tt.oldInode,
+			Mode:     tt.mode,
+		}
+		if status := mp.txCheckOperation(op); status != tt.status {
+			t.Errorf("update %v(%v) with mode %o: expected status %v but got %v", tt.name, tt.oldInode, tt.mode, tt.status, status)
+		}
+	}
+}
+
+func TestUpdateDentryType(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+
+	link := createTestInode(t, mp, proto.RootIno, "link", proto.Mode(os.ModeSymlink|0777))
+	mode := proto.Mode(0644)
+	resp := mp.fsmUpdateDentry(&Dentry{ParentId: proto.RootIno, Name: "link", Inode: 100, Type: mode})
+	if resp.Status != proto.OpOk || resp.Msg.Inode != link.Inode {
+		t.Fatalf("update dentry: status %v old %v", resp.Status, resp.Msg)
+	}
+	d, status := mp.getDentry(&Dentry{ParentId: proto.RootIno, Name: "link"})
+	if status != proto.OpOk || d.Inode != 100 || d.Type != mode {
+		t.Fatalf("expected the dentry of inode 100 mode %o but got %v", mode, d)
+	}
+}
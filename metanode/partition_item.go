@@ -117,21 +117,32 @@ type MetaItemIterator struct {
 	cur         int
 	curItem     BtreeItem
 	inoLen      int
-	inodeTree   *BTree
+	inodeTree   MetaTree
 	dentryLen   int
-	dentryTree  *BTree
+	dentryTree  MetaTree
+	txTable     []byte
+	fileLocks   []byte
+	quotaTasks  []byte
+	snapshots   []*metaSnapshot
+	snapIndex   int       // the snapshot being iterated
+	snapPhase   int       // 0: header, 1: inodes, 2: dentries
+	snapItem    BtreeItem // the last item sent of the snapshot
 	fileRootDir string
 	fileList    []string
 	total       int
 }
 
 // NewMetaItemIterator returns a new MetaItemIterator.
-func NewMetaItemIterator(applyID uint64, ino, den *BTree,
-	rootDir string, filelist []string) *MetaItemIterator {
+func NewMetaItemIterator(applyID uint64, ino, den MetaTree, txTable, fileLocks, quotaTasks []byte,
+	snapshots []*metaSnapshot, rootDir string, filelist []string) *MetaItemIterator {
 	si := new(MetaItemIterator)
 	si.applyID = applyID
 	si.inodeTree = ino
 	si.dentryTree = den
+	si.txTable = txTable
+	si.fileLocks = fileLocks
+	si.quotaTasks = quotaTasks
+	si.snapshots = snapshots
 	si.cur = 0
 	si.inoLen = ino.Len()
 	si.dentryLen = den.Len()
@@ -167,7 +178,7 @@ func (si *MetaItemIterator) Next() (data []byte, err error) {
 	if si.cur <= si.inoLen {
 		si.inodeTree.AscendGreaterOrEqual(si.curItem, func(i BtreeItem) bool {
 			ino := i.(*Inode)
-			if si.curItem == ino {
+			if si.curItem != nil && !si.curItem.Less(ino) {
 				return true
 			}
 			si.curItem = ino
@@ -187,7 +198,7 @@ func (si *MetaItemIterator) Next() (data []byte, err error) {
 	if si.cur <= si.total {
 		si.dentryTree.AscendGreaterOrEqual(si.curItem, func(i BtreeItem) bool {
 			dentry := i.(*Dentry)
-			if si.curItem == dentry {
+			if si.curItem != nil && !si.curItem.Less(dentry) {
 				return true
 			}
 			si.curItem = dentry
@@ -197,7 +208,34 @@ func (si *MetaItemIterator) Next() (data []byte, err error) {
 			si.cur++
 			return false
 		})
+		return
+	}
+
+	if si.txTable != nil {
+		snap := NewMetaItem(opTxTableSnapshot, nil, si.txTable)
+		si.txTable = nil
+		data, err = snap.MarshalBinary()
+		return
+	}
+
+	if si.fileLocks != nil {
+		snap := NewMetaItem(opLockTableSnapshot, nil, si.fileLocks)
+		si.fileLocks = nil
+		data, err = snap.MarshalBinary()
+		return
+	}
+
+	if si.quotaTasks != nil {
+		snap := NewMetaItem(opQuotaTaskSnapshot, nil, si.quotaTasks)
+		si.quotaTasks = nil
+		data, err = snap.MarshalBinary()
+		return
+	}
+
+	if si.snapIndex < len(si.snapshots) {
+		return si.nextSnapshotItem()
 	}
+
 	if len(si.fileList) == 0 {
 		err = io.EOF
 		data = nil
@@ -212,8 +250,56 @@ func (si *MetaItemIterator) Next() (data []byte, err error) {
 	}
 	snap := NewMetaItem(opExtentFileSnapshot, []byte(fileName), fileBody)
 	data, err = snap.MarshalBinary()
-	if err != nil {
+	if err == nil {
 		si.fileList = si.fileList[1:]
 	}
 	return
 }
+
+// Returns the next item of the volume snapshots. Each snapshot is sent as a header
+// followed by its inodes and dentries, which are keyed by the snapshot ID.
+func (si *MetaItemIterator) nextSnapshotItem() (data []byte, err error) {
+	for si.snapIndex < len(si.snapshots) {
+		s := si.snapshots[si.snapIndex]
+		idBuf := make([]byte, 8)
+		binary.BigEndian.PutUint64(idBuf, s.id)
+		if si.snapPhase == 0 {
+			si.snapPhase++
+			si.snapItem = nil
+			return NewMetaItem(opFSMCreateSnapshot, idBuf, nil).MarshalBinary()
+		}
+		tree, op := s.inodeTree, opMetaSnapshotInode
+		if si.snapPhase == 2 {
+			tree, op = s.dentryTree, opMetaSnapshotDentry
+		}
+		var next BtreeItem
+		tree.AscendGreaterOrEqual(si.snapItem, func(i BtreeItem) bool {
+			if si.snapItem != nil && !si.snapItem.Less(i) {
+				return true
+			}
+			next = i
+			return false
+		})
+		if next == nil {
+			si.snapItem = nil
+			if si.snapPhase++; si.snapPhase > 2 {
+				si.snapPhase = 0
+				si.snapIndex++
+			}
+			continue
+		}
+		si.snapItem = next
+		var val []byte
+		switch item := next.(type) {
+		case *Inode:
+			val, err = item.Marshal()
+		case *Dentry:
+			val, err = item.Marshal()
+		}
+		if err != nil {
+			return
+		}
+		return NewMetaItem(op, idBuf, val).MarshalBinary()
+	}
+	return si.Next()
+}
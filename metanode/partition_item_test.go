@@ -0,0 +1,45 @@
+package metanode
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMetaItemIteratorExtentFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metanode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := []string{"extent_1", "extent_2"}
+	for _, name := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	si := NewMetaItemIterator(7, NewBtree(), NewBtree(), nil, nil, nil, nil, dir, files)
+	if _, err = si.Next(); err != nil {
+		t.Fatalf("apply id: %v", err)
+	}
+	// Every file is sent once, and the iterator ends after the last one.
+	for _, name := range files {
+		data, err := si.Next()
+		if err != nil {
+			t.Fatalf("file %v: %v", name, err)
+		}
+		item := new(MetaItem)
+		if err = item.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if item.Op != opExtentFileSnapshot || string(item.K) != name || string(item.V) != name {
+			t.Fatalf("file %v: got op %v key %q value %q", name, item.Op, item.K, item.V)
+		}
+	}
+	if _, err = si.Next(); err != io.EOF {
+		t.Fatalf("after the last file: got %v, want EOF", err)
+	}
+}
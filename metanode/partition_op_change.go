@@ -0,0 +1,49 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const (
+	// the default and the maximum number of the changes read in a request
+	defaultReadChangesLimit = 1024
+	maxReadChangesLimit     = 8192
+)
+
+// ReadChanges returns the changes applied after the apply ID of the request from the change log.
+func (mp *metaPartition) ReadChanges(req *proto.ReadMetaChangesRequest, p *Packet) (err error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultReadChangesLimit
+	} else if limit > maxReadChangesLimit {
+		limit = maxReadChangesLimit
+	}
+	resp := &proto.ReadMetaChangesResponse{ApplyID: mp.GetApplyID()}
+	if resp.Changes, resp.Truncated, err = mp.changeLog.Read(req.From, limit); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
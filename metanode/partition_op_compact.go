@@ -0,0 +1,103 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// The first host of a data partition compacts its tiny extents by rewriting the data of the cold files
+// into new extents. It lists the keys referencing the tiny extents from all the meta partitions of the
+// volume, and then asks the partitions to replace the keys, each only if the inode still has the same
+// key at its file offset and the same generation. An overwrite in place keeps the key but bumps the
+// generation, so the relocation is refused instead of losing the data overwritten during the copy.
+// The regions of the replaced keys are deleted from the tiny extents as usual.
+
+// GetExtentRefs returns the extent keys of the inodes and the snapshots referencing the tiny extents.
+func (mp *metaPartition) GetExtentRefs(req *proto.GetExtentRefsRequest, p *Packet) (err error) {
+	match := func(ek *proto.ExtentKey) bool {
+		return ek.PartitionId == req.DataPartitionID && storage.IsTinyExtent(ek.ExtentId) &&
+			(req.ExtentID == 0 || ek.ExtentId == req.ExtentID)
+	}
+	resp := &proto.GetExtentRefsResponse{}
+	live := make(map[uint64]*Inode)
+	mp.getInodeTree().Ascend(func(item BtreeItem) bool {
+		ino := item.(*Inode)
+		ino.RLock()
+		ino.Extents.Range(func(item BtreeItem) bool {
+			if ek := item.(*proto.ExtentKey); match(ek) {
+				live[ino.Inode] = ino
+				resp.Refs = append(resp.Refs, &proto.ExtentRef{Inode: ino.Inode, Generation: ino.Generation, ModifyTime: ino.ModifyTime, Key: *ek})
+			}
+			return true
+		})
+		ino.RUnlock()
+		return true
+	})
+	for _, s := range mp.getSnapshots() {
+		s.inodeTree.Ascend(func(item BtreeItem) bool {
+			ino := item.(*Inode)
+			ino.Extents.Range(func(item BtreeItem) bool {
+				ek := item.(*proto.ExtentKey)
+				if !match(ek) {
+					return true
+				}
+				if i, ok := live[ino.Inode]; ok && i.Extents.Referenced(ek) {
+					return true
+				}
+				resp.Refs = append(resp.Refs, &proto.ExtentRef{Inode: ino.Inode, ModifyTime: ino.ModifyTime, Key: *ek, Snapshot: true})
+				return true
+			})
+			return true
+		})
+	}
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// RelocateExtents replaces the extent keys of the inodes with the relocated ones.
+func (mp *metaPartition) RelocateExtents(req *proto.RelocateExtentsRequest, p *Packet) (err error) {
+	for _, r := range req.Relocations {
+		if r.Old.FileOffset != r.New.FileOffset || r.Old.Size != r.New.Size || !storage.IsTinyExtent(r.Old.ExtentId) {
+			p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+			return
+		}
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMRelocateExtents, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	reply, err := json.Marshal(resp.(*proto.RelocateExtentsResponse))
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
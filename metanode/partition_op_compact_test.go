@@ -0,0 +1,169 @@
+package metanode
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Returns the extent key deleted by the partition if any.
+func deletedExtent(mp *metaPartition) *proto.ExtentKey {
+	select {
+	case item := <-mp.extDelCh:
+		return item.(*proto.ExtentKey)
+	default:
+		return nil
+	}
+}
+
+// The keys of a file are replaced only if the file is not changed since they are listed.
+func TestRelocateExtents(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	keys := []proto.ExtentKey{
+		{FileOffset: 0, PartitionId: 1, ExtentId: 1, ExtentOffset: 4096, Size: 100},
+		{FileOffset: 100, PartitionId: 1, ExtentId: 2, ExtentOffset: 8192, Size: 100},
+	}
+	ino.AppendExtents([]BtreeItem{&keys[0], &keys[1]}, time.Now().Unix())
+	relocations := func(gen uint64) []*proto.ExtentRelocation {
+		rs := make([]*proto.ExtentRelocation, 0, len(keys))
+		offset := uint64(0)
+		for _, k := range keys {
+			newKey := k
+			newKey.ExtentId, newKey.ExtentOffset = 1024, offset
+			offset += uint64(k.Size)
+			rs = append(rs, &proto.ExtentRelocation{Inode: ino.Inode, Generation: gen, Old: k, New: newKey})
+		}
+		return rs
+	}
+
+	// the file is overwritten in place after the keys are listed, which keeps the keys
+	req := &proto.RelocateExtentsRequest{Relocations: relocations(ino.Generation)}
+	mp.fsmOverwriteExtents(NewInode(ino.Inode, 0))
+	resp := mp.fsmRelocateExtents(req)
+	if resp.Replaced[0] || resp.Replaced[1] {
+		t.Fatalf("expect the relocations of an overwritten file to be refused, got %v", resp.Replaced)
+	}
+	if got := extentKeysOf(ino); got[0] != keys[0] || got[1] != keys[1] {
+		t.Fatalf("expect the keys to be kept, got %v", got)
+	}
+	if ek := deletedExtent(mp); ek != nil {
+		t.Fatalf("expect nothing to be deleted, got %v", ek)
+	}
+
+	// all the keys of the file are replaced, though each bumps the generation
+	gen := ino.Generation
+	resp = mp.fsmRelocateExtents(&proto.RelocateExtentsRequest{Relocations: relocations(gen)})
+	if !resp.Replaced[0] || !resp.Replaced[1] {
+		t.Fatalf("expect the keys to be replaced, got %v", resp.Replaced)
+	}
+	got := extentKeysOf(ino)
+	if got[0].ExtentId != 1024 || got[0].ExtentOffset != 0 || got[1].ExtentId != 1024 || got[1].ExtentOffset != 100 {
+		t.Fatalf("expect the keys of the new extent, got %v", got)
+	}
+	if ino.Generation != gen+2 {
+		t.Fatalf("expect the generation to be bumped by each key, got %v from %v", ino.Generation, gen)
+	}
+	for _, k := range keys {
+		if ek := deletedExtent(mp); ek == nil || *ek != k {
+			t.Fatalf("expect the old key %v to be deleted, got %v", k, ek)
+		}
+	}
+
+	// the keys have been replaced by the earlier request
+	resp = mp.fsmRelocateExtents(&proto.RelocateExtentsRequest{Relocations: relocations(0)})
+	if resp.Replaced[0] || resp.Replaced[1] {
+		t.Fatalf("expect the relocations of the changed keys to be refused, got %v", resp.Replaced)
+	}
+}
+
+// The requests logged before the generation is recorded are checked by the keys only.
+func TestRelocateExtentsWithoutGeneration(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	old := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1, ExtentOffset: 4096, Size: 100}
+	ino.AppendExtents([]BtreeItem{&old}, time.Now().Unix())
+	newKey := old
+	newKey.ExtentId, newKey.ExtentOffset = 1024, 0
+	resp := mp.fsmRelocateExtents(&proto.RelocateExtentsRequest{
+		Relocations: []*proto.ExtentRelocation{{Inode: ino.Inode, Old: old, New: newKey}},
+	})
+	if !resp.Replaced[0] {
+		t.Fatalf("expect the key to be replaced")
+	}
+	if got := extentKeysOf(ino); len(got) != 1 || got[0] != newKey {
+		t.Fatalf("expect the new key, got %v", got)
+	}
+}
+
+// The old key of a relocated file is kept for the snapshots referencing it.
+func TestRelocateExtentsInSnapshot(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	old := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1, ExtentOffset: 4096, Size: 100}
+	ino.AppendExtents([]BtreeItem{&old}, time.Now().Unix())
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+
+	newKey := old
+	newKey.ExtentId, newKey.ExtentOffset = 1024, 0
+	resp := mp.fsmRelocateExtents(&proto.RelocateExtentsRequest{
+		Relocations: []*proto.ExtentRelocation{{Inode: ino.Inode, Generation: ino.Generation, Old: old, New: newKey}},
+	})
+	if !resp.Replaced[0] {
+		t.Fatalf("expect the key to be replaced")
+	}
+	if ek := deletedExtent(mp); ek != nil {
+		t.Fatalf("expect the key referenced by the snapshot to be kept, got %v", ek)
+	}
+	if got := extentKeysOf(mp.inodeTree.Get(ino).(*Inode)); len(got) != 1 || got[0] != newKey {
+		t.Fatalf("expect the new key, got %v", got)
+	}
+	snap := mp.getSnapshotInode(1, NewInode(ino.Inode, 0))
+	if got := extentKeysOf(snap.Msg); len(got) != 1 || got[0] != old {
+		t.Fatalf("expect the snapshot to keep the old key, got %v", got)
+	}
+}
+
+// The keys of the tiny extents are listed with the generations of the inodes, and the keys only
+// referenced by the snapshots are marked, so that their ranges are not punched.
+func TestGetExtentRefs(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	tiny := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1, ExtentOffset: 0, Size: 100}
+	normal := proto.ExtentKey{FileOffset: 100, PartitionId: 1, ExtentId: 1024, Size: 100}
+	other := proto.ExtentKey{FileOffset: 200, PartitionId: 2, ExtentId: 1, Size: 100}
+	ino.AppendExtents([]BtreeItem{&tiny, &normal, &other}, time.Now().Unix())
+	mp.fsmCreateSnapshot(&proto.MetaSnapshotRequest{SnapshotID: 1})
+	// the tiny key is overwritten after the snapshot, which keeps the old one
+	overwritten := proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 2, ExtentOffset: 0, Size: 100}
+	update := NewInode(ino.Inode, 0)
+	update.Extents.Append(&overwritten)
+	mp.fsmAppendExtents(update)
+	ino = mp.inodeTree.Get(ino).(*Inode)
+
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaGetExtentRefs)
+	mp.GetExtentRefs(&proto.GetExtentRefsRequest{PartitionID: mp.config.PartitionId, DataPartitionID: 1}, p)
+	if p.ResultCode != proto.OpOk {
+		t.Fatalf("expect the refs, got status %v", p.ResultCode)
+	}
+	resp := new(proto.GetExtentRefsResponse)
+	if err := json.Unmarshal(p.Data, resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Refs) != 2 {
+		t.Fatalf("expect the refs of the tiny extents of the data partition, got %v", resp.Refs)
+	}
+	live, snap := resp.Refs[0], resp.Refs[1]
+	if live.Key != overwritten || live.Snapshot || live.Inode != ino.Inode || live.Generation != ino.Generation {
+		t.Fatalf("expect the live key with the generation %v, got %+v", ino.Generation, live)
+	}
+	if snap.Key != tiny || !snap.Snapshot {
+		t.Fatalf("expect the key referenced by the snapshot only, got %+v", snap)
+	}
+}
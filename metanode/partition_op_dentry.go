@@ -38,12 +38,22 @@ func (mp *metaPartition) CreateDentry(req *CreateDentryReq, p *Packet) (err erro
 	if err != nil {
 		return
 	}
-	resp, err := mp.Put(opFSMCreateDentry, val)
+	op := opFSMCreateDentry
+	if req.Shard {
+		op = opFSMCreateShardDentry
+	} else {
+		// clears the expired mark of the parent being removed if any
+		mp.isDirRemoving(req.ParentID)
+	}
+	resp, err := mp.Put(op, val)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
 		return
 	}
 	p.ResultCode = resp.(uint8)
+	if p.ResultCode == proto.OpDirShardErr {
+		mp.dirShardErr(req.ParentID, p)
+	}
 	return
 }
 
@@ -53,6 +63,12 @@ func (mp *metaPartition) DeleteDentry(req *DeleteDentryReq, p *Packet) (err erro
 		ParentId: req.ParentID,
 		Name:     req.Name,
 	}
+	if mp.isDirShardReq(req.ParentID, req.Name, req.Shards) {
+		if _, status := mp.getDentry(dentry); status != proto.OpOk {
+			mp.dirShardErr(req.ParentID, p)
+			return
+		}
+	}
 	val, err := dentry.Marshal()
 	if err != nil {
 		p.ResultCode = proto.OpErr
@@ -115,7 +131,15 @@ func (mp *metaPartition) UpdateDentry(req *UpdateDentryReq, p *Packet) (err erro
 
 // ReadDir reads the directory based on the given request.
 func (mp *metaPartition) ReadDir(req *ReadDirReq, p *Packet) (err error) {
-	resp := mp.readDir(req)
+	if req.SnapshotID == 0 && mp.isDirShardReq(req.ParentID, "", req.Shards) {
+		mp.dirShardErr(req.ParentID, p)
+		return
+	}
+	resp, status := mp.readDir(req)
+	if status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
 	reply, err := json.Marshal(resp)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpErr, nil)
@@ -131,7 +155,18 @@ func (mp *metaPartition) Lookup(req *LookupReq, p *Packet) (err error) {
 		ParentId: req.ParentID,
 		Name:     req.Name,
 	}
-	dentry, status := mp.getDentry(dentry)
+	dentry, status := mp.getSnapshotDentry(req.SnapshotID, dentry)
+	if status == proto.OpNotExistErr && req.SnapshotID == 0 {
+		if mp.isDirShardReq(req.ParentID, req.Name, req.Shards) {
+			mp.dirShardErr(req.ParentID, p)
+			return
+		}
+		// the client which has created the dentry in another shard checks whether the parent is being removed
+		if req.Shards && mp.isDirRemoving(req.ParentID) {
+			p.PacketErrorWithBody(proto.OpAgain, nil)
+			return
+		}
+	}
 	var reply []byte
 	if status == proto.OpOk {
 		resp := &LookupResp{
@@ -148,6 +183,6 @@ func (mp *metaPartition) Lookup(req *LookupReq, p *Packet) (err error) {
 }
 
 // GetDentryTree returns the dentry tree stored in the meta partition.
-func (mp *metaPartition) GetDentryTree() *BTree {
+func (mp *metaPartition) GetDentryTree() MetaTree {
 	return mp.dentryTree.GetTree()
 }
@@ -0,0 +1,199 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A directory is split on the admin task of the master, which records the shards in the reserved
+// extended attribute of the directory inode. The partition of the inode then rejects the requests of
+// the clients unaware of the split for the dentries belonging to the other shards, and replies the
+// shards along with OpDirShardErr. The dentries in the other shards are created without the parent inode.
+//
+// A sharded directory is removed only if it has no entries in any of the shards, which the partitions
+// of the shards cannot check against the concurrent creations on their own. So the client removing it
+// marks it as being removed in the partition of the inode first, after which the entries are not
+// created in that partition, and the client creating an entry in another shard checks the mark after
+// the entry is created. Either the creation or the removal then fails. The mark left by a client failed
+// during the removal expires after dirRemovingTimeout.
+
+const dirRemovingTimeout = time.Minute
+
+type dirRemovingReq struct {
+	Inode    uint64 `json:"ino"`
+	Removing bool   `json:"removing"`
+	Time     int64  `json:"time"`
+}
+
+// SplitDir splits the directory into the shards.
+func (mp *metaPartition) SplitDir(req *proto.SplitDirRequest, p *Packet) (err error) {
+	if len(req.PartitionIDs) < 2 || req.PartitionIDs[0] != mp.config.PartitionId {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMSplitDir, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	if status := resp.(uint8); status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	// the directory keeps the shards of an earlier split if any, which the master records instead
+	reply, err := json.Marshal(&proto.DirShardInfo{Inode: req.Inode, PartitionIDs: mp.getDirShards(req.Inode)})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// MarkDirRemoving marks the sharded directory as being removed, or clears the mark. The shards are
+// replied along with the mark, since the client removing the directory may not be aware of them.
+func (mp *metaPartition) MarkDirRemoving(req *proto.MarkDirRemovingRequest, p *Packet) (err error) {
+	// the directories not split are removed as usual
+	if req.Removing && len(mp.getDirShards(req.Inode)) == 0 {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	status, err := mp.putDirRemoving(req.Inode, req.Removing)
+	if err != nil {
+		p.PacketErrorWithBody(status, []byte(err.Error()))
+		return
+	}
+	if status != proto.OpOk || !req.Removing {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	reply, err := json.Marshal(&proto.DirShardInfo{Inode: req.Inode, PartitionIDs: mp.getDirShards(req.Inode)})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+func (mp *metaPartition) putDirRemoving(ino uint64, removing bool) (status uint8, err error) {
+	val, err := json.Marshal(&dirRemovingReq{Inode: ino, Removing: removing, Time: Now.GetCurrentTime().Unix()})
+	if err != nil {
+		return proto.OpErr, err
+	}
+	resp, err := mp.Put(opFSMMarkDirRemoving, val)
+	if err != nil {
+		return proto.OpAgain, err
+	}
+	return resp.(uint8), nil
+}
+
+// isDirRemoving returns whether the directory in the partition is being removed, or removed already.
+// The expired mark is cleared, so that the entries are created in the directory again.
+func (mp *metaPartition) isDirRemoving(ino uint64) bool {
+	if ino < mp.config.Start || ino > mp.config.End {
+		return false
+	}
+	item := mp.inodeTree.Get(NewInode(ino, 0))
+	if item == nil || item.(*Inode).ShouldDelete() {
+		return true
+	}
+	val, ok := item.(*Inode).GetXAttr(proto.DirRemovingXAttr)
+	if !ok {
+		return false
+	}
+	marked, _ := strconv.ParseInt(string(val), 10, 64)
+	if Now.GetCurrentTime().Unix()-marked < int64(dirRemovingTimeout/time.Second) {
+		return true
+	}
+	if _, err := mp.putDirRemoving(ino, false); err != nil {
+		log.LogWarnf("isDirRemoving: partition(%v) clear the mark of dir(%v) err(%v)", mp.config.PartitionId, ino, err)
+	}
+	return false
+}
+
+// getDirShards returns the partitions of the shards of the directory in this partition.
+func (mp *metaPartition) getDirShards(ino uint64) (pids []uint64) {
+	item := mp.inodeTree.Get(NewInode(ino, 0))
+	if item == nil {
+		return
+	}
+	val, ok := item.(*Inode).GetXAttr(proto.DirShardXAttr)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(val, &pids); err != nil {
+		return nil
+	}
+	return
+}
+
+// isDirShardReq returns true if the request of the client not aware of the shards of the parent is
+// for a dentry which does not belong to the partition. Any name is checked if it is empty.
+func (mp *metaPartition) isDirShardReq(parentID uint64, name string, shards bool) bool {
+	if shards {
+		return false
+	}
+	pids := mp.getDirShards(parentID)
+	if len(pids) < 2 {
+		return false
+	}
+	return name == "" || proto.DirShardPartition(pids, parentID, name) != mp.config.PartitionId
+}
+
+// dirShardErr rejects the request with the shards of the parent, so that the client can retry it
+// in the shard without asking the master.
+func (mp *metaPartition) dirShardErr(parentID uint64, p *Packet) {
+	reply, _ := json.Marshal(&proto.DirShardInfo{Inode: parentID, PartitionIDs: mp.getDirShards(parentID)})
+	p.PacketErrorWithBody(proto.OpDirShardErr, reply)
+}
+
+// GetLargeDirs returns the directories with more entries than the threshold, which are not split yet.
+func (mp *metaPartition) GetLargeDirs() (dirs []uint64) {
+	mp.largeDirs.Range(func(key, value interface{}) bool {
+		ino := key.(uint64)
+		item := mp.inodeTree.Get(NewInode(ino, 0))
+		if item == nil || !mp.isLargeDir(item.(*Inode)) {
+			mp.largeDirs.Delete(ino)
+			return true
+		}
+		dirs = append(dirs, ino)
+		return true
+	})
+	return
+}
+
+func (mp *metaPartition) isLargeDir(dir *Inode) bool {
+	if dirShardThreshold == 0 || dir.ShouldDelete() || uint64(dir.GetNLink()) < dirShardThreshold {
+		return false
+	}
+	if _, ok := dir.GetXAttr(proto.DirShardXAttr); ok {
+		return false
+	}
+	// the entries of the trash are purged by the partition, so they must be kept together
+	trashIno, status := mp.getTrashDir()
+	return status != proto.OpOk || trashIno != dir.Inode
+}
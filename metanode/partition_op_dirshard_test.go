@@ -0,0 +1,196 @@
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// Returns a name with the prefix in the directory which belongs to the shard in the partition.
+func testShardName(t *testing.T, pids []uint64, parentID, pid uint64, prefix string) string {
+	for i := 0; i < 1000; i++ {
+		if name := fmt.Sprintf("%v%v", prefix, i); proto.DirShardPartition(pids, parentID, name) == pid {
+			return name
+		}
+	}
+	t.Fatalf("no name of shard %v", pid)
+	return ""
+}
+
+func splitTestDir(t *testing.T, mp *metaPartition, ino uint64, pids []uint64) {
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSplitDir)
+	if mp.SplitDir(&proto.SplitDirRequest{Inode: ino, PartitionIDs: pids}, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("split dir: status %v", p.ResultCode)
+	}
+}
+
+// Checks the reply to carry the status and the shards of the directory.
+func checkDirShardReply(t *testing.T, p *Packet, status uint8, ino uint64, pids []uint64) {
+	t.Helper()
+	if p.ResultCode != status {
+		t.Fatalf("expect status %v, got %v", status, p.ResultCode)
+	}
+	info := new(proto.DirShardInfo)
+	if err := json.Unmarshal(p.Data, info); err != nil {
+		t.Fatalf("unmarshal %q: %v", p.Data, err)
+	}
+	if info.Inode != ino || !reflect.DeepEqual(info.PartitionIDs, pids) {
+		t.Fatalf("expect the shards %v of dir %v, got %v", pids, ino, info)
+	}
+}
+
+func TestSplitDirReply(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSplitDir)
+	if mp.SplitDir(&proto.SplitDirRequest{Inode: dir.Inode, PartitionIDs: []uint64{2, 1}}, p); p.ResultCode != proto.OpArgMismatchErr {
+		t.Fatalf("expect the shards not starting with the partition to be rejected, got status %v", p.ResultCode)
+	}
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaSplitDir)
+	mp.SplitDir(&proto.SplitDirRequest{Inode: dir.Inode, PartitionIDs: []uint64{1, 2}}, p)
+	checkDirShardReply(t, p, proto.OpOk, dir.Inode, []uint64{1, 2})
+
+	// the retried split keeps the shards, which the master records instead of its own
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaSplitDir)
+	mp.SplitDir(&proto.SplitDirRequest{Inode: dir.Inode, PartitionIDs: []uint64{1, 3, 4}}, p)
+	checkDirShardReply(t, p, proto.OpOk, dir.Inode, []uint64{1, 2})
+}
+
+// The partition of the directory inode rejects the requests of the clients unaware of the shards
+// along with the shards, except for the dentries created before the split.
+func TestDirShardErr(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	pids := []uint64{1, 2}
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	remote := testShardName(t, pids, dir.Inode, 2, "f")
+	local := testShardName(t, pids, dir.Inode, 1, "f")
+	old := testShardName(t, pids, dir.Inode, 2, "old")
+	createTestInode(t, mp, dir.Inode, old, proto.Mode(0644))
+	splitTestDir(t, mp, dir.Inode, pids)
+
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaCreateDentry)
+	mp.CreateDentry(&CreateDentryReq{ParentID: dir.Inode, Name: remote, Inode: 1000, Mode: proto.Mode(0644)}, p)
+	checkDirShardReply(t, p, proto.OpDirShardErr, dir.Inode, pids)
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaCreateDentry)
+	if mp.CreateDentry(&CreateDentryReq{ParentID: dir.Inode, Name: local, Inode: 1000, Mode: proto.Mode(0644)}, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("create the dentry of the partition: status %v", p.ResultCode)
+	}
+
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaLookup)
+	mp.Lookup(&LookupReq{ParentID: dir.Inode, Name: remote}, p)
+	checkDirShardReply(t, p, proto.OpDirShardErr, dir.Inode, pids)
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaLookup)
+	if mp.Lookup(&LookupReq{ParentID: dir.Inode, Name: remote, Shards: true}, p); p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("expect no dentry for the client aware of the shards, got status %v", p.ResultCode)
+	}
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaLookup)
+	if mp.Lookup(&LookupReq{ParentID: dir.Inode, Name: old}, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("expect the dentry created before the split, got status %v", p.ResultCode)
+	}
+
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaReadDir)
+	mp.ReadDir(&ReadDirReq{ParentID: dir.Inode}, p)
+	checkDirShardReply(t, p, proto.OpDirShardErr, dir.Inode, pids)
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaReadDir)
+	if mp.ReadDir(&ReadDirReq{ParentID: dir.Inode, Shards: true}, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("read dir: status %v", p.ResultCode)
+	}
+
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaDeleteDentry)
+	mp.DeleteDentry(&DeleteDentryReq{ParentID: dir.Inode, Name: remote}, p)
+	checkDirShardReply(t, p, proto.OpDirShardErr, dir.Inode, pids)
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaDeleteDentry)
+	if mp.DeleteDentry(&DeleteDentryReq{ParentID: dir.Inode, Name: old}, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("delete the dentry created before the split: status %v", p.ResultCode)
+	}
+}
+
+// No dentries are created in the partition of the directory being removed, and the clients which
+// have created the dentries in the other shards are told so.
+func TestMarkDirRemoving(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	pids := []uint64{1, 2}
+	dirMode := proto.Mode(os.ModeDir | 0755)
+	plain := createTestInode(t, mp, proto.RootIno, "plain", dirMode)
+	dir := createTestInode(t, mp, proto.RootIno, "dir", dirMode)
+	remote := testShardName(t, pids, dir.Inode, 2, "f")
+	local := testShardName(t, pids, dir.Inode, 1, "f")
+	createTestInode(t, mp, dir.Inode, local, proto.Mode(0644))
+	splitTestDir(t, mp, dir.Inode, pids)
+
+	mark := func(ino uint64, removing bool) *Packet {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaMarkDirRemoving)
+		mp.MarkDirRemoving(&proto.MarkDirRemovingRequest{Inode: ino, Removing: removing}, p)
+		return p
+	}
+	create := func(name string) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaCreateDentry)
+		mp.CreateDentry(&CreateDentryReq{ParentID: dir.Inode, Name: name, Inode: 1000, Mode: proto.Mode(0644)}, p)
+		return p.ResultCode
+	}
+	lookup := func(name string) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaLookup)
+		mp.Lookup(&LookupReq{ParentID: dir.Inode, Name: name, Shards: true}, p)
+		return p.ResultCode
+	}
+
+	if p := mark(plain.Inode, true); p.ResultCode != proto.OpArgMismatchErr {
+		t.Fatalf("expect the dir not split to be rejected, got status %v", p.ResultCode)
+	}
+	if p := mark(dir.Inode, true); p.ResultCode != proto.OpNotEmtpy {
+		t.Fatalf("expect the dir with entries to be rejected, got status %v", p.ResultCode)
+	}
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: dir.Inode, Name: local}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	checkDirShardReply(t, mark(dir.Inode, true), proto.OpOk, dir.Inode, pids)
+	if status := create(local); status != proto.OpAgain {
+		t.Fatalf("expect the creation to be retried, got status %v", status)
+	}
+	if status := lookup(remote); status != proto.OpAgain {
+		t.Fatalf("expect the dentry of the other shard to be undone, got status %v", status)
+	}
+
+	// the removal failed, the dir is usable again
+	if p := mark(dir.Inode, false); p.ResultCode != proto.OpOk {
+		t.Fatalf("clear the mark: status %v", p.ResultCode)
+	}
+	if status := lookup(remote); status != proto.OpNotExistErr {
+		t.Fatalf("expect the dentry of the other shard to be kept, got status %v", status)
+	}
+	if status := create(local); status != proto.OpOk {
+		t.Fatalf("create dentry: status %v", status)
+	}
+
+	// the mark left by a failed client expires
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: dir.Inode, Name: local}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	mark(dir.Inode, true)
+	expired := Now.GetCurrentTime().Add(-dirRemovingTimeout).Unix()
+	mp.inodeTree.Get(dir).(*Inode).SetXAttr(proto.DirRemovingXAttr, []byte(strconv.FormatInt(expired, 10)))
+	if status := create(local); status != proto.OpOk {
+		t.Fatalf("expect the expired mark to be cleared, got status %v", status)
+	}
+	if _, ok := mp.inodeTree.Get(dir).(*Inode).GetXAttr(proto.DirRemovingXAttr); ok {
+		t.Fatalf("expect no mark")
+	}
+
+	// the removed dir has no entries
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: dir.Inode, Name: local}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	mp.inodeTree.Delete(dir)
+	if status := lookup(remote); status != proto.OpAgain {
+		t.Fatalf("expect the dentry of the removed dir to be undone, got status %v", status)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The leader of a partition of a volume with the erasure code enabled converts the extents of the files
+// not modified for the days of the policy. The first host of an erasure-coded data partition copies the
+// extent from the replicas and writes the shards, and then the keys of the file are replaced in raft, unless
+// the file has been changed since the extent was chosen, including the overwrites in place recorded by the
+// clients, which bump the generation of the inode as well.
+
+const (
+	ecConvertInterval = time.Hour
+	// the maximum number of the extents converted in a round
+	ecConvertBatchCount = 128
+	// the deadline to wait for the conversion of an extent
+	ecConvertDeadlineTime = 600
+)
+
+// EcConvertExtentReq defines the request to replace the keys of an extent with the erasure-coded one.
+type EcConvertExtentReq struct {
+	Inode          uint64 `json:"ino"`
+	SrcPartitionID uint64 `json:"src_pid"`
+	SrcExtentID    uint64 `json:"src_eid"`
+	DstPartitionID uint64 `json:"dst_pid"`
+	DstExtentID    uint64 `json:"dst_eid"`
+	Size           uint64 `json:"size"`
+	Generation     uint64 `json:"gen"` // the generation of the inode when the extent was chosen
+}
+
+type ecCandidate struct {
+	inode       uint64
+	generation  uint64
+	partitionID uint64
+	extentID    uint64
+	size        uint64
+}
+
+// ecWorker converts the cold extents on the leader of the partition.
+func (mp *metaPartition) ecWorker() {
+	t := time.NewTicker(ecConvertInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-t.C:
+			if _, ok := mp.IsLeader(); !ok {
+				continue
+			}
+			mp.convertColdExtents()
+		}
+	}
+}
+
+func (mp *metaPartition) convertColdExtents() {
+	migrateDays, err := mp.getEcMigrateDays()
+	if err != nil {
+		log.LogWarnf("convertColdExtents: partition(%v) err(%v)", mp.config.PartitionId, err)
+		return
+	}
+	if migrateDays == 0 {
+		return
+	}
+	ecPartitions := mp.vol.EcPartitions()
+	if len(ecPartitions) == 0 {
+		return
+	}
+	deadline := time.Now().Add(-time.Duration(migrateDays) * 24 * time.Hour).Unix()
+	// the generations of the files bumped by the extents converted in this round
+	converted := make(map[uint64]uint64)
+	for _, c := range mp.coldExtents(deadline) {
+		if _, ok := mp.IsLeader(); !ok {
+			return
+		}
+		if gen, ok := converted[c.inode]; ok {
+			c.generation = gen
+		}
+		dst := ecPartitions[rand.Intn(len(ecPartitions))]
+		if err = mp.ecConvertExtent(c, dst); err != nil {
+			log.LogWarnf("convertColdExtents: partition(%v) ino(%v) extent(%v_%v) err(%v)",
+				mp.config.PartitionId, c.inode, c.partitionID, c.extentID, err)
+			continue
+		}
+		converted[c.inode] = c.generation + 1
+	}
+}
+
+// Returns the extents of the files not modified since the deadline, which are still in the replicated
+// data partitions. The tiny extents are shared by the files, so they are never converted.
+func (mp *metaPartition) coldExtents(deadline int64) (candidates []*ecCandidate) {
+	mp.getInodeTree().Ascend(func(item BtreeItem) bool {
+		ino := item.(*Inode)
+		ino.RLock()
+		defer ino.RUnlock()
+		if !proto.IsRegular(ino.Type) || ino.ShouldDelete() || ino.ModifyTime > deadline {
+			return true
+		}
+		extents := make(map[[2]uint64]*ecCandidate)
+		ino.Extents.Range(func(item BtreeItem) bool {
+			ek := item.(*proto.ExtentKey)
+			if storage.IsTinyExtent(ek.ExtentId) {
+				return true
+			}
+			if dp := mp.vol.GetPartition(ek.PartitionId); dp == nil || dp.IsEc() {
+				return true
+			}
+			key := [2]uint64{ek.PartitionId, ek.ExtentId}
+			c, ok := extents[key]
+			if !ok {
+				c = &ecCandidate{inode: ino.Inode, generation: ino.Generation, partitionID: ek.PartitionId, extentID: ek.ExtentId}
+				extents[key] = c
+				candidates = append(candidates, c)
+			}
+			if end := ek.ExtentOffset + uint64(ek.Size); end > c.size {
+				c.size = end
+			}
+			return true
+		})
+		return len(candidates) < ecConvertBatchCount
+	})
+	return
+}
+
+// Ask the erasure-coded data partition to convert the extent, and then replace the keys of the file.
+func (mp *metaPartition) ecConvertExtent(c *ecCandidate, dst *DataPartition) (err error) {
+	src := mp.vol.GetPartition(c.partitionID)
+	if src == nil {
+		return fmt.Errorf("unknown data partition(%v)", c.partitionID)
+	}
+	shardNum := int(dst.EcDataNum) + int(dst.EcParityNum)
+	if len(dst.Hosts) < shardNum {
+		return fmt.Errorf("data partition(%v) hosts(%v) less than shards(%v)", dst.PartitionID, dst.Hosts, shardNum)
+	}
+	data, err := json.Marshal(&proto.EcConvertExtentRequest{
+		PartitionID:    dst.PartitionID,
+		Hosts:          dst.Hosts[:shardNum],
+		SrcPartitionID: src.PartitionID,
+		SrcHosts:       src.Hosts,
+		SrcExtentID:    c.extentID,
+		Size:           c.size,
+	})
+	if err != nil {
+		return
+	}
+	p := NewPacketToEcConvertExtent(dst, data)
+	conn, err := mp.config.ConnPool.GetConnect(dst.Hosts[0])
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err != nil {
+		mp.config.ConnPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	if err = p.ReadFromConn(conn, ecConvertDeadlineTime); err != nil {
+		mp.config.ConnPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	mp.config.ConnPool.PutConnect(conn, NoClosedConnect)
+	if p.ResultCode != proto.OpOk {
+		return errors.NewErrorf("%s response: %s", p.GetUniqueLogId(), p.GetResultMsg())
+	}
+	resp := &proto.EcConvertExtentResponse{}
+	if err = json.Unmarshal(p.Data[:p.Size], resp); err != nil {
+		return
+	}
+
+	val, err := json.Marshal(&EcConvertExtentReq{
+		Inode:          c.inode,
+		SrcPartitionID: c.partitionID,
+		SrcExtentID:    c.extentID,
+		DstPartitionID: dst.PartitionID,
+		DstExtentID:    resp.ExtentID,
+		Size:           c.size,
+		Generation:     c.generation,
+	})
+	if err != nil {
+		return
+	}
+	r, err := mp.Put(opFSMEcConvertExtent, val)
+	if err != nil {
+		return
+	}
+	if status := r.(uint8); status != proto.OpOk {
+		return fmt.Errorf("extent keys of ino(%v) changed during the conversion, status(%v)", c.inode, status)
+	}
+	log.LogInfof("ecConvertExtent: partition(%v) ino(%v) extent(%v_%v) converted to (%v_%v)",
+		mp.config.PartitionId, c.inode, c.partitionID, c.extentID, dst.PartitionID, resp.ExtentID)
+	return
+}
+
+func (mp *metaPartition) getEcMigrateDays() (migrateDays uint32, err error) {
+	reqURL := fmt.Sprintf("%s?name=%s", proto.AdminGetVol, mp.config.VolName)
+	respBody, err := masterHelper.Request(http.MethodGet, reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+	view := &proto.SimpleVolView{}
+	if err = json.Unmarshal(respBody, view); err != nil {
+		return
+	}
+	return view.EcMigrateDays, nil
+}
@@ -0,0 +1,82 @@
+package metanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func extentKeysOf(ino *Inode) (keys []proto.ExtentKey) {
+	ino.Extents.Range(func(item BtreeItem) bool {
+		keys = append(keys, *item.(*proto.ExtentKey))
+		return true
+	})
+	return
+}
+
+// The keys of an extent are replaced with the erasure-coded ones, unless the file is changed during the conversion.
+func TestEcConvertExtent(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	ino.AppendExtents([]BtreeItem{
+		&proto.ExtentKey{FileOffset: 0, PartitionId: 1, ExtentId: 1024, Size: 100},
+		&proto.ExtentKey{FileOffset: 100, PartitionId: 2, ExtentId: 1024, Size: 100},
+	}, time.Now().Unix())
+	gen := ino.Generation
+	req := &EcConvertExtentReq{
+		Inode:          ino.Inode,
+		SrcPartitionID: 1,
+		SrcExtentID:    1024,
+		DstPartitionID: 3,
+		DstExtentID:    2048,
+		Size:           100,
+		Generation:     gen,
+	}
+
+	// the file is overwritten in place during the conversion
+	mp.fsmOverwriteExtents(NewInode(ino.Inode, 0))
+	if status := mp.fsmEcConvertExtent(req); status != proto.OpNotExistErr {
+		t.Fatalf("expect the conversion to be aborted, got status %v", status)
+	}
+	keys := extentKeysOf(ino)
+	if len(keys) != 2 || keys[0].PartitionId != 1 || keys[0].ExtentId != 1024 {
+		t.Fatalf("expect the keys to be kept, got %v", keys)
+	}
+	select {
+	case item := <-mp.extDelCh:
+		if ek := item.(*proto.ExtentKey); ek.PartitionId != 3 || ek.ExtentId != 2048 {
+			t.Fatalf("expect the converted copy to be deleted, got %v", ek)
+		}
+	default:
+		t.Fatalf("expect the converted copy to be deleted")
+	}
+
+	// converted again from the generation chosen
+	req.Generation = ino.Generation
+	if status := mp.fsmEcConvertExtent(req); status != proto.OpOk {
+		t.Fatalf("expect the conversion to succeed, got status %v", status)
+	}
+	keys = extentKeysOf(ino)
+	if len(keys) != 2 || keys[0].PartitionId != 3 || keys[0].ExtentId != 2048 || keys[1].PartitionId != 2 {
+		t.Fatalf("expect the keys of the source extent to be replaced, got %v", keys)
+	}
+	if ino.Generation != req.Generation+1 {
+		t.Fatalf("expect the generation to be bumped by the conversion, got %v", ino.Generation)
+	}
+	select {
+	case item := <-mp.extDelCh:
+		if ek := item.(*proto.ExtentKey); ek.PartitionId != 1 || ek.ExtentId != 1024 {
+			t.Fatalf("expect the source extent to be deleted, got %v", ek)
+		}
+	default:
+		t.Fatalf("expect the source extent to be deleted")
+	}
+
+	// the requests logged before the generation is recorded
+	req.SrcPartitionID, req.DstPartitionID, req.DstExtentID, req.Generation = 2, 4, 4096, 0
+	if status := mp.fsmEcConvertExtent(req); status != proto.OpOk {
+		t.Fatalf("expect the conversion without the generation to succeed, got status %v", status)
+	}
+}
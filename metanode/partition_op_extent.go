@@ -40,10 +40,27 @@ func (mp *metaPartition) ExtentAppend(req *proto.AppendExtentKeyRequest, p *Pack
 	return
 }
 
+// ExtentsOverwrite records the in-place overwrites of the extents of the inode.
+func (mp *metaPartition) ExtentsOverwrite(req *proto.OverwriteExtentsRequest, p *Packet) (err error) {
+	ino := NewInode(req.Inode, 0)
+	val, err := ino.Marshal()
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, nil)
+		return
+	}
+	resp, err := mp.Put(opFSMExtentsOverwrite, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
+
 // ExtentsList returns the list of extents.
 func (mp *metaPartition) ExtentsList(req *proto.GetExtentsRequest, p *Packet) (err error) {
 	ino := NewInode(req.Inode, 0)
-	retMsg := mp.getInode(ino)
+	retMsg := mp.getSnapshotInode(req.SnapshotID, ino)
 	ino = retMsg.Msg
 	var (
 		reply  []byte
@@ -0,0 +1,29 @@
+package metanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestExtentsOverwrite(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	gen := ino.Generation
+
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaExtentsOverwrite)
+	mp.ExtentsOverwrite(&proto.OverwriteExtentsRequest{PartitionID: mp.config.PartitionId, Inode: ino.Inode}, p)
+	if p.ResultCode != proto.OpOk {
+		t.Fatalf("overwrite: status %v", p.ResultCode)
+	}
+	if ino.Generation != gen+1 {
+		t.Fatalf("expect generation %v, got %v", gen+1, ino.Generation)
+	}
+
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaExtentsOverwrite)
+	mp.ExtentsOverwrite(&proto.OverwriteExtentsRequest{PartitionID: mp.config.PartitionId, Inode: ino.Inode + 1}, p)
+	if p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("expect overwriting a missing inode to fail, status %v", p.ResultCode)
+	}
+}
@@ -16,6 +16,7 @@ package metanode
 
 import (
 	"encoding/json"
+	"os"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -40,6 +41,15 @@ func replyInfo(info *proto.InodeInfo, ino *Inode) bool {
 	info.CreateTime = time.Unix(ino.CreateTime, 0)
 	info.AccessTime = time.Unix(ino.AccessTime, 0)
 	info.ModifyTime = time.Unix(ino.ModifyTime, 0)
+	if len(ino.QuotaIDs) > 0 {
+		info.QuotaIDs = append([]uint32(nil), ino.QuotaIDs...)
+	}
+	if val, ok := ino.XAttrs[proto.XAttrACLAccess]; ok {
+		info.ACL = append([]byte(nil), val...)
+	}
+	if val, ok := ino.XAttrs[proto.XAttrACLDefault]; ok {
+		info.DefaultACL = append([]byte(nil), val...)
+	}
 	ino.RUnlock()
 	return true
 }
@@ -55,6 +65,13 @@ func (mp *metaPartition) CreateInode(req *CreateInoReq, p *Packet) (err error) {
 	ino.Uid = req.Uid
 	ino.Gid = req.Gid
 	ino.LinkTarget = req.Target
+	ino.QuotaIDs = req.QuotaIDs
+	if len(req.ACL) > 0 {
+		ino.SetXAttr(proto.XAttrACLAccess, req.ACL)
+	}
+	if len(req.DefaultACL) > 0 {
+		ino.SetXAttr(proto.XAttrACLDefault, req.DefaultACL)
+	}
 	val, err := ino.Marshal()
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
@@ -118,7 +135,7 @@ func (mp *metaPartition) UnlinkInode(req *UnlinkInoReq, p *Packet) (err error) {
 // InodeGet executes the inodeGet command from the client.
 func (mp *metaPartition) InodeGet(req *InodeGetReq, p *Packet) (err error) {
 	ino := NewInode(req.Inode, 0)
-	retMsg := mp.getInode(ino)
+	retMsg := mp.getSnapshotInode(req.SnapshotID, ino)
 	ino = retMsg.Msg
 	var (
 		reply  []byte
@@ -146,7 +163,7 @@ func (mp *metaPartition) InodeGetBatch(req *InodeGetReqBatch, p *Packet) (err er
 	ino := NewInode(0, 0)
 	for _, inoId := range req.Inodes {
 		ino.Inode = inoId
-		retMsg := mp.getInode(ino)
+		retMsg := mp.getSnapshotInode(req.SnapshotID, ino)
 		if retMsg.Status == proto.OpOk {
 			inoInfo := &proto.InodeInfo{}
 			if replyInfo(inoInfo, retMsg.Msg) {
@@ -216,6 +233,20 @@ func (mp *metaPartition) EvictInode(req *EvictInodeReq, p *Packet) (err error) {
 
 // SetAttr set the inode attributes.
 func (mp *metaPartition) SetAttr(reqData []byte, p *Packet) (err error) {
+	req := &SetattrRequest{}
+	if err = json.Unmarshal(reqData, req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	if status := mp.checkSetAttr(req); status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	// the setgid bit may be dropped from the mode
+	if reqData, err = json.Marshal(req); err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
 	_, err = mp.Put(opFSMSetAttr, reqData)
 	if err != nil {
 		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
@@ -225,7 +256,75 @@ func (mp *metaPartition) SetAttr(reqData []byte, p *Packet) (err error) {
 	return
 }
 
+// checkNoCaller checks a request without a caller, which is only allowed for the old clients.
+func checkNoCaller() uint8 {
+	if allowNoCaller {
+		return proto.OpOk
+	}
+	return proto.OpNotPerm
+}
+
+// checkOwner checks if the caller of a request is the owner of the inode, or root.
+func (mp *metaPartition) checkOwner(inode uint64, c *proto.Caller) uint8 {
+	if c == nil {
+		return checkNoCaller()
+	}
+	if c.IsRoot() {
+		return proto.OpOk
+	}
+	resp := mp.getInode(NewInode(inode, 0))
+	if resp.Status != proto.OpOk {
+		return resp.Status
+	}
+	resp.Msg.RLock()
+	defer resp.Msg.RUnlock()
+	if c.Uid != resp.Msg.Uid {
+		return proto.OpNotPerm
+	}
+	return proto.OpOk
+}
+
+// checkSetAttr checks the request of setattr against its caller as the client does. Only root changes the owner,
+// and the owner changes the mode, or the group to one of the caller. The setgid bit is dropped from the new mode
+// if the caller is not a member of the group. The caller is the one asserted by the client, so that this keeps
+// a client from changing the inodes of the others on behalf of its users, but not from claiming to be root.
+func (mp *metaPartition) checkSetAttr(req *SetattrRequest) uint8 {
+	c := req.Caller
+	if c == nil {
+		return checkNoCaller()
+	}
+	if c.IsRoot() {
+		return proto.OpOk
+	}
+	resp := mp.getInode(NewInode(req.Inode, 0))
+	if resp.Status != proto.OpOk {
+		return resp.Status
+	}
+	ino := resp.Msg
+	ino.RLock()
+	uid, gid, mode := ino.Uid, ino.Gid, ino.Type
+	ino.RUnlock()
+	if req.Valid&proto.AttrUid != 0 && req.Uid != uid {
+		return proto.OpNotPerm
+	}
+	if req.Valid&proto.AttrGid != 0 && req.Gid != gid {
+		if c.Uid != uid || !c.InGroup(req.Gid) {
+			return proto.OpNotPerm
+		}
+		gid = req.Gid
+	}
+	if req.Valid&proto.AttrMode != 0 && req.Mode != mode {
+		if c.Uid != uid {
+			return proto.OpNotPerm
+		}
+		if !c.InGroup(gid) {
+			req.Mode &^= proto.Mode(os.ModeSetgid)
+		}
+	}
+	return proto.OpOk
+}
+
 // GetInodeTree returns the inode tree.
-func (mp *metaPartition) GetInodeTree() *BTree {
+func (mp *metaPartition) GetInodeTree() MetaTree {
 	return mp.inodeTree.GetTree()
 }
@@ -0,0 +1,92 @@
+package metanode
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The owner and the mode of an inode are checked against the caller of setattr.
+func TestSetAttrCaller(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	owner := &proto.Caller{Uid: 1, Groups: []uint32{1, 5}}
+	other := &proto.Caller{Uid: 2, Groups: []uint32{1}}
+	setgid := proto.Mode(os.ModeSetgid | 0755)
+	tests := []struct {
+		name   string
+		caller *proto.Caller
+		valid  uint32
+		mode   uint32
+		uid    uint32
+		gid    uint32
+		status uint8
+		want   [3]uint32
+	}{
+		{"no caller chown", nil, proto.AttrUid, 0, 2, 0, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"no caller chmod", nil, proto.AttrMode, proto.Mode(0777), 0, 0, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"root chown", &proto.Caller{}, proto.AttrUid | proto.AttrGid, 0, 3, 3, proto.OpOk, [3]uint32{proto.Mode(0644), 3, 3}},
+		{"owner chown", owner, proto.AttrUid, 0, 2, 0, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"owner chown to self", owner, proto.AttrUid, 0, 1, 0, proto.OpOk, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"owner chgrp to member", owner, proto.AttrGid, 0, 0, 5, proto.OpOk, [3]uint32{proto.Mode(0644), 1, 5}},
+		{"owner chgrp to non-member", owner, proto.AttrGid, 0, 0, 6, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"other chgrp", other, proto.AttrGid, 0, 0, 1, proto.OpOk, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"other chmod", other, proto.AttrMode, proto.Mode(0777), 0, 0, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"other chmod unchanged", other, proto.AttrMode, proto.Mode(0644), 0, 0, proto.OpOk, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"owner chmod", owner, proto.AttrMode, proto.Mode(0600), 0, 0, proto.OpOk, [3]uint32{proto.Mode(0600), 1, 1}},
+		{"owner setgid member", owner, proto.AttrMode, setgid, 0, 0, proto.OpOk, [3]uint32{setgid, 1, 1}},
+		{"owner setgid non-member", owner, proto.AttrMode | proto.AttrGid, setgid, 0, 6, proto.OpNotPerm, [3]uint32{proto.Mode(0644), 1, 1}},
+		{"owner chgrp and setgid", owner, proto.AttrMode | proto.AttrGid, setgid, 0, 5, proto.OpOk, [3]uint32{setgid, 1, 5}},
+	}
+	for _, tt := range tests {
+		ino.Type, ino.Uid, ino.Gid = proto.Mode(0644), 1, 1
+		data, err := json.Marshal(&SetattrRequest{
+			PartitionID: mp.config.PartitionId,
+			Inode:       ino.Inode,
+			Valid:       tt.valid,
+			Mode:        tt.mode,
+			Uid:         tt.uid,
+			Gid:         tt.gid,
+			Caller:      tt.caller,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetattr)
+		mp.SetAttr(data, p)
+		if p.ResultCode != tt.status {
+			t.Errorf("%v: expect status %v, got %v", tt.name, tt.status, p.ResultCode)
+			continue
+		}
+		if got := [3]uint32{ino.Type, ino.Uid, ino.Gid}; got != tt.want {
+			t.Errorf("%v: expect mode/uid/gid %o/%v/%v, got %o/%v/%v", tt.name, tt.want[0], tt.want[1], tt.want[2],
+				got[0], got[1], got[2])
+		}
+	}
+
+	// the setgid bit is dropped if the caller is not a member of the group
+	ino.Type, ino.Uid, ino.Gid = proto.Mode(0644), 1, 6
+	data, _ := json.Marshal(&SetattrRequest{Inode: ino.Inode, Valid: proto.AttrMode, Mode: setgid, Caller: owner})
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetattr)
+	if mp.SetAttr(data, p); p.ResultCode != proto.OpOk || ino.Type != proto.Mode(0755) {
+		t.Fatalf("expect the setgid bit to be dropped, got status %v mode %o", p.ResultCode, ino.Type)
+	}
+
+	data, _ = json.Marshal(&SetattrRequest{Inode: ino.Inode + 1, Valid: proto.AttrMode, Mode: setgid, Caller: owner})
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetattr)
+	if mp.SetAttr(data, p); p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("expect the missing inode to be reported, got status %v", p.ResultCode)
+	}
+
+	// the requests without a caller of the old clients are allowed only if the metanode is configured to
+	allowNoCaller = true
+	defer func() { allowNoCaller = false }()
+	data, _ = json.Marshal(&SetattrRequest{Inode: ino.Inode, Valid: proto.AttrUid, Uid: 2})
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetattr)
+	if mp.SetAttr(data, p); p.ResultCode != proto.OpOk || ino.Uid != 2 {
+		t.Fatalf("expect the request without a caller to be allowed, got status %v uid %v", p.ResultCode, ino.Uid)
+	}
+}
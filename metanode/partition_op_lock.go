@@ -0,0 +1,89 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// SetLock acquires or releases an advisory lock on the inode.
+func (mp *metaPartition) SetLock(req *SetLockReq, p *Packet) (err error) {
+	if req.Lock.Type > proto.FileLockUnlock || req.Lock.Start > req.Lock.End {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	if req.Lock.Type != proto.FileLockUnlock {
+		if status := mp.getInode(NewInode(req.Inode, 0)).Status; status != proto.OpOk {
+			p.PacketErrorWithBody(status, nil)
+			return
+		}
+	}
+	req.Time = time.Now().UnixNano()
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMSetLock, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// GetLock returns a lock on the inode which conflicts with the given one.
+func (mp *metaPartition) GetLock(req *GetLockReq, p *Packet) (err error) {
+	resp := &GetLockResp{}
+	if conflict := mp.fileLocks.GetConflict(req.Inode, &req.Lock, time.Now().UnixNano()); conflict != nil {
+		resp.Lock = *conflict
+	} else {
+		resp.Lock = req.Lock
+		resp.Lock.Type = proto.FileLockUnlock
+	}
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// RenewLock renews the leases of the locks held by the client on the inodes.
+func (mp *metaPartition) RenewLock(req *RenewLockReq, p *Packet) (err error) {
+	req.Time = time.Now().UnixNano()
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMRenewLock, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	reply, err := json.Marshal(resp.(*RenewLockResp))
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// interval of retrying the quota tasks failed
+	quotaTaskInterval = time.Minute
+	// max number of the inodes in a request to apply a quota
+	applyQuotaBatchLimit = 1000
+)
+
+// SetInodeQuota accounts the given inodes to the quota, or removes them from it, along with the directory trees
+// beneath the given directories, which are walked in the background as ApplyQuota does.
+func (mp *metaPartition) SetInodeQuota(req *SetInodeQuotaReq, p *Packet) (err error) {
+	mp.applyInodeQuota(req.QuotaID, req.Inodes, req.Dirs, req.Remove, p)
+	return
+}
+
+// ApplyQuota accounts the inodes of the request to the quota, or removes them from it, and then the directory
+// trees beneath the directories of the request in the background. The directories are recorded as a task before
+// the reply, which is retried by the leader until it succeeds.
+func (mp *metaPartition) ApplyQuota(req *proto.ApplyQuotaRequest, p *Packet) (err error) {
+	mp.applyInodeQuota(req.QuotaID, req.Inodes, req.Dirs, req.Remove, p)
+	return
+}
+
+func (mp *metaPartition) applyInodeQuota(quotaID uint32, inodes, dirs []uint64, remove bool, p *Packet) {
+	if quotaID == 0 {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	if status := mp.setInodeQuota(inodes, quotaID, remove); status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	if len(dirs) > 0 {
+		task := &QuotaTask{QuotaID: quotaID, Remove: remove, Dirs: dirs}
+		if status := mp.putQuotaTask(opFSMPutQuotaTask, task); status != proto.OpOk {
+			p.PacketErrorWithBody(status, nil)
+			return
+		}
+		select {
+		case mp.quotaTaskC <- struct{}{}:
+		default:
+		}
+	}
+	p.PacketOkReply()
+}
+
+func (mp *metaPartition) putQuotaTask(op uint32, task *QuotaTask) (status uint8) {
+	val, err := json.Marshal(task)
+	if err != nil {
+		return proto.OpErr
+	}
+	resp, err := mp.Put(op, val)
+	if err != nil {
+		return proto.OpAgain
+	}
+	return resp.(uint8)
+}
+
+func (mp *metaPartition) setInodeQuota(inodes []uint64, quotaID uint32, remove bool) (status uint8) {
+	if len(inodes) == 0 {
+		return proto.OpOk
+	}
+	val, err := json.Marshal(&SetInodeQuotaReq{VolName: mp.config.VolName, PartitionID: mp.config.PartitionId,
+		Inodes: inodes, QuotaID: quotaID, Remove: remove})
+	if err != nil {
+		return proto.OpErr
+	}
+	resp, err := mp.Put(opFSMSetInodeQuota, val)
+	if err != nil {
+		return proto.OpAgain
+	}
+	return resp.(uint8)
+}
+
+// Walk the directory trees beneath the directories of the task, and account the inodes to the quota. The entries
+// in this partition are walked here, while the inodes of the other partitions, along with the entries of the
+// directories there and in the shards of the directories, are sent to the partitions, which record them as their
+// own tasks. The whole task is walked again if any step fails, which is harmless as the steps are idempotent.
+func (mp *metaPartition) applyQuota(task *QuotaTask) (ok bool) {
+	var (
+		quotaID = task.QuotaID
+		dirs    = append([]uint64(nil), task.Dirs...)
+		views   []*proto.MetaPartitionView
+		local   []uint64
+		remotes = make(map[uint64]*proto.ApplyQuotaRequest)
+		failed  bool
+	)
+	send := func(req *proto.ApplyQuotaRequest) {
+		view := findMetaPartitionViewByID(views, req.PartitionID)
+		if view == nil {
+			log.LogWarnf("applyQuota: partition(%v) quota(%v) target(%v) not found",
+				mp.config.PartitionId, quotaID, req.PartitionID)
+			failed = true
+			return
+		}
+		target := proto.TxPartition{PartitionID: view.PartitionID, Members: view.Members}
+		task := proto.NewAdminTask(proto.OpMetaApplyQuota, view.LeaderAddr, req)
+		if status := mp.txSend(target, proto.OpMetaApplyQuota, 0, task, nil); status != proto.OpOk {
+			log.LogWarnf("applyQuota: partition(%v) quota(%v) target(%v) status(%v)",
+				mp.config.PartitionId, quotaID, req.PartitionID, status)
+			failed = true
+		}
+	}
+	remote := func(pid uint64) *proto.ApplyQuotaRequest {
+		req, ok := remotes[pid]
+		if !ok {
+			req = &proto.ApplyQuotaRequest{VolName: mp.config.VolName, PartitionID: pid, QuotaID: quotaID,
+				Remove: task.Remove}
+			remotes[pid] = req
+		}
+		return req
+	}
+	getViews := func() bool {
+		if views != nil {
+			return true
+		}
+		var err error
+		if views, err = mp.getMetaPartitionsView(); err != nil {
+			log.LogWarnf("applyQuota: partition(%v) quota(%v) err(%v)", mp.config.PartitionId, quotaID, err)
+			failed = true
+			return false
+		}
+		return true
+	}
+
+	for len(dirs) > 0 && !failed {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		if shards := mp.getDirShards(dir); len(shards) > 1 {
+			if !getViews() {
+				break
+			}
+			for _, pid := range shards[1:] {
+				req := remote(pid)
+				req.Dirs = append(req.Dirs, dir)
+			}
+		}
+		var children []*Dentry
+		mp.getDentryTree().AscendRange(&Dentry{ParentId: dir}, &Dentry{ParentId: dir + 1}, func(item BtreeItem) bool {
+			children = append(children, item.(*Dentry))
+			return true
+		})
+		for _, d := range children {
+			if d.Inode >= mp.config.Start && d.Inode <= mp.config.End {
+				local = append(local, d.Inode)
+				if proto.IsDir(d.Type) {
+					dirs = append(dirs, d.Inode)
+				}
+				continue
+			}
+			if !getViews() {
+				break
+			}
+			view := findMetaPartitionView(views, d.Inode)
+			if view == nil {
+				log.LogWarnf("applyQuota: partition(%v) quota(%v) ino(%v) partition not found",
+					mp.config.PartitionId, quotaID, d.Inode)
+				failed = true
+				break
+			}
+			req := remote(view.PartitionID)
+			req.Inodes = append(req.Inodes, d.Inode)
+			if proto.IsDir(d.Type) {
+				req.Dirs = append(req.Dirs, d.Inode)
+			}
+			if len(req.Inodes) >= applyQuotaBatchLimit {
+				delete(remotes, view.PartitionID)
+				send(req)
+			}
+		}
+		if len(local) >= applyQuotaBatchLimit || (len(dirs) == 0 && len(local) > 0) {
+			if status := mp.setInodeQuota(local, quotaID, task.Remove); status != proto.OpOk {
+				log.LogWarnf("applyQuota: partition(%v) quota(%v) status(%v)", mp.config.PartitionId, quotaID, status)
+				failed = true
+			}
+			local = nil
+		}
+	}
+	for _, req := range remotes {
+		if failed {
+			break
+		}
+		send(req)
+	}
+	if failed {
+		log.LogErrorf("applyQuota: partition(%v) quota(%v) task(%v) failed, retry later",
+			mp.config.PartitionId, quotaID, task.ID)
+		return false
+	}
+	log.LogInfof("applyQuota: partition(%v) quota(%v) task(%v) remove(%v) applied",
+		mp.config.PartitionId, quotaID, task.ID, task.Remove)
+	return true
+}
+
+// GetQuotaUsages returns the usage of the quotas in the partition.
+func (mp *metaPartition) GetQuotaUsages() []*proto.QuotaUsage {
+	return mp.quotaUsages.list()
+}
+
+// quotaWorker runs the quota tasks on the leader, once they are added, and then periodically until they succeed.
+func (mp *metaPartition) quotaWorker() {
+	t := time.NewTicker(quotaTaskInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-mp.quotaTaskC:
+		case <-t.C:
+		}
+		if _, ok := mp.IsLeader(); !ok {
+			continue
+		}
+		mp.runQuotaTasks()
+	}
+}
+
+func (mp *metaPartition) runQuotaTasks() {
+	for _, task := range mp.quotaTasks.List() {
+		if !mp.applyQuota(task) {
+			continue
+		}
+		if status := mp.putQuotaTask(opFSMDeleteQuotaTask, &QuotaTask{ID: task.ID}); status != proto.OpOk {
+			log.LogWarnf("runQuotaTasks: partition(%v) delete task(%v) status(%v)",
+				mp.config.PartitionId, task.ID, status)
+		}
+	}
+}
+
+// Count the inodes and the bytes of the files accounted to each quota, which are updated by the FSM
+// afterwards. It is called once the inodes are loaded, before any raft log entry is applied.
+func (mp *metaPartition) countQuotaUsages() []*proto.QuotaUsage {
+	t := newQuotaUsageTable(nil)
+	mp.inodeTree.Ascend(func(item BtreeItem) bool {
+		t.update(nil, inodeQuotaUsage(item.(*Inode)))
+		return true
+	})
+	return t.list()
+}
@@ -0,0 +1,183 @@
+package metanode
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func applyTestQuota(t *testing.T, mp *metaPartition, req *proto.ApplyQuotaRequest) {
+	t.Helper()
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaApplyQuota)
+	if mp.ApplyQuota(req, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("apply quota %v: status %v", req.QuotaID, p.ResultCode)
+	}
+}
+
+// Checks the usage updated by the FSM to be the one counted from the inodes.
+func checkTestQuotaUsages(t *testing.T, mp *metaPartition, expect ...*proto.QuotaUsage) {
+	t.Helper()
+	usages := mp.GetQuotaUsages()
+	if len(expect) == 0 {
+		expect = []*proto.QuotaUsage{}
+	}
+	if !reflect.DeepEqual(usages, expect) {
+		t.Fatalf("expect usages %v, got %v", expect, usages)
+	}
+	if counted := mp.countQuotaUsages(); !reflect.DeepEqual(counted, usages) {
+		t.Fatalf("expect the usages updated %v to be counted, got %v", usages, counted)
+	}
+}
+
+func checkTestQuotaIDs(t *testing.T, mp *metaPartition, quotaIDs []uint32, inodes ...*Inode) {
+	t.Helper()
+	for _, ino := range inodes {
+		// the inodes are copied on write once the tree is cloned
+		ino = mp.inodeTree.Get(ino).(*Inode)
+		if !reflect.DeepEqual(ino.QuotaIDs, quotaIDs) {
+			t.Errorf("inode %v: expect quotas %v, got %v", ino.Inode, quotaIDs, ino.QuotaIDs)
+		}
+	}
+}
+
+func TestApplyQuota(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	dirMode := proto.Mode(os.ModeDir | 0755)
+	fileMode := proto.Mode(0644)
+
+	// a populated directory, and a sibling which is not beneath the quota
+	dir := createTestInode(t, mp, proto.RootIno, "dir", dirMode)
+	file := createTestInode(t, mp, dir.Inode, "file", fileMode)
+	appendTestExtent(mp, file.Inode, proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 100})
+	sub := createTestInode(t, mp, dir.Inode, "sub", dirMode)
+	deep := createTestInode(t, mp, sub.Inode, "deep", fileMode)
+	appendTestExtent(mp, deep.Inode, proto.ExtentKey{PartitionId: 1, ExtentId: 2, Size: 20})
+	other := createTestInode(t, mp, proto.RootIno, "other", dirMode)
+	otherFile := createTestInode(t, mp, other.Inode, "file", fileMode)
+
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaApplyQuota)
+	if mp.ApplyQuota(&proto.ApplyQuotaRequest{Inodes: []uint64{dir.Inode}}, p); p.ResultCode != proto.OpArgMismatchErr {
+		t.Fatalf("expect quota 0 to be rejected, status %v", p.ResultCode)
+	}
+	const quotaID = 7
+	applyTestQuota(t, mp, &proto.ApplyQuotaRequest{QuotaID: quotaID, Inodes: []uint64{dir.Inode}, Dirs: []uint64{dir.Inode}})
+	// the directories are walked by the task recorded
+	if tasks := mp.quotaTasks.List(); len(tasks) != 1 || tasks[0].QuotaID != quotaID {
+		t.Fatalf("expect the task of quota %v, got %v", quotaID, tasks)
+	}
+	mp.runQuotaTasks()
+	if tasks := mp.quotaTasks.List(); len(tasks) != 0 {
+		t.Fatalf("expect the task done to be deleted, got %v", tasks)
+	}
+	checkTestQuotaIDs(t, mp, []uint32{quotaID}, dir, file, sub, deep)
+	checkTestQuotaIDs(t, mp, nil, other, otherFile)
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: quotaID, Files: 4, Bytes: 120})
+
+	// applying the quota again takes no effect
+	applyTestQuota(t, mp, &proto.ApplyQuotaRequest{QuotaID: quotaID, Inodes: []uint64{dir.Inode}, Dirs: []uint64{dir.Inode}})
+	mp.runQuotaTasks()
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: quotaID, Files: 4, Bytes: 120})
+
+	// the tree renamed out of the quota is removed from it
+	applyTestQuota(t, mp, &proto.ApplyQuotaRequest{QuotaID: quotaID, Inodes: []uint64{sub.Inode}, Dirs: []uint64{sub.Inode}, Remove: true})
+	mp.runQuotaTasks()
+	checkTestQuotaIDs(t, mp, nil, sub, deep)
+	checkTestQuotaIDs(t, mp, []uint32{quotaID}, dir, file)
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: quotaID, Files: 2, Bytes: 100})
+
+	// and accounted again once the clients rename it back
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetInodeQuota)
+	req := &SetInodeQuotaReq{QuotaID: quotaID, Inodes: []uint64{sub.Inode}, Dirs: []uint64{sub.Inode}}
+	if mp.SetInodeQuota(req, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("set inode quota: status %v", p.ResultCode)
+	}
+	mp.runQuotaTasks()
+	checkTestQuotaIDs(t, mp, []uint32{quotaID}, sub, deep)
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: quotaID, Files: 4, Bytes: 120})
+}
+
+// The usage of the quotas is updated by the FSM as the inodes are changed.
+func TestQuotaUsage(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	applyTestQuota(t, mp, &proto.ApplyQuotaRequest{QuotaID: 1, Inodes: []uint64{dir.Inode}})
+
+	file := NewInode(100, proto.Mode(0644))
+	file.QuotaIDs = []uint32{1}
+	if status := mp.fsmCreateInode(file); status != proto.OpOk {
+		t.Fatalf("create inode: status %v", status)
+	}
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 2})
+	appendTestExtent(mp, file.Inode, proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: 100})
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 2, Bytes: 100})
+	truncate := NewInode(file.Inode, 0)
+	truncate.Size = 30
+	if resp := mp.fsmExtentsTruncate(truncate); resp.Status != proto.OpOk {
+		t.Fatalf("truncate: status %v", resp.Status)
+	}
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 2, Bytes: 30})
+
+	// the unlinked file is accounted until it is evicted
+	mp.fsmUnlinkInode(NewInode(file.Inode, 0))
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 2, Bytes: 30})
+	mp.fsmEvictInode(NewInode(file.Inode, 0))
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 1})
+	mp.internalDeleteInode(NewInode(file.Inode, 0))
+	checkTestQuotaUsages(t, mp, &proto.QuotaUsage{QuotaID: 1, Files: 1})
+
+	// the empty directory is deleted once unlinked
+	if resp := mp.fsmDeleteDentry(&Dentry{ParentId: proto.RootIno, Name: "dir"}); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	mp.fsmUnlinkInode(NewInode(dir.Inode, 0))
+	checkTestQuotaUsages(t, mp)
+}
+
+// The task failed is kept, and retried until it succeeds. It is stored with the partition.
+func TestQuotaTaskRetry(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	helper := masterHelper
+	masterHelper = util.NewMasterHelper()
+	defer func() { masterHelper = helper }()
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	file := createTestInode(t, mp, dir.Inode, "file", proto.Mode(0644))
+	// the entry of an inode in another partition, which is not found without the master
+	remote := &Dentry{ParentId: dir.Inode, Name: "remote", Inode: file.Inode + 100, Type: proto.Mode(0644)}
+	mp.config.End = file.Inode
+	if status := mp.fsmCreateDentry(remote, false); status != proto.OpOk {
+		t.Fatalf("create dentry: status %v", status)
+	}
+
+	applyTestQuota(t, mp, &proto.ApplyQuotaRequest{QuotaID: 1, Dirs: []uint64{dir.Inode}})
+	mp.runQuotaTasks()
+	tasks := mp.quotaTasks.List()
+	if len(tasks) != 1 {
+		t.Fatalf("expect the task failed to be kept, got %v", tasks)
+	}
+	data, err := mp.quotaTasks.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewQuotaTaskTable()
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.List(), tasks) {
+		t.Fatalf("expect the tasks %v to be loaded, got %v", tasks, loaded.List())
+	}
+
+	if resp := mp.fsmDeleteDentry(remote); resp.Status != proto.OpOk {
+		t.Fatalf("delete dentry: status %v", resp.Status)
+	}
+	mp.runQuotaTasks()
+	if tasks = mp.quotaTasks.List(); len(tasks) != 0 {
+		t.Fatalf("expect the task retried to be done, got %v", tasks)
+	}
+	checkTestQuotaIDs(t, mp, []uint32{1}, file)
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// CreateSnapshot freezes the current version of the inodes and dentries as the volume snapshot.
+func (mp *metaPartition) CreateSnapshot(req *proto.MetaSnapshotRequest, p *Packet) (err error) {
+	return mp.putSnapshotOp(opFSMCreateSnapshot, req, p)
+}
+
+// DeleteSnapshot deletes the volume snapshot, and the extents only referenced by it.
+func (mp *metaPartition) DeleteSnapshot(req *proto.MetaSnapshotRequest, p *Packet) (err error) {
+	return mp.putSnapshotOp(opFSMDeleteSnapshot, req, p)
+}
+
+func (mp *metaPartition) putSnapshotOp(op uint32, req *proto.MetaSnapshotRequest, p *Packet) (err error) {
+	if req.SnapshotID == 0 {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(op, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
@@ -0,0 +1,392 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The leader of a partition of a volume with the cold tier migrates the extents of the files not accessed
+// for the days of the tier policy to the cold data partitions. The policy of the volume applies to all the
+// files, and the policy of a directory, kept in the TierXAttr of it, applies to the files directly in it.
+// The files in a directory may be in the other partitions, so the policy of the directory is sent to them, along
+// with the directory itself to the partitions of its shards if it is sharded.
+// The shorter of the policies of the volume and the directory takes effect.
+
+const (
+	tierMigrateInterval = time.Hour
+	// the maximum number of the extents migrated in a round
+	tierMigrateBatchCount = 128
+	// the deadline to wait for the migration of an extent
+	tierMigrateDeadlineTime = 600
+)
+
+// tierWorker migrates the cold files on the leader of the partition, by the policies of the volume and the
+// directories periodically, and by the policies sent by the other partitions once they are received.
+func (mp *metaPartition) tierWorker() {
+	t := time.NewTicker(tierMigrateInterval)
+	for {
+		var periodic bool
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-mp.tierC:
+		case <-t.C:
+			periodic = true
+		}
+		if _, ok := mp.IsLeader(); !ok {
+			continue
+		}
+		mp.runTierRound(periodic)
+	}
+}
+
+// TierMigrate merges the tier policies of the files and the directories sent by another partition, which are
+// migrated by tierWorker in background.
+func (mp *metaPartition) TierMigrate(req *proto.TierMigrateRequest, p *Packet) (err error) {
+	if req.ColdAfterDays == 0 {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	mp.tierLock.Lock()
+	if mp.tierInodes == nil {
+		mp.tierInodes = make(map[uint64]uint32)
+		mp.tierDirs = make(map[uint64]uint32)
+	}
+	for _, ino := range req.Inodes {
+		mergeTierPolicy(mp.tierInodes, ino, req.ColdAfterDays)
+	}
+	for _, dir := range req.Dirs {
+		mergeTierPolicy(mp.tierDirs, dir, req.ColdAfterDays)
+	}
+	mp.tierLock.Unlock()
+	select {
+	case mp.tierC <- struct{}{}:
+	default:
+	}
+	p.PacketOkReply()
+	return
+}
+
+// Keeps the shorter of the policies of the inode.
+func mergeTierPolicy(policies map[uint64]uint32, ino uint64, days uint32) {
+	if cur, ok := policies[ino]; !ok || days < cur {
+		policies[ino] = days
+	}
+}
+
+// Returns the policies sent by the other partitions, which are cleared.
+func (mp *metaPartition) takeTierPolicies() (inodes, dirs map[uint64]uint32) {
+	mp.tierLock.Lock()
+	defer mp.tierLock.Unlock()
+	inodes, dirs = mp.tierInodes, mp.tierDirs
+	mp.tierInodes, mp.tierDirs = nil, nil
+	if inodes == nil {
+		inodes = make(map[uint64]uint32)
+		dirs = make(map[uint64]uint32)
+	}
+	return
+}
+
+// Migrates the cold files by the policies sent by the other partitions, along with the policies of the volume
+// and of the directories of this partition in the periodic round.
+func (mp *metaPartition) runTierRound(periodic bool) {
+	var coldAfterDays uint32
+	policies, dirs := mp.takeTierPolicies()
+	if periodic {
+		var err error
+		if coldAfterDays, err = mp.getColdAfterDays(); err != nil {
+			log.LogWarnf("runTierRound: partition(%v) err(%v)", mp.config.PartitionId, err)
+		}
+		for dir, days := range mp.getTierDirs() {
+			mergeTierPolicy(dirs, dir, days)
+		}
+	}
+	for ino, days := range mp.dispatchDirTierPolicies(dirs) {
+		mergeTierPolicy(policies, ino, days)
+	}
+	mp.migrateColdFiles(coldAfterDays, policies)
+}
+
+// Returns the policies of the directories of this partition.
+func (mp *metaPartition) getTierDirs() (dirs map[uint64]uint32) {
+	dirs = make(map[uint64]uint32)
+	mp.getInodeTree().Ascend(func(item BtreeItem) bool {
+		ino := item.(*Inode)
+		ino.RLock()
+		defer ino.RUnlock()
+		if !proto.IsDir(ino.Type) || ino.ShouldDelete() {
+			return true
+		}
+		if val, ok := ino.XAttrs[proto.TierXAttr]; ok {
+			if days, err := strconv.ParseUint(string(val), 10, 32); err == nil && days > 0 {
+				dirs[ino.Inode] = uint32(days)
+			}
+		}
+		return true
+	})
+	return
+}
+
+// Returns the tier policies of the files of this partition in the directories with the policies, and sends the
+// policies of the files in the other partitions to them. The sharded directories are sent to the partitions of
+// their shards, which apply the policies to their own entries of them.
+func (mp *metaPartition) dispatchDirTierPolicies(dirs map[uint64]uint32) (policies map[uint64]uint32) {
+	policies = make(map[uint64]uint32)
+	if len(dirs) == 0 {
+		return
+	}
+	var (
+		views    []*proto.MetaPartitionView
+		viewsErr error
+		remotes  = make(map[uint64]map[uint32]*proto.TierMigrateRequest)
+	)
+	remote := func(pid uint64, days uint32) *proto.TierMigrateRequest {
+		if remotes[pid] == nil {
+			remotes[pid] = make(map[uint32]*proto.TierMigrateRequest)
+		}
+		req, ok := remotes[pid][days]
+		if !ok {
+			req = &proto.TierMigrateRequest{VolName: mp.config.VolName, PartitionID: pid, ColdAfterDays: days}
+			remotes[pid][days] = req
+		}
+		return req
+	}
+	getViews := func() bool {
+		if views == nil && viewsErr == nil {
+			if views, viewsErr = mp.getMetaPartitionsView(); viewsErr != nil {
+				log.LogWarnf("dispatchDirTierPolicies: partition(%v) err(%v)", mp.config.PartitionId, viewsErr)
+			}
+		}
+		return viewsErr == nil
+	}
+
+	for dir, days := range dirs {
+		if shards := mp.getDirShards(dir); len(shards) > 1 {
+			for _, pid := range shards[1:] {
+				req := remote(pid, days)
+				req.Dirs = append(req.Dirs, dir)
+			}
+		}
+		mp.getDentryTree().AscendRange(&Dentry{ParentId: dir}, &Dentry{ParentId: dir + 1}, func(item BtreeItem) bool {
+			d := item.(*Dentry)
+			if !proto.IsRegular(d.Type) {
+				return true
+			}
+			if d.Inode >= mp.config.Start && d.Inode <= mp.config.End {
+				mergeTierPolicy(policies, d.Inode, days)
+				return true
+			}
+			if !getViews() {
+				return true
+			}
+			if view := findMetaPartitionView(views, d.Inode); view != nil {
+				req := remote(view.PartitionID, days)
+				req.Inodes = append(req.Inodes, d.Inode)
+			}
+			return true
+		})
+	}
+
+	if len(remotes) == 0 || !getViews() {
+		return
+	}
+	for pid, reqs := range remotes {
+		view := findMetaPartitionViewByID(views, pid)
+		if view == nil {
+			log.LogWarnf("dispatchDirTierPolicies: partition(%v) target(%v) not found", mp.config.PartitionId, pid)
+			continue
+		}
+		target := proto.TxPartition{PartitionID: view.PartitionID, Members: view.Members}
+		for _, req := range reqs {
+			if status := mp.txSend(target, proto.OpMetaTierMigrate, 0, req, nil); status != proto.OpOk {
+				log.LogWarnf("dispatchDirTierPolicies: partition(%v) target(%v) inodes(%v) dirs(%v) status(%v)",
+					mp.config.PartitionId, pid, len(req.Inodes), len(req.Dirs), status)
+			}
+		}
+	}
+	return
+}
+
+// Migrates the extents of the files not accessed for the days of the policy of the volume, or the policies
+// of the directories by the inodes of the files.
+func (mp *metaPartition) migrateColdFiles(coldAfterDays uint32, policies map[uint64]uint32) {
+	if coldAfterDays == 0 && len(policies) == 0 {
+		return
+	}
+	coldPartitions := mp.vol.ColdPartitions()
+	if len(coldPartitions) == 0 {
+		return
+	}
+	now := time.Now()
+	deadline := func(ino uint64) int64 {
+		days := coldAfterDays
+		if d, ok := policies[ino]; ok && (days == 0 || d < days) {
+			days = d
+		}
+		if days == 0 {
+			return 0
+		}
+		return now.Add(-time.Duration(days) * 24 * time.Hour).Unix()
+	}
+	// the generations of the files bumped by the extents migrated in this round
+	migrated := make(map[uint64]uint64)
+	for _, c := range mp.tierCandidates(deadline) {
+		if _, ok := mp.IsLeader(); !ok {
+			return
+		}
+		if gen, ok := migrated[c.inode]; ok {
+			c.generation = gen
+		}
+		dst := coldPartitions[rand.Intn(len(coldPartitions))]
+		if err := mp.tierMigrateExtent(c, dst); err != nil {
+			log.LogWarnf("migrateColdFiles: partition(%v) ino(%v) extent(%v_%v) err(%v)",
+				mp.config.PartitionId, c.inode, c.partitionID, c.extentID, err)
+			continue
+		}
+		migrated[c.inode] = c.generation + 1
+	}
+}
+
+// Returns the extents of the files not accessed since the deadline of them, which are still in the hot tier.
+// The tiny extents are shared by the files, so they are never migrated.
+func (mp *metaPartition) tierCandidates(deadline func(ino uint64) int64) (candidates []*ecCandidate) {
+	mp.getInodeTree().Ascend(func(item BtreeItem) bool {
+		ino := item.(*Inode)
+		ino.RLock()
+		defer ino.RUnlock()
+		if !proto.IsRegular(ino.Type) || ino.ShouldDelete() {
+			return true
+		}
+		d := deadline(ino.Inode)
+		if d == 0 || ino.AccessTime > d || ino.ModifyTime > d {
+			return true
+		}
+		extents := make(map[[2]uint64]*ecCandidate)
+		ino.Extents.Range(func(item BtreeItem) bool {
+			ek := item.(*proto.ExtentKey)
+			if storage.IsTinyExtent(ek.ExtentId) {
+				return true
+			}
+			if dp := mp.vol.GetPartition(ek.PartitionId); dp == nil || dp.IsEc() || dp.Cold {
+				return true
+			}
+			key := [2]uint64{ek.PartitionId, ek.ExtentId}
+			c, ok := extents[key]
+			if !ok {
+				c = &ecCandidate{inode: ino.Inode, generation: ino.Generation, partitionID: ek.PartitionId, extentID: ek.ExtentId}
+				extents[key] = c
+				candidates = append(candidates, c)
+			}
+			if end := ek.ExtentOffset + uint64(ek.Size); end > c.size {
+				c.size = end
+			}
+			return true
+		})
+		return len(candidates) < tierMigrateBatchCount
+	})
+	return
+}
+
+// Ask the cold data partition to copy the extent, and then replace the keys of the file.
+func (mp *metaPartition) tierMigrateExtent(c *ecCandidate, dst *DataPartition) (err error) {
+	src := mp.vol.GetPartition(c.partitionID)
+	if src == nil {
+		return fmt.Errorf("unknown data partition(%v)", c.partitionID)
+	}
+	if len(dst.Hosts) == 0 {
+		return fmt.Errorf("data partition(%v) has no hosts", dst.PartitionID)
+	}
+	data, err := json.Marshal(&proto.TierMigrateExtentRequest{
+		PartitionID:    dst.PartitionID,
+		Inode:          c.inode,
+		SrcPartitionID: src.PartitionID,
+		SrcHosts:       src.Hosts,
+		SrcExtentID:    c.extentID,
+		Size:           c.size,
+	})
+	if err != nil {
+		return
+	}
+	p := NewPacketToTierMigrateExtent(dst, data)
+	conn, err := mp.config.ConnPool.GetConnect(dst.Hosts[0])
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err != nil {
+		mp.config.ConnPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	if err = p.ReadFromConn(conn, tierMigrateDeadlineTime); err != nil {
+		mp.config.ConnPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	mp.config.ConnPool.PutConnect(conn, NoClosedConnect)
+	if p.ResultCode != proto.OpOk {
+		return errors.NewErrorf("%s response: %s", p.GetUniqueLogId(), p.GetResultMsg())
+	}
+	resp := &proto.TierMigrateExtentResponse{}
+	if err = json.Unmarshal(p.Data[:p.Size], resp); err != nil {
+		return
+	}
+
+	// the keys are replaced as the erasure-coded ones, the extent is deleted if the file has been changed
+	val, err := json.Marshal(&EcConvertExtentReq{
+		Inode:          c.inode,
+		SrcPartitionID: c.partitionID,
+		SrcExtentID:    c.extentID,
+		DstPartitionID: dst.PartitionID,
+		DstExtentID:    resp.ExtentID,
+		Size:           c.size,
+		Generation:     c.generation,
+	})
+	if err != nil {
+		return
+	}
+	r, err := mp.Put(opFSMEcConvertExtent, val)
+	if err != nil {
+		return
+	}
+	if status := r.(uint8); status != proto.OpOk {
+		return fmt.Errorf("extent keys of ino(%v) changed during the migration, status(%v)", c.inode, status)
+	}
+	log.LogInfof("tierMigrateExtent: partition(%v) ino(%v) extent(%v_%v) migrated to (%v_%v)",
+		mp.config.PartitionId, c.inode, c.partitionID, c.extentID, dst.PartitionID, resp.ExtentID)
+	return
+}
+
+func (mp *metaPartition) getColdAfterDays() (coldAfterDays uint32, err error) {
+	reqURL := fmt.Sprintf("%s?name=%s", proto.AdminGetVol, mp.config.VolName)
+	respBody, err := masterHelper.Request(http.MethodGet, reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+	view := &proto.SimpleVolView{}
+	if err = json.Unmarshal(respBody, view); err != nil {
+		return
+	}
+	return view.ColdAfterDays, nil
+}
@@ -0,0 +1,125 @@
+package metanode
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// Serves the views of the meta partitions as the master does, until the returned function is called.
+func serveTestPartitionViews(t *testing.T, views []*proto.MetaPartitionView) func() {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != proto.ClientMetaPartitions {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := json.Marshal(&proto.HTTPReply{Data: views})
+		w.Write(data)
+	}))
+	helper := masterHelper
+	masterHelper = util.NewMasterHelper()
+	masterHelper.AddNode(strings.TrimPrefix(s.URL, "http://"))
+	return func() {
+		masterHelper = helper
+		s.Close()
+	}
+}
+
+// Creates a file in the partition of the inodes, and its entry in the partition of the entries.
+func createTestRemoteEntry(t *testing.T, dentryMp, inodeMp *metaPartition, parentID uint64, name string) *Inode {
+	inodeMp.config.Cursor++
+	ino := NewInode(inodeMp.config.Cursor, proto.Mode(0644))
+	if status := inodeMp.fsmCreateInode(ino); status != proto.OpOk {
+		t.Fatalf("create inode %v: status %v", name, status)
+	}
+	dentry := &Dentry{ParentId: parentID, Name: name, Inode: ino.Inode, Type: ino.Type}
+	if status := dentryMp.fsmCreateDentry(dentry, true); status != proto.OpOk {
+		t.Fatalf("create dentry %v: status %v", name, status)
+	}
+	return ino
+}
+
+func tierMigrateTest(t *testing.T, mp *metaPartition, req *proto.TierMigrateRequest, status uint8) {
+	t.Helper()
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaTierMigrate)
+	if mp.TierMigrate(req, p); p.ResultCode != status {
+		t.Fatalf("tier migrate %v: expect status %v, got %v", req, status, p.ResultCode)
+	}
+}
+
+func checkTestTierPolicies(t *testing.T, policies map[uint64]uint32, expect map[uint64]uint32) {
+	t.Helper()
+	if !reflect.DeepEqual(policies, expect) {
+		t.Fatalf("expect the policies %v, got %v", expect, policies)
+	}
+}
+
+// The policies sent by the other partitions are merged until tierWorker takes them, and the shorter one of a
+// file takes effect.
+func TestTierMigrate(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+
+	tierMigrateTest(t, mp, &proto.TierMigrateRequest{Inodes: []uint64{10}}, proto.OpArgMismatchErr)
+	tierMigrateTest(t, mp, &proto.TierMigrateRequest{Inodes: []uint64{10, 11}, ColdAfterDays: 7}, proto.OpOk)
+	tierMigrateTest(t, mp, &proto.TierMigrateRequest{Inodes: []uint64{10}, Dirs: []uint64{20}, ColdAfterDays: 3}, proto.OpOk)
+	tierMigrateTest(t, mp, &proto.TierMigrateRequest{Dirs: []uint64{20}, ColdAfterDays: 5}, proto.OpOk)
+	select {
+	case <-mp.tierC:
+	default:
+		t.Fatalf("expect tierWorker notified")
+	}
+	inodes, dirs := mp.takeTierPolicies()
+	checkTestTierPolicies(t, inodes, map[uint64]uint32{10: 3, 11: 7})
+	checkTestTierPolicies(t, dirs, map[uint64]uint32{20: 3})
+
+	// the policies are taken only once, by the round of any kind
+	tierMigrateTest(t, mp, &proto.TierMigrateRequest{Inodes: []uint64{10}, ColdAfterDays: 7}, proto.OpOk)
+	mp.runTierRound(false)
+	inodes, dirs = mp.takeTierPolicies()
+	checkTestTierPolicies(t, inodes, map[uint64]uint32{})
+	checkTestTierPolicies(t, dirs, map[uint64]uint32{})
+}
+
+// The policy of a sharded directory applies to the files of its entries in all the shards.
+func TestDispatchDirTierPolicies(t *testing.T) {
+	mp1, mp2, cleanup := newTestTxPartitions(t)
+	defer cleanup()
+	mp1.config.End = 999
+	defer serveTestPartitionViews(t, []*proto.MetaPartitionView{
+		testPartitionView(mp1, 1, 999), testPartitionView(mp2, 1000, 1999)})()
+	fileMode := proto.Mode(0644)
+	pids := []uint64{1, 2}
+
+	dir := createTestInode(t, mp1, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	if status := mp1.fsmSetXAttr(&SetXAttrReq{Inode: dir.Inode, Key: proto.TierXAttr, Value: []byte("7")}); status != proto.OpOk {
+		t.Fatalf("set the tier policy: status %v", status)
+	}
+	createTestInode(t, mp1, dir.Inode, "sub", proto.Mode(os.ModeDir|0755))
+	local := createTestInode(t, mp1, dir.Inode, testShardName(t, pids, dir.Inode, 1, "f"), fileMode)
+	// the entry created before the split, whose inode is in the other partition
+	old := createTestRemoteEntry(t, mp1, mp2, dir.Inode, "old")
+	splitTestDir(t, mp1, dir.Inode, pids)
+	// the entry in the shard, without the directory inode
+	shard := createTestRemoteEntry(t, mp2, mp2, dir.Inode, testShardName(t, pids, dir.Inode, 2, "f"))
+
+	policies := mp1.dispatchDirTierPolicies(mp1.getTierDirs())
+	checkTestTierPolicies(t, policies, map[uint64]uint32{local.Inode: 7})
+
+	// the shard gets the file of the entry in the directory inode partition, and the directory to scan
+	inodes, dirs := mp2.takeTierPolicies()
+	checkTestTierPolicies(t, inodes, map[uint64]uint32{old.Inode: 7})
+	checkTestTierPolicies(t, dirs, map[uint64]uint32{dir.Inode: 7})
+	policies = mp2.dispatchDirTierPolicies(dirs)
+	checkTestTierPolicies(t, policies, map[uint64]uint32{shard.Inode: 7})
+	if inodes, dirs = mp1.takeTierPolicies(); len(inodes) != 0 || len(dirs) != 0 {
+		t.Fatalf("expect the directory not sent back, got %v %v", inodes, dirs)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The clients of a volume with the trash enabled move the deleted files and directories into the trash
+// directory under the root, whose inode is allocated in the partition of the root. So all the entries of
+// the trash are kept by that partition, and its leader purges them once the retention expires.
+
+const (
+	trashPurgeInterval = 10 * time.Minute
+)
+
+// ListTrash returns the entries in the trash, which are only found in the partition of the root.
+func (mp *metaPartition) ListTrash() (entries []*proto.TrashEntry, status uint8) {
+	trashIno, status := mp.getTrashDir()
+	if status != proto.OpOk {
+		return
+	}
+	resp, status := mp.readDir(&ReadDirReq{ParentID: trashIno})
+	if status != proto.OpOk {
+		return
+	}
+	for _, child := range resp.Children {
+		entry, err := proto.ParseTrashEntry(child.Name, child.Inode, child.Type)
+		if err != nil {
+			log.LogWarnf("ListTrash: partition(%v) %v", mp.config.PartitionId, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// RestoreTrash moves the entry in the trash back to its original path in a rename transaction.
+// A file or directory at the original path is not overwritten.
+func (mp *metaPartition) RestoreTrash(req *proto.RestoreTrashRequest, p *Packet) (err error) {
+	name := req.Name
+	entry, err := proto.ParseTrashEntry(name, 0, 0)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte(err.Error()))
+		return
+	}
+	trashIno, status := mp.getTrashDir()
+	if status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	dentry, status := mp.getDentry(&Dentry{ParentId: trashIno, Name: name})
+	if status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+	views, err := mp.getMetaPartitionsView()
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	dst := findMetaPartitionView(views, entry.ParentID)
+	if dst == nil {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		return
+	}
+	renameReq := &TxRenameReq{
+		VolName:     mp.config.VolName,
+		PartitionID: mp.config.PartitionId,
+		SrcParentID: trashIno,
+		SrcName:     name,
+		DstParentID: entry.ParentID,
+		DstName:     entry.OrigName,
+		Inode:       dentry.Inode,
+		Mode:        dentry.Type,
+		DstPartition: proto.TxPartition{
+			PartitionID: dst.PartitionID,
+			Members:     dst.Members,
+		},
+	}
+	log.LogInfof("RestoreTrash: partition(%v) entry(%v)", mp.config.PartitionId, entry)
+	return mp.TxRename(renameReq, p)
+}
+
+// Returns the inode of the trash directory, if it is kept by this partition.
+func (mp *metaPartition) getTrashDir() (trashIno uint64, status uint8) {
+	if proto.RootIno < mp.config.Start || proto.RootIno > mp.config.End {
+		return 0, proto.OpNotExistErr
+	}
+	dentry, status := mp.getDentry(&Dentry{ParentId: proto.RootIno, Name: proto.TrashDirName})
+	if status != proto.OpOk {
+		return
+	}
+	if dentry.Inode < mp.config.Start || dentry.Inode > mp.config.End {
+		log.LogWarnf("getTrashDir: partition(%v) trash inode(%v) out of range",
+			mp.config.PartitionId, dentry.Inode)
+		return 0, proto.OpNotExistErr
+	}
+	return dentry.Inode, proto.OpOk
+}
+
+// trashWorker purges the expired entries in the trash on the leader of the partition of the root.
+func (mp *metaPartition) trashWorker() {
+	t := time.NewTicker(trashPurgeInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-t.C:
+			if _, ok := mp.IsLeader(); !ok {
+				continue
+			}
+			if _, status := mp.getTrashDir(); status != proto.OpOk {
+				continue
+			}
+			mp.purgeTrash()
+		}
+	}
+}
+
+func (mp *metaPartition) purgeTrash() {
+	retention, err := mp.getTrashRetention()
+	if err != nil {
+		log.LogWarnf("purgeTrash: partition(%v) err(%v)", mp.config.PartitionId, err)
+		return
+	}
+	// the entries are kept until the trash is enabled again, or removed from the trash explicitly
+	if retention == 0 {
+		return
+	}
+	entries, status := mp.ListTrash()
+	if status != proto.OpOk {
+		return
+	}
+	now := time.Now()
+	var views []*proto.MetaPartitionView
+	for _, entry := range entries {
+		if !entry.Expired(retention, now) {
+			continue
+		}
+		if views == nil {
+			if views, err = mp.getMetaPartitionsView(); err != nil {
+				log.LogWarnf("purgeTrash: partition(%v) err(%v)", mp.config.PartitionId, err)
+				return
+			}
+		}
+		mp.purgeTrashEntry(entry, views)
+	}
+}
+
+// Unlink and evict the inode of the entry, just as a client deletes a file, and then delete its dentry from
+// the trash. An entry failed is kept in the trash, and purged again the next time. The inode not found then
+// has been purged by the last attempt, which failed to delete the dentry only.
+func (mp *metaPartition) purgeTrashEntry(entry *proto.TrashEntry, views []*proto.MetaPartitionView) {
+	trashIno, status := mp.getTrashDir()
+	if status != proto.OpOk {
+		return
+	}
+	view := findMetaPartitionView(views, entry.Inode)
+	if view == nil {
+		log.LogErrorf("purgeTrashEntry: no partition of entry(%v)", entry)
+		return
+	}
+	target := proto.TxPartition{PartitionID: view.PartitionID, Members: view.Members}
+	unlinkReq := &proto.UnlinkInodeRequest{
+		VolName:     mp.config.VolName,
+		PartitionID: view.PartitionID,
+		Inode:       entry.Inode,
+	}
+	status = mp.txSend(target, proto.OpMetaUnlinkInode, 0, unlinkReq, nil)
+	if status != proto.OpOk && status != proto.OpNotExistErr {
+		log.LogErrorf("purgeTrashEntry: unlink entry(%v) status(%v)", entry, status)
+		return
+	}
+	evictReq := &proto.EvictInodeRequest{
+		VolName:     mp.config.VolName,
+		PartitionID: view.PartitionID,
+		Inode:       entry.Inode,
+	}
+	status = mp.txSend(target, proto.OpMetaEvictInode, 0, evictReq, nil)
+	if status != proto.OpOk && status != proto.OpNotExistErr {
+		log.LogErrorf("purgeTrashEntry: evict entry(%v) status(%v)", entry, status)
+		return
+	}
+
+	val, err := (&Dentry{ParentId: trashIno, Name: entry.Name}).Marshal()
+	if err != nil {
+		return
+	}
+	resp, err := mp.Put(opFSMDeleteDentry, val)
+	if err != nil {
+		log.LogWarnf("purgeTrashEntry: partition(%v) entry(%v) err(%v)", mp.config.PartitionId, entry, err)
+		return
+	}
+	if status = resp.(*DentryResponse).Status; status != proto.OpOk {
+		log.LogWarnf("purgeTrashEntry: partition(%v) entry(%v) status(%v)", mp.config.PartitionId, entry, status)
+		return
+	}
+	log.LogInfof("purgeTrashEntry: partition(%v) entry(%v)", mp.config.PartitionId, entry)
+}
+
+func (mp *metaPartition) getTrashRetention() (retention uint32, err error) {
+	reqURL := fmt.Sprintf("%s?name=%s", proto.AdminGetVol, mp.config.VolName)
+	respBody, err := masterHelper.Request(http.MethodGet, reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+	view := &proto.SimpleVolView{}
+	if err = json.Unmarshal(respBody, view); err != nil {
+		return
+	}
+	return view.TrashRetention, nil
+}
+
+func (mp *metaPartition) getMetaPartitionsView() (views []*proto.MetaPartitionView, err error) {
+	reqURL := fmt.Sprintf("%s?name=%s", proto.ClientMetaPartitions, mp.config.VolName)
+	respBody, err := masterHelper.Request(http.MethodGet, reqURL, nil, nil)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(respBody, &views); err != nil {
+		return
+	}
+	return
+}
+
+func findMetaPartitionView(views []*proto.MetaPartitionView, inode uint64) *proto.MetaPartitionView {
+	for _, view := range views {
+		if inode >= view.Start && inode <= view.End {
+			return view
+		}
+	}
+	return nil
+}
+
+func findMetaPartitionViewByID(views []*proto.MetaPartitionView, partitionID uint64) *proto.MetaPartitionView {
+	for _, view := range views {
+		if view.PartitionID == partitionID {
+			return view
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package metanode
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func testPartitionView(mp *metaPartition, start, end uint64) *proto.MetaPartitionView {
+	return &proto.MetaPartitionView{
+		PartitionID: mp.config.PartitionId,
+		Start:       start,
+		End:         end,
+		Members:     mp.txPartition().Members,
+	}
+}
+
+// Moves the inode into the trash of the partition of the root, as a client deletes it.
+func moveTestInodeToTrash(t *testing.T, mp *metaPartition, trashIno uint64, ino *Inode) *proto.TrashEntry {
+	name := proto.TrashEntryName(proto.RootIno, "file", time.Now())
+	dentry := &Dentry{ParentId: trashIno, Name: name, Inode: ino.Inode, Type: ino.Type}
+	if status := mp.fsmCreateDentry(dentry, false); status != proto.OpOk {
+		t.Fatalf("create dentry: status %v", status)
+	}
+	entry, err := proto.ParseTrashEntry(name, ino.Inode, ino.Type)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func checkTestInodeDeleted(t *testing.T, mp *metaPartition, ino uint64) {
+	t.Helper()
+	if item := mp.inodeTree.Get(NewInode(ino, 0)); item != nil && !item.(*Inode).ShouldDelete() {
+		t.Fatalf("expect inode %v deleted, got %v", ino, item)
+	}
+}
+
+func TestPurgeTrashEntry(t *testing.T) {
+	mp1, mp2, cleanup := newTestTxPartitions(t)
+	defer cleanup()
+	mp1.config.End = 999
+	trash := createTestInode(t, mp1, proto.RootIno, proto.TrashDirName, proto.Mode(os.ModeDir|0755))
+	trashIno, status := mp1.getTrashDir()
+	if status != proto.OpOk || trashIno != trash.Inode {
+		t.Fatalf("expect the trash %v, got %v status %v", trash.Inode, trashIno, status)
+	}
+	views := []*proto.MetaPartitionView{testPartitionView(mp1, 1, 999), testPartitionView(mp2, 1000, 1999)}
+
+	dir := createTestInode(t, mp2, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	file := createTestInode(t, mp2, dir.Inode, "file", proto.Mode(0644))
+	mp2.fsmDeleteDentry(&Dentry{ParentId: dir.Inode, Name: "file"})
+	entry := moveTestInodeToTrash(t, mp1, trashIno, file)
+
+	// the entry is kept if its inode is not unlinked
+	unreachable := *views[1]
+	unreachable.Members = []string{"127.0.0.1:1"}
+	mp1.purgeTrashEntry(entry, []*proto.MetaPartitionView{views[0], &unreachable})
+	checkTestDentry(t, mp1, trashIno, entry.Name, file.Inode)
+	if ino := mp2.inodeTree.Get(file).(*Inode); ino.ShouldDelete() || ino.GetNLink() != 1 {
+		t.Fatalf("expect the inode kept, got %v", ino)
+	}
+
+	mp1.purgeTrashEntry(entry, views)
+	checkTestDentry(t, mp1, trashIno, entry.Name, 0)
+	checkTestInodeDeleted(t, mp2, file.Inode)
+
+	// the entry of the inode purged already is deleted
+	other := createTestInode(t, mp2, dir.Inode, "other", proto.Mode(0644))
+	mp2.fsmDeleteDentry(&Dentry{ParentId: dir.Inode, Name: "other"})
+	entry = moveTestInodeToTrash(t, mp1, trashIno, other)
+	mp2.fsmUnlinkInode(NewInode(other.Inode, 0))
+	mp2.fsmEvictInode(NewInode(other.Inode, 0))
+	mp1.purgeTrashEntry(entry, views)
+	checkTestDentry(t, mp1, trashIno, entry.Name, 0)
+	checkTestInodeDeleted(t, mp2, other.Inode)
+
+	// the empty directory is purged as well
+	mp2.fsmDeleteDentry(&Dentry{ParentId: proto.RootIno, Name: "dir"})
+	entry = moveTestInodeToTrash(t, mp1, trashIno, dir)
+	mp1.purgeTrashEntry(entry, views)
+	checkTestDentry(t, mp1, trashIno, entry.Name, 0)
+	checkTestInodeDeleted(t, mp2, dir.Inode)
+}
@@ -0,0 +1,411 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	txCheckInterval   = 10 * time.Second
+	txTimeout         = 60 // seconds
+	txSendRetryLimit  = 10
+	txSendRetryPeriod = 100 * time.Millisecond
+)
+
+var txSequence uint64
+
+// TxRename renames a dentry in a transaction coordinated by this partition.
+// All the changes are prepared on the participants first, and only executed once the decision to commit has been
+// replicated, so an interrupted rename is resolved by the coordinator instead of being left half done.
+func (mp *metaPartition) TxRename(req *TxRenameReq, p *Packet) (err error) {
+	tx := mp.newRenameTx(req)
+	val, err := json.Marshal(tx)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMTxInit, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	if status := resp.(uint8); status != proto.OpOk {
+		p.PacketErrorWithBody(status, nil)
+		return
+	}
+
+	decision := proto.TxStateCommitted
+	status := mp.txPrepare(tx)
+	if status != proto.OpOk {
+		decision = proto.TxStateRolledBack
+	}
+	state, err := mp.txDecide(tx.TxID, decision)
+	if err != nil {
+		// the transaction will be resolved by the tx worker
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	tx.State = state
+	mp.txFinish(tx)
+
+	switch {
+	case state == proto.TxStateCommitted:
+		p.PacketOkReply()
+	case status != proto.OpOk:
+		p.PacketErrorWithBody(status, nil)
+	default:
+		p.PacketErrorWithBody(proto.OpAgain, nil)
+	}
+	return
+}
+
+func (mp *metaPartition) newRenameTx(req *TxRenameReq) *proto.TxInfo {
+	tx := &proto.TxInfo{
+		TxID: fmt.Sprintf("%d_%d_%d", mp.config.PartitionId,
+			time.Now().UnixNano(), atomic.AddUint64(&txSequence, 1)),
+		State:      proto.TxStateInit,
+		CreateTime: Now.GetCurrentTime().Unix(),
+	}
+	addOp := func(target proto.TxPartition, op *proto.TxOperation) {
+		for _, part := range tx.Participants {
+			if part.PartitionID == target.PartitionID {
+				part.Ops = append(part.Ops, op)
+				return
+			}
+		}
+		tx.Participants = append(tx.Participants, &proto.TxParticipant{
+			TxPartition: target,
+			Ops:         []*proto.TxOperation{op},
+		})
+	}
+
+	if req.OldInode == 0 {
+		addOp(req.DstPartition, &proto.TxOperation{
+			Type:     proto.TxOpCreateDentry,
+			ParentID: req.DstParentID,
+			Name:     req.DstName,
+			Inode:    req.Inode,
+			Mode:     req.Mode,
+			Shard:    req.DstShard,
+		})
+	} else {
+		addOp(req.DstPartition, &proto.TxOperation{
+			Type:     proto.TxOpUpdateDentry,
+			ParentID: req.DstParentID,
+			Name:     req.DstName,
+			Inode:    req.Inode,
+			OldInode: req.OldInode,
+			Mode:     req.Mode,
+		})
+	}
+	addOp(mp.txPartition(), &proto.TxOperation{
+		Type:     proto.TxOpDeleteDentry,
+		ParentID: req.SrcParentID,
+		Name:     req.SrcName,
+		OldInode: req.Inode,
+		Mode:     req.Mode,
+	})
+	if req.OldInode != 0 && req.OldInodePartition != nil {
+		addOp(*req.OldInodePartition, &proto.TxOperation{
+			Type:  proto.TxOpUnlinkInode,
+			Inode: req.OldInode,
+		})
+	}
+	return tx
+}
+
+func (mp *metaPartition) txPartition() proto.TxPartition {
+	target := proto.TxPartition{PartitionID: mp.config.PartitionId}
+	for _, peer := range mp.config.Peers {
+		target.Members = append(target.Members, peer.Addr)
+	}
+	return target
+}
+
+// Prepare the participants one by one, and stop at the first failure.
+func (mp *metaPartition) txPrepare(tx *proto.TxInfo) (status uint8) {
+	for _, part := range tx.Participants {
+		req := &proto.TxPrepareRequest{
+			VolName:     mp.config.VolName,
+			PartitionID: part.PartitionID,
+			TxID:        tx.TxID,
+			Coordinator: mp.txPartition(),
+			Ops:         part.Ops,
+			CreateTime:  tx.CreateTime,
+		}
+		status = mp.txSend(part.TxPartition, proto.OpMetaTxPrepare, opFSMTxPrepare, req, nil)
+		if status != proto.OpOk {
+			log.LogWarnf("txPrepare: tx(%v) partition(%v) status(%v)", tx.TxID, part.PartitionID, status)
+			return
+		}
+	}
+	return
+}
+
+// Replicate the decision of the transaction, and return the state actually recorded.
+func (mp *metaPartition) txDecide(txID string, decision uint8) (state uint8, err error) {
+	val, err := json.Marshal(&proto.TxInfo{TxID: txID, State: decision})
+	if err != nil {
+		return
+	}
+	resp, err := mp.Put(opFSMTxSetState, val)
+	if err != nil {
+		return
+	}
+	msg := resp.(*TxStateResponse)
+	if msg.Status != proto.OpOk {
+		err = errors.NewErrorf("[txDecide] tx(%v) status(%v)", txID, msg.Status)
+		return
+	}
+	state = msg.State
+	return
+}
+
+// Send the decision to all the participants, and forget the transaction once they all have acknowledged it.
+func (mp *metaPartition) txFinish(tx *proto.TxInfo) {
+	var (
+		opcode uint8
+		fsmOp  uint32
+	)
+	switch tx.State {
+	case proto.TxStateCommitted:
+		opcode, fsmOp = proto.OpMetaTxCommit, opFSMTxCommit
+	case proto.TxStateRolledBack:
+		opcode, fsmOp = proto.OpMetaTxRollback, opFSMTxRollback
+	default:
+		return
+	}
+	done := true
+	for _, part := range tx.Participants {
+		req := &proto.TxCommitRequest{
+			VolName:     mp.config.VolName,
+			PartitionID: part.PartitionID,
+			TxID:        tx.TxID,
+		}
+		if status := mp.txSend(part.TxPartition, opcode, fsmOp, req, nil); status != proto.OpOk {
+			log.LogWarnf("txFinish: tx(%v) state(%v) partition(%v) status(%v)",
+				tx.TxID, tx.State, part.PartitionID, status)
+			done = false
+		}
+	}
+	if !done {
+		return
+	}
+	val, err := json.Marshal(&proto.TxInfo{TxID: tx.TxID})
+	if err != nil {
+		return
+	}
+	if _, err = mp.Put(opFSMTxDelete, val); err != nil {
+		log.LogWarnf("txFinish: tx(%v) delete err(%v)", tx.TxID, err)
+	}
+}
+
+// txSend sends a transaction request to the target partition. Requests to this partition are submitted to raft
+// directly with the given fsm operation, others are sent to the members of the target partition.
+func (mp *metaPartition) txSend(target proto.TxPartition, opcode uint8, fsmOp uint32,
+	req interface{}, reply interface{}) (status uint8) {
+	if target.PartitionID == mp.config.PartitionId && fsmOp != 0 {
+		val, err := json.Marshal(req)
+		if err != nil {
+			return proto.OpErr
+		}
+		resp, err := mp.Put(fsmOp, val)
+		if err != nil {
+			return proto.OpAgain
+		}
+		return resp.(uint8)
+	}
+
+	p := NewPacketToTx(target.PartitionID, opcode)
+	if err := p.MarshalData(req); err != nil {
+		return proto.OpErr
+	}
+	status = proto.OpAgain
+	for i := 0; i < txSendRetryLimit; i++ {
+		for _, addr := range target.Members {
+			resp, err := mp.txSendToAddr(addr, p)
+			if err != nil {
+				log.LogWarnf("txSend: partition(%v) addr(%v) op(%v) err(%v)",
+					target.PartitionID, addr, p.GetOpMsg(), err)
+				continue
+			}
+			status = resp.ResultCode
+			if resp.ShouldRetry() {
+				continue
+			}
+			if status == proto.OpOk && reply != nil {
+				if err = resp.UnmarshalData(reply); err != nil {
+					status = proto.OpErr
+				}
+			}
+			return
+		}
+		time.Sleep(txSendRetryPeriod)
+	}
+	return
+}
+
+func (mp *metaPartition) txSendToAddr(addr string, p *Packet) (resp *Packet, err error) {
+	conn, err := mp.manager.connPool.GetConnect(addr)
+	if err != nil {
+		return
+	}
+	if err = p.WriteToConn(conn); err != nil {
+		mp.manager.connPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	resp = &Packet{}
+	if err = resp.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		mp.manager.connPool.PutConnect(conn, ForceClosedConnect)
+		return
+	}
+	mp.manager.connPool.PutConnect(conn, NoClosedConnect)
+	return
+}
+
+// TxPrepare prepares the operations of a participant.
+func (mp *metaPartition) TxPrepare(req *TxPrepareReq, p *Packet) (err error) {
+	return mp.txSubmit(opFSMTxPrepare, req, p)
+}
+
+// TxCommit commits the prepared operations of a participant.
+func (mp *metaPartition) TxCommit(req *TxCommitReq, p *Packet) (err error) {
+	return mp.txSubmit(opFSMTxCommit, req, p)
+}
+
+// TxRollback discards the prepared operations of a participant.
+func (mp *metaPartition) TxRollback(req *TxRollbackReq, p *Packet) (err error) {
+	return mp.txSubmit(opFSMTxRollback, req, p)
+}
+
+func (mp *metaPartition) txSubmit(fsmOp uint32, req interface{}, p *Packet) (err error) {
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(fsmOp, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// TxGetState returns the state of a transaction coordinated by this partition.
+func (mp *metaPartition) TxGetState(req *TxGetStateReq, p *Packet) (err error) {
+	tx, ok := mp.txTable.GetTx(req.TxID)
+	if !ok {
+		p.PacketErrorWithBody(proto.OpNotExistErr, nil)
+		return
+	}
+	reply, err := json.Marshal(&TxGetStateResp{State: tx.State})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// txWorker resolves the transactions left behind by a failed coordinator or participant.
+func (mp *metaPartition) txWorker() {
+	t := time.NewTicker(txCheckInterval)
+	for {
+		select {
+		case <-mp.stopC:
+			t.Stop()
+			return
+		case <-t.C:
+			if _, ok := mp.IsLeader(); !ok {
+				continue
+			}
+			mp.checkTransactions()
+		}
+	}
+}
+
+func (mp *metaPartition) checkTransactions() {
+	now := Now.GetCurrentTime().Unix()
+	for _, tx := range mp.txTable.Txs() {
+		if now-tx.CreateTime < txTimeout {
+			continue
+		}
+		if tx.State == proto.TxStateInit {
+			state, err := mp.txDecide(tx.TxID, proto.TxStateRolledBack)
+			if err != nil {
+				log.LogWarnf("checkTransactions: tx(%v) rollback err(%v)", tx.TxID, err)
+				continue
+			}
+			tx.State = state
+		}
+		log.LogWarnf("checkTransactions: partition(%v) resolve tx(%v) state(%v)",
+			mp.config.PartitionId, tx.TxID, tx.State)
+		mp.txFinish(tx)
+	}
+
+	for _, rec := range mp.txTable.TxRecords() {
+		if now-rec.CreateTime < txTimeout {
+			continue
+		}
+		state := proto.TxStateRolledBack
+		resp := &TxGetStateResp{}
+		req := &proto.TxGetStateRequest{
+			VolName:     mp.config.VolName,
+			PartitionID: rec.Coordinator.PartitionID,
+			TxID:        rec.TxID,
+		}
+		if rec.Coordinator.PartitionID == mp.config.PartitionId {
+			if tx, ok := mp.txTable.GetTx(rec.TxID); ok {
+				state = tx.State
+			}
+		} else {
+			switch status := mp.txSend(rec.Coordinator, proto.OpMetaTxGetState, 0, req, resp); status {
+			case proto.OpOk:
+				state = resp.State
+			case proto.OpNotExistErr:
+				// the coordinator only forgets a transaction after all the participants have acknowledged it
+			default:
+				log.LogWarnf("checkTransactions: tx(%v) get state status(%v)", rec.TxID, status)
+				continue
+			}
+		}
+		if state == proto.TxStateInit {
+			continue
+		}
+		fsmOp := uint32(opFSMTxRollback)
+		if state == proto.TxStateCommitted {
+			fsmOp = opFSMTxCommit
+		}
+		log.LogWarnf("checkTransactions: partition(%v) resolve record(%v) state(%v)",
+			mp.config.PartitionId, rec.TxID, state)
+		val, err := json.Marshal(&proto.TxCommitRequest{TxID: rec.TxID})
+		if err != nil {
+			continue
+		}
+		if _, err = mp.Put(fsmOp, val); err != nil {
+			log.LogWarnf("checkTransactions: record(%v) err(%v)", rec.TxID, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package metanode
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// Returns two partitions served on a local address, as the metanodes serving the transactions do.
+// The inodes of the second partition are numbered after the ones of the first.
+func newTestTxPartitions(t *testing.T) (mp1, mp2 *metaPartition, cleanup func()) {
+	mp1, cleanup1 := newTestPartition(t)
+	mp2, cleanup2 := newTestPartition(t)
+	mp2.config.PartitionId = 2
+	mp2.config.Cursor = 1000
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		cleanup1()
+		cleanup2()
+		t.Fatal(err)
+	}
+	m := &metadataManager{
+		connPool:   util.NewConnectPool(),
+		partitions: map[uint64]MetaPartition{1: mp1, 2: mp2},
+	}
+	for _, mp := range []*metaPartition{mp1, mp2} {
+		mp.manager = m
+		mp.config.Peers = []proto.Peer{{ID: mp.config.NodeId, Addr: ln.Addr().String()}}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					p := &Packet{}
+					if err := p.ReadFromConn(conn, proto.NoReadDeadlineTime); err != nil {
+						return
+					}
+					m.HandleMetadataOperation(conn, p, conn.RemoteAddr().String())
+				}
+			}()
+		}
+	}()
+	return mp1, mp2, func() {
+		ln.Close()
+		cleanup1()
+		cleanup2()
+	}
+}
+
+func checkTestDentry(t *testing.T, mp *metaPartition, parentID uint64, name string, ino uint64) {
+	t.Helper()
+	d, status := mp.getDentry(&Dentry{ParentId: parentID, Name: name})
+	if ino == 0 {
+		if status != proto.OpNotExistErr {
+			t.Fatalf("partition %v: expect no dentry %v, got %v", mp.config.PartitionId, name, d)
+		}
+		return
+	}
+	if status != proto.OpOk || d.Inode != ino {
+		t.Fatalf("partition %v: expect dentry %v of inode %v, got %v status %v", mp.config.PartitionId, name, ino, d, status)
+	}
+}
+
+// Checks the transactions to be forgotten and the items to be unlocked.
+func checkTestTxDone(t *testing.T, mps ...*metaPartition) {
+	t.Helper()
+	for _, mp := range mps {
+		if txs, recs := mp.txTable.Txs(), mp.txTable.TxRecords(); len(txs) != 0 || len(recs) != 0 {
+			t.Fatalf("partition %v: expect no transactions, got %v and records %v", mp.config.PartitionId, txs, recs)
+		}
+	}
+}
+
+func TestTxRename(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	file := createTestInode(t, mp, proto.RootIno, "a", proto.Mode(0644))
+	dir := createTestInode(t, mp, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	old := createTestInode(t, mp, dir.Inode, "b", proto.Mode(0644))
+
+	req := &TxRenameReq{
+		SrcParentID:       proto.RootIno,
+		SrcName:           "a",
+		DstParentID:       dir.Inode,
+		DstName:           "b",
+		Inode:             file.Inode,
+		Mode:              file.Type,
+		OldInode:          old.Inode,
+		DstPartition:      mp.txPartition(),
+		OldInodePartition: &proto.TxPartition{PartitionID: mp.config.PartitionId},
+	}
+	p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaTxRename)
+	if mp.TxRename(req, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("rename: status %v", p.ResultCode)
+	}
+	checkTestDentry(t, mp, proto.RootIno, "a", 0)
+	checkTestDentry(t, mp, dir.Inode, "b", file.Inode)
+	if nlink := mp.inodeTree.Get(old).(*Inode).GetNLink(); nlink != 0 {
+		t.Fatalf("expect the overwritten inode to be unlinked, got nlink %v", nlink)
+	}
+	checkTestTxDone(t, mp)
+
+	// the source is gone, so the rename is rejected without any change
+	p = NewPacketToTx(mp.config.PartitionId, proto.OpMetaTxRename)
+	req.OldInode, req.OldInodePartition = 0, nil
+	req.DstName = "c"
+	if mp.TxRename(req, p); p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("expect the missing source to be rejected, got status %v", p.ResultCode)
+	}
+	checkTestDentry(t, mp, dir.Inode, "c", 0)
+	checkTestTxDone(t, mp)
+}
+
+func TestTxRenameAcrossPartitions(t *testing.T) {
+	mp1, mp2, cleanup := newTestTxPartitions(t)
+	defer cleanup()
+	file := createTestInode(t, mp1, proto.RootIno, "a", proto.Mode(0644))
+	dir := createTestInode(t, mp2, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	req := &TxRenameReq{
+		SrcParentID:  proto.RootIno,
+		SrcName:      "a",
+		DstParentID:  dir.Inode,
+		DstName:      "b",
+		Inode:        file.Inode + 1,
+		Mode:         file.Type,
+		DstPartition: mp2.txPartition(),
+	}
+
+	// the destination is prepared before the source fails, and is rolled back
+	p := NewPacketToTx(mp1.config.PartitionId, proto.OpMetaTxRename)
+	if mp1.TxRename(req, p); p.ResultCode != proto.OpNotExistErr {
+		t.Fatalf("expect the mismatched source to be rejected, got status %v", p.ResultCode)
+	}
+	checkTestDentry(t, mp1, proto.RootIno, "a", file.Inode)
+	checkTestDentry(t, mp2, dir.Inode, "b", 0)
+	checkTestTxDone(t, mp1, mp2)
+
+	req.Inode = file.Inode
+	p = NewPacketToTx(mp1.config.PartitionId, proto.OpMetaTxRename)
+	if mp1.TxRename(req, p); p.ResultCode != proto.OpOk {
+		t.Fatalf("rename: status %v", p.ResultCode)
+	}
+	checkTestDentry(t, mp1, proto.RootIno, "a", 0)
+	checkTestDentry(t, mp2, dir.Inode, "b", file.Inode)
+	checkTestTxDone(t, mp1, mp2)
+}
+
+// The transaction left prepared by a failed coordinator is resolved by the coordinator after the timeout,
+// and the items are locked until then.
+func TestTxCoordinatorFailure(t *testing.T) {
+	mp1, mp2, cleanup := newTestTxPartitions(t)
+	defer cleanup()
+	dir := createTestInode(t, mp2, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+
+	prepare := func(name string) (*proto.TxInfo, *Inode) {
+		file := createTestInode(t, mp1, proto.RootIno, name, proto.Mode(0644))
+		tx := mp1.newRenameTx(&TxRenameReq{
+			SrcParentID:  proto.RootIno,
+			SrcName:      name,
+			DstParentID:  dir.Inode,
+			DstName:      name,
+			Inode:        file.Inode,
+			Mode:         file.Type,
+			DstPartition: mp2.txPartition(),
+		})
+		tx.CreateTime = Now.GetCurrentTime().Unix() - txTimeout
+		if status := mp1.fsmTxInit(tx); status != proto.OpOk {
+			t.Fatalf("init tx: status %v", status)
+		}
+		if status := mp1.txPrepare(tx); status != proto.OpOk {
+			t.Fatalf("prepare tx: status %v", status)
+		}
+		return tx, file
+	}
+
+	// undecided, which is rolled back
+	prepare("a")
+	if !mp2.txTable.IsDentryLocked(dir.Inode, "a") || !mp1.txTable.IsDentryLocked(proto.RootIno, "a") {
+		t.Fatalf("expect the dentries to be locked")
+	}
+	p := NewPacketToTx(mp2.config.PartitionId, proto.OpMetaCreateDentry)
+	if mp2.CreateDentry(&CreateDentryReq{ParentID: dir.Inode, Name: "a", Inode: 2000, Mode: proto.Mode(0644)}, p); p.ResultCode != proto.OpAgain {
+		t.Fatalf("expect the locked dentry to be retried, got status %v", p.ResultCode)
+	}
+	mp1.checkTransactions()
+	checkTestDentry(t, mp2, dir.Inode, "a", 0)
+	checkTestTxDone(t, mp1, mp2)
+	if mp1.txTable.IsDentryLocked(proto.RootIno, "a") {
+		t.Fatalf("expect the dentry to be unlocked")
+	}
+
+	// decided to commit, which is committed
+	tx, file := prepare("b")
+	if state, err := mp1.txDecide(tx.TxID, proto.TxStateCommitted); err != nil || state != proto.TxStateCommitted {
+		t.Fatalf("decide tx: state %v err %v", state, err)
+	}
+	mp1.checkTransactions()
+	checkTestDentry(t, mp1, proto.RootIno, "b", 0)
+	checkTestDentry(t, mp2, dir.Inode, "b", file.Inode)
+	checkTestTxDone(t, mp1, mp2)
+}
+
+// The participant resolves the record timed out by asking the coordinator.
+func TestTxParticipantTimeout(t *testing.T) {
+	mp1, mp2, cleanup := newTestTxPartitions(t)
+	defer cleanup()
+	dir := createTestInode(t, mp2, proto.RootIno, "dir", proto.Mode(os.ModeDir|0755))
+	expired := Now.GetCurrentTime().Unix() - txTimeout
+
+	prepare := func(txID, name string) {
+		if status := mp2.fsmTxPrepare(&proto.TxPrepareRequest{
+			TxID:        txID,
+			Coordinator: mp1.txPartition(),
+			Ops:         []*proto.TxOperation{{Type: proto.TxOpCreateDentry, ParentID: dir.Inode, Name: name, Inode: 2000, Mode: proto.Mode(0644)}},
+			CreateTime:  expired,
+		}); status != proto.OpOk {
+			t.Fatalf("prepare %v: status %v", txID, status)
+		}
+	}
+	decide := func(txID string, state uint8) {
+		if status := mp1.fsmTxInit(&proto.TxInfo{TxID: txID, CreateTime: Now.GetCurrentTime().Unix()}); status != proto.OpOk {
+			t.Fatalf("init %v: status %v", txID, status)
+		}
+		if state != proto.TxStateInit {
+			mp1.fsmTxSetState(&proto.TxInfo{TxID: txID, State: state})
+		}
+	}
+
+	prepare("committed", "a")
+	decide("committed", proto.TxStateCommitted)
+	prepare("undecided", "b")
+	decide("undecided", proto.TxStateInit)
+	// the coordinator forgets the transactions acknowledged by all the participants only
+	prepare("forgotten", "c")
+	mp2.checkTransactions()
+
+	checkTestDentry(t, mp2, dir.Inode, "a", 2000)
+	checkTestDentry(t, mp2, dir.Inode, "c", 0)
+	if _, ok := mp2.txTable.GetRecord("committed"); ok {
+		t.Fatalf("expect the committed record to be resolved")
+	}
+	if _, ok := mp2.txTable.GetRecord("forgotten"); ok {
+		t.Fatalf("expect the forgotten record to be rolled back")
+	}
+	if _, ok := mp2.txTable.GetRecord("undecided"); !ok || !mp2.txTable.IsDentryLocked(dir.Inode, "b") {
+		t.Fatalf("expect the undecided record to be kept")
+	}
+}
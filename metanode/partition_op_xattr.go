@@ -0,0 +1,127 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// SetXAttr sets an extended attribute of the inode.
+func (mp *metaPartition) SetXAttr(req *SetXAttrReq, p *Packet) (err error) {
+	if len(req.Key) == 0 || len(req.Key) > proto.XAttrNameMaxLen ||
+		len(req.Value) > proto.XAttrValueMaxLen {
+		p.PacketErrorWithBody(proto.OpArgMismatchErr, nil)
+		return
+	}
+	if req.Key == proto.DirShardXAttr {
+		p.PacketErrorWithBody(proto.OpNotPerm, nil)
+		return
+	}
+	if isACLXAttr(req.Key) {
+		if _, err = proto.ParseACL(req.Value); err != nil {
+			p.PacketErrorWithBody(proto.OpArgMismatchErr, []byte(err.Error()))
+			return
+		}
+		if status := mp.checkOwner(req.Inode, req.Caller); status != proto.OpOk {
+			p.PacketErrorWithBody(status, nil)
+			return
+		}
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMSetXAttr, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// GetXAttr returns the value of an extended attribute of the inode.
+func (mp *metaPartition) GetXAttr(req *GetXAttrReq, p *Packet) (err error) {
+	retMsg := mp.getSnapshotInode(req.SnapshotID, NewInode(req.Inode, 0))
+	if retMsg.Status != proto.OpOk {
+		p.PacketErrorWithBody(retMsg.Status, nil)
+		return
+	}
+	val, ok := retMsg.Msg.GetXAttr(req.Key)
+	if !ok {
+		p.PacketErrorWithBody(proto.OpNoAttrErr, nil)
+		return
+	}
+	reply, err := json.Marshal(&GetXAttrResp{Value: val})
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// ListXAttr returns the keys of the extended attributes of the inode.
+func (mp *metaPartition) ListXAttr(req *ListXAttrReq, p *Packet) (err error) {
+	retMsg := mp.getSnapshotInode(req.SnapshotID, NewInode(req.Inode, 0))
+	if retMsg.Status != proto.OpOk {
+		p.PacketErrorWithBody(retMsg.Status, nil)
+		return
+	}
+	resp := &ListXAttrResp{
+		Keys: retMsg.Msg.ListXAttr(),
+	}
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkWithBody(reply)
+	return
+}
+
+// RemoveXAttr removes an extended attribute of the inode.
+func (mp *metaPartition) RemoveXAttr(req *RemoveXAttrReq, p *Packet) (err error) {
+	if req.Key == proto.DirShardXAttr {
+		p.PacketErrorWithBody(proto.OpNotPerm, nil)
+		return
+	}
+	if isACLXAttr(req.Key) {
+		if status := mp.checkOwner(req.Inode, req.Caller); status != proto.OpOk {
+			p.PacketErrorWithBody(status, nil)
+			return
+		}
+	}
+	val, err := json.Marshal(req)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpErr, []byte(err.Error()))
+		return
+	}
+	resp, err := mp.Put(opFSMRemoveXAttr, val)
+	if err != nil {
+		p.PacketErrorWithBody(proto.OpAgain, []byte(err.Error()))
+		return
+	}
+	p.PacketErrorWithBody(resp.(uint8), nil)
+	return
+}
+
+// The ACLs are only changed by the owner of the inode.
+func isACLXAttr(key string) bool {
+	return key == proto.XAttrACLAccess || key == proto.XAttrACLDefault
+}
@@ -0,0 +1,176 @@
+package metanode
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The ACLs of an inode are only changed by the owner, while the other extended attributes are not checked.
+func TestACLXAttrCaller(t *testing.T) {
+	mp, cleanup := newTestPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	ino.Uid, ino.Gid = 1, 1
+	acl := proto.ACL{
+		{Tag: proto.ACLUserObj, Perm: 6},
+		{Tag: proto.ACLUser, Perm: 6, ID: 2},
+		{Tag: proto.ACLGroupObj, Perm: 4},
+		{Tag: proto.ACLMask, Perm: 6},
+		{Tag: proto.ACLOther, Perm: 4},
+	}.Marshal()
+	owner := &proto.Caller{Uid: 1, Groups: []uint32{1}}
+	other := &proto.Caller{Uid: 2, Groups: []uint32{1}}
+	set := func(key string, value []byte, c *proto.Caller) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetXAttr)
+		mp.SetXAttr(&SetXAttrReq{PartitionID: mp.config.PartitionId, Inode: ino.Inode, Key: key, Value: value, Caller: c}, p)
+		return p.ResultCode
+	}
+	remove := func(key string, c *proto.Caller) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaRemoveXAttr)
+		mp.RemoveXAttr(&RemoveXAttrReq{PartitionID: mp.config.PartitionId, Inode: ino.Inode, Key: key, Caller: c}, p)
+		return p.ResultCode
+	}
+
+	if status := set(proto.XAttrACLAccess, acl, other); status != proto.OpNotPerm {
+		t.Fatalf("expect the others not to set the ACL, got status %v", status)
+	}
+	if status := set(proto.XAttrACLDefault, acl, other); status != proto.OpNotPerm {
+		t.Fatalf("expect the others not to set the default ACL, got status %v", status)
+	}
+	if _, ok := ino.GetXAttr(proto.XAttrACLAccess); ok {
+		t.Fatalf("expect the ACL not to be set")
+	}
+	if status := set(proto.XAttrACLAccess, acl, owner); status != proto.OpOk {
+		t.Fatalf("expect the owner to set the ACL, got status %v", status)
+	}
+	if status := set(proto.XAttrACLAccess, acl, &proto.Caller{}); status != proto.OpOk {
+		t.Fatalf("expect root to set the ACL, got status %v", status)
+	}
+	if status := set("user.key", []byte("value"), other); status != proto.OpOk {
+		t.Fatalf("expect the other extended attributes not to be checked, got status %v", status)
+	}
+
+	if status := remove(proto.XAttrACLAccess, other); status != proto.OpNotPerm {
+		t.Fatalf("expect the others not to remove the ACL, got status %v", status)
+	}
+	if _, ok := ino.GetXAttr(proto.XAttrACLAccess); !ok {
+		t.Fatalf("expect the ACL to be kept")
+	}
+	if status := remove(proto.XAttrACLAccess, nil); status != proto.OpNotPerm {
+		t.Fatalf("expect the request without a caller not to remove the ACL, got status %v", status)
+	}
+	if status := set(proto.XAttrACLAccess, acl, nil); status != proto.OpNotPerm {
+		t.Fatalf("expect the request without a caller not to set the ACL, got status %v", status)
+	}
+	if status := remove(proto.XAttrACLAccess, owner); status != proto.OpOk {
+		t.Fatalf("expect the owner to remove the ACL, got status %v", status)
+	}
+
+	// the requests without a caller of the old clients are allowed only if the metanode is configured to
+	allowNoCaller = true
+	defer func() { allowNoCaller = false }()
+	if status := set(proto.XAttrACLAccess, acl, nil); status != proto.OpOk {
+		t.Fatalf("expect the request without a caller to set the ACL, got status %v", status)
+	}
+	if status := remove(proto.XAttrACLAccess, nil); status != proto.OpOk {
+		t.Fatalf("expect the request without a caller to remove the ACL, got status %v", status)
+	}
+}
+
+// The extended attributes are set and removed by the FSM, which checks the flags, and kept in the snapshot.
+func TestXAttrApply(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	ino := createTestInode(t, mp, proto.RootIno, "file", proto.Mode(0644))
+	set := func(inode uint64, key string, value []byte, flags uint32) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaSetXAttr)
+		mp.SetXAttr(&SetXAttrReq{PartitionID: mp.config.PartitionId, Inode: inode, Key: key, Value: value, Flags: flags}, p)
+		return p.ResultCode
+	}
+	remove := func(key string) uint8 {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaRemoveXAttr)
+		mp.RemoveXAttr(&RemoveXAttrReq{PartitionID: mp.config.PartitionId, Inode: ino.Inode, Key: key}, p)
+		return p.ResultCode
+	}
+	get := func(key string) ([]byte, uint8) {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaGetXAttr)
+		mp.GetXAttr(&GetXAttrReq{PartitionID: mp.config.PartitionId, Inode: ino.Inode, Key: key}, p)
+		if p.ResultCode != proto.OpOk {
+			return nil, p.ResultCode
+		}
+		resp := &GetXAttrResp{}
+		if err := json.Unmarshal(p.Data, resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Value, p.ResultCode
+	}
+	list := func() []string {
+		p := NewPacketToTx(mp.config.PartitionId, proto.OpMetaListXAttr)
+		mp.ListXAttr(&ListXAttrReq{PartitionID: mp.config.PartitionId, Inode: ino.Inode}, p)
+		resp := &ListXAttrResp{}
+		if err := json.Unmarshal(p.Data, resp); p.ResultCode != proto.OpOk || err != nil {
+			t.Fatalf("list: status %v err %v", p.ResultCode, err)
+		}
+		return resp.Keys
+	}
+
+	if status := set(ino.Inode, "user.a", []byte("a"), proto.XAttrReplace); status != proto.OpNoAttrErr {
+		t.Fatalf("expect the missing xattr not replaced, got status %v", status)
+	}
+	if status := set(ino.Inode, "user.a", []byte("a"), proto.XAttrCreate); status != proto.OpOk {
+		t.Fatalf("create: status %v", status)
+	}
+	if status := set(ino.Inode, "user.a", []byte("b"), proto.XAttrCreate); status != proto.OpExistErr {
+		t.Fatalf("expect the existing xattr not created, got status %v", status)
+	}
+	if status := set(ino.Inode, "user.a", []byte("b"), proto.XAttrReplace); status != proto.OpOk {
+		t.Fatalf("replace: status %v", status)
+	}
+	if status := set(ino.Inode, "user.c", nil, 0); status != proto.OpOk {
+		t.Fatalf("set: status %v", status)
+	}
+	if val, status := get("user.a"); status != proto.OpOk || string(val) != "b" {
+		t.Fatalf("expect the value replaced, got %q status %v", val, status)
+	}
+	if keys := list(); !reflect.DeepEqual(keys, []string{"user.a", "user.c"}) {
+		t.Fatalf("expect the keys set, got %v", keys)
+	}
+
+	// the requests refused before the FSM
+	if status := set(ino.Inode, strings.Repeat("k", proto.XAttrNameMaxLen+1), nil, 0); status != proto.OpArgMismatchErr {
+		t.Fatalf("expect the long key refused, got status %v", status)
+	}
+	if status := set(ino.Inode, "user.big", make([]byte, proto.XAttrValueMaxLen+1), 0); status != proto.OpArgMismatchErr {
+		t.Fatalf("expect the big value refused, got status %v", status)
+	}
+	if status := set(ino.Inode, proto.DirShardXAttr, nil, 0); status != proto.OpNotPerm {
+		t.Fatalf("expect the internal xattr refused, got status %v", status)
+	}
+	if status := set(ino.Inode+1, "user.a", nil, 0); status != proto.OpNotExistErr {
+		t.Fatalf("expect the missing inode refused, got status %v", status)
+	}
+
+	// the attributes are stored along with the partition
+	storeTestPartition(t, mp, 10)
+	loaded := loadTestPartition(t, mp)
+	if item := loaded.inodeTree.Get(NewInode(ino.Inode, 0)); item == nil ||
+		!reflect.DeepEqual(item.(*Inode).XAttrs, map[string][]byte{"user.a": []byte("b"), "user.c": {}}) {
+		t.Fatalf("expect the xattrs loaded, got %v", item)
+	}
+	if status := remove("user.a"); status != proto.OpOk {
+		t.Fatalf("remove: status %v", status)
+	}
+	if status := remove("user.a"); status != proto.OpNoAttrErr {
+		t.Fatalf("expect the removed xattr not found, got status %v", status)
+	}
+	if _, status := get("user.a"); status != proto.OpNoAttrErr {
+		t.Fatalf("expect the removed xattr not found, got status %v", status)
+	}
+	if keys := list(); !reflect.DeepEqual(keys, []string{"user.c"}) {
+		t.Fatalf("expect the keys left, got %v", keys)
+	}
+}
@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync/atomic"
 )
@@ -36,10 +38,16 @@ const (
 	snapshotBackup  = ".snapshot_backup"
 	inodeFile       = "inode"
 	dentryFile      = "dentry"
+	txTableFile     = "transaction"
+	fileLockFile    = "filelock"
+	quotaTaskFile   = "quotatask"
+	metaSnapshotDir = "snap_"  // followed by the snapshot ID
+	deltaFilePrefix = "delta_" // followed by the apply ID
 	applyIDFile     = "apply"
 	SnapshotSign    = ".sign"
 	metadataFile    = "meta"
 	metadataFileTmp = ".meta"
+	rocksDBDir      = "rocksdb"
 )
 
 func (mp *metaPartition) loadMetadata() (err error) {
@@ -186,7 +194,165 @@ func (mp *metaPartition) loadDentry(rootDir string) (err error) {
 	}
 }
 
+// Load the transactions from the snapshot.
+func (mp *metaPartition) loadTxTable(rootDir string) (err error) {
+	filename := path.Join(rootDir, txTableFile)
+	if _, err = os.Stat(filename); err != nil {
+		err = nil
+		return
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		err = errors.NewErrorf("[loadTxTable] ReadFile: %s", err.Error())
+		return
+	}
+	txTable := NewTxTable()
+	if err = txTable.Unmarshal(data); err != nil {
+		err = errors.NewErrorf("[loadTxTable] Unmarshal: %s", err.Error())
+		return
+	}
+	mp.txTable = txTable
+	return
+}
+
+// Load the file locks from the snapshot.
+func (mp *metaPartition) loadFileLocks(rootDir string) (err error) {
+	filename := path.Join(rootDir, fileLockFile)
+	if _, err = os.Stat(filename); err != nil {
+		err = nil
+		return
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		err = errors.NewErrorf("[loadFileLocks] ReadFile: %s", err.Error())
+		return
+	}
+	fileLocks := NewFileLockTable()
+	if err = fileLocks.Unmarshal(data); err != nil {
+		err = errors.NewErrorf("[loadFileLocks] Unmarshal: %s", err.Error())
+		return
+	}
+	mp.fileLocks = fileLocks
+	return
+}
+
+// Load the quota tasks from the snapshot.
+func (mp *metaPartition) loadQuotaTasks(rootDir string) (err error) {
+	filename := path.Join(rootDir, quotaTaskFile)
+	if _, err = os.Stat(filename); err != nil {
+		err = nil
+		return
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		err = errors.NewErrorf("[loadQuotaTasks] ReadFile: %s", err.Error())
+		return
+	}
+	quotaTasks := NewQuotaTaskTable()
+	if err = quotaTasks.Unmarshal(data); err != nil {
+		err = errors.NewErrorf("[loadQuotaTasks] Unmarshal: %s", err.Error())
+		return
+	}
+	mp.quotaTasks = quotaTasks
+	return
+}
+
+// Load the volume snapshots, each of which is stored in a sub-directory with its own inode and dentry files.
+func (mp *metaPartition) loadMetaSnapshots(rootDir string) (err error) {
+	fileInfos, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	snapshots := make(map[uint64]*metaSnapshot)
+	for _, fi := range fileInfos {
+		if !fi.IsDir() || !strings.HasPrefix(fi.Name(), metaSnapshotDir) {
+			continue
+		}
+		var id uint64
+		if id, err = strconv.ParseUint(strings.TrimPrefix(fi.Name(), metaSnapshotDir), 10, 64); err != nil {
+			err = errors.NewErrorf("[loadMetaSnapshots] invalid snapshot dir %s", fi.Name())
+			return
+		}
+		s := newMetaSnapshot(id)
+		dir := path.Join(rootDir, fi.Name())
+		err = readItems(path.Join(dir, inodeFile), func(data []byte) (err error) {
+			ino := NewInode(0, 0)
+			if err = ino.Unmarshal(data); err != nil {
+				return
+			}
+			s.inodeTree.ReplaceOrInsert(ino, true)
+			return
+		})
+		if err != nil {
+			err = errors.NewErrorf("[loadMetaSnapshots] snapshot %v inode: %s", id, err.Error())
+			return
+		}
+		err = readItems(path.Join(dir, dentryFile), func(data []byte) (err error) {
+			dentry := &Dentry{}
+			if err = dentry.Unmarshal(data); err != nil {
+				return
+			}
+			s.dentryTree.ReplaceOrInsert(dentry, true)
+			return
+		})
+		if err != nil {
+			err = errors.NewErrorf("[loadMetaSnapshots] snapshot %v dentry: %s", id, err.Error())
+			return
+		}
+		snapshots[id] = s
+	}
+	mp.snapshotsLock.Lock()
+	mp.snapshots = snapshots
+	mp.snapshotsLock.Unlock()
+	return
+}
+
+// Read the length prefixed items from the file, as written by storeInode and storeDentry.
+func readItems(filename string, fn func(data []byte) error) (err error) {
+	fp, err := os.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer fp.Close()
+	reader := bufio.NewReaderSize(fp, 4*1024*1024)
+	lenBuf := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(reader, lenBuf); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(lenBuf))
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return
+		}
+		if err = fn(data); err != nil {
+			return
+		}
+	}
+}
+
 func (mp *metaPartition) loadApplyID(rootDir string) (err error) {
+	applyID, cursor, err := readApplyID(rootDir)
+	if err != nil {
+		return
+	}
+	mp.applyID = applyID
+	if cursor > atomic.LoadUint64(&mp.config.Cursor) {
+		atomic.StoreUint64(&mp.config.Cursor, cursor)
+	}
+	return
+}
+
+// Read the apply ID and the cursor of the snapshot, which are zero if not stored.
+func readApplyID(rootDir string) (applyID, cursor uint64, err error) {
 	filename := path.Join(rootDir, applyIDFile)
 	if _, err = os.Stat(filename); err != nil {
 		err = nil
@@ -205,24 +371,126 @@ func (mp *metaPartition) loadApplyID(rootDir string) (err error) {
 		err = errors.NewErrorf("[loadApplyID]: ApplyID is empty")
 		return
 	}
-	var cursor uint64
 	if strings.Contains(string(data), "|") {
-		_, err = fmt.Sscanf(string(data), "%d|%d", &mp.applyID, &cursor)
+		_, err = fmt.Sscanf(string(data), "%d|%d", &applyID, &cursor)
 	} else {
-		_, err = fmt.Sscanf(string(data), "%d", &mp.applyID)
+		_, err = fmt.Sscanf(string(data), "%d", &applyID)
 	}
 	if err != nil {
 		err = errors.NewErrorf("[loadApplyID] ReadApplyID: %s", err.Error())
 		return
 	}
+	return
+}
 
-	if cursor > atomic.LoadUint64(&mp.config.Cursor) {
-		atomic.StoreUint64(&mp.config.Cursor, cursor)
+// Open the RocksDB of the partition, and return the snapshot directory holding the rest of the
+// partition as of the apply ID of the DB, or none if the partition starts over from the raft log.
+func (mp *metaPartition) loadRocksDB() (dir string, err error) {
+	store, err := openRocksMetaStore(path.Join(mp.config.RootDir, rocksDBDir), metadataCachedItems)
+	if err != nil {
+		err = errors.NewErrorf("[loadRocksDB] %s", err.Error())
+		return
+	}
+	mp.metaStore = store
+	mp.inodeTree = store.inodeTree
+	mp.dentryTree = store.dentryTree
+	applyID, ok, err := store.ApplyID()
+	if err != nil {
+		err = errors.NewErrorf("[loadRocksDB] %s", err.Error())
+		return
+	}
+	dir = path.Join(mp.config.RootDir, snapshotDir)
+	if !ok {
+		// The DB is new, or an interrupted load is discarded. The inode and dentry files
+		// stored by the memory store are imported, if any.
+		if _, err = os.Stat(path.Join(dir, inodeFile)); err != nil {
+			err = nil
+			dir = ""
+			if err = store.BeginLoad(); err == nil {
+				err = store.EndLoad()
+			}
+			return
+		}
+		if err = mp.importSnapshot(dir); err != nil {
+			err = errors.NewErrorf("[loadRocksDB] import %s: %s", dir, err.Error())
+		}
+		return
+	}
+	tmpDir := path.Join(mp.config.RootDir, snapshotDirTmp)
+	if _, e := os.Stat(path.Join(tmpDir, SnapshotSign)); e == nil {
+		if id, _, e := readApplyID(tmpDir); e == nil && id == applyID {
+			// the DB is flushed, but the snapshot is not renamed by the last store
+			if err = mp.renameSnapshotDir(); err != nil {
+				return
+			}
+		}
 	}
+	// TODO Unhandled errors
+	os.RemoveAll(tmpDir)
+	id, _, err := readApplyID(dir)
+	if err != nil {
+		return
+	}
+	if id != applyID {
+		err = errors.NewErrorf("[loadRocksDB] apply ID %v of the snapshot mismatches %v of the DB", id, applyID)
+	}
+	return
+}
 
+// Import the inode and dentry files of the snapshot into the DB.
+func (mp *metaPartition) importSnapshot(rootDir string) (err error) {
+	applyID, _, err := readApplyID(rootDir)
+	if err != nil {
+		return
+	}
+	if err = mp.metaStore.BeginLoad(); err != nil {
+		return
+	}
+	err = readItems(path.Join(rootDir, inodeFile), func(data []byte) (err error) {
+		ino := NewInode(0, 0)
+		if err = ino.Unmarshal(data); err != nil {
+			return
+		}
+		mp.inodeTree.ReplaceOrInsert(ino, true)
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = readItems(path.Join(rootDir, dentryFile), func(data []byte) (err error) {
+		dentry := &Dentry{}
+		if err = dentry.Unmarshal(data); err != nil {
+			return
+		}
+		mp.dentryTree.ReplaceOrInsert(dentry, true)
+		return
+	})
+	if err != nil {
+		return
+	}
+	if err = mp.metaStore.EndLoad(); err != nil {
+		return
+	}
+	if err = mp.metaStore.Flush(applyID, mp.inodeTree.GetTree(), mp.dentryTree.GetTree()); err != nil {
+		return
+	}
+	log.LogInfof("[importSnapshot] partition(%v) imported %v inodes and %v dentries of apply ID %v",
+		mp.config.PartitionId, mp.inodeTree.Len(), mp.dentryTree.Len(), applyID)
 	return
 }
 
+// Rebuild the free list and the cursor from the inodes stored in the DB.
+func (mp *metaPartition) loadFreeList() {
+	mp.inodeTree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		mp.checkAndInsertFreeList(ino)
+		if mp.config.Cursor < ino.Inode {
+			mp.config.Cursor = ino.Inode
+		}
+		return true
+	})
+}
+
 func (mp *metaPartition) persistMetadata() (err error) {
 	if err = mp.config.checkMeta(); err != nil {
 		err = errors.NewErrorf("[persistMetadata]->%s", err.Error())
@@ -355,6 +623,53 @@ func (mp *metaPartition) storeDentry(rootDir string,
 	return
 }
 
+func (mp *metaPartition) storeTxTable(rootDir string, sm *storeMsg) (err error) {
+	if len(sm.txTable) == 0 {
+		return
+	}
+	filename := path.Join(rootDir, txTableFile)
+	err = ioutil.WriteFile(filename, sm.txTable, 0755)
+	return
+}
+
+func (mp *metaPartition) storeFileLocks(rootDir string, sm *storeMsg) (err error) {
+	if len(sm.fileLocks) == 0 {
+		return
+	}
+	filename := path.Join(rootDir, fileLockFile)
+	err = ioutil.WriteFile(filename, sm.fileLocks, 0755)
+	return
+}
+
+func (mp *metaPartition) storeQuotaTasks(rootDir string, sm *storeMsg) (err error) {
+	if len(sm.quotaTasks) == 0 {
+		return
+	}
+	filename := path.Join(rootDir, quotaTaskFile)
+	err = ioutil.WriteFile(filename, sm.quotaTasks, 0755)
+	return
+}
+
+func (mp *metaPartition) storeMetaSnapshots(rootDir string, sm *storeMsg) (err error) {
+	for _, s := range sm.snapshots {
+		dir := path.Join(rootDir, fmt.Sprintf("%s%d", metaSnapshotDir, s.id))
+		if err = os.MkdirAll(dir, 0775); err != nil {
+			return
+		}
+		msg := &storeMsg{
+			inodeTree:  s.inodeTree,
+			dentryTree: s.dentryTree,
+		}
+		if _, err = mp.storeInode(dir, msg); err != nil {
+			return
+		}
+		if _, err = mp.storeDentry(dir, msg); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (mp *metaPartition) deleteInodeFile() {
 	filename := path.Join(mp.config.RootDir, inodeFile)
 	// TODO Unhandled errors
@@ -25,8 +25,13 @@ import (
 type storeMsg struct {
 	command    uint32
 	applyIndex uint64
-	inodeTree  *BTree
-	dentryTree *BTree
+	inodeTree  MetaTree
+	dentryTree MetaTree
+	txTable    []byte
+	fileLocks  []byte
+	quotaTasks []byte
+	snapshots  []*metaSnapshot
+	changes    *treeChanges
 }
 
 func (mp *metaPartition) startSchedule(curIndex uint64) {
@@ -91,6 +96,12 @@ func (mp *metaPartition) startSchedule(curIndex uint64) {
 					}
 				}
 				if maxMsg != nil {
+					// the dropped messages are stored along with the picked one
+					for _, msg := range msgs {
+						if msg != maxMsg {
+							maxMsg.changes = mergeChanges(maxMsg.changes, msg.changes)
+						}
+					}
 					go dumpFunc(maxMsg)
 				}
 				msgs = msgs[:0]
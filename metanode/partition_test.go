@@ -0,0 +1,68 @@
+package metanode
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+)
+
+// testRaft applies the commands submitted to the partition directly, as the leader of a single replica.
+type testRaft struct {
+	raftstore.Partition
+	mp    *metaPartition
+	index uint64
+}
+
+func (r *testRaft) Submit(cmd []byte) (resp interface{}, err error) {
+	r.index++
+	return r.mp.Apply(cmd, r.index)
+}
+
+func (r *testRaft) LeaderTerm() (leaderID, term uint64) {
+	return r.mp.config.NodeId, 1
+}
+
+func (r *testRaft) IsRaftLeader() bool {
+	return true
+}
+
+// Returns a partition whose trees are in memory and whose files are in a temporary directory,
+// which is removed by the returned function.
+func newTestPartition(t *testing.T) (*metaPartition, func()) {
+	dir, err := ioutil.TempDir("", "metanode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &MetaPartitionConfig{
+		PartitionId: 1,
+		NodeId:      1,
+		VolName:     "test",
+		Start:       proto.RootIno,
+		End:         math.MaxUint64,
+		RootDir:     dir,
+	}
+	mp := NewMetaPartition(conf, nil).(*metaPartition)
+	root := NewInode(proto.RootIno, proto.Mode(os.ModeDir|0755))
+	mp.inodeTree.ReplaceOrInsert(root, true)
+	mp.config.Cursor = proto.RootIno
+	mp.raftPartition = &testRaft{mp: mp}
+	return mp, func() { os.RemoveAll(dir) }
+}
+
+// Creates an inode under the parent directly in the trees of the partition.
+func createTestInode(t *testing.T, mp *metaPartition, parentID uint64, name string, mode uint32) *Inode {
+	mp.config.Cursor++
+	ino := NewInode(mp.config.Cursor, mode)
+	if status := mp.fsmCreateInode(ino); status != proto.OpOk {
+		t.Fatalf("create inode %v: status %v", name, status)
+	}
+	dentry := &Dentry{ParentId: parentID, Name: name, Inode: ino.Inode, Type: mode}
+	if status := mp.fsmCreateDentry(dentry, false); status != proto.OpOk {
+		t.Fatalf("create dentry %v: status %v", name, status)
+	}
+	return ino
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// QuotaTask defines the directory trees to be accounted to a quota, or to be removed from it, by the partition.
+type QuotaTask struct {
+	ID      uint64   `json:"id"` // the apply ID of the task
+	QuotaID uint32   `json:"qid"`
+	Remove  bool     `json:"remove"`
+	Dirs    []uint64 `json:"dirs"`
+}
+
+// QuotaTaskTable keeps the quota tasks of a meta partition, which are run by the leader until they succeed.
+// It is modified by the FSM only, so that the tasks are kept across the restarts and the leader changes.
+type QuotaTaskTable struct {
+	sync.RWMutex
+	Tasks map[uint64]*QuotaTask `json:"tasks"`
+}
+
+// NewQuotaTaskTable returns a new QuotaTaskTable.
+func NewQuotaTaskTable() *QuotaTaskTable {
+	return &QuotaTaskTable{
+		Tasks: make(map[uint64]*QuotaTask),
+	}
+}
+
+// Put adds the task.
+func (t *QuotaTaskTable) Put(task *QuotaTask) {
+	t.Lock()
+	t.Tasks[task.ID] = task
+	t.Unlock()
+}
+
+// Delete removes the task done.
+func (t *QuotaTaskTable) Delete(id uint64) {
+	t.Lock()
+	delete(t.Tasks, id)
+	t.Unlock()
+}
+
+// List returns the tasks in the order they are added.
+func (t *QuotaTaskTable) List() (tasks []*QuotaTask) {
+	t.RLock()
+	for _, task := range t.Tasks {
+		tasks = append(tasks, task)
+	}
+	t.RUnlock()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return
+}
+
+// Marshal marshals the QuotaTaskTable into a byte array.
+func (t *QuotaTaskTable) Marshal() ([]byte, error) {
+	t.RLock()
+	defer t.RUnlock()
+	return json.Marshal(t)
+}
+
+// Unmarshal unmarshals the QuotaTaskTable.
+func (t *QuotaTaskTable) Unmarshal(data []byte) (err error) {
+	t.Lock()
+	defer t.Unlock()
+	if err = json.Unmarshal(data, t); err != nil {
+		return
+	}
+	if t.Tasks == nil {
+		t.Tasks = make(map[uint64]*QuotaTask)
+	}
+	return
+}
+
+// quotaUsage is the usage of the quotas of an inode.
+type quotaUsage struct {
+	quotaIDs []uint32
+	files    uint64
+	bytes    uint64
+}
+
+// Returns the usage of the quotas of the inode, which is nil if the inode is not accounted to any quota.
+// Only the FSM changes the inodes, so that the usage taken before and after a change by the FSM is consistent.
+func inodeQuotaUsage(ino *Inode) *quotaUsage {
+	ino.RLock()
+	defer ino.RUnlock()
+	if len(ino.QuotaIDs) == 0 || ino.Flag&DeleteMarkFlag != 0 {
+		return nil
+	}
+	usage := &quotaUsage{quotaIDs: append([]uint32(nil), ino.QuotaIDs...), files: 1}
+	if proto.IsRegular(ino.Type) {
+		usage.bytes = ino.Size
+	}
+	return usage
+}
+
+// quotaUsageTable keeps the usage of the quotas in a meta partition. It is counted once the partition is loaded,
+// and then updated by the FSM as the inodes are changed.
+type quotaUsageTable struct {
+	sync.Mutex
+	usages map[uint32]*proto.QuotaUsage
+}
+
+func newQuotaUsageTable(usages []*proto.QuotaUsage) *quotaUsageTable {
+	t := &quotaUsageTable{usages: make(map[uint32]*proto.QuotaUsage, len(usages))}
+	for _, u := range usages {
+		t.usages[u.QuotaID] = u
+	}
+	return t
+}
+
+// update replaces the usage of an inode before a change with the one after it.
+func (t *quotaUsageTable) update(before, after *quotaUsage) {
+	if before == nil && after == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if before != nil {
+		for _, id := range before.quotaIDs {
+			if u, ok := t.usages[id]; ok {
+				u.Files -= minUint64(u.Files, before.files)
+				u.Bytes -= minUint64(u.Bytes, before.bytes)
+				if u.Files == 0 && u.Bytes == 0 {
+					delete(t.usages, id)
+				}
+			}
+		}
+	}
+	if after != nil {
+		for _, id := range after.quotaIDs {
+			u, ok := t.usages[id]
+			if !ok {
+				u = &proto.QuotaUsage{QuotaID: id}
+				t.usages[id] = u
+			}
+			u.Files += after.files
+			u.Bytes += after.bytes
+		}
+	}
+}
+
+// list returns a copy of the usage of the quotas, in the order of the quota IDs.
+func (t *quotaUsageTable) list() []*proto.QuotaUsage {
+	t.Lock()
+	usages := make([]*proto.QuotaUsage, 0, len(t.usages))
+	for _, u := range t.usages {
+		usage := *u
+		usages = append(usages, &usage)
+	}
+	t.Unlock()
+	sort.Slice(usages, func(i, j int) bool { return usages[i].QuotaID < usages[j].QuotaID })
+	return usages
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,893 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/btree"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	rocksBlockCacheSize  = 32 * util.MB // of each meta partition
+	rocksWriteBufferSize = 4 * util.MB
+	rocksWriteBatchSize  = 4096 // items written at once while loading or clearing the DB
+)
+
+var (
+	// apply ID and the numbers of the items, written along with the items they cover
+	rocksApplyKey = []byte("m_apply")
+	// set while the DB is loaded from a snapshot, so that an interrupted load is discarded at start
+	rocksLoadingKey = []byte("m_loading")
+
+	errRocksStoreClosed = errors.New("rocksdb store is closed")
+	errStaleTreeView    = errors.New("tree snapshot taken before the store is reset")
+)
+
+// rocksMetaStore keeps the inodes and the dentries of a meta partition in a RocksDB instance.
+// The changes are cached in memory by the trees, and flushed along with the apply ID each time
+// the partition is stored, so the DB always holds the items as of a stored apply ID.
+//
+// The trees have no way to return the errors, so the store fails once the trees fail to read or
+// write the DB. The items read from a failed store may be wrong, so it is never flushed again, and
+// the partition is recovered from the items flushed last and the raft log once it is reloaded.
+type rocksMetaStore struct {
+	dir        string
+	db         *gorocksdb.DB
+	lock       sync.Mutex
+	cond       *sync.Cond
+	refs       int // the reads in progress, which the close waits for
+	closing    bool
+	err        error      // the first error of the trees, which fails the store
+	flushLock  sync.Mutex // serializes the flushes and the loads
+	inodeTree  *RocksTree
+	dentryTree *RocksTree
+}
+
+func openRocksMetaStore(dir string, cachedItems int) (s *rocksMetaStore, err error) {
+	tableOpts := gorocksdb.NewDefaultBlockBasedTableOptions()
+	tableOpts.SetBlockCache(gorocksdb.NewLRUCache(rocksBlockCacheSize))
+	opts := gorocksdb.NewDefaultOptions()
+	opts.SetBlockBasedTableFactory(tableOpts)
+	opts.SetCreateIfMissing(true)
+	opts.SetWriteBufferSize(rocksWriteBufferSize)
+	opts.SetMaxWriteBufferNumber(2)
+	opts.SetCompression(gorocksdb.NoCompression)
+	db, err := gorocksdb.OpenDb(opts, dir)
+	if err != nil {
+		err = fmt.Errorf("open rocksdb %v: %v", dir, err)
+		return
+	}
+	s = &rocksMetaStore{dir: dir, db: db}
+	s.cond = sync.NewCond(&s.lock)
+	s.inodeTree = newRocksTree(s, inodeKeyPrefix, cachedItems)
+	s.dentryTree = newRocksTree(s, dentryKeyPrefix, cachedItems)
+	var data []byte
+	if data, err = s.getBytes(nil, rocksApplyKey); err != nil {
+		s.Close()
+		return
+	}
+	if len(data) == 24 {
+		s.inodeTree.count = int(binary.BigEndian.Uint64(data[8:16]))
+		s.dentryTree.count = int(binary.BigEndian.Uint64(data[16:24]))
+	}
+	return
+}
+
+// Close waits for the reads in progress and closes the DB.
+// The trees return no items afterwards.
+func (s *rocksMetaStore) Close() {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closing = true
+	for s.refs > 0 {
+		s.cond.Wait()
+	}
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+}
+
+// Err returns the error the store failed with, or nil.
+func (s *rocksMetaStore) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *rocksMetaStore) fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	msg := fmt.Sprintf("rocksdb %v failed: %v", s.dir, err)
+	log.LogError(msg)
+	exporter.Warning(msg)
+}
+
+func (s *rocksMetaStore) acquire() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closing {
+		return false
+	}
+	s.refs++
+	return true
+}
+
+func (s *rocksMetaStore) release() {
+	s.lock.Lock()
+	if s.refs--; s.refs == 0 {
+		s.cond.Broadcast()
+	}
+	s.lock.Unlock()
+}
+
+// ApplyID returns the apply ID of the items in the DB, which is not ok if the DB holds no items
+// of a completed store, that is, it is new or an interrupted load is discarded.
+func (s *rocksMetaStore) ApplyID() (applyID uint64, ok bool, err error) {
+	var data []byte
+	if data, err = s.getBytes(nil, rocksLoadingKey); err != nil || data != nil {
+		return
+	}
+	if data, err = s.getBytes(nil, rocksApplyKey); err != nil || len(data) < 8 {
+		return
+	}
+	return binary.BigEndian.Uint64(data), true, nil
+}
+
+func (s *rocksMetaStore) getBytes(snap *gorocksdb.Snapshot, key []byte) (data []byte, err error) {
+	if !s.acquire() {
+		return nil, errRocksStoreClosed
+	}
+	defer s.release()
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	if snap != nil {
+		ro.SetSnapshot(snap)
+	}
+	return s.db.GetBytes(ro, key)
+}
+
+// Returns the item of the key, or nil if the store is closed. The store fails on a read error.
+func (s *rocksMetaStore) get(snap *gorocksdb.Snapshot, key []byte) (item BtreeItem) {
+	data, err := s.getBytes(snap, key)
+	if err == errRocksStoreClosed {
+		return nil
+	}
+	if err == nil && data != nil {
+		item, err = unmarshalRocksItem(key[0], data)
+	}
+	if err != nil {
+		s.fail(fmt.Errorf("get %v: %v", key, err))
+		return nil
+	}
+	return
+}
+
+func (s *rocksMetaStore) write(wb *gorocksdb.WriteBatch, sync bool) (err error) {
+	if !s.acquire() {
+		return errRocksStoreClosed
+	}
+	defer s.release()
+	wo := gorocksdb.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	wo.SetSync(sync)
+	return s.db.Write(wo, wb)
+}
+
+func (s *rocksMetaStore) snapshot() *gorocksdb.Snapshot {
+	if !s.acquire() {
+		return nil
+	}
+	defer s.release()
+	return s.db.NewSnapshot()
+}
+
+func (s *rocksMetaStore) releaseSnapshot(snap *gorocksdb.Snapshot) {
+	if snap == nil || !s.acquire() {
+		return
+	}
+	defer s.release()
+	s.db.ReleaseSnapshot(snap)
+}
+
+// Calls fn with the keys and the values in [lower, upper) of the DB snapshot until it returns false.
+func (s *rocksMetaStore) scan(snap *gorocksdb.Snapshot, lower, upper []byte, fn func(key, value []byte) bool) (err error) {
+	if !s.acquire() {
+		return
+	}
+	defer s.release()
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	if snap != nil {
+		ro.SetSnapshot(snap)
+	}
+	it := s.db.NewIterator(ro)
+	defer it.Close()
+	for it.Seek(lower); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, upper) >= 0 || !fn(key, it.Value().Data()) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// Deletes the items with the prefix from the DB.
+func (s *rocksMetaStore) deleteItems(prefix byte) (err error) {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	err = s.scan(nil, []byte{prefix}, []byte{prefix + 1}, func(key, value []byte) bool {
+		wb.Delete(key)
+		if wb.Count() >= rocksWriteBatchSize {
+			if err = s.write(wb, false); err != nil {
+				return false
+			}
+			wb.Clear()
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	return s.write(wb, false)
+}
+
+// BeginLoad clears the DB to load the items, of a raft snapshot or the snapshot files, into the trees,
+// which are written to the DB directly until EndLoad. The DB is marked being loaded until flushed.
+func (s *rocksMetaStore) BeginLoad() (err error) {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	if err = s.Err(); err != nil {
+		return
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(rocksLoadingKey, []byte{1})
+	if err = s.write(wb, true); err != nil {
+		return
+	}
+	for _, t := range []*RocksTree{s.inodeTree, s.dentryTree} {
+		if err = s.deleteItems(t.prefix); err != nil {
+			return
+		}
+		t.beginLoad()
+	}
+	return
+}
+
+// EndLoad writes the rest of the loaded items.
+func (s *rocksMetaStore) EndLoad() (err error) {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	for _, t := range []*RocksTree{s.inodeTree, s.dentryTree} {
+		if err = t.endLoad(); err != nil {
+			return
+		}
+	}
+	return s.Err()
+}
+
+// Flush writes the changes in the snapshots of the trees to the DB atomically, along with the apply ID
+// the snapshots are taken at, then the written items are no longer kept in the cache if not recently used.
+func (s *rocksMetaStore) Flush(applyID uint64, inodeTree, dentryTree MetaTree) (err error) {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	if err = s.Err(); err != nil {
+		return
+	}
+	views := []*rocksTreeView{inodeTree.(*rocksTreeView), dentryTree.(*rocksTreeView)}
+	for _, v := range views {
+		if !v.tree.current(v) {
+			return errStaleTreeView
+		}
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for _, v := range views {
+		v.cache.Ascend(func(i BtreeItem) bool {
+			c := i.(*rocksCacheItem)
+			if c.dirty == 0 {
+				return true
+			}
+			if c.item == nil {
+				wb.Delete(c.key)
+				return true
+			}
+			var data []byte
+			if data, err = marshalRocksItem(c.item); err != nil {
+				return false
+			}
+			wb.Put(c.key, data)
+			return true
+		})
+		if err != nil {
+			return
+		}
+	}
+	state := make([]byte, 24)
+	binary.BigEndian.PutUint64(state[0:8], applyID)
+	binary.BigEndian.PutUint64(state[8:16], uint64(views[0].count))
+	binary.BigEndian.PutUint64(state[16:24], uint64(views[1].count))
+	wb.Put(rocksApplyKey, state)
+	wb.Delete(rocksLoadingKey)
+	if err = s.write(wb, true); err != nil {
+		return
+	}
+	for _, v := range views {
+		v.tree.clean(v)
+	}
+	return
+}
+
+func marshalRocksItem(item BtreeItem) ([]byte, error) {
+	switch it := item.(type) {
+	case *Inode:
+		return it.Marshal()
+	case *Dentry:
+		return it.Marshal()
+	}
+	return nil, fmt.Errorf("unknown item type %T", item)
+}
+
+func unmarshalRocksItem(prefix byte, data []byte) (item BtreeItem, err error) {
+	switch prefix {
+	case inodeKeyPrefix:
+		ino := NewInode(0, 0)
+		err = ino.Unmarshal(data)
+		item = ino
+	case dentryKeyPrefix:
+		dentry := &Dentry{}
+		err = dentry.Unmarshal(data)
+		item = dentry
+	default:
+		err = fmt.Errorf("unknown item prefix %v", prefix)
+	}
+	return
+}
+
+// rocksCacheItem is an item cached by a RocksTree, ordered by the key in the DB.
+// The item is nil if it is deleted, and dirty is the epoch of the change not yet flushed, or 0.
+type rocksCacheItem struct {
+	key   []byte
+	item  BtreeItem
+	dirty uint64
+}
+
+// Less tests whether the key of the current item is less than the given one.
+func (c *rocksCacheItem) Less(than BtreeItem) bool {
+	return bytes.Compare(c.key, than.(*rocksCacheItem).key) < 0
+}
+
+// Copy returns a copy of the cached item.
+func (c *rocksCacheItem) Copy() BtreeItem {
+	nc := *c
+	if c.item != nil {
+		nc.item = c.item.Copy()
+	}
+	return &nc
+}
+
+// RocksTree is the tree of the inodes or the dentries stored in RocksDB.
+// The cache, a copy-on-write btree like BTree, holds the changed items until they are flushed,
+// and the recently used ones up to the limit. The snapshot of the tree is the clone of the cache
+// over the snapshot of the DB.
+type RocksTree struct {
+	sync.Mutex
+	store      *rocksMetaStore
+	prefix     byte
+	cache      *btree.BTree
+	lru        *list.List // keys of the cached items, the recently used first
+	lruItems   map[string]*list.Element
+	maxCached  int
+	count      int
+	dirtyItems int
+	epoch      uint64 // epoch of the changes, advanced by each snapshot of the tree
+	evictions  uint64 // advanced whenever the items may be evicted
+	resets     uint64
+	load       *gorocksdb.WriteBatch // items being loaded
+	loadErr    error                 // the error of the load, which drops the rest of the items
+}
+
+func newRocksTree(store *rocksMetaStore, prefix byte, maxCached int) *RocksTree {
+	return &RocksTree{
+		store:     store,
+		prefix:    prefix,
+		cache:     btree.New(defaultBTreeDegree),
+		lru:       list.New(),
+		lruItems:  make(map[string]*list.Element),
+		maxCached: maxCached,
+		epoch:     1,
+	}
+}
+
+// Returns the cached item of the key, reading it into the cache on a miss, or nil if it does not exist.
+// It is called with the tree unlocked, and returns with the tree locked.
+func (t *RocksTree) lookup(key []byte) *rocksCacheItem {
+	probe := &rocksCacheItem{key: key}
+	for {
+		t.Lock()
+		if c := t.cache.Get(probe); c != nil {
+			return c.(*rocksCacheItem)
+		}
+		evictions := t.evictions
+		t.Unlock()
+
+		item := t.store.get(nil, key)
+
+		t.Lock()
+		if c := t.cache.Get(probe); c != nil {
+			return c.(*rocksCacheItem)
+		}
+		if evictions != t.evictions {
+			// the item read may have been changed and evicted meanwhile
+			t.Unlock()
+			continue
+		}
+		if item == nil {
+			return nil
+		}
+		c := &rocksCacheItem{key: key, item: item}
+		t.cache.ReplaceOrInsert(c)
+		t.touch(key)
+		t.evict()
+		return c
+	}
+}
+
+// Returns the cached item to be changed, which is not shared with the snapshots.
+func (t *RocksTree) change(c *rocksCacheItem) *rocksCacheItem {
+	c = t.cache.CopyGet(c).(*rocksCacheItem)
+	t.markDirty(c)
+	return c
+}
+
+func (t *RocksTree) markDirty(c *rocksCacheItem) {
+	if c.dirty == 0 {
+		t.dirtyItems++
+	}
+	c.dirty = t.epoch
+}
+
+func (t *RocksTree) touch(key []byte) {
+	if e, ok := t.lruItems[string(key)]; ok {
+		t.lru.MoveToFront(e)
+		return
+	}
+	t.lruItems[string(key)] = t.lru.PushFront(key)
+}
+
+// Evicts the least recently used items, which are not changed, beyond the limit.
+func (t *RocksTree) evict() {
+	for n := t.lru.Len(); n > 0 && t.cache.Len()-t.dirtyItems > t.maxCached; n-- {
+		e := t.lru.Back()
+		key := e.Value.([]byte)
+		c := t.cache.Get(&rocksCacheItem{key: key})
+		if c != nil && c.(*rocksCacheItem).dirty != 0 {
+			t.lru.MoveToFront(e)
+			continue
+		}
+		t.lru.Remove(e)
+		delete(t.lruItems, string(key))
+		if c != nil {
+			t.cache.Delete(c)
+		}
+	}
+}
+
+// Get returns the object of the given key in the tree.
+func (t *RocksTree) Get(key BtreeItem) (item BtreeItem) {
+	if c := t.lookup(treeKey(key)); c != nil && c.item != nil {
+		item = c.item
+		t.touch(c.key)
+	}
+	t.Unlock()
+	return
+}
+
+// CopyGet returns the object of the given key to be changed.
+func (t *RocksTree) CopyGet(key BtreeItem) (item BtreeItem) {
+	if c := t.lookup(treeKey(key)); c != nil && c.item != nil {
+		item = t.change(c).item
+		t.touch(c.key)
+	}
+	t.Unlock()
+	return
+}
+
+// CopyFind calls fn with the object of the given key to be changed, with the tree locked.
+func (t *RocksTree) CopyFind(key BtreeItem, fn func(i BtreeItem)) {
+	var item BtreeItem
+	if c := t.lookup(treeKey(key)); c != nil && c.item != nil {
+		item = t.change(c).item
+		t.touch(c.key)
+	}
+	fn(item)
+	t.Unlock()
+}
+
+// Has checks if the key exists in the tree.
+func (t *RocksTree) Has(key BtreeItem) bool {
+	return t.Get(key) != nil
+}
+
+// Delete deletes the object by the given key.
+func (t *RocksTree) Delete(key BtreeItem) (item BtreeItem) {
+	if c := t.lookup(treeKey(key)); c != nil && c.item != nil {
+		item = c.item
+		c = t.change(c)
+		c.item = nil
+		t.count--
+	}
+	t.Unlock()
+	return
+}
+
+// ReplaceOrInsert inserts the item, or replaces the existing one if replace is true.
+// It returns the existing item, and whether the item is inserted.
+func (t *RocksTree) ReplaceOrInsert(key BtreeItem, replace bool) (item BtreeItem, ok bool) {
+	k := treeKey(key)
+	t.Lock()
+	if t.load != nil {
+		defer t.Unlock()
+		t.loadItem(k, key)
+		return nil, true
+	}
+	t.Unlock()
+
+	c := t.lookup(k)
+	defer t.Unlock()
+	if c != nil && c.item != nil {
+		if !replace {
+			return c.item, false
+		}
+		item = c.item
+	} else {
+		t.count++
+	}
+	if c == nil {
+		c = &rocksCacheItem{key: k}
+		t.cache.ReplaceOrInsert(c)
+	}
+	c = t.change(c)
+	c.item = key
+	t.touch(k)
+	return item, true
+}
+
+// Ascend calls the iterator for every item in the tree, on a snapshot of the tree.
+func (t *RocksTree) Ascend(fn func(i BtreeItem) bool) {
+	v := t.view()
+	defer v.release()
+	v.Ascend(fn)
+}
+
+// AscendRange calls the iterator for the items in [greaterOrEqual, lessThan), on a snapshot of the tree.
+func (t *RocksTree) AscendRange(greaterOrEqual, lessThan BtreeItem, iterator func(i BtreeItem) bool) {
+	v := t.view()
+	defer v.release()
+	v.AscendRange(greaterOrEqual, lessThan, iterator)
+}
+
+// AscendGreaterOrEqual calls the iterator for the items not less than the pivot, on a snapshot of the tree.
+func (t *RocksTree) AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem) bool) {
+	v := t.view()
+	defer v.release()
+	v.AscendGreaterOrEqual(pivot, iterator)
+}
+
+// GetTree returns the read-only snapshot of the tree.
+func (t *RocksTree) GetTree() MetaTree {
+	return t.view()
+}
+
+// Reset deletes all the items of the tree. The store fails if the items are not deleted from the DB.
+func (t *RocksTree) Reset() {
+	t.store.flushLock.Lock()
+	defer t.store.flushLock.Unlock()
+	if err := t.store.deleteItems(t.prefix); err != nil {
+		t.store.fail(fmt.Errorf("reset: %v", err))
+	}
+	t.Lock()
+	t.reset()
+	t.Unlock()
+}
+
+// Len returns the number of the items in the tree.
+func (t *RocksTree) Len() (size int) {
+	t.Lock()
+	size = t.count
+	t.Unlock()
+	return
+}
+
+func (t *RocksTree) reset() {
+	t.cache = btree.New(defaultBTreeDegree)
+	t.lru.Init()
+	t.lruItems = make(map[string]*list.Element)
+	t.count = 0
+	t.dirtyItems = 0
+	t.evictions++
+	t.resets++
+}
+
+func (t *RocksTree) beginLoad() {
+	t.Lock()
+	defer t.Unlock()
+	t.reset()
+	if t.load != nil {
+		t.load.Destroy()
+	}
+	t.load = gorocksdb.NewWriteBatch()
+	t.loadErr = nil
+}
+
+// Adds the item to the batch being loaded. Once it fails, the rest of the items are dropped,
+// and the load fails at the end.
+func (t *RocksTree) loadItem(key []byte, item BtreeItem) {
+	if t.loadErr != nil {
+		return
+	}
+	data, err := marshalRocksItem(item)
+	if err == nil {
+		t.load.Put(key, data)
+		if t.load.Count() >= rocksWriteBatchSize {
+			err = t.store.write(t.load, false)
+			t.load.Clear()
+		}
+	}
+	if err != nil {
+		t.loadErr = fmt.Errorf("load %v: %v", key, err)
+		return
+	}
+	t.count++
+}
+
+func (t *RocksTree) endLoad() (err error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.load == nil {
+		return
+	}
+	if err = t.loadErr; err == nil {
+		err = t.store.write(t.load, true)
+	}
+	t.load.Destroy()
+	t.load = nil
+	t.loadErr = nil
+	t.evictions++
+	return
+}
+
+func (t *RocksTree) view() *rocksTreeView {
+	t.Lock()
+	v := &rocksTreeView{
+		tree:   t,
+		cache:  t.cache.Clone(),
+		snap:   t.store.snapshot(),
+		count:  t.count,
+		epoch:  t.epoch,
+		resets: t.resets,
+	}
+	t.epoch++
+	t.Unlock()
+	runtime.SetFinalizer(v, (*rocksTreeView).release)
+	return v
+}
+
+// Tests whether the snapshot is taken since the tree is reset last.
+func (t *RocksTree) current(v *rocksTreeView) bool {
+	t.Lock()
+	defer t.Unlock()
+	return v.resets == t.resets
+}
+
+// Marks the items flushed from the snapshot clean, unless changed after the snapshot is taken.
+func (t *RocksTree) clean(v *rocksTreeView) {
+	t.Lock()
+	defer t.Unlock()
+	v.cache.Ascend(func(i BtreeItem) bool {
+		c := i.(*rocksCacheItem)
+		if c.dirty == 0 {
+			return true
+		}
+		item := t.cache.Get(c)
+		if item == nil {
+			return true
+		}
+		if cur := item.(*rocksCacheItem); cur.dirty == 0 || cur.dirty > v.epoch {
+			return true
+		} else if cur.item == nil {
+			t.cache.Delete(cur)
+		} else {
+			t.cache.CopyGet(cur).(*rocksCacheItem).dirty = 0
+		}
+		t.dirtyItems--
+		return true
+	})
+	t.evictions++
+	t.evict()
+}
+
+// rocksTreeView is the read-only snapshot of a RocksTree.
+type rocksTreeView struct {
+	tree   *RocksTree
+	cache  *btree.BTree
+	snap   *gorocksdb.Snapshot
+	count  int
+	epoch  uint64
+	resets uint64
+	once   sync.Once
+}
+
+func (v *rocksTreeView) release() {
+	v.once.Do(func() {
+		v.tree.store.releaseSnapshot(v.snap)
+	})
+}
+
+// Get returns the object of the given key in the snapshot.
+func (v *rocksTreeView) Get(key BtreeItem) BtreeItem {
+	k := treeKey(key)
+	if c := v.cache.Get(&rocksCacheItem{key: k}); c != nil {
+		return c.(*rocksCacheItem).item
+	}
+	if v.snap == nil {
+		return nil
+	}
+	return v.tree.store.get(v.snap, k)
+}
+
+// CopyGet is the same as Get, since the snapshot is not changed.
+func (v *rocksTreeView) CopyGet(key BtreeItem) BtreeItem {
+	return v.Get(key)
+}
+
+// CopyFind calls fn with the object of the given key.
+func (v *rocksTreeView) CopyFind(key BtreeItem, fn func(i BtreeItem)) {
+	fn(v.Get(key))
+}
+
+// Has checks if the key exists in the snapshot.
+func (v *rocksTreeView) Has(key BtreeItem) bool {
+	return v.Get(key) != nil
+}
+
+// Delete panics since the snapshot is read-only.
+func (v *rocksTreeView) Delete(key BtreeItem) BtreeItem {
+	panic("delete from the snapshot of a rocksdb tree")
+}
+
+// ReplaceOrInsert panics since the snapshot is read-only.
+func (v *rocksTreeView) ReplaceOrInsert(key BtreeItem, replace bool) (BtreeItem, bool) {
+	panic("insert into the snapshot of a rocksdb tree")
+}
+
+// Reset panics since the snapshot is read-only.
+func (v *rocksTreeView) Reset() {
+	panic("reset the snapshot of a rocksdb tree")
+}
+
+// Ascend calls the iterator for every item in the snapshot.
+func (v *rocksTreeView) Ascend(fn func(i BtreeItem) bool) {
+	v.ascend(nil, nil, fn)
+}
+
+// AscendRange calls the iterator for the items in [greaterOrEqual, lessThan).
+func (v *rocksTreeView) AscendRange(greaterOrEqual, lessThan BtreeItem, iterator func(i BtreeItem) bool) {
+	v.ascend(treeKey(greaterOrEqual), treeKey(lessThan), iterator)
+}
+
+// AscendGreaterOrEqual calls the iterator for the items not less than the pivot.
+func (v *rocksTreeView) AscendGreaterOrEqual(pivot BtreeItem, iterator func(i BtreeItem) bool) {
+	v.ascend(treeKey(pivot), nil, iterator)
+}
+
+// GetTree returns the snapshot itself.
+func (v *rocksTreeView) GetTree() MetaTree {
+	return v
+}
+
+// Len returns the number of the items in the snapshot.
+func (v *rocksTreeView) Len() int {
+	return v.count
+}
+
+// Merges the items of the DB snapshot in [lower, upper) with the cached ones, which take the
+// place of the stored items of the same keys, and are skipped if deleted. The iteration stops,
+// and the store fails, on a read error.
+func (v *rocksTreeView) ascend(lower, upper []byte, fn func(i BtreeItem) bool) {
+	if lower == nil {
+		lower = []byte{v.tree.prefix}
+	}
+	if upper == nil {
+		upper = []byte{v.tree.prefix + 1}
+	}
+	var (
+		s       = v.tree.store
+		it      *gorocksdb.Iterator
+		stopped bool
+	)
+	if v.snap != nil && s.acquire() {
+		defer s.release()
+		ro := gorocksdb.NewDefaultReadOptions()
+		defer ro.Destroy()
+		ro.SetFillCache(false)
+		ro.SetSnapshot(v.snap)
+		it = s.db.NewIterator(ro)
+		defer it.Close()
+		it.Seek(lower)
+	}
+	valid := func() bool {
+		return it != nil && it.Valid() && bytes.Compare(it.Key().Data(), upper) < 0
+	}
+	// emits the stored items before the key, or all the rest if the key is nil
+	emit := func(key []byte) bool {
+		for ; valid(); it.Next() {
+			if key != nil && bytes.Compare(it.Key().Data(), key) >= 0 {
+				return true
+			}
+			item, err := unmarshalRocksItem(v.tree.prefix, append([]byte(nil), it.Value().Data()...))
+			if err != nil {
+				s.fail(fmt.Errorf("unmarshal %v: %v", it.Key().Data(), err))
+				return false
+			}
+			if !fn(item) {
+				return false
+			}
+		}
+		return true
+	}
+	v.cache.AscendRange(&rocksCacheItem{key: lower}, &rocksCacheItem{key: upper}, func(i BtreeItem) bool {
+		c := i.(*rocksCacheItem)
+		if !emit(c.key) {
+			stopped = true
+			return false
+		}
+		if valid() && bytes.Equal(it.Key().Data(), c.key) {
+			it.Next()
+		}
+		if c.item != nil && !fn(c.item) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if !stopped {
+		emit(nil)
+	}
+	if it != nil {
+		if err := it.Err(); err != nil {
+			s.fail(fmt.Errorf("iterate: %v", err))
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package metanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/tecbot/gorocksdb"
+)
+
+func openTestRocksStore(t *testing.T, dir string, cachedItems int) *rocksMetaStore {
+	t.Helper()
+	s, err := openRocksMetaStore(dir, cachedItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestRocksStore(t *testing.T, cachedItems int) (*rocksMetaStore, string, func()) {
+	dir, err := ioutil.TempDir("", "rocks_tree_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := openTestRocksStore(t, dir, cachedItems)
+	return s, dir, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func flushTestRocksStore(t *testing.T, s *rocksMetaStore, applyID uint64) {
+	t.Helper()
+	if err := s.Flush(applyID, s.inodeTree.GetTree(), s.dentryTree.GetTree()); err != nil {
+		t.Fatalf("flush at %v: %v", applyID, err)
+	}
+}
+
+// Returns the inodes of the tree with their uids.
+func testTreeInodes(tree MetaTree) (inodes []string) {
+	tree.Ascend(func(i BtreeItem) bool {
+		ino := i.(*Inode)
+		inodes = append(inodes, fmt.Sprintf("%v:%v", ino.Inode, ino.Uid))
+		return true
+	})
+	return
+}
+
+func checkTestTreeInodes(t *testing.T, tree MetaTree, expect ...string) {
+	t.Helper()
+	if inodes := testTreeInodes(tree); fmt.Sprint(inodes) != fmt.Sprint(expect) {
+		t.Fatalf("expect inodes %v, got %v", expect, inodes)
+	}
+	if tree.Len() != len(expect) {
+		t.Fatalf("expect %v inodes, got %v", len(expect), tree.Len())
+	}
+}
+
+// The items flushed are kept across the reopen along with the apply ID, while the changes after the flush are not.
+func TestRocksTreeFlush(t *testing.T) {
+	s, dir, cleanup := newTestRocksStore(t, 10)
+	defer cleanup()
+	if _, ok, err := s.ApplyID(); err != nil || ok {
+		t.Fatalf("expect no apply ID of a new store, got %v err %v", ok, err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		s.inodeTree.ReplaceOrInsert(NewInode(i, proto.Mode(0644)), true)
+	}
+	s.dentryTree.ReplaceOrInsert(&Dentry{ParentId: 1, Name: "a", Inode: 2}, true)
+	flushTestRocksStore(t, s, 10)
+
+	ino := s.inodeTree.CopyGet(NewInode(2, 0)).(*Inode)
+	ino.Uid = 100
+	s.inodeTree.Delete(NewInode(3, 0))
+	s.inodeTree.ReplaceOrInsert(NewInode(4, 0), true)
+	checkTestTreeInodes(t, s.inodeTree, "1:0", "2:100", "4:0")
+	s.Close()
+
+	s = openTestRocksStore(t, dir, 10)
+	if applyID, ok, err := s.ApplyID(); err != nil || !ok || applyID != 10 {
+		t.Fatalf("expect apply ID 10, got %v %v err %v", applyID, ok, err)
+	}
+	checkTestTreeInodes(t, s.inodeTree, "1:0", "2:0", "3:0")
+	if d, ok := s.dentryTree.Get(&Dentry{ParentId: 1, Name: "a"}).(*Dentry); !ok || d.Inode != 2 {
+		t.Fatalf("expect the dentry flushed, got %v", d)
+	}
+	if s.dentryTree.Len() != 1 {
+		t.Fatalf("expect 1 dentry, got %v", s.dentryTree.Len())
+	}
+	s.Close()
+}
+
+// The items not changed are evicted beyond the limit, and read from the DB again, while the changed ones are
+// kept until they are flushed.
+func TestRocksTreeEviction(t *testing.T) {
+	s, _, cleanup := newTestRocksStore(t, 2)
+	defer cleanup()
+	tree := s.inodeTree
+	for i := uint64(1); i <= 10; i++ {
+		tree.ReplaceOrInsert(NewInode(i, 0), true)
+	}
+	if tree.cache.Len() != 10 {
+		t.Fatalf("expect the changed items cached, got %v", tree.cache.Len())
+	}
+	flushTestRocksStore(t, s, 1)
+	if tree.cache.Len() > 2 || tree.dirtyItems != 0 {
+		t.Fatalf("expect at most 2 items cached, got %v dirty %v", tree.cache.Len(), tree.dirtyItems)
+	}
+	for i := uint64(1); i <= 10; i++ {
+		if ino, ok := tree.Get(NewInode(i, 0)).(*Inode); !ok || ino.Inode != i {
+			t.Fatalf("expect inode %v, got %v", i, ino)
+		}
+	}
+	if tree.cache.Len() > 2 {
+		t.Fatalf("expect at most 2 items cached, got %v", tree.cache.Len())
+	}
+	if tree.Get(NewInode(11, 0)) != nil {
+		t.Fatalf("expect no inode 11")
+	}
+}
+
+// A view is not changed by the changes after it is taken, nor by their flush.
+func TestRocksTreeView(t *testing.T) {
+	s, _, cleanup := newTestRocksStore(t, 2)
+	defer cleanup()
+	tree := s.inodeTree
+	for i := uint64(1); i <= 5; i++ {
+		tree.ReplaceOrInsert(NewInode(i, 0), true)
+	}
+	flushTestRocksStore(t, s, 1)
+
+	view := tree.GetTree()
+	tree.CopyGet(NewInode(1, 0)).(*Inode).Uid = 100
+	tree.Delete(NewInode(2, 0))
+	tree.ReplaceOrInsert(NewInode(6, 0), true)
+	checkTestTreeInodes(t, view, "1:0", "2:0", "3:0", "4:0", "5:0")
+	checkTestTreeInodes(t, tree, "1:100", "3:0", "4:0", "5:0", "6:0")
+
+	flushTestRocksStore(t, s, 2)
+	checkTestTreeInodes(t, view, "1:0", "2:0", "3:0", "4:0", "5:0")
+	if view.Get(NewInode(2, 0)) == nil || view.Get(NewInode(6, 0)) != nil {
+		t.Fatalf("expect the view to get the items before the changes")
+	}
+	var inodes []uint64
+	view.AscendRange(NewInode(2, 0), NewInode(4, 0), func(i BtreeItem) bool {
+		inodes = append(inodes, i.(*Inode).Inode)
+		return true
+	})
+	if fmt.Sprint(inodes) != "[2 3]" {
+		t.Fatalf("expect inodes [2 3] in the range, got %v", inodes)
+	}
+	view.(*rocksTreeView).release()
+
+	// the view taken before the reset is not flushed
+	stale := tree.GetTree()
+	tree.Reset()
+	if tree.Len() != 0 || tree.Get(NewInode(1, 0)) != nil {
+		t.Fatalf("expect the tree reset")
+	}
+	if err := s.Flush(3, stale, s.dentryTree.GetTree()); err != errStaleTreeView {
+		t.Fatalf("expect the stale view refused, got %v", err)
+	}
+}
+
+// A load replaces the items, and the DB holds no apply ID until the load is flushed.
+func TestRocksTreeLoad(t *testing.T) {
+	s, dir, cleanup := newTestRocksStore(t, 2)
+	defer cleanup()
+	s.inodeTree.ReplaceOrInsert(NewInode(100, 0), true)
+	flushTestRocksStore(t, s, 1)
+
+	if err := s.BeginLoad(); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 5; i++ {
+		s.inodeTree.ReplaceOrInsert(NewInode(i, 0), true)
+	}
+	if err := s.EndLoad(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTreeInodes(t, s.inodeTree, "1:0", "2:0", "3:0", "4:0", "5:0")
+	if _, ok, err := s.ApplyID(); err != nil || ok {
+		t.Fatalf("expect no apply ID of the load not flushed, got %v err %v", ok, err)
+	}
+	s.Close()
+
+	// the load interrupted is discarded at the reopen
+	s = openTestRocksStore(t, dir, 2)
+	if _, ok, err := s.ApplyID(); err != nil || ok {
+		t.Fatalf("expect the interrupted load discarded, got %v err %v", ok, err)
+	}
+	if err := s.BeginLoad(); err != nil {
+		t.Fatal(err)
+	}
+	s.inodeTree.ReplaceOrInsert(NewInode(1, 0), true)
+	if err := s.EndLoad(); err != nil {
+		t.Fatal(err)
+	}
+	flushTestRocksStore(t, s, 2)
+	if applyID, ok, err := s.ApplyID(); err != nil || !ok || applyID != 2 {
+		t.Fatalf("expect apply ID 2, got %v %v err %v", applyID, ok, err)
+	}
+	checkTestTreeInodes(t, s.inodeTree, "1:0")
+	s.Close()
+}
+
+// The store fails on a bad item read, and is never flushed again.
+func TestRocksTreeFail(t *testing.T) {
+	s, _, cleanup := newTestRocksStore(t, 2)
+	defer cleanup()
+	s.inodeTree.ReplaceOrInsert(NewInode(1, 0), true)
+	flushTestRocksStore(t, s, 1)
+	wo := gorocksdb.NewDefaultWriteOptions()
+	defer wo.Destroy()
+	if err := s.db.Put(wo, treeKey(NewInode(2, 0)), []byte("bad")); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.inodeTree.Get(NewInode(2, 0)) != nil {
+		t.Fatalf("expect no bad item")
+	}
+	if s.Err() == nil {
+		t.Fatalf("expect the store failed")
+	}
+	checkTestTreeInodes(t, s.inodeTree.GetTree(), "1:0")
+	if err := s.Flush(2, s.inodeTree.GetTree(), s.dentryTree.GetTree()); err != s.Err() {
+		t.Fatalf("expect the flush refused, got %v", err)
+	}
+	if err := s.BeginLoad(); err != s.Err() {
+		t.Fatalf("expect the load refused, got %v", err)
+	}
+}
+
+// The inodes and the dentries stored by the memory store are imported into the DB at the first load.
+func TestLoadRocksDB(t *testing.T) {
+	mp, cleanup := newTestCheckpointPartition(t)
+	defer cleanup()
+	createTestInodes(t, mp, "base", 10)
+	storeTestPartition(t, mp, 10)
+	defer func() { metadataStore = metadataStoreMemory }()
+
+	metadataStore = metadataStoreRocksDB
+	loaded := loadTestPartition(t, mp)
+	checkTestPartitionLoaded(t, mp, loaded)
+	if applyID, ok, err := loaded.metaStore.ApplyID(); err != nil || !ok || applyID != 10 {
+		t.Fatalf("expect apply ID 10 imported, got %v %v err %v", applyID, ok, err)
+	}
+
+	// the partition is stored in the DB afterwards
+	loaded.trackChanges()
+	createTestInodes(t, loaded, "new", 5)
+	storeTestPartition(t, loaded, 20)
+	inodes, dentries := testPartitionItems(loaded)
+	loaded.metaStore.Close()
+	reloaded := loadTestPartition(t, loaded)
+	defer reloaded.metaStore.Close()
+	if gotInodes, gotDentries := testPartitionItems(reloaded); !reflect.DeepEqual(gotInodes, inodes) ||
+		!reflect.DeepEqual(gotDentries, dentries) {
+		t.Fatalf("expect inodes %v dentries %v, got %v %v", inodes, dentries, gotInodes, gotDentries)
+	}
+	if reloaded.applyID != 20 {
+		t.Fatalf("expect apply ID 20, got %v", reloaded.applyID)
+	}
+	if _, err := os.Stat(path.Join(mp.config.RootDir, snapshotDir, inodeFile)); err == nil {
+		t.Fatalf("expect no inode file stored along with the DB")
+	}
+
+	// and is no longer loaded by the memory store
+	metadataStore = metadataStoreMemory
+	conf := *mp.config
+	if err := NewMetaPartition(&conf, nil).(*metaPartition).load(); err == nil {
+		t.Fatalf("expect the partition in the DB refused by the memory store")
+	}
+}
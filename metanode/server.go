@@ -15,10 +15,13 @@
 package metanode
 
 import (
+	"fmt"
 	"io"
 	"net"
+	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -67,6 +70,8 @@ func (m *MetaNode) serveConn(conn net.Conn, stopC chan uint8) {
 	c.SetKeepAlive(true)
 	c.SetNoDelay(true)
 	remoteAddr := conn.RemoteAddr().String()
+	// the ticket presented by the client of the connection
+	var ticket *cryptoutil.Ticket
 	for {
 		select {
 		case <-stopC:
@@ -80,6 +85,21 @@ func (m *MetaNode) serveConn(conn net.Conn, stopC chan uint8) {
 			}
 			return
 		}
+		if p.Opcode == proto.OpAuthenticate {
+			ticket = m.authenticateConn(p, remoteAddr)
+			if err := p.WriteToConn(conn); err != nil {
+				log.LogError("serve MetaNode: ", err.Error())
+				return
+			}
+			continue
+		}
+		if err := m.checkTicket(ticket, p); err != nil {
+			log.LogWarnf("serve MetaNode: remote(%v) op(%v) err(%v)", remoteAddr, p.GetOpMsg(), err)
+			// the client is expected to reconnect with a new ticket
+			p.PacketErrorWithBody(proto.OpAuthErr, []byte(err.Error()))
+			p.WriteToConn(conn)
+			return
+		}
 		// Start a goroutine for packet handling. Do not block connection read goroutine.
 		go func() {
 			if err := m.handlePacket(conn, p, remoteAddr); err != nil {
@@ -96,3 +116,38 @@ func (m *MetaNode) handlePacket(conn net.Conn, p *Packet,
 	err = m.metadataManager.HandleMetadataOperation(conn, p, remoteAddr)
 	return
 }
+
+// Verify the token of the connection, and returns the ticket carried by it.
+func (m *MetaNode) authenticateConn(p *Packet, remoteAddr string) (ticket *cryptoutil.Ticket) {
+	if !m.authenticate {
+		p.PacketOkReply()
+		return
+	}
+	t, err := proto.ExtractAPIAccessToken(string(p.Data), proto.MetaServiceID, m.serviceKey)
+	if err != nil {
+		log.LogWarnf("[authenticateConn] remote(%v) err(%v)", remoteAddr, err)
+		p.PacketErrorWithBody(proto.OpAuthErr, []byte(err.Error()))
+		return
+	}
+	p.PacketOkReply()
+	return &t
+}
+
+// Check whether the ticket of the connection grants the operation. The operations sent by the master,
+// other metanodes and datanodes require the tickets of the services, and unknown operations are rejected.
+func (m *MetaNode) checkTicket(ticket *cryptoutil.Ticket, p *Packet) (err error) {
+	if !m.authenticate {
+		return
+	}
+	rsc, ok := proto.MetaOp2ResourceMap[p.Opcode]
+	if !ok {
+		return fmt.Errorf("unknown operation(%v)", p.Opcode)
+	}
+	if ticket == nil {
+		return fmt.Errorf("connection is not authenticated")
+	}
+	if time.Now().Unix() >= ticket.Exp {
+		return fmt.Errorf("ticket expired")
+	}
+	return proto.CheckTicketCaps(ticket, rsc)
+}
@@ -0,0 +1,50 @@
+package metanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+)
+
+func TestCheckTicket(t *testing.T) {
+	m := &MetaNode{authenticate: true}
+	exp := time.Now().Add(time.Hour).Unix()
+	client := &cryptoutil.Ticket{Exp: exp, Caps: []byte(`{"API": ["meta:lookup:access", "meta:readchanges:access"]}`)}
+	service := &cryptoutil.Ticket{Exp: exp, Caps: []byte(`{"API": ["meta:internal:access"]}`)}
+	expired := &cryptoutil.Ticket{Exp: time.Now().Unix() - 1, Caps: []byte(`{"API": ["*:*:*"]}`)}
+
+	tests := []struct {
+		ticket *cryptoutil.Ticket
+		opcode uint8
+		ok     bool
+	}{
+		{client, proto.OpMetaLookup, true},
+		{client, proto.OpMetaReadChanges, true},
+		{client, proto.OpMetaCreateInode, false},
+		{client, proto.OpMetaTxCommit, false},
+		{client, proto.OpMetaRelocateExtents, false},
+		{client, proto.OpCreateMetaPartition, false},
+		{service, proto.OpMetaTxPrepare, true},
+		{service, proto.OpMetaSplitDir, true},
+		{service, proto.OpMetaLookup, false},
+		{nil, proto.OpMetaTxGetState, false},
+		{nil, proto.OpMetaLookup, false},
+		{expired, proto.OpMetaLookup, false},
+		// unknown operations are rejected whatever the ticket
+		{service, 0x90, false},
+		{&cryptoutil.Ticket{Exp: exp, Caps: []byte(`{"API": ["*:*:*"]}`)}, 0x90, false},
+	}
+	for _, tt := range tests {
+		err := m.checkTicket(tt.ticket, &Packet{Packet: proto.Packet{Opcode: tt.opcode}})
+		if (err == nil) != tt.ok {
+			t.Errorf("op(%v) ticket(%v): expected ok(%v) but got err(%v)", tt.opcode, tt.ticket, tt.ok, err)
+		}
+	}
+
+	m.authenticate = false
+	if err := m.checkTicket(nil, &Packet{Packet: proto.Packet{Opcode: 0x90}}); err != nil {
+		t.Errorf("tickets are checked without authentication: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// TxRecord defines the operations prepared by a participant, which are waiting for the decision of the coordinator.
+type TxRecord struct {
+	TxID        string               `json:"tid"`
+	Coordinator proto.TxPartition    `json:"coordinator"`
+	Ops         []*proto.TxOperation `json:"ops"`
+	CreateTime  int64                `json:"ct"`
+}
+
+// TxTable keeps the transactions of a meta partition, both as the coordinator and as a participant.
+// The dentries and inodes touched by a prepared record are locked until the record is committed or rolled back.
+type TxTable struct {
+	sync.RWMutex
+	Transactions map[string]*proto.TxInfo `json:"txs"`
+	Records      map[string]*TxRecord     `json:"records"`
+	locks        map[string]string        // lock key -> txID
+	parents      map[uint64]int           // parent inode -> number of dentries to be created
+}
+
+// NewTxTable returns a new TxTable.
+func NewTxTable() *TxTable {
+	return &TxTable{
+		Transactions: make(map[string]*proto.TxInfo),
+		Records:      make(map[string]*TxRecord),
+		locks:        make(map[string]string),
+		parents:      make(map[uint64]int),
+	}
+}
+
+func dentryLockKey(parentID uint64, name string) string {
+	return fmt.Sprintf("d_%d_%s", parentID, name)
+}
+
+func inodeLockKey(ino uint64) string {
+	return fmt.Sprintf("i_%d", ino)
+}
+
+func txLockKey(op *proto.TxOperation) string {
+	if op.Type == proto.TxOpUnlinkInode {
+		return inodeLockKey(op.Inode)
+	}
+	return dentryLockKey(op.ParentID, op.Name)
+}
+
+// GetTx returns the transaction coordinated by the partition.
+func (t *TxTable) GetTx(txID string) (tx *proto.TxInfo, ok bool) {
+	t.RLock()
+	tx, ok = t.Transactions[txID]
+	t.RUnlock()
+	return
+}
+
+// PutTx records a transaction coordinated by the partition.
+func (t *TxTable) PutTx(tx *proto.TxInfo) (ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok = t.Transactions[tx.TxID]; ok {
+		return false
+	}
+	t.Transactions[tx.TxID] = tx
+	return true
+}
+
+// SetTxState changes the state of an undecided transaction, and returns the state after the change.
+func (t *TxTable) SetTxState(txID string, state uint8) (cur uint8, ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	tx, ok := t.Transactions[txID]
+	if !ok {
+		return
+	}
+	if tx.State == proto.TxStateInit {
+		tx.State = state
+	}
+	cur = tx.State
+	return
+}
+
+// DeleteTx removes a finished transaction.
+func (t *TxTable) DeleteTx(txID string) {
+	t.Lock()
+	delete(t.Transactions, txID)
+	t.Unlock()
+}
+
+// GetRecord returns the prepared record of a transaction.
+func (t *TxTable) GetRecord(txID string) (rec *TxRecord, ok bool) {
+	t.RLock()
+	rec, ok = t.Records[txID]
+	t.RUnlock()
+	return
+}
+
+// PutRecord records the prepared operations and locks the items they touch.
+// It fails if any of the items has been locked by another transaction.
+func (t *TxTable) PutRecord(rec *TxRecord) (ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	// the items of the record prepared again are locked already
+	if _, ok = t.Records[rec.TxID]; ok {
+		return true
+	}
+	for _, op := range rec.Ops {
+		if txID, locked := t.locks[txLockKey(op)]; locked && txID != rec.TxID {
+			return false
+		}
+	}
+	t.Records[rec.TxID] = rec
+	t.lockRecord(rec)
+	return true
+}
+
+// DeleteRecord removes the prepared record and unlocks the items it touches.
+func (t *TxTable) DeleteRecord(txID string) {
+	t.Lock()
+	defer t.Unlock()
+	rec, ok := t.Records[txID]
+	if !ok {
+		return
+	}
+	delete(t.Records, txID)
+	for _, op := range rec.Ops {
+		delete(t.locks, txLockKey(op))
+		if op.Type == proto.TxOpCreateDentry {
+			if t.parents[op.ParentID]--; t.parents[op.ParentID] <= 0 {
+				delete(t.parents, op.ParentID)
+			}
+		}
+	}
+}
+
+func (t *TxTable) lockRecord(rec *TxRecord) {
+	for _, op := range rec.Ops {
+		t.locks[txLockKey(op)] = rec.TxID
+		if op.Type == proto.TxOpCreateDentry {
+			t.parents[op.ParentID]++
+		}
+	}
+}
+
+// IsDentryLocked returns if the dentry is locked by a transaction.
+func (t *TxTable) IsDentryLocked(parentID uint64, name string) bool {
+	t.RLock()
+	_, ok := t.locks[dentryLockKey(parentID, name)]
+	t.RUnlock()
+	return ok
+}
+
+// IsInodeLocked returns if the inode is locked by a transaction, either to be unlinked or to be the parent of
+// a new dentry.
+func (t *TxTable) IsInodeLocked(ino uint64) bool {
+	t.RLock()
+	defer t.RUnlock()
+	if _, ok := t.locks[inodeLockKey(ino)]; ok {
+		return true
+	}
+	return t.parents[ino] > 0
+}
+
+// Txs returns the transactions coordinated by the partition.
+func (t *TxTable) Txs() (txs []*proto.TxInfo) {
+	t.RLock()
+	for _, tx := range t.Transactions {
+		txCopy := *tx
+		txs = append(txs, &txCopy)
+	}
+	t.RUnlock()
+	return
+}
+
+// TxRecords returns the prepared records of the partition.
+func (t *TxTable) TxRecords() (recs []*TxRecord) {
+	t.RLock()
+	for _, rec := range t.Records {
+		recs = append(recs, rec)
+	}
+	t.RUnlock()
+	return
+}
+
+// Marshal marshals the TxTable into a byte array.
+func (t *TxTable) Marshal() ([]byte, error) {
+	t.RLock()
+	defer t.RUnlock()
+	return json.Marshal(t)
+}
+
+// Unmarshal unmarshals the TxTable and rebuilds the locks.
+func (t *TxTable) Unmarshal(data []byte) (err error) {
+	t.Lock()
+	defer t.Unlock()
+	if err = json.Unmarshal(data, t); err != nil {
+		return
+	}
+	if t.Transactions == nil {
+		t.Transactions = make(map[string]*proto.TxInfo)
+	}
+	if t.Records == nil {
+		t.Records = make(map[string]*TxRecord)
+	}
+	t.locks = make(map[string]string)
+	t.parents = make(map[uint64]int)
+	for _, rec := range t.Records {
+		t.lockRecord(rec)
+	}
+	return
+}
@@ -0,0 +1,96 @@
+package metanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestTxTableLocks(t *testing.T) {
+	table := NewTxTable()
+	create := &proto.TxOperation{Type: proto.TxOpCreateDentry, ParentID: 10, Name: "a"}
+	unlink := &proto.TxOperation{Type: proto.TxOpUnlinkInode, Inode: 20}
+	if !table.PutRecord(&TxRecord{TxID: "1", Ops: []*proto.TxOperation{create, unlink}}) {
+		t.Fatalf("put record")
+	}
+	if !table.IsDentryLocked(10, "a") || table.IsDentryLocked(10, "b") {
+		t.Fatalf("expect only the dentry of the record to be locked")
+	}
+	if !table.IsInodeLocked(10) || !table.IsInodeLocked(20) || table.IsInodeLocked(30) {
+		t.Fatalf("expect the parent and the unlinked inode to be locked")
+	}
+
+	// the record is prepared again by the retried request
+	if !table.PutRecord(&TxRecord{TxID: "1", Ops: []*proto.TxOperation{create, unlink}}) {
+		t.Fatalf("expect the same transaction to prepare the record again")
+	}
+	if table.PutRecord(&TxRecord{TxID: "2", Ops: []*proto.TxOperation{{Type: proto.TxOpDeleteDentry, ParentID: 10, Name: "a"}}}) {
+		t.Fatalf("expect the locked dentry to be rejected")
+	}
+	if !table.PutRecord(&TxRecord{TxID: "3", Ops: []*proto.TxOperation{{Type: proto.TxOpCreateDentry, ParentID: 10, Name: "b"}}}) {
+		t.Fatalf("put another record in the parent")
+	}
+
+	table.DeleteRecord("1")
+	if table.IsDentryLocked(10, "a") || table.IsInodeLocked(20) {
+		t.Fatalf("expect the items of the deleted record to be unlocked")
+	}
+	if !table.IsInodeLocked(10) {
+		t.Fatalf("expect the parent to be locked by the other record")
+	}
+	table.DeleteRecord("3")
+	if table.IsInodeLocked(10) {
+		t.Fatalf("expect the parent to be unlocked")
+	}
+	// deleting an unknown record is a no-op
+	table.DeleteRecord("3")
+}
+
+func TestTxTableState(t *testing.T) {
+	table := NewTxTable()
+	if _, ok := table.SetTxState("1", proto.TxStateCommitted); ok {
+		t.Fatalf("expect an unknown transaction to be rejected")
+	}
+	if !table.PutTx(&proto.TxInfo{TxID: "1"}) || table.PutTx(&proto.TxInfo{TxID: "1"}) {
+		t.Fatalf("expect the transaction to be put once")
+	}
+	if state, ok := table.SetTxState("1", proto.TxStateRolledBack); !ok || state != proto.TxStateRolledBack {
+		t.Fatalf("expect the first decision, got %v", state)
+	}
+	// the first decision wins
+	if state, ok := table.SetTxState("1", proto.TxStateCommitted); !ok || state != proto.TxStateRolledBack {
+		t.Fatalf("expect the first decision to be kept, got %v", state)
+	}
+	table.DeleteTx("1")
+	if _, ok := table.GetTx("1"); ok {
+		t.Fatalf("expect the transaction to be deleted")
+	}
+}
+
+func TestTxTableMarshal(t *testing.T) {
+	table := NewTxTable()
+	table.PutTx(&proto.TxInfo{TxID: "1", State: proto.TxStateCommitted})
+	table.PutRecord(&TxRecord{TxID: "2", Ops: []*proto.TxOperation{
+		{Type: proto.TxOpCreateDentry, ParentID: 10, Name: "a"},
+		{Type: proto.TxOpUnlinkInode, Inode: 20},
+	}})
+	data, err := table.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewTxTable()
+	if err = loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if tx, ok := loaded.GetTx("1"); !ok || tx.State != proto.TxStateCommitted {
+		t.Fatalf("expect the transaction to be loaded, got %v", tx)
+	}
+	if _, ok := loaded.GetRecord("2"); !ok {
+		t.Fatalf("expect the record to be loaded")
+	}
+	// the locks are rebuilt from the records
+	if !loaded.IsDentryLocked(10, "a") || !loaded.IsInodeLocked(10) || !loaded.IsInodeLocked(20) {
+		t.Fatalf("expect the items of the loaded record to be locked")
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The buckets are addressed in the path style, i.e. /<bucket>/<key>.
+
+type requestContext struct {
+	requestID string
+	bucket    string
+	key       string
+	volume    *Volume
+	sig       *signatureV4
+}
+
+func (o *ObjectNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := &requestContext{requestID: strconv.FormatInt(proto.GenerateRequestID(), 16)}
+	w.Header().Set(HeaderAmzRequestID, ctx.requestID)
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if idx := strings.Index(path, "/"); idx >= 0 {
+		ctx.bucket, ctx.key = path[:idx], path[idx+1:]
+	} else {
+		ctx.bucket = path
+	}
+	if ctx.bucket == "" {
+		o.writeError(w, r, ctx, ErrNotImplemented)
+		return
+	}
+	if err := o.authenticate(r, ctx); err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	volume, err := o.getVolume(ctx.bucket, ctx.sig.accessKey)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	ctx.volume = volume
+
+	query := r.URL.Query()
+	_, hasUploads := query[ParamUploads]
+	uploadID := query.Get(ParamUploadID)
+	if ctx.key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && query.Get(ParamListType) == "2":
+			o.listObjectsV2(w, r, ctx)
+		default:
+			o.writeError(w, r, ctx, ErrNotImplemented)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		if uploadID != "" {
+			o.uploadPart(w, r, ctx)
+		} else {
+			o.putObject(w, r, ctx)
+		}
+	case http.MethodGet:
+		if uploadID != "" {
+			o.listParts(w, r, ctx)
+		} else {
+			o.getObject(w, r, ctx)
+		}
+	case http.MethodHead:
+		o.headObject(w, r, ctx)
+	case http.MethodDelete:
+		if uploadID != "" {
+			o.abortMultipartUpload(w, r, ctx)
+		} else {
+			o.deleteObject(w, r, ctx)
+		}
+	case http.MethodPost:
+		if hasUploads {
+			o.createMultipartUpload(w, r, ctx)
+		} else if uploadID != "" {
+			o.completeMultipartUpload(w, r, ctx)
+		} else {
+			o.writeError(w, r, ctx, ErrNotImplemented)
+		}
+	default:
+		o.writeError(w, r, ctx, ErrMethodNotAllowed)
+	}
+}
+
+func (o *ObjectNode) authenticate(r *http.Request, ctx *requestContext) (err error) {
+	sig, errCode := parseSignatureV4(r)
+	if errCode != nil {
+		return errCode
+	}
+	if errCode = sig.checkTime(time.Now().UTC()); errCode != nil {
+		return errCode
+	}
+	secretKey, err := o.getSecretKey(sig.accessKey)
+	if err != nil {
+		log.LogWarnf("authenticate: access key(%v) err(%v)", sig.accessKey, err)
+		return ErrInvalidAccessKeyID
+	}
+	if errCode = sig.verify(r, secretKey); errCode != nil {
+		return errCode
+	}
+	ctx.sig = sig
+	return nil
+}
+
+// payloadReader verifies the SHA256 of the payload signed in the request once it is read to the end.
+type payloadReader struct {
+	reader   io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (p *payloadReader) Read(b []byte) (n int, err error) {
+	n, err = p.reader.Read(b)
+	p.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(p.hash.Sum(nil)) != p.expected {
+		err = ErrContentSHA256Mismatch
+	}
+	return
+}
+
+func requestBody(r *http.Request, ctx *requestContext) io.Reader {
+	if ctx.sig.payloadHash == UnsignedPayload {
+		return r.Body
+	}
+	return &payloadReader{reader: r.Body, hash: sha256.New(), expected: ctx.sig.payloadHash}
+}
+
+func (o *ObjectNode) putObject(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		o.writeError(w, r, ctx, ErrNotImplemented)
+		return
+	}
+	etag, err := ctx.volume.putObject(ctx.key, r.Header.Get(HeaderContentType), requestBody(r, ctx))
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	w.Header().Set(HeaderETag, quoteETag(etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *ObjectNode) headObject(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	info, err := ctx.volume.getObjectInfo(ctx.key)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	setObjectHeaders(w, info)
+	w.Header().Set(HeaderContentLength, strconv.FormatUint(info.size, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *ObjectNode) getObject(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	info, err := ctx.volume.getObjectInfo(ctx.key)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	start, end, partial, err := parseRange(r.Header.Get(HeaderRange), info.size)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	setObjectHeaders(w, info)
+	size := end - start + 1
+	if info.size == 0 {
+		size = 0
+	}
+	w.Header().Set(HeaderContentLength, strconv.FormatUint(size, 10))
+	if partial {
+		w.Header().Set(HeaderContentRange, "bytes "+strconv.FormatUint(start, 10)+"-"+
+			strconv.FormatUint(end, 10)+"/"+strconv.FormatUint(info.size, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if size == 0 {
+		return
+	}
+	if err = ctx.volume.readFile(info.inode, start, size, w); err != nil {
+		log.LogErrorf("getObject: bucket(%v) key(%v) requestID(%v) err(%v)", ctx.bucket, ctx.key, ctx.requestID, err)
+	}
+}
+
+func (o *ObjectNode) deleteObject(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	if err := ctx.volume.deleteObject(ctx.key); err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (o *ObjectNode) listObjectsV2(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	query := r.URL.Query()
+	result := &ListBucketResultV2{
+		Name:              ctx.bucket,
+		Prefix:            query.Get(ParamPrefix),
+		Delimiter:         query.Get(ParamDelimiter),
+		MaxKeys:           DefaultMaxKeys,
+		ContinuationToken: query.Get(ParamContinuationToken),
+		StartAfter:        query.Get(ParamStartAfter),
+	}
+	if result.Delimiter != "" && result.Delimiter != "/" {
+		o.writeError(w, r, ctx, ErrNotImplemented)
+		return
+	}
+	if value := query.Get(ParamMaxKeys); value != "" {
+		maxKeys, err := strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			o.writeError(w, r, ctx, ErrInvalidArgument)
+			return
+		}
+		if maxKeys < DefaultMaxKeys {
+			result.MaxKeys = maxKeys
+		}
+	}
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.StdEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			o.writeError(w, r, ctx, ErrInvalidArgument)
+			return
+		}
+		marker = string(token)
+	}
+	entries, truncated, err := ctx.volume.listObjects(result.Prefix, result.Delimiter, marker, result.MaxKeys)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.prefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, &CommonPrefix{Prefix: entry.key})
+			continue
+		}
+		result.Contents = append(result.Contents, &Content{
+			Key:          entry.key,
+			LastModified: formatTimeISO(entry.info.modifyTime),
+			ETag:         quoteETag(entry.info.etag),
+			Size:         entry.info.size,
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(entries)
+	result.IsTruncated = truncated
+	if truncated && len(entries) > 0 {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(entries[len(entries)-1].key))
+	}
+	o.writeXML(w, r, ctx, result)
+}
+
+func (o *ObjectNode) createMultipartUpload(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	uploadID, err := ctx.volume.initiateUpload(ctx.key, r.Header.Get(HeaderContentType))
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	o.writeXML(w, r, ctx, &InitiateMultipartUploadResult{Bucket: ctx.bucket, Key: ctx.key, UploadID: uploadID})
+}
+
+func (o *ObjectNode) uploadPart(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	query := r.URL.Query()
+	partNumber, err := strconv.Atoi(query.Get(ParamPartNumber))
+	if err != nil || partNumber < 1 || partNumber > MaxPartNumber {
+		o.writeError(w, r, ctx, ErrInvalidArgument)
+		return
+	}
+	etag, err := ctx.volume.uploadPart(query.Get(ParamUploadID), ctx.key, partNumber, requestBody(r, ctx))
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	w.Header().Set(HeaderETag, quoteETag(etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *ObjectNode) listParts(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	uploadID := r.URL.Query().Get(ParamUploadID)
+	parts, err := ctx.volume.listParts(uploadID, ctx.key)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	o.writeXML(w, r, ctx, &ListPartsResult{Bucket: ctx.bucket, Key: ctx.key, UploadID: uploadID, Parts: parts})
+}
+
+func (o *ObjectNode) completeMultipartUpload(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	req := &CompleteMultipartUpload{}
+	if err := xml.NewDecoder(requestBody(r, ctx)).Decode(req); err != nil {
+		o.writeError(w, r, ctx, ErrMalformedXML)
+		return
+	}
+	etag, err := ctx.volume.completeUpload(r.URL.Query().Get(ParamUploadID), ctx.key, req.Parts)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	o.writeXML(w, r, ctx, &CompleteMultipartUploadResult{Bucket: ctx.bucket, Key: ctx.key, ETag: quoteETag(etag)})
+}
+
+func (o *ObjectNode) abortMultipartUpload(w http.ResponseWriter, r *http.Request, ctx *requestContext) {
+	if err := ctx.volume.abortUpload(r.URL.Query().Get(ParamUploadID), ctx.key); err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setObjectHeaders(w http.ResponseWriter, info *objectInfo) {
+	w.Header().Set(HeaderContentType, info.contentType)
+	w.Header().Set(HeaderETag, quoteETag(info.etag))
+	w.Header().Set(HeaderLastModified, info.modifyTime.UTC().Format(http.TimeFormat))
+	w.Header().Set(HeaderAcceptRanges, "bytes")
+}
+
+// parseRange parses the single range of the request, and the whole object is returned if there is no
+// range or several ranges.
+func parseRange(value string, size uint64) (start, end uint64, partial bool, err error) {
+	end = size - 1
+	if value == "" || !strings.HasPrefix(value, "bytes=") || strings.Contains(value, ",") {
+		return 0, end, false, nil
+	}
+	bounds := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+	if len(bounds) != 2 || (bounds[0] == "" && bounds[1] == "") {
+		return 0, end, false, nil
+	}
+	if bounds[0] == "" {
+		// the suffix of the object
+		var suffix uint64
+		if suffix, err = strconv.ParseUint(bounds[1], 10, 64); err != nil || suffix == 0 || size == 0 {
+			return 0, 0, false, ErrInvalidRange
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, end, true, nil
+	}
+	if start, err = strconv.ParseUint(bounds[0], 10, 64); err != nil || start >= size {
+		return 0, 0, false, ErrInvalidRange
+	}
+	if bounds[1] != "" {
+		var last uint64
+		if last, err = strconv.ParseUint(bounds[1], 10, 64); err != nil || last < start {
+			return 0, 0, false, ErrInvalidRange
+		}
+		if last < end {
+			end = last
+		}
+	}
+	return start, end, true, nil
+}
+
+func quoteETag(etag string) string {
+	return "\"" + etag + "\""
+}
+
+func formatTimeISO(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func toErrorCode(err error) *ErrorCode {
+	switch e := err.(type) {
+	case *ErrorCode:
+		return e
+	case syscall.Errno:
+		switch e {
+		case syscall.ENOENT:
+			return ErrNoSuchKey
+		case syscall.EEXIST, syscall.ENOTDIR, syscall.EISDIR:
+			return ErrKeyIsDirectoryOrParent
+		case syscall.EDQUOT, syscall.ENOSPC:
+			return ErrEntityTooLarge
+		case syscall.EPERM, syscall.EACCES, syscall.EROFS:
+			return ErrAccessDenied
+		}
+	}
+	return ErrInternalError
+}
+
+func (o *ObjectNode) writeError(w http.ResponseWriter, r *http.Request, ctx *requestContext, err error) {
+	code := toErrorCode(err)
+	if code == ErrInternalError {
+		log.LogErrorf("writeError: method(%v) url(%v) requestID(%v) err(%v)", r.Method, r.URL, ctx.requestID, err)
+	} else {
+		log.LogDebugf("writeError: method(%v) url(%v) requestID(%v) err(%v)", r.Method, r.URL, ctx.requestID, err)
+	}
+	resp := &ErrorResponse{
+		Code:      code.Code,
+		Message:   code.Message,
+		Resource:  r.URL.Path,
+		RequestID: ctx.requestID,
+	}
+	w.Header().Set(HeaderContentType, "application/xml")
+	w.WriteHeader(code.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	data, _ := xml.Marshal(resp)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func (o *ObjectNode) writeXML(w http.ResponseWriter, r *http.Request, ctx *requestContext, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		o.writeError(w, r, ctx, err)
+		return
+	}
+	w.Header().Set(HeaderContentType, "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
@@ -0,0 +1,46 @@
+package objectnode
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		value   string
+		size    uint64
+		start   uint64
+		end     uint64
+		partial bool
+		err     error
+	}{
+		{value: "", size: 100, end: 99},
+		{value: "bytes=0-9", size: 100, end: 9, partial: true},
+		{value: "bytes=10-", size: 100, start: 10, end: 99, partial: true},
+		{value: "bytes=90-200", size: 100, start: 90, end: 99, partial: true},
+		{value: "bytes=-10", size: 100, start: 90, end: 99, partial: true},
+		{value: "bytes=-200", size: 100, end: 99, partial: true},
+		{value: "bytes=5-5", size: 100, start: 5, end: 5, partial: true},
+		// the unsupported ranges are ignored
+		{value: "items=0-9", size: 100, end: 99},
+		{value: "bytes=0-9,20-29", size: 100, end: 99},
+		{value: "bytes=-", size: 100, end: 99},
+		{value: "bytes=5", size: 100, end: 99},
+		// the unsatisfiable ranges
+		{value: "bytes=100-", size: 100, err: ErrInvalidRange},
+		{value: "bytes=10-5", size: 100, err: ErrInvalidRange},
+		{value: "bytes=-0", size: 100, err: ErrInvalidRange},
+		{value: "bytes=a-9", size: 100, err: ErrInvalidRange},
+		{value: "bytes=0-b", size: 100, err: ErrInvalidRange},
+		{value: "bytes=0-", size: 0, err: ErrInvalidRange},
+		{value: "bytes=-10", size: 0, err: ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		start, end, partial, err := parseRange(tt.value, tt.size)
+		if err != tt.err {
+			t.Errorf("parseRange(%q, %v): expect err %v, got %v", tt.value, tt.size, tt.err, err)
+			continue
+		}
+		if err == nil && (start != tt.start || end != tt.end || partial != tt.partial) {
+			t.Errorf("parseRange(%q, %v): expect %v-%v %v, got %v-%v %v", tt.value, tt.size,
+				tt.start, tt.end, tt.partial, start, end, partial)
+		}
+	}
+}
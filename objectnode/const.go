@@ -0,0 +1,98 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"time"
+)
+
+const (
+	ModuleName = "objectNode"
+)
+
+const (
+	ConfigKeyListen       = "listen"       // string
+	ConfigKeyMasterAddr   = "masterAddr"   // array
+	ConfigKeyRegion       = "region"       // string
+	ConfigKeyAuthNodes    = "authNodes"    // array
+	ConfigKeyClientID     = "clientID"     // string
+	ConfigKeyClientKey    = "clientKey"    // string
+	ConfigKeyAuthCertFile = "authCertFile" // string
+)
+
+const (
+	DefaultListen = ":80"
+	DefaultRegion = "cfs_default"
+
+	// the hidden directory under the root of a volume, keeping the temporary files and the parts of the uploads
+	MultipartDirName = ".multipart"
+
+	// the extended attributes of the files of the objects
+	XAttrKeyETag        = "oss:etag"
+	XAttrKeyContentType = "oss:content-type"
+	XAttrKeyUploadKey   = "oss:upload-key"
+
+	DefaultContentType = "application/octet-stream"
+	DefaultMaxKeys     = 1000
+	MaxPartNumber      = 10000
+
+	// the size of the buffer to copy the data of the files
+	copyBufferSize = 1 << 20
+	// the credentials are looked up from authnode again after they expire
+	credentialExpiration = 10 * time.Minute
+	// the maximum difference between the time of the request and the local time
+	maxRequestSkew = 15 * time.Minute
+	// the maximum expiration of the presigned URLs
+	maxPresignExpires = 7 * 24 * time.Hour
+)
+
+const (
+	HeaderAuthorization   = "Authorization"
+	HeaderContentType     = "Content-Type"
+	HeaderContentLength   = "Content-Length"
+	HeaderContentRange    = "Content-Range"
+	HeaderRange           = "Range"
+	HeaderETag            = "ETag"
+	HeaderLastModified    = "Last-Modified"
+	HeaderAcceptRanges    = "Accept-Ranges"
+	HeaderAmzDate         = "X-Amz-Date"
+	HeaderAmzContentSha   = "X-Amz-Content-Sha256"
+	HeaderAmzRequestID    = "X-Amz-Request-Id"
+	UnsignedPayload       = "UNSIGNED-PAYLOAD"
+	StreamingPayload      = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	SignatureV4Algorithm  = "AWS4-HMAC-SHA256"
+	SignatureV4Terminator = "aws4_request"
+	ServiceS3             = "s3"
+	amzDateFormat         = "20060102T150405Z"
+	amzShortDateFormat    = "20060102"
+)
+
+const (
+	ParamUploads           = "uploads"
+	ParamUploadID          = "uploadId"
+	ParamPartNumber        = "partNumber"
+	ParamListType          = "list-type"
+	ParamPrefix            = "prefix"
+	ParamDelimiter         = "delimiter"
+	ParamMaxKeys           = "max-keys"
+	ParamContinuationToken = "continuation-token"
+	ParamStartAfter        = "start-after"
+	ParamAmzAlgorithm      = "X-Amz-Algorithm"
+	ParamAmzCredential     = "X-Amz-Credential"
+	ParamAmzDate           = "X-Amz-Date"
+	ParamAmzExpires        = "X-Amz-Expires"
+	ParamAmzSignedHeaders  = "X-Amz-SignedHeaders"
+	ParamAmzSignature      = "X-Amz-Signature"
+)
@@ -0,0 +1,142 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// ErrorCode defines the error of the S3 API.
+type ErrorCode struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *ErrorCode) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	ErrAccessDenied           = &ErrorCode{"AccessDenied", "Access Denied", http.StatusForbidden}
+	ErrInvalidAccessKeyID     = &ErrorCode{"InvalidAccessKeyId", "The access key Id you provided does not exist in our records.", http.StatusForbidden}
+	ErrSignatureDoesNotMatch  = &ErrorCode{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	ErrRequestTimeTooSkewed   = &ErrorCode{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	ErrExpiredToken           = &ErrorCode{"ExpiredToken", "The provided token has expired.", http.StatusBadRequest}
+	ErrMissingSecurityHeader  = &ErrorCode{"MissingSecurityHeader", "Your request is missing a required header.", http.StatusBadRequest}
+	ErrAuthorizationMalformed = &ErrorCode{"AuthorizationHeaderMalformed", "The authorization header you provided is invalid.", http.StatusBadRequest}
+	ErrContentSHA256Mismatch  = &ErrorCode{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	ErrNoSuchBucket           = &ErrorCode{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	ErrNoSuchKey              = &ErrorCode{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	ErrNoSuchUpload           = &ErrorCode{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	ErrInvalidPart            = &ErrorCode{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	ErrInvalidPartOrder       = &ErrorCode{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	ErrInvalidArgument        = &ErrorCode{"InvalidArgument", "Invalid Argument", http.StatusBadRequest}
+	ErrInvalidKey             = &ErrorCode{"InvalidArgument", "The key is invalid or reserved.", http.StatusBadRequest}
+	ErrInvalidRange           = &ErrorCode{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	ErrMalformedXML           = &ErrorCode{"MalformedXML", "The XML you provided was not well-formed.", http.StatusBadRequest}
+	ErrMethodNotAllowed       = &ErrorCode{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	ErrNotImplemented         = &ErrorCode{"NotImplemented", "A header you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	ErrInternalError          = &ErrorCode{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	ErrKeyIsDirectoryOrParent = &ErrorCode{"InvalidArgument", "The key conflicts with an existing directory or object.", http.StatusConflict}
+	ErrEntityTooLarge         = &ErrorCode{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed size.", http.StatusBadRequest}
+	ErrMissingContentLength   = &ErrorCode{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	ErrInvalidBucketName      = &ErrorCode{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+)
+
+// ErrorResponse defines the body of the error response.
+type ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// ListBucketResultV2 defines the result of ListObjectsV2.
+type ListBucketResultV2 struct {
+	XMLName               xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string          `xml:"Name"`
+	Prefix                string          `xml:"Prefix"`
+	Delimiter             string          `xml:"Delimiter,omitempty"`
+	MaxKeys               int             `xml:"MaxKeys"`
+	KeyCount              int             `xml:"KeyCount"`
+	IsTruncated           bool            `xml:"IsTruncated"`
+	ContinuationToken     string          `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string          `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string          `xml:"StartAfter,omitempty"`
+	Contents              []*Content      `xml:"Contents"`
+	CommonPrefixes        []*CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// Content defines an object in the result of listing.
+type Content struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// CommonPrefix defines a common prefix in the result of listing.
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// InitiateMultipartUploadResult defines the result of CreateMultipartUpload.
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// CompleteMultipartUpload defines the body of the request of CompleteMultipartUpload.
+type CompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []*CompletePart `xml:"Part"`
+}
+
+// CompletePart defines a part in the request of CompleteMultipartUpload.
+type CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// CompleteMultipartUploadResult defines the result of CompleteMultipartUpload.
+type CompleteMultipartUploadResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// ListPartsResult defines the result of ListParts.
+type ListPartsResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+	Parts    []*Part  `xml:"Part"`
+}
+
+// Part defines a part in the result of ListParts.
+type Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+}
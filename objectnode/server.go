@@ -0,0 +1,249 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package objectnode serves a subset of the S3 REST API over the volumes, in which a bucket is a volume
+// and the key of an object is the path of a file. The requests are signed with the keys in the keystore
+// of authnode, and the access key must be the owner of the volume.
+package objectnode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The status of the server
+const (
+	Standby uint32 = iota
+	Start
+	Running
+	Shutdown
+	Stopped
+)
+
+type credential struct {
+	secretKey string
+	expire    time.Time
+}
+
+// ObjectNode defines the structure of the object node.
+type ObjectNode struct {
+	listen        string
+	region        string
+	masters       []string
+	masterHelper  util.MasterHelper
+	authenticator *auth.Authenticator
+	httpServer    *http.Server
+	state         uint32
+	wg            sync.WaitGroup
+
+	volumeLock  sync.Mutex
+	volumes     map[string]*Volume
+	volumeLoads map[string]*volumeLoad // the volumes being built
+	credentials sync.Map               // access key -> *credential
+}
+
+// volumeLoad is a volume being built, which the other requests of the bucket wait for.
+type volumeLoad struct {
+	done chan struct{}
+	v    *Volume
+	err  error
+}
+
+// NewServer returns a new object node.
+func NewServer() *ObjectNode {
+	return &ObjectNode{}
+}
+
+// Start starts the object node.
+func (o *ObjectNode) Start(cfg *config.Config) (err error) {
+	if atomic.CompareAndSwapUint32(&o.state, Standby, Start) {
+		defer func() {
+			if err != nil {
+				atomic.StoreUint32(&o.state, Standby)
+			} else {
+				atomic.StoreUint32(&o.state, Running)
+			}
+		}()
+		if err = o.onStart(cfg); err != nil {
+			return
+		}
+		o.wg.Add(1)
+	}
+	return
+}
+
+// Shutdown shuts down the object node.
+func (o *ObjectNode) Shutdown() {
+	if atomic.CompareAndSwapUint32(&o.state, Running, Shutdown) {
+		o.httpServer.Close()
+		o.wg.Done()
+		atomic.StoreUint32(&o.state, Stopped)
+	}
+}
+
+// Sync blocks the invoker until the object node is shut down.
+func (o *ObjectNode) Sync() {
+	if atomic.LoadUint32(&o.state) == Running {
+		o.wg.Wait()
+	}
+}
+
+func (o *ObjectNode) onStart(cfg *config.Config) (err error) {
+	if err = o.parseConfig(cfg); err != nil {
+		return
+	}
+	o.volumes = make(map[string]*Volume)
+	o.volumeLoads = make(map[string]*volumeLoad)
+	o.httpServer = &http.Server{
+		Addr:    o.listen,
+		Handler: http.HandlerFunc(o.serveHTTP),
+	}
+	go func() {
+		if e := o.httpServer.ListenAndServe(); e != nil && e != http.ErrServerClosed {
+			log.LogErrorf("action[onStart] listen(%v) err(%v)", o.listen, e)
+		}
+	}()
+	log.LogInfof("action[onStart] object node listen(%v) region(%v) masters(%v)", o.listen, o.region, o.masters)
+	return
+}
+
+func (o *ObjectNode) parseConfig(cfg *config.Config) (err error) {
+	if o.listen = cfg.GetString(ConfigKeyListen); o.listen == "" {
+		o.listen = DefaultListen
+	}
+	if o.region = cfg.GetString(ConfigKeyRegion); o.region == "" {
+		o.region = DefaultRegion
+	}
+	o.masterHelper = util.NewMasterHelper()
+	for _, addr := range cfg.GetArray(ConfigKeyMasterAddr) {
+		o.masters = append(o.masters, addr.(string))
+		o.masterHelper.AddNode(addr.(string))
+	}
+	if len(o.masters) == 0 {
+		return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, "masterAddr is empty")
+	}
+	var authNodes []string
+	for _, addr := range cfg.GetArray(ConfigKeyAuthNodes) {
+		authNodes = append(authNodes, addr.(string))
+	}
+	// the credentials of the requests are looked up in the keystore, so authnode is required
+	o.authenticator, err = auth.NewAuthenticator(authNodes, cfg.GetString(ConfigKeyClientID),
+		cfg.GetString(ConfigKeyClientKey), cfg.GetString(ConfigKeyAuthCertFile))
+	if err != nil {
+		return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+	}
+	o.masterHelper.SetTokenFunc(func() (string, error) {
+		return o.authenticator.Token(proto.MasterServiceID)
+	})
+	return
+}
+
+// getSecretKey returns the secret key of the access key, which is the base64 encoded key in the keystore.
+func (o *ObjectNode) getSecretKey(accessKey string) (secretKey string, err error) {
+	if value, ok := o.credentials.Load(accessKey); ok {
+		c := value.(*credential)
+		if time.Now().Before(c.expire) {
+			return c.secretKey, nil
+		}
+	}
+	keyInfo, err := o.authenticator.GetKey(accessKey)
+	if err != nil {
+		return
+	}
+	secretKey = cryptoutil.Base64Encode(keyInfo.Key)
+	o.credentials.Store(accessKey, &credential{secretKey: secretKey, expire: time.Now().Add(credentialExpiration)})
+	return
+}
+
+// getVolume returns the volume of the bucket, which must be owned by the access key.
+func (o *ObjectNode) getVolume(bucket, accessKey string) (v *Volume, err error) {
+	o.volumeLock.Lock()
+	v = o.volumes[bucket]
+	o.volumeLock.Unlock()
+	if v != nil {
+		if v.owner != accessKey {
+			return nil, ErrAccessDenied
+		}
+		return
+	}
+	owner, err := o.getVolumeOwner(bucket)
+	if err != nil {
+		return
+	}
+	if owner != accessKey {
+		return nil, ErrAccessDenied
+	}
+	return o.loadVolume(bucket, owner)
+}
+
+// Returns the volume built once for all the requests, without the lock held across the requests to
+// the master and the meta partitions.
+func (o *ObjectNode) loadVolume(bucket, owner string) (v *Volume, err error) {
+	o.volumeLock.Lock()
+	if v = o.volumes[bucket]; v != nil {
+		o.volumeLock.Unlock()
+		return
+	}
+	load, loading := o.volumeLoads[bucket]
+	if !loading {
+		load = &volumeLoad{done: make(chan struct{})}
+		o.volumeLoads[bucket] = load
+	}
+	o.volumeLock.Unlock()
+	if loading {
+		<-load.done
+		return load.v, load.err
+	}
+
+	if load.v, load.err = newVolume(bucket, owner, strings.Join(o.masters, ","), o.authenticator); load.err != nil {
+		log.LogErrorf("action[loadVolume] bucket(%v) err(%v)", bucket, load.err)
+		load.v, load.err = nil, ErrInternalError
+	}
+	o.volumeLock.Lock()
+	if load.err == nil {
+		o.volumes[bucket] = load.v
+	}
+	delete(o.volumeLoads, bucket)
+	o.volumeLock.Unlock()
+	close(load.done)
+	return load.v, load.err
+}
+
+func (o *ObjectNode) getVolumeOwner(name string) (owner string, err error) {
+	reqURL := fmt.Sprintf("%s?name=%s", proto.AdminGetVol, name)
+	respBody, err := o.masterHelper.Request(http.MethodGet, reqURL, nil, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), proto.ErrVolNotExists.Error()) {
+			return "", ErrNoSuchBucket
+		}
+		return
+	}
+	view := &proto.SimpleVolView{}
+	if err = json.Unmarshal(respBody, view); err != nil {
+		return
+	}
+	return view.Owner, nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The requests are signed with AWS Signature Version 4, either in the Authorization header or in the
+// query of a presigned URL. The access key is the ID of a key in the keystore of authnode, and the secret
+// key is the base64 encoded key of it, as in the key file created by authtool.
+
+type signatureV4 struct {
+	accessKey     string
+	date          string // the short date in the scope of the credential
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	requestTime   time.Time
+	payloadHash   string
+	expires       time.Duration // only for the presigned URLs
+	presigned     bool
+}
+
+func isPresignedRequest(r *http.Request) bool {
+	return r.URL.Query().Get(ParamAmzAlgorithm) != ""
+}
+
+// parseSignatureV4 parses the signature of the request, from the Authorization header or from the
+// query of a presigned URL.
+func parseSignatureV4(r *http.Request) (sig *signatureV4, err *ErrorCode) {
+	if isPresignedRequest(r) {
+		return parsePresignedSignatureV4(r.URL.Query())
+	}
+	auth := r.Header.Get(HeaderAuthorization)
+	if auth == "" {
+		return nil, ErrAccessDenied
+	}
+	if !strings.HasPrefix(auth, SignatureV4Algorithm+" ") {
+		return nil, ErrNotImplemented
+	}
+	sig = &signatureV4{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, SignatureV4Algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrAuthorizationMalformed
+		}
+		switch kv[0] {
+		case "Credential":
+			if err = sig.parseCredential(kv[1]); err != nil {
+				return
+			}
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			sig.signature = kv[1]
+		}
+	}
+	if sig.accessKey == "" || len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return nil, ErrAuthorizationMalformed
+	}
+	date := r.Header.Get(HeaderAmzDate)
+	if date == "" {
+		return nil, ErrMissingSecurityHeader
+	}
+	var e error
+	if sig.requestTime, e = time.Parse(amzDateFormat, date); e != nil {
+		return nil, ErrAuthorizationMalformed
+	}
+	if sig.payloadHash = r.Header.Get(HeaderAmzContentSha); sig.payloadHash == "" {
+		return nil, ErrMissingSecurityHeader
+	}
+	if sig.payloadHash == StreamingPayload {
+		return nil, ErrNotImplemented
+	}
+	return
+}
+
+func parsePresignedSignatureV4(query url.Values) (sig *signatureV4, err *ErrorCode) {
+	if query.Get(ParamAmzAlgorithm) != SignatureV4Algorithm {
+		return nil, ErrNotImplemented
+	}
+	sig = &signatureV4{presigned: true, payloadHash: UnsignedPayload}
+	if err = sig.parseCredential(query.Get(ParamAmzCredential)); err != nil {
+		return
+	}
+	sig.signedHeaders = strings.Split(query.Get(ParamAmzSignedHeaders), ";")
+	sig.signature = query.Get(ParamAmzSignature)
+	var e error
+	if sig.requestTime, e = time.Parse(amzDateFormat, query.Get(ParamAmzDate)); e != nil {
+		return nil, ErrAuthorizationMalformed
+	}
+	expires, e := strconv.ParseInt(query.Get(ParamAmzExpires), 10, 64)
+	if e != nil || expires <= 0 {
+		return nil, ErrAuthorizationMalformed
+	}
+	if sig.expires = time.Duration(expires) * time.Second; sig.expires > maxPresignExpires {
+		return nil, ErrAuthorizationMalformed
+	}
+	if sig.signature == "" {
+		return nil, ErrAuthorizationMalformed
+	}
+	return
+}
+
+// The credential is in the form of <access key>/<date>/<region>/<service>/aws4_request.
+func (sig *signatureV4) parseCredential(credential string) *ErrorCode {
+	fields := strings.Split(credential, "/")
+	if len(fields) != 5 || fields[4] != SignatureV4Terminator || fields[0] == "" {
+		return ErrAuthorizationMalformed
+	}
+	sig.accessKey, sig.date, sig.region, sig.service = fields[0], fields[1], fields[2], fields[3]
+	return nil
+}
+
+// checkTime checks the time of the request, or the expiration of the presigned URL.
+func (sig *signatureV4) checkTime(now time.Time) *ErrorCode {
+	if sig.requestTime.Format(amzShortDateFormat) != sig.date {
+		return ErrAuthorizationMalformed
+	}
+	if sig.presigned {
+		if now.Before(sig.requestTime.Add(-maxRequestSkew)) {
+			return ErrRequestTimeTooSkewed
+		}
+		if now.After(sig.requestTime.Add(sig.expires)) {
+			return ErrExpiredToken
+		}
+		return nil
+	}
+	if now.Sub(sig.requestTime) > maxRequestSkew || sig.requestTime.Sub(now) > maxRequestSkew {
+		return ErrRequestTimeTooSkewed
+	}
+	return nil
+}
+
+// verify checks the signature of the request with the secret key.
+func (sig *signatureV4) verify(r *http.Request, secretKey string) *ErrorCode {
+	stringToSign := strings.Join([]string{
+		SignatureV4Algorithm,
+		sig.requestTime.Format(amzDateFormat),
+		strings.Join([]string{sig.date, sig.region, sig.service, SignatureV4Terminator}, "/"),
+		hashHex([]byte(sig.canonicalRequest(r))),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), sig.date)
+	key = hmacSHA256(key, sig.region)
+	key = hmacSHA256(key, sig.service)
+	key = hmacSHA256(key, SignatureV4Terminator)
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return ErrSignatureDoesNotMatch
+	}
+	return nil
+}
+
+func (sig *signatureV4) canonicalRequest(r *http.Request) string {
+	query := r.URL.Query()
+	if sig.presigned {
+		query.Del(ParamAmzSignature)
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	headers := make([]string, 0, len(sig.signedHeaders))
+	for _, name := range sig.signedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			value = strings.Join(r.Header[http.CanonicalHeaderKey(name)], ",")
+		}
+		headers = append(headers, name+":"+strings.Join(strings.Fields(value), " "))
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		strings.Join(params, "&"),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+// uriEncode encodes the string as required by the signature, in which only the unreserved characters
+// are kept, and the slashes are kept in the path.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
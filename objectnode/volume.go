@@ -0,0 +1,636 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package objectnode
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/data/stream"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/auth"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// A bucket is a volume, and the key of an object is the path of a file in it, of which the directories
+// are created on demand. The data of an object is written into a temporary file under the hidden
+// multipart directory at first, and then the file is renamed to the path of the key, so that the readers
+// never see a partial object.
+
+const (
+	dirMode  = os.ModeDir | 0755
+	fileMode = 0644
+	// the maximum length of a key in bytes
+	maxKeyLength = 1024
+)
+
+// Volume defines the clients of the metadata and the data of a volume.
+type Volume struct {
+	name         string
+	owner        string
+	mw           *meta.MetaWrapper
+	ec           *stream.ExtentClient
+	multipartIno uint64
+}
+
+type objectInfo struct {
+	key         string
+	inode       uint64
+	size        uint64
+	modifyTime  time.Time
+	etag        string
+	contentType string
+}
+
+// the entries in the result of listing, either an object or a common prefix, in the lexical order
+type listEntry struct {
+	key    string
+	prefix bool
+	info   *objectInfo
+}
+
+func newVolume(name, owner, masters string, authenticator *auth.Authenticator) (v *Volume, err error) {
+	v = &Volume{name: name, owner: owner}
+	if v.mw, err = meta.NewMetaWrapper(name, owner, masters, authenticator); err != nil {
+		return nil, errors.Trace(err, "NewMetaWrapper failed!")
+	}
+	v.ec, err = stream.NewExtentClient(name, masters, authenticator, 0, 0, v.mw.AppendExtentKey, v.mw.GetExtents, v.mw.Truncate, v.mw.OverwriteExtents, v.mw.CheckQuota)
+	if err != nil {
+		return nil, errors.Trace(err, "NewExtentClient failed!")
+	}
+	if v.multipartIno, err = v.mkdir(proto.RootIno, MultipartDirName); err != nil {
+		return nil, errors.Trace(err, "create multipart directory failed!")
+	}
+	return
+}
+
+// splitKey returns the directories and the name of the file of the key. The keys of the directories,
+// i.e. ending with a slash, and the ones in the reserved directories are not allowed.
+func splitKey(key string) (dirs []string, name string, err error) {
+	if key == "" || len(key) > maxKeyLength {
+		return nil, "", ErrInvalidKey
+	}
+	parts := strings.Split(key, "/")
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return nil, "", ErrInvalidKey
+		}
+	}
+	if parts[0] == MultipartDirName || parts[0] == proto.TrashDirName {
+		return nil, "", ErrInvalidKey
+	}
+	return parts[:len(parts)-1], parts[len(parts)-1], nil
+}
+
+func (v *Volume) mkdir(parentID uint64, name string) (ino uint64, err error) {
+	ino, mode, err := v.mw.Lookup_ll(parentID, name)
+	if err == nil {
+		if !proto.IsDir(mode) {
+			return 0, ErrKeyIsDirectoryOrParent
+		}
+		return
+	}
+	if err != syscall.ENOENT {
+		return
+	}
+	info, err := v.mw.Create_ll(parentID, name, proto.Mode(dirMode), 0, 0, nil)
+	if err == syscall.EEXIST {
+		return v.mkdir(parentID, name)
+	}
+	if err != nil {
+		return
+	}
+	return info.Inode, nil
+}
+
+// lookupDirs returns the inodes of the directories in the path, and creates them if required.
+func (v *Volume) lookupDirs(dirs []string, create bool) (inodes []uint64, err error) {
+	parentID := proto.RootIno
+	for _, name := range dirs {
+		var (
+			ino  uint64
+			mode uint32
+		)
+		if create {
+			ino, err = v.mkdir(parentID, name)
+		} else if ino, mode, err = v.mw.Lookup_ll(parentID, name); err == nil && !proto.IsDir(mode) {
+			err = syscall.ENOENT
+		}
+		if err != nil {
+			return
+		}
+		inodes = append(inodes, ino)
+		parentID = ino
+	}
+	return
+}
+
+func lastOf(inodes []uint64) uint64 {
+	if len(inodes) == 0 {
+		return proto.RootIno
+	}
+	return inodes[len(inodes)-1]
+}
+
+func (v *Volume) getObjectInfo(key string) (info *objectInfo, err error) {
+	dirs, name, err := splitKey(key)
+	if err != nil {
+		return
+	}
+	inodes, err := v.lookupDirs(dirs, false)
+	if err != nil {
+		return nil, ErrNoSuchKey
+	}
+	ino, mode, err := v.mw.Lookup_ll(lastOf(inodes), name)
+	if err != nil || !proto.IsRegular(mode) {
+		return nil, ErrNoSuchKey
+	}
+	return v.getInodeInfo(key, ino)
+}
+
+func (v *Volume) getInodeInfo(key string, ino uint64) (info *objectInfo, err error) {
+	inode, err := v.mw.InodeGet_ll(ino)
+	if err != nil {
+		return nil, ErrNoSuchKey
+	}
+	info = &objectInfo{
+		key:         key,
+		inode:       ino,
+		size:        inode.Size,
+		modifyTime:  inode.ModifyTime,
+		contentType: DefaultContentType,
+	}
+	if etag, e := v.mw.XAttrGet_ll(ino, XAttrKeyETag); e == nil {
+		info.etag = string(etag)
+	}
+	if contentType, e := v.mw.XAttrGet_ll(ino, XAttrKeyContentType); e == nil && len(contentType) > 0 {
+		info.contentType = string(contentType)
+	}
+	return
+}
+
+// readFile writes the data of the file in [offset, offset+size) to the writer.
+func (v *Volume) readFile(ino, offset, size uint64, w io.Writer) (err error) {
+	if err = v.ec.OpenStream(ino); err != nil {
+		return
+	}
+	defer v.ec.CloseStream(ino)
+	buf := make([]byte, copyBufferSize)
+	for size > 0 {
+		n := uint64(len(buf))
+		if n > size {
+			n = size
+		}
+		var read int
+		read, err = v.ec.Read(ino, buf, int(offset), int(n))
+		if err != nil && err != io.EOF {
+			return
+		}
+		if read == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if _, err = w.Write(buf[:read]); err != nil {
+			return
+		}
+		offset += uint64(read)
+		size -= uint64(read)
+	}
+	return nil
+}
+
+func newTempName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "tmp_" + hex.EncodeToString(b)
+}
+
+// writeTempFile writes the data into a new temporary file, and returns its name and the MD5 of the data.
+func (v *Volume) writeTempFile(r io.Reader) (name string, ino uint64, etag string, err error) {
+	name = newTempName()
+	info, err := v.mw.Create_ll(v.multipartIno, name, proto.Mode(fileMode), 0, 0, nil)
+	if err != nil {
+		return
+	}
+	ino = info.Inode
+	h := md5.New()
+	if err = v.writeFile(ino, io.TeeReader(r, h)); err != nil {
+		v.removeFile(v.multipartIno, name)
+		return
+	}
+	etag = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+func (v *Volume) writeFile(ino uint64, r io.Reader) (err error) {
+	if err = v.ec.OpenStream(ino); err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := v.ec.CloseStream(ino); err == nil {
+			err = closeErr
+		}
+	}()
+	buf := make([]byte, copyBufferSize)
+	offset := 0
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err = v.ec.Write(ino, offset, buf[:n], false); err != nil {
+				return
+			}
+			offset += n
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	return v.ec.Flush(ino)
+}
+
+func (v *Volume) removeFile(parentID uint64, name string) {
+	info, err := v.mw.Delete_ll(parentID, name, false)
+	if err != nil {
+		log.LogWarnf("removeFile: vol(%v) parent(%v) name(%v) err(%v)", v.name, parentID, name, err)
+		return
+	}
+	if info != nil && info.Nlink == 0 {
+		v.mw.Evict(info.Inode)
+	}
+}
+
+// moveFile renames the file into the directory, and the file of the same name is overwritten.
+func (v *Volume) moveFile(srcParentID uint64, srcName string, dstParentID uint64, dstName string) (err error) {
+	oldIno, oldMode, lookupErr := v.mw.Lookup_ll(dstParentID, dstName)
+	if lookupErr == nil && !proto.IsRegular(oldMode) {
+		return ErrKeyIsDirectoryOrParent
+	}
+	if err = v.mw.Rename_ll(srcParentID, srcName, dstParentID, dstName); err != nil {
+		return
+	}
+	// the overwritten inode is unlinked by the rename, and evicted as it is no longer opened
+	if lookupErr == nil {
+		v.mw.Evict(oldIno)
+	}
+	return
+}
+
+// commitTempFile moves the temporary file to the path of the key with the attributes of the object.
+func (v *Volume) commitTempFile(name string, ino uint64, key, etag, contentType string) (err error) {
+	defer func() {
+		if err != nil {
+			v.removeFile(v.multipartIno, name)
+		}
+	}()
+	dirs, fileName, err := splitKey(key)
+	if err != nil {
+		return
+	}
+	if err = v.mw.XAttrSetAsRoot_ll(ino, XAttrKeyETag, []byte(etag), 0); err != nil {
+		return
+	}
+	if contentType != "" {
+		if err = v.mw.XAttrSetAsRoot_ll(ino, XAttrKeyContentType, []byte(contentType), 0); err != nil {
+			return
+		}
+	}
+	inodes, err := v.lookupDirs(dirs, true)
+	if err != nil {
+		return
+	}
+	return v.moveFile(v.multipartIno, name, lastOf(inodes), fileName)
+}
+
+func (v *Volume) putObject(key, contentType string, r io.Reader) (etag string, err error) {
+	if _, _, err = splitKey(key); err != nil {
+		return
+	}
+	name, ino, etag, err := v.writeTempFile(r)
+	if err != nil {
+		return
+	}
+	err = v.commitTempFile(name, ino, key, etag, contentType)
+	return
+}
+
+// deleteObject deletes the file of the key, and then the directories left empty.
+func (v *Volume) deleteObject(key string) (err error) {
+	dirs, name, err := splitKey(key)
+	if err != nil {
+		return
+	}
+	inodes, err := v.lookupDirs(dirs, false)
+	if err != nil {
+		return nil
+	}
+	_, mode, err := v.mw.Lookup_ll(lastOf(inodes), name)
+	if err != nil || !proto.IsRegular(mode) {
+		return nil
+	}
+	info, err := v.mw.Delete_ll(lastOf(inodes), name, false)
+	if err != nil {
+		return
+	}
+	if info != nil && info.Nlink == 0 {
+		v.mw.Evict(info.Inode)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, e := v.mw.Delete_ll(lastOf(inodes[:i]), dirs[i], true); e != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// listObjects lists the objects of the prefix after the marker in the lexical order. Only the slash is
+// supported as the delimiter, so that the common prefixes are the directories.
+func (v *Volume) listObjects(prefix, delimiter, marker string, maxKeys int) (entries []*listEntry, truncated bool, err error) {
+	// one more entry is listed to tell if the result is truncated
+	limit := maxKeys + 1
+	err = v.walk(proto.RootIno, "", prefix, delimiter, marker, limit, &entries)
+	if len(entries) > maxKeys {
+		entries = entries[:maxKeys]
+		truncated = true
+	}
+	return
+}
+
+// walk lists the keys in the directory after the marker. The children are read in batches in the order of their
+// names, while a directory is ordered as its name with a slash, which is the order of the keys in it. So the
+// directories are held until the children ordered before them are walked.
+func (v *Volume) walk(dirIno uint64, dirKey, prefix, delimiter, marker string, limit int, entries *[]*listEntry) (err error) {
+	var pending []proto.Dentry
+	ds := v.mw.OpenDirStream(dirIno)
+	for offset := uint64(0); len(*entries) < limit; {
+		var children []proto.Dentry
+		if children, err = ds.ReadAt(offset); err != nil {
+			return
+		}
+		if len(children) == 0 {
+			break
+		}
+		offset += uint64(len(children))
+		for _, child := range children {
+			key := objectSortKey(child)
+			for len(pending) > 0 && objectSortKey(pending[0]) < key {
+				if err = v.walkChild(dirIno, dirKey, pending[0], prefix, delimiter, marker, limit, entries); err != nil {
+					return
+				}
+				pending = pending[1:]
+			}
+			if proto.IsDir(child.Type) {
+				i := sort.Search(len(pending), func(i int) bool { return objectSortKey(pending[i]) > key })
+				pending = append(pending, proto.Dentry{})
+				copy(pending[i+1:], pending[i:])
+				pending[i] = child
+				continue
+			}
+			if err = v.walkChild(dirIno, dirKey, child, prefix, delimiter, marker, limit, entries); err != nil {
+				return
+			}
+		}
+	}
+	for _, child := range pending {
+		if err = v.walkChild(dirIno, dirKey, child, prefix, delimiter, marker, limit, entries); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func objectSortKey(d proto.Dentry) string {
+	if proto.IsDir(d.Type) {
+		return d.Name + "/"
+	}
+	return d.Name
+}
+
+func (v *Volume) walkChild(dirIno uint64, dirKey string, child proto.Dentry, prefix, delimiter, marker string, limit int, entries *[]*listEntry) (err error) {
+	if len(*entries) >= limit {
+		return
+	}
+	if dirIno == proto.RootIno && (child.Name == MultipartDirName || child.Name == proto.TrashDirName) {
+		return
+	}
+	key := dirKey + objectSortKey(child)
+	if proto.IsDir(child.Type) {
+		if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+			return
+		}
+		// all the keys in the directory are before the marker
+		if key <= marker && !strings.HasPrefix(marker, key) {
+			return
+		}
+		// the directory of the prefix itself is descended into, as its children are after the prefix
+		if delimiter != "" && strings.HasPrefix(key, prefix) && key != prefix {
+			if key > marker {
+				*entries = append(*entries, &listEntry{key: key, prefix: true})
+			}
+			return
+		}
+		return v.walk(child.Inode, key, prefix, delimiter, marker, limit, entries)
+	}
+	if !proto.IsRegular(child.Type) || !strings.HasPrefix(key, prefix) || key <= marker {
+		return
+	}
+	info, e := v.getInodeInfo(key, child.Inode)
+	if e != nil {
+		// deleted in the meantime
+		return
+	}
+	*entries = append(*entries, &listEntry{key: key, info: info})
+	return
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (v *Volume) initiateUpload(key, contentType string) (uploadID string, err error) {
+	if _, _, err = splitKey(key); err != nil {
+		return
+	}
+	uploadID = newUploadID()
+	ino, err := v.mkdir(v.multipartIno, uploadID)
+	if err != nil {
+		return
+	}
+	if err = v.mw.XAttrSetAsRoot_ll(ino, XAttrKeyUploadKey, []byte(key), 0); err != nil {
+		return
+	}
+	if contentType != "" {
+		err = v.mw.XAttrSetAsRoot_ll(ino, XAttrKeyContentType, []byte(contentType), 0)
+	}
+	return
+}
+
+// Returns the directory of the upload, which must be of the key.
+func (v *Volume) getUploadDir(uploadID, key string) (ino uint64, err error) {
+	ino, mode, err := v.mw.Lookup_ll(v.multipartIno, uploadID)
+	if err != nil || !proto.IsDir(mode) {
+		return 0, ErrNoSuchUpload
+	}
+	uploadKey, err := v.mw.XAttrGet_ll(ino, XAttrKeyUploadKey)
+	if err != nil || string(uploadKey) != key {
+		return 0, ErrNoSuchUpload
+	}
+	return
+}
+
+// the parts are named with the zero-padded numbers, so that they are listed in order
+func partName(partNumber int) string {
+	return fmt.Sprintf("%05d", partNumber)
+}
+
+func (v *Volume) uploadPart(uploadID, key string, partNumber int, r io.Reader) (etag string, err error) {
+	uploadIno, err := v.getUploadDir(uploadID, key)
+	if err != nil {
+		return
+	}
+	name, ino, etag, err := v.writeTempFile(r)
+	if err != nil {
+		return
+	}
+	if err = v.mw.XAttrSetAsRoot_ll(ino, XAttrKeyETag, []byte(etag), 0); err != nil {
+		v.removeFile(v.multipartIno, name)
+		return
+	}
+	if err = v.moveFile(v.multipartIno, name, uploadIno, partName(partNumber)); err != nil {
+		v.removeFile(v.multipartIno, name)
+	}
+	return
+}
+
+func (v *Volume) listParts(uploadID, key string) (parts []*Part, err error) {
+	uploadIno, err := v.getUploadDir(uploadID, key)
+	if err != nil {
+		return
+	}
+	children, err := v.mw.ReadDir_ll(uploadIno)
+	if err != nil {
+		return
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	for _, child := range children {
+		partNumber, e := strconv.Atoi(child.Name)
+		if e != nil {
+			continue
+		}
+		info, e := v.getInodeInfo(child.Name, child.Inode)
+		if e != nil {
+			continue
+		}
+		parts = append(parts, &Part{
+			PartNumber:   partNumber,
+			LastModified: formatTimeISO(info.modifyTime),
+			ETag:         quoteETag(info.etag),
+			Size:         info.size,
+		})
+	}
+	return
+}
+
+// completeUpload concatenates the parts into the object. The ETag of the object is the MD5 of the MD5s
+// of the parts, with the number of the parts, as S3 does.
+func (v *Volume) completeUpload(uploadID, key string, parts []*CompletePart) (etag string, err error) {
+	uploadIno, err := v.getUploadDir(uploadID, key)
+	if err != nil {
+		return
+	}
+	if len(parts) == 0 {
+		return "", ErrMalformedXML
+	}
+	inodes := make([]*objectInfo, 0, len(parts))
+	h := md5.New()
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return "", ErrInvalidPartOrder
+		}
+		ino, _, e := v.mw.Lookup_ll(uploadIno, partName(part.PartNumber))
+		if e != nil {
+			return "", ErrInvalidPart
+		}
+		info, e := v.getInodeInfo(partName(part.PartNumber), ino)
+		if e != nil || info.etag != strings.Trim(part.ETag, "\"") {
+			return "", ErrInvalidPart
+		}
+		sum, _ := hex.DecodeString(info.etag)
+		h.Write(sum)
+		inodes = append(inodes, info)
+	}
+	etag = hex.EncodeToString(h.Sum(nil)) + "-" + strconv.Itoa(len(parts))
+
+	pr, pw := io.Pipe()
+	go func() {
+		var e error
+		for _, info := range inodes {
+			if e = v.readFile(info.inode, 0, info.size, pw); e != nil {
+				break
+			}
+		}
+		pw.CloseWithError(e)
+	}()
+	name, ino, _, err := v.writeTempFile(pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return
+	}
+	var contentType string
+	if value, e := v.mw.XAttrGet_ll(uploadIno, XAttrKeyContentType); e == nil {
+		contentType = string(value)
+	}
+	if err = v.commitTempFile(name, ino, key, etag, contentType); err != nil {
+		return
+	}
+	v.removeUpload(uploadIno, uploadID)
+	return
+}
+
+func (v *Volume) abortUpload(uploadID, key string) (err error) {
+	uploadIno, err := v.getUploadDir(uploadID, key)
+	if err != nil {
+		return
+	}
+	v.removeUpload(uploadIno, uploadID)
+	return
+}
+
+func (v *Volume) removeUpload(uploadIno uint64, uploadID string) {
+	children, err := v.mw.ReadDir_ll(uploadIno)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		v.removeFile(uploadIno, child.Name)
+	}
+	if _, err = v.mw.Delete_ll(v.multipartIno, uploadID, true); err != nil {
+		log.LogWarnf("removeUpload: vol(%v) upload(%v) err(%v)", v.name, uploadID, err)
+	}
+}
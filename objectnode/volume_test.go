@@ -0,0 +1,159 @@
+package objectnode
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		dirs []string
+		name string
+		err  error
+	}{
+		{key: "a", name: "a"},
+		{key: "a/b/c.txt", dirs: []string{"a", "b"}, name: "c.txt"},
+		{key: MultipartDirName + "x/" + proto.TrashDirName, dirs: []string{MultipartDirName + "x"}, name: proto.TrashDirName},
+		{key: "", err: ErrInvalidKey},
+		{key: "/a", err: ErrInvalidKey},
+		{key: "a/", err: ErrInvalidKey},
+		{key: "a//b", err: ErrInvalidKey},
+		{key: "a/./b", err: ErrInvalidKey},
+		{key: "a/../b", err: ErrInvalidKey},
+		{key: MultipartDirName + "/a", err: ErrInvalidKey},
+		{key: proto.TrashDirName + "/a", err: ErrInvalidKey},
+		{key: string(make([]byte, maxKeyLength+1)), err: ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		dirs, name, err := splitKey(tt.key)
+		if err != tt.err {
+			t.Errorf("splitKey(%.20q): expect err %v, got %v", tt.key, tt.err, err)
+			continue
+		}
+		if len(dirs) == 0 {
+			dirs = nil
+		}
+		if !reflect.DeepEqual(dirs, tt.dirs) || name != tt.name {
+			t.Errorf("splitKey(%q): expect %v %v, got %v %v", tt.key, tt.dirs, tt.name, dirs, name)
+		}
+	}
+}
+
+func newTestVolume(t *testing.T) (*mocktest.MockVolume, *Volume) {
+	vol, err := mocktest.NewMockVolume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := meta.NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		vol.Close()
+		t.Fatal(err)
+	}
+	v := &Volume{name: vol.Name, owner: "owner", mw: mw}
+	if v.multipartIno, err = v.mkdir(proto.RootIno, MultipartDirName); err != nil {
+		vol.Close()
+		t.Fatal(err)
+	}
+	return vol, v
+}
+
+func (v *Volume) createTestTempFile(t *testing.T, name string) uint64 {
+	info, err := v.mw.Create_ll(v.multipartIno, name, proto.Mode(fileMode), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Inode
+}
+
+// The temporary file written is moved to the key, and the object of the same key is replaced.
+func TestCommitTempFile(t *testing.T) {
+	vol, v := newTestVolume(t)
+	defer vol.Close()
+
+	ino := v.createTestTempFile(t, "tmp1")
+	if err := v.commitTempFile("tmp1", ino, "a/b/c", "etag1", "text/plain"); err != nil {
+		t.Fatalf("expect the commit to succeed, got %v", err)
+	}
+	if _, _, err := v.mw.Lookup_ll(v.multipartIno, "tmp1"); err == nil {
+		t.Fatalf("expect the temporary file to be moved")
+	}
+	info, err := v.getObjectInfo("a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.inode != ino || info.etag != "etag1" || info.contentType != "text/plain" {
+		t.Fatalf("unexpected object %+v", info)
+	}
+
+	newIno := v.createTestTempFile(t, "tmp2")
+	if err = v.commitTempFile("tmp2", newIno, "a/b/c", "etag2", ""); err != nil {
+		t.Fatalf("expect the object to be replaced, got %v", err)
+	}
+	if info, err = v.getObjectInfo("a/b/c"); err != nil || info.inode != newIno || info.etag != "etag2" {
+		t.Fatalf("unexpected object %+v err %v", info, err)
+	}
+	if vol.Inode(ino) != nil {
+		t.Fatalf("expect the replaced inode %v to be evicted", ino)
+	}
+
+	// a directory is not replaced by an object, and the temporary file is removed
+	dirIno := v.createTestTempFile(t, "tmp3")
+	if err = v.commitTempFile("tmp3", dirIno, "a/b", "etag3", ""); err != ErrKeyIsDirectoryOrParent {
+		t.Fatalf("expect %v, got %v", ErrKeyIsDirectoryOrParent, err)
+	}
+	if _, _, err = v.mw.Lookup_ll(v.multipartIno, "tmp3"); err == nil {
+		t.Fatalf("expect the temporary file to be removed")
+	}
+}
+
+func listTestKeys(t *testing.T, v *Volume, prefix, delimiter, marker string, maxKeys int) (keys []string, truncated bool) {
+	t.Helper()
+	entries, truncated, err := v.listObjects(prefix, delimiter, marker, maxKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		keys = append(keys, e.key)
+	}
+	return
+}
+
+// The keys are listed in the lexical order, where a directory is ordered as its name with a slash.
+func TestListObjects(t *testing.T) {
+	vol, v := newTestVolume(t)
+	defer vol.Close()
+	for i, key := range []string{"b", "a/d/e", "a0", "a-b", "a/c"} {
+		name := fmt.Sprintf("tmp%v", i)
+		if err := v.commitTempFile(name, v.createTestTempFile(t, name), key, "etag", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix, delimiter, marker string
+		maxKeys                   int
+		keys                      []string
+		truncated                 bool
+	}{
+		{"", "", "", 10, []string{"a-b", "a/c", "a/d/e", "a0", "b"}, false},
+		{"", "/", "", 10, []string{"a-b", "a/", "a0", "b"}, false},
+		{"", "", "a/c", 10, []string{"a/d/e", "a0", "b"}, false},
+		{"a/", "", "", 10, []string{"a/c", "a/d/e"}, false},
+		{"a/", "/", "", 10, []string{"a/c", "a/d/"}, false},
+		{"", "", "", 2, []string{"a-b", "a/c"}, true},
+		{"", "", "b", 10, nil, false},
+	}
+	for _, tt := range tests {
+		keys, truncated := listTestKeys(t, v, tt.prefix, tt.delimiter, tt.marker, tt.maxKeys)
+		if !reflect.DeepEqual(keys, tt.keys) || truncated != tt.truncated {
+			t.Errorf("list(%q, %q, %q, %v): expect %v truncated %v, got %v truncated %v", tt.prefix, tt.delimiter,
+				tt.marker, tt.maxKeys, tt.keys, tt.truncated, keys, truncated)
+		}
+	}
+}
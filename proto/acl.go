@@ -0,0 +1,213 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// The POSIX ACLs are kept as the extended attributes of the inode, in the same binary format as
+// the ones of Linux, so that getfacl(1) and setfacl(1) work on the mounted volume as they are.
+const (
+	XAttrACLAccess  = "system.posix_acl_access"
+	XAttrACLDefault = "system.posix_acl_default"
+)
+
+// Tags of the ACL entries.
+const (
+	ACLUserObj  uint16 = 0x01
+	ACLUser     uint16 = 0x02
+	ACLGroupObj uint16 = 0x04
+	ACLGroup    uint16 = 0x08
+	ACLMask     uint16 = 0x10
+	ACLOther    uint16 = 0x20
+)
+
+// Permission bits of the ACL entries, which are also the ones of access(2).
+const (
+	ACLExec  uint16 = 0x01
+	ACLWrite uint16 = 0x02
+	ACLRead  uint16 = 0x04
+)
+
+const (
+	aclVersion     = 2
+	aclHeaderSize  = 4
+	aclEntrySize   = 8
+	aclUndefinedID = 0xffffffff
+)
+
+var ErrInvalidACL = errors.New("invalid acl")
+
+// ACLEntry defines an entry of the ACL.
+type ACLEntry struct {
+	Tag  uint16
+	Perm uint16
+	ID   uint32 // the uid or gid of the ACLUser and ACLGroup entries
+}
+
+// ACL defines a POSIX ACL, whose entries are sorted by the tags and the ids.
+type ACL []ACLEntry
+
+// ParseACL parses and validates the ACL in the extended attribute.
+func ParseACL(raw []byte) (ACL, error) {
+	if len(raw) < aclHeaderSize || (len(raw)-aclHeaderSize)%aclEntrySize != 0 ||
+		binary.LittleEndian.Uint32(raw) != aclVersion {
+		return nil, ErrInvalidACL
+	}
+	acl := make(ACL, 0, (len(raw)-aclHeaderSize)/aclEntrySize)
+	for off := aclHeaderSize; off < len(raw); off += aclEntrySize {
+		e := ACLEntry{
+			Tag:  binary.LittleEndian.Uint16(raw[off:]),
+			Perm: binary.LittleEndian.Uint16(raw[off+2:]),
+			ID:   binary.LittleEndian.Uint32(raw[off+4:]),
+		}
+		if e.Tag != ACLUser && e.Tag != ACLGroup {
+			e.ID = aclUndefinedID
+		}
+		acl = append(acl, e)
+	}
+	if !acl.valid() {
+		return nil, ErrInvalidACL
+	}
+	return acl, nil
+}
+
+// valid checks that the ACL has exactly one entry of the owner, the owning group and the others,
+// no duplicated users or groups, and a mask if there is any named user or group.
+func (acl ACL) valid() bool {
+	counts := make(map[uint16]int)
+	for i, e := range acl {
+		if e.Perm&^(ACLRead|ACLWrite|ACLExec) != 0 {
+			return false
+		}
+		switch e.Tag {
+		case ACLUserObj, ACLUser, ACLGroupObj, ACLGroup, ACLMask, ACLOther:
+		default:
+			return false
+		}
+		if i > 0 && !acl.less(i-1, i) {
+			return false
+		}
+		counts[e.Tag]++
+	}
+	if counts[ACLUserObj] != 1 || counts[ACLGroupObj] != 1 || counts[ACLOther] != 1 || counts[ACLMask] > 1 {
+		return false
+	}
+	return counts[ACLMask] == 1 || counts[ACLUser]+counts[ACLGroup] == 0
+}
+
+func (acl ACL) less(i, j int) bool {
+	if acl[i].Tag != acl[j].Tag {
+		return acl[i].Tag < acl[j].Tag
+	}
+	return acl[i].ID < acl[j].ID
+}
+
+// Marshal returns the ACL in the format of the extended attribute.
+func (acl ACL) Marshal() []byte {
+	raw := make([]byte, aclHeaderSize+len(acl)*aclEntrySize)
+	binary.LittleEndian.PutUint32(raw, aclVersion)
+	off := aclHeaderSize
+	for _, e := range acl {
+		binary.LittleEndian.PutUint16(raw[off:], e.Tag)
+		binary.LittleEndian.PutUint16(raw[off+2:], e.Perm)
+		binary.LittleEndian.PutUint32(raw[off+4:], e.ID)
+		off += aclEntrySize
+	}
+	return raw
+}
+
+// IsMinimal checks if the ACL is equivalent to the permission bits of the mode, in which case it
+// is not kept at all.
+func (acl ACL) IsMinimal() bool {
+	return len(acl) == 3
+}
+
+func (acl ACL) find(tag uint16) *ACLEntry {
+	for i := range acl {
+		if acl[i].Tag == tag {
+			return &acl[i]
+		}
+	}
+	return nil
+}
+
+// groupClass returns the entry whose permission is shown as the one of the group in the mode,
+// which is the mask if there is any.
+func (acl ACL) groupClass() *ACLEntry {
+	if e := acl.find(ACLMask); e != nil {
+		return e
+	}
+	return acl.find(ACLGroupObj)
+}
+
+// Mode returns the permission bits of the mode equivalent to the ACL.
+func (acl ACL) Mode() os.FileMode {
+	return os.FileMode(acl.find(ACLUserObj).Perm)<<6 | os.FileMode(acl.groupClass().Perm)<<3 |
+		os.FileMode(acl.find(ACLOther).Perm)
+}
+
+// Chmod returns a copy of the ACL updated with the permission bits of the mode.
+func (acl ACL) Chmod(mode os.FileMode) ACL {
+	acl = append(ACL(nil), acl...)
+	acl.find(ACLUserObj).Perm = uint16(mode>>6) & 7
+	acl.groupClass().Perm = uint16(mode>>3) & 7
+	acl.find(ACLOther).Perm = uint16(mode) & 7
+	return acl
+}
+
+// Inherit returns the access ACL of a new inode created with the mode in the directory with the
+// default ACL, along with the mode of the inode, in which the permission bits are masked by the
+// ones of the ACL.
+func (acl ACL) Inherit(mode os.FileMode) (ACL, os.FileMode) {
+	access := append(ACL(nil), acl...)
+	access.find(ACLUserObj).Perm &= uint16(mode>>6) & 7
+	access.groupClass().Perm &= uint16(mode>>3) & 7
+	access.find(ACLOther).Perm &= uint16(mode) & 7
+	return access, mode&^os.ModePerm | access.Mode()
+}
+
+// Permits checks if the caller is permitted to access with the permission bits by the ACL of the
+// inode with the owner and the owning group, as the algorithm of acl(5).
+func (acl ACL) Permits(uid uint32, inGroup func(gid uint32) bool, owner, group uint32, want uint16) bool {
+	mask := ACLRead | ACLWrite | ACLExec
+	if e := acl.find(ACLMask); e != nil {
+		mask = e.Perm
+	}
+	if uid == owner {
+		return acl.find(ACLUserObj).Perm&want == want
+	}
+	for _, e := range acl {
+		if e.Tag == ACLUser && e.ID == uid {
+			return e.Perm&mask&want == want
+		}
+	}
+	var matched bool
+	for _, e := range acl {
+		if (e.Tag == ACLGroupObj && inGroup(group)) || (e.Tag == ACLGroup && inGroup(e.ID)) {
+			if e.Perm&mask&want == want {
+				return true
+			}
+			matched = true
+		}
+	}
+	if matched {
+		return false
+	}
+	return acl.find(ACLOther).Perm&want == want
+}
@@ -0,0 +1,232 @@
+package proto
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const testUndefinedID = aclUndefinedID
+
+func testACL(named bool) ACL {
+	acl := ACL{
+		{Tag: ACLUserObj, Perm: ACLRead | ACLWrite | ACLExec, ID: testUndefinedID},
+		{Tag: ACLGroupObj, Perm: ACLRead | ACLExec, ID: testUndefinedID},
+		{Tag: ACLOther, Perm: ACLRead, ID: testUndefinedID},
+	}
+	if named {
+		acl = ACL{
+			acl[0],
+			{Tag: ACLUser, Perm: ACLRead | ACLWrite, ID: 10},
+			acl[1],
+			{Tag: ACLGroup, Perm: ACLRead | ACLWrite | ACLExec, ID: 20},
+			{Tag: ACLMask, Perm: ACLRead | ACLExec, ID: testUndefinedID},
+			acl[2],
+		}
+	}
+	return acl
+}
+
+func TestParseACL(t *testing.T) {
+	minimal, named := testACL(false), testACL(true)
+	with := func(acl ACL, f func(ACL) ACL) []byte {
+		return f(append(ACL(nil), acl...)).Marshal()
+	}
+	badVersion := minimal.Marshal()
+	binary.LittleEndian.PutUint32(badVersion, 1)
+	tests := []struct {
+		name string
+		raw  []byte
+		want ACL
+	}{
+		{"minimal", minimal.Marshal(), minimal},
+		{"named", named.Marshal(), named},
+		{"undefined ids", with(minimal, func(acl ACL) ACL { acl[0].ID = 1; return acl }), minimal},
+		{"empty", nil, nil},
+		{"header only", minimal.Marshal()[:aclHeaderSize], nil},
+		{"bad version", badVersion, nil},
+		{"bad length", minimal.Marshal()[:aclHeaderSize+aclEntrySize+1], nil},
+		{"bad tag", with(minimal, func(acl ACL) ACL { return append(acl, ACLEntry{Tag: 0x40}) }), nil},
+		{"bad perm", with(minimal, func(acl ACL) ACL { acl[2].Perm = 8; return acl }), nil},
+		{"no owner", with(minimal, func(acl ACL) ACL { return acl[1:] }), nil},
+		{"no other", with(minimal, func(acl ACL) ACL { return acl[:2] }), nil},
+		{"unsorted", with(minimal, func(acl ACL) ACL { acl[1], acl[2] = acl[2], acl[1]; return acl }), nil},
+		{"unsorted users", with(named, func(acl ACL) ACL {
+			return append(acl[:2], append(ACL{{Tag: ACLUser, ID: 5}}, acl[2:]...)...)
+		}), nil},
+		{"duplicated user", with(named, func(acl ACL) ACL {
+			return append(acl[:2], append(ACL{acl[1]}, acl[2:]...)...)
+		}), nil},
+		{"duplicated mask", with(named, func(acl ACL) ACL {
+			return append(acl[:5], append(ACL{acl[4]}, acl[5:]...)...)
+		}), nil},
+		{"named without mask", with(named, func(acl ACL) ACL { return append(acl[:4], acl[5]) }), nil},
+	}
+	for _, tt := range tests {
+		acl, err := ParseACL(tt.raw)
+		if tt.want == nil {
+			if err != ErrInvalidACL {
+				t.Errorf("%v: expect the ACL to be invalid, got %v %v", tt.name, acl, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(acl, tt.want) {
+			t.Errorf("%v: expect %v, got %v %v", tt.name, tt.want, acl, err)
+		}
+	}
+}
+
+func TestACLMode(t *testing.T) {
+	if mode := testACL(false).Mode(); mode != 0754 {
+		t.Fatalf("expect the mode of the minimal ACL to be 0754, got %o", mode)
+	}
+	// the group class of the mode is the mask rather than the owning group
+	acl := testACL(true)
+	acl[4].Perm = ACLRead
+	if mode := acl.Mode(); mode != 0744 {
+		t.Fatalf("expect the mode to show the mask, got %o", mode)
+	}
+	if !testACL(false).IsMinimal() || acl.IsMinimal() {
+		t.Fatalf("expect only the ACL of three entries to be minimal")
+	}
+}
+
+func TestACLChmod(t *testing.T) {
+	tests := []struct {
+		name string
+		acl  ACL
+		mode os.FileMode
+		want [4]uint16 // the owner, the owning group, the mask and the others
+	}{
+		{"minimal", testACL(false), 0640, [4]uint16{6, 4, 0, 0}},
+		{"mask", testACL(true), 0640, [4]uint16{6, 5, 4, 0}},
+		{"mask cleared", testACL(true), 0707, [4]uint16{7, 5, 0, 7}},
+	}
+	for _, tt := range tests {
+		old := append(ACL(nil), tt.acl...)
+		acl := tt.acl.Chmod(tt.mode)
+		if !reflect.DeepEqual(tt.acl, old) {
+			t.Errorf("%v: expect the ACL not to be changed in place", tt.name)
+		}
+		var got [4]uint16
+		got[0], got[1], got[3] = acl.find(ACLUserObj).Perm, acl.find(ACLGroupObj).Perm, acl.find(ACLOther).Perm
+		if mask := acl.find(ACLMask); mask != nil {
+			got[2] = mask.Perm
+		}
+		if got != tt.want {
+			t.Errorf("%v: expect %v, got %v", tt.name, tt.want, got)
+		}
+		if acl.Mode() != tt.mode {
+			t.Errorf("%v: expect mode %o, got %o", tt.name, tt.mode, acl.Mode())
+		}
+		// the named entries are kept, and masked instead
+		if len(acl) != len(tt.acl) || (len(acl) > 3 && acl[1] != tt.acl[1]) {
+			t.Errorf("%v: expect the named entries to be kept, got %v", tt.name, acl)
+		}
+	}
+}
+
+func TestACLInherit(t *testing.T) {
+	tests := []struct {
+		name     string
+		acl      ACL
+		mode     os.FileMode
+		want     ACL
+		wantMode os.FileMode
+	}{
+		{
+			name:     "minimal",
+			acl:      testACL(false),
+			mode:     os.ModeDir | 0777,
+			want:     testACL(false),
+			wantMode: os.ModeDir | 0754,
+		},
+		{
+			name: "minimal masked",
+			acl:  testACL(false),
+			mode: 0640,
+			want: ACL{
+				{Tag: ACLUserObj, Perm: ACLRead | ACLWrite, ID: testUndefinedID},
+				{Tag: ACLGroupObj, Perm: ACLRead, ID: testUndefinedID},
+				{Tag: ACLOther, Perm: 0, ID: testUndefinedID},
+			},
+			wantMode: 0640,
+		},
+		{
+			// the mask rather than the owning group is limited by the mode of the group
+			name: "named",
+			acl:  testACL(true),
+			mode: os.ModeSetgid | 0644,
+			want: ACL{
+				{Tag: ACLUserObj, Perm: ACLRead | ACLWrite, ID: testUndefinedID},
+				{Tag: ACLUser, Perm: ACLRead | ACLWrite, ID: 10},
+				{Tag: ACLGroupObj, Perm: ACLRead | ACLExec, ID: testUndefinedID},
+				{Tag: ACLGroup, Perm: ACLRead | ACLWrite | ACLExec, ID: 20},
+				{Tag: ACLMask, Perm: ACLRead, ID: testUndefinedID},
+				{Tag: ACLOther, Perm: ACLRead, ID: testUndefinedID},
+			},
+			wantMode: os.ModeSetgid | 0644,
+		},
+	}
+	for _, tt := range tests {
+		old := append(ACL(nil), tt.acl...)
+		acl, mode := tt.acl.Inherit(tt.mode)
+		if !reflect.DeepEqual(tt.acl, old) {
+			t.Errorf("%v: expect the default ACL not to be changed", tt.name)
+		}
+		if !reflect.DeepEqual(acl, tt.want) || mode != tt.wantMode {
+			t.Errorf("%v: expect %v %o, got %v %o", tt.name, tt.want, tt.wantMode, acl, mode)
+		}
+	}
+}
+
+func TestACLPermits(t *testing.T) {
+	const owner, group = 1, 2
+	groups := func(gids ...uint32) func(uint32) bool {
+		return func(gid uint32) bool {
+			for _, g := range gids {
+				if g == gid {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	named := testACL(true)
+	openOthers := testACL(false)
+	openOthers[1].Perm, openOthers[2].Perm = 0, ACLRead|ACLWrite|ACLExec
+	tests := []struct {
+		name    string
+		acl     ACL
+		uid     uint32
+		inGroup func(uint32) bool
+		want    uint16
+		permits bool
+	}{
+		{"owner", named, owner, groups(), ACLRead | ACLWrite | ACLExec, true},
+		// the mask does not apply to the owner
+		{"owner unmasked", named, owner, groups(group), ACLWrite, true},
+		{"named user", named, 10, groups(), ACLRead, true},
+		{"named user masked", named, 10, groups(), ACLWrite, false},
+		// the named user is not checked against the groups
+		{"named user in group", named, 10, groups(20), ACLWrite, false},
+		{"owning group", named, 3, groups(group), ACLRead | ACLExec, true},
+		{"owning group denied", named, 3, groups(group), ACLWrite, false},
+		{"named group masked", named, 3, groups(20), ACLWrite, false},
+		{"named group", named, 3, groups(20), ACLExec, true},
+		// any of the matched groups grants the permission
+		{"groups", named, 3, groups(group, 20), ACLRead | ACLExec, true},
+		// the others are not checked once a group is matched
+		{"group over others", openOthers, 3, groups(group), ACLRead, false},
+		{"others", named, 3, groups(), ACLRead, true},
+		{"others denied", named, 3, groups(), ACLExec, false},
+		{"minimal group", testACL(false), 3, groups(group), ACLRead | ACLExec, true},
+		{"minimal others", testACL(false), 3, groups(4), ACLWrite, false},
+	}
+	for _, tt := range tests {
+		if permits := tt.acl.Permits(tt.uid, tt.inGroup, owner, group, tt.want); permits != tt.permits {
+			t.Errorf("%v: expect %v, got %v", tt.name, tt.permits, permits)
+		}
+	}
+}
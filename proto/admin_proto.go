@@ -32,6 +32,28 @@ const (
 	AdminGetIP                     = "/admin/getIp"
 	AdminCreateMP                  = "/metaPartition/create"
 	AdminSetMetaNodeThreshold      = "/threshold/set"
+	AdminSetQuota                  = "/quota/set"
+	AdminDeleteQuota               = "/quota/delete"
+	AdminGetQuota                  = "/quota/get"
+	AdminListQuota                 = "/quota/list"
+	AdminCreateSnapshot            = "/snapshot/create"
+	AdminDeleteSnapshot            = "/snapshot/delete"
+	AdminListSnapshot              = "/snapshot/list"
+	AdminSetVolTrash               = "/vol/setTrash"
+	AdminSetVolEc                  = "/vol/setEc"
+	AdminSetVolTier                = "/vol/setTier"
+	AdminSplitDir                  = "/dir/split"
+	AdminStartBalancer             = "/balancer/start"
+	AdminStopBalancer              = "/balancer/stop"
+	AdminGetBalancer               = "/balancer/get"
+	AdminStartMetaBalancer         = "/metaBalancer/start"
+	AdminStopMetaBalancer          = "/metaBalancer/stop"
+	AdminGetMetaBalancer           = "/metaBalancer/get"
+	AdminListJobs                  = "/job/list"
+	AdminGetJob                    = "/job/get"
+	AdminCancelJob                 = "/job/cancel"
+	AdminPauseJob                  = "/job/pause"
+	AdminResumeJob                 = "/job/resume"
 
 	// Client APIs
 	ClientDataPartitions = "/client/partitions"
@@ -92,6 +114,9 @@ type CreateDataPartitionRequest struct {
 	Members       []Peer
 	Hosts         []string
 	CreateType    int
+	EcDataNum     uint8
+	EcParityNum   uint8
+	MediaType     string // media class of the disk to create the partition on, any if empty
 }
 
 // CreateDataPartitionResponse defines the response to the request of creating a data partition.
@@ -203,6 +228,7 @@ type PartitionReport struct {
 	IsLeader        bool
 	ExtentCount     int
 	NeedCompare     bool
+	BadExtentCount  int // extents with the corrupt blocks not repaired by the last scrub
 }
 
 // DataNodeHeartbeatResponse defines the response to the data node heartbeat.
@@ -219,6 +245,7 @@ type DataNodeHeartbeatResponse struct {
 	Status              uint8
 	Result              string
 	BadDisks            []string
+	DiskReports         []*DiskReport
 }
 
 // MetaPartitionReport defines the meta partition report.
@@ -230,6 +257,12 @@ type MetaPartitionReport struct {
 	MaxInodeID  uint64
 	IsLeader    bool
 	VolName     string
+	QuotaUsages []*QuotaUsage
+	LargeDirs   []uint64 // the directories with more entries than the threshold to be split
+	ApplyID     uint64
+	InodeCount  uint64
+	DentryCount uint64
+	MemSize     uint64 // the estimated memory used by the inodes and dentries
 }
 
 // MetaNodeHeartbeatResponse defines the response to the meta node heartbeat request.
@@ -331,6 +364,10 @@ type DataPartitionResponse struct {
 	Hosts       []string
 	LeaderAddr  string
 	Epoch       uint64
+	EcDataNum   uint8 // the partition is erasure-coded if it is not zero
+	EcParityNum uint8
+	MediaType   string
+	Cold        bool // the partition only keeps the extents migrated to the cold tier
 }
 
 // DataPartitionsView defines the view of a data partition
@@ -359,8 +396,10 @@ type VolView struct {
 	Name           string
 	Status         uint8
 	FollowerRead   bool
+	TrashRetention uint32
 	MetaPartitions []*MetaPartitionView
 	DataPartitions []*DataPartitionResponse
+	DirShards      []*DirShardInfo
 }
 
 func NewVolView(name string, status uint8, followerRead bool) (view *VolView) {
@@ -397,4 +436,12 @@ type SimpleVolView struct {
 	DpCnt              int
 	FollowerRead       bool
 	NeedToLowerReplica bool
+	CopyOnWrite        bool   // the volume has snapshots, so the extents must not be overwritten in place
+	TrashRetention     uint32 // hours to keep the deleted files in the trash, zero if the trash is disabled
+	EcDataNum          uint8
+	EcParityNum        uint8
+	EcMigrateDays      uint32 // the extents not modified for the days are converted to erasure code, zero if disabled
+	MediaType          string // media class of the disks of the data partitions written by the clients, any if empty
+	ColdMediaType      string // media class of the disks of the cold data partitions
+	ColdAfterDays      uint32 // the files not accessed for the days are migrated to the cold tier, zero if disabled
 }
@@ -72,10 +72,10 @@ const (
 	// MasterServiceID defines ticket for master access
 	MasterServiceID = "MasterService"
 
-	// MetaServiceID defines ticket for metanode access (not supported)
+	// MetaServiceID defines ticket for metanode access
 	MetaServiceID = "MetanodeService"
 
-	// DataServiceID defines ticket for datanode access (not supported)
+	// DataServiceID defines ticket for datanode access
 	DataServiceID = "DatanodeService"
 )
 
@@ -160,6 +160,18 @@ const (
 
 	// MsgMasterAPIAccessResp response type for master api access
 	MsgMasterAPIAccessResp MsgType = 0x60001
+
+	// MsgMetaAPIAccessReq request type for metanode access
+	MsgMetaAPIAccessReq MsgType = 0x70000
+
+	// MsgMetaAPIAccessResp response type for metanode access
+	MsgMetaAPIAccessResp MsgType = 0x70001
+
+	// MsgDataAPIAccessReq request type for datanode access
+	MsgDataAPIAccessReq MsgType = 0x80000
+
+	// MsgDataAPIAccessResp response type for datanode access
+	MsgDataAPIAccessResp MsgType = 0x80001
 )
 
 // HTTPAuthReply uniform response structure
@@ -181,6 +193,170 @@ var MsgType2ResourceMap = map[MsgType]string{
 	MsgAuthRemoveRaftNodeReq: "auth:removenode",
 }
 
+// MasterAPI2ResourceMap define the mapping from master api to resource
+var MasterAPI2ResourceMap = map[string]string{
+	AdminGetCluster:                "master:getcluster",
+	AdminGetDataPartition:          "master:getdp",
+	AdminLoadDataPartition:         "master:loaddp",
+	AdminCreateDataPartition:       "master:createdp",
+	AdminDecommissionDataPartition: "master:decommissiondp",
+	AdminDeleteDataReplica:         "master:deletedr",
+	AdminAddDataReplica:            "master:adddr",
+	AdminDeleteVol:                 "master:deletevol",
+	AdminUpdateVol:                 "master:updatevol",
+	AdminCreateVol:                 "master:createvol",
+	AdminGetVol:                    "master:getvol",
+	AdminClusterFreeze:             "master:freeze",
+	AdminCreateMP:                  "master:createmp",
+	AdminSetMetaNodeThreshold:      "master:setthreshold",
+	AdminSetQuota:                  "master:setquota",
+	AdminDeleteQuota:               "master:deletequota",
+	AdminGetQuota:                  "master:getquota",
+	AdminListQuota:                 "master:listquota",
+	AdminCreateSnapshot:            "master:createsnapshot",
+	AdminDeleteSnapshot:            "master:deletesnapshot",
+	AdminListSnapshot:              "master:listsnapshot",
+	AdminSetVolTrash:               "master:setvoltrash",
+	AdminSetVolEc:                  "master:setvolec",
+	AdminSetVolTier:                "master:setvoltier",
+	AdminSplitDir:                  "master:splitdir",
+	AdminStartBalancer:             "master:startbalancer",
+	AdminStopBalancer:              "master:stopbalancer",
+	AdminGetBalancer:               "master:getbalancer",
+	AdminStartMetaBalancer:         "master:startmetabalancer",
+	AdminStopMetaBalancer:          "master:stopmetabalancer",
+	AdminGetMetaBalancer:           "master:getmetabalancer",
+	AdminListJobs:                  "master:listjobs",
+	AdminGetJob:                    "master:getjob",
+	AdminCancelJob:                 "master:canceljob",
+	AdminPauseJob:                  "master:pausejob",
+	AdminResumeJob:                 "master:resumejob",
+	ClientDataPartitions:           "master:getdps",
+	ClientVol:                      "master:getclientvol",
+	ClientMetaPartition:            "master:getmp",
+	ClientVolStat:                  "master:getvolstat",
+	ClientMetaPartitions:           "master:getmps",
+	AddRaftNode:                    "master:addraftnode",
+	RemoveRaftNode:                 "master:removeraftnode",
+	AddDataNode:                    "master:adddatanode",
+	DecommissionDataNode:           "master:decommissiondn",
+	DecommissionDisk:               "master:decommissiondisk",
+	GetDataNode:                    "master:getdatanode",
+	AddMetaNode:                    "master:addmetanode",
+	DecommissionMetaNode:           "master:decommissionmn",
+	GetMetaNode:                    "master:getmetanode",
+	AdminLoadMetaPartition:         "master:loadmp",
+	AdminDecommissionMetaPartition: "master:decommissionmp",
+	AdminAddMetaReplica:            "master:addmr",
+	AdminDeleteMetaReplica:         "master:deletemr",
+	GetMetaNodeTaskResponse:        "master:mntaskresponse",
+	GetDataNodeTaskResponse:        "master:dntaskresponse",
+	GetTopologyView:                "master:gettopology",
+}
+
+const (
+	// MetaInternalResource is the resource of the operations sent to metanodes by the master,
+	// the other metanodes and the datanodes, whose tickets are issued to the services.
+	MetaInternalResource = "meta:internal"
+	// DataInternalResource is the resource of the operations sent to datanodes by the master,
+	// the metanodes and the other datanodes, whose tickets are issued to the services.
+	DataInternalResource = "data:internal"
+)
+
+// MetaOp2ResourceMap define the mapping from operation on metanode to resource,
+// operations which are not listed are rejected
+var MetaOp2ResourceMap = map[uint8]string{
+	OpMetaCreateInode:   "meta:createinode",
+	OpMetaUnlinkInode:   "meta:unlinkinode",
+	OpMetaCreateDentry:  "meta:createdentry",
+	OpMetaDeleteDentry:  "meta:deletedentry",
+	OpMetaOpen:          "meta:open",
+	OpMetaLookup:        "meta:lookup",
+	OpMetaReadDir:       "meta:readdir",
+	OpMetaInodeGet:      "meta:inodeget",
+	OpMetaBatchInodeGet: "meta:batchinodeget",
+	OpMetaExtentsAdd:    "meta:extentsadd",
+	OpMetaExtentsDel:    "meta:extentsdel",
+	OpMetaExtentsList:   "meta:extentslist",
+	OpMetaUpdateDentry:  "meta:updatedentry",
+	OpMetaTruncate:      "meta:truncate",
+	OpMetaLinkInode:     "meta:linkinode",
+	OpMetaEvictInode:    "meta:evictinode",
+	OpMetaSetattr:       "meta:setattr",
+	OpMetaReleaseOpen:   "meta:releaseopen",
+	OpMetaSetXAttr:      "meta:setxattr",
+	OpMetaGetXAttr:      "meta:getxattr",
+	OpMetaListXAttr:     "meta:listxattr",
+	OpMetaRemoveXAttr:   "meta:removexattr",
+	OpMetaTxRename:      "meta:rename",
+	OpMetaSetInodeQuota: "meta:setinodequota",
+	OpMetaSetLock:       "meta:setlock",
+	OpMetaGetLock:       "meta:getlock",
+	OpMetaRenewLock:     "meta:renewlock",
+	OpMetaReadChanges:   "meta:readchanges",
+	OpMetaRestoreTrash:  "meta:restoretrash",
+
+	OpMetaExtentsOverwrite: "meta:extentsoverwrite",
+	OpMetaMarkDirRemoving:  "meta:markdirremoving",
+
+	OpMetaFreeInodesOnRaftFollower:  MetaInternalResource,
+	OpMetaTxPrepare:                 MetaInternalResource,
+	OpMetaTxCommit:                  MetaInternalResource,
+	OpMetaTxRollback:                MetaInternalResource,
+	OpMetaTxGetState:                MetaInternalResource,
+	OpCreateMetaPartition:           MetaInternalResource,
+	OpMetaNodeHeartbeat:             MetaInternalResource,
+	OpDeleteMetaPartition:           MetaInternalResource,
+	OpUpdateMetaPartition:           MetaInternalResource,
+	OpLoadMetaPartition:             MetaInternalResource,
+	OpDecommissionMetaPartition:     MetaInternalResource,
+	OpAddMetaPartitionRaftMember:    MetaInternalResource,
+	OpRemoveMetaPartitionRaftMember: MetaInternalResource,
+	OpMetaPartitionTryToLeader:      MetaInternalResource,
+	OpCreateMetaSnapshot:            MetaInternalResource,
+	OpDeleteMetaSnapshot:            MetaInternalResource,
+	OpMetaSplitDir:                  MetaInternalResource,
+	OpMetaApplyQuota:                MetaInternalResource,
+	OpMetaGetExtentRefs:             MetaInternalResource,
+	OpMetaRelocateExtents:           MetaInternalResource,
+	OpMetaTierMigrate:               MetaInternalResource,
+}
+
+// DataOp2ResourceMap define the mapping from operation on datanode to resource,
+// operations which are not listed are rejected
+var DataOp2ResourceMap = map[uint8]string{
+	OpCreateExtent:       "data:createextent",
+	OpWrite:              "data:write",
+	OpSyncWrite:          "data:syncwrite",
+	OpRandomWrite:        "data:randomwrite",
+	OpSyncRandomWrite:    "data:syncrandomwrite",
+	OpRead:               "data:read",
+	OpStreamRead:         "data:streamread",
+	OpStreamFollowerRead: "data:followerread",
+
+	OpMarkDelete:                     DataInternalResource,
+	OpGetAllWatermarks:               DataInternalResource,
+	OpNotifyReplicasToRepair:         DataInternalResource,
+	OpExtentRepairRead:               DataInternalResource,
+	OpBroadcastMinAppliedID:          DataInternalResource,
+	OpGetAppliedId:                   DataInternalResource,
+	OpGetPartitionSize:               DataInternalResource,
+	OpReadTinyDeleteRecord:           DataInternalResource,
+	OpTinyExtentRepairRead:           DataInternalResource,
+	OpGetMaxExtentIDAndPartitionSize: DataInternalResource,
+	OpEcConvertExtent:                DataInternalResource,
+	OpTierMigrateExtent:              DataInternalResource,
+	OpCreateDataPartition:            DataInternalResource,
+	OpDeleteDataPartition:            DataInternalResource,
+	OpLoadDataPartition:              DataInternalResource,
+	OpDataNodeHeartbeat:              DataInternalResource,
+	OpDecommissionDataPartition:      DataInternalResource,
+	OpAddDataPartitionRaftMember:     DataInternalResource,
+	OpRemoveDataPartitionRaftMember:  DataInternalResource,
+	OpDataPartitionTryToLeader:       DataInternalResource,
+	OpEcReconstructDataPartition:     DataInternalResource,
+}
+
 // AuthGetTicketReq defines the message from client to authnode
 // use Timestamp as verifier for MITM mitigation
 // verifier is also used to verify the server identity
@@ -271,6 +447,10 @@ func IsValidMsgReqType(serviceID string, msgType MsgType) (err error) {
 		if msgType|MsgAuthBase != 0 {
 			b = true
 		}
+	case "MetanodeService":
+		b = msgType == MsgMetaAPIAccessReq
+	case "DatanodeService":
+		b = msgType == MsgDataAPIAccessReq
 	}
 	if !b {
 		err = fmt.Errorf("invalid request type [%x] and serviceID[%s]", msgType, serviceID)
@@ -470,6 +650,72 @@ func CheckAPIAccessCaps(ticket *cryptoutil.Ticket, rscType string, mp MsgType, a
 	return
 }
 
+// CheckTicketCaps checks whether the ticket is granted to access the resource
+func CheckTicketCaps(ticket *cryptoutil.Ticket, rsc string) (err error) {
+	rule := rsc + capSeparator + APIAccess
+
+	if err = checkTicketCaps(ticket, APIRsc, rule); err != nil {
+		err = fmt.Errorf("checkTicketCaps failed: %s", err.Error())
+		return
+	}
+	return
+}
+
+// EncodeAPIAccessToken encodes the api access request into a token which is
+// attached to the requests sent to the service
+func EncodeAPIAccessToken(req *APIAccessReq) (token string, err error) {
+	var (
+		data []byte
+	)
+
+	if data, err = json.Marshal(req); err != nil {
+		return
+	}
+
+	token = cryptoutil.Base64Encode(data)
+	return
+}
+
+// ExtractAPIAccessToken decodes the token and verifies the ticket carried by it
+// with the key of the service
+func ExtractAPIAccessToken(token string, serviceID string, key []byte) (ticket cryptoutil.Ticket, err error) {
+	var (
+		data []byte
+		req  APIAccessReq
+	)
+
+	if data, err = cryptoutil.Base64Decode(token); err != nil {
+		err = fmt.Errorf("decode token failed: %s", err.Error())
+		return
+	}
+
+	if err = json.Unmarshal(data, &req); err != nil {
+		err = fmt.Errorf("unmarshal token failed: %s", err.Error())
+		return
+	}
+
+	if req.ServiceID != serviceID {
+		err = fmt.Errorf("service id mismatch [%s]", req.ServiceID)
+		return
+	}
+
+	if err = VerifyAPIAccessReqIDs(&req); err != nil {
+		err = fmt.Errorf("VerifyAPIAccessReqIDs failed: %s", err.Error())
+		return
+	}
+
+	if ticket, _, err = ExtractAPIAccessTicket(&req, key); err != nil {
+		err = fmt.Errorf("ExtractAPIAccessTicket failed: %s", err.Error())
+		return
+	}
+
+	if ticket.ServiceID != serviceID {
+		err = fmt.Errorf("ticket service id mismatch [%s]", ticket.ServiceID)
+		return
+	}
+	return
+}
+
 // VerifyAPIRespComm client verifies commond attributes returned from server
 func VerifyAPIRespComm(apiResp *APIAccessResp, msg MsgType, clientID string, serviceID string, ts int64) (err error) {
 	if ts+1 != apiResp.Verifier {
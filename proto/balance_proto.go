@@ -0,0 +1,95 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+)
+
+// The state of a partition migration scheduled by the balancer
+const (
+	BalanceAddingReplica uint8 = iota
+	BalanceCatchingUp
+	BalanceRemovingReplica
+	BalanceFinished
+	BalanceFailed
+)
+
+// DiskReport defines the usage of a disk reported in the heartbeat of a data node.
+type DiskReport struct {
+	Path      string
+	Total     uint64
+	Used      uint64
+	Status    int
+	MediaType string
+}
+
+// BalanceTask defines the migration of a replica of a data or meta partition from a node to another one,
+// in which the new replica is added and caught up before the old one is removed.
+type BalanceTask struct {
+	PartitionID uint64 `json:"pid"`
+	VolName     string `json:"vol"`
+	Src         string `json:"src"`
+	SrcDisk     string `json:"srcDisk,omitempty"`
+	Dst         string `json:"dst"`
+	State       uint8  `json:"state"`
+	StartTime   int64  `json:"start"`
+	UpdateTime  int64  `json:"update"`
+	Msg         string `json:"msg,omitempty"`
+}
+
+// String returns the string format of the task.
+func (t *BalanceTask) String() string {
+	return fmt.Sprintf("BalanceTask{PartitionID(%v) Src(%v:%v) Dst(%v) State(%v)}", t.PartitionID, t.Src, t.SrcDisk, t.Dst, t.State)
+}
+
+// BalanceNodeView defines the usage of a data node and its disks seen by the balancer.
+type BalanceNodeView struct {
+	Addr       string        `json:"addr"`
+	UsageRatio float64       `json:"usage"`
+	Disks      []*DiskReport `json:"disks"`
+}
+
+// MetaPartitionMemView defines the memory footprint of a meta partition reported by its leader.
+type MetaPartitionMemView struct {
+	PartitionID uint64 `json:"pid"`
+	VolName     string `json:"vol"`
+	InodeCount  uint64 `json:"inodes"`
+	DentryCount uint64 `json:"dentries"`
+	MemSize     uint64 `json:"mem"`
+}
+
+// MetaNodeMemView defines the memory usage of a meta node and the footprint of its meta partitions.
+type MetaNodeMemView struct {
+	Addr       string                  `json:"addr"`
+	Total      uint64                  `json:"total"`
+	Used       uint64                  `json:"used"`
+	UsageRatio float64                 `json:"usage"`
+	Partitions []*MetaPartitionMemView `json:"partitions"`
+}
+
+// BalancerView defines the status of the balancer of the data nodes or the meta nodes.
+type BalancerView struct {
+	Enabled     bool               `json:"enabled"`
+	Threshold   float64            `json:"threshold"`   // the skew of usage ratio tolerated
+	Concurrency int                `json:"concurrency"` // the maximum number of migrations at a time
+	AvgUsage    float64            `json:"avgUsage"`
+	Skew        float64            `json:"skew"` // the difference between the most and the least used disks or meta nodes
+	Nodes       []*BalanceNodeView `json:"nodes,omitempty"`
+	MetaNodes   []*MetaNodeMemView `json:"metaNodes,omitempty"`
+	Tasks       []*BalanceTask     `json:"tasks"` // the running and recently finished migrations
+	Finished    uint64             `json:"finished"`
+	Failed      uint64             `json:"failed"`
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import "fmt"
+
+// The types of the changes of the metadata applied by a meta partition.
+const (
+	MetaChangeCreateInode uint8 = iota + 1
+	MetaChangeUnlinkInode
+	MetaChangeLinkInode
+	MetaChangeEvictInode
+	MetaChangeSetAttr // the attributes or the extended attributes of the inode are changed
+	MetaChangeAppend
+	MetaChangeTruncate
+	MetaChangeCreateDentry
+	MetaChangeDeleteDentry
+	MetaChangeUpdateDentry
+	MetaChangeRename // decided by the coordinator of the transaction, whose dentries are changed by the participants
+	MetaChangeOverwrite
+)
+
+// MetaChange defines a change of the metadata applied by a meta partition. The changes applied by the same
+// raft log entry have the same apply ID, which is the offset of the changes in the change log of the partition.
+type MetaChange struct {
+	ApplyID  uint64 `json:"aid"`
+	Time     int64  `json:"t"`
+	Type     uint8  `json:"type"`
+	Inode    uint64 `json:"ino"`
+	ParentID uint64 `json:"pino,omitempty"`
+	Name     string `json:"name,omitempty"`
+	// the new parent and name of a rename
+	NewParentID uint64 `json:"npino,omitempty"`
+	NewName     string `json:"nname,omitempty"`
+	TxID        string `json:"tx,omitempty"` // the transaction of the change
+}
+
+// String returns the string format of the change.
+func (c *MetaChange) String() string {
+	return fmt.Sprintf("MetaChange{ApplyID(%v) Type(%v) Inode(%v) ParentID(%v) Name(%v) NewParentID(%v) NewName(%v) TxID(%v)}",
+		c.ApplyID, c.Type, c.Inode, c.ParentID, c.Name, c.NewParentID, c.NewName, c.TxID)
+}
+
+// Event returns the event of the change, or nil if the change is not notified, i.e. the changes of the inodes
+// without the attributes or the data changed, and the changes of the dentries committed by a rename.
+func (c *MetaChange) Event() *MetaEvent {
+	e := &MetaEvent{Offset: c.ApplyID, Time: c.Time, Inode: c.Inode, ParentID: c.ParentID, Name: c.Name}
+	switch c.Type {
+	case MetaChangeCreateDentry, MetaChangeUpdateDentry:
+		e.Type = MetaEventCreate
+	case MetaChangeDeleteDentry:
+		e.Type = MetaEventDelete
+	case MetaChangeRename:
+		e.Type, e.NewParentID, e.NewName = MetaEventRename, c.NewParentID, c.NewName
+	case MetaChangeSetAttr, MetaChangeTruncate:
+		e.Type = MetaEventSetAttr
+	case MetaChangeAppend:
+		e.Type = MetaEventAppend
+	case MetaChangeOverwrite:
+		e.Type = MetaEventOverwrite
+	default:
+		return nil
+	}
+	if c.TxID != "" && c.Type != MetaChangeRename {
+		return nil
+	}
+	return e
+}
+
+// The types of the events of the metadata changes notified to the subscribers.
+const (
+	MetaEventCreate    = "create"
+	MetaEventDelete    = "delete"
+	MetaEventRename    = "rename"
+	MetaEventSetAttr   = "setattr" // the attributes, the extended attributes or the size of the inode are changed
+	MetaEventAppend    = "append"
+	MetaEventOverwrite = "overwrite" // the extents of the inode are overwritten in place
+)
+
+// MetaEvent defines an event of the metadata changes of a meta partition. The parent and the name are set for the
+// events of the dentries only, and the new ones for the renames.
+type MetaEvent struct {
+	Offset      uint64 `json:"offset"` // the apply ID of the change, from which the subscription is resumed
+	Time        int64  `json:"time"`
+	Type        string `json:"type"`
+	Inode       uint64 `json:"ino"`
+	ParentID    uint64 `json:"pino,omitempty"`
+	Name        string `json:"name,omitempty"`
+	NewParentID uint64 `json:"npino,omitempty"`
+	NewName     string `json:"nname,omitempty"`
+}
+
+// ReadMetaChangesRequest defines the request to read the changes applied after the given apply ID.
+type ReadMetaChangesRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	From        uint64 `json:"from"`
+	Limit       int    `json:"limit"`
+}
+
+// ReadMetaChangesResponse defines the response to the request of reading the changes. The changes of
+// the same apply ID are never split. If the changes after the given apply ID are no longer kept, Truncated
+// is set, and the reader has to resynchronize the whole partition.
+type ReadMetaChangesResponse struct {
+	Changes   []*MetaChange `json:"changes"`
+	ApplyID   uint64        `json:"aid"` // the apply ID of the partition
+	Truncated bool          `json:"truncated"`
+}
+
+// MetaEvents defines the events read from a meta partition, and the offset to read the next ones after, which
+// is advanced by the changes not notified as well.
+type MetaEvents struct {
+	Events    []*MetaEvent `json:"events"`
+	Offset    uint64       `json:"offset"`
+	ApplyID   uint64       `json:"aid"` // the apply ID of the partition
+	Truncated bool         `json:"truncated"`
+}
+
+// Events returns the events of the changes read after the given offset.
+func (resp *ReadMetaChangesResponse) Events(from uint64) *MetaEvents {
+	events := &MetaEvents{Offset: from, ApplyID: resp.ApplyID, Truncated: resp.Truncated}
+	for _, c := range resp.Changes {
+		if e := c.Event(); e != nil {
+			events.Events = append(events.Events, e)
+		}
+		events.Offset = c.ApplyID
+	}
+	return events
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// ExtentRef defines an extent key of an inode referencing an extent of a data partition.
+type ExtentRef struct {
+	Inode      uint64    `json:"ino"`
+	Generation uint64    `json:"gen"`
+	ModifyTime int64     `json:"mtime"`
+	Key        ExtentKey `json:"key"`
+	Snapshot   bool      `json:"snap,omitempty"` // referenced by a snapshot only
+}
+
+// GetExtentRefsRequest defines the request of the first host of a data partition to a meta partition,
+// to list the extent keys referencing the tiny extents of the data partition.
+type GetExtentRefsRequest struct {
+	VolName         string `json:"vol"`
+	PartitionID     uint64 `json:"pid"`
+	DataPartitionID uint64 `json:"dp"`
+	ExtentID        uint64 `json:"eid"` // all the tiny extents if zero
+}
+
+// GetExtentRefsResponse defines the response to the request of listing the extent keys.
+type GetExtentRefsResponse struct {
+	Refs []*ExtentRef `json:"refs"`
+}
+
+// ExtentRelocation defines the replacement of an extent key of an inode, which is applied only if the
+// inode still has the old key at its file offset, and has not been changed since the keys were listed.
+type ExtentRelocation struct {
+	Inode      uint64    `json:"ino"`
+	Generation uint64    `json:"gen"` // the generation of the inode when the keys were listed
+	Old        ExtentKey `json:"old"`
+	New        ExtentKey `json:"new"`
+}
+
+// RelocateExtentsRequest defines the request of the first host of a data partition to a meta partition,
+// to replace the keys of the tiny extents with the ones of the extents the data is rewritten into.
+type RelocateExtentsRequest struct {
+	VolName     string              `json:"vol"`
+	PartitionID uint64              `json:"pid"`
+	Relocations []*ExtentRelocation `json:"relocations"`
+}
+
+// RelocateExtentsResponse defines the response to the request of relocating the extent keys.
+type RelocateExtentsResponse struct {
+	Replaced []bool `json:"replaced"`
+}
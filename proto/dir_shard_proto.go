@@ -0,0 +1,77 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// A directory with a huge number of entries is split across several meta partitions by the hash of
+// the entry names. The entries created before the split stay in the partition of the directory inode,
+// which is the first of the shards, so an entry not found in its shard is looked up there. The partition
+// of the directory inode rejects the requests of the clients not aware of the split with OpDirShardErr,
+// along with the shards of the directory, so that the clients do not depend on the master to learn them.
+
+// DirShardXAttr is the reserved extended attribute of a sharded directory inode, which keeps the
+// partitions of the shards.
+const DirShardXAttr = "cfs.dirshards"
+
+// DirRemovingXAttr is the reserved extended attribute of a sharded directory being removed, which keeps
+// the time it is marked. The entries are not created in the directory until the mark is cleared.
+const DirRemovingXAttr = "cfs.dirremoving"
+
+// DirShardInfo defines the shards of a directory.
+type DirShardInfo struct {
+	Inode        uint64   `json:"ino"`
+	PartitionIDs []uint64 `json:"pids"` // the first one is the partition of the directory inode
+}
+
+// String returns the string format of the shards.
+func (d *DirShardInfo) String() string {
+	return fmt.Sprintf("DirShard{Inode(%v) PartitionIDs(%v)}", d.Inode, d.PartitionIDs)
+}
+
+// DirShardIndex returns the index of the shard which the entry name belongs to.
+func DirShardIndex(name string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// SplitDirRequest defines the request from the master to split a directory in the partition of its inode.
+type SplitDirRequest struct {
+	PartitionID  uint64   `json:"pid"`
+	Inode        uint64   `json:"ino"`
+	PartitionIDs []uint64 `json:"pids"`
+}
+
+// MarkDirRemovingRequest defines the request to mark a sharded directory as being removed in the
+// partition of its inode, or to clear the mark.
+type MarkDirRemovingRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	Removing    bool   `json:"removing"`
+}
+
+// DirShardPartition returns the partition of the shard which the entry of the directory belongs to.
+// The trash under the root always stays in the partition of the root.
+func DirShardPartition(partitionIDs []uint64, parentID uint64, name string) uint64 {
+	if parentID == RootIno && name == TrashDirName {
+		return partitionIDs[0]
+	}
+	return partitionIDs[DirShardIndex(name, len(partitionIDs))]
+}
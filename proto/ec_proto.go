@@ -0,0 +1,45 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// EcConvertExtentRequest defines the request of the metanode to the first host of an erasure-coded
+// data partition, to copy a sealed extent of a replicated data partition into a new extent of it.
+type EcConvertExtentRequest struct {
+	PartitionID    uint64
+	Hosts          []string // hosts of the erasure-coded data partition, in the order of the shards
+	SrcPartitionID uint64
+	SrcHosts       []string
+	SrcExtentID    uint64
+	Size           uint64
+}
+
+// EcConvertExtentResponse defines the response to the request of converting an extent.
+type EcConvertExtentResponse struct {
+	ExtentID uint64
+}
+
+// EcReconstructRequest defines the request of the master to the new host of an erasure-coded data
+// partition, to reconstruct its shards from the other hosts.
+type EcReconstructRequest struct {
+	PartitionID uint64
+	Hosts       []string
+}
+
+// EcReconstructResponse defines the response to the request of reconstructing a data partition.
+type EcReconstructResponse struct {
+	PartitionID uint64
+	Status      uint8
+	Result      string
+}
@@ -61,6 +61,10 @@ var (
 	ErrAuthAPIAccessGenRespError       = errors.New("auth API access response error")
 	ErrKeyNotExists                    = errors.New("key not exists")
 	ErrDuplicateKey                    = errors.New("duplicate key")
+	ErrInvalidTicket                   = errors.New("invalid ticket")
+	ErrQuotaNotExists                  = errors.New("quota not exists")
+	ErrSnapshotNotExists               = errors.New("snapshot not exists")
+	ErrJobNotExists                    = errors.New("job not exists")
 )
 
 // http response error code and error message definitions
@@ -102,6 +106,10 @@ const (
 	ErrCodeAuthAPIAccessGenRespError
 	ErrCodeAuthRaftNodeGenRespError
 	ErrCodeAuthReqRedirectError
+	ErrCodeInvalidTicket
+	ErrCodeQuotaNotExists
+	ErrCodeSnapshotNotExists
+	ErrCodeJobNotExists
 )
 
 // Err2CodeMap error map to code
@@ -141,4 +149,8 @@ var Err2CodeMap = map[error]int32{
 	ErrVolAuthKeyNotMatch:              ErrCodeVolAuthKeyNotMatch,
 	ErrAuthKeyStoreError:               ErrCodeAuthKeyStoreError,
 	ErrAuthAPIAccessGenRespError:       ErrCodeAuthAPIAccessGenRespError,
+	ErrInvalidTicket:                   ErrCodeInvalidTicket,
+	ErrQuotaNotExists:                  ErrCodeQuotaNotExists,
+	ErrSnapshotNotExists:               ErrCodeSnapshotNotExists,
+	ErrJobNotExists:                    ErrCodeJobNotExists,
 }
@@ -54,6 +54,34 @@ func (k *ExtentKey) Copy() btree.Item {
 	return k
 }
 
+// Trim returns the parts of the extent key outside of the file range [start, end). The key itself
+// is returned if it does not overlap with the range, and nothing is returned if it is covered.
+func (k *ExtentKey) Trim(start, end uint64) (parts []*ExtentKey) {
+	kEnd := k.FileOffset + uint64(k.Size)
+	if kEnd <= start || k.FileOffset >= end {
+		return []*ExtentKey{k}
+	}
+	if k.FileOffset < start {
+		parts = append(parts, &ExtentKey{
+			FileOffset:   k.FileOffset,
+			PartitionId:  k.PartitionId,
+			ExtentId:     k.ExtentId,
+			ExtentOffset: k.ExtentOffset,
+			Size:         uint32(start - k.FileOffset),
+		})
+	}
+	if kEnd > end {
+		parts = append(parts, &ExtentKey{
+			FileOffset:   end,
+			PartitionId:  k.PartitionId,
+			ExtentId:     k.ExtentId,
+			ExtentOffset: k.ExtentOffset + (end - k.FileOffset),
+			Size:         uint32(kEnd - end),
+		})
+	}
+	return
+}
+
 func (k *ExtentKey) Marshal() (m string) {
 	return fmt.Sprintf("%v_%v_%v_%v_%v_%v", k.FileOffset, k.PartitionId, k.ExtentId, k.ExtentOffset, k.Size, k.CRC)
 }
@@ -0,0 +1,36 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtentKeyTrim(t *testing.T) {
+	// the key covers [100, 200) of the file, at offset 1000 of its extent
+	key := &ExtentKey{FileOffset: 100, PartitionId: 1, ExtentId: 1024, ExtentOffset: 1000, Size: 100, CRC: 1}
+	part := func(fileOffset, extentOffset uint64, size uint32) *ExtentKey {
+		return &ExtentKey{FileOffset: fileOffset, PartitionId: 1, ExtentId: 1024, ExtentOffset: extentOffset, Size: size}
+	}
+	tests := []struct {
+		name       string
+		start, end uint64
+		parts      []*ExtentKey
+	}{
+		{name: "before", start: 0, end: 50, parts: []*ExtentKey{key}},
+		{name: "adjacent before", start: 0, end: 100, parts: []*ExtentKey{key}},
+		{name: "adjacent after", start: 200, end: 300, parts: []*ExtentKey{key}},
+		{name: "after", start: 250, end: 300, parts: []*ExtentKey{key}},
+		{name: "same range", start: 100, end: 200, parts: nil},
+		{name: "covered", start: 50, end: 250, parts: nil},
+		{name: "head", start: 50, end: 150, parts: []*ExtentKey{part(150, 1050, 50)}},
+		{name: "head from start", start: 100, end: 101, parts: []*ExtentKey{part(101, 1001, 99)}},
+		{name: "tail", start: 150, end: 250, parts: []*ExtentKey{part(100, 1000, 50)}},
+		{name: "tail to end", start: 199, end: 200, parts: []*ExtentKey{part(100, 1000, 99)}},
+		{name: "middle", start: 120, end: 180, parts: []*ExtentKey{part(100, 1000, 20), part(180, 1080, 20)}},
+	}
+	for _, tt := range tests {
+		if parts := key.Trim(tt.start, tt.end); !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("%v: trim [%v, %v): expect %v, got %v", tt.name, tt.start, tt.end, tt.parts, parts)
+		}
+	}
+}
@@ -62,6 +62,9 @@ type InodeInfo struct {
 	CreateTime time.Time `json:"ct"`
 	AccessTime time.Time `json:"at"`
 	Target     []byte    `json:"tgt"`
+	QuotaIDs   []uint32  `json:"quota,omitempty"`
+	ACL        []byte    `json:"acl,omitempty"`  // access ACL
+	DefaultACL []byte    `json:"dacl,omitempty"` // default ACL of the directory
 }
 
 // String returns the string format of the inode.
@@ -83,12 +86,15 @@ func (d Dentry) String() string {
 
 // CreateInodeRequest defines the request to create an inode.
 type CreateInodeRequest struct {
-	VolName     string `json:"vol"`
-	PartitionID uint64 `json:"pid"`
-	Mode        uint32 `json:"mode"`
-	Uid         uint32 `json:"uid"`
-	Gid         uint32 `json:"gid"`
-	Target      []byte `json:"tgt"`
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Mode        uint32   `json:"mode"`
+	Uid         uint32   `json:"uid"`
+	Gid         uint32   `json:"gid"`
+	Target      []byte   `json:"tgt"`
+	QuotaIDs    []uint32 `json:"quota,omitempty"` // quotas inherited from the parent directory
+	ACL         []byte   `json:"acl,omitempty"`   // access ACL inherited from the parent directory
+	DefaultACL  []byte   `json:"dacl,omitempty"`  // default ACL inherited from the parent directory
 }
 
 // CreateInodeResponse defines the response to the request of creating an inode.
@@ -135,6 +141,7 @@ type CreateDentryRequest struct {
 	Inode       uint64 `json:"ino"`
 	Name        string `json:"name"`
 	Mode        uint32 `json:"mode"`
+	Shard       bool   `json:"shard,omitempty"` // created in a shard of the parent, which is not in the partition
 }
 
 // UpdateDentryRequest defines the request to update a dentry.
@@ -157,6 +164,7 @@ type DeleteDentryRequest struct {
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
 	Name        string `json:"name"`
+	Shards      bool   `json:"shards,omitempty"` // the client knows the shards of the parent
 }
 
 // DeleteDentryResponse defines the response to the request of deleting a dentry.
@@ -170,6 +178,8 @@ type LookupRequest struct {
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
 	Name        string `json:"name"`
+	SnapshotID  uint64 `json:"snap,omitempty"`   // read from the snapshot if not zero
+	Shards      bool   `json:"shards,omitempty"` // the client knows the shards of the parent
 }
 
 // LookupResponse defines the response for the loopup request.
@@ -183,6 +193,7 @@ type InodeGetRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	SnapshotID  uint64 `json:"snap,omitempty"` // read from the snapshot if not zero
 }
 
 // InodeGetResponse defines the response to the InodeGetRequest.
@@ -195,6 +206,7 @@ type BatchInodeGetRequest struct {
 	VolName     string   `json:"vol"`
 	PartitionID uint64   `json:"pid"`
 	Inodes      []uint64 `json:"inos"`
+	SnapshotID  uint64   `json:"snap,omitempty"` // read from the snapshot if not zero
 }
 
 // BatchInodeGetResponse defines the response to the request of getting the inode in batch.
@@ -207,11 +219,16 @@ type ReadDirRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	ParentID    uint64 `json:"pino"`
+	SnapshotID  uint64 `json:"snap,omitempty"`   // read from the snapshot if not zero
+	Marker      string `json:"marker,omitempty"` // read the children after the name if not empty
+	Limit       uint64 `json:"limit,omitempty"`  // read all the children if zero
+	Shards      bool   `json:"shards,omitempty"` // the client knows the shards of the parent
 }
 
 // ReadDirResponse defines the response to the request of reading dir.
 type ReadDirResponse struct {
-	Children []Dentry `json:"children"`
+	Children   []Dentry `json:"children"`
+	NextMarker string   `json:"next,omitempty"` // the marker to read the rest of the children, empty if none
 }
 
 // AppendExtentKeyRequest defines the request to append an extent key.
@@ -222,11 +239,19 @@ type AppendExtentKeyRequest struct {
 	Extent      ExtentKey `json:"ek"`
 }
 
+// OverwriteExtentsRequest defines the request to record the in-place overwrites of the extents of an inode.
+type OverwriteExtentsRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+}
+
 // GetExtentsRequest defines the reques to get extents.
 type GetExtentsRequest struct {
 	VolName     string `json:"vol"`
 	PartitionID uint64 `json:"pid"`
 	Inode       uint64 `json:"ino"`
+	SnapshotID  uint64 `json:"snap,omitempty"` // read from the snapshot if not zero
 }
 
 // GetExtentsResponse defines the response to the request of getting extents.
@@ -244,15 +269,40 @@ type TruncateRequest struct {
 	Size        uint64 `json:"sz"`
 }
 
+// Caller defines the user on behalf of whom a client sends a request, as asserted by the client. The metanode
+// checks the ownership of the inode against it, and rejects the requests without it unless the metanode allows
+// them for the old clients. As the metanode cannot verify the caller, a client sending root as the caller, e.g.
+// the replicator, is trusted with any change.
+type Caller struct {
+	Uid    uint32   `json:"uid"`
+	Groups []uint32 `json:"groups,omitempty"` // the primary and the supplementary groups
+}
+
+// IsRoot checks if the caller is root.
+func (c *Caller) IsRoot() bool {
+	return c.Uid == 0
+}
+
+// InGroup checks if the caller is a member of the group.
+func (c *Caller) InGroup(gid uint32) bool {
+	for _, g := range c.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
 // SetAttrRequest defines the request to set attribute.
 type SetAttrRequest struct {
-	VolName     string `json:"vol"`
-	PartitionID uint64 `json:"pid"`
-	Inode       uint64 `json:"ino"`
-	Mode        uint32 `json:"mode"`
-	Uid         uint32 `json:"uid"`
-	Gid         uint32 `json:"gid"`
-	Valid       uint32 `json:"valid"`
+	VolName     string  `json:"vol"`
+	PartitionID uint64  `json:"pid"`
+	Inode       uint64  `json:"ino"`
+	Mode        uint32  `json:"mode"`
+	Uid         uint32  `json:"uid"`
+	Gid         uint32  `json:"gid"`
+	Valid       uint32  `json:"valid"`
+	Caller      *Caller `json:"caller,omitempty"`
 }
 
 const (
@@ -260,3 +310,62 @@ const (
 	AttrUid
 	AttrGid
 )
+
+// Flags of SetXAttrRequest, same as XATTR_CREATE and XATTR_REPLACE of setxattr(2).
+const (
+	XAttrCreate uint32 = 1 << iota
+	XAttrReplace
+)
+
+// Limits of the extended attributes.
+const (
+	XAttrNameMaxLen  = 255
+	XAttrValueMaxLen = 64 * 1024
+)
+
+// SetXAttrRequest defines the request to set an extended attribute.
+type SetXAttrRequest struct {
+	VolName     string  `json:"vol"`
+	PartitionID uint64  `json:"pid"`
+	Inode       uint64  `json:"ino"`
+	Key         string  `json:"key"`
+	Value       []byte  `json:"val"`
+	Flags       uint32  `json:"flags"`
+	Caller      *Caller `json:"caller,omitempty"`
+}
+
+// GetXAttrRequest defines the request to get an extended attribute.
+type GetXAttrRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	Key         string `json:"key"`
+	SnapshotID  uint64 `json:"snap,omitempty"` // read from the snapshot if not zero
+}
+
+// GetXAttrResponse defines the response to the request of getting an extended attribute.
+type GetXAttrResponse struct {
+	Value []byte `json:"val"`
+}
+
+// ListXAttrRequest defines the request to list the extended attributes.
+type ListXAttrRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Inode       uint64 `json:"ino"`
+	SnapshotID  uint64 `json:"snap,omitempty"` // read from the snapshot if not zero
+}
+
+// ListXAttrResponse defines the response to the request of listing the extended attributes.
+type ListXAttrResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// RemoveXAttrRequest defines the request to remove an extended attribute.
+type RemoveXAttrRequest struct {
+	VolName     string  `json:"vol"`
+	PartitionID uint64  `json:"pid"`
+	Inode       uint64  `json:"ino"`
+	Key         string  `json:"key"`
+	Caller      *Caller `json:"caller,omitempty"`
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+)
+
+// The type of a job run by the master
+const (
+	JobDecommissionDataNode      = "decommissionDataNode"
+	JobDecommissionDisk          = "decommissionDisk"
+	JobDecommissionMetaNode      = "decommissionMetaNode"
+	JobDecommissionDataPartition = "decommissionDataPartition"
+	JobDecommissionMetaPartition = "decommissionMetaPartition"
+	JobAddDataReplica            = "addDataReplica"
+	JobDeleteDataReplica         = "deleteDataReplica"
+	JobAddMetaReplica            = "addMetaReplica"
+	JobDeleteMetaReplica         = "deleteMetaReplica"
+)
+
+// The status of a job, and of the step of a job on a partition
+const (
+	JobPending uint8 = iota
+	JobRunning
+	JobPaused
+	JobCancelled
+	JobSucceeded
+	JobFailed
+)
+
+// JobStep defines the work of a job on a partition.
+type JobStep struct {
+	PartitionID uint64 `json:"pid"`
+	VolName     string `json:"vol"`
+	Status      uint8  `json:"status"`
+	UpdateTime  int64  `json:"update"`
+	Msg         string `json:"msg,omitempty"`
+}
+
+// Job defines an operation of the master on the partitions, which is persisted by the raft of the masters,
+// and resumed by the new leader. The progress is recorded by the steps, one for each partition.
+type Job struct {
+	ID          uint64     `json:"id"`
+	Type        string     `json:"type"`
+	Addr        string     `json:"addr"`           // the node operated on
+	Disk        string     `json:"disk,omitempty"` // the disk decommissioned
+	PartitionID uint64     `json:"pid,omitempty"`  // the partition operated on by a partition job
+	Status      uint8      `json:"status"`
+	CreateTime  int64      `json:"create"`
+	UpdateTime  int64      `json:"update"`
+	Msg         string     `json:"msg,omitempty"`
+	Total       int        `json:"total"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	Steps       []*JobStep `json:"steps,omitempty"`
+}
+
+// String returns the string format of the job.
+func (j *Job) String() string {
+	return fmt.Sprintf("Job{ID(%v) Type(%v) Addr(%v) Disk(%v) PartitionID(%v) Status(%v)}",
+		j.ID, j.Type, j.Addr, j.Disk, j.PartitionID, j.Status)
+}
+
+// IsActive returns true if the job has not finished.
+func (j *Job) IsActive() bool {
+	return j.Status == JobPending || j.Status == JobRunning || j.Status == JobPaused
+}
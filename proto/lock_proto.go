@@ -0,0 +1,107 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"time"
+)
+
+// The types of the file locks, independent of the values of F_RDLCK, F_WRLCK and F_UNLCK of the platforms.
+const (
+	FileLockRead uint32 = iota
+	FileLockWrite
+	FileLockUnlock
+)
+
+// FileLockEOF is the end of a lock to the end of the file, however the file grows.
+const FileLockEOF = ^uint64(0)
+
+// FileLockLease is the lease of the file locks. The client renews the leases of the locks it holds,
+// and the locks of a client which fails to renew them in time, e.g. a crashed one, are released.
+const FileLockLease = 30 * time.Second
+
+// FileLock defines an advisory lock on the byte range [Start, End] of an inode. The POSIX locks
+// are owned by the processes, and the flock locks are owned by the open files, both of which are
+// identified by Owner in the client. The flock locks are always on the whole file, and do not
+// conflict with the POSIX locks.
+type FileLock struct {
+	ClientID uint64 `json:"cid"`
+	Owner    uint64 `json:"owner"`
+	Pid      uint32 `json:"pid"`
+	Type     uint32 `json:"type"`
+	Start    uint64 `json:"start"`
+	End      uint64 `json:"end"`
+	Flock    bool   `json:"flock"`
+}
+
+// String returns the string format of the lock.
+func (l *FileLock) String() string {
+	return fmt.Sprintf("FileLock{Client(%v) Owner(%v) Pid(%v) Type(%v) Range(%v-%v) Flock(%v)}",
+		l.ClientID, l.Owner, l.Pid, l.Type, l.Start, l.End, l.Flock)
+}
+
+// SameOwner returns whether the two locks are of the same owner of the same client.
+func (l *FileLock) SameOwner(o *FileLock) bool {
+	return l.ClientID == o.ClientID && l.Owner == o.Owner && l.Flock == o.Flock
+}
+
+// Conflicts returns whether the two locks cannot be held at the same time.
+func (l *FileLock) Conflicts(o *FileLock) bool {
+	if l.Flock != o.Flock || l.SameOwner(o) {
+		return false
+	}
+	if l.Type != FileLockWrite && o.Type != FileLockWrite {
+		return false
+	}
+	return l.Start <= o.End && o.Start <= l.End
+}
+
+// SetLockRequest defines the request to acquire a lock, or to release it if the type is FileLockUnlock.
+type SetLockRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Inode       uint64   `json:"ino"`
+	Lock        FileLock `json:"lock"`
+	Time        int64    `json:"time"` // unix time in nanoseconds, set by the leader to start the lease
+}
+
+// GetLockRequest defines the request to get a lock conflicting with the given one.
+type GetLockRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Inode       uint64   `json:"ino"`
+	Lock        FileLock `json:"lock"`
+}
+
+// GetLockResponse defines the response to the request of getting a lock.
+// The type of the lock is FileLockUnlock if there is no conflicting lock.
+type GetLockResponse struct {
+	Lock FileLock `json:"lock"`
+}
+
+// RenewLockRequest defines the request to renew the leases of the locks held by a client on the inodes.
+type RenewLockRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	ClientID    uint64   `json:"cid"`
+	Inodes      []uint64 `json:"inos"`
+	Time        int64    `json:"time"` // unix time in nanoseconds, set by the leader to start the lease
+}
+
+// RenewLockResponse defines the response to the request of renewing the leases.
+type RenewLockResponse struct {
+	Inodes []uint64 `json:"inos"` // the inodes on which the client holds no lock any more
+}
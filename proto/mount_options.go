@@ -9,16 +9,27 @@ const (
 	LogDir     = "logDir"
 	WarnLogDir = "warnLogDir"
 	// Optional
-	LogLevel      = "logLevel"
-	ProfPort      = "profPort"
-	IcacheTimeout = "icacheTimeout"
-	LookupValid   = "lookupValid"
-	AttrValid     = "attrValid"
-	ReadRate      = "readRate"
-	WriteRate     = "writeRate"
-	EnSyncWrite   = "enSyncWrite"
-	AutoInvalData = "autoInvalData"
-	Rdonly        = "rdonly"
-	WriteCache    = "writecache"
-	KeepCache     = "keepcache"
+	LogLevel       = "logLevel"
+	ProfPort       = "profPort"
+	IcacheTimeout  = "icacheTimeout"
+	LookupValid    = "lookupValid"
+	AttrValid      = "attrValid"
+	ReadRate       = "readRate"
+	WriteRate      = "writeRate"
+	EnSyncWrite    = "enSyncWrite"
+	AutoInvalData  = "autoInvalData"
+	Rdonly         = "rdonly"
+	WriteCache     = "writecache"
+	KeepCache      = "keepcache"
+	AuthNodes      = "authNodes"
+	ClientID       = "clientID"
+	ClientKey      = "clientKey"
+	AuthCertFile   = "authCertFile"
+	Snapshot       = "snapshot"
+	EnableFileLock = "enableFileLock"
+
+	BlockCachePolicy   = "blockCachePolicy"
+	BlockCacheSize     = "blockCacheSize"
+	BlockCacheDiskSize = "blockCacheDiskSize"
+	BlockCacheDir      = "blockCacheDir"
 )
@@ -66,6 +66,15 @@ const (
 	OpTinyExtentRepairRead           uint8 = 0x15
 	OpGetMaxExtentIDAndPartitionSize uint8 = 0x16
 
+	// Operations: MetaNode -> DataNode, erasure coding
+	OpEcConvertExtent uint8 = 0x17
+
+	// Operations: MetaNode -> DataNode, storage tiering
+	OpTierMigrateExtent uint8 = 0x18
+
+	// Operations: Client -> MetaNode and Client -> DataNode, connection authentication
+	OpAuthenticate uint8 = 0x1F
+
 	// Operations: Client -> MetaNode.
 	OpMetaCreateInode   uint8 = 0x20
 	OpMetaUnlinkInode   uint8 = 0x21
@@ -89,6 +98,27 @@ const (
 	//Operations: MetaNode Leader -> MetaNode Follower
 	OpMetaFreeInodesOnRaftFollower uint8 = 0x32
 
+	// Operations: Client -> MetaNode, extended attributes
+	OpMetaSetXAttr    uint8 = 0x33
+	OpMetaGetXAttr    uint8 = 0x34
+	OpMetaListXAttr   uint8 = 0x35
+	OpMetaRemoveXAttr uint8 = 0x36
+
+	// Operations: Client -> MetaNode and MetaNode -> MetaNode, transactions
+	OpMetaTxRename   uint8 = 0x37
+	OpMetaTxPrepare  uint8 = 0x38
+	OpMetaTxCommit   uint8 = 0x39
+	OpMetaTxRollback uint8 = 0x3A
+	OpMetaTxGetState uint8 = 0x3B
+
+	// Operations: Client -> MetaNode, directory quotas
+	OpMetaSetInodeQuota uint8 = 0x3C
+
+	// Operations: Client -> MetaNode, file locks
+	OpMetaSetLock   uint8 = 0x3D
+	OpMetaGetLock   uint8 = 0x3E
+	OpMetaRenewLock uint8 = 0x3F
+
 	// Operations: Master -> MetaNode
 	OpCreateMetaPartition           uint8 = 0x40
 	OpMetaNodeHeartbeat             uint8 = 0x41
@@ -99,6 +129,31 @@ const (
 	OpAddMetaPartitionRaftMember    uint8 = 0x46
 	OpRemoveMetaPartitionRaftMember uint8 = 0x47
 	OpMetaPartitionTryToLeader      uint8 = 0x48
+	OpCreateMetaSnapshot            uint8 = 0x49
+	OpDeleteMetaSnapshot            uint8 = 0x4A
+	OpMetaSplitDir                  uint8 = 0x4B
+
+	// Operations: DataNode -> MetaNode, tiny extent compaction
+	OpMetaGetExtentRefs   uint8 = 0x4C
+	OpMetaRelocateExtents uint8 = 0x4D
+
+	// Operations: MetaNode -> MetaNode, storage tiering
+	OpMetaTierMigrate uint8 = 0x4E
+
+	// Operations: Client -> MetaNode, change log
+	OpMetaReadChanges uint8 = 0x4F
+
+	// Operations: Client -> MetaNode, trash
+	OpMetaRestoreTrash uint8 = 0x50
+
+	// Operations: Master -> MetaNode and MetaNode -> MetaNode, directory quotas
+	OpMetaApplyQuota uint8 = 0x51
+
+	// Operations: Client -> MetaNode, in-place overwrites
+	OpMetaExtentsOverwrite uint8 = 0x52
+
+	// Operations: Client -> MetaNode, directory sharding
+	OpMetaMarkDirRemoving uint8 = 0x53
 
 	// Operations: Master -> DataNode
 	OpCreateDataPartition           uint8 = 0x60
@@ -111,6 +166,7 @@ const (
 	OpAddDataPartitionRaftMember    uint8 = 0x67
 	OpRemoveDataPartitionRaftMember uint8 = 0x68
 	OpDataPartitionTryToLeader      uint8 = 0x69
+	OpEcReconstructDataPartition    uint8 = 0x6A
 
 	// Commons
 	OpIntraGroupNetErr uint8 = 0xF3
@@ -125,6 +181,10 @@ const (
 	OpTryOtherAddr     uint8 = 0xFC
 	OpNotPerm          uint8 = 0xFD
 	OpNotEmtpy         uint8 = 0xFE
+	OpNoAttrErr        uint8 = 0xF2
+	OpLockConflictErr  uint8 = 0xEF
+	OpDirShardErr      uint8 = 0xEE
+	OpAuthErr          uint8 = 0xF1
 	OpOk               uint8 = 0xF0
 
 	OpPing uint8 = 0xFF
@@ -264,6 +324,32 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpMetaEvictInode"
 	case OpMetaSetattr:
 		m = "OpMetaSetattr"
+	case OpMetaSetXAttr:
+		m = "OpMetaSetXAttr"
+	case OpMetaGetXAttr:
+		m = "OpMetaGetXAttr"
+	case OpMetaListXAttr:
+		m = "OpMetaListXAttr"
+	case OpMetaRemoveXAttr:
+		m = "OpMetaRemoveXAttr"
+	case OpMetaTxRename:
+		m = "OpMetaTxRename"
+	case OpMetaTxPrepare:
+		m = "OpMetaTxPrepare"
+	case OpMetaTxCommit:
+		m = "OpMetaTxCommit"
+	case OpMetaTxRollback:
+		m = "OpMetaTxRollback"
+	case OpMetaTxGetState:
+		m = "OpMetaTxGetState"
+	case OpMetaSetInodeQuota:
+		m = "OpMetaSetInodeQuota"
+	case OpMetaSetLock:
+		m = "OpMetaSetLock"
+	case OpMetaGetLock:
+		m = "OpMetaGetLock"
+	case OpMetaRenewLock:
+		m = "OpMetaRenewLock"
 	case OpCreateMetaPartition:
 		m = "OpCreateMetaPartition"
 	case OpMetaNodeHeartbeat:
@@ -316,10 +402,40 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpAddMetaPartitionRaftMember"
 	case OpRemoveMetaPartitionRaftMember:
 		m = "OpRemoveMetaPartitionRaftMember"
+	case OpCreateMetaSnapshot:
+		m = "OpCreateMetaSnapshot"
+	case OpDeleteMetaSnapshot:
+		m = "OpDeleteMetaSnapshot"
+	case OpMetaSplitDir:
+		m = "OpMetaSplitDir"
+	case OpMetaGetExtentRefs:
+		m = "OpMetaGetExtentRefs"
+	case OpMetaRelocateExtents:
+		m = "OpMetaRelocateExtents"
+	case OpMetaTierMigrate:
+		m = "OpMetaTierMigrate"
+	case OpMetaReadChanges:
+		m = "OpMetaReadChanges"
+	case OpMetaRestoreTrash:
+		m = "OpMetaRestoreTrash"
+	case OpMetaApplyQuota:
+		m = "OpMetaApplyQuota"
+	case OpMetaExtentsOverwrite:
+		m = "OpMetaExtentsOverwrite"
+	case OpMetaMarkDirRemoving:
+		m = "OpMetaMarkDirRemoving"
 	case OpMetaPartitionTryToLeader:
 		m = "OpMetaPartitionTryToLeader"
 	case OpDataPartitionTryToLeader:
 		m = "OpDataPartitionTryToLeader"
+	case OpEcConvertExtent:
+		m = "OpEcConvertExtent"
+	case OpTierMigrateExtent:
+		m = "OpTierMigrateExtent"
+	case OpEcReconstructDataPartition:
+		m = "OpEcReconstructDataPartition"
+	case OpAuthenticate:
+		m = "OpAuthenticate"
 	}
 	return
 }
@@ -357,6 +473,14 @@ func (p *Packet) GetResultMsg() (m string) {
 		m = "NotPerm"
 	case OpNotEmtpy:
 		m = "DirNotEmpty"
+	case OpNoAttrErr:
+		m = "NoAttrErr"
+	case OpLockConflictErr:
+		m = "LockConflictErr"
+	case OpDirShardErr:
+		m = "DirShardErr"
+	case OpAuthErr:
+		m = "AuthErr"
 	default:
 		return fmt.Sprintf("Unknown ResultCode(%v)", p.ResultCode)
 	}
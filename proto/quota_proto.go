@@ -0,0 +1,74 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+)
+
+// QuotaInfo defines a quota, which limits the number of inodes and the bytes of the files
+// in the directory tree rooted at RootInode. A limit of zero means unlimited, and a quota
+// on RootIno limits the whole volume.
+type QuotaInfo struct {
+	QuotaID   uint32 `json:"id"`
+	RootInode uint64 `json:"ino"`
+	MaxFiles  uint64 `json:"maxFiles"`
+	MaxBytes  uint64 `json:"maxBytes"`
+	UsedFiles uint64 `json:"usedFiles"`
+	UsedBytes uint64 `json:"usedBytes"`
+}
+
+// String returns the string format of the quota.
+func (q *QuotaInfo) String() string {
+	return fmt.Sprintf("Quota{ID(%v) RootInode(%v) Files(%v/%v) Bytes(%v/%v)}",
+		q.QuotaID, q.RootInode, q.UsedFiles, q.MaxFiles, q.UsedBytes, q.MaxBytes)
+}
+
+// Exceeded returns whether the usage has reached any of the limits.
+func (q *QuotaInfo) Exceeded() bool {
+	return (q.MaxFiles > 0 && q.UsedFiles >= q.MaxFiles) || (q.MaxBytes > 0 && q.UsedBytes >= q.MaxBytes)
+}
+
+// QuotaUsage defines the usage of a quota in a meta partition.
+type QuotaUsage struct {
+	QuotaID uint32
+	Files   uint64
+	Bytes   uint64
+}
+
+// SetInodeQuotaRequest defines the request to add a quota to inodes, or to remove it from them, along with the
+// directory trees beneath the given directories, which are walked by the partition in the background. It is sent
+// by the clients to account the inodes renamed or linked into another quota, and to remove the ones renamed out.
+type SetInodeQuotaRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	Inodes      []uint64 `json:"inos"`
+	QuotaID     uint32   `json:"id"`
+	Dirs        []uint64 `json:"dirs,omitempty"`
+	Remove      bool     `json:"remove,omitempty"`
+}
+
+// ApplyQuotaRequest defines the request to account the inodes of a partition, and the directory trees beneath
+// the entries of the given directories in the partition, to a quota. It is sent by the master to the partition
+// of the root inode of a new quota, and then by the meta partitions to each other along the directory trees.
+// The quota is removed from the inodes instead if Remove is set.
+type ApplyQuotaRequest struct {
+	VolName     string   `json:"vol"`
+	PartitionID uint64   `json:"pid"`
+	QuotaID     uint32   `json:"id"`
+	Inodes      []uint64 `json:"inos"`
+	Dirs        []uint64 `json:"dirs"`
+	Remove      bool     `json:"remove,omitempty"`
+}
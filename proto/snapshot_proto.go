@@ -0,0 +1,45 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+)
+
+// The status of a snapshot
+const (
+	SnapshotCreating uint8 = iota
+	SnapshotNormal
+)
+
+// SnapshotInfo defines a point-in-time snapshot of a volume. Each meta partition freezes its
+// inode and dentry trees when it applies the creation of the snapshot.
+type SnapshotInfo struct {
+	ID         uint64 `json:"id"`
+	Name       string `json:"name"`
+	CreateTime int64  `json:"ctime"`
+	Status     uint8  `json:"status"`
+}
+
+// String returns the string format of the snapshot.
+func (s *SnapshotInfo) String() string {
+	return fmt.Sprintf("Snapshot{ID(%v) Name(%v) CreateTime(%v) Status(%v)}", s.ID, s.Name, s.CreateTime, s.Status)
+}
+
+// MetaSnapshotRequest defines the request from the master to create or delete a snapshot of a meta partition.
+type MetaSnapshotRequest struct {
+	PartitionID uint64 `json:"pid"`
+	SnapshotID  uint64 `json:"snap"`
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+// TierXAttr is the reserved extended attribute of a directory, which keeps the days after which the files
+// not accessed in the directory are migrated to the cold tier of the volume.
+const TierXAttr = "cfs.tier.coldAfterDays"
+
+// TierMigrateExtentRequest defines the request of the metanode to the first host of a cold data partition,
+// to copy an extent of a data partition of the hot tier into a new extent of it.
+type TierMigrateExtentRequest struct {
+	PartitionID    uint64
+	Inode          uint64
+	SrcPartitionID uint64
+	SrcHosts       []string
+	SrcExtentID    uint64
+	Size           uint64
+}
+
+// TierMigrateExtentResponse defines the response to the request of migrating an extent.
+type TierMigrateExtentResponse struct {
+	ExtentID uint64
+}
+
+// TierMigrateRequest defines the request of the partition of a directory with the tier policy to the partition
+// of the files in the directory, to migrate the files not accessed for the days of the policy. The sharded
+// directories are sent to the partitions of their shards, which apply the policy to their own entries of them.
+type TierMigrateRequest struct {
+	VolName       string   `json:"vol"`
+	PartitionID   uint64   `json:"pid"`
+	Inodes        []uint64 `json:"inos"`
+	Dirs          []uint64 `json:"dirs,omitempty"`
+	ColdAfterDays uint32   `json:"days"`
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TrashDirName is the name of the hidden directory under the root, into which the deleted files
+// and directories are moved if the trash of the volume is enabled.
+const TrashDirName = ".Trash"
+
+// TrashEntryNameMaxLen is the max length of the names in the trash directory.
+const TrashEntryNameMaxLen = 255
+
+// TrashEntry defines a deleted file or directory in the trash. The original path is recorded
+// in the name of its dentry in the trash directory, i.e. "<parent inode>_<delete time>_<name>".
+// A name too long is truncated, and then the entry is restored under the truncated name.
+type TrashEntry struct {
+	Name       string `json:"name"` // name in the trash directory
+	Inode      uint64 `json:"ino"`
+	Mode       uint32 `json:"mode"`
+	ParentID   uint64 `json:"pino"`
+	OrigName   string `json:"origName"`
+	DeleteTime int64  `json:"deleteTime"` // unix time in nanoseconds
+}
+
+// String returns the string format of the trash entry.
+func (e *TrashEntry) String() string {
+	return fmt.Sprintf("TrashEntry{Inode(%v) Parent(%v) Name(%v) DeleteTime(%v)}",
+		e.Inode, e.ParentID, e.OrigName, time.Unix(0, e.DeleteTime).Format(time.RFC3339))
+}
+
+// Expired returns whether the entry has been kept in the trash for the given hours.
+func (e *TrashEntry) Expired(retention uint32, now time.Time) bool {
+	return now.Sub(time.Unix(0, e.DeleteTime)) >= time.Duration(retention)*time.Hour
+}
+
+// RestoreTrashRequest defines the request to move an entry in the trash back to its original path,
+// which is sent to the partition of the root.
+type RestoreTrashRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	Name        string `json:"name"` // name in the trash directory
+}
+
+// TrashEntryName returns the name in the trash directory of the dentry deleted from the parent.
+// If it exceeds TrashEntryNameMaxLen, the original name is truncated and followed by its hash,
+// which tells apart the names truncated alike.
+func TrashEntryName(parentID uint64, name string, deleteTime time.Time) string {
+	prefix := fmt.Sprintf("%d_%d_", parentID, deleteTime.UnixNano())
+	if len(prefix)+len(name) <= TrashEntryNameMaxLen {
+		return prefix + name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("~%08x", h.Sum32())
+	n := TrashEntryNameMaxLen - len(prefix) - len(suffix)
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return prefix + name[:n] + suffix
+}
+
+// ParseTrashEntry parses the original path and the delete time from the name in the trash directory.
+func ParseTrashEntry(name string, inode uint64, mode uint32) (entry *TrashEntry, err error) {
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, fmt.Errorf("invalid trash entry name [%v]", name)
+	}
+	entry = &TrashEntry{Name: name, Inode: inode, Mode: mode, OrigName: parts[2]}
+	if entry.ParentID, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid trash entry name [%v]: %v", name, err)
+	}
+	if entry.DeleteTime, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid trash entry name [%v]: %v", name, err)
+	}
+	return
+}
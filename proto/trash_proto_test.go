@@ -0,0 +1,34 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTrashEntryName(t *testing.T) {
+	now := time.Now()
+	name := TrashEntryName(10, "a_b", now)
+	entry, err := ParseTrashEntry(name, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ParentID != 10 || entry.OrigName != "a_b" || entry.DeleteTime != now.UnixNano() {
+		t.Fatalf("expect the entry of a_b, got %v", entry)
+	}
+
+	// the long names are truncated alike, and told apart by the hash
+	long := strings.Repeat("文", 100)
+	name = TrashEntryName(10, long+"a", now)
+	other := TrashEntryName(10, long+"b", now)
+	if len(name) > TrashEntryNameMaxLen || !utf8.ValidString(name) || name == other {
+		t.Fatalf("expect the names truncated and told apart, got %v and %v", name, other)
+	}
+	if entry, err = ParseTrashEntry(name, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ParentID != 10 || !strings.HasPrefix(long, strings.Split(entry.OrigName, "~")[0]) {
+		t.Fatalf("expect the entry of the truncated name, got %v", entry)
+	}
+}
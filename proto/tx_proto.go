@@ -0,0 +1,123 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proto
+
+import (
+	"fmt"
+)
+
+// Transaction states.
+const (
+	TxStateInit uint8 = iota
+	TxStateCommitted
+	TxStateRolledBack
+)
+
+// Transaction operation types, executed by the participants on commit.
+const (
+	TxOpCreateDentry uint8 = iota
+	TxOpDeleteDentry
+	TxOpUpdateDentry
+	TxOpUnlinkInode
+)
+
+// TxPartition defines a meta partition taking part in a transaction.
+type TxPartition struct {
+	PartitionID uint64   `json:"pid"`
+	Members     []string `json:"members"`
+}
+
+// TxOperation defines a single metadata change of a transaction.
+type TxOperation struct {
+	Type     uint8  `json:"type"`
+	ParentID uint64 `json:"pino"`
+	Name     string `json:"name"`
+	Inode    uint64 `json:"ino"`
+	OldInode uint64 `json:"oino"` // inode the dentry is expected to refer to before the change
+	Mode     uint32 `json:"mode"`
+	Shard    bool   `json:"shard,omitempty"` // the dentry is created in a shard of the parent
+}
+
+// String returns the string format of the operation.
+func (op *TxOperation) String() string {
+	return fmt.Sprintf("TxOp{Type(%v) ParentID(%v) Name(%v) Inode(%v) OldInode(%v)}", op.Type, op.ParentID, op.Name, op.Inode, op.OldInode)
+}
+
+// TxParticipant defines the operations a meta partition executes in a transaction.
+type TxParticipant struct {
+	TxPartition
+	Ops []*TxOperation `json:"ops"`
+}
+
+// TxInfo defines a transaction recorded by the coordinator.
+type TxInfo struct {
+	TxID         string           `json:"tid"`
+	State        uint8            `json:"state"`
+	CreateTime   int64            `json:"ct"`
+	Participants []*TxParticipant `json:"participants"`
+}
+
+// TxRenameRequest defines the request to rename a dentry in a transaction.
+// The request is sent to the partition of the source parent, which coordinates the transaction.
+type TxRenameRequest struct {
+	VolName           string       `json:"vol"`
+	PartitionID       uint64       `json:"pid"`
+	SrcParentID       uint64       `json:"spino"`
+	SrcName           string       `json:"sname"`
+	DstParentID       uint64       `json:"dpino"`
+	DstName           string       `json:"dname"`
+	Inode             uint64       `json:"ino"`
+	Mode              uint32       `json:"mode"`
+	OldInode          uint64       `json:"oino"` // inode overwritten in the destination, 0 if none
+	DstPartition      TxPartition  `json:"dmp"`
+	DstShard          bool         `json:"dshard,omitempty"` // the destination is a shard of the parent
+	OldInodePartition *TxPartition `json:"omp"`
+}
+
+// TxPrepareRequest defines the request to prepare the operations of a participant.
+type TxPrepareRequest struct {
+	VolName     string         `json:"vol"`
+	PartitionID uint64         `json:"pid"`
+	TxID        string         `json:"tid"`
+	Coordinator TxPartition    `json:"coordinator"`
+	Ops         []*TxOperation `json:"ops"`
+	CreateTime  int64          `json:"ct"`
+}
+
+// TxCommitRequest defines the request to commit the prepared operations of a participant.
+type TxCommitRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	TxID        string `json:"tid"`
+}
+
+// TxRollbackRequest defines the request to discard the prepared operations of a participant.
+type TxRollbackRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	TxID        string `json:"tid"`
+}
+
+// TxGetStateRequest defines the request to get the state of a transaction from the coordinator.
+type TxGetStateRequest struct {
+	VolName     string `json:"vol"`
+	PartitionID uint64 `json:"pid"`
+	TxID        string `json:"tid"`
+}
+
+// TxGetStateResponse defines the response to the request of getting the state of a transaction.
+type TxGetStateResponse struct {
+	State uint8 `json:"state"`
+}
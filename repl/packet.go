@@ -85,6 +85,8 @@ func (p *FollowerPacket) identificationErrorResultCode(errLog string, errMsg str
 		p.ResultCode = proto.OpAgain
 	} else if strings.Contains(errMsg, raft.ErrNotLeader.Error()) {
 		p.ResultCode = proto.OpTryOtherAddr
+	} else if strings.Contains(errMsg, proto.ErrInvalidTicket.Error()) {
+		p.ResultCode = proto.OpAuthErr
 	} else {
 		p.ResultCode = proto.OpIntraGroupNetErr
 	}
@@ -293,6 +295,8 @@ func (p *Packet) identificationErrorResultCode(errLog string, errMsg string) {
 		p.ResultCode = proto.OpAgain
 	} else if strings.Contains(errMsg, raft.ErrNotLeader.Error()) {
 		p.ResultCode = proto.OpTryOtherAddr
+	} else if strings.Contains(errMsg, proto.ErrInvalidTicket.Error()) {
+		p.ResultCode = proto.OpAuthErr
 	} else {
 		p.ResultCode = proto.OpIntraGroupNetErr
 	}
@@ -359,7 +363,8 @@ func (p *Packet) IsMasterCommand() bool {
 		proto.OpDecommissionDataPartition,
 		proto.OpAddDataPartitionRaftMember,
 		proto.OpRemoveDataPartitionRaftMember,
-		proto.OpDataPartitionTryToLeader:
+		proto.OpDataPartitionTryToLeader,
+		proto.OpEcReconstructDataPartition:
 		return true
 	}
 	return false
@@ -31,6 +31,11 @@ var (
 	gConnPool = util.NewConnectPool()
 )
 
+// SetHandshake sets the handshake function of the connections to the followers.
+func SetHandshake(handshake util.HandshakeFunc) {
+	gConnPool.SetHandshake(handshake)
+}
+
 // ReplProtocol defines the struct of the replication protocol.
 // 1. ServerConn reads a packet from the client socket, and analyzes the addresses of the followers.
 // 2. After the preparation, the packet is send to toBeProcessedCh. If failure happens, send it to the response channel.
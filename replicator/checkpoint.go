@@ -0,0 +1,78 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replicator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// replicaInode defines the inode of the target volume replicating an inode of the source volume.
+type replicaInode struct {
+	Inode      uint64 `json:"ino"`
+	Generation uint64 `json:"gen,omitempty"` // the generation of the source file whose data is replicated
+	// the parent and the name of a directory in the target volume, with which the directory is renamed
+	ParentID uint64 `json:"pino,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// checkpoint defines the progress of the replication, which is stored after each round, so that the
+// replication is resumed from it after restarts.
+type checkpoint struct {
+	Synced     bool                     `json:"synced"`     // the whole volume has been synchronized
+	Partitions map[uint64]uint64        `json:"partitions"` // meta partition ID -> apply ID replicated
+	Inodes     map[uint64]*replicaInode `json:"inodes"`     // source inode -> target inode
+}
+
+func newCheckpoint() *checkpoint {
+	cp := &checkpoint{
+		Partitions: make(map[uint64]uint64),
+		Inodes:     make(map[uint64]*replicaInode),
+	}
+	cp.Inodes[proto.RootIno] = &replicaInode{Inode: proto.RootIno}
+	return cp
+}
+
+func loadCheckpoint(dir string) (cp *checkpoint, err error) {
+	data, err := ioutil.ReadFile(path.Join(dir, checkpointFile))
+	if os.IsNotExist(err) {
+		return newCheckpoint(), nil
+	}
+	if err != nil {
+		return
+	}
+	cp = newCheckpoint()
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Writes the checkpoint into a temporary file, and renames it to replace the old one.
+func (cp *checkpoint) store(dir string) (err error) {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return
+	}
+	tmpFile := path.Join(dir, checkpointFile+".tmp")
+	if err = ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmpFile, path.Join(dir, checkpointFile))
+}
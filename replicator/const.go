@@ -0,0 +1,74 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replicator
+
+import (
+	"time"
+)
+
+const (
+	ModuleName = "replicator"
+)
+
+const (
+	ConfigKeyListen             = "listen"             // string
+	ConfigKeyMasterAddr         = "masterAddr"         // array
+	ConfigKeyVolName            = "volName"            // string
+	ConfigKeyOwner              = "owner"              // string
+	ConfigKeyAuthNodes          = "authNodes"          // array
+	ConfigKeyClientID           = "clientID"           // string
+	ConfigKeyClientKey          = "clientKey"          // string
+	ConfigKeyAuthCertFile       = "authCertFile"       // string
+	ConfigKeyTargetMasterAddr   = "targetMasterAddr"   // array
+	ConfigKeyTargetVolName      = "targetVolName"      // string
+	ConfigKeyTargetOwner        = "targetOwner"        // string
+	ConfigKeyTargetAuthNodes    = "targetAuthNodes"    // array
+	ConfigKeyTargetClientID     = "targetClientID"     // string
+	ConfigKeyTargetClientKey    = "targetClientKey"    // string
+	ConfigKeyTargetAuthCertFile = "targetAuthCertFile" // string
+	ConfigKeyDataDir            = "dataDir"            // string
+	ConfigKeySyncInterval       = "syncInterval"       // int, seconds
+)
+
+const (
+	DefaultListen       = ":17410"
+	DefaultSyncInterval = 5 * time.Second
+
+	// the file of the checkpoint in the data directory
+	checkpointFile = "checkpoint"
+	// the number of the changes read from a partition in a request
+	readChangesLimit = 1024
+	// the maximum number of the changes read from a partition in a round
+	maxRoundChanges = 64 * 1024
+	// the size of the buffer to copy the data of the files
+	copyBufferSize = 1 << 20
+	// the maximum number of the files whose extent keys are cached to copy the changed ranges only
+	maxCachedExtents = 64 * 1024
+	// the default time to wait for the switchover
+	defaultSwitchoverTimeout = 10 * time.Minute
+)
+
+// The states of the replication
+const (
+	StateSyncing   = "syncing" // the whole volume is being synchronized
+	StateRunning   = "running"
+	StateSwitching = "switching" // waiting for the target to catch up with the source
+	StateSwitched  = "switched"  // the target has caught up, and the replication is stopped
+)
+
+const (
+	MetricLagEntries = "lag_entries"
+	MetricLagSeconds = "lag_seconds"
+)
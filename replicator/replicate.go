@@ -0,0 +1,561 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replicator
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// round defines the changes tailed from the source volume, which are replicated in a round.
+type round struct {
+	dirs       map[uint64]struct{} // the source directories whose entries are changed
+	inodes     map[uint64]struct{} // the source inodes whose attributes or data are changed
+	overwrites map[uint64]struct{} // the source files overwritten in place, whose changed ranges are unknown
+	applyIDs   map[uint64]uint64   // meta partition ID -> apply ID replicated after the round
+	partitions []*PartitionStatus
+	changes    int
+	oldest     int64 // the time of the oldest change
+	fullSync   bool  // the changes are not available, so that the whole volume is synchronized
+}
+
+// deletion defines an entry of the target volume to be deleted, which is not in the source volume.
+type deletion struct {
+	parentID uint64
+	name     string
+	inode    uint64
+	mode     uint32
+}
+
+type dataRange struct {
+	offset uint64
+	size   uint64
+}
+
+func (r *Replicator) replicate() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if r.runRound() {
+			log.LogWarnf("action[replicate] switched over, src(%v) dst(%v)", r.src.name, r.dst.name)
+			return
+		}
+		select {
+		case <-r.stopC:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runRound replicates the changes applied by the source volume since the last round, and returns true if
+// the switchover is done.
+func (r *Replicator) runRound() (switched bool) {
+	switching := r.getStatus().State == StateSwitching
+	rd, err := r.tail()
+	if err == nil {
+		err = r.apply(rd)
+	}
+	if err == nil {
+		r.cp.Partitions = rd.applyIDs
+	}
+	if e := r.cp.store(r.dataDir); e != nil && err == nil {
+		err = e
+	}
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	if err != nil {
+		log.LogErrorf("action[runRound] src(%v) dst(%v) err(%v)", r.src.name, r.dst.name, err)
+		r.status.Error = err.Error()
+		return
+	}
+	r.status.Error = ""
+	r.status.LastRound = time.Now()
+	r.status.Partitions = rd.partitions
+	r.status.Inodes = len(r.cp.Inodes)
+	r.status.LagSeconds = 0
+	if rd.changes > 0 {
+		r.status.LagSeconds = time.Now().Unix() - rd.oldest
+	}
+	if r.status.State == StateSyncing {
+		r.status.State = StateRunning
+	}
+	exporter.NewGauge(MetricLagSeconds).SetWithLabels(r.status.LagSeconds, map[string]string{"vol": r.src.name})
+	caughtUp := rd.changes == 0 && !rd.fullSync
+	for _, p := range rd.partitions {
+		labels := map[string]string{"vol": r.src.name, "partition": strconv.FormatUint(p.PartitionID, 10)}
+		exporter.NewGauge(MetricLagEntries).SetWithLabels(int64(p.Lag), labels)
+		if p.Lag > 0 {
+			caughtUp = false
+		}
+	}
+	// the state may be reverted by the timeout of the switchover during the round
+	if switching && caughtUp && r.status.State == StateSwitching {
+		r.status.State = StateSwitched
+		close(r.switched)
+		return true
+	}
+	return
+}
+
+// tail reads the changes applied by the meta partitions of the source volume since the checkpoint.
+func (r *Replicator) tail() (rd *round, err error) {
+	rd = &round{
+		dirs:       make(map[uint64]struct{}),
+		inodes:     make(map[uint64]struct{}),
+		overwrites: make(map[uint64]struct{}),
+		applyIDs:   make(map[uint64]uint64),
+		fullSync:   !r.cp.Synced,
+	}
+	for _, pid := range r.src.mw.PartitionIDs() {
+		if err = r.tailPartition(rd, pid); err != nil {
+			return
+		}
+	}
+	sort.Slice(rd.partitions, func(i, j int) bool { return rd.partitions[i].PartitionID < rd.partitions[j].PartitionID })
+	return
+}
+
+func (r *Replicator) tailPartition(rd *round, pid uint64) (err error) {
+	var (
+		from          = r.cp.Partitions[pid]
+		leaderApplyID uint64
+		read          int
+	)
+	for read < maxRoundChanges {
+		resp, err := r.src.mw.ReadChanges(pid, from, readChangesLimit)
+		if err != nil {
+			log.LogErrorf("action[tailPartition] vol(%v) pid(%v) from(%v) err(%v)", r.src.name, pid, from, err)
+			return err
+		}
+		if resp.ApplyID > leaderApplyID {
+			leaderApplyID = resp.ApplyID
+		}
+		// the changes applied before the apply ID are covered by the full sync started after it
+		if rd.fullSync || resp.Truncated {
+			if resp.Truncated {
+				log.LogWarnf("action[tailPartition] vol(%v) pid(%v) changes since %v are truncated", r.src.name, pid, from)
+			}
+			rd.fullSync = true
+			if resp.ApplyID > from {
+				from = resp.ApplyID
+			}
+			break
+		}
+		if len(resp.Changes) == 0 {
+			if resp.ApplyID > from {
+				from = resp.ApplyID
+			}
+			break
+		}
+		for _, change := range resp.Changes {
+			rd.addChange(change)
+		}
+		from = resp.Changes[len(resp.Changes)-1].ApplyID
+		read += len(resp.Changes)
+	}
+	rd.applyIDs[pid] = from
+	status := &PartitionStatus{PartitionID: pid, ApplyID: from, LeaderApplyID: leaderApplyID}
+	if leaderApplyID > from {
+		status.Lag = leaderApplyID - from
+	}
+	rd.partitions = append(rd.partitions, status)
+	return nil
+}
+
+// addChange classifies a change read from the change log into the directories and the inodes to be synchronized.
+func (rd *round) addChange(change *proto.MetaChange) {
+	switch change.Type {
+	case proto.MetaChangeCreateDentry, proto.MetaChangeDeleteDentry, proto.MetaChangeUpdateDentry:
+		rd.dirs[change.ParentID] = struct{}{}
+	case proto.MetaChangeRename:
+		// the dentries are changed by the participants of the transaction later
+	case proto.MetaChangeOverwrite:
+		// the extent keys are not changed by the overwrite, so that the whole file is copied
+		rd.inodes[change.Inode] = struct{}{}
+		rd.overwrites[change.Inode] = struct{}{}
+	default:
+		rd.inodes[change.Inode] = struct{}{}
+	}
+	if rd.changes == 0 || change.Time < rd.oldest {
+		rd.oldest = change.Time
+	}
+	rd.changes++
+}
+
+// apply replicates the changes of the round to the target volume. The entries of the changed directories are
+// synchronized first, and the entries removed from the source are deleted after, so that the ones moved to the
+// other directories are renamed or linked in the target rather than copied again.
+func (r *Replicator) apply(rd *round) (err error) {
+	if rd.fullSync {
+		return r.syncAll()
+	}
+	var deletions []*deletion
+	for dir := range rd.dirs {
+		m, ok := r.cp.Inodes[dir]
+		if !ok {
+			continue
+		}
+		if err = r.syncDir(dir, m.Inode, false, &deletions, nil); err != nil && err != syscall.ENOENT {
+			return
+		}
+	}
+	r.deleteEntries(deletions)
+	for ino := range rd.inodes {
+		if _, ok := rd.overwrites[ino]; ok {
+			delete(r.extents, ino)
+		}
+		m, ok := r.cp.Inodes[ino]
+		if !ok {
+			continue
+		}
+		info, err := r.src.mw.InodeGet_ll(ino)
+		if err == syscall.ENOENT || (err == nil && info.Nlink == 0) {
+			r.dropInode(ino)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = r.syncInode(info, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncAll synchronizes the whole volume, and drops the mappings of the inodes no longer in the source.
+func (r *Replicator) syncAll() (err error) {
+	log.LogWarnf("action[syncAll] start, src(%v) dst(%v)", r.src.name, r.dst.name)
+	start := time.Now()
+	// the files overwritten in place since the last round are unknown, so that they are copied entirely
+	r.extents = make(map[uint64][]proto.ExtentKey)
+	visited := map[uint64]struct{}{proto.RootIno: {}}
+	var deletions []*deletion
+	if err = r.syncDir(proto.RootIno, proto.RootIno, true, &deletions, visited); err != nil {
+		return
+	}
+	r.deleteEntries(deletions)
+	for ino := range r.cp.Inodes {
+		if _, ok := visited[ino]; !ok {
+			r.dropInode(ino)
+		}
+	}
+	info, err := r.src.mw.InodeGet_ll(proto.RootIno)
+	if err != nil {
+		return
+	}
+	if err = r.syncInode(info, r.cp.Inodes[proto.RootIno]); err != nil {
+		return
+	}
+	r.cp.Synced = true
+	log.LogWarnf("action[syncAll] done, src(%v) dst(%v) inodes(%v) cost(%v)", r.src.name, r.dst.name, len(r.cp.Inodes), time.Since(start))
+	return
+}
+
+// syncDir synchronizes the entries of a source directory to the target one. The entries not in the source are
+// deferred to be deleted, and the sub directories are synchronized as well if recursive.
+func (r *Replicator) syncDir(srcDir, dstDir uint64, recursive bool, deletions *[]*deletion, visited map[uint64]struct{}) (err error) {
+	srcEntries, err := r.src.mw.ReadDir_ll(srcDir)
+	if err != nil {
+		return
+	}
+	dstEntries, err := r.dst.mw.ReadDir_ll(dstDir)
+	if err != nil {
+		return
+	}
+	targets := make(map[string]proto.Dentry, len(dstEntries))
+	for _, dentry := range dstEntries {
+		targets[dentry.Name] = dentry
+	}
+	names := make(map[string]struct{}, len(srcEntries))
+	for _, dentry := range srcEntries {
+		if srcDir == proto.RootIno && dentry.Name == proto.TrashDirName {
+			continue
+		}
+		names[dentry.Name] = struct{}{}
+		if visited != nil {
+			visited[dentry.Inode] = struct{}{}
+		}
+		m := r.cp.Inodes[dentry.Inode]
+		target, exist := targets[dentry.Name]
+		if exist && m != nil && target.Inode == m.Inode && !recursive {
+			continue
+		}
+		info, err := r.src.mw.InodeGet_ll(dentry.Inode)
+		if err == syscall.ENOENT {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		created := false
+		if !exist || m == nil || target.Inode != m.Inode {
+			if exist {
+				if err = r.removeEntry(dstDir, target.Name, target.Inode, target.Type); err != nil {
+					return err
+				}
+			}
+			if m, created, err = r.createEntry(dstDir, dentry.Name, info); err != nil {
+				return err
+			}
+		}
+		if recursive && !created {
+			if err = r.syncInode(info, m); err != nil {
+				return err
+			}
+		}
+		if created && proto.IsRegular(info.Mode) {
+			if err = r.syncData(info.Inode, m); err != nil {
+				return err
+			}
+		}
+		// the entries of a new directory are all new
+		if proto.IsDir(info.Mode) && (recursive || created) {
+			if err = r.syncDir(info.Inode, m.Inode, true, deletions, visited); err != nil && err != syscall.ENOENT {
+				return err
+			}
+		}
+	}
+	for name, target := range targets {
+		if dstDir == proto.RootIno && name == proto.TrashDirName {
+			continue
+		}
+		if _, ok := names[name]; !ok {
+			*deletions = append(*deletions, &deletion{parentID: dstDir, name: name, inode: target.Inode, mode: target.Type})
+		}
+	}
+	return nil
+}
+
+// createEntry creates the entry of a source inode in the target directory. The inode replicated before is
+// renamed if it is a directory or linked otherwise, and a new one is created if failed.
+func (r *Replicator) createEntry(dstDir uint64, name string, info *proto.InodeInfo) (m *replicaInode, created bool, err error) {
+	if m = r.cp.Inodes[info.Inode]; m != nil {
+		if proto.IsDir(info.Mode) {
+			if ino, _, e := r.dst.mw.Lookup_ll(m.ParentID, m.Name); e == nil && ino == m.Inode {
+				if err = r.dst.mw.Rename_ll(m.ParentID, m.Name, dstDir, name); err == nil {
+					m.ParentID, m.Name = dstDir, name
+					return
+				}
+			}
+		} else if _, err = r.dst.mw.Link(dstDir, name, m.Inode); err == nil {
+			return
+		}
+		log.LogWarnf("action[createEntry] failed to move or link, create a new one, src(%v) dst(%v) parent(%v) name(%v) err(%v)",
+			info.Inode, m.Inode, dstDir, name, err)
+		r.dropInode(info.Inode)
+	}
+	dstInfo, err := r.dst.mw.Create_ll(dstDir, name, info.Mode, info.Uid, info.Gid, info.Target)
+	if err != nil {
+		log.LogErrorf("action[createEntry] parent(%v) name(%v) err(%v)", dstDir, name, err)
+		return nil, false, err
+	}
+	m = &replicaInode{Inode: dstInfo.Inode}
+	if proto.IsDir(info.Mode) {
+		m.ParentID, m.Name = dstDir, name
+	}
+	r.cp.Inodes[info.Inode] = m
+	if err = r.syncXAttrs(info.Inode, m.Inode); err != nil {
+		return
+	}
+	return m, true, nil
+}
+
+// deleteEntries deletes the entries of the target volume, unless they are replaced during the round.
+func (r *Replicator) deleteEntries(deletions []*deletion) {
+	for _, d := range deletions {
+		ino, _, err := r.dst.mw.Lookup_ll(d.parentID, d.name)
+		if err != nil || ino != d.inode {
+			continue
+		}
+		if err = r.removeEntry(d.parentID, d.name, d.inode, d.mode); err != nil {
+			log.LogWarnf("action[deleteEntries] parent(%v) name(%v) ino(%v) err(%v)", d.parentID, d.name, d.inode, err)
+		}
+	}
+}
+
+// removeEntry removes an entry of the target volume, and the directory is removed recursively.
+func (r *Replicator) removeEntry(parentID uint64, name string, ino uint64, mode uint32) error {
+	if proto.IsDir(mode) {
+		children, err := r.dst.mw.ReadDir_ll(ino)
+		if err != nil && err != syscall.ENOENT {
+			return err
+		}
+		for _, child := range children {
+			if err = r.removeEntry(ino, child.Name, child.Inode, child.Type); err != nil {
+				return err
+			}
+		}
+	}
+	info, err := r.dst.mw.Delete_ll(parentID, name, proto.IsDir(mode))
+	if err != nil {
+		return err
+	}
+	if info != nil && info.Nlink == 0 {
+		r.dst.mw.Evict(info.Inode)
+	}
+	return nil
+}
+
+// syncInode synchronizes the attributes and the data of a source inode to the target one.
+func (r *Replicator) syncInode(info *proto.InodeInfo, m *replicaInode) (err error) {
+	if err = r.dst.mw.SetattrAsRoot(m.Inode, proto.AttrMode|proto.AttrUid|proto.AttrGid, info.Mode, info.Uid, info.Gid); err != nil {
+		return
+	}
+	if err = r.syncXAttrs(info.Inode, m.Inode); err != nil {
+		return
+	}
+	if proto.IsRegular(info.Mode) {
+		return r.syncData(info.Inode, m)
+	}
+	return
+}
+
+func (r *Replicator) syncXAttrs(srcIno, dstIno uint64) (err error) {
+	names, err := r.src.mw.XAttrsList_ll(srcIno)
+	if err != nil {
+		return
+	}
+	dstNames, err := r.dst.mw.XAttrsList_ll(dstIno)
+	if err != nil {
+		return
+	}
+	exists := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		exists[name] = struct{}{}
+		value, err := r.src.mw.XAttrGet_ll(srcIno, name)
+		if err == syscall.ENODATA {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if dstValue, e := r.dst.mw.XAttrGet_ll(dstIno, name); e == nil && bytes.Equal(value, dstValue) {
+			continue
+		}
+		if err = r.dst.mw.XAttrSetAsRoot_ll(dstIno, name, value, 0); err != nil {
+			return err
+		}
+	}
+	for _, name := range dstNames {
+		if _, ok := exists[name]; !ok {
+			if err = r.dst.mw.XAttrDelAsRoot_ll(dstIno, name); err != nil && err != syscall.ENODATA {
+				return
+			}
+		}
+	}
+	return nil
+}
+
+// syncData copies the data of a source file changed since the last replication to the target file. Only the
+// ranges of the extent keys not replicated before are copied if they are cached. The generation of the source
+// is bumped by the overwrites in place as well, which drop the cached extent keys beforehand.
+func (r *Replicator) syncData(srcIno uint64, m *replicaInode) (err error) {
+	gen, size, extents, err := r.src.mw.GetExtents(srcIno)
+	if err != nil || (gen == m.Generation && gen != 0) {
+		return
+	}
+	ranges := changedRanges(extents, r.extents[srcIno], size)
+	if err = r.src.ec.OpenStream(srcIno); err != nil {
+		return
+	}
+	defer r.src.ec.CloseStream(srcIno)
+	if err = r.src.ec.RefreshExtentsCache(srcIno); err != nil {
+		return
+	}
+	if err = r.dst.ec.OpenStream(m.Inode); err != nil {
+		return
+	}
+	defer r.dst.ec.CloseStream(m.Inode)
+
+	buf := make([]byte, copyBufferSize)
+	for _, dr := range ranges {
+		if err = r.copyRange(srcIno, m.Inode, dr, buf); err != nil {
+			log.LogErrorf("action[syncData] src(%v) dst(%v) range(%v,%v) err(%v)", srcIno, m.Inode, dr.offset, dr.size, err)
+			return
+		}
+	}
+	if err = r.dst.ec.Flush(m.Inode); err != nil {
+		return
+	}
+	if err = r.dst.ec.Truncate(m.Inode, int(size)); err != nil {
+		return
+	}
+	m.Generation = gen
+	if len(r.extents) >= maxCachedExtents {
+		r.extents = make(map[uint64][]proto.ExtentKey)
+	}
+	r.extents[srcIno] = extents
+	return
+}
+
+func (r *Replicator) copyRange(srcIno, dstIno uint64, dr dataRange, buf []byte) error {
+	for offset, end := dr.offset, dr.offset+dr.size; offset < end; {
+		size := uint64(len(buf))
+		if end-offset < size {
+			size = end - offset
+		}
+		read, err := r.src.ec.Read(srcIno, buf[:size], int(offset), int(size))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if read == 0 {
+			return nil
+		}
+		if _, err = r.dst.ec.Write(dstIno, int(offset), buf[:read], false); err != nil {
+			return err
+		}
+		offset += uint64(read)
+	}
+	return nil
+}
+
+// changedRanges returns the ranges of the extent keys not in the ones replicated before, or the whole file
+// if they are unknown.
+func changedRanges(extents, replicated []proto.ExtentKey, size uint64) (ranges []dataRange) {
+	if replicated == nil {
+		return []dataRange{{offset: 0, size: size}}
+	}
+	keys := make(map[proto.ExtentKey]struct{}, len(replicated))
+	for _, ek := range replicated {
+		keys[ek] = struct{}{}
+	}
+	for _, ek := range extents {
+		if _, ok := keys[ek]; ok || ek.FileOffset >= size {
+			continue
+		}
+		dr := dataRange{offset: ek.FileOffset, size: uint64(ek.Size)}
+		if dr.offset+dr.size > size {
+			dr.size = size - dr.offset
+		}
+		ranges = append(ranges, dr)
+	}
+	return
+}
+
+func (r *Replicator) dropInode(ino uint64) {
+	delete(r.cp.Inodes, ino)
+	delete(r.extents, ino)
+}
@@ -0,0 +1,124 @@
+package replicator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func newTestRound() *round {
+	return &round{
+		dirs:       make(map[uint64]struct{}),
+		inodes:     make(map[uint64]struct{}),
+		overwrites: make(map[uint64]struct{}),
+		applyIDs:   make(map[uint64]uint64),
+	}
+}
+
+func TestRoundAddChange(t *testing.T) {
+	rd := newTestRound()
+	changes := []*proto.MetaChange{
+		{Type: proto.MetaChangeCreateDentry, ParentID: 1, Inode: 10, Time: 3},
+		{Type: proto.MetaChangeRename, ParentID: 1, Inode: 11, Time: 2},
+		{Type: proto.MetaChangeAppend, Inode: 12, Time: 4},
+		{Type: proto.MetaChangeOverwrite, Inode: 13, Time: 5},
+	}
+	for _, change := range changes {
+		rd.addChange(change)
+	}
+	if !reflect.DeepEqual(rd.dirs, map[uint64]struct{}{1: {}}) {
+		t.Fatalf("unexpected dirs %v", rd.dirs)
+	}
+	if !reflect.DeepEqual(rd.inodes, map[uint64]struct{}{12: {}, 13: {}}) {
+		t.Fatalf("unexpected inodes %v", rd.inodes)
+	}
+	if !reflect.DeepEqual(rd.overwrites, map[uint64]struct{}{13: {}}) {
+		t.Fatalf("expect only the overwritten file to be copied entirely, got %v", rd.overwrites)
+	}
+	if rd.changes != len(changes) || rd.oldest != 2 {
+		t.Fatalf("unexpected changes %v oldest %v", rd.changes, rd.oldest)
+	}
+}
+
+func TestChangedRanges(t *testing.T) {
+	ek := func(offset uint64, size uint32, extentID uint64) proto.ExtentKey {
+		return proto.ExtentKey{FileOffset: offset, PartitionId: 1, ExtentId: extentID, Size: size}
+	}
+	replicated := []proto.ExtentKey{ek(0, 100, 1), ek(100, 100, 2)}
+	tests := []struct {
+		name       string
+		extents    []proto.ExtentKey
+		replicated []proto.ExtentKey
+		size       uint64
+		want       []dataRange
+	}{
+		{
+			name:    "unknown",
+			extents: replicated,
+			size:    200,
+			want:    []dataRange{{offset: 0, size: 200}},
+		},
+		{
+			// an overwrite in place changes neither the extent keys nor the size
+			name:       "unchanged",
+			extents:    replicated,
+			replicated: replicated,
+			size:       200,
+		},
+		{
+			name:       "appended",
+			extents:    []proto.ExtentKey{ek(0, 100, 1), ek(100, 100, 2), ek(200, 50, 3)},
+			replicated: replicated,
+			size:       250,
+			want:       []dataRange{{offset: 200, size: 50}},
+		},
+		{
+			name:       "replaced",
+			extents:    []proto.ExtentKey{ek(0, 100, 1), ek(100, 50, 3), ek(150, 50, 2)},
+			replicated: replicated,
+			size:       200,
+			want:       []dataRange{{offset: 100, size: 50}, {offset: 150, size: 50}},
+		},
+		{
+			name:       "truncated",
+			extents:    []proto.ExtentKey{ek(0, 100, 1), ek(100, 100, 3)},
+			replicated: replicated,
+			size:       150,
+			want:       []dataRange{{offset: 100, size: 50}},
+		},
+		{
+			name:       "beyond size",
+			extents:    []proto.ExtentKey{ek(0, 100, 1), ek(100, 100, 3)},
+			replicated: replicated,
+			size:       100,
+		},
+	}
+	for _, tt := range tests {
+		if got := changedRanges(tt.extents, tt.replicated, tt.size); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: expect ranges %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// An overwrite in place drops the extent keys replicated, so that the whole file is copied.
+func TestApplyOverwriteCopiesWholeFile(t *testing.T) {
+	extents := []proto.ExtentKey{{PartitionId: 1, ExtentId: 1, Size: 100}}
+	r := &Replicator{
+		cp:      newCheckpoint(),
+		extents: map[uint64][]proto.ExtentKey{10: extents, 11: extents},
+	}
+	rd := newTestRound()
+	rd.addChange(&proto.MetaChange{Type: proto.MetaChangeOverwrite, Inode: 10})
+	rd.addChange(&proto.MetaChange{Type: proto.MetaChangeAppend, Inode: 11})
+	// the inodes are not mapped, so that only the cached extent keys are updated
+	if err := r.apply(rd); err != nil {
+		t.Fatal(err)
+	}
+	if got := changedRanges(extents, r.extents[10], 100); !reflect.DeepEqual(got, []dataRange{{offset: 0, size: 100}}) {
+		t.Fatalf("expect the overwritten file to be copied entirely, got %v", got)
+	}
+	if got := changedRanges(extents, r.extents[11], 100); got != nil {
+		t.Fatalf("expect the unchanged ranges to be skipped, got %v", got)
+	}
+}
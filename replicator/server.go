@@ -0,0 +1,295 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package replicator replicates a volume to a volume of another cluster asynchronously. It tails the changes
+// applied by the meta partitions of the source volume, and synchronizes the directories and the files changed
+// to the target volume, which must not be modified by the others until the switchover.
+package replicator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/auth"
+	"github.com/chubaofs/chubaofs/util/config"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The status of the server
+const (
+	Standby uint32 = iota
+	Start
+	Running
+	Shutdown
+	Stopped
+)
+
+// Replicator defines the structure of the replication service of a volume.
+type Replicator struct {
+	listen     string
+	dataDir    string
+	interval   time.Duration
+	src        *volume
+	dst        *volume
+	httpServer *http.Server
+	state      uint32
+	wg         sync.WaitGroup
+	stopC      chan struct{}
+
+	cp       *checkpoint
+	extents  map[uint64][]proto.ExtentKey // source inode -> extent keys replicated
+	statusMu sync.RWMutex
+	status   *Status
+	switched chan struct{} // closed once the switchover is done
+}
+
+// Status defines the status of the replication.
+type Status struct {
+	SrcVol     string             `json:"srcVol"`
+	DstVol     string             `json:"dstVol"`
+	State      string             `json:"state"`
+	LastRound  time.Time          `json:"lastRound"`
+	LagSeconds int64              `json:"lagSeconds"` // the age of the oldest change replicated in the last round
+	Inodes     int                `json:"inodes"`
+	Partitions []*PartitionStatus `json:"partitions"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// PartitionStatus defines the progress of the replication of a meta partition.
+type PartitionStatus struct {
+	PartitionID   uint64 `json:"id"`
+	ApplyID       uint64 `json:"applyID"`
+	LeaderApplyID uint64 `json:"leaderApplyID"`
+	Lag           uint64 `json:"lag"`
+}
+
+// NewServer returns a new replicator.
+func NewServer() *Replicator {
+	return &Replicator{}
+}
+
+// Start starts the replicator.
+func (r *Replicator) Start(cfg *config.Config) (err error) {
+	if atomic.CompareAndSwapUint32(&r.state, Standby, Start) {
+		defer func() {
+			if err != nil {
+				atomic.StoreUint32(&r.state, Standby)
+			} else {
+				atomic.StoreUint32(&r.state, Running)
+			}
+		}()
+		if err = r.onStart(cfg); err != nil {
+			return
+		}
+		r.wg.Add(1)
+	}
+	return
+}
+
+// Shutdown shuts down the replicator.
+func (r *Replicator) Shutdown() {
+	if atomic.CompareAndSwapUint32(&r.state, Running, Shutdown) {
+		close(r.stopC)
+		r.httpServer.Close()
+		r.wg.Done()
+		atomic.StoreUint32(&r.state, Stopped)
+	}
+}
+
+// Sync blocks the invoker until the replicator is shut down.
+func (r *Replicator) Sync() {
+	if atomic.LoadUint32(&r.state) == Running {
+		r.wg.Wait()
+	}
+}
+
+func (r *Replicator) onStart(cfg *config.Config) (err error) {
+	if err = r.parseConfig(cfg); err != nil {
+		return
+	}
+	exporter.Init(ModuleName, cfg)
+	if err = os.MkdirAll(r.dataDir, 0755); err != nil {
+		return
+	}
+	if r.cp, err = loadCheckpoint(r.dataDir); err != nil {
+		return fmt.Errorf("load checkpoint from %v err: %v", r.dataDir, err)
+	}
+	r.extents = make(map[uint64][]proto.ExtentKey)
+	r.status = &Status{SrcVol: r.src.name, DstVol: r.dst.name, State: StateRunning}
+	if !r.cp.Synced {
+		r.status.State = StateSyncing
+	}
+	r.stopC = make(chan struct{})
+	r.switched = make(chan struct{})
+	go r.replicate()
+
+	http.HandleFunc("/status", r.getStatusAPI)
+	http.HandleFunc("/switchover", r.switchoverAPI)
+	r.httpServer = &http.Server{Addr: r.listen}
+	go func() {
+		if e := r.httpServer.ListenAndServe(); e != nil && e != http.ErrServerClosed {
+			log.LogErrorf("action[onStart] listen(%v) err(%v)", r.listen, e)
+		}
+	}()
+	log.LogInfof("action[onStart] replicator listen(%v) src(%v) dst(%v)", r.listen, r.src.name, r.dst.name)
+	return
+}
+
+func (r *Replicator) parseConfig(cfg *config.Config) (err error) {
+	if r.listen = cfg.GetString(ConfigKeyListen); r.listen == "" {
+		r.listen = DefaultListen
+	}
+	if r.dataDir = cfg.GetString(ConfigKeyDataDir); r.dataDir == "" {
+		return fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, "dataDir is empty")
+	}
+	r.interval = DefaultSyncInterval
+	if seconds := cfg.GetInt64(ConfigKeySyncInterval); seconds > 0 {
+		r.interval = time.Duration(seconds) * time.Second
+	}
+	srcAuth, err := parseAuthenticator(cfg, ConfigKeyAuthNodes, ConfigKeyClientID, ConfigKeyClientKey, ConfigKeyAuthCertFile)
+	if err != nil {
+		return
+	}
+	if r.src, err = parseVolume(cfg, ConfigKeyMasterAddr, ConfigKeyVolName, ConfigKeyOwner, srcAuth); err != nil {
+		return
+	}
+	dstAuth, err := parseAuthenticator(cfg, ConfigKeyTargetAuthNodes, ConfigKeyTargetClientID, ConfigKeyTargetClientKey, ConfigKeyTargetAuthCertFile)
+	if err != nil {
+		return
+	}
+	if r.dst, err = parseVolume(cfg, ConfigKeyTargetMasterAddr, ConfigKeyTargetVolName, ConfigKeyTargetOwner, dstAuth); err != nil {
+		return
+	}
+	return
+}
+
+// Returns the authenticator of a cluster, or nil if the authnodes of the cluster are not configured.
+func parseAuthenticator(cfg *config.Config, nodesKey, idKey, keyKey, certKey string) (*auth.Authenticator, error) {
+	var authNodes []string
+	for _, addr := range cfg.GetArray(nodesKey) {
+		authNodes = append(authNodes, addr.(string))
+	}
+	if len(authNodes) == 0 {
+		return nil, nil
+	}
+	a, err := auth.NewAuthenticator(authNodes, cfg.GetString(idKey), cfg.GetString(keyKey), cfg.GetString(certKey))
+	if err != nil {
+		return nil, fmt.Errorf("%v,err:%v", proto.ErrInvalidCfg, err.Error())
+	}
+	return a, nil
+}
+
+func parseVolume(cfg *config.Config, mastersKey, nameKey, ownerKey string, authenticator *auth.Authenticator) (*volume, error) {
+	var masters []string
+	for _, addr := range cfg.GetArray(mastersKey) {
+		masters = append(masters, addr.(string))
+	}
+	name, owner := cfg.GetString(nameKey), cfg.GetString(ownerKey)
+	if len(masters) == 0 || name == "" || owner == "" {
+		return nil, fmt.Errorf("%v,err:%v, %v or %v is empty", proto.ErrInvalidCfg, mastersKey, nameKey, ownerKey)
+	}
+	return newVolume(name, owner, strings.Join(masters, ","), authenticator)
+}
+
+func (r *Replicator) getStatus() *Status {
+	r.statusMu.RLock()
+	defer r.statusMu.RUnlock()
+	status := *r.status
+	return &status
+}
+
+func (r *Replicator) setState(state string) {
+	r.statusMu.Lock()
+	r.status.State = state
+	r.statusMu.Unlock()
+}
+
+func (r *Replicator) getStatusAPI(w http.ResponseWriter, req *http.Request) {
+	r.buildSuccessResp(w, r.getStatus())
+}
+
+// switchoverAPI waits for the target volume to catch up with the source volume, and then stops the replication.
+// The writes to the source volume must be stopped before, otherwise the target may never catch up.
+func (r *Replicator) switchoverAPI(w http.ResponseWriter, req *http.Request) {
+	timeout := defaultSwitchoverTimeout
+	if value := req.FormValue("timeout"); value != "" {
+		seconds, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			r.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	r.statusMu.Lock()
+	switch r.status.State {
+	case StateRunning:
+		r.status.State = StateSwitching
+	case StateSwitching, StateSwitched:
+	default:
+		r.statusMu.Unlock()
+		r.buildFailureResp(w, http.StatusConflict, fmt.Sprintf("replication is %v", r.status.State))
+		return
+	}
+	r.statusMu.Unlock()
+	log.LogWarnf("action[switchoverAPI] src(%v) dst(%v) timeout(%v)", r.src.name, r.dst.name, timeout)
+
+	select {
+	case <-r.switched:
+		r.buildSuccessResp(w, r.getStatus())
+	case <-time.After(timeout):
+		r.statusMu.Lock()
+		if r.status.State == StateSwitching {
+			r.status.State = StateRunning
+		}
+		r.statusMu.Unlock()
+		r.buildFailureResp(w, http.StatusRequestTimeout, "target has not caught up with source")
+	}
+}
+
+func (r *Replicator) buildSuccessResp(w http.ResponseWriter, data interface{}) {
+	r.buildJSONResp(w, http.StatusOK, data, "")
+}
+
+func (r *Replicator) buildFailureResp(w http.ResponseWriter, code int, msg string) {
+	r.buildJSONResp(w, code, nil, msg)
+}
+
+// Create response for the API request.
+func (r *Replicator) buildJSONResp(w http.ResponseWriter, code int, data interface{}, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	body := struct {
+		Code int         `json:"code"`
+		Data interface{} `json:"data"`
+		Msg  string      `json:"msg"`
+	}{
+		Code: code,
+		Data: data,
+		Msg:  msg,
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	w.Write(jsonBody)
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package replicator
+
+import (
+	"github.com/chubaofs/chubaofs/sdk/data/stream"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/auth"
+	"github.com/chubaofs/chubaofs/util/errors"
+)
+
+// volume defines the clients of a volume replicated from or to.
+type volume struct {
+	name string
+	mw   *meta.MetaWrapper
+	ec   *stream.ExtentClient
+}
+
+func newVolume(name, owner, masters string, authenticator *auth.Authenticator) (v *volume, err error) {
+	v = &volume{name: name}
+	if v.mw, err = meta.NewMetaWrapper(name, owner, masters, authenticator); err != nil {
+		return nil, errors.Trace(err, "NewMetaWrapper failed!")
+	}
+	v.ec, err = stream.NewExtentClient(name, masters, authenticator, 0, 0, v.mw.AppendExtentKey, v.mw.GetExtents, v.mw.Truncate, v.mw.OverwriteExtents, v.mw.CheckQuota)
+	if err != nil {
+		return nil, errors.Trace(err, "NewExtentClient failed!")
+	}
+	return
+}
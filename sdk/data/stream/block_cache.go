@@ -0,0 +1,316 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The block cache keeps the blocks of the files read by the client in memory, and optionally the
+// blocks evicted from memory on the local disk. The blocks of an inode are tagged with the generation
+// of its extents, and are dropped once the extents are refreshed from the metanode with another
+// generation, which the client does on each open. The generation is bumped by the appends and the
+// truncations, and by the in-place overwrites which the writers record on flush. Together with the
+// invalidation on the local writes, the reads are consistent in the close-to-open manner.
+
+// The policies of the block cache.
+const (
+	BlockCachePolicyNone   = "none"
+	BlockCachePolicyMemory = "memory"
+	BlockCachePolicyDisk   = "disk" // memory backed by the local disk
+)
+
+const (
+	BlockCacheBlockSize       = 128 * util.KB
+	DefaultBlockCacheSize     = 256 * util.MB
+	DefaultBlockCacheDiskSize = 4 * util.GB
+)
+
+// The names of the metrics.
+const (
+	BlockCacheHit     = "blockcache_hit"
+	BlockCacheDiskHit = "blockcache_disk_hit"
+	BlockCacheMiss    = "blockcache_miss"
+)
+
+type blockKey struct {
+	inode uint64
+	index int
+}
+
+type cachedBlock struct {
+	key  blockKey
+	gen  uint64
+	data []byte // nil for the blocks on disk
+	size int
+}
+
+// blockLRU is a bounded LRU list of the blocks, which is not thread-safe.
+type blockLRU struct {
+	capacity int64
+	size     int64
+	lru      *list.List
+	blocks   map[blockKey]*list.Element
+}
+
+func newBlockLRU(capacity int64) *blockLRU {
+	return &blockLRU{
+		capacity: capacity,
+		lru:      list.New(),
+		blocks:   make(map[blockKey]*list.Element),
+	}
+}
+
+func (l *blockLRU) get(key blockKey) *cachedBlock {
+	e, ok := l.blocks[key]
+	if !ok {
+		return nil
+	}
+	l.lru.MoveToFront(e)
+	return e.Value.(*cachedBlock)
+}
+
+// put inserts the block, and returns the blocks evicted to keep the size within the capacity.
+func (l *blockLRU) put(b *cachedBlock) (evicted []*cachedBlock) {
+	if old := l.remove(b.key); old != nil {
+		evicted = append(evicted, old)
+	}
+	l.blocks[b.key] = l.lru.PushFront(b)
+	l.size += int64(b.size)
+	for l.size > l.capacity {
+		e := l.lru.Back()
+		victim := e.Value.(*cachedBlock)
+		l.lru.Remove(e)
+		delete(l.blocks, victim.key)
+		l.size -= int64(victim.size)
+		evicted = append(evicted, victim)
+	}
+	return
+}
+
+func (l *blockLRU) remove(key blockKey) *cachedBlock {
+	e, ok := l.blocks[key]
+	if !ok {
+		return nil
+	}
+	b := e.Value.(*cachedBlock)
+	l.lru.Remove(e)
+	delete(l.blocks, key)
+	l.size -= int64(b.size)
+	return b
+}
+
+// BlockCache defines the struct of the block cache.
+type BlockCache struct {
+	sync.Mutex
+	mem  *blockLRU
+	disk *blockLRU // nil if the blocks are not kept on disk
+	dir  string
+
+	// the blocks of each inode in memory or on disk
+	inodes map[uint64]map[int]struct{}
+	// increased on each invalidation, so that the blocks read before it are not cached
+	version uint64
+}
+
+// NewBlockCache returns a new block cache of the policy. The blocks on disk are kept in dir, which
+// is emptied first since the generations of the blocks left by the last mount are unknown.
+func NewBlockCache(policy string, memSize, diskSize int64, dir string) (bc *BlockCache, err error) {
+	if memSize <= 0 {
+		memSize = DefaultBlockCacheSize
+	}
+	bc = &BlockCache{
+		mem:    newBlockLRU(memSize),
+		inodes: make(map[uint64]map[int]struct{}),
+	}
+	switch policy {
+	case BlockCachePolicyMemory:
+	case BlockCachePolicyDisk:
+		if dir == "" {
+			return nil, fmt.Errorf("no directory for the block cache on disk")
+		}
+		if diskSize <= 0 {
+			diskSize = DefaultBlockCacheDiskSize
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		bc.disk = newBlockLRU(diskSize)
+		bc.dir = dir
+	default:
+		return nil, fmt.Errorf("unknown block cache policy %v", policy)
+	}
+	log.LogInfof("NewBlockCache: policy(%v) memSize(%v) diskSize(%v) dir(%v)", policy, memSize, diskSize, dir)
+	return
+}
+
+func (bc *BlockCache) blockPath(key blockKey) string {
+	return path.Join(bc.dir, fmt.Sprintf("%v_%v", key.inode, key.index))
+}
+
+// Get returns the block of the inode at the generation, or nil with the version to put the block
+// read from the datanodes.
+func (bc *BlockCache) Get(inode, gen uint64, index int) (data []byte, version uint64) {
+	key := blockKey{inode: inode, index: index}
+	bc.Lock()
+	b := bc.mem.get(key)
+	if b != nil && b.gen == gen {
+		data = b.data
+		bc.Unlock()
+		exporter.NewCounter(BlockCacheHit).Add(1)
+		return
+	}
+	if b != nil {
+		// the file is changed, and so are its other blocks
+		bc.invalidate(inode)
+	} else if bc.disk != nil {
+		b = bc.disk.get(key)
+		if b != nil && b.gen != gen {
+			bc.invalidate(inode)
+			b = nil
+		}
+	}
+	version = bc.version
+	bc.Unlock()
+
+	if b != nil {
+		if data = bc.readDisk(key, b.size); data != nil {
+			exporter.NewCounter(BlockCacheDiskHit).Add(1)
+			bc.Put(inode, gen, version, index, data)
+			return
+		}
+	}
+	exporter.NewCounter(BlockCacheMiss).Add(1)
+	return nil, version
+}
+
+// Put caches the block, unless the cache is invalidated after the version is returned by Get.
+func (bc *BlockCache) Put(inode, gen, version uint64, index int, data []byte) {
+	bc.Lock()
+	if bc.version != version {
+		bc.Unlock()
+		return
+	}
+	b := &cachedBlock{key: blockKey{inode: inode, index: index}, gen: gen, data: data, size: len(data)}
+	evicted := bc.mem.put(b)
+	bc.addBlock(b.key)
+	var demoted, dropped []*cachedBlock
+	for _, victim := range evicted {
+		if victim.key == b.key {
+			continue
+		}
+		if bc.disk == nil {
+			bc.removeBlock(victim.key)
+			continue
+		}
+		demoted = append(demoted, victim)
+		for _, d := range bc.disk.put(&cachedBlock{key: victim.key, gen: victim.gen, size: victim.size}) {
+			if d.key == victim.key {
+				// the file is overwritten with the demoted block
+				continue
+			}
+			bc.removeBlock(d.key)
+			dropped = append(dropped, d)
+		}
+	}
+	version = bc.version
+	bc.Unlock()
+
+	for _, d := range dropped {
+		os.Remove(bc.blockPath(d.key))
+	}
+	for _, victim := range demoted {
+		bc.writeDisk(victim, version)
+	}
+}
+
+// Invalidate drops the blocks of the inode.
+func (bc *BlockCache) Invalidate(inode uint64) {
+	bc.Lock()
+	defer bc.Unlock()
+	bc.invalidate(inode)
+}
+
+func (bc *BlockCache) invalidate(inode uint64) {
+	bc.version++
+	for index := range bc.inodes[inode] {
+		key := blockKey{inode: inode, index: index}
+		bc.mem.remove(key)
+		if bc.disk != nil && bc.disk.remove(key) != nil {
+			os.Remove(bc.blockPath(key))
+		}
+	}
+	delete(bc.inodes, inode)
+}
+
+func (bc *BlockCache) addBlock(key blockKey) {
+	indexes, ok := bc.inodes[key.inode]
+	if !ok {
+		indexes = make(map[int]struct{})
+		bc.inodes[key.inode] = indexes
+	}
+	indexes[key.index] = struct{}{}
+}
+
+func (bc *BlockCache) removeBlock(key blockKey) {
+	indexes := bc.inodes[key.inode]
+	delete(indexes, key.index)
+	if len(indexes) == 0 {
+		delete(bc.inodes, key.inode)
+	}
+}
+
+func (bc *BlockCache) readDisk(key blockKey, size int) []byte {
+	data, err := ioutil.ReadFile(bc.blockPath(key))
+	if err != nil || len(data) != size {
+		log.LogDebugf("BlockCache readDisk: ino(%v) index(%v) size(%v) err(%v)", key.inode, key.index, size, err)
+		return nil
+	}
+	return data
+}
+
+// writeDisk writes the block demoted to disk. The block is dropped if the cache is invalidated
+// meanwhile, since it may be dropped from the index before the file is written.
+func (bc *BlockCache) writeDisk(b *cachedBlock, version uint64) {
+	if err := ioutil.WriteFile(bc.blockPath(b.key), b.data, 0600); err != nil {
+		log.LogWarnf("BlockCache writeDisk: ino(%v) index(%v) err(%v)", b.key.inode, b.key.index, err)
+		bc.Lock()
+		if bc.disk.remove(b.key) != nil {
+			bc.removeBlock(b.key)
+		}
+		bc.Unlock()
+		return
+	}
+	bc.Lock()
+	if bc.version != version {
+		if bc.disk.remove(b.key) != nil {
+			bc.removeBlock(b.key)
+		}
+		os.Remove(bc.blockPath(b.key))
+	}
+	bc.Unlock()
+}
@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+// A client overwrites a file in place, while another one has cached the blocks of the file.
+func TestBlockCacheOverwriteByOtherClient(t *testing.T) {
+	vol, err := mocktest.NewMockVolume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vol.Close()
+	writer, err := meta.NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := meta.NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := writer.Create_ll(proto.RootIno, "file", proto.Mode(0644), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ino := info.Inode
+	ek := proto.ExtentKey{PartitionId: 1, ExtentId: 1, Size: BlockCacheBlockSize}
+	if err = writer.AppendExtentKey(ino, ek); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reader opens the file, and caches the first block
+	cache, err := NewBlockCache(BlockCachePolicyMemory, 0, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extents := NewExtentCache(ino)
+	open := func() uint64 {
+		if err := extents.Refresh(ino, reader.GetExtents); err != nil {
+			t.Fatal(err)
+		}
+		_, gen := extents.Size()
+		return gen
+	}
+	gen := open()
+	old := bytes.Repeat([]byte{'a'}, BlockCacheBlockSize)
+	_, version := cache.Get(ino, gen, 0)
+	cache.Put(ino, gen, version, 0, old)
+
+	// the blocks survive the reopen as long as the file is not changed
+	gen = open()
+	if data, _ := cache.Get(ino, gen, 0); !bytes.Equal(data, old) {
+		t.Fatalf("expect the block to be cached at generation %v", gen)
+	}
+
+	// the writer overwrites the block in place, which changes neither the extent keys nor the size,
+	// and records the overwrite on flush
+	s := &Streamer{client: &ExtentClient{overwriteExtents: writer.OverwriteExtents}, inode: ino}
+	if err = s.recordOverwrite(); err != nil {
+		t.Fatal(err)
+	}
+	if newGen := open(); newGen != gen {
+		t.Fatalf("expect no overwrite to be recorded, generation %v -> %v", gen, newGen)
+	}
+	s.overwritten = true
+	if err = s.recordOverwrite(); err != nil {
+		t.Fatal(err)
+	}
+	if s.overwritten {
+		t.Fatalf("expect the overwrite to be recorded once")
+	}
+
+	// the reader drops the stale block on the next open
+	newGen := open()
+	if newGen == gen {
+		t.Fatalf("expect the generation %v to be bumped by the overwrite", gen)
+	}
+	if data, _ := cache.Get(ino, newGen, 0); data != nil {
+		t.Fatalf("expect the block cached before the overwrite to be dropped")
+	}
+}
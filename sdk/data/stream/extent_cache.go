@@ -115,6 +115,19 @@ func (cache *ExtentCache) Append(ek *proto.ExtentKey, sync bool) {
 	cache.Lock()
 	defer cache.Unlock()
 
+	// The last extent before the file offset may overlap with the current extent,
+	// which happens if the data is overwritten by appending to a new extent.
+	cache.root.DescendLessOrEqual(lower, func(i btree.Item) bool {
+		found := i.(*proto.ExtentKey)
+		if found.FileOffset >= ek.FileOffset {
+			return true
+		}
+		if found.FileOffset+uint64(found.Size) > ek.FileOffset {
+			discard = append(discard, found)
+		}
+		return false
+	})
+
 	// When doing the append, we do not care about the data after the file offset.
 	// Those data will be overwritten by the current extent anyway.
 	cache.root.AscendRange(lower, upper, func(i btree.Item) bool {
@@ -123,9 +136,12 @@ func (cache *ExtentCache) Append(ek *proto.ExtentKey, sync bool) {
 		return true
 	})
 
-	// After deleting the data between lower and upper, we will do the append
+	// After trimming the data between lower and upper, we will do the append
 	for _, key := range discard {
 		cache.root.Delete(key)
+		for _, part := range key.Trim(ek.FileOffset, ekEnd) {
+			cache.root.ReplaceOrInsert(part)
+		}
 	}
 
 	cache.root.ReplaceOrInsert(ek)
@@ -17,12 +17,14 @@ package stream
 import (
 	"fmt"
 	"golang.org/x/time/rate"
+	"net"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/data/wrapper"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -31,6 +33,8 @@ import (
 type AppendExtentKeyFunc func(inode uint64, key proto.ExtentKey) error
 type GetExtentsFunc func(inode uint64) (uint64, uint64, []proto.ExtentKey, error)
 type TruncateFunc func(inode, size uint64) error
+type OverwriteExtentsFunc func(inode uint64) error
+type CheckQuotaFunc func(inode uint64) error
 
 const (
 	MaxMountRetryLimit = 5
@@ -44,7 +48,6 @@ const (
 )
 
 var (
-	gDataWrapper       *wrapper.Wrapper
 	openRequestPool    *sync.Pool
 	writeRequestPool   *sync.Pool
 	flushRequestPool   *sync.Pool
@@ -58,23 +61,38 @@ type ExtentClient struct {
 	streamers    map[uint64]*Streamer
 	streamerLock sync.Mutex
 
+	// the data partitions of the volume, so that the clients of several volumes may live in a process
+	dataWrapper *wrapper.Wrapper
+
 	readLimiter  *rate.Limiter
 	writeLimiter *rate.Limiter
 
-	appendExtentKey AppendExtentKeyFunc
-	getExtents      GetExtentsFunc
-	truncate        TruncateFunc
-	followerRead    bool
+	appendExtentKey  AppendExtentKeyFunc
+	getExtents       GetExtentsFunc
+	truncate         TruncateFunc
+	overwriteExtents OverwriteExtentsFunc
+	checkQuota       CheckQuotaFunc
+	followerRead     bool
+
+	blockCache *BlockCache // nil if the reads are not cached
 }
 
-// NewExtentClient returns a new extent client.
-func NewExtentClient(volname, master string, readRate, writeRate int64, appendExtentKey AppendExtentKeyFunc, getExtents GetExtentsFunc, truncate TruncateFunc) (client *ExtentClient, err error) {
+// NewExtentClient returns a new extent client. If authenticator is not nil, the connections to the
+// datanodes are authenticated with its tickets. The in-place overwrites of a file are recorded with
+// overwriteExtents on flush. If checkQuota is not nil, it is called before each write, and the write
+// fails with its error.
+func NewExtentClient(volname, master string, authenticator *auth.Authenticator, readRate, writeRate int64, appendExtentKey AppendExtentKeyFunc, getExtents GetExtentsFunc, truncate TruncateFunc, overwriteExtents OverwriteExtentsFunc, checkQuota CheckQuotaFunc) (client *ExtentClient, err error) {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	client = new(ExtentClient)
+	if authenticator != nil {
+		StreamConnPool.SetHandshake(func(c *net.TCPConn) error {
+			return authenticator.Handshake(proto.DataServiceID, c)
+		})
+	}
 
 	limit := MaxMountRetryLimit
 retry:
-	gDataWrapper, err = wrapper.NewDataPartitionWrapper(volname, master)
+	client.dataWrapper, err = wrapper.NewDataPartitionWrapper(volname, master, authenticator)
 	if err != nil {
 		if limit <= 0 {
 			return nil, errors.Trace(err, "Init data wrapper failed!")
@@ -89,7 +107,9 @@ retry:
 	client.appendExtentKey = appendExtentKey
 	client.getExtents = getExtents
 	client.truncate = truncate
-	client.followerRead = gDataWrapper.FollowerRead()
+	client.overwriteExtents = overwriteExtents
+	client.checkQuota = checkQuota
+	client.followerRead = client.dataWrapper.FollowerRead()
 
 	// Init request pools
 	openRequestPool = &sync.Pool{New: func() interface{} {
@@ -129,6 +149,11 @@ retry:
 	return
 }
 
+// SetBlockCache caches the reads in the block cache. It shall be called before any stream is opened.
+func (client *ExtentClient) SetBlockCache(cache *BlockCache) {
+	client.blockCache = cache
+}
+
 // Open request shall grab the lock until request is sent to the request channel
 func (client *ExtentClient) OpenStream(inode uint64) error {
 	client.streamerLock.Lock()
@@ -137,7 +162,15 @@ func (client *ExtentClient) OpenStream(inode uint64) error {
 		s = NewStreamer(client, inode)
 		client.streamers[inode] = s
 	}
-	return s.IssueOpenRequest()
+	if err := s.IssueOpenRequest(); err != nil {
+		return err
+	}
+	if client.blockCache != nil {
+		// the extents are refreshed on each open, so that the blocks cached before are dropped
+		// if the file is changed by the other clients
+		return s.GetExtents()
+	}
+	return nil
 }
 
 // Release request shall grab the lock until request is sent to the request channel
@@ -163,6 +196,9 @@ func (client *ExtentClient) EvictStream(inode uint64) error {
 	if err != nil {
 		return err
 	}
+	if client.blockCache != nil {
+		client.blockCache.Invalidate(inode)
+	}
 
 	s.done <- struct{}{}
 	return nil
@@ -206,12 +242,21 @@ func (client *ExtentClient) Write(inode uint64, offset int, data []byte, direct
 		return 0, fmt.Errorf("Prefix(%v): stream is not opened yet", prefix)
 	}
 
+	if client.checkQuota != nil {
+		if err = client.checkQuota(inode); err != nil {
+			return
+		}
+	}
+
 	s.once.Do(func() {
 		// TODO unhandled error
 		s.GetExtents()
 	})
 
 	write, err = s.IssueWriteRequest(offset, data, direct)
+	if client.blockCache != nil {
+		client.blockCache.Invalidate(inode)
+	}
 	if err != nil {
 		err = errors.Trace(err, prefix)
 		log.LogError(errors.Stack(err))
@@ -228,6 +273,9 @@ func (client *ExtentClient) Truncate(inode uint64, size int) error {
 	}
 
 	err := s.IssueTruncRequest(size)
+	if client.blockCache != nil {
+		client.blockCache.Invalidate(inode)
+	}
 	if err != nil {
 		err = errors.Trace(err, prefix)
 		log.LogError(errors.Stack(err))
@@ -263,6 +311,10 @@ func (client *ExtentClient) Read(inode uint64, data []byte, offset int, size int
 		return
 	}
 
+	if client.blockCache != nil {
+		read, err = s.cachedRead(data, offset, size)
+		return
+	}
 	read, err = s.read(data, offset, size)
 	return
 }
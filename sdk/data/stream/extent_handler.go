@@ -485,7 +485,7 @@ func (eh *ExtentHandler) allocateExtent() (err error) {
 	exclude := make(map[string]struct{})
 
 	for i := 0; i < MaxSelectDataPartitionForWrite; i++ {
-		if dp, err = gDataWrapper.GetDataPartitionForWrite(exclude); err != nil {
+		if dp, err = eh.stream.client.dataWrapper.GetDataPartitionForWrite(exclude); err != nil {
 			log.LogWarnf("allocateExtent: failed to get write data partition, eh(%v) exclude(%v)", eh, exclude)
 			continue
 		}
@@ -51,6 +51,9 @@ func (reader *ExtentReader) String() (m string) {
 
 // Read reads the extent request.
 func (reader *ExtentReader) Read(req *ExtentRequest) (readBytes int, err error) {
+	if reader.dp.IsEc() {
+		return reader.readEc(req)
+	}
 	offset := req.FileOffset - int(reader.key.FileOffset) + int(reader.key.ExtentOffset)
 	size := req.Size
 
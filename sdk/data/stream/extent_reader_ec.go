@@ -0,0 +1,114 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package stream
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/ec"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// readEc reads the extent of an erasure-coded data partition. The i-th host keeps the i-th unit of
+// each stripe, and a unit is reconstructed from any DataNum shards of its stripe if its host fails.
+func (reader *ExtentReader) readEc(req *ExtentRequest) (readBytes int, err error) {
+	dataNum := int(reader.dp.EcDataNum)
+	hosts := reader.dp.EcHosts()
+	if len(hosts) == 0 {
+		err = errors.New(fmt.Sprintf("readEc: not enough hosts, dp(%v)", reader.dp))
+		return
+	}
+	offset := uint64(req.FileOffset - int(reader.key.FileOffset) + int(reader.key.ExtentOffset))
+	units := ec.Locate(offset, uint64(req.Size), dataNum)
+
+	log.LogDebugf("ExtentReader readEc enter: req(%v) units(%v)", req, len(units))
+
+	for _, unit := range units {
+		buf := req.Data[readBytes : readBytes+int(unit.Size)]
+		if err = reader.readShard(hosts[unit.Index], unit.ShardOffset, buf); err != nil {
+			log.LogWarnf("readEc: failed to read unit, ino(%v) dp(%v) host(%v) unit(%+v) err(%v), try degraded read",
+				reader.inode, reader.dp.PartitionID, hosts[unit.Index], unit, err)
+			if err = reader.degradedRead(hosts, unit, buf); err != nil {
+				log.LogErrorf("readEc: err(%v) req(%v)", err, req)
+				return
+			}
+		}
+		readBytes += int(unit.Size)
+	}
+
+	log.LogDebugf("ExtentReader readEc exit: req(%v) readBytes(%v)", req, readBytes)
+	return
+}
+
+// degradedRead reconstructs the range of the unit from the same range of the other shards.
+func (reader *ExtentReader) degradedRead(hosts []string, unit ec.Unit, buf []byte) (err error) {
+	encoder, err := ec.NewEncoder(int(reader.dp.EcDataNum), int(reader.dp.EcParityNum))
+	if err != nil {
+		return
+	}
+	shards := make([][]byte, len(hosts))
+	got := 0
+	for i, host := range hosts {
+		if i == unit.Index || got == encoder.DataNum() {
+			continue
+		}
+		shard := make([]byte, unit.Size)
+		if e := reader.readShard(host, unit.ShardOffset, shard); e != nil {
+			log.LogWarnf("degradedRead: failed to read shard(%v), dp(%v) host(%v) err(%v)", i, reader.dp.PartitionID, host, e)
+			continue
+		}
+		shards[i] = shard
+		got++
+	}
+	if err = encoder.Reconstruct(shards); err != nil {
+		return errors.New(fmt.Sprintf("degradedRead: dp(%v) extent(%v) unit(%+v) err(%v)",
+			reader.dp.PartitionID, reader.key.ExtentId, unit, err))
+	}
+	copy(buf, shards[unit.Index])
+	return
+}
+
+// readShard reads the range of the shard kept by the given host.
+func (reader *ExtentReader) readShard(addr string, shardOffset uint64, buf []byte) (err error) {
+	conn, err := StreamConnPool.GetConnect(addr)
+	if err != nil {
+		return
+	}
+	defer func() {
+		StreamConnPool.PutConnect(conn, err != nil)
+	}()
+
+	reqPacket := NewReadPacket(reader.key, int(shardOffset), len(buf), reader.inode, 0, true)
+	if err = reqPacket.WriteToConn(conn); err != nil {
+		return
+	}
+	readBytes := 0
+	for readBytes < len(buf) {
+		replyPacket := NewReply(reqPacket.ReqID, reader.dp.PartitionID, reqPacket.ExtentID)
+		bufSize := util.Min(util.ReadBlockSize, len(buf)-readBytes)
+		replyPacket.Data = buf[readBytes : readBytes+bufSize]
+		if err = replyPacket.readFromConn(conn, proto.ReadDeadlineTime); err != nil {
+			return
+		}
+		if err = reader.checkStreamReply(reqPacket, replyPacket); err != nil {
+			return
+		}
+		readBytes += int(replyPacket.Size)
+	}
+	return
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -44,6 +45,8 @@ type Streamer struct {
 	dirtylist *DirtyExtentList // dirty handlers
 	dirty     bool             // whether current open handler is in the dirty list
 
+	overwritten bool // whether the extents are overwritten in place since the last flush
+
 	request chan interface{} // request channel, write/flush/close
 	done    chan struct{}    // stream writer is being closed
 
@@ -76,7 +79,7 @@ func (s *Streamer) GetExtents() error {
 // GetExtentReader returns the extent reader.
 // TODO: use memory pool
 func (s *Streamer) GetExtentReader(ek *proto.ExtentKey) (*ExtentReader, error) {
-	partition, err := gDataWrapper.GetDataPartition(ek.PartitionId)
+	partition, err := s.client.dataWrapper.GetDataPartition(ek.PartitionId)
 	if err != nil {
 		return nil, err
 	}
@@ -158,3 +161,44 @@ func (s *Streamer) read(data []byte, offset int, size int) (total int, err error
 	}
 	return
 }
+
+// cachedRead reads the data through the block cache. On a miss, the whole block within the file size
+// is read from the datanodes, and it is cached unless the read is short.
+func (s *Streamer) cachedRead(data []byte, offset int, size int) (total int, err error) {
+	cache := s.client.blockCache
+	filesize, gen := s.extents.Size()
+	if offset >= filesize {
+		return 0, io.EOF
+	}
+	end := util.Min(offset+size, filesize)
+	for pos := offset; pos < end; {
+		index := pos / BlockCacheBlockSize
+		blockOffset := index * BlockCacheBlockSize
+		block, version := cache.Get(s.inode, gen, index)
+		if block == nil {
+			blockSize := util.Min(BlockCacheBlockSize, filesize-blockOffset)
+			block = make([]byte, blockSize)
+			var readBytes int
+			readBytes, err = s.read(block, blockOffset, blockSize)
+			if err != nil && err != io.EOF {
+				return
+			}
+			err = nil
+			block = block[:readBytes]
+			if readBytes == blockSize {
+				cache.Put(s.inode, gen, version, index, block)
+			}
+		}
+		if pos-blockOffset >= len(block) {
+			break
+		}
+		copied := copy(data[pos-offset:end-offset], block[pos-blockOffset:])
+		total += copied
+		pos += copied
+	}
+	if total < size {
+		err = io.EOF
+	}
+	log.LogDebugf("cachedRead: ino(%v) offset(%v) size(%v) filesize(%v) gen(%v) total(%v)", s.inode, offset, size, filesize, gen, total)
+	return
+}
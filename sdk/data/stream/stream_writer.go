@@ -244,7 +244,9 @@ func (s *Streamer) handleRequest(request interface{}) {
 		request.err = s.truncate(request.size)
 		request.done <- struct{}{}
 	case *FlushRequest:
-		request.err = s.flush()
+		if request.err = s.flush(); request.err == nil {
+			request.err = s.recordOverwrite()
+		}
 		request.done <- struct{}{}
 	case *ReleaseRequest:
 		request.err = s.release()
@@ -277,10 +279,14 @@ func (s *Streamer) write(data []byte, offset, size int, direct bool) (total int,
 		log.LogDebugf("Streamer write: ino(%v) prepared requests after flush(%v)", s.inode, requests)
 	}
 
+	// the extents may be referenced by the snapshots, so the data is written to new extents instead
+	copyOnWrite := s.client.dataWrapper.CopyOnWrite()
 	for _, req := range requests {
 		var writeSize int
-		if req.ExtentKey != nil {
+		// the erasure-coded extents are never overwritten in place
+		if req.ExtentKey != nil && !copyOnWrite && !s.isEcExtent(req.ExtentKey) {
 			writeSize, err = s.doOverwrite(req, direct)
+			s.overwritten = true
 		} else {
 			writeSize, err = s.doWrite(req.Data, req.FileOffset, req.Size, direct)
 		}
@@ -298,6 +304,11 @@ func (s *Streamer) write(data []byte, offset, size int, direct bool) (total int,
 	return
 }
 
+func (s *Streamer) isEcExtent(ek *proto.ExtentKey) bool {
+	dp, err := s.client.dataWrapper.GetDataPartition(ek.PartitionId)
+	return err == nil && dp.IsEc()
+}
+
 func (s *Streamer) doOverwrite(req *ExtentRequest, direct bool) (total int, err error) {
 	var dp *wrapper.DataPartition
 
@@ -319,7 +330,7 @@ func (s *Streamer) doOverwrite(req *ExtentRequest, direct bool) (total int, err
 		return
 	}
 
-	if dp, err = gDataWrapper.GetDataPartition(req.ExtentKey.PartitionId); err != nil {
+	if dp, err = s.client.dataWrapper.GetDataPartition(req.ExtentKey.PartitionId); err != nil {
 		// TODO unhandled error
 		errors.Trace(err, "doOverwrite: ino(%v) failed to get datapartition, ek(%v)", s.inode, req.ExtentKey)
 		return
@@ -448,6 +459,21 @@ func (s *Streamer) flush() (err error) {
 	return
 }
 
+// Records the in-place overwrites on the metanode, which bumps the generation of the inode, so that the other
+// clients drop the blocks cached before on the next open. The overwrites change neither the extent keys nor
+// the size, which is otherwise unknown to the other clients.
+func (s *Streamer) recordOverwrite() (err error) {
+	if !s.overwritten {
+		return
+	}
+	if err = s.client.overwriteExtents(s.inode); err != nil {
+		log.LogErrorf("recordOverwrite: ino(%v) err(%v)", s.inode, err)
+		return
+	}
+	s.overwritten = false
+	return
+}
+
 func (s *Streamer) traverse() (err error) {
 	s.traversed++
 	length := s.dirtylist.Len()
@@ -516,6 +542,8 @@ func (s *Streamer) release() error {
 	err := s.flush()
 	if err != nil {
 		s.abort()
+	} else {
+		err = s.recordOverwrite()
 	}
 	log.LogDebugf("release: streamer(%v) refcnt(%v)", s, s.refcnt)
 	return err
@@ -556,6 +584,8 @@ func (s *Streamer) truncate(size int) error {
 	if err != nil {
 		return err
 	}
+	// the generation is bumped by the truncation too
+	s.overwritten = false
 
 	oldsize, _ := s.extents.Size()
 	if oldsize <= size {
@@ -83,6 +83,21 @@ func (dp *DataPartition) CheckAllHostsIsAvail(exclude map[string]struct{}) {
 
 }
 
+// IsEc returns true if the data partition is erasure-coded.
+func (dp *DataPartition) IsEc() bool {
+	return dp.EcDataNum > 0
+}
+
+// EcHosts returns the hosts of the shards of the erasure-coded data partition in order. The hosts
+// added for the decommission are excluded.
+func (dp *DataPartition) EcHosts() []string {
+	shardNum := int(dp.EcDataNum) + int(dp.EcParityNum)
+	if len(dp.Hosts) < shardNum {
+		return nil
+	}
+	return dp.Hosts[:shardNum]
+}
+
 // GetAllAddrs returns the addresses of all the replicas of the data partition.
 func (dp *DataPartition) GetAllAddrs() string {
 	return strings.Join(dp.Hosts[1:], proto.AddrSplit) + proto.AddrSplit
@@ -27,6 +27,7 @@ import (
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/log"
 )
 
@@ -53,16 +54,23 @@ type Wrapper struct {
 	rwPartition           []*DataPartition
 	localLeaderPartitions []*DataPartition
 	followerRead          bool
+	copyOnWrite           bool
 }
 
-// NewDataPartitionWrapper returns a new data partition wrapper.
-func NewDataPartitionWrapper(volName, masterHosts string) (w *Wrapper, err error) {
+// NewDataPartitionWrapper returns a new data partition wrapper. If authenticator is not nil,
+// the requests to the master carry its tokens.
+func NewDataPartitionWrapper(volName, masterHosts string, authenticator *auth.Authenticator) (w *Wrapper, err error) {
 	masters := strings.Split(masterHosts, ",")
 	w = new(Wrapper)
 	w.masters = masters
 	for _, m := range w.masters {
 		MasterHelper.AddNode(m)
 	}
+	if authenticator != nil {
+		MasterHelper.SetTokenFunc(func() (string, error) {
+			return authenticator.Token(proto.MasterServiceID)
+		})
+	}
 	w.volName = volName
 	w.rwPartition = make([]*DataPartition, 0)
 	w.partitions = make(map[uint64]*DataPartition)
@@ -86,6 +94,14 @@ func (w *Wrapper) FollowerRead() bool {
 	return w.followerRead
 }
 
+// CopyOnWrite returns true if the volume has snapshots, in which case the extents must not be
+// overwritten in place. It is refreshed along with the data partitions.
+func (w *Wrapper) CopyOnWrite() bool {
+	w.RLock()
+	defer w.RUnlock()
+	return w.copyOnWrite
+}
+
 func (w *Wrapper) updateClusterInfo() error {
 	body, err := MasterHelper.Request(http.MethodPost, proto.AdminGetIP, nil, nil)
 	if err != nil {
@@ -119,6 +135,9 @@ func (w *Wrapper) getSimpleVolView() error {
 		return err
 	}
 	w.followerRead = view.FollowerRead
+	w.Lock()
+	w.copyOnWrite = view.CopyOnWrite
+	w.Unlock()
 	log.LogInfof("SimpleVolView: %v", *view)
 	return nil
 }
@@ -128,6 +147,7 @@ func (w *Wrapper) update() {
 	for {
 		select {
 		case <-ticker.C:
+			w.getSimpleVolView()
 			w.updateDataPartition()
 		}
 	}
@@ -153,7 +173,8 @@ func (w *Wrapper) updateDataPartition() error {
 	for _, dp := range view.DataPartitions {
 		log.LogInfof("updateDataPartition: dp(%v)", dp)
 		w.replaceOrInsertPartition(dp)
-		if dp.Status == proto.ReadWrite {
+		// the erasure-coded and cold partitions only keep the extents converted or migrated from the others
+		if dp.Status == proto.ReadWrite && !dp.IsEc() && !dp.Cold {
 			rwPartitionGroups = append(rwPartitionGroups, dp)
 			if strings.Split(dp.Hosts[0], ":")[0] == LocalIP {
 				localLeaderPartitionGroups = append(localLeaderPartitionGroups, dp)
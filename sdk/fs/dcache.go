@@ -0,0 +1,85 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"sync"
+	"time"
+)
+
+// the maximum number of the dentries cached, which are all dropped once exceeded
+const maxCachedDentries = 1 << 20
+
+type dentryKey struct {
+	parentID uint64
+	name     string
+}
+
+type dentryValue struct {
+	ino    uint64
+	mode   uint32
+	expire time.Time
+}
+
+// dentryCache caches the dentries looked up to resolve the paths. The dentries changed through the same FS are
+// updated at once, and the ones changed by the other clients are seen once they expire.
+type dentryCache struct {
+	sync.Mutex
+	timeout time.Duration
+	cache   map[dentryKey]*dentryValue
+}
+
+func newDentryCache(timeout time.Duration) *dentryCache {
+	return &dentryCache{
+		timeout: timeout,
+		cache:   make(map[dentryKey]*dentryValue),
+	}
+}
+
+func (dc *dentryCache) get(parentID uint64, name string) (ino uint64, mode uint32, ok bool) {
+	if dc.timeout <= 0 {
+		return
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	key := dentryKey{parentID: parentID, name: name}
+	value, ok := dc.cache[key]
+	if !ok {
+		return
+	}
+	if value.expire.Before(time.Now()) {
+		delete(dc.cache, key)
+		return 0, 0, false
+	}
+	return value.ino, value.mode, true
+}
+
+func (dc *dentryCache) put(parentID uint64, name string, ino uint64, mode uint32) {
+	if dc.timeout <= 0 {
+		return
+	}
+	dc.Lock()
+	defer dc.Unlock()
+	if len(dc.cache) >= maxCachedDentries {
+		dc.cache = make(map[dentryKey]*dentryValue)
+	}
+	dc.cache[dentryKey{parentID: parentID, name: name}] = &dentryValue{ino: ino, mode: mode, expire: time.Now().Add(dc.timeout)}
+}
+
+func (dc *dentryCache) delete(parentID uint64, name string) {
+	dc.Lock()
+	defer dc.Unlock()
+	delete(dc.cache, dentryKey{parentID: parentID, name: name})
+}
@@ -0,0 +1,310 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+var errWriteAtInAppendMode = errors.New("invalid use of WriteAt on file opened with O_APPEND")
+
+// File defines a file or a directory opened, which implements io.Reader, io.Writer, io.Seeker, io.ReaderAt,
+// io.WriterAt and io.Closer. It is safe for the concurrent use.
+type File struct {
+	fs   *FS
+	name string
+	ino  uint64
+	mode uint32
+	flag int
+
+	mu      sync.Mutex
+	offset  int64
+	closed  bool
+	dirents []os.FileInfo // the children of the directory to be read by Readdir
+	listed  bool
+}
+
+// Name returns the path of the file as opened.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Read reads up to len(p) bytes from the offset of the file, and advances it.
+func (f *File) Read(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n, err = f.readAt(p, f.offset); n > 0 && err == io.EOF {
+		err = nil
+	}
+	f.offset += int64(n)
+	return
+}
+
+// ReadAt reads len(p) bytes from the given offset of the file, and returns io.EOF if there are less.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+func (f *File) readAt(p []byte, off int64) (n int, err error) {
+	if err = f.check("read", os.O_RDONLY); err != nil {
+		return
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+	for n < len(p) {
+		read, err := f.fs.ec.Read(f.ino, p[n:], int(off)+n, len(p)-n)
+		n += read
+		if err != nil && err != io.EOF {
+			return n, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		if read == 0 || err == io.EOF {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// Write writes p to the offset of the file, or to the end of it if opened with O_APPEND, and advances the offset.
+func (f *File) Write(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.size()
+	}
+	n, err = f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return
+}
+
+// WriteAt writes p to the given offset of the file.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errWriteAtInAppendMode}
+	}
+	return f.writeAt(p, off)
+}
+
+// WriteString writes the string to the file like Write.
+func (f *File) WriteString(s string) (n int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) writeAt(p []byte, off int64) (n int, err error) {
+	if err = f.check("write", os.O_WRONLY); err != nil {
+		return
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EINVAL}
+	}
+	if len(p) == 0 {
+		return
+	}
+	if n, err = f.fs.ec.Write(f.ino, int(off), p, false); err != nil {
+		return n, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	if f.flag&os.O_SYNC != 0 {
+		if err = f.fs.ec.Flush(f.ino); err != nil {
+			return n, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+	return
+}
+
+// Seek sets the offset of the file for the next Read or Write, relative to the start of the file if whence is
+// io.SeekStart, to the current offset if io.SeekCurrent, and to the end if io.SeekEnd.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size()
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat returns the FileInfo of the file, whose size includes the data written but not flushed.
+func (f *File) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	info, err := f.fs.mw.InodeGet_ll(f.ino)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	if proto.IsRegular(f.mode) {
+		if size := f.size(); uint64(size) > info.Size {
+			info.Size = uint64(size)
+		}
+	}
+	return newFileInfo(baseName(f.name), info), nil
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("truncate", os.O_WRONLY); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	}
+	if err := f.fs.ec.Truncate(f.ino, int(size)); err != nil {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Sync flushes the data written to the data nodes.
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: os.ErrClosed}
+	}
+	if !proto.IsRegular(f.mode) {
+		return nil
+	}
+	if err := f.fs.ec.Flush(f.ino); err != nil {
+		return &os.PathError{Op: "sync", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Readdir reads the FileInfo of the children of the directory like os.File.Readdir. If n > 0, it returns at
+// most n children, and io.EOF at the end of the directory. Otherwise all the remaining children are returned.
+func (f *File) Readdir(n int) ([]os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: os.ErrClosed}
+	}
+	if !proto.IsDir(f.mode) {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if !f.listed {
+		dirents, err := f.fs.readDir(f.ino)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		f.dirents, f.listed = dirents, true
+	}
+	if n <= 0 {
+		dirents := f.dirents
+		f.dirents = nil
+		return dirents, nil
+	}
+	if len(f.dirents) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.dirents) {
+		n = len(f.dirents)
+	}
+	dirents := f.dirents[:n]
+	f.dirents = f.dirents[n:]
+	return dirents, nil
+}
+
+// Readdirnames reads the names of the children of the directory like Readdir.
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	dirents, err := f.Readdir(n)
+	for _, dirent := range dirents {
+		names = append(names, dirent.Name())
+	}
+	return
+}
+
+// Close flushes the data written, and closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	if !proto.IsRegular(f.mode) {
+		return nil
+	}
+	err := f.fs.ec.Flush(f.ino)
+	if e := f.fs.release(f.ino); err == nil {
+		err = e
+	}
+	if err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// Checks if the file is opened for the access, i.e. os.O_RDONLY for reading and os.O_WRONLY for writing.
+func (f *File) check(op string, access int) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if proto.IsDir(f.mode) {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	if !proto.IsRegular(f.mode) {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EINVAL}
+	}
+	var allowed bool
+	switch f.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		allowed = access == os.O_RDONLY
+	case os.O_WRONLY:
+		allowed = access == os.O_WRONLY
+	case os.O_RDWR:
+		allowed = true
+	}
+	if !allowed {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+// Returns the size of the file known by the stream, including the data written but not flushed.
+func (f *File) size() int64 {
+	if size, _, valid := f.fs.ec.FileSize(f.ino); valid {
+		return int64(size)
+	}
+	if info, err := f.fs.mw.InodeGet_ll(f.ino); err == nil {
+		return int64(info.Size)
+	}
+	return 0
+}
@@ -0,0 +1,625 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fs provides the access to a volume by the paths, without mounting it through FUSE. The API follows
+// the os package, e.g. the errors are *os.PathError, so that os.IsNotExist and the like work on them.
+//
+//	vol, err := fs.OpenVolume(&fs.Config{Volume: "ltptest", Owner: "ltptest", Masters: "10.196.30.200:80"})
+//	f, err := vol.Create("/dir/file")
+//	_, err = f.Write(data)
+//	err = f.Close()
+//
+// Symbolic links are not followed when the paths are resolved.
+package fs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/data/stream"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/util/auth"
+	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultDentryCacheTimeout = 5 * time.Second
+)
+
+// Config defines the configurations to open a volume.
+type Config struct {
+	Volume  string
+	Owner   string
+	Masters string // the addresses of the masters, separated by commas
+	// the authnodes, separated by commas, and the credentials of the client, if authnode is enabled
+	AuthNodes    string
+	ClientID     string
+	ClientKey    string
+	AuthCertFile string
+	ReadRate     int64 // the limit of the reads per second, unlimited if 0
+	WriteRate    int64 // the limit of the writes per second, unlimited if 0
+	// the time the dentries looked up are cached, which is DefaultDentryCacheTimeout if 0, and disabled if negative
+	DentryCacheTimeout time.Duration
+	// the owner of the files and the directories created
+	Uid uint32
+	Gid uint32
+}
+
+// FS defines a volume accessed by the paths, which is safe for the concurrent use.
+type FS struct {
+	volume string
+	uid    uint32
+	gid    uint32
+	mw     *meta.MetaWrapper
+	ec     *stream.ExtentClient
+	dcache *dentryCache
+
+	openMu  sync.Mutex
+	opened  map[uint64]int      // inode -> number of the files opened
+	orphans map[uint64]struct{} // the inodes removed while opened, evicted once closed
+}
+
+// OpenVolume returns the FS of the volume.
+func OpenVolume(cfg *Config) (fs *FS, err error) {
+	var authenticator *auth.Authenticator
+	if cfg.AuthNodes != "" {
+		authenticator, err = auth.NewAuthenticator(strings.Split(cfg.AuthNodes, ","), cfg.ClientID, cfg.ClientKey, cfg.AuthCertFile)
+		if err != nil {
+			return nil, errors.Trace(err, "NewAuthenticator failed!")
+		}
+	}
+	fs = &FS{
+		volume:  cfg.Volume,
+		uid:     cfg.Uid,
+		gid:     cfg.Gid,
+		opened:  make(map[uint64]int),
+		orphans: make(map[uint64]struct{}),
+	}
+	if fs.mw, err = meta.NewMetaWrapper(cfg.Volume, cfg.Owner, cfg.Masters, authenticator); err != nil {
+		return nil, errors.Trace(err, "NewMetaWrapper failed!")
+	}
+	fs.ec, err = stream.NewExtentClient(cfg.Volume, cfg.Masters, authenticator, cfg.ReadRate, cfg.WriteRate,
+		fs.mw.AppendExtentKey, fs.mw.GetExtents, fs.mw.Truncate, fs.mw.OverwriteExtents, fs.mw.CheckQuota)
+	if err != nil {
+		return nil, errors.Trace(err, "NewExtentClient failed!")
+	}
+	timeout := cfg.DentryCacheTimeout
+	if timeout == 0 {
+		timeout = DefaultDentryCacheTimeout
+	}
+	fs.dcache = newDentryCache(timeout)
+	return
+}
+
+// Statfs returns the capacity and the used size of the volume.
+func (fs *FS) Statfs() (total, used uint64) {
+	return fs.mw.Statfs()
+}
+
+// Stat returns the FileInfo of the file.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	ino, _, err := fs.lookupPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	info, err := fs.mw.InodeGet_ll(ino)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return newFileInfo(baseName(name), info), nil
+}
+
+// Mkdir creates a directory, and the parent must exist.
+func (fs *FS) Mkdir(name string, perm os.FileMode) error {
+	parentID, base, err := fs.lookupParent(name)
+	if err == nil {
+		_, err = fs.create(parentID, base, os.ModeDir|perm.Perm(), nil)
+	}
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// MkdirAll creates a directory along with the parents which do not exist.
+func (fs *FS) MkdirAll(name string, perm os.FileMode) error {
+	ino, mode := proto.RootIno, proto.Mode(os.ModeDir)
+	for _, part := range splitPath(name) {
+		if !proto.IsDir(mode) {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		childIno, childMode, err := fs.lookup(ino, part)
+		if err == syscall.ENOENT {
+			var info *proto.InodeInfo
+			if info, err = fs.create(ino, part, os.ModeDir|perm.Perm(), nil); err == nil {
+				childIno, childMode = info.Inode, info.Mode
+			} else if err == syscall.EEXIST {
+				// created by the others
+				childIno, childMode, err = fs.lookup(ino, part)
+			}
+		}
+		if err != nil {
+			return &os.PathError{Op: "mkdir", Path: name, Err: err}
+		}
+		ino, mode = childIno, childMode
+	}
+	if !proto.IsDir(mode) {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// Create creates or truncates the file, which is opened for reading and writing.
+func (fs *FS) Create(name string) (*File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens the file for reading.
+func (fs *FS) Open(name string) (*File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the file with the flags of os.OpenFile, i.e. O_RDONLY, O_WRONLY, O_RDWR, O_APPEND, O_CREATE,
+// O_EXCL, O_SYNC and O_TRUNC. The permission is used if the file is created.
+func (fs *FS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	f, err := fs.openFile(name, flag, perm)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (fs *FS) openFile(name string, flag int, perm os.FileMode) (f *File, err error) {
+	parentID, base, err := fs.lookupParent(name)
+	if err == syscall.EINVAL {
+		// the root
+		parentID, err = proto.RootIno, nil
+	}
+	if err != nil {
+		return
+	}
+	var (
+		ino  = proto.RootIno
+		mode = proto.Mode(os.ModeDir)
+	)
+	if base != "" {
+		ino, mode, err = fs.lookup(parentID, base)
+	}
+	switch {
+	case err == syscall.ENOENT && flag&os.O_CREATE != 0:
+		var info *proto.InodeInfo
+		if info, err = fs.create(parentID, base, perm.Perm(), nil); err == nil {
+			ino, mode = info.Inode, info.Mode
+			// truncating a new file is unnecessary
+			flag &^= os.O_TRUNC
+		} else if err == syscall.EEXIST && flag&os.O_EXCL == 0 {
+			ino, mode, err = fs.lookup(parentID, base)
+		}
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		err = syscall.EEXIST
+	}
+	if err != nil {
+		return
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if proto.IsDir(mode) && writable {
+		return nil, syscall.EISDIR
+	}
+	f = &File{fs: fs, name: name, ino: ino, mode: mode, flag: flag}
+	if !proto.IsRegular(mode) {
+		return
+	}
+	if err = fs.open(ino); err != nil {
+		return nil, err
+	}
+	if flag&os.O_TRUNC != 0 && writable {
+		if err = fs.ec.Truncate(ino, 0); err != nil {
+			fs.release(ino)
+			return nil, err
+		}
+	}
+	return
+}
+
+// Remove removes the file or the empty directory.
+func (fs *FS) Remove(name string) error {
+	parentID, base, err := fs.lookupParent(name)
+	if err == nil {
+		var mode uint32
+		if _, mode, err = fs.lookup(parentID, base); err == nil {
+			err = fs.remove(parentID, base, proto.IsDir(mode))
+		}
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// RemoveAll removes the file, or the directory and all its children. It returns nil if the path does not exist.
+func (fs *FS) RemoveAll(name string) error {
+	parentID, base, err := fs.lookupParent(name)
+	if err == nil {
+		var (
+			ino  uint64
+			mode uint32
+		)
+		if ino, mode, err = fs.lookup(parentID, base); err == nil {
+			err = fs.removeAll(parentID, base, ino, mode)
+		}
+	}
+	if err == syscall.ENOENT {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *FS) removeAll(parentID uint64, name string, ino uint64, mode uint32) error {
+	if proto.IsDir(mode) {
+		children, err := fs.mw.ReadDir_ll(ino)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err = fs.removeAll(ino, child.Name, child.Inode, child.Type); err != nil && err != syscall.ENOENT {
+				return err
+			}
+		}
+	}
+	return fs.remove(parentID, name, proto.IsDir(mode))
+}
+
+// Rename renames the file or the directory. The file of the new path is replaced if it exists.
+func (fs *FS) Rename(oldpath, newpath string) error {
+	err := fs.rename(oldpath, newpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+func (fs *FS) rename(oldpath, newpath string) (err error) {
+	srcParentID, srcName, err := fs.lookupParent(oldpath)
+	if err != nil {
+		return
+	}
+	dstParentID, dstName, err := fs.lookupParent(newpath)
+	if err != nil {
+		return
+	}
+	oldIno, _, lookupErr := fs.mw.Lookup_ll(dstParentID, dstName)
+	err = fs.mw.Rename_ll(srcParentID, srcName, dstParentID, dstName)
+	fs.dcache.delete(srcParentID, srcName)
+	fs.dcache.delete(dstParentID, dstName)
+	if err != nil {
+		return
+	}
+	// the replaced inode is unlinked by the rename
+	if lookupErr == nil {
+		if info, e := fs.mw.InodeGet_ll(oldIno); e == nil && info.Nlink == 0 {
+			fs.evict(oldIno)
+		}
+	}
+	return
+}
+
+// ReadDir returns the FileInfo of the children of the directory, sorted by the names.
+func (fs *FS) ReadDir(name string) ([]os.FileInfo, error) {
+	ino, mode, err := fs.lookupPath(name)
+	if err == nil && !proto.IsDir(mode) {
+		err = syscall.ENOTDIR
+	}
+	var infos []os.FileInfo
+	if err == nil {
+		infos, err = fs.readDir(ino)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return infos, nil
+}
+
+func (fs *FS) readDir(ino uint64) ([]os.FileInfo, error) {
+	children, err := fs.mw.ReadDir_ll(ino)
+	if err != nil {
+		return nil, err
+	}
+	inodes := make([]uint64, 0, len(children))
+	for _, child := range children {
+		inodes = append(inodes, child.Inode)
+	}
+	infoMap := make(map[uint64]*proto.InodeInfo, len(children))
+	for _, info := range fs.mw.BatchInodeGet(inodes) {
+		infoMap[info.Inode] = info
+	}
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		// the children removed during the listing are skipped
+		if info, ok := infoMap[child.Inode]; ok {
+			infos = append(infos, newFileInfo(child.Name, info))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// Walk walks the file tree rooted at root like filepath.Walk, calling walkFn for each file or directory in the
+// tree, including root, in lexical order.
+func (fs *FS) Walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := fs.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = fs.walk(root, info, walkFn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (fs *FS) walk(name string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(name, info, nil)
+	}
+	infos, err := fs.readDir(info.Sys().(*proto.InodeInfo).Inode)
+	err1 := walkFn(name, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, child := range infos {
+		err = fs.walk(path.Join(name, child.Name()), child, walkFn)
+		if err != nil && (!child.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chmod changes the permission of the file.
+func (fs *FS) Chmod(name string, mode os.FileMode) error {
+	err := fs.setattr(name, proto.AttrMode, mode, 0, 0)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Chown changes the owner of the file.
+func (fs *FS) Chown(name string, uid, gid uint32) error {
+	err := fs.setattr(name, proto.AttrUid|proto.AttrGid, 0, uid, gid)
+	if err != nil {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *FS) setattr(name string, valid uint32, mode os.FileMode, uid, gid uint32) error {
+	ino, curMode, err := fs.lookupPath(name)
+	if err != nil {
+		return err
+	}
+	// the type of the file is kept
+	newMode := curMode&^proto.Mode(os.ModePerm) | proto.Mode(mode.Perm())
+	// the volume is accessed as its owner, who is trusted with any change
+	return fs.mw.SetattrAsRoot(ino, valid, newMode, uid, gid)
+}
+
+// Truncate changes the size of the file.
+func (fs *FS) Truncate(name string, size int64) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (fs *FS) Symlink(oldname, newname string) error {
+	parentID, base, err := fs.lookupParent(newname)
+	if err == nil {
+		_, err = fs.create(parentID, base, os.ModeSymlink|os.ModePerm, []byte(oldname))
+	}
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the symbolic link.
+func (fs *FS) Readlink(name string) (string, error) {
+	ino, mode, err := fs.lookupPath(name)
+	if err == nil && !proto.IsSymlink(mode) {
+		err = syscall.EINVAL
+	}
+	var info *proto.InodeInfo
+	if err == nil {
+		info, err = fs.mw.InodeGet_ll(ino)
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return string(info.Target), nil
+}
+
+// Returns the inode and the mode of the path.
+func (fs *FS) lookupPath(name string) (ino uint64, mode uint32, err error) {
+	ino, mode = proto.RootIno, proto.Mode(os.ModeDir)
+	for _, part := range splitPath(name) {
+		if !proto.IsDir(mode) {
+			return 0, 0, syscall.ENOTDIR
+		}
+		if ino, mode, err = fs.lookup(ino, part); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Returns the parent directory and the name of the path, or EINVAL for the root.
+func (fs *FS) lookupParent(name string) (parentID uint64, base string, err error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return 0, "", syscall.EINVAL
+	}
+	parentID, mode, err := fs.lookupPath(strings.Join(parts[:len(parts)-1], "/"))
+	if err != nil {
+		return
+	}
+	if !proto.IsDir(mode) {
+		return 0, "", syscall.ENOTDIR
+	}
+	return parentID, parts[len(parts)-1], nil
+}
+
+func (fs *FS) lookup(parentID uint64, name string) (ino uint64, mode uint32, err error) {
+	if ino, mode, ok := fs.dcache.get(parentID, name); ok {
+		return ino, mode, nil
+	}
+	if ino, mode, err = fs.mw.Lookup_ll(parentID, name); err != nil {
+		return
+	}
+	fs.dcache.put(parentID, name, ino, mode)
+	return
+}
+
+func (fs *FS) create(parentID uint64, name string, mode os.FileMode, target []byte) (info *proto.InodeInfo, err error) {
+	if info, err = fs.mw.Create_ll(parentID, name, proto.Mode(mode), fs.uid, fs.gid, target); err != nil {
+		return
+	}
+	fs.dcache.put(parentID, name, info.Inode, info.Mode)
+	return
+}
+
+func (fs *FS) remove(parentID uint64, name string, isDir bool) error {
+	info, err := fs.mw.Delete_ll(parentID, name, isDir)
+	fs.dcache.delete(parentID, name)
+	if err != nil {
+		return err
+	}
+	if info != nil && info.Nlink == 0 && !isDir {
+		fs.evict(info.Inode)
+	}
+	return nil
+}
+
+// Opens the stream of a regular file.
+func (fs *FS) open(ino uint64) error {
+	fs.openMu.Lock()
+	defer fs.openMu.Unlock()
+	if err := fs.ec.OpenStream(ino); err != nil {
+		return err
+	}
+	fs.opened[ino]++
+	return nil
+}
+
+// Closes the stream of a regular file, and evicts the inode if it has been removed and is no longer opened.
+func (fs *FS) release(ino uint64) (err error) {
+	fs.openMu.Lock()
+	defer fs.openMu.Unlock()
+	err = fs.ec.CloseStream(ino)
+	if fs.opened[ino]--; fs.opened[ino] > 0 {
+		return
+	}
+	delete(fs.opened, ino)
+	if _, ok := fs.orphans[ino]; ok {
+		delete(fs.orphans, ino)
+		fs.evictInode(ino)
+	}
+	return
+}
+
+// Evicts the inode unlinked, unless it is opened.
+func (fs *FS) evict(ino uint64) {
+	fs.openMu.Lock()
+	defer fs.openMu.Unlock()
+	if fs.opened[ino] > 0 {
+		fs.orphans[ino] = struct{}{}
+		return
+	}
+	fs.evictInode(ino)
+}
+
+func (fs *FS) evictInode(ino uint64) {
+	if err := fs.mw.Evict(ino); err != nil {
+		log.LogWarnf("evict: vol(%v) ino(%v) err(%v)", fs.volume, ino, err)
+	}
+}
+
+// Returns the parts of the cleaned path.
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+func baseName(name string) string {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return "/"
+	}
+	return parts[len(parts)-1]
+}
+
+// fileInfo implements os.FileInfo, and Sys returns the *proto.InodeInfo.
+type fileInfo struct {
+	name string
+	info *proto.InodeInfo
+}
+
+func newFileInfo(name string, info *proto.InodeInfo) *fileInfo {
+	return &fileInfo{name: name, info: info}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return int64(fi.info.Size)
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	return proto.OsMode(fi.info.Mode)
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.info.ModifyTime
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return proto.IsDir(fi.info.Mode)
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.info
+}
@@ -0,0 +1,401 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+// Returns the FS of a mock volume without the data client, so that the regular files are not opened.
+func newTestFS(t *testing.T) (*mocktest.MockVolume, *FS) {
+	vol, err := mocktest.NewMockVolume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := meta.NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		vol.Close()
+		t.Fatal(err)
+	}
+	fs := &FS{
+		volume:  vol.Name,
+		uid:     1,
+		gid:     2,
+		mw:      mw,
+		dcache:  newDentryCache(DefaultDentryCacheTimeout),
+		opened:  make(map[uint64]int),
+		orphans: make(map[uint64]struct{}),
+	}
+	return vol, fs
+}
+
+func (fs *FS) createTestFile(t *testing.T, name string) uint64 {
+	parentID, base, err := fs.lookupParent(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.create(parentID, base, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Inode
+}
+
+func expectPathError(t *testing.T, err error, op, path string, errno syscall.Errno) {
+	t.Helper()
+	e, ok := err.(*os.PathError)
+	if !ok {
+		t.Fatalf("%v %v: expect *os.PathError, got %#v", op, path, err)
+	}
+	if e.Op != op || e.Path != path || e.Err != errno {
+		t.Fatalf("expect %v %v: %v, got %v", op, path, errno, err)
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		base  string
+	}{
+		{"", nil, "/"},
+		{"/", nil, "/"},
+		{".", nil, "/"},
+		{"..", nil, "/"},
+		{"a", []string{"a"}, "a"},
+		{"/a/b/", []string{"a", "b"}, "b"},
+		{"a//b/./c", []string{"a", "b", "c"}, "c"},
+		{"/a/../b", []string{"b"}, "b"},
+		{"/../../a", []string{"a"}, "a"},
+	}
+	for _, tt := range tests {
+		if parts := splitPath(tt.name); !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("splitPath(%q): expect %q, got %q", tt.name, tt.parts, parts)
+		}
+		if base := baseName(tt.name); base != tt.base {
+			t.Errorf("baseName(%q): expect %q, got %q", tt.name, tt.base, base)
+		}
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	ino := fs.createTestFile(t, "/a/b/file")
+
+	for _, name := range []string{"/a/b/file", "a/b/file", "/a/./b//file", "/a/b/../b/file", "/../a/b/file"} {
+		got, mode, err := fs.lookupPath(name)
+		if err != nil || got != ino || !proto.IsRegular(mode) {
+			t.Errorf("lookupPath(%q): expect %v, got %v %o %v", name, ino, got, mode, err)
+		}
+	}
+	if ino, mode, err := fs.lookupPath("/"); err != nil || ino != proto.RootIno || !proto.IsDir(mode) {
+		t.Fatalf("expect the root, got %v %o %v", ino, mode, err)
+	}
+	if _, _, err := fs.lookupPath("/a/c"); err != syscall.ENOENT {
+		t.Fatalf("expect ENOENT, got %v", err)
+	}
+	if _, _, err := fs.lookupPath("/a/b/file/c"); err != syscall.ENOTDIR {
+		t.Fatalf("expect ENOTDIR, got %v", err)
+	}
+
+	parentID, base, err := fs.lookupParent("/a/b/new")
+	if err != nil || base != "new" {
+		t.Fatalf("unexpected parent %v %v %v", parentID, base, err)
+	}
+	if _, _, err = fs.lookupParent("/"); err != syscall.EINVAL {
+		t.Fatalf("expect EINVAL for the parent of the root, got %v", err)
+	}
+	if _, _, err = fs.lookupParent("/a/b/file/new"); err != syscall.ENOTDIR {
+		t.Fatalf("expect ENOTDIR, got %v", err)
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.Mkdir("/a", 0700); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "a" || !info.IsDir() || info.Mode() != os.ModeDir|0700 {
+		t.Fatalf("unexpected directory %v %v", info.Name(), info.Mode())
+	}
+	if i := info.Sys().(*proto.InodeInfo); i.Uid != 1 || i.Gid != 2 {
+		t.Fatalf("expect the directory to be owned by the FS, got %v:%v", i.Uid, i.Gid)
+	}
+	err = fs.Mkdir("/a", 0700)
+	expectPathError(t, err, "mkdir", "/a", syscall.EEXIST)
+	if !os.IsExist(err) {
+		t.Fatalf("expect os.IsExist(%v)", err)
+	}
+	err = fs.Mkdir("/b/c", 0700)
+	expectPathError(t, err, "mkdir", "/b/c", syscall.ENOENT)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expect os.IsNotExist(%v)", err)
+	}
+
+	if err = fs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatalf("expect MkdirAll on an existing directory to succeed, got %v", err)
+	}
+	fs.createTestFile(t, "/a/file")
+	expectPathError(t, fs.MkdirAll("/a/file/d", 0755), "mkdir", "/a/file/d", syscall.ENOTDIR)
+	expectPathError(t, fs.MkdirAll("/a/file", 0755), "mkdir", "/a/file", syscall.ENOTDIR)
+}
+
+func TestRemove(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	ino := fs.createTestFile(t, "/a/b/file")
+
+	expectPathError(t, fs.Remove("/a"), "remove", "/a", syscall.ENOTEMPTY)
+	expectPathError(t, fs.Remove("/a/c"), "remove", "/a/c", syscall.ENOENT)
+	if err := fs.Remove("/a/b/file"); err != nil {
+		t.Fatal(err)
+	}
+	if vol.Inode(ino) != nil {
+		t.Fatalf("expect the inode %v removed to be evicted", ino)
+	}
+	if _, err := fs.Stat("/a/b/file"); !os.IsNotExist(err) {
+		t.Fatalf("expect the file to be removed, got %v", err)
+	}
+
+	fs.createTestFile(t, "/a/b/file")
+	if err := fs.RemoveAll("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a"); !os.IsNotExist(err) {
+		t.Fatalf("expect the directory to be removed, got %v", err)
+	}
+	if err := fs.RemoveAll("/a"); err != nil {
+		t.Fatalf("expect RemoveAll on a missing path to succeed, got %v", err)
+	}
+}
+
+// The files removed or replaced while opened are evicted once closed.
+func TestRemoveOpened(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	ino := fs.createTestFile(t, "/file")
+	fs.opened[ino] = 1
+	if err := fs.Remove("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if vol.Inode(ino) == nil {
+		t.Fatalf("expect the inode opened to be kept")
+	}
+	if _, ok := fs.orphans[ino]; !ok {
+		t.Fatalf("expect the inode opened to be evicted once closed")
+	}
+}
+
+func TestRename(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := fs.createTestFile(t, "/a/src")
+	dst := fs.createTestFile(t, "/a/b/dst")
+
+	// the looked up entries are cached
+	if _, err := fs.Stat("/a/b/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a/src", "/a/b/dst"); err != nil {
+		t.Fatalf("expect the rename to succeed, got %v", err)
+	}
+	if _, err := fs.Stat("/a/src"); !os.IsNotExist(err) {
+		t.Fatalf("expect the old path to be removed, got %v", err)
+	}
+	info, err := fs.Stat("/a/b/dst")
+	if err != nil || info.Sys().(*proto.InodeInfo).Inode != src {
+		t.Fatalf("expect the new path to be the renamed file %v, got %v %v", src, info, err)
+	}
+	if vol.Inode(dst) != nil {
+		t.Fatalf("expect the replaced inode %v to be evicted", dst)
+	}
+
+	if err = fs.Rename("/a/b", "/c"); err != nil {
+		t.Fatalf("expect the directory to be renamed, got %v", err)
+	}
+	if _, err = fs.Stat("/c/dst"); err != nil {
+		t.Fatalf("expect the children to be moved, got %v", err)
+	}
+
+	err = fs.Rename("/a/missing", "/a/new")
+	linkErr, ok := err.(*os.LinkError)
+	if !ok || linkErr.Op != "rename" || linkErr.Old != "/a/missing" || linkErr.New != "/a/new" || !os.IsNotExist(err) {
+		t.Fatalf("expect *os.LinkError of ENOENT, got %#v", err)
+	}
+	if err, ok := fs.Rename("/c/dst", "/a").(*os.LinkError); !ok || err.Err != syscall.EISDIR {
+		t.Fatalf("expect a file not to replace a directory, got %v", err)
+	}
+	if err, ok := fs.Rename("/c", "/a").(*os.LinkError); !ok || err.Err != syscall.EEXIST {
+		t.Fatalf("expect a directory not to replace a directory, got %v", err)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Symlink("/a/b", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	target, err := fs.Readlink("/link")
+	if err != nil || target != "/a/b" {
+		t.Fatalf("expect the target /a/b, got %v %v", target, err)
+	}
+	info, err := fs.Stat("/link")
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expect Stat not to follow the link, got %v %v", info, err)
+	}
+
+	// the links are not followed when the paths are resolved
+	expectPathError(t, fs.Mkdir("/link/c", 0755), "mkdir", "/link/c", syscall.ENOTDIR)
+	_, err = fs.ReadDir("/link")
+	expectPathError(t, err, "readdir", "/link", syscall.ENOTDIR)
+	_, err = fs.Readlink("/a")
+	expectPathError(t, err, "readlink", "/a", syscall.EINVAL)
+
+	err = fs.Symlink("/a", "/link")
+	linkErr, ok := err.(*os.LinkError)
+	if !ok || linkErr.Op != "symlink" || !os.IsExist(err) {
+		t.Fatalf("expect *os.LinkError of EEXIST, got %#v", err)
+	}
+}
+
+func TestReadDirAndWalk(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	fs.createTestFile(t, "/a/z")
+	fs.createTestFile(t, "/a/b/file")
+	if err := fs.Mkdir("/a/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := fs.ReadDir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"b", "c", "z"}) {
+		t.Fatalf("expect the sorted children, got %v", names)
+	}
+	_, err = fs.ReadDir("/a/z")
+	expectPathError(t, err, "readdir", "/a/z", syscall.ENOTDIR)
+
+	var walked []string
+	err = fs.Walk("/a", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, name)
+		if name == "/a/b" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, []string{"/a", "/a/b", "/a/c", "/a/z"}) {
+		t.Fatalf("unexpected walk %v", walked)
+	}
+	err = fs.Walk("/missing", func(name string, info os.FileInfo, err error) error { return err })
+	if !os.IsNotExist(err) {
+		t.Fatalf("expect the error of the root to be passed, got %v", err)
+	}
+}
+
+func TestChmodChown(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	ino := fs.createTestFile(t, "/file")
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Chmod("/file", os.ModeDir|0600); err != nil {
+		t.Fatal(err)
+	}
+	if info := vol.Inode(ino); info.Mode != proto.Mode(0600) {
+		t.Fatalf("expect only the permission to be changed, got %o", info.Mode)
+	}
+	if err := fs.Chmod("/dir", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fs.Stat("/dir"); err != nil || info.Mode() != os.ModeDir|0700 {
+		t.Fatalf("expect the type of the directory to be kept, got %v %v", info, err)
+	}
+	if err := fs.Chown("/file", 3, 4); err != nil {
+		t.Fatal(err)
+	}
+	if info := vol.Inode(ino); info.Uid != 3 || info.Gid != 4 || info.Mode != proto.Mode(0600) {
+		t.Fatalf("unexpected owner %v:%v mode %o", info.Uid, info.Gid, info.Mode)
+	}
+	expectPathError(t, fs.Chmod("/missing", 0600), "chmod", "/missing", syscall.ENOENT)
+	expectPathError(t, fs.Chown("/missing", 3, 4), "chown", "/missing", syscall.ENOENT)
+}
+
+// The directories and the links are opened without the data client.
+func TestOpenFileErrors(t *testing.T) {
+	vol, fs := newTestFS(t)
+	defer vol.Close()
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	fs.createTestFile(t, "/file")
+
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := f.Readdirnames(-1)
+	if err != nil || len(names) != 0 {
+		t.Fatalf("expect no children, got %v %v", names, err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = fs.Open("/"); err != nil {
+		t.Fatalf("expect the root to be opened, got %v", err)
+	}
+	f.Close()
+
+	_, err = fs.OpenFile("/dir", os.O_RDWR, 0)
+	expectPathError(t, err, "open", "/dir", syscall.EISDIR)
+	_, err = fs.OpenFile("/file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	expectPathError(t, err, "open", "/file", syscall.EEXIST)
+	_, err = fs.Open("/missing")
+	expectPathError(t, err, "open", "/missing", syscall.ENOENT)
+	_, err = fs.Open("/file/child")
+	expectPathError(t, err, "open", "/file/child", syscall.ENOTDIR)
+}
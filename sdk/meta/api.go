@@ -15,6 +15,7 @@
 package meta
 
 import (
+	"os"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -42,12 +43,19 @@ func (mw *MetaWrapper) Statfs() (total, used uint64) {
 }
 
 func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode, uid, gid uint32, target []byte) (*proto.InodeInfo, error) {
+	return mw.CreateWithACL_ll(parentID, name, mode, uid, gid, target, nil, nil)
+}
+
+// CreateWithACL_ll creates an inode with the access and default ACLs, which are inherited from the
+// default ACL of the parent directory.
+func (mw *MetaWrapper) CreateWithACL_ll(parentID uint64, name string, mode, uid, gid uint32, target, acl, defaultACL []byte) (*proto.InodeInfo, error) {
 	var (
 		status       int
 		err          error
 		info         *proto.InodeInfo
 		mp           *MetaPartition
 		rwPartitions []*MetaPartition
+		quotaIDs     []uint32
 	)
 
 	parentMP := mw.getPartitionByInode(parentID)
@@ -56,6 +64,17 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode, uid, gid ui
 		return nil, syscall.ENOENT
 	}
 
+	// The new inode is accounted to the quotas of its parent.
+	if mw.hasQuotas() {
+		if quotaIDs, err = mw.inodeQuotaIDs(parentID); err != nil {
+			return nil, err
+		}
+		if mw.quotaExceeded(quotaIDs) {
+			log.LogWarnf("Create_ll: quota exceeded, parentID(%v) quotaIDs(%v)", parentID, quotaIDs)
+			return nil, syscall.EDQUOT
+		}
+	}
+
 	// Create Inode
 
 	//	mp = mw.getLatestPartition()
@@ -84,7 +103,7 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode, uid, gid ui
 	for i := 0; i < length; i++ {
 		index := (int(epoch) + i) % length
 		mp = rwPartitions[index]
-		status, info, err = mw.icreate(mp, mode, uid, gid, target)
+		status, info, err = mw.icreate(mp, mode, uid, gid, target, quotaIDs, acl, defaultACL)
 		if err == nil && status == statusOK {
 			goto create_dentry
 		}
@@ -92,7 +111,7 @@ func (mw *MetaWrapper) Create_ll(parentID uint64, name string, mode, uid, gid ui
 	return nil, syscall.ENOMEM
 
 create_dentry:
-	status, err = mw.dcreate(parentMP, parentID, name, info.Inode, mode)
+	status, err = mw.createDentry(parentID, name, info.Inode, mode)
 	if err != nil || status != statusOK {
 		if status == statusExist {
 			return nil, syscall.EEXIST
@@ -102,17 +121,14 @@ create_dentry:
 			return nil, statusToErrno(status)
 		}
 	}
+	if len(quotaIDs) > 0 {
+		mw.quotaCache.put(info.Inode, info.QuotaIDs)
+	}
 	return info, nil
 }
 
 func (mw *MetaWrapper) Lookup_ll(parentID uint64, name string) (inode uint64, mode uint32, err error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
-		log.LogErrorf("Lookup_ll: No parent partition, parentID(%v) name(%v)", parentID, name)
-		return 0, 0, syscall.ENOENT
-	}
-
-	status, inode, mode, err := mw.lookup(parentMP, parentID, name)
+	_, status, inode, mode, err := mw.lookupDentry(parentID, name)
 	if err != nil || status != statusOK {
 		return 0, 0, statusToErrno(status)
 	}
@@ -164,12 +180,13 @@ func (mw *MetaWrapper) BatchInodeGet(inodes []uint64) []*proto.InodeInfo {
  */
 func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*proto.InodeInfo, error) {
 	var (
-		status int
-		inode  uint64
-		mode   uint32
-		err    error
-		info   *proto.InodeInfo
-		mp     *MetaPartition
+		status  int
+		inode   uint64
+		mode    uint32
+		err     error
+		info    *proto.InodeInfo
+		mp      *MetaPartition
+		removed bool
 	)
 
 	parentMP := mw.getPartitionByInode(parentID)
@@ -179,7 +196,7 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 	}
 
 	if isDir {
-		status, inode, mode, err = mw.lookup(parentMP, parentID, name)
+		_, status, inode, mode, err = mw.lookupDentry(parentID, name)
 		if err != nil || status != statusOK {
 			return nil, statusToErrno(status)
 		}
@@ -198,15 +215,51 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 		if info == nil || info.Nlink > 2 {
 			return nil, syscall.ENOTEMPTY
 		}
+		// The split directory is marked as being removed first, so that no entries are created in
+		// it meanwhile. The entries in the other shards are not counted by the nlink of the inode.
+		status, err = mw.markDirRemoving(mp, inode, true)
+		if err != nil || (status != statusOK && status != statusInval) {
+			return nil, statusToErrno(status)
+		}
+		if status == statusOK {
+			dirMP := mp
+			defer func() {
+				if !removed {
+					mw.markDirRemoving(dirMP, inode, false)
+				}
+			}()
+			if empty, st := mw.isDirShardsEmpty(inode); !empty {
+				if st != statusOK {
+					return nil, statusToErrno(st)
+				}
+				return nil, syscall.ENOTEMPTY
+			}
+		}
+	}
+
+	// The dentries deleted from the trash are not moved to it again, and neither is the trash itself.
+	if mw.trashEnabled() && !(parentID == proto.RootIno && name == proto.TrashDirName) {
+		trashIno, err := mw.trashDir()
+		if err != nil {
+			return nil, err
+		}
+		if parentID != trashIno {
+			err = mw.Rename_ll(parentID, name, trashIno, proto.TrashEntryName(parentID, name, time.Now()))
+			if err == syscall.ENOENT {
+				return nil, nil
+			}
+			return nil, err
+		}
 	}
 
-	status, inode, err = mw.ddelete(parentMP, parentID, name)
+	status, inode, err = mw.deleteDentry(parentID, name)
 	if err != nil || status != statusOK {
 		if status == statusNoent {
 			return nil, nil
 		}
 		return nil, statusToErrno(status)
 	}
+	removed = true
 
 	// dentry is deleted successfully but inode is not, still returns success.
 	mp = mw.getPartitionByInode(inode)
@@ -215,7 +268,13 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 		return nil, nil
 	}
 
-	status, info, err = mw.iunlink(mp, inode)
+	// the inode is locked while a transaction creates an entry in it
+	for start := time.Now(); ; {
+		status, info, err = mw.iunlink(mp, inode)
+		if err != nil || !retryAgain(status, start) {
+			break
+		}
+	}
 	if err != nil || status != statusOK {
 		return nil, nil
 	}
@@ -223,94 +282,144 @@ func (mw *MetaWrapper) Delete_ll(parentID uint64, name string, isDir bool) (*pro
 }
 
 func (mw *MetaWrapper) Rename_ll(srcParentID uint64, srcName string, dstParentID uint64, dstName string) (err error) {
-	var oldInode uint64
-
-	srcParentMP := mw.getPartitionByInode(srcParentID)
-	if srcParentMP == nil {
-		return syscall.ENOENT
-	}
-	dstParentMP := mw.getPartitionByInode(dstParentID)
-	if dstParentMP == nil {
-		return syscall.ENOENT
+	if srcParentID == dstParentID && srcName == dstName {
+		return nil
 	}
 
-	// look up for the src ino
-	status, inode, mode, err := mw.lookup(srcParentMP, srcParentID, srcName)
+	retry := 0
+	start := time.Now()
+retry:
+	// The src dentry is deleted by the partition it is found in, which coordinates the rename.
+	srcParentMP, status, inode, mode, err := mw.lookupDentry(srcParentID, srcName)
 	if err != nil || status != statusOK {
 		return statusToErrno(status)
 	}
-	srcMP := mw.getPartitionByInode(inode)
-	if srcMP == nil {
+	dstParentMP, dstShard := mw.getDentryPartition(dstParentID, dstName)
+	if dstParentMP == nil {
 		return syscall.ENOENT
 	}
 
-	status, _, err = mw.ilink(srcMP, inode)
-	if err != nil || status != statusOK {
-		return statusToErrno(status)
+	req := &proto.TxRenameRequest{
+		SrcParentID: srcParentID,
+		SrcName:     srcName,
+		DstParentID: dstParentID,
+		DstName:     dstName,
+		Inode:       inode,
+		Mode:        mode,
+		DstPartition: proto.TxPartition{
+			PartitionID: dstParentMP.PartitionID,
+			Members:     dstParentMP.Members,
+		},
+		DstShard: dstShard,
 	}
 
-	// create dentry in dst parent
-	status, err = mw.dcreate(dstParentMP, dstParentID, dstName, inode, mode)
+	// look up for the dst ino to be overwritten
+	oldDentryMP, status, oldInode, oldMode, err := mw.lookupDentry(dstParentID, dstName)
 	if err != nil {
-		mw.iunlink(srcMP, inode)
 		return syscall.EAGAIN
 	}
-
-	// Note that only regular files are allowed to be overwritten.
-	if status == statusExist && proto.IsRegular(mode) {
-		status, oldInode, err = mw.dupdate(dstParentMP, dstParentID, dstName, inode)
-		if err != nil {
-			mw.iunlink(srcMP, inode)
-			return syscall.EAGAIN
+	if status == statusOK {
+		if oldInode == inode {
+			return nil
 		}
-	}
-
-	if status != statusOK {
-		mw.iunlink(srcMP, inode)
-		return statusToErrno(status)
-	}
-
-	// delete dentry from src parent
-	status, _, err = mw.ddelete(srcParentMP, srcParentID, srcName)
-	if err != nil || status != statusOK {
-		var (
-			sts int
-			e   error
-		)
-		if oldInode == 0 {
-			sts, _, e = mw.ddelete(dstParentMP, dstParentID, dstName)
-		} else {
-			sts, _, e = mw.dupdate(dstParentMP, dstParentID, dstName, oldInode)
+		// Directories and files never overwrite each other, whatever their permission bits, and the
+		// directories are never overwritten by the directories either.
+		if proto.IsDir(oldMode) {
+			if proto.IsDir(mode) {
+				return syscall.EEXIST
+			}
+			return syscall.EISDIR
+		}
+		if proto.IsDir(mode) {
+			return syscall.ENOTDIR
+		}
+		// Note that only regular files are allowed to be overwritten.
+		if !proto.IsRegular(mode) {
+			return syscall.EEXIST
+		}
+		oldInodeMP := mw.getPartitionByInode(oldInode)
+		if oldInodeMP == nil {
+			return syscall.ENOENT
 		}
-		if e == nil && sts == statusOK {
-			mw.iunlink(srcMP, inode)
+		req.OldInode = oldInode
+		req.DstPartition = proto.TxPartition{
+			PartitionID: oldDentryMP.PartitionID,
+			Members:     oldDentryMP.Members,
 		}
+		req.OldInodePartition = &proto.TxPartition{
+			PartitionID: oldInodeMP.PartitionID,
+			Members:     oldInodeMP.Members,
+		}
+	} else if status != statusNoent {
 		return statusToErrno(status)
 	}
 
-	mw.iunlink(srcMP, inode)
-
-	if oldInode != 0 {
-		inodeMP := mw.getPartitionByInode(oldInode)
-		if inodeMP != nil {
-			mw.iunlink(inodeMP, oldInode)
-		}
+	status, err = mw.txRename(srcParentMP, req)
+	if err != nil {
+		return syscall.EAGAIN
 	}
-
+	if status == statusDirShard && retry < DirShardRetryLimit {
+		retry++
+		mw.updateMetaPartitions()
+		goto retry
+	}
+	// the dentries are locked by another transaction
+	if retryAgain(status, start) {
+		goto retry
+	}
+	if status != statusOK {
+		return statusToErrno(status)
+	}
+	mw.renameQuotas(srcParentID, dstParentID, inode, mode)
 	return nil
 }
 
+// ReadDir_ll reads all the children of the directory, in batches of ReadDirLimit.
 func (mw *MetaWrapper) ReadDir_ll(parentID uint64) ([]proto.Dentry, error) {
-	parentMP := mw.getPartitionByInode(parentID)
-	if parentMP == nil {
-		return nil, syscall.ENOENT
+	var (
+		children []proto.Dentry
+		marker   string
+	)
+	for {
+		batch, next, err := mw.ReadDirLimit_ll(parentID, marker, ReadDirLimit)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, batch...)
+		if next == "" {
+			return children, nil
+		}
+		marker = next
 	}
+}
 
-	status, children, err := mw.readdir(parentMP, parentID)
+// ReadDirLimit_ll reads at most limit children of the directory after the marker, and returns the
+// marker to read the rest of them, which is empty if there are no more.
+func (mw *MetaWrapper) ReadDirLimit_ll(parentID uint64, marker string, limit uint64) ([]proto.Dentry, string, error) {
+	var (
+		status   int
+		children []proto.Dentry
+		next     string
+		err      error
+	)
+	for i := 0; ; i++ {
+		if pids := mw.getDirShards(parentID); len(pids) > 0 {
+			status, children, next, err = mw.readDirShards(pids, parentID, marker, limit)
+		} else {
+			parentMP := mw.getPartitionByInode(parentID)
+			if parentMP == nil {
+				return nil, "", syscall.ENOENT
+			}
+			status, children, next, err = mw.readdir(parentMP, parentID, marker, limit)
+		}
+		if err != nil || !mw.retryDirShard(parentID, status, i) {
+			break
+		}
+	}
 	if err != nil || status != statusOK {
-		return nil, statusToErrno(status)
+		return nil, "", statusToErrno(status)
 	}
-	return children, nil
+	return children, next, nil
 }
 
 // Used as a callback by stream sdk
@@ -329,6 +438,22 @@ func (mw *MetaWrapper) AppendExtentKey(inode uint64, ek proto.ExtentKey) error {
 	return nil
 }
 
+// OverwriteExtents records the in-place overwrites of the extents of the inode, which bumps its generation.
+func (mw *MetaWrapper) OverwriteExtents(inode uint64) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		return syscall.ENOENT
+	}
+
+	status, err := mw.overwriteExtents(mp, inode)
+	if err != nil || status != statusOK {
+		log.LogErrorf("OverwriteExtents: inode(%v) err(%v) status(%v)", inode, err, status)
+		return statusToErrno(status)
+	}
+	log.LogDebugf("OverwriteExtents: ino(%v)", inode)
+	return nil
+}
+
 func (mw *MetaWrapper) GetExtents(inode uint64) (gen uint64, size uint64, extents []proto.ExtentKey, err error) {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
@@ -379,7 +504,7 @@ func (mw *MetaWrapper) Link(parentID uint64, name string, ino uint64) (*proto.In
 	}
 
 	// create new dentry and refer to the inode
-	status, err = mw.dcreate(parentMP, parentID, name, ino, info.Mode)
+	status, err = mw.createDentry(parentID, name, ino, info.Mode)
 	if err != nil || status != statusOK {
 		if status == statusExist {
 			return nil, syscall.EEXIST
@@ -388,6 +513,7 @@ func (mw *MetaWrapper) Link(parentID uint64, name string, ino uint64) (*proto.In
 			return nil, syscall.EAGAIN
 		}
 	}
+	mw.linkQuotas(parentID, info)
 	return info, nil
 }
 
@@ -406,14 +532,22 @@ func (mw *MetaWrapper) Evict(inode uint64) error {
 	return nil
 }
 
-func (mw *MetaWrapper) Setattr(inode uint64, valid, mode, uid, gid uint32) error {
+// SetattrAsRoot sets the attributes of the inode as root, for the callers which check the permissions by
+// themselves, or are trusted with any change.
+func (mw *MetaWrapper) SetattrAsRoot(inode uint64, valid, mode, uid, gid uint32) error {
+	return mw.SetattrAs(&proto.Caller{}, inode, valid, mode, uid, gid)
+}
+
+// SetattrAs sets the attributes of the inode on behalf of the caller, whose ownership of the inode is checked
+// by the metanode.
+func (mw *MetaWrapper) SetattrAs(caller *proto.Caller, inode uint64, valid, mode, uid, gid uint32) error {
 	mp := mw.getPartitionByInode(inode)
 	if mp == nil {
 		log.LogErrorf("Setattr: No such partition, ino(%v)", inode)
 		return syscall.EINVAL
 	}
 
-	status, err := mw.setattr(mp, inode, valid, mode, uid, gid)
+	status, err := mw.setattr(mp, inode, valid, mode, uid, gid, caller)
 	if err != nil || status != statusOK {
 		log.LogErrorf("Setattr: ino(%v) err(%v) status(%v)", inode, err, status)
 		return statusToErrno(status)
@@ -421,3 +555,334 @@ func (mw *MetaWrapper) Setattr(inode uint64, valid, mode, uid, gid uint32) error
 
 	return nil
 }
+
+// XAttrSetAsRoot_ll sets the extended attribute of the inode as root, for the callers which check the
+// permissions by themselves, or are trusted with any change.
+func (mw *MetaWrapper) XAttrSetAsRoot_ll(inode uint64, name string, value []byte, flags uint32) error {
+	return mw.XAttrSetAs_ll(&proto.Caller{}, inode, name, value, flags)
+}
+
+// XAttrSetAs_ll sets the extended attribute of the inode on behalf of the caller, who must own the inode to
+// set its ACLs.
+func (mw *MetaWrapper) XAttrSetAs_ll(caller *proto.Caller, inode uint64, name string, value []byte, flags uint32) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("XAttrSet_ll: No such partition, ino(%v)", inode)
+		return syscall.ENOENT
+	}
+
+	status, err := mw.setXAttr(mp, inode, name, value, flags, caller)
+	if err != nil || status != statusOK {
+		return statusToErrno(status)
+	}
+	return nil
+}
+
+func (mw *MetaWrapper) XAttrGet_ll(inode uint64, name string) ([]byte, error) {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("XAttrGet_ll: No such partition, ino(%v)", inode)
+		return nil, syscall.ENOENT
+	}
+
+	status, value, err := mw.getXAttr(mp, inode, name)
+	if err != nil || status != statusOK {
+		return nil, statusToErrno(status)
+	}
+	return value, nil
+}
+
+func (mw *MetaWrapper) XAttrsList_ll(inode uint64) ([]string, error) {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("XAttrsList_ll: No such partition, ino(%v)", inode)
+		return nil, syscall.ENOENT
+	}
+
+	status, names, err := mw.listXAttr(mp, inode)
+	if err != nil || status != statusOK {
+		return nil, statusToErrno(status)
+	}
+	return names, nil
+}
+
+// XAttrDelAsRoot_ll removes the extended attribute of the inode as root, for the callers which check the
+// permissions by themselves, or are trusted with any change.
+func (mw *MetaWrapper) XAttrDelAsRoot_ll(inode uint64, name string) error {
+	return mw.XAttrDelAs_ll(&proto.Caller{}, inode, name)
+}
+
+// XAttrDelAs_ll removes the extended attribute of the inode on behalf of the caller, who must own the inode to
+// remove its ACLs.
+func (mw *MetaWrapper) XAttrDelAs_ll(caller *proto.Caller, inode uint64, name string) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("XAttrDel_ll: No such partition, ino(%v)", inode)
+		return syscall.ENOENT
+	}
+
+	status, err := mw.removeXAttr(mp, inode, name, caller)
+	if err != nil || status != statusOK {
+		return statusToErrno(status)
+	}
+	return nil
+}
+
+func (mw *MetaWrapper) getQuotas() map[uint32]*proto.QuotaInfo {
+	quotas, _ := mw.quotas.Load().(map[uint32]*proto.QuotaInfo)
+	return quotas
+}
+
+func (mw *MetaWrapper) hasQuotas() bool {
+	return len(mw.getQuotas()) > 0
+}
+
+// Returns true if any of the given quotas is exceeded. Deleted quotas are ignored.
+func (mw *MetaWrapper) quotaExceeded(quotaIDs []uint32) bool {
+	quotas := mw.getQuotas()
+	for _, id := range quotaIDs {
+		if q, ok := quotas[id]; ok && q.Exceeded() {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckQuota returns EDQUOT if any quota the inode is accounted to is exceeded.
+// Used as a callback by stream sdk.
+func (mw *MetaWrapper) CheckQuota(inode uint64) error {
+	exceeded := false
+	for _, q := range mw.getQuotas() {
+		if q.Exceeded() {
+			exceeded = true
+			break
+		}
+	}
+	if !exceeded {
+		return nil
+	}
+	quotaIDs, err := mw.inodeQuotaIDs(inode)
+	if err != nil {
+		log.LogWarnf("CheckQuota: ino(%v) err(%v)", inode, err)
+		return nil
+	}
+	if mw.quotaExceeded(quotaIDs) {
+		return syscall.EDQUOT
+	}
+	return nil
+}
+
+// ListTrash returns the entries in the trash of the volume.
+func (mw *MetaWrapper) ListTrash() ([]*proto.TrashEntry, error) {
+	trashIno, _, err := mw.Lookup_ll(proto.RootIno, proto.TrashDirName)
+	if err == syscall.ENOENT {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the trash is read in batches, as it may hold a huge number of entries
+	entries := make([]*proto.TrashEntry, 0)
+	ds := mw.OpenDirStream(trashIno)
+	for offset := uint64(0); ; {
+		children, err := ds.ReadAt(offset)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) == 0 {
+			return entries, nil
+		}
+		offset += uint64(len(children))
+		for _, child := range children {
+			entry, err := proto.ParseTrashEntry(child.Name, child.Inode, child.Type)
+			if err != nil {
+				log.LogWarnf("ListTrash: %v", err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// RestoreTrash moves the entry in the trash back to its original path, whose parent must exist.
+// A file or directory at the original path is not overwritten. The entry is moved back by the partition
+// of the root, which keeps the trash.
+func (mw *MetaWrapper) RestoreTrash(name string) error {
+	entry, err := proto.ParseTrashEntry(name, 0, 0)
+	if err != nil {
+		return syscall.EINVAL
+	}
+	rootMP := mw.getPartitionByInode(proto.RootIno)
+	if rootMP == nil {
+		log.LogErrorf("RestoreTrash: No root partition")
+		return syscall.ENOENT
+	}
+	status, err := mw.restoreTrash(rootMP, name)
+	if err != nil {
+		return syscall.EAGAIN
+	}
+	if status != statusOK {
+		return statusToErrno(status)
+	}
+	log.LogDebugf("RestoreTrash: name(%v)", name)
+	if mw.hasQuotas() {
+		trashIno, _, err := mw.Lookup_ll(proto.RootIno, proto.TrashDirName)
+		if err != nil {
+			log.LogWarnf("RestoreTrash: lookup trash, name(%v) err(%v)", name, err)
+			return nil
+		}
+		inode, mode, err := mw.Lookup_ll(entry.ParentID, entry.OrigName)
+		if err != nil {
+			log.LogWarnf("RestoreTrash: lookup restored, name(%v) err(%v)", name, err)
+			return nil
+		}
+		mw.renameQuotas(trashIno, entry.ParentID, inode, mode)
+	}
+	return nil
+}
+
+func (mw *MetaWrapper) trashEnabled() bool {
+	return atomic.LoadUint32(&mw.trashRetention) > 0
+}
+
+// Returns the inode of the trash directory, which is created on demand. Its inode is allocated
+// in the partition of the root, so that the metanodes find all the entries of the trash there.
+func (mw *MetaWrapper) trashDir() (uint64, error) {
+	rootMP := mw.getPartitionByInode(proto.RootIno)
+	if rootMP == nil {
+		log.LogErrorf("trashDir: No root partition")
+		return 0, syscall.ENOENT
+	}
+	status, inode, _, err := mw.lookup(rootMP, proto.RootIno, proto.TrashDirName)
+	if err != nil {
+		return 0, syscall.EAGAIN
+	}
+	if status == statusOK {
+		return inode, nil
+	}
+	if status != statusNoent {
+		return 0, statusToErrno(status)
+	}
+
+	mode := proto.Mode(os.ModeDir | 0700)
+	status, info, err := mw.icreate(rootMP, mode, 0, 0, nil, nil, nil, nil)
+	if err != nil || status != statusOK {
+		log.LogErrorf("trashDir: create inode failed, status(%v) err(%v)", status, err)
+		return 0, statusToErrno(status)
+	}
+	status, err = mw.dcreate(rootMP, proto.RootIno, proto.TrashDirName, info.Inode, mode, false)
+	if err != nil || status != statusOK {
+		mw.iunlink(rootMP, info.Inode)
+		mw.ievict(rootMP, info.Inode)
+		if status != statusExist {
+			return 0, statusToErrno(status)
+		}
+		// created by another client concurrently
+		status, inode, _, err = mw.lookup(rootMP, proto.RootIno, proto.TrashDirName)
+		if err != nil || status != statusOK {
+			return 0, statusToErrno(status)
+		}
+		return inode, nil
+	}
+	return info.Inode, nil
+}
+
+// SetLock_ll acquires or releases an advisory lock on the inode on behalf of the lock owner in the client.
+// It returns EAGAIN if the lock conflicts with the locks of other owners, on this client or not.
+func (mw *MetaWrapper) SetLock_ll(inode uint64, lock *proto.FileLock) error {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("SetLock_ll: No such partition, ino(%v)", inode)
+		return syscall.ENOENT
+	}
+
+	lock.ClientID = mw.clientID
+	status, err := mw.setLock(mp, inode, lock)
+	if err != nil || status != statusOK {
+		return statusToErrno(status)
+	}
+	if lock.Type != proto.FileLockUnlock {
+		// the inode is forgotten once the metanode tells no lock is held on it
+		mw.lockedInodesMu.Lock()
+		mw.lockSeq++
+		mw.lockedInodes[inode] = mw.lockSeq
+		mw.lockedInodesMu.Unlock()
+	}
+	return nil
+}
+
+// GetLock_ll returns a lock on the inode which conflicts with the given one, whose type is
+// FileLockUnlock if there is none.
+func (mw *MetaWrapper) GetLock_ll(inode uint64, lock *proto.FileLock) (*proto.FileLock, error) {
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogErrorf("GetLock_ll: No such partition, ino(%v)", inode)
+		return nil, syscall.ENOENT
+	}
+
+	lock.ClientID = mw.clientID
+	status, conflict, err := mw.getLock(mp, inode, lock)
+	if err != nil || status != statusOK {
+		return nil, statusToErrno(status)
+	}
+	if conflict.ClientID != mw.clientID {
+		// the pid of another host is meaningless here
+		conflict.Pid = 0
+	}
+	return conflict, nil
+}
+
+// PartitionIDs returns the IDs of the meta partitions of the volume.
+func (mw *MetaWrapper) PartitionIDs() (ids []uint64) {
+	mw.RLock()
+	defer mw.RUnlock()
+	for id := range mw.partitions {
+		ids = append(ids, id)
+	}
+	return
+}
+
+// ReadChanges returns at most limit changes applied by the meta partition after the given apply ID.
+func (mw *MetaWrapper) ReadChanges(partitionID, from uint64, limit int) (*proto.ReadMetaChangesResponse, error) {
+	mp := mw.getPartitionByID(partitionID)
+	if mp == nil {
+		log.LogErrorf("ReadChanges: No such partition(%v)", partitionID)
+		return nil, syscall.ENOENT
+	}
+
+	status, resp, err := mw.readChanges(mp, from, limit)
+	if err != nil || status != statusOK {
+		return nil, statusToErrno(status)
+	}
+	return resp, nil
+}
+
+// Renews the leases of the locks held by the client, so that they are kept as long as the client lives.
+func (mw *MetaWrapper) renewFileLocks() {
+	mw.lockedInodesMu.Lock()
+	batches := make(map[*MetaPartition][]uint64)
+	seqs := make(map[uint64]uint64, len(mw.lockedInodes))
+	for ino, seq := range mw.lockedInodes {
+		if mp := mw.getPartitionByInode(ino); mp != nil {
+			batches[mp] = append(batches[mp], ino)
+			seqs[ino] = seq
+		}
+	}
+	mw.lockedInodesMu.Unlock()
+
+	for mp, inodes := range batches {
+		status, released, err := mw.renewLock(mp, inodes)
+		if err != nil || status != statusOK {
+			log.LogWarnf("renewFileLocks: mp(%v) inodes(%v) status(%v) err(%v)", mp, inodes, status, err)
+			continue
+		}
+		mw.lockedInodesMu.Lock()
+		for _, ino := range released {
+			// unless locked again in the meantime
+			if mw.lockedInodes[ino] == seqs[ino] {
+				delete(mw.lockedInodes, ino)
+			}
+		}
+		mw.lockedInodesMu.Unlock()
+	}
+}
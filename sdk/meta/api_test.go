@@ -0,0 +1,140 @@
+package meta
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+func newTestMetaWrapper(t *testing.T) (*mocktest.MockVolume, *MetaWrapper) {
+	vol, err := mocktest.NewMockVolume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		vol.Close()
+		t.Fatal(err)
+	}
+	return vol, mw
+}
+
+func createFile(t *testing.T, mw *MetaWrapper, parentID uint64, name string, perm os.FileMode) *proto.InodeInfo {
+	info, err := mw.Create_ll(parentID, name, proto.Mode(perm), 0, 0, nil)
+	if err != nil {
+		t.Fatalf("create %v: %v", name, err)
+	}
+	return info
+}
+
+func TestRename(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+
+	info := createFile(t, mw, proto.RootIno, "a", 0644)
+	if err := mw.Rename_ll(proto.RootIno, "a", proto.RootIno, "b"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if _, _, err := mw.Lookup_ll(proto.RootIno, "a"); err != syscall.ENOENT {
+		t.Fatalf("lookup the source: expected ENOENT but got %v", err)
+	}
+	if ino, _, err := mw.Lookup_ll(proto.RootIno, "b"); err != nil || ino != info.Inode {
+		t.Fatalf("lookup the destination: expected inode %v but got %v, err %v", info.Inode, ino, err)
+	}
+}
+
+func TestRenameOverwrite(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+
+	// the permission bits of the files differ
+	src := createFile(t, mw, proto.RootIno, "src", 0644)
+	dst := createFile(t, mw, proto.RootIno, "dst", 0600)
+	if err := mw.Rename_ll(proto.RootIno, "src", proto.RootIno, "dst"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	ino, mode, err := mw.Lookup_ll(proto.RootIno, "dst")
+	if err != nil || ino != src.Inode || mode != src.Mode {
+		t.Fatalf("lookup the destination: expected inode %v mode %o but got %v %o, err %v", src.Inode, src.Mode, ino, mode, err)
+	}
+	if info := vol.Inode(dst.Inode); info == nil || info.Nlink != 0 {
+		t.Fatalf("the overwritten inode is not unlinked: %v", info)
+	}
+}
+
+func TestRenameDirAndFile(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+
+	if _, err := mw.Create_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 0, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, mw, proto.RootIno, "file", 0644)
+	if err := mw.Rename_ll(proto.RootIno, "file", proto.RootIno, "dir"); err != syscall.EISDIR {
+		t.Fatalf("rename a file over a directory: expected EISDIR but got %v", err)
+	}
+	if err := mw.Rename_ll(proto.RootIno, "dir", proto.RootIno, "file"); err != syscall.ENOTDIR {
+		t.Fatalf("rename a directory over a file: expected ENOTDIR but got %v", err)
+	}
+}
+
+func testACL(otherPerm uint16) []byte {
+	return proto.ACL{
+		{Tag: proto.ACLUserObj, Perm: proto.ACLRead | proto.ACLWrite},
+		{Tag: proto.ACLGroupObj, Perm: proto.ACLRead},
+		{Tag: proto.ACLOther, Perm: otherPerm},
+	}.Marshal()
+}
+
+func TestACL(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+
+	acl, defaultACL := testACL(proto.ACLRead), testACL(0)
+	info, err := mw.CreateWithACL_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 100, 100, nil, acl, defaultACL)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !bytes.Equal(info.ACL, acl) || !bytes.Equal(info.DefaultACL, defaultACL) {
+		t.Fatalf("expect the ACLs created, got %v %v", info.ACL, info.DefaultACL)
+	}
+	if info, err = mw.InodeGet_ll(info.Inode); err != nil || !bytes.Equal(info.ACL, acl) ||
+		!bytes.Equal(info.DefaultACL, defaultACL) {
+		t.Fatalf("expect the ACLs of the inode, got %v err %v", info, err)
+	}
+
+	// only the owner or root changes the ACLs
+	newACL := testACL(0)
+	if err = mw.XAttrSetAs_ll(&proto.Caller{Uid: 200}, info.Inode, proto.XAttrACLAccess, newACL, 0); err != syscall.EPERM {
+		t.Fatalf("set by the other user: expected EPERM but got %v", err)
+	}
+	if err = mw.XAttrDelAs_ll(&proto.Caller{Uid: 200}, info.Inode, proto.XAttrACLDefault); err != syscall.EPERM {
+		t.Fatalf("remove by the other user: expected EPERM but got %v", err)
+	}
+	if err = mw.XAttrSetAs_ll(&proto.Caller{Uid: 100}, info.Inode, proto.XAttrACLAccess, []byte("bad"), 0); err != syscall.EINVAL {
+		t.Fatalf("set the invalid ACL: expected EINVAL but got %v", err)
+	}
+	if err = mw.XAttrSetAs_ll(&proto.Caller{Uid: 100}, info.Inode, proto.XAttrACLAccess, newACL, proto.XAttrCreate); err != syscall.EEXIST {
+		t.Fatalf("create the existing ACL: expected EEXIST but got %v", err)
+	}
+	if err = mw.XAttrSetAs_ll(&proto.Caller{Uid: 100}, info.Inode, proto.XAttrACLAccess, newACL, 0); err != nil {
+		t.Fatalf("set by the owner: %v", err)
+	}
+	if info, err = mw.InodeGet_ll(info.Inode); err != nil || !bytes.Equal(info.ACL, newACL) {
+		t.Fatalf("expect the ACL set, got %v err %v", info, err)
+	}
+
+	if err = mw.XAttrDelAsRoot_ll(info.Inode, proto.XAttrACLDefault); err != nil {
+		t.Fatalf("remove by root: %v", err)
+	}
+	if info, err = mw.InodeGet_ll(info.Inode); err != nil || info.DefaultACL != nil || !bytes.Equal(info.ACL, newACL) {
+		t.Fatalf("expect the default ACL removed, got %v err %v", info, err)
+	}
+	if err = mw.XAttrDelAsRoot_ll(info.Inode, proto.XAttrACLDefault); err != syscall.ENODATA {
+		t.Fatalf("remove again: expected ENODATA but got %v", err)
+	}
+}
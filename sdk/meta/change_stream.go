@@ -0,0 +1,103 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// the number of the changes read from a meta partition in a request
+const readChangesLimit = 1024
+
+// ErrChangesTruncated is returned if the changes after the offset are no longer kept by the meta partition,
+// so that the subscriber has to resynchronize, and subscribe again from the current offset.
+var ErrChangesTruncated = errors.New("changes after the offset are truncated")
+
+// ChangeStream reads the events of the metadata changes of a meta partition in order, after an offset, which
+// is the apply ID of the changes in the partition. It is not thread-safe.
+type ChangeStream struct {
+	mw          *MetaWrapper
+	partitionID uint64
+	offset      uint64
+}
+
+// OpenChangeStream returns a new stream of the events of the meta partition after the offset.
+func (mw *MetaWrapper) OpenChangeStream(partitionID, offset uint64) *ChangeStream {
+	return &ChangeStream{mw: mw, partitionID: partitionID, offset: offset}
+}
+
+// ChangeOffset returns the current offset of the meta partition, after which the changes are to be applied.
+func (mw *MetaWrapper) ChangeOffset(partitionID uint64) (uint64, error) {
+	resp, err := mw.ReadChanges(partitionID, math.MaxUint64, 1)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ApplyID, nil
+}
+
+// Offset returns the offset of the changes read.
+func (cs *ChangeStream) Offset() uint64 {
+	return cs.offset
+}
+
+// Next returns the next events, which are empty if there are no more changes for now.
+func (cs *ChangeStream) Next() ([]*proto.MetaEvent, error) {
+	for {
+		resp, err := cs.mw.ReadChanges(cs.partitionID, cs.offset, readChangesLimit)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Truncated {
+			return nil, ErrChangesTruncated
+		}
+		events := resp.Events(cs.offset)
+		cs.offset = events.Offset
+		if len(events.Events) > 0 || len(resp.Changes) == 0 {
+			return events.Events, nil
+		}
+	}
+}
+
+// Subscribe calls the handler with the events of the meta partition after the offset in order, and polls for the
+// new ones every interval, until the stop channel is closed or it fails. The subscriber is supposed to save the
+// offset of the last event handled, and subscribe from it after restarts.
+func (mw *MetaWrapper) Subscribe(partitionID, offset uint64, interval time.Duration, stopC <-chan struct{},
+	handler func(event *proto.MetaEvent) error) error {
+	cs := mw.OpenChangeStream(partitionID, offset)
+	for {
+		events, err := cs.Next()
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err = handler(event); err != nil {
+				return err
+			}
+		}
+		wait := interval
+		if len(events) > 0 {
+			wait = 0
+		}
+		select {
+		case <-stopC:
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package meta
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+func checkTestEvents(t *testing.T, events []*proto.MetaEvent, types ...string) {
+	t.Helper()
+	if len(events) != len(types) {
+		t.Fatalf("expect events %v, got %v", types, events)
+	}
+	for i, e := range events {
+		if e.Type != types[i] || e.ParentID != proto.RootIno || e.Name != "a" {
+			t.Fatalf("expect event %v of a, got %v", types[i], e)
+		}
+	}
+}
+
+func TestChangeStream(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+
+	offset, err := mw.ChangeOffset(mocktest.PartitionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := mw.OpenChangeStream(mocktest.PartitionID, offset)
+	if events, err := cs.Next(); err != nil || len(events) != 0 || cs.Offset() != offset {
+		t.Fatalf("expect no events, got %v offset %v err %v", events, cs.Offset(), err)
+	}
+
+	// the changes of the inodes are not notified
+	file := createFile(t, mw, proto.RootIno, "a", 0644)
+	events, err := cs.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestEvents(t, events, proto.MetaEventCreate)
+	if events[0].Inode != file.Inode || cs.Offset() != events[0].Offset {
+		t.Fatalf("expect the event of inode %v at the offset, got %v offset %v", file.Inode, events[0], cs.Offset())
+	}
+
+	// the offset is advanced by the changes without events
+	if _, err = mw.Create_ll(proto.RootIno, "a", proto.Mode(0644), 0, 0, nil); err == nil {
+		t.Fatalf("expect the existing file to be rejected")
+	}
+	last := cs.Offset()
+	if events, err = cs.Next(); err != nil || len(events) != 0 || cs.Offset() <= last {
+		t.Fatalf("expect the offset to be advanced without events, got %v offset %v err %v", events, cs.Offset(), err)
+	}
+
+	if _, err = mw.Delete_ll(proto.RootIno, "a", false); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = cs.Next(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestEvents(t, events, proto.MetaEventDelete)
+
+	// the stream from an offset no longer kept fails, and is resumed from the current offset
+	createFile(t, mw, proto.RootIno, "a", 0644)
+	vol.TruncateChanges()
+	if _, err = cs.Next(); err != ErrChangesTruncated {
+		t.Fatalf("expect the changes to be truncated, got %v", err)
+	}
+	if offset, err = mw.ChangeOffset(mocktest.PartitionID); err != nil || offset <= cs.Offset() {
+		t.Fatalf("expect the current offset after the stream, got %v err %v", offset, err)
+	}
+	if events, err = mw.OpenChangeStream(mocktest.PartitionID, offset).Next(); err != nil || len(events) != 0 {
+		t.Fatalf("expect no events after the current offset, got %v err %v", events, err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+	offset, err := mw.ChangeOffset(mocktest.PartitionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, mw, proto.RootIno, "a", 0644)
+	if _, err = mw.Delete_ll(proto.RootIno, "a", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the error of the handler stops the subscription
+	errStop := errors.New("stop")
+	var events []*proto.MetaEvent
+	err = mw.Subscribe(mocktest.PartitionID, offset, time.Millisecond, nil, func(e *proto.MetaEvent) error {
+		events = append(events, e)
+		if len(events) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("expect the error of the handler, got %v", err)
+	}
+	checkTestEvents(t, events, proto.MetaEventCreate, proto.MetaEventDelete)
+
+	// the subscription polls until stopped
+	if offset, err = mw.ChangeOffset(mocktest.PartitionID); err != nil {
+		t.Fatal(err)
+	}
+	stopC := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(stopC) })
+	events = nil
+	err = mw.Subscribe(mocktest.PartitionID, offset, time.Millisecond, stopC, func(e *proto.MetaEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expect no events until stopped, got %v err %v", events, err)
+	}
+}
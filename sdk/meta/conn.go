@@ -29,6 +29,7 @@ const (
 	SendRetryLimit    = 100
 	SendRetryInterval = 100 * time.Millisecond
 	SendTimeLimit     = 20 * time.Second
+	AuthRetryLimit    = 2
 )
 
 type MetaConn struct {
@@ -71,17 +72,16 @@ func (mw *MetaWrapper) sendToMetaPartition(mp *MetaPartition, req *proto.Packet)
 		start time.Time
 	)
 
+	if mw.snapshotID != 0 && !isReadOp(req.Opcode) {
+		return nil, errors.New(fmt.Sprintf("sendToMetaPartition failed: snapshot(%v) is read-only, req(%v)", mw.snapshotID, req))
+	}
+
 	addr = mp.LeaderAddr
 	if addr == "" {
 		err = errors.New(fmt.Sprintf("sendToMetaPartition failed: leader addr empty, req(%v) mp(%v)", req, mp))
 		goto retry
 	}
-	mc, err = mw.getConn(mp.PartitionID, addr)
-	if err != nil {
-		goto retry
-	}
-	resp, err = mc.send(req)
-	mw.putConn(mc, err)
+	mc, resp, err = mw.sendToAddr(mp, addr, req)
 	if err == nil && !resp.ShouldRetry() {
 		goto out
 	}
@@ -91,12 +91,7 @@ retry:
 	start = time.Now()
 	for i := 0; i < SendRetryLimit; i++ {
 		for _, addr = range mp.Members {
-			mc, err = mw.getConn(mp.PartitionID, addr)
-			if err != nil {
-				continue
-			}
-			resp, err = mc.send(req)
-			mw.putConn(mc, err)
+			mc, resp, err = mw.sendToAddr(mp, addr, req)
 			if err == nil && !resp.ShouldRetry() {
 				goto out
 			}
@@ -118,6 +113,24 @@ out:
 	return resp, nil
 }
 
+// Send the request to the given address. The metanode rejects the requests and closes the connection
+// once the ticket of the connection expires, so the request is resent through a new connection.
+func (mw *MetaWrapper) sendToAddr(mp *MetaPartition, addr string, req *proto.Packet) (mc *MetaConn, resp *proto.Packet, err error) {
+	for i := 0; i < AuthRetryLimit; i++ {
+		if mc, err = mw.getConn(mp.PartitionID, addr); err != nil {
+			return
+		}
+		resp, err = mc.send(req)
+		if err == nil && resp.ResultCode == proto.OpAuthErr {
+			mw.putConn(mc, errors.New(string(resp.Data)))
+			continue
+		}
+		mw.putConn(mc, err)
+		return
+	}
+	return
+}
+
 func (mc *MetaConn) send(req *proto.Packet) (resp *proto.Packet, err error) {
 	err = req.WriteToConn(mc.conn)
 	if err != nil {
@@ -130,3 +143,13 @@ func (mc *MetaConn) send(req *proto.Packet) (resp *proto.Packet, err error) {
 	}
 	return resp, nil
 }
+
+// Returns true if the operation only reads the metadata, which is allowed on a snapshot.
+func isReadOp(opcode uint8) bool {
+	switch opcode {
+	case proto.OpMetaLookup, proto.OpMetaInodeGet, proto.OpMetaBatchInodeGet, proto.OpMetaReadDir,
+		proto.OpMetaExtentsList, proto.OpMetaGetXAttr, proto.OpMetaListXAttr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The entries of a split directory are looked up in the shard which their names belong to, and then
+// in the partition of the directory inode, where the entries created before the split stay. The shards
+// are learned from the master, or from the partition of the directory inode, which rejects the requests
+// of the clients not aware of them along with the shards. The shards of a directory never change once it
+// is split, so the learned ones are kept even if the master has not recorded them yet.
+
+func (mw *MetaWrapper) updateDirShards(shards []*proto.DirShardInfo) {
+	mw.dirShardsLock.Lock()
+	defer mw.dirShardsLock.Unlock()
+	old, _ := mw.dirShards.Load().(map[uint64][]uint64)
+	dirShards := make(map[uint64][]uint64, len(old)+len(shards))
+	for ino, pids := range old {
+		dirShards[ino] = pids
+	}
+	for _, s := range shards {
+		if len(s.PartitionIDs) > 0 {
+			dirShards[s.Inode] = s.PartitionIDs
+		}
+	}
+	mw.dirShards.Store(dirShards)
+}
+
+// learnDirShards records the shards of the directory replied by the partition of its inode.
+func (mw *MetaWrapper) learnDirShards(status int, packet *proto.Packet) {
+	if status != statusDirShard || len(packet.Data) == 0 {
+		return
+	}
+	info := new(proto.DirShardInfo)
+	if err := packet.UnmarshalData(info); err != nil {
+		log.LogWarnf("learnDirShards: packet(%v) err(%v) PacketData(%v)", packet, err, string(packet.Data))
+		return
+	}
+	mw.updateDirShards([]*proto.DirShardInfo{info})
+}
+
+// retryDirShard returns true if the request rejected by the partition of the directory inode is to be
+// retried, after the shards are refreshed from the master if they are not replied by the partition.
+func (mw *MetaWrapper) retryDirShard(parentID uint64, status int, retry int) bool {
+	if status != statusDirShard || retry >= DirShardRetryLimit {
+		return false
+	}
+	if len(mw.getDirShards(parentID)) == 0 {
+		mw.updateMetaPartitions()
+	}
+	return true
+}
+
+// getDirShards returns the partitions of the shards of the directory, or nil if it is not split.
+func (mw *MetaWrapper) getDirShards(ino uint64) []uint64 {
+	dirShards, _ := mw.dirShards.Load().(map[uint64][]uint64)
+	return dirShards[ino]
+}
+
+// getDentryPartition returns the partition in which the entry of the directory is created, and whether
+// it is a shard other than the partition of the directory inode.
+func (mw *MetaWrapper) getDentryPartition(parentID uint64, name string) (mp *MetaPartition, shard bool) {
+	pids := mw.getDirShards(parentID)
+	if len(pids) == 0 {
+		return mw.getPartitionByInode(parentID), false
+	}
+	pid := proto.DirShardPartition(pids, parentID, name)
+	return mw.getPartitionByID(pid), pid != pids[0]
+}
+
+// lookupDentry returns the entry of the directory along with the partition it is found in.
+func (mw *MetaWrapper) lookupDentry(parentID uint64, name string) (mp *MetaPartition, status int, inode uint64, mode uint32, err error) {
+	for i := 0; ; i++ {
+		mp, status, inode, mode, err = mw.lookupShardDentry(parentID, name)
+		if err != nil || !mw.retryDirShard(parentID, status, i) {
+			return
+		}
+	}
+}
+
+func (mw *MetaWrapper) lookupShardDentry(parentID uint64, name string) (mp *MetaPartition, status int, inode uint64, mode uint32, err error) {
+	mp, shard := mw.getDentryPartition(parentID, name)
+	if mp == nil {
+		log.LogErrorf("lookupDentry: No dentry partition, parentID(%v) name(%v)", parentID, name)
+		return nil, statusNoent, 0, 0, nil
+	}
+	if shard {
+		status, inode, mode, err = mw.lookup(mp, parentID, name)
+		if err != nil || status != statusNoent {
+			return
+		}
+		if mp = mw.getPartitionByInode(parentID); mp == nil {
+			return nil, statusNoent, 0, 0, nil
+		}
+	}
+	status, inode, mode, err = mw.lookup(mp, parentID, name)
+	// the partition of the directory inode replies statusAgain if the sharded directory is being
+	// removed or removed, which has no entries in the partition then
+	if status == statusAgain && len(mw.getDirShards(parentID)) > 0 {
+		status = statusNoent
+	}
+	return
+}
+
+// createDentry creates the entry in the shard it belongs to. The partition of the directory inode
+// rejects the entries of the other shards, in which case the request is retried in the shard, and the
+// entries while the directory is being removed, in which case the request is retried until the
+// removal is done, as it is while the entry is locked by a transaction.
+func (mw *MetaWrapper) createDentry(parentID uint64, name string, inode uint64, mode uint32) (status int, err error) {
+	start := time.Now()
+	for i := 0; ; {
+		mp, shard := mw.getDentryPartition(parentID, name)
+		if mp == nil {
+			log.LogErrorf("createDentry: No dentry partition, parentID(%v) name(%v)", parentID, name)
+			return statusNoent, nil
+		}
+		status, err = mw.dcreate(mp, parentID, name, inode, mode, shard)
+		if err == nil && status == statusOK && shard {
+			status, err = mw.checkShardDentry(mp, parentID, name)
+		}
+		if err != nil {
+			return
+		}
+		if mw.retryDirShard(parentID, status, i) {
+			i++
+			continue
+		}
+		if status == statusAgain && len(mw.getDirShards(parentID)) > 0 {
+			if home := mw.getPartitionByInode(parentID); home != nil {
+				if st, _, e := mw.iget(home, parentID); e == nil && st == statusNoent {
+					return statusNoent, nil
+				}
+			}
+		}
+		if !retryAgain(status, start) {
+			return
+		}
+	}
+}
+
+// checkShardDentry checks the entry created in a shard other than the partition of the directory inode,
+// which is deleted if the entry has been created in the partition of the directory inode before the
+// split, or if the directory is being removed.
+func (mw *MetaWrapper) checkShardDentry(mp *MetaPartition, parentID uint64, name string) (status int, err error) {
+	home := mw.getPartitionByInode(parentID)
+	if home == nil {
+		status = statusNoent
+	} else {
+		status, _, _, err = mw.lookup(home, parentID, name)
+	}
+	if err == nil && status == statusNoent {
+		return statusOK, nil
+	}
+	if err == nil && status == statusOK {
+		status = statusExist
+	}
+	if st, _, e := mw.ddelete(mp, parentID, name); e != nil || (st != statusOK && st != statusNoent) {
+		log.LogErrorf("checkShardDentry: delete the dentry, parentID(%v) name(%v) status(%v) err(%v)", parentID, name, st, e)
+	}
+	return
+}
+
+// deleteDentry deletes the entry from the shard it belongs to, or from the partition of the directory
+// inode if it is created before the split. It is retried while the entry is locked by a transaction.
+func (mw *MetaWrapper) deleteDentry(parentID uint64, name string) (status int, inode uint64, err error) {
+	start := time.Now()
+	for i := 0; ; {
+		status, inode, err = mw.deleteShardDentry(parentID, name)
+		if err != nil {
+			return
+		}
+		if mw.retryDirShard(parentID, status, i) {
+			i++
+		} else if !retryAgain(status, start) {
+			return
+		}
+	}
+}
+
+func (mw *MetaWrapper) deleteShardDentry(parentID uint64, name string) (status int, inode uint64, err error) {
+	mp, shard := mw.getDentryPartition(parentID, name)
+	if mp == nil {
+		log.LogErrorf("deleteDentry: No dentry partition, parentID(%v) name(%v)", parentID, name)
+		return statusNoent, 0, nil
+	}
+	status, inode, err = mw.ddelete(mp, parentID, name)
+	if err != nil || status != statusNoent || !shard {
+		return
+	}
+	if mp = mw.getPartitionByInode(parentID); mp == nil {
+		return statusNoent, 0, nil
+	}
+	return mw.ddelete(mp, parentID, name)
+}
+
+// isDirShardsEmpty returns true if there are no entries of the directory in the shards other than
+// the partition of the directory inode, whose entries are counted by the nlink of the inode.
+func (mw *MetaWrapper) isDirShardsEmpty(ino uint64) (empty bool, status int) {
+	pids := mw.getDirShards(ino)
+	for i := 1; i < len(pids); i++ {
+		mp := mw.getPartitionByID(pids[i])
+		if mp == nil {
+			return false, statusAgain
+		}
+		st, children, _, err := mw.readdir(mp, ino, "", 1)
+		if err != nil || st != statusOK {
+			return false, statusAgain
+		}
+		if len(children) > 0 {
+			return false, statusOK
+		}
+	}
+	return true, statusOK
+}
+
+// readDirShards reads at most limit children after the marker from all the shards of the directory.
+// The children of each shard are sorted by name, so the first ones of all of them are merged.
+func (mw *MetaWrapper) readDirShards(pids []uint64, parentID uint64, marker string, limit uint64) (status int, children []proto.Dentry, next string, err error) {
+	more := false
+	children = make([]proto.Dentry, 0)
+	for _, pid := range pids {
+		mp := mw.getPartitionByID(pid)
+		if mp == nil {
+			return statusAgain, nil, "", nil
+		}
+		st, batch, batchNext, e := mw.readdir(mp, parentID, marker, limit)
+		if e != nil || st != statusOK {
+			return st, nil, "", e
+		}
+		children = append(children, batch...)
+		more = more || batchNext != ""
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	if limit > 0 && uint64(len(children)) > limit {
+		children = children[:limit]
+		more = true
+	}
+	if more && len(children) > 0 {
+		next = children[len(children)-1].Name
+	}
+	return statusOK, children, next, nil
+}
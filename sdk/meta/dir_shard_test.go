@@ -0,0 +1,31 @@
+package meta
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The shards learned from the partitions are kept by the refreshes of the view, which the master
+// may have not recorded them in yet.
+func TestLearnDirShards(t *testing.T) {
+	mw := new(MetaWrapper)
+	mw.updateDirShards([]*proto.DirShardInfo{{Inode: 10, PartitionIDs: []uint64{1, 2}}})
+
+	packet := proto.NewPacket()
+	packet.Data, _ = json.Marshal(&proto.DirShardInfo{Inode: 20, PartitionIDs: []uint64{3, 4}})
+	mw.learnDirShards(statusNoent, packet)
+	if pids := mw.getDirShards(20); pids != nil {
+		t.Fatalf("expect no shards learned from other errors, got %v", pids)
+	}
+	mw.learnDirShards(statusDirShard, packet)
+	mw.updateDirShards([]*proto.DirShardInfo{{Inode: 10, PartitionIDs: []uint64{1, 2}}})
+	if pids := mw.getDirShards(20); !reflect.DeepEqual(pids, []uint64{3, 4}) {
+		t.Fatalf("expect the learned shards to be kept, got %v", pids)
+	}
+	if pids := mw.getDirShards(10); !reflect.DeepEqual(pids, []uint64{1, 2}) {
+		t.Fatalf("expect the shards of the view, got %v", pids)
+	}
+}
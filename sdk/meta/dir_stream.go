@@ -0,0 +1,73 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// DirStream reads the children of a directory lazily, one batch of ReadDirLimit at a time. The
+// children are addressed by their offsets in the listing as in readdir(3), and only the current
+// batch is kept, so that a huge directory is never listed at once. It is not thread-safe.
+type DirStream struct {
+	mw    *MetaWrapper
+	ino   uint64
+	limit uint64 // the number of the children in a batch
+	start uint64 // the offset of the first child of the batch
+	batch []proto.Dentry
+	next  string // the marker to read the next batch
+	eof   bool   // whether the batch is the last one
+}
+
+// OpenDirStream returns a new stream of the children of the directory.
+func (mw *MetaWrapper) OpenDirStream(ino uint64) *DirStream {
+	return &DirStream{mw: mw, ino: ino, limit: ReadDirLimit}
+}
+
+// ReadAt returns the children from the offset to the end of the batch containing it, which are
+// empty at the end of the directory. The directory is read again from the start to seek backwards,
+// and at the offset 0 as rewinddir(3) does, so that the changes since the last read are seen.
+func (ds *DirStream) ReadAt(offset uint64) ([]proto.Dentry, error) {
+	if offset == 0 || offset < ds.start || ds.batch == nil {
+		ds.start, ds.batch, ds.next, ds.eof = 0, nil, "", false
+		if err := ds.readBatch(); err != nil {
+			return nil, err
+		}
+	}
+	for offset >= ds.start+uint64(len(ds.batch)) {
+		if ds.eof {
+			return nil, nil
+		}
+		ds.start += uint64(len(ds.batch))
+		if err := ds.readBatch(); err != nil {
+			return nil, err
+		}
+	}
+	return ds.batch[offset-ds.start:], nil
+}
+
+func (ds *DirStream) readBatch() error {
+	batch, next, err := ds.mw.ReadDirLimit_ll(ds.ino, ds.next, ds.limit)
+	if err != nil {
+		// read the batch again next time
+		ds.batch = nil
+		return err
+	}
+	if batch == nil {
+		batch = make([]proto.Dentry, 0)
+	}
+	ds.batch, ds.next, ds.eof = batch, next, next == ""
+	return nil
+}
@@ -0,0 +1,129 @@
+package meta
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func checkTestNames(t *testing.T, children []proto.Dentry, names ...string) {
+	t.Helper()
+	if len(children) != len(names) {
+		t.Fatalf("expect %v, got %v", names, children)
+	}
+	for i, c := range children {
+		if c.Name != names[i] {
+			t.Fatalf("expect %v, got %v", names, children)
+		}
+	}
+}
+
+func TestReadDirLimit(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+	dir, err := mw.Create_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty directory is read in an empty page
+	children, next, err := mw.ReadDirLimit_ll(dir.Inode, "", 2)
+	if err != nil || len(children) != 0 || next != "" {
+		t.Fatalf("expect an empty page, got %v next %q err %v", children, next, err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		createFile(t, mw, dir.Inode, name, 0644)
+	}
+	if children, next, err = mw.ReadDirLimit_ll(dir.Inode, "", 2); err != nil || next != "b" {
+		t.Fatalf("expect the marker b, got %q err %v", next, err)
+	}
+	checkTestNames(t, children, "a", "b")
+	if children, next, err = mw.ReadDirLimit_ll(dir.Inode, next, 2); err != nil || next != "" {
+		t.Fatalf("expect the last page, got next %q err %v", next, err)
+	}
+	checkTestNames(t, children, "c")
+	// a page of the limit exactly is not followed by an empty one
+	if children, next, err = mw.ReadDirLimit_ll(dir.Inode, "a", 2); err != nil || next != "" {
+		t.Fatalf("expect the last page, got next %q err %v", next, err)
+	}
+	checkTestNames(t, children, "b", "c")
+
+	// nothing is after the marker of the last name
+	if children, next, err = mw.ReadDirLimit_ll(dir.Inode, "c", 2); err != nil || len(children) != 0 || next != "" {
+		t.Fatalf("expect an empty page after the last name, got %v next %q err %v", children, next, err)
+	}
+	// the marker not found reads the names after it
+	if children, _, err = mw.ReadDirLimit_ll(dir.Inode, "bb", 2); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "c")
+
+	// all the children are read without the limit
+	if children, next, err = mw.ReadDirLimit_ll(dir.Inode, "", 0); err != nil || next != "" {
+		t.Fatalf("expect all the children, got next %q err %v", next, err)
+	}
+	checkTestNames(t, children, "a", "b", "c")
+}
+
+func TestDirStream(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+	dir, err := mw.Create_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := mw.OpenDirStream(dir.Inode)
+	ds.limit = 2
+	if children, err := ds.ReadAt(0); err != nil || len(children) != 0 {
+		t.Fatalf("expect the end of the empty directory, got %v err %v", children, err)
+	}
+
+	// the stream is rewound at the offset 0, and sees the children created since
+	createFile(t, mw, dir.Inode, "f0", 0644)
+	children, err := ds.ReadAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f0")
+	createFile(t, mw, dir.Inode, "f1", 0644)
+	if children, err = ds.ReadAt(0); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f0", "f1")
+
+	for i := 2; i < 5; i++ {
+		createFile(t, mw, dir.Inode, fmt.Sprintf("f%v", i), 0644)
+	}
+	if children, err = ds.ReadAt(0); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f0", "f1")
+	if children, err = ds.ReadAt(1); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f1")
+
+	// the entries created between the pages after the marker are read, and the ones before it are not
+	createFile(t, mw, dir.Inode, "a", 0644)
+	createFile(t, mw, dir.Inode, "f3a", 0644)
+	if children, err = ds.ReadAt(2); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f2", "f3")
+	if children, err = ds.ReadAt(4); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "f3a", "f4")
+	if children, err = ds.ReadAt(6); err != nil || len(children) != 0 {
+		t.Fatalf("expect the end of the directory, got %v err %v", children, err)
+	}
+
+	// seeking backwards reads the directory again from the start
+	if children, err = ds.ReadAt(0); err != nil {
+		t.Fatal(err)
+	}
+	checkTestNames(t, children, "a", "f0")
+}
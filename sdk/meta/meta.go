@@ -15,14 +15,19 @@
 package meta
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/auth"
 	"github.com/chubaofs/chubaofs/util/btree"
 	"github.com/chubaofs/chubaofs/util/errors"
 )
@@ -30,6 +35,8 @@ import (
 const (
 	HostsSeparator                = ","
 	RefreshMetaPartitionsInterval = time.Minute * 5
+	RefreshQuotasInterval         = time.Minute
+	RenewFileLocksInterval        = proto.FileLockLease / 3
 )
 
 const (
@@ -42,11 +49,27 @@ const (
 	statusError
 	statusInval
 	statusNotPerm
+	statusNoAttr
+	statusLocked
+	statusDirShard
+	statusNotEmpty
 )
 
 const (
 	MaxMountRetryLimit = 5
 	MountRetryInterval = time.Second * 5
+
+	// the number of the children read from the metanode in one request
+	ReadDirLimit = 1024
+
+	// the number of retries to create a dentry after the shards of the directory are refreshed
+	DirShardRetryLimit = 3
+
+	// The requests rejected by the locks of the transactions, or by the sharded directories being removed,
+	// are retried until the locks are released, which takes up to the timeout of the transactions on the
+	// metanodes if a coordinator fails.
+	AgainRetryTimeLimit = 90 * time.Second
+	AgainRetryInterval  = 200 * time.Millisecond
 )
 
 type MetaWrapper struct {
@@ -73,9 +96,35 @@ type MetaWrapper struct {
 
 	totalSize uint64
 	usedSize  uint64
+
+	// Quotas of the volume indexed by ID, i.e. map[uint32]*proto.QuotaInfo
+	quotas atomic.Value
+	// Quotas of the inodes recently checked
+	quotaCache *quotaCache
+
+	// The volume snapshot to read from if not zero, in which case the modifications are rejected.
+	snapshotID uint64
+
+	// Hours to keep the deleted files in the trash, zero if the trash is disabled.
+	trashRetention uint32
+
+	// Partitions of the shards of the split directories indexed by inode, i.e. map[uint64][]uint64,
+	// which are replaced as a whole under the lock.
+	dirShards     atomic.Value
+	dirShardsLock sync.Mutex
+
+	// The ID of the client in the file locks, and the inodes on which the client holds locks,
+	// whose leases are renewed periodically. An inode is mapped to the sequence of the latest
+	// lock acquired on it.
+	clientID       uint64
+	lockedInodes   map[uint64]uint64
+	lockSeq        uint64
+	lockedInodesMu sync.Mutex
 }
 
-func NewMetaWrapper(volname, owner, masterHosts string) (*MetaWrapper, error) {
+// NewMetaWrapper returns a new meta wrapper. If authenticator is not nil, the requests to the master
+// carry its tokens, and the connections to the metanodes are authenticated with its tickets.
+func NewMetaWrapper(volname, owner, masterHosts string, authenticator *auth.Authenticator) (*MetaWrapper, error) {
 	mw := new(MetaWrapper)
 	mw.volname = volname
 	mw.owner = owner
@@ -85,11 +134,23 @@ func NewMetaWrapper(volname, owner, masterHosts string) (*MetaWrapper, error) {
 		mw.master.AddNode(ip)
 	}
 	mw.conns = util.NewConnectPool()
+	if authenticator != nil {
+		mw.master.SetTokenFunc(func() (string, error) {
+			return authenticator.Token(proto.MasterServiceID)
+		})
+		mw.conns.SetHandshake(func(c *net.TCPConn) error {
+			return authenticator.Handshake(proto.MetaServiceID, c)
+		})
+	}
 	mw.partitions = make(map[uint64]*MetaPartition)
 	mw.ranges = btree.New(32)
 	mw.rwPartitions = make([]*MetaPartition, 0)
+	mw.clientID = newClientID()
+	mw.lockedInodes = make(map[uint64]uint64)
+	mw.quotaCache = newQuotaCache()
 	mw.updateClusterInfo()
 	mw.updateVolStatInfo()
+	mw.updateQuotas()
 
 	limit := MaxMountRetryLimit
 retry:
@@ -108,6 +169,29 @@ retry:
 	return mw, nil
 }
 
+// MountSnapshot makes the meta wrapper read from the given snapshot of the volume.
+// It must be called before any other operations, and the modifications are rejected afterwards.
+func (mw *MetaWrapper) MountSnapshot(name string) error {
+	snapshot, err := mw.getSnapshot(name)
+	if err != nil {
+		return err
+	}
+	if snapshot.Status != proto.SnapshotNormal {
+		return fmt.Errorf("snapshot(%v) is not ready", snapshot)
+	}
+	mw.snapshotID = snapshot.ID
+	return nil
+}
+
+// Returns a random ID, which identifies the client in the file locks.
+func newClientID() uint64 {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
 func (mw *MetaWrapper) Cluster() string {
 	return mw.cluster
 }
@@ -137,12 +221,32 @@ func parseStatus(result uint8) (status int) {
 		status = statusInval
 	case proto.OpNotPerm:
 		status = statusNotPerm
+	case proto.OpNoAttrErr:
+		status = statusNoAttr
+	case proto.OpLockConflictErr:
+		status = statusLocked
+	case proto.OpDirShardErr:
+		status = statusDirShard
+	case proto.OpNotEmtpy:
+		status = statusNotEmpty
+	case proto.OpAuthErr:
+		status = statusNotPerm
 	default:
 		status = statusError
 	}
 	return
 }
 
+// retryAgain returns true if the request rejected with statusAgain since the start is to be retried,
+// after waiting for a while.
+func retryAgain(status int, start time.Time) bool {
+	if status != statusAgain || time.Since(start) > AgainRetryTimeLimit {
+		return false
+	}
+	time.Sleep(AgainRetryInterval)
+	return true
+}
+
 func statusToErrno(status int) error {
 	switch status {
 	case statusOK:
@@ -160,6 +264,12 @@ func statusToErrno(status int) error {
 		return syscall.EINVAL
 	case statusNotPerm:
 		return syscall.EPERM
+	case statusNoAttr:
+		return syscall.ENODATA
+	case statusLocked, statusDirShard:
+		return syscall.EAGAIN
+	case statusNotEmpty:
+		return syscall.ENOTEMPTY
 	case statusError:
 		return syscall.EPERM
 	default:
@@ -0,0 +1,730 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package mocktest provides a volume served by a mock master and a mock metanode in memory,
+// against which the clients of the meta sdk are tested.
+package mocktest
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const (
+	PartitionID = 1
+	ClusterName = "mocktest"
+)
+
+// MockVolume is a volume of a single meta partition. Its namespace is kept in memory by the
+// mock metanode, which applies the requests at once without replication.
+type MockVolume struct {
+	Name           string
+	TrashRetention uint32
+
+	master   *httptest.Server
+	listener net.Listener
+
+	sync.Mutex
+	cursor      uint64
+	inodes      map[uint64]*mockInode
+	dentries    map[uint64]map[string]*proto.Dentry // indexed by parent and name
+	applyID     uint64
+	changes     []*proto.MetaChange // the changes after changesFrom, one for each apply ID
+	changesFrom uint64
+	quotas      map[uint32]*proto.QuotaInfo
+}
+
+type mockInode struct {
+	proto.InodeInfo
+	extents []proto.ExtentKey
+	xattrs  map[string][]byte
+}
+
+// NewMockVolume starts the mock master and metanode of a volume with an empty root directory.
+func NewMockVolume(name string) (*MockVolume, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	v := &MockVolume{
+		Name:     name,
+		listener: listener,
+		cursor:   proto.RootIno,
+		inodes:   make(map[uint64]*mockInode),
+		dentries: make(map[uint64]map[string]*proto.Dentry),
+		quotas:   make(map[uint32]*proto.QuotaInfo),
+	}
+	v.inodes[proto.RootIno] = newMockInode(proto.RootIno, proto.Mode(os.ModeDir|0755), 0, 0)
+	v.master = httptest.NewServer(http.HandlerFunc(v.serveMaster))
+	go v.serveMeta()
+	return v, nil
+}
+
+// MasterAddr returns the address of the mock master, to which the meta wrapper is pointed.
+func (v *MockVolume) MasterAddr() string {
+	return strings.TrimPrefix(v.master.URL, "http://")
+}
+
+// Inode returns a copy of the inode, or nil if it does not exist.
+func (v *MockVolume) Inode(ino uint64) *proto.InodeInfo {
+	v.Lock()
+	defer v.Unlock()
+	i, ok := v.inodes[ino]
+	if !ok {
+		return nil
+	}
+	info := i.InodeInfo
+	return &info
+}
+
+// SetQuota adds the quota, or updates its limits and usage, and accounts the tree of its root inode to it
+// as the master does. The usage is reported as given, instead of being counted from the inodes.
+func (v *MockVolume) SetQuota(quota *proto.QuotaInfo) {
+	v.Lock()
+	defer v.Unlock()
+	q := *quota
+	v.quotas[q.QuotaID] = &q
+	v.setInodeQuota(&proto.SetInodeQuotaRequest{Inodes: []uint64{q.RootInode}, QuotaID: q.QuotaID,
+		Dirs: []uint64{q.RootInode}})
+}
+
+// TruncateChanges drops the changes recorded, so that the changes before are read as truncated.
+func (v *MockVolume) TruncateChanges() {
+	v.Lock()
+	defer v.Unlock()
+	v.changes, v.changesFrom = nil, v.applyID
+}
+
+// Close stops the mock master and metanode.
+func (v *MockVolume) Close() {
+	v.master.Close()
+	v.listener.Close()
+}
+
+func newMockInode(ino uint64, mode, uid, gid uint32) *mockInode {
+	now := time.Now()
+	i := &mockInode{
+		InodeInfo: proto.InodeInfo{
+			Inode:      ino,
+			Mode:       mode,
+			Nlink:      1,
+			Uid:        uid,
+			Gid:        gid,
+			Generation: 1,
+			ModifyTime: now,
+			CreateTime: now,
+			AccessTime: now,
+		},
+		xattrs: make(map[string][]byte),
+	}
+	if proto.IsDir(mode) {
+		i.Nlink = 2
+	}
+	return i
+}
+
+// Same as the metanode, the ACLs are kept as the extended attributes, and returned with the inode info.
+func (i *mockInode) setXAttr(key string, val []byte) {
+	i.xattrs[key] = val
+	i.updateACL(key)
+}
+
+func (i *mockInode) removeXAttr(key string) {
+	delete(i.xattrs, key)
+	i.updateACL(key)
+}
+
+func (i *mockInode) updateACL(key string) {
+	switch key {
+	case proto.XAttrACLAccess:
+		i.ACL = i.xattrs[key]
+	case proto.XAttrACLDefault:
+		i.DefaultACL = i.xattrs[key]
+	}
+}
+
+// Same as the metanode, the ACLs are only changed by the owner of the inode or root.
+func (i *mockInode) checkACLCaller(key string, c *proto.Caller) uint8 {
+	if key != proto.XAttrACLAccess && key != proto.XAttrACLDefault {
+		return proto.OpOk
+	}
+	if c == nil || !c.IsRoot() && c.Uid != i.Uid {
+		return proto.OpNotPerm
+	}
+	return proto.OpOk
+}
+
+// Same as the metanode, the nlink of a directory drops to zero once its last child is removed.
+func (i *mockInode) decNlink() {
+	if proto.IsDir(i.Mode) && i.Nlink == 2 {
+		i.Nlink--
+	}
+	if i.Nlink > 0 {
+		i.Nlink--
+	}
+}
+
+func (v *MockVolume) serveMaster(w http.ResponseWriter, r *http.Request) {
+	var data interface{}
+	switch r.URL.Path {
+	case proto.AdminGetIP:
+		data = &proto.ClusterInfo{Cluster: ClusterName, Ip: "127.0.0.1"}
+	case proto.ClientVolStat:
+		data = map[string]interface{}{"Name": v.Name, "TotalSize": uint64(1 << 40), "UsedSize": uint64(0)}
+	case proto.AdminListQuota:
+		data = v.listQuotas()
+	case proto.ClientVol:
+		addr := v.listener.Addr().String()
+		data = map[string]interface{}{
+			"VolName":        v.Name,
+			"TrashRetention": v.TrashRetention,
+			"MetaPartitions": []map[string]interface{}{{
+				"PartitionID": PartitionID,
+				"Start":       uint64(0),
+				"End":         uint64(math.MaxUint64),
+				"Members":     []string{addr},
+				"LeaderAddr":  addr,
+				"Status":      proto.ReadWrite,
+			}},
+		}
+	default:
+		http.Error(w, "unsupported", http.StatusNotFound)
+		return
+	}
+	reply, _ := json.Marshal(&proto.HTTPReply{Code: proto.ErrCodeSuccess, Msg: "success", Data: data})
+	w.Write(reply)
+}
+
+func (v *MockVolume) serveMeta() {
+	for {
+		conn, err := v.listener.Accept()
+		if err != nil {
+			return
+		}
+		go v.serveConn(conn)
+	}
+}
+
+func (v *MockVolume) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		p := proto.NewPacket()
+		if err := p.ReadFromConn(conn, proto.NoReadDeadlineTime); err != nil {
+			return
+		}
+		v.Lock()
+		resp, status := v.handle(p)
+		v.Unlock()
+		if status != proto.OpOk {
+			p.PacketErrorWithBody(status, nil)
+		} else if resp != nil {
+			data, _ := json.Marshal(resp)
+			p.PacketOkWithBody(data)
+		} else {
+			p.PacketOkReply()
+		}
+		if err := p.WriteToConn(conn); err != nil {
+			return
+		}
+	}
+}
+
+func (v *MockVolume) handle(p *proto.Packet) (resp interface{}, status uint8) {
+	switch p.Opcode {
+	case proto.OpMetaLookup:
+		req := new(proto.LookupRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		d, ok := v.dentries[req.ParentID][req.Name]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		return &proto.LookupResponse{Inode: d.Inode, Mode: d.Type}, proto.OpOk
+	case proto.OpMetaInodeGet:
+		req := new(proto.InodeGetRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		info := i.InodeInfo
+		return &proto.InodeGetResponse{Info: &info}, proto.OpOk
+	case proto.OpMetaBatchInodeGet:
+		req := new(proto.BatchInodeGetRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		infos := make([]*proto.InodeInfo, 0, len(req.Inodes))
+		for _, ino := range req.Inodes {
+			if i, ok := v.inodes[ino]; ok {
+				info := i.InodeInfo
+				infos = append(infos, &info)
+			}
+		}
+		return &proto.BatchInodeGetResponse{Infos: infos}, proto.OpOk
+	case proto.OpMetaCreateInode:
+		req := new(proto.CreateInodeRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		v.cursor++
+		i := newMockInode(v.cursor, req.Mode, req.Uid, req.Gid)
+		i.Target = req.Target
+		i.QuotaIDs = req.QuotaIDs
+		if len(req.ACL) > 0 {
+			i.setXAttr(proto.XAttrACLAccess, req.ACL)
+		}
+		if len(req.DefaultACL) > 0 {
+			i.setXAttr(proto.XAttrACLDefault, req.DefaultACL)
+		}
+		v.inodes[i.Inode] = i
+		v.addChange(proto.MetaChangeCreateInode, i.Inode, 0, "")
+		info := i.InodeInfo
+		return &proto.CreateInodeResponse{Info: &info}, proto.OpOk
+	case proto.OpMetaLinkInode, proto.OpMetaUnlinkInode:
+		req := new(proto.LinkInodeRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		if p.Opcode == proto.OpMetaLinkInode {
+			i.Nlink++
+		} else {
+			i.decNlink()
+		}
+		info := i.InodeInfo
+		return &proto.LinkInodeResponse{Info: &info}, proto.OpOk
+	case proto.OpMetaEvictInode:
+		req := new(proto.EvictInodeRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		if i, ok := v.inodes[req.Inode]; ok && i.Nlink == 0 {
+			delete(v.inodes, req.Inode)
+		}
+		return nil, proto.OpOk
+	case proto.OpMetaCreateDentry:
+		req := new(proto.CreateDentryRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		return nil, v.createDentry(req.ParentID, req.Name, req.Inode, req.Mode)
+	case proto.OpMetaUpdateDentry:
+		req := new(proto.UpdateDentryRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		d, ok := v.dentries[req.ParentID][req.Name]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		d.Inode, req.Inode = req.Inode, d.Inode
+		return &proto.UpdateDentryResponse{Inode: req.Inode}, proto.OpOk
+	case proto.OpMetaDeleteDentry:
+		req := new(proto.DeleteDentryRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		d, status := v.deleteDentry(req.ParentID, req.Name)
+		if status != proto.OpOk {
+			return nil, status
+		}
+		return &proto.DeleteDentryResponse{Inode: d.Inode}, proto.OpOk
+	case proto.OpMetaReadDir:
+		req := new(proto.ReadDirRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		return v.readDir(req), proto.OpOk
+	case proto.OpMetaExtentsList:
+		req := new(proto.GetExtentsRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		return &proto.GetExtentsResponse{Generation: i.Generation, Size: i.Size, Extents: i.extents}, proto.OpOk
+	case proto.OpMetaExtentsAdd:
+		req := new(proto.AppendExtentKeyRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		i.extents = append(i.extents, req.Extent)
+		if end := req.Extent.FileOffset + uint64(req.Extent.Size); end > i.Size {
+			i.Size = end
+		}
+		i.Generation++
+		return nil, proto.OpOk
+	case proto.OpMetaExtentsOverwrite:
+		req := new(proto.OverwriteExtentsRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		i.Generation++
+		return nil, proto.OpOk
+	case proto.OpMetaTruncate:
+		req := new(proto.TruncateRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		i.Size = req.Size
+		i.Generation++
+		return nil, proto.OpOk
+	case proto.OpMetaSetattr:
+		req := new(proto.SetAttrRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		if req.Valid&proto.AttrMode != 0 {
+			i.Mode = req.Mode
+		}
+		if req.Valid&proto.AttrUid != 0 {
+			i.Uid = req.Uid
+		}
+		if req.Valid&proto.AttrGid != 0 {
+			i.Gid = req.Gid
+		}
+		return nil, proto.OpOk
+	case proto.OpMetaSetXAttr:
+		req := new(proto.SetXAttrRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		if req.Key == proto.XAttrACLAccess || req.Key == proto.XAttrACLDefault {
+			if _, err := proto.ParseACL(req.Value); err != nil {
+				return nil, proto.OpArgMismatchErr
+			}
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		if status = i.checkACLCaller(req.Key, req.Caller); status != proto.OpOk {
+			return
+		}
+		_, exist := i.xattrs[req.Key]
+		if exist && req.Flags&proto.XAttrCreate != 0 {
+			return nil, proto.OpExistErr
+		}
+		if !exist && req.Flags&proto.XAttrReplace != 0 {
+			return nil, proto.OpNoAttrErr
+		}
+		i.setXAttr(req.Key, req.Value)
+		return nil, proto.OpOk
+	case proto.OpMetaGetXAttr:
+		req := new(proto.GetXAttrRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		val, ok := i.xattrs[req.Key]
+		if !ok {
+			return nil, proto.OpNoAttrErr
+		}
+		return &proto.GetXAttrResponse{Value: val}, proto.OpOk
+	case proto.OpMetaListXAttr:
+		req := new(proto.ListXAttrRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		keys := make([]string, 0, len(i.xattrs))
+		for key := range i.xattrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return &proto.ListXAttrResponse{Keys: keys}, proto.OpOk
+	case proto.OpMetaRemoveXAttr:
+		req := new(proto.RemoveXAttrRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		i, ok := v.inodes[req.Inode]
+		if !ok {
+			return nil, proto.OpNotExistErr
+		}
+		if status = i.checkACLCaller(req.Key, req.Caller); status != proto.OpOk {
+			return
+		}
+		if _, ok = i.xattrs[req.Key]; !ok {
+			return nil, proto.OpNoAttrErr
+		}
+		i.removeXAttr(req.Key)
+		return nil, proto.OpOk
+	case proto.OpMetaSetInodeQuota:
+		req := new(proto.SetInodeQuotaRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		if req.QuotaID == 0 {
+			return nil, proto.OpArgMismatchErr
+		}
+		v.setInodeQuota(req)
+		return nil, proto.OpOk
+	case proto.OpMetaTxRename:
+		req := new(proto.TxRenameRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		return nil, v.rename(req)
+	case proto.OpMetaRestoreTrash:
+		req := new(proto.RestoreTrashRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		return nil, v.restoreTrash(req.Name)
+	case proto.OpMetaReadChanges:
+		req := new(proto.ReadMetaChangesRequest)
+		if status = unmarshal(p, req); status != proto.OpOk {
+			return
+		}
+		return v.readChanges(req), proto.OpOk
+	case proto.OpMetaMarkDirRemoving:
+		// the directories of the mock volume are never split
+		return nil, proto.OpArgMismatchErr
+	default:
+		return nil, proto.OpErr
+	}
+}
+
+func unmarshal(p *proto.Packet, v interface{}) uint8 {
+	if err := json.Unmarshal(p.Data, v); err != nil {
+		return proto.OpErr
+	}
+	return proto.OpOk
+}
+
+func (v *MockVolume) createDentry(parentID uint64, name string, ino uint64, mode uint32) uint8 {
+	parent, ok := v.inodes[parentID]
+	if !ok {
+		return proto.OpNotExistErr
+	}
+	if !proto.IsDir(parent.Mode) {
+		return proto.OpArgMismatchErr
+	}
+	children := v.dentries[parentID]
+	if children == nil {
+		children = make(map[string]*proto.Dentry)
+		v.dentries[parentID] = children
+	}
+	if d, ok := children[name]; ok {
+		if d.Inode == ino {
+			return proto.OpOk
+		}
+		return proto.OpExistErr
+	}
+	children[name] = &proto.Dentry{Name: name, Inode: ino, Type: mode}
+	parent.Nlink++
+	v.addChange(proto.MetaChangeCreateDentry, ino, parentID, name)
+	return proto.OpOk
+}
+
+func (v *MockVolume) deleteDentry(parentID uint64, name string) (*proto.Dentry, uint8) {
+	d, ok := v.dentries[parentID][name]
+	if !ok {
+		return nil, proto.OpNotExistErr
+	}
+	delete(v.dentries[parentID], name)
+	if parent, ok := v.inodes[parentID]; ok {
+		parent.decNlink()
+	}
+	v.addChange(proto.MetaChangeDeleteDentry, d.Inode, parentID, name)
+	return d, proto.OpOk
+}
+
+func (v *MockVolume) listQuotas() []*proto.QuotaInfo {
+	v.Lock()
+	defer v.Unlock()
+	quotas := make([]*proto.QuotaInfo, 0, len(v.quotas))
+	for _, q := range v.quotas {
+		quota := *q
+		quotas = append(quotas, &quota)
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].QuotaID < quotas[j].QuotaID })
+	return quotas
+}
+
+// Accounts the inodes, and the trees beneath the directories at once, to the quota, or removes them from it.
+func (v *MockVolume) setInodeQuota(req *proto.SetInodeQuotaRequest) {
+	inodes := append([]uint64(nil), req.Inodes...)
+	for dirs := append([]uint64(nil), req.Dirs...); len(dirs) > 0; dirs = dirs[1:] {
+		for _, d := range v.dentries[dirs[0]] {
+			inodes = append(inodes, d.Inode)
+			if proto.IsDir(d.Type) {
+				dirs = append(dirs, d.Inode)
+			}
+		}
+	}
+	for _, ino := range inodes {
+		i, ok := v.inodes[ino]
+		if !ok {
+			continue
+		}
+		quotaIDs := make([]uint32, 0, len(i.QuotaIDs)+1)
+		for _, id := range i.QuotaIDs {
+			if id != req.QuotaID {
+				quotaIDs = append(quotaIDs, id)
+			}
+		}
+		if !req.Remove {
+			quotaIDs = append(quotaIDs, req.QuotaID)
+		}
+		if len(quotaIDs) == 0 {
+			quotaIDs = nil
+		}
+		i.QuotaIDs = quotaIDs
+	}
+}
+
+// Records the change with the next apply ID, as the metanode does for each raft log entry.
+func (v *MockVolume) addChange(typ uint8, ino, parentID uint64, name string) {
+	v.applyID++
+	v.changes = append(v.changes, &proto.MetaChange{
+		ApplyID:  v.applyID,
+		Time:     time.Now().Unix(),
+		Type:     typ,
+		Inode:    ino,
+		ParentID: parentID,
+		Name:     name,
+	})
+}
+
+func (v *MockVolume) readChanges(req *proto.ReadMetaChangesRequest) *proto.ReadMetaChangesResponse {
+	resp := &proto.ReadMetaChangesResponse{ApplyID: v.applyID}
+	if req.From < v.changesFrom {
+		resp.Truncated = true
+		return resp
+	}
+	for _, c := range v.changes {
+		if len(resp.Changes) >= req.Limit {
+			break
+		}
+		if c.ApplyID > req.From {
+			change := *c
+			resp.Changes = append(resp.Changes, &change)
+		}
+	}
+	return resp
+}
+
+func (v *MockVolume) readDir(req *proto.ReadDirRequest) *proto.ReadDirResponse {
+	names := make([]string, 0, len(v.dentries[req.ParentID]))
+	for name := range v.dentries[req.ParentID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// same as the metanode, the children after the marker are read up to the limit
+	resp := &proto.ReadDirResponse{Children: make([]proto.Dentry, 0, len(names))}
+	for _, name := range names {
+		if name <= req.Marker {
+			continue
+		}
+		if req.Limit > 0 && uint64(len(resp.Children)) >= req.Limit {
+			resp.NextMarker = resp.Children[len(resp.Children)-1].Name
+			break
+		}
+		resp.Children = append(resp.Children, *v.dentries[req.ParentID][name])
+	}
+	return resp
+}
+
+// Renames in one step, with the same checks as the transaction on the metanode.
+func (v *MockVolume) rename(req *proto.TxRenameRequest) uint8 {
+	src, ok := v.dentries[req.SrcParentID][req.SrcName]
+	if !ok || src.Inode != req.Inode {
+		return proto.OpNotExistErr
+	}
+	if req.OldInode == 0 {
+		if status := v.createDentry(req.DstParentID, req.DstName, req.Inode, req.Mode); status != proto.OpOk {
+			return status
+		}
+	} else {
+		dst, ok := v.dentries[req.DstParentID][req.DstName]
+		if !ok || dst.Inode != req.OldInode {
+			return proto.OpNotExistErr
+		}
+		if proto.IsDir(dst.Type) != proto.IsDir(req.Mode) {
+			return proto.OpArgMismatchErr
+		}
+		dst.Inode, dst.Type = req.Inode, req.Mode
+		if old, ok := v.inodes[req.OldInode]; ok {
+			old.decNlink()
+		}
+	}
+	v.deleteDentry(req.SrcParentID, req.SrcName)
+	return proto.OpOk
+}
+
+func (v *MockVolume) restoreTrash(name string) uint8 {
+	entry, err := proto.ParseTrashEntry(name, 0, 0)
+	if err != nil {
+		return proto.OpArgMismatchErr
+	}
+	trash, ok := v.dentries[proto.RootIno][proto.TrashDirName]
+	if !ok {
+		return proto.OpNotExistErr
+	}
+	d, ok := v.dentries[trash.Inode][name]
+	if !ok {
+		return proto.OpNotExistErr
+	}
+	return v.rename(&proto.TxRenameRequest{
+		SrcParentID: trash.Inode,
+		SrcName:     name,
+		DstParentID: entry.ParentID,
+		DstName:     entry.OrigName,
+		Inode:       d.Inode,
+		Mode:        d.Type,
+	})
+}
@@ -28,7 +28,7 @@ import (
 // API implementations
 //
 
-func (mw *MetaWrapper) icreate(mp *MetaPartition, mode, uid, gid uint32, target []byte) (status int, info *proto.InodeInfo, err error) {
+func (mw *MetaWrapper) icreate(mp *MetaPartition, mode, uid, gid uint32, target []byte, quotaIDs []uint32, acl, defaultACL []byte) (status int, info *proto.InodeInfo, err error) {
 	req := &proto.CreateInodeRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -36,6 +36,9 @@ func (mw *MetaWrapper) icreate(mp *MetaPartition, mode, uid, gid uint32, target
 		Uid:         uid,
 		Gid:         gid,
 		Target:      target,
+		QuotaIDs:    quotaIDs,
+		ACL:         acl,
+		DefaultACL:  defaultACL,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -151,7 +154,44 @@ func (mw *MetaWrapper) ievict(mp *MetaPartition, inode uint64) (status int, err
 	return statusOK, nil
 }
 
-func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32) (status int, err error) {
+func (mw *MetaWrapper) setInodeQuota(mp *MetaPartition, inodes, dirs []uint64, quotaID uint32, remove bool) (status int, err error) {
+	req := &proto.SetInodeQuotaRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inodes:      inodes,
+		QuotaID:     quotaID,
+		Dirs:        dirs,
+		Remove:      remove,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaSetInodeQuota
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogWarnf("setInodeQuota: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogWarnf("setInodeQuota: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogWarnf("setInodeQuota: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("setInodeQuota exit: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string, inode uint64, mode uint32, shard bool) (status int, err error) {
 	if parentID == inode {
 		return statusExist, nil
 	}
@@ -163,6 +203,7 @@ func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string,
 		Inode:       inode,
 		Name:        name,
 		Mode:        mode,
+		Shard:       shard,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -185,6 +226,7 @@ func (mw *MetaWrapper) dcreate(mp *MetaPartition, parentID uint64, name string,
 	status = parseStatus(packet.ResultCode)
 	if status != statusOK {
 		log.LogErrorf("dcreate: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		mw.learnDirShards(status, packet)
 	}
 	log.LogDebugf("dcreate: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
 	return
@@ -242,6 +284,7 @@ func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string)
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
 		Name:        name,
+		Shards:      len(mw.getDirShards(parentID)) > 0,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -264,6 +307,7 @@ func (mw *MetaWrapper) ddelete(mp *MetaPartition, parentID uint64, name string)
 	status = parseStatus(packet.ResultCode)
 	if status != statusOK {
 		log.LogErrorf("ddelete: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		mw.learnDirShards(status, packet)
 		return
 	}
 
@@ -283,6 +327,8 @@ func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
 		Name:        name,
+		SnapshotID:  mw.snapshotID,
+		Shards:      len(mw.getDirShards(parentID)) > 0,
 	}
 	packet := proto.NewPacketReqID()
 	packet.Opcode = proto.OpMetaLookup
@@ -307,6 +353,7 @@ func (mw *MetaWrapper) lookup(mp *MetaPartition, parentID uint64, name string) (
 	if status != statusOK {
 		if status != statusNoent {
 			log.LogErrorf("lookup: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+			mw.learnDirShards(status, packet)
 		} else {
 			log.LogDebugf("lookup exit: packet(%v) mp(%v) req(%v) NoEntry", packet, mp, *req)
 		}
@@ -328,6 +375,7 @@ func (mw *MetaWrapper) iget(mp *MetaPartition, inode uint64) (status int, info *
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inode:       inode,
+		SnapshotID:  mw.snapshotID,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -371,6 +419,7 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inodes:      inodes,
+		SnapshotID:  mw.snapshotID,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -412,11 +461,15 @@ func (mw *MetaWrapper) batchIget(wg *sync.WaitGroup, mp *MetaPartition, inodes [
 	}
 }
 
-func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int, children []proto.Dentry, err error) {
+func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64, marker string, limit uint64) (status int, children []proto.Dentry, next string, err error) {
 	req := &proto.ReadDirRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		ParentID:    parentID,
+		SnapshotID:  mw.snapshotID,
+		Marker:      marker,
+		Limit:       limit,
+		Shards:      len(mw.getDirShards(parentID)) > 0,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -440,6 +493,7 @@ func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int,
 	if status != statusOK {
 		children = make([]proto.Dentry, 0)
 		log.LogErrorf("readdir: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		mw.learnDirShards(status, packet)
 		return
 	}
 
@@ -449,8 +503,8 @@ func (mw *MetaWrapper) readdir(mp *MetaPartition, parentID uint64) (status int,
 		log.LogErrorf("readdir: packet(%v) mp(%v) err(%v) PacketData(%v)", packet, mp, err, string(packet.Data))
 		return
 	}
-	log.LogDebugf("readdir: packet(%v) mp(%v) req(%v)", packet, mp, *req)
-	return statusOK, resp.Children, nil
+	log.LogDebugf("readdir: packet(%v) mp(%v) req(%v) children(%v) next(%v)", packet, mp, *req, len(resp.Children), resp.NextMarker)
+	return statusOK, resp.Children, resp.NextMarker, nil
 }
 
 func (mw *MetaWrapper) appendExtentKey(mp *MetaPartition, inode uint64, extent proto.ExtentKey) (status int, err error) {
@@ -485,11 +539,43 @@ func (mw *MetaWrapper) appendExtentKey(mp *MetaPartition, inode uint64, extent p
 	return status, nil
 }
 
+func (mw *MetaWrapper) overwriteExtents(mp *MetaPartition, inode uint64) (status int, err error) {
+	req := &proto.OverwriteExtentsRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaExtentsOverwrite
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("overwriteExtents: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("overwriteExtents: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("overwriteExtents: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+	}
+	return status, nil
+}
+
 func (mw *MetaWrapper) getExtents(mp *MetaPartition, inode uint64) (status int, gen, size uint64, extents []proto.ExtentKey, err error) {
 	req := &proto.GetExtentsRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
 		Inode:       inode,
+		SnapshotID:  mw.snapshotID,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -609,7 +695,7 @@ func (mw *MetaWrapper) ilink(mp *MetaPartition, inode uint64) (status int, info
 	return statusOK, resp.Info, nil
 }
 
-func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid, gid uint32) (status int, err error) {
+func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid, gid uint32, caller *proto.Caller) (status int, err error) {
 	req := &proto.SetAttrRequest{
 		VolName:     mw.volname,
 		PartitionID: mp.PartitionID,
@@ -618,6 +704,7 @@ func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid
 		Mode:        mode,
 		Uid:         uid,
 		Gid:         gid,
+		Caller:      caller,
 	}
 
 	packet := proto.NewPacketReqID()
@@ -648,3 +735,437 @@ func (mw *MetaWrapper) setattr(mp *MetaPartition, inode uint64, valid, mode, uid
 	log.LogDebugf("setattr exit: packet(%v) mp(%v) req(%v)", packet, mp, *req)
 	return statusOK, nil
 }
+
+func (mw *MetaWrapper) setXAttr(mp *MetaPartition, inode uint64, name string, value []byte, flags uint32, caller *proto.Caller) (status int, err error) {
+	req := &proto.SetXAttrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Key:         name,
+		Value:       value,
+		Flags:       flags,
+		Caller:      caller,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaSetXAttr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("setXAttr: ino(%v) name(%v) err(%v)", inode, name, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("setXAttr: packet(%v) mp(%v) ino(%v) name(%v) err(%v)", packet, mp, inode, name, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("setXAttr: packet(%v) mp(%v) ino(%v) name(%v) result(%v)", packet, mp, inode, name, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("setXAttr: packet(%v) mp(%v) ino(%v) name(%v)", packet, mp, inode, name)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) getXAttr(mp *MetaPartition, inode uint64, name string) (status int, value []byte, err error) {
+	req := &proto.GetXAttrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Key:         name,
+		SnapshotID:  mw.snapshotID,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaGetXAttr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("getXAttr: ino(%v) name(%v) err(%v)", inode, name, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("getXAttr: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		// a missing attribute is a common case, e.g. security.capability
+		log.LogDebugf("getXAttr: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp := new(proto.GetXAttrResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("getXAttr: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("getXAttr: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, resp.Value, nil
+}
+
+func (mw *MetaWrapper) listXAttr(mp *MetaPartition, inode uint64) (status int, names []string, err error) {
+	req := &proto.ListXAttrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		SnapshotID:  mw.snapshotID,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaListXAttr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("listXAttr: ino(%v) err(%v)", inode, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("listXAttr: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("listXAttr: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp := new(proto.ListXAttrResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("listXAttr: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("listXAttr: packet(%v) mp(%v) req(%v) names(%v)", packet, mp, *req, resp.Keys)
+	return statusOK, resp.Keys, nil
+}
+
+func (mw *MetaWrapper) removeXAttr(mp *MetaPartition, inode uint64, name string, caller *proto.Caller) (status int, err error) {
+	req := &proto.RemoveXAttrRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Key:         name,
+		Caller:      caller,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaRemoveXAttr
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("removeXAttr: ino(%v) name(%v) err(%v)", inode, name, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("removeXAttr: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("removeXAttr: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("removeXAttr: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) txRename(mp *MetaPartition, req *proto.TxRenameRequest) (status int, err error) {
+	req.VolName = mw.volname
+	req.PartitionID = mp.PartitionID
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaTxRename
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("txRename: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("txRename: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("txRename: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("txRename: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) setLock(mp *MetaPartition, inode uint64, lock *proto.FileLock) (status int, err error) {
+	req := &proto.SetLockRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Lock:        *lock,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaSetLock
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("setLock: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("setLock: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		// a conflicting lock is a common case, e.g. waiting for a lock
+		log.LogDebugf("setLock: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("setLock: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) getLock(mp *MetaPartition, inode uint64, lock *proto.FileLock) (status int, conflict *proto.FileLock, err error) {
+	req := &proto.GetLockRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Lock:        *lock,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaGetLock
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("getLock: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("getLock: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("getLock: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp := new(proto.GetLockResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("getLock: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("getLock: packet(%v) mp(%v) req(%v) conflict(%v)", packet, mp, *req, resp.Lock)
+	return statusOK, &resp.Lock, nil
+}
+
+func (mw *MetaWrapper) renewLock(mp *MetaPartition, inodes []uint64) (status int, released []uint64, err error) {
+	req := &proto.RenewLockRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		ClientID:    mw.clientID,
+		Inodes:      inodes,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaRenewLock
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("renewLock: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("renewLock: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("renewLock: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp := new(proto.RenewLockResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("renewLock: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+		return
+	}
+
+	log.LogDebugf("renewLock: packet(%v) mp(%v) req(%v) released(%v)", packet, mp, *req, resp.Inodes)
+	return statusOK, resp.Inodes, nil
+}
+
+func (mw *MetaWrapper) readChanges(mp *MetaPartition, from uint64, limit int) (status int, resp *proto.ReadMetaChangesResponse, err error) {
+	req := &proto.ReadMetaChangesRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		From:        from,
+		Limit:       limit,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaReadChanges
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("readChanges: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("readChanges: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("readChanges: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	resp = new(proto.ReadMetaChangesResponse)
+	err = packet.UnmarshalData(resp)
+	if err != nil {
+		log.LogErrorf("readChanges: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	log.LogDebugf("readChanges: packet(%v) mp(%v) req(%v) changes(%v) applyID(%v)", packet, mp, *req, len(resp.Changes), resp.ApplyID)
+	return statusOK, resp, nil
+}
+
+func (mw *MetaWrapper) restoreTrash(mp *MetaPartition, name string) (status int, err error) {
+	req := &proto.RestoreTrashRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Name:        name,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaRestoreTrash
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("restoreTrash: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("restoreTrash: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		log.LogErrorf("restoreTrash: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		return
+	}
+
+	log.LogDebugf("restoreTrash: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
+
+func (mw *MetaWrapper) markDirRemoving(mp *MetaPartition, inode uint64, removing bool) (status int, err error) {
+	req := &proto.MarkDirRemovingRequest{
+		VolName:     mw.volname,
+		PartitionID: mp.PartitionID,
+		Inode:       inode,
+		Removing:    removing,
+	}
+
+	packet := proto.NewPacketReqID()
+	packet.Opcode = proto.OpMetaMarkDirRemoving
+	err = packet.MarshalData(req)
+	if err != nil {
+		log.LogErrorf("markDirRemoving: req(%v) err(%v)", *req, err)
+		return
+	}
+
+	metric := exporter.NewTPCnt(packet.GetOpMsg())
+	defer metric.Set(err)
+
+	packet, err = mw.sendToMetaPartition(mp, packet)
+	if err != nil {
+		log.LogErrorf("markDirRemoving: packet(%v) mp(%v) req(%v) err(%v)", packet, mp, *req, err)
+		return
+	}
+
+	status = parseStatus(packet.ResultCode)
+	if status != statusOK {
+		// statusInval is replied for the directories not split
+		if status != statusInval {
+			log.LogErrorf("markDirRemoving: packet(%v) mp(%v) req(%v) result(%v)", packet, mp, *req, packet.GetResultMsg())
+		}
+		return
+	}
+
+	if removing && len(packet.Data) > 0 {
+		info := new(proto.DirShardInfo)
+		if err = packet.UnmarshalData(info); err != nil {
+			log.LogErrorf("markDirRemoving: packet(%v) mp(%v) req(%v) err(%v) PacketData(%v)", packet, mp, *req, err, string(packet.Data))
+			return
+		}
+		mw.updateDirShards([]*proto.DirShardInfo{info})
+	}
+
+	log.LogDebugf("markDirRemoving: packet(%v) mp(%v) req(%v)", packet, mp, *req)
+	return statusOK, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package meta
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// the max number of the inodes whose quotas are cached
+	QuotaCacheLimit = 1 << 16
+)
+
+type quotaCacheEntry struct {
+	quotaIDs   []uint32
+	expiration time.Time
+}
+
+// quotaCache caches the quotas the inodes are accounted to, which are checked on every write. The entries
+// expire as the quotas are refreshed, so that the quotas changed by the others are seen in time.
+type quotaCache struct {
+	sync.Mutex
+	entries map[uint64]*quotaCacheEntry
+}
+
+func newQuotaCache() *quotaCache {
+	return &quotaCache{entries: make(map[uint64]*quotaCacheEntry)}
+}
+
+func (c *quotaCache) get(ino uint64) ([]uint32, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[ino]
+	if !ok || time.Now().After(e.expiration) {
+		return nil, false
+	}
+	return e.quotaIDs, true
+}
+
+func (c *quotaCache) put(ino uint64, quotaIDs []uint32) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if len(c.entries) >= QuotaCacheLimit {
+		for i, e := range c.entries {
+			if now.After(e.expiration) {
+				delete(c.entries, i)
+			}
+		}
+		if len(c.entries) >= QuotaCacheLimit {
+			c.entries = make(map[uint64]*quotaCacheEntry)
+		}
+	}
+	c.entries[ino] = &quotaCacheEntry{quotaIDs: quotaIDs, expiration: now.Add(RefreshQuotasInterval)}
+}
+
+func (c *quotaCache) delete(ino uint64) {
+	c.Lock()
+	delete(c.entries, ino)
+	c.Unlock()
+}
+
+// Returns the quotas the inode is accounted to, from the cache if possible.
+func (mw *MetaWrapper) inodeQuotaIDs(inode uint64) ([]uint32, error) {
+	if quotaIDs, ok := mw.quotaCache.get(inode); ok {
+		return quotaIDs, nil
+	}
+	info, err := mw.InodeGet_ll(inode)
+	if err != nil {
+		return nil, err
+	}
+	mw.quotaCache.put(inode, info.QuotaIDs)
+	return info.QuotaIDs, nil
+}
+
+// Accounts the inode renamed into another directory to the quotas of the new parent, and removes it from the
+// quotas of the old parent, along with the tree beneath it if it is a directory. The quotas of the inode itself,
+// and the ones shared by both parents, are kept. Failures are logged only, as the rename is done.
+func (mw *MetaWrapper) renameQuotas(srcParentID, dstParentID, inode uint64, mode uint32) {
+	if srcParentID == dstParentID || !mw.hasQuotas() {
+		return
+	}
+	src, err := mw.InodeGet_ll(srcParentID)
+	if err != nil {
+		log.LogWarnf("renameQuotas: ino(%v) srcParentID(%v) err(%v)", inode, srcParentID, err)
+		return
+	}
+	dst, err := mw.InodeGet_ll(dstParentID)
+	if err != nil {
+		log.LogWarnf("renameQuotas: ino(%v) dstParentID(%v) err(%v)", inode, dstParentID, err)
+		return
+	}
+	for _, id := range quotaIDsMissing(dst.QuotaIDs, src.QuotaIDs) {
+		mw.updateInodeQuota(inode, mode, id, false)
+	}
+	for _, id := range quotaIDsMissing(src.QuotaIDs, dst.QuotaIDs) {
+		mw.updateInodeQuota(inode, mode, id, true)
+	}
+}
+
+// Accounts the inode linked into another directory to the quotas of the new parent.
+func (mw *MetaWrapper) linkQuotas(parentID uint64, info *proto.InodeInfo) {
+	if !mw.hasQuotas() {
+		return
+	}
+	parent, err := mw.InodeGet_ll(parentID)
+	if err != nil {
+		log.LogWarnf("linkQuotas: ino(%v) parentID(%v) err(%v)", info.Inode, parentID, err)
+		return
+	}
+	for _, id := range quotaIDsMissing(parent.QuotaIDs, info.QuotaIDs) {
+		mw.updateInodeQuota(info.Inode, info.Mode, id, false)
+	}
+}
+
+func (mw *MetaWrapper) updateInodeQuota(inode uint64, mode uint32, quotaID uint32, remove bool) {
+	defer mw.quotaCache.delete(inode)
+	mp := mw.getPartitionByInode(inode)
+	if mp == nil {
+		log.LogWarnf("updateInodeQuota: No such partition, ino(%v)", inode)
+		return
+	}
+	var dirs []uint64
+	if proto.IsDir(mode) {
+		dirs = []uint64{inode}
+	}
+	status, err := mw.setInodeQuota(mp, []uint64{inode}, dirs, quotaID, remove)
+	if err != nil || status != statusOK {
+		log.LogWarnf("updateInodeQuota: ino(%v) quotaID(%v) remove(%v) status(%v) err(%v)",
+			inode, quotaID, remove, status, err)
+	}
+}
+
+// Returns the quotas in a but not in b.
+func quotaIDsMissing(a, b []uint32) (missing []uint32) {
+	for _, id := range a {
+		found := false
+		for _, other := range b {
+			if id == other {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, id)
+		}
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package meta
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func checkTestInodeQuotas(t *testing.T, mw *MetaWrapper, ino uint64, quotaIDs []uint32) {
+	t.Helper()
+	info, err := mw.InodeGet_ll(ino)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.QuotaIDs, quotaIDs) {
+		t.Fatalf("inode %v: expect quotas %v, got %v", ino, quotaIDs, info.QuotaIDs)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+	dir, err := mw.Create_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := &proto.QuotaInfo{QuotaID: 1, RootInode: dir.Inode, MaxFiles: 3}
+	vol.SetQuota(quota)
+	if err = mw.updateQuotas(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new inodes are accounted to the quotas of the parent
+	file := createFile(t, mw, dir.Inode, "file", 0644)
+	if !reflect.DeepEqual(file.QuotaIDs, []uint32{1}) {
+		t.Fatalf("expect the file to be accounted to the quota, got %v", file.QuotaIDs)
+	}
+	other := createFile(t, mw, proto.RootIno, "other", 0644)
+	if err = mw.CheckQuota(file.Inode); err != nil {
+		t.Fatalf("expect the quota not exceeded, got %v", err)
+	}
+
+	quota.UsedFiles = 3
+	vol.SetQuota(quota)
+	if err = mw.updateQuotas(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mw.Create_ll(dir.Inode, "new", proto.Mode(0644), 0, 0, nil); err != syscall.EDQUOT {
+		t.Fatalf("expect the quota exceeded, got %v", err)
+	}
+	if err = mw.CheckQuota(file.Inode); err != syscall.EDQUOT {
+		t.Fatalf("expect the quota exceeded, got %v", err)
+	}
+	if err = mw.CheckQuota(other.Inode); err != nil {
+		t.Fatalf("expect the inode out of the quota to be written, got %v", err)
+	}
+	createFile(t, mw, proto.RootIno, "new", 0644)
+
+	// the quotas of the inodes checked are cached
+	vol.SetQuota(&proto.QuotaInfo{QuotaID: 2, RootInode: proto.RootIno, MaxFiles: 1, UsedFiles: 1})
+	if err = mw.updateQuotas(); err != nil {
+		t.Fatal(err)
+	}
+	if err = mw.CheckQuota(other.Inode); err != nil {
+		t.Fatalf("expect the cached quotas of the inode, got %v", err)
+	}
+	mw.quotaCache.delete(other.Inode)
+	if err = mw.CheckQuota(other.Inode); err != syscall.EDQUOT {
+		t.Fatalf("expect the quota of the root exceeded, got %v", err)
+	}
+}
+
+func TestRenameQuota(t *testing.T) {
+	vol, mw := newTestMetaWrapper(t)
+	defer vol.Close()
+	dirMode := proto.Mode(os.ModeDir | 0755)
+	a, err := mw.Create_ll(proto.RootIno, "a", dirMode, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mw.Create_ll(proto.RootIno, "b", dirMode, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol.SetQuota(&proto.QuotaInfo{QuotaID: 1, RootInode: a.Inode})
+	if err = mw.updateQuotas(); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := mw.Create_ll(a.Inode, "sub", dirMode, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := createFile(t, mw, sub.Inode, "file", 0644)
+	checkTestInodeQuotas(t, mw, file.Inode, []uint32{1})
+
+	// the tree renamed out of the quota is removed from it, while the quota of its own is kept
+	vol.SetQuota(&proto.QuotaInfo{QuotaID: 2, RootInode: sub.Inode})
+	if err = mw.Rename_ll(a.Inode, "sub", b.Inode, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	checkTestInodeQuotas(t, mw, sub.Inode, []uint32{2})
+	checkTestInodeQuotas(t, mw, file.Inode, []uint32{2})
+
+	// and accounted to the quota renamed into
+	if err = mw.Rename_ll(b.Inode, "sub", a.Inode, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	checkTestInodeQuotas(t, mw, sub.Inode, []uint32{2, 1})
+	checkTestInodeQuotas(t, mw, file.Inode, []uint32{2, 1})
+
+	// the file linked into another quota is accounted to both
+	vol.SetQuota(&proto.QuotaInfo{QuotaID: 3, RootInode: b.Inode})
+	if _, err = mw.Link(b.Inode, "link", file.Inode); err != nil {
+		t.Fatal(err)
+	}
+	checkTestInodeQuotas(t, mw, file.Inode, []uint32{2, 1, 3})
+}
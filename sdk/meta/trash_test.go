@@ -0,0 +1,78 @@
+package meta
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/meta/mocktest"
+)
+
+func TestTrash(t *testing.T) {
+	vol, err := mocktest.NewMockVolume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vol.Close()
+	vol.TrashRetention = 24
+	mw, err := NewMetaWrapper(vol.Name, "owner", vol.MasterAddr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := mw.Create_ll(proto.RootIno, "dir", proto.Mode(os.ModeDir|0755), 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := createFile(t, mw, dir.Inode, "file", 0644)
+
+	// the deleted file is moved into the trash instead of being unlinked
+	if _, err = mw.Delete_ll(dir.Inode, "file", false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, _, err = mw.Lookup_ll(dir.Inode, "file"); err != syscall.ENOENT {
+		t.Fatalf("lookup the deleted file: expected ENOENT but got %v", err)
+	}
+	if info := vol.Inode(file.Inode); info == nil || info.Nlink != 1 {
+		t.Fatalf("the deleted file is unlinked: %v", info)
+	}
+	entries, err := mw.ListTrash()
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Inode != file.Inode || entries[0].ParentID != dir.Inode || entries[0].OrigName != "file" {
+		t.Fatalf("unexpected trash entries: %v", entries)
+	}
+
+	// the entry is not restored over another file
+	other := createFile(t, mw, dir.Inode, "file", 0644)
+	if err = mw.RestoreTrash(entries[0].Name); err != syscall.EEXIST {
+		t.Fatalf("restore over an existing file: expected EEXIST but got %v", err)
+	}
+	if _, err = mw.Delete_ll(dir.Inode, "file", false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err = mw.RestoreTrash(entries[0].Name); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if ino, _, err := mw.Lookup_ll(dir.Inode, "file"); err != nil || ino != file.Inode {
+		t.Fatalf("lookup the restored file: expected inode %v but got %v, err %v", file.Inode, ino, err)
+	}
+	if entries, err = mw.ListTrash(); err != nil || len(entries) != 1 || entries[0].Inode != other.Inode {
+		t.Fatalf("unexpected trash entries after restore: %v, err %v", entries, err)
+	}
+
+	// the entries deleted from the trash are unlinked
+	trashIno, _, err := mw.Lookup_ll(proto.RootIno, proto.TrashDirName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mw.Delete_ll(trashIno, entries[0].Name, false)
+	if err != nil || info == nil || info.Inode != other.Inode || info.Nlink != 0 {
+		t.Fatalf("delete from the trash: info %v err %v", info, err)
+	}
+	if err = mw.RestoreTrash("bad-name"); err != syscall.EINVAL {
+		t.Fatalf("restore an invalid name: expected EINVAL but got %v", err)
+	}
+}
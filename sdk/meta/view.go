@@ -32,7 +32,9 @@ const (
 
 type VolumeView struct {
 	VolName        string
+	TrashRetention uint32
 	MetaPartitions []*MetaPartition
+	DirShards      []*proto.DirShardInfo
 }
 
 type VolStatInfo struct {
@@ -104,11 +106,58 @@ func (mw *MetaWrapper) updateVolStatInfo() error {
 	return nil
 }
 
+func (mw *MetaWrapper) updateQuotas() error {
+	params := make(map[string]string)
+	params["name"] = mw.volname
+	body, err := mw.master.Request(http.MethodPost, proto.AdminListQuota, params, nil)
+	if err != nil {
+		log.LogWarnf("updateQuotas request: err(%v)", err)
+		return err
+	}
+
+	quotas := make([]*proto.QuotaInfo, 0)
+	if err = json.Unmarshal(body, &quotas); err != nil {
+		log.LogWarnf("updateQuotas unmarshal: err(%v)", err)
+		return err
+	}
+	quotaMap := make(map[uint32]*proto.QuotaInfo, len(quotas))
+	for _, q := range quotas {
+		quotaMap[q.QuotaID] = q
+	}
+	mw.quotas.Store(quotaMap)
+	log.LogDebugf("updateQuotas: quotas(%v)", quotas)
+	return nil
+}
+
+func (mw *MetaWrapper) getSnapshot(name string) (*proto.SnapshotInfo, error) {
+	params := make(map[string]string)
+	params["name"] = mw.volname
+	body, err := mw.master.Request(http.MethodPost, proto.AdminListSnapshot, params, nil)
+	if err != nil {
+		log.LogWarnf("getSnapshot request: err(%v)", err)
+		return nil, err
+	}
+
+	snapshots := make([]*proto.SnapshotInfo, 0)
+	if err = json.Unmarshal(body, &snapshots); err != nil {
+		log.LogWarnf("getSnapshot unmarshal: err(%v)", err)
+		return nil, err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, proto.ErrSnapshotNotExists
+}
+
 func (mw *MetaWrapper) updateMetaPartitions() error {
 	view, err := mw.fetchVolumeView()
 	if err != nil {
 		return err
 	}
+	atomic.StoreUint32(&mw.trashRetention, view.TrashRetention)
+	mw.updateDirShards(view.DirShards)
 
 	rwPartitions := make([]*MetaPartition, 0)
 	for _, mp := range view.MetaPartitions {
@@ -133,11 +182,19 @@ func (mw *MetaWrapper) updateMetaPartitions() error {
 func (mw *MetaWrapper) refresh() {
 	t := time.NewTicker(RefreshMetaPartitionsInterval)
 	defer t.Stop()
+	qt := time.NewTicker(RefreshQuotasInterval)
+	defer qt.Stop()
+	lt := time.NewTicker(RenewFileLocksInterval)
+	defer lt.Stop()
 	for {
 		select {
 		case <-t.C:
 			mw.updateMetaPartitions()
 			mw.updateVolStatInfo()
+		case <-qt.C:
+			mw.updateQuotas()
+		case <-lt.C:
+			mw.renewFileLocks()
 		}
 	}
 }
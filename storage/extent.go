@@ -66,6 +66,8 @@ type Extent struct {
 	hasClose   int32
 	header     []byte
 	sync.Mutex
+	// held shared by the writes, which run concurrently, and exclusively by the repair of a block
+	repairLock sync.RWMutex
 }
 
 // NewExtentInCore create and returns a new extent instance.
@@ -215,6 +217,8 @@ func (e *Extent) Write(data []byte, offset, size int64, crc uint32, writeType in
 	if err = e.checkOffsetAndSize(offset, size); err != nil {
 		return
 	}
+	e.repairLock.RLock()
+	defer e.repairLock.RUnlock()
 	if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
 		return
 	}
@@ -323,6 +327,54 @@ func (e *Extent) autoComputeExtentCrc(crcFunc UpdateCrcFunc) (crc uint32, err er
 	return crc, err
 }
 
+// blockCrc returns the crc of the block stored in the header, which is zero if it has not been computed yet.
+func (e *Extent) blockCrc(blockNo int) uint32 {
+	return binary.BigEndian.Uint32(e.header[blockNo*util.PerBlockCrcSize : (blockNo+1)*util.PerBlockCrcSize])
+}
+
+// readBlock reads the data of the block, which is shorter than a block at the end of the extent.
+func (e *Extent) readBlock(blockNo int, data []byte) (size int, err error) {
+	offset := int64(blockNo) * util.BlockSize
+	if offset >= e.Size() {
+		return 0, NewParameterMismatchErr(fmt.Sprintf("blockNo=%v size=%v", blockNo, e.Size()))
+	}
+	size = int(util.Min(util.BlockSize, int(e.Size()-offset)))
+	if _, err = e.file.ReadAt(data[:size], offset); err != nil && err != io.EOF {
+		return
+	}
+	return size, nil
+}
+
+// repairBlock overwrites the block with the data if the block does not match the crc stored in the header,
+// while the data does. The writes to the extent wait for the repair, so that a block written in the meantime
+// is not overwritten with the stale data.
+func (e *Extent) repairBlock(blockNo int, data []byte) (err error) {
+	e.repairLock.Lock()
+	defer e.repairLock.Unlock()
+	expectCrc := e.blockCrc(blockNo)
+	if expectCrc == 0 {
+		return NewParameterMismatchErr(fmt.Sprintf("blockNo=%v crc not computed", blockNo))
+	}
+	if crc32.ChecksumIEEE(data) != expectCrc {
+		return CrcMismatchError
+	}
+	local := make([]byte, util.BlockSize)
+	size, err := e.readBlock(blockNo, local)
+	if err != nil {
+		return
+	}
+	if size != len(data) {
+		return NewParameterMismatchErr(fmt.Sprintf("blockNo=%v size=%v repair size=%v", blockNo, size, len(data)))
+	}
+	if crc32.ChecksumIEEE(local[:size]) == expectCrc {
+		return
+	}
+	if _, err = e.file.WriteAt(data, int64(blockNo)*util.BlockSize); err != nil {
+		return
+	}
+	return e.file.Sync()
+}
+
 const (
 	PageSize          = 4 * util.KB
 	FallocFLKeepSize  = 1
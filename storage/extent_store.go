@@ -787,6 +787,60 @@ func (s *ExtentStore) ScanBlocks(extentID uint64) (bcs []*BlockCrc, err error) {
 	return
 }
 
+// BlockCount returns the number of the blocks of a normal extent.
+func (s *ExtentStore) BlockCount(extentID uint64) (blockCnt int, err error) {
+	s.eiMutex.RLock()
+	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	e, err := s.extentWithHeader(ei)
+	if err != nil {
+		return
+	}
+	blockCnt = int(e.Size() / util.BlockSize)
+	if e.Size()%util.BlockSize != 0 {
+		blockCnt += 1
+	}
+	return
+}
+
+// VerifyBlock reads a block of a normal extent into the buffer, and returns the size of the block, the crc stored in
+// the header and the crc of the data read. The stored crc is zero if it has not been computed yet.
+func (s *ExtentStore) VerifyBlock(extentID uint64, blockNo int, data []byte) (size int, expectCrc, actualCrc uint32, err error) {
+	if IsTinyExtent(extentID) {
+		err = ParameterMismatchError
+		return
+	}
+	s.eiMutex.RLock()
+	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	e, err := s.extentWithHeader(ei)
+	if err != nil {
+		return
+	}
+	expectCrc = e.blockCrc(blockNo)
+	if size, err = e.readBlock(blockNo, data); err != nil {
+		return
+	}
+	actualCrc = crc32.ChecksumIEEE(data[:size])
+	return
+}
+
+// RepairBlock overwrites a corrupt block of a normal extent with the data read from another replica,
+// which must match the crc stored in the header.
+func (s *ExtentStore) RepairBlock(extentID uint64, blockNo int, data []byte) (err error) {
+	if IsTinyExtent(extentID) {
+		return ParameterMismatchError
+	}
+	s.eiMutex.RLock()
+	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	e, err := s.extentWithHeader(ei)
+	if err != nil {
+		return
+	}
+	return e.repairBlock(blockNo, data)
+}
+
 type ExtentInfoArr []*ExtentInfo
 
 func (arr ExtentInfoArr) Len() int           { return len(arr) }
@@ -890,6 +944,26 @@ func (s *ExtentStore) TinyExtentGetFinfoSize(extentID uint64) (size uint64, err
 	return
 }
 
+// TinyExtentUsage returns the logical size of the tiny extent, and the size of the space allocated on the disk,
+// which is smaller than the logical size as the deleted ranges are punched out.
+func (s *ExtentStore) TinyExtentUsage(extentID uint64) (size, allocated int64, err error) {
+	var e *Extent
+	if !IsTinyExtent(extentID) {
+		return 0, 0, fmt.Errorf("unavali extent id (%v)", extentID)
+	}
+	if size, err = s.GetTinyExtentOffset(extentID); err != nil {
+		return
+	}
+	s.eiMutex.RLock()
+	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	if e, err = s.extentWithHeader(ei); err != nil {
+		return
+	}
+	allocated = e.getRealBlockCnt() * 512
+	return
+}
+
 func (s *ExtentStore) TinyExtentAvaliOffset(extentID uint64, offset int64) (newOffset, newEnd int64, err error) {
 	var e *Extent
 	if !IsTinyExtent(extentID) {
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func newTestExtentStore(t *testing.T) (*ExtentStore, func()) {
+	dir, err := ioutil.TempDir("", "extent_store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewExtentStore(dir, 1, util.GB)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Creates a normal extent of a full block, of which the crc is stored, and a partial block, of which it is not.
+func createTestExtent(t *testing.T, s *ExtentStore, block []byte) uint64 {
+	extentID, err := s.NextExtentID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Create(extentID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(extentID, 0, util.BlockSize, block, crc32.ChecksumIEEE(block), AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(extentID, util.BlockSize, 100, block[:100], 0, AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+	return extentID
+}
+
+func corruptTestExtent(t *testing.T, s *ExtentStore, extentID uint64, offset int64) {
+	f, err := os.OpenFile(path.Join(s.dataPath, strconv.FormatUint(extentID, 10)), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteAt([]byte("corrupt"), offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyBlock(t *testing.T) {
+	s, cleanup := newTestExtentStore(t)
+	defer cleanup()
+	block := bytes.Repeat([]byte("a"), util.BlockSize)
+	extentID := createTestExtent(t, s, block)
+
+	if cnt, err := s.BlockCount(extentID); err != nil || cnt != 2 {
+		t.Fatalf("expect 2 blocks, got %v err %v", cnt, err)
+	}
+	data := make([]byte, util.BlockSize)
+	size, expectCrc, actualCrc, err := s.VerifyBlock(extentID, 0, data)
+	if err != nil || size != util.BlockSize || expectCrc == 0 || actualCrc != expectCrc {
+		t.Fatalf("expect the block to match, got size %v crc %v/%v err %v", size, actualCrc, expectCrc, err)
+	}
+	// the crc of the partial block is not computed yet
+	if size, expectCrc, _, err = s.VerifyBlock(extentID, 1, data); err != nil || size != 100 || expectCrc != 0 {
+		t.Fatalf("expect the partial block without crc, got size %v crc %v err %v", size, expectCrc, err)
+	}
+	if _, _, _, err = s.VerifyBlock(extentID, 2, data); err == nil {
+		t.Fatalf("expect the block beyond the extent to be rejected")
+	}
+
+	corruptTestExtent(t, s, extentID, 10)
+	if _, expectCrc, actualCrc, err = s.VerifyBlock(extentID, 0, data); err != nil || actualCrc == expectCrc {
+		t.Fatalf("expect the corrupt block to mismatch, got crc %v/%v err %v", actualCrc, expectCrc, err)
+	}
+
+	if _, err = s.BlockCount(extentID + 1); err != ExtentNotFoundError {
+		t.Fatalf("expect the extent not found, got %v", err)
+	}
+	if _, _, _, err = s.VerifyBlock(TinyExtentStartID, 0, data); err != ParameterMismatchError {
+		t.Fatalf("expect the tiny extent to be rejected, got %v", err)
+	}
+}
+
+func TestRepairBlock(t *testing.T) {
+	s, cleanup := newTestExtentStore(t)
+	defer cleanup()
+	block := bytes.Repeat([]byte("a"), util.BlockSize)
+	extentID := createTestExtent(t, s, block)
+	corruptTestExtent(t, s, extentID, 10)
+
+	// the data not matching the stored crc is refused
+	bad := append([]byte(nil), block...)
+	bad[0] = 'b'
+	if err := s.RepairBlock(extentID, 0, bad); err != CrcMismatchError {
+		t.Fatalf("expect the bad data to be refused, got %v", err)
+	}
+	if err := s.RepairBlock(extentID, 0, block[:100]); err != CrcMismatchError {
+		t.Fatalf("expect the short data to be refused, got %v", err)
+	}
+	if err := s.RepairBlock(extentID, 1, block[:100]); err == nil {
+		t.Fatalf("expect the block without crc to be refused")
+	}
+
+	if err := s.RepairBlock(extentID, 0, block); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	data := make([]byte, util.BlockSize)
+	if _, expectCrc, actualCrc, err := s.VerifyBlock(extentID, 0, data); err != nil || actualCrc != expectCrc {
+		t.Fatalf("expect the block repaired to match, got crc %v/%v err %v", actualCrc, expectCrc, err)
+	}
+	if !bytes.Equal(data, block) {
+		t.Fatalf("expect the data repaired")
+	}
+	// the block matching the crc is kept
+	if err := s.RepairBlock(extentID, 0, block); err != nil {
+		t.Fatalf("repair the good block: %v", err)
+	}
+
+	if err := s.RepairBlock(TinyExtentStartID, 0, block); err != ParameterMismatchError {
+		t.Fatalf("expect the tiny extent to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package auth obtains tickets from authnode on behalf of a client, and uses
+// them to access the master, metanodes and datanodes.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+	"github.com/chubaofs/chubaofs/util/keystore"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	// A ticket is refreshed once it is about to expire within this many seconds.
+	ticketRefreshMargin = 60 * 60
+	requestTimeout      = 30 * time.Second
+	// Caps of the tickets issued by a service to its own peers.
+	peerCaps = `{"API": ["*:*:*"]}`
+)
+
+type ticketInfo struct {
+	ticket     string
+	sessionKey []byte
+	exp        int64
+}
+
+// Authenticator holds the key of a client, and caches the tickets of the services.
+type Authenticator struct {
+	sync.Mutex
+	authNodes []string
+	clientID  string
+	clientKey []byte
+	client    *http.Client
+	scheme    string
+	tickets   map[string]*ticketInfo
+
+	// If set, tickets are issued locally with the key of the service instead of being
+	// requested from authnode. It is used by the nodes of a service to access each other.
+	serviceID  string
+	serviceKey []byte
+}
+
+// NewAuthenticator returns a new authenticator. The client key is base64 encoded as in the key file
+// generated by authnode. If certFile is not empty, authnode is accessed through https.
+func NewAuthenticator(authNodes []string, clientID, clientKey, certFile string) (a *Authenticator, err error) {
+	if len(authNodes) == 0 {
+		err = fmt.Errorf("no authnode address")
+		return
+	}
+	if err = proto.IsValidClientID(clientID); err != nil {
+		return
+	}
+	a = &Authenticator{
+		authNodes: authNodes,
+		clientID:  clientID,
+		client:    &http.Client{Timeout: requestTimeout},
+		scheme:    "http://",
+		tickets:   make(map[string]*ticketInfo),
+	}
+	if a.clientKey, err = cryptoutil.Base64Decode(clientKey); err != nil {
+		err = fmt.Errorf("decode client key failed: %s", err.Error())
+		return
+	}
+	if certFile != "" {
+		var cert []byte
+		if cert, err = ioutil.ReadFile(certFile); err != nil {
+			return
+		}
+		if a.client, err = cryptoutil.CreateClientX(&cert); err != nil {
+			return
+		}
+		a.client.Timeout = requestTimeout
+		a.scheme = "https://"
+	}
+	return
+}
+
+// NewPeerAuthenticator returns an authenticator that issues tickets of the given service by itself.
+// Only the nodes sharing the key of the service accept these tickets.
+func NewPeerAuthenticator(clientID, serviceID string, serviceKey []byte) (a *Authenticator, err error) {
+	if err = proto.IsValidClientID(clientID); err != nil {
+		return
+	}
+	a = &Authenticator{
+		clientID:   clientID,
+		tickets:    make(map[string]*ticketInfo),
+		serviceID:  serviceID,
+		serviceKey: serviceKey,
+	}
+	return
+}
+
+// ClientID returns the ID of the client.
+func (a *Authenticator) ClientID() string {
+	return a.clientID
+}
+
+// Token returns a token to access the given service, refreshing the ticket if necessary.
+func (a *Authenticator) Token(serviceID string) (token string, err error) {
+	var (
+		ticket *ticketInfo
+		req    proto.APIAccessReq
+	)
+	if ticket, err = a.getTicket(serviceID); err != nil {
+		return
+	}
+	req.ClientID = a.clientID
+	req.ServiceID = serviceID
+	req.Ticket = ticket.ticket
+	switch serviceID {
+	case proto.MetaServiceID:
+		req.Type = proto.MsgMetaAPIAccessReq
+	case proto.DataServiceID:
+		req.Type = proto.MsgDataAPIAccessReq
+	default:
+		req.Type = proto.MsgMasterAPIAccessReq
+	}
+	if req.Verifier, _, err = cryptoutil.GenVerifier(ticket.sessionKey); err != nil {
+		return
+	}
+	return proto.EncodeAPIAccessToken(&req)
+}
+
+// Handshake authenticates a newly established connection to a metanode or a datanode.
+func (a *Authenticator) Handshake(serviceID string, conn *net.TCPConn) (err error) {
+	token, err := a.Token(serviceID)
+	if err != nil {
+		return
+	}
+	p := proto.NewPacketReqID()
+	p.Opcode = proto.OpAuthenticate
+	p.Data = []byte(token)
+	p.Size = uint32(len(p.Data))
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("authenticate to %v failed: %v %v", conn.RemoteAddr(), p.GetResultMsg(), string(p.Data))
+	}
+	return
+}
+
+// GetKey returns the key info of the given ID in the keystore of authnode. The caps of the client must
+// allow it to get the keys, e.g. {"API": ["auth:getkey:access"]}.
+func (a *Authenticator) GetKey(id string) (keyInfo *keystore.KeyInfo, err error) {
+	var (
+		ticket *ticketInfo
+		ts     int64
+		body   []byte
+		resp   proto.AuthAPIAccessResp
+	)
+	if ticket, err = a.getTicket(proto.AuthServiceID); err != nil {
+		return
+	}
+	req := proto.AuthAPIAccessReq{
+		APIReq: proto.APIAccessReq{
+			Type:      proto.MsgAuthGetKeyReq,
+			ClientID:  a.clientID,
+			ServiceID: proto.AuthServiceID,
+			Ticket:    ticket.ticket,
+		},
+		KeyInfo: keystore.KeyInfo{ID: id},
+	}
+	for _, addr := range a.authNodes {
+		if req.APIReq.Verifier, ts, err = cryptoutil.GenVerifier(ticket.sessionKey); err != nil {
+			return
+		}
+		if body, err = proto.SendData(a.client, a.scheme+addr+proto.AdminGetKey, req); err != nil {
+			log.LogWarnf("GetKey: authnode(%v) id(%v) err(%v)", addr, id, err)
+			continue
+		}
+		if resp, err = proto.ParseAuthAPIAccessResp(body, ticket.sessionKey); err != nil {
+			return
+		}
+		if err = proto.VerifyAPIRespComm(&resp.APIResp, proto.MsgAuthGetKeyReq, a.clientID, proto.AuthServiceID, ts); err != nil {
+			return
+		}
+		return &resp.KeyInfo, nil
+	}
+	err = fmt.Errorf("get key [%s] failed: %v", id, err)
+	return
+}
+
+func (a *Authenticator) getTicket(serviceID string) (ticket *ticketInfo, err error) {
+	a.Lock()
+	defer a.Unlock()
+	ticket, ok := a.tickets[serviceID]
+	if ok && time.Now().Unix() < ticket.exp-ticketRefreshMargin {
+		return
+	}
+	if a.serviceKey != nil {
+		if ticket, err = a.issueTicket(serviceID); err != nil {
+			return
+		}
+		a.tickets[serviceID] = ticket
+		return
+	}
+	for _, addr := range a.authNodes {
+		var t *ticketInfo
+		if t, err = a.requestTicket(addr, serviceID); err != nil {
+			log.LogWarnf("getTicket: authnode(%v) service(%v) err(%v)", addr, serviceID, err)
+			continue
+		}
+		a.tickets[serviceID] = t
+		return t, nil
+	}
+	// keep using the cached ticket until it expires
+	if ok && time.Now().Unix() < ticket.exp {
+		return ticket, nil
+	}
+	err = fmt.Errorf("get ticket of service [%s] failed: %v", serviceID, err)
+	return
+}
+
+func (a *Authenticator) requestTicket(addr, serviceID string) (ticket *ticketInfo, err error) {
+	var (
+		ts   int64
+		body []byte
+		resp proto.AuthGetTicketResp
+	)
+	req := proto.AuthGetTicketReq{
+		Type:      proto.MsgAuthTicketReq,
+		ClientID:  a.clientID,
+		ServiceID: serviceID,
+	}
+	if req.Verifier, ts, err = cryptoutil.GenVerifier(a.clientKey); err != nil {
+		return
+	}
+	if body, err = proto.SendData(a.client, a.scheme+addr+proto.ClientGetTicket, req); err != nil {
+		return
+	}
+	if resp, err = proto.ParseAuthGetTicketResp(body, a.clientKey); err != nil {
+		return
+	}
+	if err = proto.VerifyTicketRespComm(&resp, proto.MsgAuthTicketReq, a.clientID, serviceID, ts); err != nil {
+		return
+	}
+	ticket = &ticketInfo{
+		ticket:     resp.Ticket,
+		sessionKey: resp.SessionKey.Key,
+		exp:        resp.SessionKey.Ctime + cryptoutil.TicketAge,
+	}
+	return
+}
+
+func (a *Authenticator) issueTicket(serviceID string) (ticket *ticketInfo, err error) {
+	var (
+		t       cryptoutil.Ticket
+		jticket []byte
+	)
+	if serviceID != a.serviceID {
+		err = fmt.Errorf("can not issue ticket of service [%s]", serviceID)
+		return
+	}
+	now := time.Now().Unix()
+	t.Version = cryptoutil.TicketVersion
+	t.ServiceID = serviceID
+	t.SessionKey.Ctime = now
+	t.SessionKey.Key = cryptoutil.AuthGenSessionKeyTS(a.serviceKey)
+	t.Exp = now + cryptoutil.TicketAge
+	t.Caps = []byte(peerCaps)
+	if jticket, err = json.Marshal(t); err != nil {
+		return
+	}
+	ticket = &ticketInfo{
+		sessionKey: t.SessionKey.Key,
+		exp:        t.Exp,
+	}
+	if ticket.ticket, err = cryptoutil.EncodeMessage(jticket, a.serviceKey); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/cryptoutil"
+)
+
+func TestPeerAuthenticator(t *testing.T) {
+	key := cryptoutil.AuthGenSessionKeyTS([]byte("metanode service key"))
+	a, err := NewPeerAuthenticator("metanode", proto.MetaServiceID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.Token(proto.MetaServiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err := proto.ExtractAPIAccessToken(token, proto.MetaServiceID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = proto.CheckTicketCaps(&ticket, proto.MetaOp2ResourceMap[proto.OpMetaCreateInode]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = proto.ExtractAPIAccessToken(token, proto.DataServiceID, key); err == nil {
+		t.Fatal("token of the metanode service is accepted by the datanode service")
+	}
+	if _, err = proto.ExtractAPIAccessToken(token, proto.MetaServiceID, []byte("wrong key")); err == nil {
+		t.Fatal("token is accepted with a wrong key")
+	}
+	if _, err = a.Token(proto.DataServiceID); err == nil {
+		t.Fatal("ticket of another service is issued")
+	}
+}
@@ -29,12 +29,16 @@ const (
 	ConnectIdleTime = 30
 )
 
+// HandshakeFunc is called on each newly established connection before it is used.
+type HandshakeFunc func(c *net.TCPConn) error
+
 type ConnectPool struct {
 	sync.RWMutex
-	pools   map[string]*Pool
-	mincap  int
-	maxcap  int
-	timeout int64
+	pools     map[string]*Pool
+	mincap    int
+	maxcap    int
+	timeout   int64
+	handshake HandshakeFunc
 }
 
 func NewConnectPool() (cp *ConnectPool) {
@@ -44,6 +48,13 @@ func NewConnectPool() (cp *ConnectPool) {
 	return cp
 }
 
+// SetHandshake sets the handshake function of the connections established afterwards.
+func (cp *ConnectPool) SetHandshake(handshake HandshakeFunc) {
+	cp.Lock()
+	cp.handshake = handshake
+	cp.Unlock()
+}
+
 func DailTimeOut(target string, timeout time.Duration) (c *net.TCPConn, err error) {
 	var connect net.Conn
 	connect, err = net.DialTimeout("tcp", target, timeout)
@@ -62,7 +73,7 @@ func (cp *ConnectPool) GetConnect(targetAddr string) (c *net.TCPConn, err error)
 	cp.RUnlock()
 	if !ok {
 		cp.Lock()
-		pool = NewPool(cp.mincap, cp.maxcap, cp.timeout, targetAddr)
+		pool = NewPool(cp.mincap, cp.maxcap, cp.timeout, targetAddr, cp.handshake)
 		cp.pools[targetAddr] = pool
 		cp.Unlock()
 	}
@@ -109,31 +120,30 @@ func (cp *ConnectPool) autoRelease() {
 }
 
 type Pool struct {
-	objects chan *Object
-	mincap  int
-	maxcap  int
-	target  string
-	timeout int64
+	objects   chan *Object
+	mincap    int
+	maxcap    int
+	target    string
+	timeout   int64
+	handshake HandshakeFunc
 }
 
-func NewPool(min, max int, timeout int64, target string) (p *Pool) {
+func NewPool(min, max int, timeout int64, target string, handshake HandshakeFunc) (p *Pool) {
 	p = new(Pool)
 	p.mincap = min
 	p.maxcap = max
 	p.target = target
 	p.objects = make(chan *Object, max)
 	p.timeout = timeout
+	p.handshake = handshake
 	p.initAllConnect()
 	return p
 }
 
 func (p *Pool) initAllConnect() {
 	for i := 0; i < p.mincap; i++ {
-		c, err := net.Dial("tcp", p.target)
+		conn, err := p.NewConnect(p.target)
 		if err == nil {
-			conn := c.(*net.TCPConn)
-			conn.SetKeepAlive(true)
-			conn.SetNoDelay(true)
 			o := &Object{conn: conn, idle: time.Now().UnixNano()}
 			p.PutConnectObjectToPool(o)
 		}
@@ -177,6 +187,12 @@ func (p *Pool) NewConnect(target string) (c *net.TCPConn, err error) {
 		conn.SetNoDelay(true)
 		c = conn
 	}
+	if err == nil && p.handshake != nil {
+		if err = p.handshake(c); err != nil {
+			c.Close()
+			c = nil
+		}
+	}
 	return
 }
 
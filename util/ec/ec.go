@@ -0,0 +1,212 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ec implements the systematic Reed-Solomon code used by the erasure-coded data partitions.
+//
+// An extent of an erasure-coded data partition is split into stripes, each of which consists of
+// DataNum units of StripeUnitSize bytes and ParityNum parity units computed from them. The i-th
+// unit of every stripe is stored in the extent with the same ID on the i-th host of the partition,
+// so any DataNum of the DataNum+ParityNum hosts are enough to recover the extent.
+package ec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+const (
+	// StripeUnitSize is the size of a unit of a stripe in a shard.
+	StripeUnitSize = util.BlockSize
+
+	MaxShardNum = 32
+)
+
+var (
+	ErrInvalidParams   = errors.New("invalid erasure code params")
+	ErrShardSize       = errors.New("shards of different sizes")
+	ErrTooFewShards    = errors.New("too few shards to reconstruct")
+	ErrInvalidShardNum = errors.New("invalid number of shards")
+)
+
+// Encoder encodes and reconstructs the shards of a stripe.
+type Encoder struct {
+	dataNum   int
+	parityNum int
+	// The encoding matrix of (dataNum+parityNum) x dataNum, whose top is the identity matrix,
+	// and whose bottom is a Cauchy matrix, so that any dataNum rows of it are invertible.
+	matrix matrix
+}
+
+// NewEncoder returns a new encoder of dataNum data shards and parityNum parity shards.
+func NewEncoder(dataNum, parityNum int) (e *Encoder, err error) {
+	if err = CheckParams(dataNum, parityNum); err != nil {
+		return
+	}
+	e = &Encoder{dataNum: dataNum, parityNum: parityNum}
+	e.matrix = newMatrix(dataNum+parityNum, dataNum)
+	for r := 0; r < dataNum; r++ {
+		e.matrix[r][r] = 1
+	}
+	for r := dataNum; r < dataNum+parityNum; r++ {
+		for c := 0; c < dataNum; c++ {
+			e.matrix[r][c] = galInv(byte(r) ^ byte(c))
+		}
+	}
+	return
+}
+
+// CheckParams checks the number of the data shards and the parity shards.
+func CheckParams(dataNum, parityNum int) error {
+	if dataNum <= 0 || parityNum <= 0 || dataNum+parityNum > MaxShardNum {
+		return fmt.Errorf("%v: data[%v] parity[%v]", ErrInvalidParams, dataNum, parityNum)
+	}
+	return nil
+}
+
+// DataNum returns the number of the data shards.
+func (e *Encoder) DataNum() int {
+	return e.dataNum
+}
+
+// ParityNum returns the number of the parity shards.
+func (e *Encoder) ParityNum() int {
+	return e.parityNum
+}
+
+// Encode computes the parity shards from the data shards. The parity shards are allocated
+// if they are nil.
+func (e *Encoder) Encode(shards [][]byte) (err error) {
+	if len(shards) != e.dataNum+e.parityNum {
+		return ErrInvalidShardNum
+	}
+	size := len(shards[0])
+	for i := 0; i < e.dataNum; i++ {
+		if len(shards[i]) != size {
+			return ErrShardSize
+		}
+	}
+	for i := e.dataNum; i < len(shards); i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+		}
+		if len(shards[i]) != size {
+			return ErrShardSize
+		}
+	}
+	e.encodeRows(shards[:e.dataNum], e.matrix[e.dataNum:], shards[e.dataNum:])
+	return
+}
+
+// Computes the outputs by multiplying the rows of the matrix with the inputs.
+func (e *Encoder) encodeRows(inputs [][]byte, rows matrix, outputs [][]byte) {
+	for r, out := range outputs {
+		for i := range out {
+			out[i] = 0
+		}
+		for c, in := range inputs {
+			galMulAdd(rows[r][c], in, out)
+		}
+	}
+}
+
+// Reconstruct recovers the missing shards, i.e. the nil ones, from any dataNum shards present.
+func (e *Encoder) Reconstruct(shards [][]byte) (err error) {
+	if len(shards) != e.dataNum+e.parityNum {
+		return ErrInvalidShardNum
+	}
+	var (
+		size    = -1
+		present = make([]int, 0, e.dataNum)
+		missing bool
+	)
+	for i, shard := range shards {
+		if shard == nil {
+			missing = true
+			continue
+		}
+		if size == -1 {
+			size = len(shard)
+		} else if len(shard) != size {
+			return ErrShardSize
+		}
+		if len(present) < e.dataNum {
+			present = append(present, i)
+		}
+	}
+	if !missing {
+		return
+	}
+	if len(present) < e.dataNum {
+		return ErrTooFewShards
+	}
+
+	// recover the data shards by the inverse of the rows of the present shards
+	sub := newMatrix(e.dataNum, e.dataNum)
+	inputs := make([][]byte, e.dataNum)
+	for r, i := range present {
+		copy(sub[r], e.matrix[i])
+		inputs[r] = shards[i]
+	}
+	inv, err := sub.invert()
+	if err != nil {
+		return
+	}
+	var (
+		rows    matrix
+		outputs [][]byte
+	)
+	for i := 0; i < e.dataNum; i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+			rows = append(rows, inv[i])
+			outputs = append(outputs, shards[i])
+		}
+	}
+	e.encodeRows(inputs, rows, outputs)
+
+	// and then the parity shards from the data shards
+	rows, outputs = nil, nil
+	for i := e.dataNum; i < len(shards); i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+			rows = append(rows, e.matrix[i])
+			outputs = append(outputs, shards[i])
+		}
+	}
+	e.encodeRows(shards[:e.dataNum], rows, outputs)
+	return
+}
+
+// Verify returns true if the parity shards match the data shards.
+func (e *Encoder) Verify(shards [][]byte) (ok bool, err error) {
+	if len(shards) != e.dataNum+e.parityNum {
+		return false, ErrInvalidShardNum
+	}
+	parity := make([][]byte, e.parityNum)
+	for i := range parity {
+		if len(shards[e.dataNum+i]) != len(shards[0]) {
+			return false, ErrShardSize
+		}
+		parity[i] = make([]byte, len(shards[0]))
+	}
+	e.encodeRows(shards[:e.dataNum], e.matrix[e.dataNum:], parity)
+	for i, p := range parity {
+		if string(p) != string(shards[e.dataNum+i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
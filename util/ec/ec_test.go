@@ -0,0 +1,98 @@
+package ec
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randShards(e *Encoder, size int) [][]byte {
+	shards := make([][]byte, e.DataNum()+e.ParityNum())
+	for i := 0; i < e.DataNum(); i++ {
+		shards[i] = make([]byte, size)
+		rand.Read(shards[i])
+	}
+	return shards
+}
+
+func TestEncodeAndReconstruct(t *testing.T) {
+	for _, params := range [][2]int{{1, 1}, {4, 2}, {6, 3}, {10, 4}} {
+		e, err := NewEncoder(params[0], params[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards := randShards(e, 1024)
+		if err = e.Encode(shards); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := e.Verify(shards); err != nil || !ok {
+			t.Fatalf("verify %v: ok[%v] err[%v]", params, ok, err)
+		}
+		origin := make([][]byte, len(shards))
+		for i := range shards {
+			origin[i] = append([]byte(nil), shards[i]...)
+		}
+		// lose any parityNum shards
+		for round := 0; round < 20; round++ {
+			lost := append([][]byte(nil), origin...)
+			for _, i := range rand.Perm(len(lost))[:e.ParityNum()] {
+				lost[i] = nil
+			}
+			if err = e.Reconstruct(lost); err != nil {
+				t.Fatalf("reconstruct %v: %v", params, err)
+			}
+			for i := range lost {
+				if !bytes.Equal(lost[i], origin[i]) {
+					t.Fatalf("reconstruct %v: shard[%v] mismatch", params, i)
+				}
+			}
+		}
+	}
+}
+
+func TestReconstructTooFewShards(t *testing.T) {
+	e, err := NewEncoder(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := randShards(e, 64)
+	if err = e.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	shards[0], shards[1], shards[5] = nil, nil, nil
+	if err = e.Reconstruct(shards); err != ErrTooFewShards {
+		t.Fatalf("expect err[%v], but got[%v]", ErrTooFewShards, err)
+	}
+}
+
+func TestInvalidParams(t *testing.T) {
+	for _, params := range [][2]int{{0, 1}, {1, 0}, {30, 3}} {
+		if _, err := NewEncoder(params[0], params[1]); err == nil {
+			t.Fatalf("params %v should be invalid", params)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	const dataNum = 4
+	if size := ShardSize(StripeSize(dataNum)+1, dataNum); size != 2*StripeUnitSize {
+		t.Fatalf("shard size %v", size)
+	}
+	units := Locate(StripeUnitSize-10, StripeSize(dataNum), dataNum)
+	if len(units) != dataNum+1 {
+		t.Fatalf("units %v", units)
+	}
+	if u := units[0]; u.Stripe != 0 || u.Index != 0 || u.ShardOffset != StripeUnitSize-10 || u.Size != 10 {
+		t.Fatalf("first unit %+v", u)
+	}
+	if u := units[dataNum]; u.Stripe != 1 || u.Index != 0 || u.ShardOffset != StripeUnitSize || u.Size != StripeUnitSize-10 {
+		t.Fatalf("last unit %+v", u)
+	}
+	var total uint64
+	for _, u := range units {
+		total += u.Size
+	}
+	if total != StripeSize(dataNum) {
+		t.Fatalf("total size %v", total)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec
+
+import (
+	"errors"
+)
+
+// Arithmetic over GF(2^8) with the primitive polynomial x^8+x^4+x^3+x^2+1.
+const (
+	fieldSize  = 256
+	polynomial = 0x11d
+)
+
+var (
+	expTable [fieldSize * 2]byte
+	logTable [fieldSize]int
+	mulTable [fieldSize][fieldSize]byte
+)
+
+var errSingular = errors.New("matrix is singular")
+
+func init() {
+	x := 1
+	for i := 0; i < fieldSize-1; i++ {
+		expTable[i] = byte(x)
+		logTable[x] = i
+		x <<= 1
+		if x >= fieldSize {
+			x ^= polynomial
+		}
+	}
+	for i := fieldSize - 1; i < len(expTable); i++ {
+		expTable[i] = expTable[i-(fieldSize-1)]
+	}
+	for a := 0; a < fieldSize; a++ {
+		for b := 0; b < fieldSize; b++ {
+			mulTable[a][b] = galMul(byte(a), byte(b))
+		}
+	}
+}
+
+func galMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[logTable[a]+logTable[b]]
+}
+
+func galInv(a byte) byte {
+	return expTable[fieldSize-1-logTable[a]]
+}
+
+// Adds c*in to out.
+func galMulAdd(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	t := &mulTable[c]
+	for i, v := range in {
+		out[i] ^= t[v]
+	}
+}
+
+type matrix [][]byte
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+	return m
+}
+
+// Returns the inverse of the square matrix by the Gauss-Jordan elimination.
+func (m matrix) invert() (inv matrix, err error) {
+	n := len(m)
+	work := newMatrix(n, n*2)
+	for r := 0; r < n; r++ {
+		copy(work[r], m[r])
+		work[r][n+r] = 1
+	}
+	for c := 0; c < n; c++ {
+		if work[c][c] == 0 {
+			for r := c + 1; r < n; r++ {
+				if work[r][c] != 0 {
+					work[c], work[r] = work[r], work[c]
+					break
+				}
+			}
+		}
+		if work[c][c] == 0 {
+			return nil, errSingular
+		}
+		if scale := galInv(work[c][c]); scale != 1 {
+			for i := range work[c] {
+				work[c][i] = galMul(work[c][i], scale)
+			}
+		}
+		for r := 0; r < n; r++ {
+			if r == c || work[r][c] == 0 {
+				continue
+			}
+			factor := work[r][c]
+			for i := range work[r] {
+				work[r][i] ^= galMul(factor, work[c][i])
+			}
+		}
+	}
+	inv = newMatrix(n, n)
+	for r := 0; r < n; r++ {
+		copy(inv[r], work[r][n:])
+	}
+	return
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec
+
+// StripeSize returns the size of the data in a stripe.
+func StripeSize(dataNum int) uint64 {
+	return uint64(dataNum) * StripeUnitSize
+}
+
+// StripeNum returns the number of the stripes of an extent of the given size.
+func StripeNum(extentSize uint64, dataNum int) uint64 {
+	stripeSize := StripeSize(dataNum)
+	return (extentSize + stripeSize - 1) / stripeSize
+}
+
+// ShardSize returns the size of each shard of an extent of the given size. The last stripe is
+// padded with zeros, so all the shards are of the same size.
+func ShardSize(extentSize uint64, dataNum int) uint64 {
+	return StripeNum(extentSize, dataNum) * StripeUnitSize
+}
+
+// Unit locates a range of an extent in a unit of a stripe.
+type Unit struct {
+	Stripe      uint64 // index of the stripe
+	Index       int    // index of the data shard, i.e. the host
+	ShardOffset uint64 // offset in the shard
+	Size        uint64 // size of the range in the unit
+}
+
+// Locate splits the range [offset, offset+size) of an extent into the units of the stripes.
+func Locate(offset, size uint64, dataNum int) (units []Unit) {
+	stripeSize := StripeSize(dataNum)
+	for size > 0 {
+		stripe := offset / stripeSize
+		inStripe := offset % stripeSize
+		index := inStripe / StripeUnitSize
+		inUnit := inStripe % StripeUnitSize
+		n := StripeUnitSize - inUnit
+		if n > size {
+			n = size
+		}
+		units = append(units, Unit{
+			Stripe:      stripe,
+			Index:       int(index),
+			ShardOffset: stripe*StripeUnitSize + inUnit,
+			Size:        n,
+		})
+		offset += n
+		size -= n
+	}
+	return
+}
@@ -31,6 +31,9 @@ const (
 	requestTimeout = 30 * time.Second
 )
 
+// AuthTokenHeader is the HTTP header which carries the token to access the master.
+const AuthTokenHeader = "X-Auth-Token"
+
 var (
 	ErrNoValidMaster = errors.New("no valid master")
 )
@@ -41,12 +44,17 @@ type MasterHelper interface {
 	Nodes() []string
 	Leader() string
 	Request(method, path string, param map[string]string, body []byte) (data []byte, err error)
+	SetTokenFunc(fn TokenFunc)
 }
 
+// TokenFunc returns the token attached to each request sent to the master.
+type TokenFunc func() (token string, err error)
+
 type masterHelper struct {
 	sync.RWMutex
 	masters    []string
 	leaderAddr string
+	tokenFunc  TokenFunc
 }
 
 // AddNode add the given address as the master address.
@@ -64,6 +72,13 @@ func (helper *masterHelper) Leader() (addr string) {
 	return
 }
 
+// SetTokenFunc sets the function which generates the token of the requests.
+func (helper *masterHelper) SetTokenFunc(fn TokenFunc) {
+	helper.Lock()
+	helper.tokenFunc = fn
+	helper.Unlock()
+}
+
 // Change the leader address.
 func (helper *masterHelper) setLeader(addr string) {
 	helper.Lock()
@@ -171,6 +186,16 @@ func (helper *masterHelper) httpRequest(method, url string, param map[string]str
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Connection", "close")
+	helper.RLock()
+	tokenFunc := helper.tokenFunc
+	helper.RUnlock()
+	if tokenFunc != nil {
+		var token string
+		if token, err = tokenFunc(); err != nil {
+			return
+		}
+		req.Header.Set(AuthTokenHeader, token)
+	}
 	resp, err = client.Do(req)
 	return
 }